@@ -0,0 +1,8 @@
+-- Binlog event that triggered each conflict
+ALTER TABLE conflicts
+    ADD COLUMN binlog_file VARCHAR(255) NULL,
+    ADD COLUMN binlog_position BIGINT NULL,
+    ADD COLUMN gtid VARCHAR(255) NULL,
+    ADD COLUMN event_type VARCHAR(20) NULL,
+    ADD COLUMN event_before JSON NULL,
+    ADD COLUMN event_after JSON NULL;
@@ -0,0 +1,5 @@
+-- Source that produced the event behind each conflict
+ALTER TABLE conflicts
+    ADD COLUMN source_site VARCHAR(64) NULL,
+    ADD COLUMN source_host VARCHAR(255) NULL,
+    ADD COLUMN source_server_uuid VARCHAR(36) NULL;
@@ -0,0 +1,15 @@
+-- Events that could not be applied, kept for inspection and replay
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id VARCHAR(36) PRIMARY KEY,
+    run_id VARCHAR(36),
+    table_name VARCHAR(255),
+    event_type VARCHAR(20),
+    binlog_file VARCHAR(255) NULL,
+    binlog_position BIGINT NULL,
+    gtid VARCHAR(255) NULL,
+    payload JSON,
+    error_message TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_dead_letters_run ON dead_letters(run_id);
@@ -0,0 +1,3 @@
+-- What started each run: manual, scheduled or catch_up
+ALTER TABLE sync_history
+    ADD COLUMN trigger_type VARCHAR(20) NOT NULL DEFAULT 'manual';
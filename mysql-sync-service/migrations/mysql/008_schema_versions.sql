@@ -0,0 +1,14 @@
+-- Snapshots of each synced table's layout, one row per change
+CREATE TABLE IF NOT EXISTS schema_versions (
+    table_name VARCHAR(255),
+    version INT,
+    columns JSON,
+    primary_key JSON,
+    checksum VARCHAR(64),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (table_name, version)
+);
+
+-- Schema version in effect when each conflict and dead letter was recorded
+ALTER TABLE conflicts ADD COLUMN schema_version INT NULL;
+ALTER TABLE dead_letters ADD COLUMN schema_version INT NULL;
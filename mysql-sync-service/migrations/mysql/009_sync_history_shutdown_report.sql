@@ -0,0 +1,4 @@
+-- Where each run left off when it was stopped: drained events, final
+-- positions per table, dead letters
+ALTER TABLE sync_history
+    ADD COLUMN shutdown_report JSON NULL;
@@ -0,0 +1,16 @@
+-- Conflict resolutions being applied to both databases. An entry is
+-- written before either database is touched, so one left pending by a
+-- crash is finished, or rolled back, on restart
+CREATE TABLE IF NOT EXISTS resolution_intents (
+    id VARCHAR(36) PRIMARY KEY,
+    conflict_id VARCHAR(36) NOT NULL,
+    strategy VARCHAR(50) NOT NULL,
+    resolved_data JSON NULL,
+    status VARCHAR(20) NOT NULL,
+    local_applied BOOLEAN NOT NULL DEFAULT FALSE,
+    cloud_applied BOOLEAN NOT NULL DEFAULT FALSE,
+    error_message TEXT NULL,
+    created_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP NULL,
+    INDEX idx_resolution_intents_status (status)
+);
@@ -0,0 +1,4 @@
+-- Bumped each time a resolution claims the conflict, so two resolvers
+-- working from the same version can't both resolve it
+ALTER TABLE conflicts
+    ADD COLUMN version INT NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Range scans for the conflict and error heatmap
+CREATE INDEX idx_conflicts_detected ON conflicts(detected_at);
+CREATE INDEX idx_dead_letters_created ON dead_letters(created_at);
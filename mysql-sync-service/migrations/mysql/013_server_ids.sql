@@ -0,0 +1,10 @@
+-- Replication server IDs claimed by service instances on each source, so
+-- two instances reading one source never register with the same ID
+CREATE TABLE IF NOT EXISTS server_ids (
+    source VARCHAR(255) NOT NULL,
+    server_id INT UNSIGNED NOT NULL,
+    owner VARCHAR(255) NOT NULL,
+    claimed_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (source, server_id),
+    UNIQUE KEY uq_server_ids_owner (source, owner)
+);
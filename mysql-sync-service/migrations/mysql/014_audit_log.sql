@@ -0,0 +1,20 @@
+-- Every change applied to the target, when the audit log is kept in the
+-- state store. Row images are stored as hashes only.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id VARCHAR(36) PRIMARY KEY,
+    run_id VARCHAR(36) NOT NULL,
+    table_name VARCHAR(255) NOT NULL,
+    primary_key_value VARCHAR(255) NOT NULL,
+    operation VARCHAR(20) NOT NULL,
+    before_hash CHAR(64) NULL,
+    after_hash CHAR(64) NULL,
+    binlog_file VARCHAR(255) NULL,
+    binlog_position BIGINT NULL,
+    gtid VARCHAR(255) NULL,
+    worker INT NOT NULL,
+    latency_ms DOUBLE NOT NULL,
+    applied_at TIMESTAMP(6) NOT NULL
+);
+
+CREATE INDEX idx_audit_log_applied ON audit_log(applied_at);
+CREATE INDEX idx_audit_log_table ON audit_log(table_name, primary_key_value, applied_at);
@@ -0,0 +1,3 @@
+-- Lookups for the retention purge of resolved conflicts and their intents
+CREATE INDEX idx_conflicts_resolved_at ON conflicts(resolved, resolved_at);
+CREATE INDEX idx_resolution_intents_conflict ON resolution_intents(conflict_id);
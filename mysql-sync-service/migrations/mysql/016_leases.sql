@@ -0,0 +1,9 @@
+-- Leases elect the one instance that syncs among several sharing a
+-- config; the others take over once the holder stops renewing
+CREATE TABLE IF NOT EXISTS leases (
+    name VARCHAR(255) PRIMARY KEY,
+    holder VARCHAR(255) NOT NULL,
+    acquired_at DATETIME(6) NOT NULL,
+    renewed_at DATETIME(6) NOT NULL,
+    expires_at DATETIME(6) NOT NULL
+);
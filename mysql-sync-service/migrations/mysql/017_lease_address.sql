@@ -0,0 +1,3 @@
+-- Where the lease holder's API is reached, for standbys to health-check
+-- the leader
+ALTER TABLE leases ADD COLUMN address VARCHAR(512) NULL;
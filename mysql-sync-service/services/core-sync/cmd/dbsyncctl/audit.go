@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newAuditCmd(opts *clientOptions) *cobra.Command {
+	var (
+		table, pk, operation, runID string
+		since                       time.Duration
+		limit, offset               int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "List applied changes from the audit log, newest first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := url.Values{}
+			for name, value := range map[string]string{"table": table, "pk": pk, "operation": operation, "run_id": runID} {
+				if value != "" {
+					query.Set(name, value)
+				}
+			}
+			if since > 0 {
+				query.Set("from", time.Now().Add(-since).UTC().Format(time.RFC3339))
+			}
+			query.Set("limit", strconv.Itoa(limit))
+			query.Set("offset", strconv.Itoa(offset))
+
+			var resp struct {
+				Entries []struct {
+					Table      string    `json:"table"`
+					PrimaryKey string    `json:"primary_key"`
+					Operation  string    `json:"operation"`
+					BeforeHash string    `json:"before_hash"`
+					AfterHash  string    `json:"after_hash"`
+					BinlogFile string    `json:"binlog_file"`
+					BinlogPos  uint32    `json:"binlog_pos"`
+					Worker     int       `json:"worker"`
+					LatencyMs  float64   `json:"latency_ms"`
+					AppliedAt  time.Time `json:"applied_at"`
+				} `json:"entries"`
+			}
+			data, err := newClient(opts).do(cmd.Context(), http.MethodGet, "/audit?"+query.Encode(), nil, &resp)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			if len(resp.Entries) == 0 {
+				printf(cmd, "No audit entries\n")
+				return nil
+			}
+
+			short := func(hash string) string {
+				if len(hash) > 12 {
+					return hash[:12]
+				}
+				return orDash(hash)
+			}
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			defer tw.Flush()
+			fmt.Fprintf(tw, "APPLIED\tTABLE\tKEY\tOPERATION\tBEFORE\tAFTER\tPOSITION\tWORKER\tLATENCY\n")
+			for _, e := range resp.Entries {
+				position := "-"
+				if e.BinlogFile != "" {
+					position = fmt.Sprintf("%s:%d", e.BinlogFile, e.BinlogPos)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%.1fms\n", formatTime(e.AppliedAt), e.Table, orDash(e.PrimaryKey), e.Operation, short(e.BeforeHash), short(e.AfterHash), position, e.Worker, e.LatencyMs)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&table, "table", "", "only changes to this table")
+	cmd.Flags().StringVar(&pk, "pk", "", "only changes to the row with this primary key")
+	cmd.Flags().StringVar(&operation, "operation", "", "only insert, update or delete")
+	cmd.Flags().StringVar(&runID, "run", "", "only changes applied by this run")
+	cmd.Flags().DurationVar(&since, "since", 0, "only changes applied within this long, e.g. 24h")
+	cmd.Flags().IntVar(&limit, "limit", 50, "maximum number of entries")
+	cmd.Flags().IntVar(&offset, "offset", 0, "number of entries to skip")
+	return cmd
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type capabilityField struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required"`
+	Default     string   `json:"default"`
+	Enum        []string `json:"enum"`
+	Description string   `json:"description"`
+}
+
+type capabilityComponent struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	ConfigPath  string            `json:"config_path"`
+	Config      []capabilityField `json:"config"`
+}
+
+func newCapabilitiesCmd(opts *clientOptions) *cobra.Command {
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:   "capabilities",
+		Short: "List the sources, targets, sinks and strategies the server supports",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp struct {
+				Sources            []capabilityComponent `json:"sources"`
+				Targets            []capabilityComponent `json:"targets"`
+				Sinks              []capabilityComponent `json:"sinks"`
+				StoreBackends      []capabilityComponent `json:"store_backends"`
+				ConflictStrategies []capabilityComponent `json:"conflict_strategies"`
+				DeleteModes        []capabilityComponent `json:"delete_modes"`
+				Notifiers          []capabilityComponent `json:"notifiers"`
+			}
+			data, err := newClient(opts).do(cmd.Context(), http.MethodGet, "/capabilities", nil, &resp)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+
+			sections := []struct {
+				title      string
+				components []capabilityComponent
+			}{
+				{"Sources", resp.Sources},
+				{"Targets", resp.Targets},
+				{"Sinks", resp.Sinks},
+				{"State stores", resp.StoreBackends},
+				{"Conflict strategies", resp.ConflictStrategies},
+				{"Delete modes", resp.DeleteModes},
+				{"Notifiers", resp.Notifiers},
+			}
+			for i, section := range sections {
+				if i > 0 {
+					printf(cmd, "\n")
+				}
+				printf(cmd, "%s:\n", section.title)
+				for _, c := range section.components {
+					printf(cmd, "  %-18s %s\n", c.Name, c.Description)
+					if !verbose || len(c.Config) == 0 {
+						continue
+					}
+					printf(cmd, "    config under %s:\n", c.ConfigPath)
+					for _, f := range c.Config {
+						printf(cmd, "      %s (%s)%s\n", f.Name, f.Type, fieldDetails(f))
+					}
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "also list each component's config fields")
+	return cmd
+}
+
+func fieldDetails(f capabilityField) string {
+	var details []string
+	if f.Required {
+		details = append(details, "required")
+	}
+	if f.Default != "" {
+		details = append(details, "default "+f.Default)
+	}
+	if len(f.Enum) > 0 {
+		details = append(details, "one of "+strings.Join(f.Enum, " | "))
+	}
+	if f.Description != "" {
+		details = append(details, f.Description)
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return ": " + strings.Join(details, "; ")
+}
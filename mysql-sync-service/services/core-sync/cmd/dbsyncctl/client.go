@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type clientOptions struct {
+	server  string
+	token   string
+	timeout time.Duration
+	json    bool
+}
+
+// client is a thin wrapper around the /api/v1 HTTP endpoints.
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func newClient(opts *clientOptions) *client {
+	return &client{
+		baseURL: strings.TrimRight(opts.server, "/") + "/api/v1",
+		token:   opts.token,
+		http:    &http.Client{Timeout: opts.timeout},
+	}
+}
+
+// apiError mirrors the service's JSON error envelope.
+type apiError struct {
+	Status    int         `json:"-"`
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+func (e *apiError) Error() string {
+	msg := fmt.Sprintf("%s (%d %s)", e.Message, e.Status, e.Code)
+	if e.RequestID != "" {
+		msg += ", request id " + e.RequestID
+	}
+	return msg
+}
+
+func (c *client) newRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// do sends a request and returns the raw response body. If out is non-nil
+// the body is also decoded into it.
+func (c *client) do(ctx context.Context, method, path string, body, out interface{}) ([]byte, error) {
+	req, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, decodeError(resp.StatusCode, data)
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return data, nil
+}
+
+// stream opens a long-lived request without the client timeout.
+func (c *client) stream(ctx context.Context, path string) (*http.Response, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return nil, decodeError(resp.StatusCode, data)
+	}
+	return resp, nil
+}
+
+func decodeError(status int, data []byte) error {
+	var envelope struct {
+		Error *apiError `json:"error"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Error == nil {
+		return &apiError{Status: status, Code: http.StatusText(status), Message: strings.TrimSpace(string(data))}
+	}
+	envelope.Error.Status = status
+	return envelope.Error
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type conflict struct {
+	ID                 string          `json:"id"`
+	TableName          string          `json:"table_name"`
+	PrimaryKeyValue    string          `json:"primary_key_value"`
+	ConflictType       string          `json:"conflict_type"`
+	LocalData          json.RawMessage `json:"local_data"`
+	CloudData          json.RawMessage `json:"cloud_data"`
+	DetectedAt         time.Time       `json:"detected_at"`
+	Resolved           bool            `json:"resolved"`
+	ResolutionStrategy string          `json:"resolution_strategy"`
+	Version            int             `json:"version"`
+	Event              *struct {
+		Type           string `json:"type"`
+		BinlogFile     string `json:"binlog_file"`
+		BinlogPosition int64  `json:"binlog_position"`
+		GTID           string `json:"gtid"`
+	} `json:"event"`
+	Diff []columnDiff `json:"diff"`
+}
+
+type columnDiff struct {
+	Column    string      `json:"column"`
+	Local     interface{} `json:"local"`
+	Cloud     interface{} `json:"cloud"`
+	LocalType string      `json:"local_type"`
+	CloudType string      `json:"cloud_type"`
+}
+
+type columnChange struct {
+	Column string      `json:"column"`
+	From   interface{} `json:"from"`
+	To     interface{} `json:"to"`
+}
+
+func newConflictsCmd(opts *clientOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "conflicts",
+		Aliases: []string{"conflict"},
+		Short:   "Inspect and resolve sync conflicts",
+	}
+	cmd.AddCommand(newConflictsListCmd(opts), newConflictsShowCmd(opts), newConflictsPreviewCmd(opts), newConflictsResolveCmd(opts), newConflictsResolveAllCmd(opts), newConflictsPurgeCmd(opts))
+	return cmd
+}
+
+func newConflictsListCmd(opts *clientOptions) *cobra.Command {
+	var (
+		resolved bool
+		limit    int
+		offset   int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List conflicts",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conflicts, data, err := listConflicts(cmd, opts, resolved, limit, offset)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			if len(conflicts) == 0 {
+				printf(cmd, "No conflicts\n")
+				return nil
+			}
+
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			defer tw.Flush()
+			fmt.Fprintf(tw, "ID\tTABLE\tPRIMARY KEY\tTYPE\tDETECTED\tRESOLUTION\n")
+			for _, c := range conflicts {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.ID, c.TableName, c.PrimaryKeyValue, c.ConflictType, formatTime(c.DetectedAt), orDash(c.ResolutionStrategy))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&resolved, "resolved", false, "list resolved conflicts instead of open ones")
+	cmd.Flags().IntVar(&limit, "limit", 50, "maximum number of conflicts")
+	cmd.Flags().IntVar(&offset, "offset", 0, "number of conflicts to skip")
+	return cmd
+}
+
+func newConflictsShowCmd(opts *clientOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a conflict with both row versions",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var c conflict
+			data, err := newClient(opts).do(cmd.Context(), http.MethodGet, "/conflicts/"+url.PathEscape(args[0]), nil, &c)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			printConflict(cmd, &c)
+			return nil
+		},
+	}
+}
+
+func newConflictsPreviewCmd(opts *clientOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "preview <id>",
+		Short: "Show what each strategy would resolve a conflict to, without resolving it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var preview struct {
+				Options []struct {
+					Strategy     string         `json:"strategy"`
+					Default      bool           `json:"default"`
+					Delete       bool           `json:"delete"`
+					LocalChanges []columnChange `json:"local_changes"`
+					CloudChanges []columnChange `json:"cloud_changes"`
+					Error        string         `json:"error"`
+				} `json:"options"`
+			}
+			data, err := newClient(opts).do(cmd.Context(), http.MethodGet, "/conflicts/"+url.PathEscape(args[0])+"/preview", nil, &preview)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			for _, option := range preview.Options {
+				title := option.Strategy
+				if option.Default {
+					title += " (default)"
+				}
+				printf(cmd, "%s\n", title)
+				switch {
+				case option.Error != "":
+					printf(cmd, "  not possible: %s\n", option.Error)
+					continue
+				case option.Delete:
+					printf(cmd, "  deletes the row\n")
+				}
+				for _, side := range []struct {
+					name    string
+					changes []columnChange
+				}{{"local", option.LocalChanges}, {"cloud", option.CloudChanges}} {
+					if len(side.changes) == 0 {
+						printf(cmd, "  %s: unchanged\n", side.name)
+						continue
+					}
+					for _, change := range side.changes {
+						printf(cmd, "  %s: %s %v -> %v\n", side.name, change.Column, change.From, change.To)
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func newConflictsResolveCmd(opts *clientOptions) *cobra.Command {
+	var (
+		strategy string
+		dataFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "resolve [id]",
+		Short: "Resolve one conflict, or walk through open conflicts interactively",
+		Long: `Resolve a conflict by id with --strategy local_wins|cloud_wins|last_write_wins|manual.
+The server writes the kept row to both databases.
+
+Without an id, open conflicts are shown one at a time and you choose which
+row version to keep.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return resolveInteractive(cmd, opts)
+			}
+
+			var c conflict
+			if _, err := newClient(opts).do(cmd.Context(), http.MethodGet, "/conflicts/"+url.PathEscape(args[0]), nil, &c); err != nil {
+				return err
+			}
+
+			var resolved json.RawMessage
+			switch strategy {
+			case "local_wins":
+				resolved = c.LocalData
+			case "cloud_wins":
+				resolved = c.CloudData
+			case "last_write_wins":
+				// The server compares the rows on the table's timestamp column
+			case "manual":
+				if dataFile == "" {
+					return fmt.Errorf("--data is required for manual resolution")
+				}
+				data, err := readDataFile(cmd, dataFile)
+				if err != nil {
+					return err
+				}
+				resolved = data
+			case "":
+				return fmt.Errorf("--strategy is required when an id is given")
+			default:
+				return fmt.Errorf("unknown strategy %q", strategy)
+			}
+
+			return resolveConflict(cmd, opts, &c, strategy, resolved)
+		},
+	}
+	cmd.Flags().StringVar(&strategy, "strategy", "", "local_wins, cloud_wins, last_write_wins or manual")
+	cmd.Flags().StringVar(&dataFile, "data", "", "JSON file with the row to keep for manual resolution, - for stdin")
+	return cmd
+}
+
+func newConflictsResolveAllCmd(opts *clientOptions) *cobra.Command {
+	var (
+		strategy string
+		tables   []string
+		ids      []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "resolve-all",
+		Short: "Resolve many conflicts with one strategy in the background",
+		Long: `Resolve the conflicts given with --ids, or every open conflict of --tables
+(default: every table the token may access), with --strategy
+local_wins|cloud_wins|last_write_wins|default, default resolving each with
+its table's default for the conflict's type. The server resolves them in
+the background; follow it with dbsyncctl operations --wait <id>.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if strategy == "" {
+				return fmt.Errorf("--strategy is required")
+			}
+			body := map[string]interface{}{"strategy": strategy, "tables": tables, "ids": ids}
+			var op operation
+			data, err := newClient(opts).do(cmd.Context(), http.MethodPost, "/conflicts/resolve", body, &op)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			printf(cmd, "resolving conflicts, follow it with: dbsyncctl operations --wait %s\n", op.ID)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&strategy, "strategy", "", "local_wins, cloud_wins, last_write_wins or default")
+	cmd.Flags().StringSliceVar(&tables, "tables", nil, "resolve the open conflicts of these tables")
+	cmd.Flags().StringSliceVar(&ids, "ids", nil, "resolve these conflicts")
+	return cmd
+}
+
+func newConflictsPurgeCmd(opts *clientOptions) *cobra.Command {
+	var (
+		olderThan  string
+		tables     []string
+		unresolved bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Delete conflicts resolved longer ago than --older-than",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if olderThan == "" {
+				return fmt.Errorf("--older-than is required")
+			}
+			query := url.Values{"older_than": {olderThan}, "table": tables}
+			if unresolved {
+				query.Set("unresolved", "true")
+			}
+			var resp struct {
+				Purged int64 `json:"purged"`
+			}
+			data, err := newClient(opts).do(cmd.Context(), http.MethodDelete, "/conflicts/purge?"+query.Encode(), nil, &resp)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			printf(cmd, "purged %d conflicts\n", resp.Purged)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&olderThan, "older-than", "", "age cutoff, e.g. 30d or 720h")
+	cmd.Flags().StringSliceVar(&tables, "tables", nil, "only purge conflicts of these tables")
+	cmd.Flags().BoolVar(&unresolved, "unresolved", false, "also purge conflicts detected before the cutoff and never resolved")
+	return cmd
+}
+
+func resolveInteractive(cmd *cobra.Command, opts *clientOptions) error {
+	conflicts, _, err := listConflicts(cmd, opts, false, 100, 0)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) == 0 {
+		printf(cmd, "No open conflicts\n")
+		return nil
+	}
+
+	in := bufio.NewReader(cmd.InOrStdin())
+	for i := range conflicts {
+		c := &conflicts[i]
+		printf(cmd, "\n[%d/%d] ", i+1, len(conflicts))
+		printConflict(cmd, c)
+
+		for {
+			printf(cmd, "\nKeep [l]ocal, [c]loud, [s]kip or [q]uit? ")
+			answer, err := in.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return err
+			}
+
+			choice := strings.ToLower(strings.TrimSpace(answer))
+			switch choice {
+			case "l", "local":
+				if err := resolveConflict(cmd, opts, c, "local_wins", c.LocalData); err != nil {
+					return err
+				}
+			case "c", "cloud":
+				if err := resolveConflict(cmd, opts, c, "cloud_wins", c.CloudData); err != nil {
+					return err
+				}
+			case "s", "skip":
+			case "q", "quit":
+				return nil
+			default:
+				if err == io.EOF {
+					return nil
+				}
+				continue
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func listConflicts(cmd *cobra.Command, opts *clientOptions, resolved bool, limit, offset int) ([]conflict, []byte, error) {
+	query := url.Values{}
+	query.Set("resolved", strconv.FormatBool(resolved))
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("offset", strconv.Itoa(offset))
+
+	var resp struct {
+		Conflicts []conflict `json:"conflicts"`
+	}
+	data, err := newClient(opts).do(cmd.Context(), http.MethodGet, "/conflicts?"+query.Encode(), nil, &resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Conflicts, data, nil
+}
+
+// resolveConflict resolves c unless it changed since it was fetched.
+func resolveConflict(cmd *cobra.Command, opts *clientOptions, c *conflict, strategy string, resolved json.RawMessage) error {
+	body := map[string]interface{}{"strategy": strategy, "resolved_data": resolved, "version": c.Version}
+	if _, err := newClient(opts).do(cmd.Context(), http.MethodPost, "/conflicts/"+url.PathEscape(c.ID)+"/resolve", body, nil); err != nil {
+		return err
+	}
+	printf(cmd, "Resolved %s with %s\n", c.ID, strategy)
+	return nil
+}
+
+func printConflict(cmd *cobra.Command, c *conflict) {
+	printf(cmd, "Conflict %s\n", c.ID)
+	printf(cmd, "  Table:       %s\n", c.TableName)
+	printf(cmd, "  Primary key: %s\n", c.PrimaryKeyValue)
+	printf(cmd, "  Type:        %s\n", c.ConflictType)
+	printf(cmd, "  Detected:    %s\n", formatTime(c.DetectedAt))
+	if c.Resolved {
+		printf(cmd, "  Resolution:  %s\n", c.ResolutionStrategy)
+	}
+	if c.Event != nil {
+		printf(cmd, "  Event:       %s at %s:%d %s\n", c.Event.Type, c.Event.BinlogFile, c.Event.BinlogPosition, c.Event.GTID)
+	}
+	printf(cmd, "  Local:       %s\n", c.LocalData)
+	printf(cmd, "  Cloud:       %s\n", c.CloudData)
+	if len(c.Diff) > 0 {
+		printf(cmd, "  Differs in:\n")
+		tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		for _, d := range c.Diff {
+			fmt.Fprintf(tw, "    %s\tlocal %v (%s)\tcloud %v (%s)\n", d.Column, d.Local, d.LocalType, d.Cloud, d.CloudType)
+		}
+		tw.Flush()
+	}
+}
+
+func readDataFile(cmd *cobra.Command, path string) (json.RawMessage, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = io.ReadAll(cmd.InOrStdin())
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("%s is not valid JSON", path)
+	}
+	return json.RawMessage(data), nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newEventsCmd(opts *clientOptions) *cobra.Command {
+	var table string
+
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Tail the live sync event stream",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "/sync/events"
+			if table != "" {
+				path += "?table=" + url.QueryEscape(table)
+			}
+
+			resp, err := newClient(opts).stream(cmd.Context(), path)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+				if !ok {
+					continue
+				}
+				if opts.json {
+					printf(cmd, "%s\n", data)
+					continue
+				}
+				printEvent(cmd, data)
+			}
+			if cmd.Context().Err() != nil {
+				return nil
+			}
+			return scanner.Err()
+		},
+	}
+	cmd.Flags().StringVarP(&table, "table", "t", "", "only show events for this table")
+	return cmd
+}
+
+func printEvent(cmd *cobra.Command, data string) {
+	var e struct {
+		Type       string    `json:"type"`
+		RunID      string    `json:"run_id"`
+		Table      string    `json:"table"`
+		Status     string    `json:"status"`
+		Events     int       `json:"events"`
+		BinlogFile string    `json:"binlog_file"`
+		BinlogPos  uint32    `json:"binlog_position"`
+		Error      string    `json:"error"`
+		Time       time.Time `json:"time"`
+
+		Progress *snapshotProgress `json:"progress"`
+	}
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		printf(cmd, "%s\n", data)
+		return
+	}
+
+	switch {
+	case e.Progress != nil && e.Error == "":
+		p := e.Progress
+		printf(cmd, "%s  %-14s %-20s rows=%d/%d (%.1f%%) rate=%.0f/s status=%s\n", formatTime(e.Time), e.Type, e.Table, p.RowsCopied, p.EstimatedRows, p.Percent, p.RowsPerSecond, e.Status)
+	case e.Error != "":
+		printf(cmd, "%s  %-14s %-20s events=%d error=%s\n", formatTime(e.Time), e.Type, e.Table, e.Events, e.Error)
+	case e.Table != "":
+		printf(cmd, "%s  %-14s %-20s events=%d pos=%s:%d status=%s\n", formatTime(e.Time), e.Type, e.Table, e.Events, e.BinlogFile, e.BinlogPos, e.Status)
+	default:
+		printf(cmd, "%s  %-14s run=%s status=%s\n", formatTime(e.Time), e.Type, e.RunID, e.Status)
+	}
+}
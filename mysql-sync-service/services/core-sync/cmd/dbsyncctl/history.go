@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newHistoryCmd(opts *clientOptions) *cobra.Command {
+	var limit, offset int
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Dump past sync runs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := url.Values{}
+			query.Set("limit", strconv.Itoa(limit))
+			query.Set("offset", strconv.Itoa(offset))
+
+			var resp struct {
+				History []struct {
+					ID                string     `json:"id"`
+					StartedAt         time.Time  `json:"started_at"`
+					CompletedAt       *time.Time `json:"completed_at"`
+					Direction         string     `json:"direction"`
+					TotalRows         int64      `json:"total_rows"`
+					ConflictsDetected int        `json:"conflicts_detected"`
+					Status            string     `json:"status"`
+					ErrorMessage      string     `json:"error_message"`
+					Trigger           string     `json:"trigger"`
+				} `json:"history"`
+			}
+			data, err := newClient(opts).do(cmd.Context(), http.MethodGet, "/sync/history?"+query.Encode(), nil, &resp)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			if len(resp.History) == 0 {
+				printf(cmd, "No sync history\n")
+				return nil
+			}
+
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			defer tw.Flush()
+			fmt.Fprintf(tw, "ID\tSTARTED\tCOMPLETED\tTRIGGER\tDIRECTION\tROWS\tCONFLICTS\tSTATUS\tERROR\n")
+			for _, h := range resp.History {
+				completed := "-"
+				if h.CompletedAt != nil {
+					completed = formatTime(*h.CompletedAt)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n", h.ID, formatTime(h.StartedAt), completed, orDash(h.Trigger), h.Direction, h.TotalRows, h.ConflictsDetected, h.Status, orDash(h.ErrorMessage))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&limit, "limit", 50, "maximum number of runs")
+	cmd.Flags().IntVar(&offset, "offset", 0, "number of runs to skip")
+	return cmd
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type scheduledRun struct {
+	Job     string    `json:"job"`
+	Trigger string    `json:"trigger"`
+	Time    time.Time `json:"time"`
+	Outcome string    `json:"outcome"`
+	Reason  string    `json:"reason"`
+}
+
+type scheduledJob struct {
+	Name     string        `json:"name"`
+	Job      string        `json:"job"`
+	Tables   []string      `json:"tables"`
+	Schedule string        `json:"schedule"`
+	Enabled  bool          `json:"enabled"`
+	NextRun  *time.Time    `json:"next_run"`
+	LastRun  *scheduledRun `json:"last_run"`
+}
+
+func newJobsCmd(opts *clientOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "List the scheduler's named jobs with their next and last runs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp struct {
+				Jobs []scheduledJob `json:"jobs"`
+			}
+			data, err := newClient(opts).do(cmd.Context(), http.MethodGet, "/scheduler/jobs", nil, &resp)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			if len(resp.Jobs) == 0 {
+				printf(cmd, "No scheduled jobs\n")
+				return nil
+			}
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tJOB\tTABLES\tSCHEDULE\tENABLED\tNEXT RUN\tLAST RUN")
+			for _, job := range resp.Jobs {
+				next := "-"
+				if job.NextRun != nil {
+					next = formatTime(*job.NextRun)
+				}
+				last := "-"
+				if job.LastRun != nil {
+					last = fmt.Sprintf("%s %s", formatTime(job.LastRun.Time), job.LastRun.Outcome)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%t\t%s\t%s\n", job.Name, job.Job, orDash(strings.Join(job.Tables, ",")), job.Schedule, job.Enabled, next, last)
+			}
+			return tw.Flush()
+		},
+	}
+	cmd.AddCommand(newJobsRunCmd(opts), newJobsSetCmd(opts))
+	return cmd
+}
+
+func newJobsRunCmd(opts *clientOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "run <name>",
+		Short: "Run a scheduled job now, even a disabled one",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var run scheduledRun
+			data, err := newClient(opts).do(cmd.Context(), http.MethodPost, "/scheduler/jobs/"+url.PathEscape(args[0])+"/run", nil, &run)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			if run.Reason != "" {
+				printf(cmd, "%s: %s (%s)\n", args[0], run.Outcome, run.Reason)
+			} else {
+				printf(cmd, "%s: %s\n", args[0], run.Outcome)
+			}
+			return nil
+		},
+	}
+}
+
+func newJobsSetCmd(opts *clientOptions) *cobra.Command {
+	var schedule string
+	var enable, disable bool
+
+	cmd := &cobra.Command{
+		Use:   "set <name>",
+		Short: "Change a scheduled job's cron expression, or enable or disable it",
+		Long: "Change a scheduled job's cron expression, or enable or disable it. The change\n" +
+			"is kept by the server across restarts.\n\n" +
+			"  dbsyncctl jobs set weekly-verify --schedule \"0 4 * * 0\"\n" +
+			"  dbsyncctl jobs set orders-incremental --disable",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if enable && disable {
+				return fmt.Errorf("--enable and --disable are mutually exclusive")
+			}
+			body := map[string]interface{}{}
+			if schedule != "" {
+				body["schedule"] = schedule
+			}
+			if enable || disable {
+				body["enabled"] = enable
+			}
+			if len(body) == 0 {
+				return fmt.Errorf("nothing to change: pass --schedule, --enable or --disable")
+			}
+
+			var job scheduledJob
+			data, err := newClient(opts).do(cmd.Context(), http.MethodPatch, "/scheduler/jobs/"+url.PathEscape(args[0]), body, &job)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			state := "disabled"
+			if job.Enabled {
+				state = "enabled"
+			}
+			printf(cmd, "%s: %s, %s\n", job.Name, job.Schedule, state)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&schedule, "schedule", "", "cron expression, e.g. \"*/5 * * * *\"")
+	cmd.Flags().BoolVar(&enable, "enable", false, "schedule the job")
+	cmd.Flags().BoolVar(&disable, "disable", false, "stop scheduling the job; it can still be run by hand")
+	return cmd
+}
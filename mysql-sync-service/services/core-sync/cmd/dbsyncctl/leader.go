@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type leaderStatus struct {
+	Enabled   bool       `json:"enabled"`
+	Instance  string     `json:"instance"`
+	Lease     string     `json:"lease"`
+	Role      string     `json:"role"`
+	Leader    bool       `json:"leader"`
+	Holder    string     `json:"holder"`
+	Address   string     `json:"address"`
+	Since     *time.Time `json:"since"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Standby   *struct {
+		LeaderHealthy  bool       `json:"leader_healthy"`
+		Reason         string     `json:"reason"`
+		UnhealthySince *time.Time `json:"unhealthy_since"`
+		PromotesAt     *time.Time `json:"promotes_at"`
+		CheckedAt      *time.Time `json:"checked_at"`
+		Checkpoints    []struct {
+			Table          string     `json:"table"`
+			BinlogFile     string     `json:"binlog_file"`
+			BinlogPosition int64      `json:"binlog_position"`
+			LastSyncTime   *time.Time `json:"last_sync_time"`
+			UpdatedAt      time.Time  `json:"updated_at"`
+		} `json:"checkpoints"`
+	} `json:"standby"`
+}
+
+// summary is the instance's role in one line.
+func (l *leaderStatus) summary() string {
+	switch {
+	case !l.Enabled:
+		return "leader (election disabled)"
+	case l.Leader:
+		return fmt.Sprintf("leader, as %s", l.Instance)
+	case l.Holder == "":
+		return fmt.Sprintf("standby, as %s, no leader", l.Instance)
+	default:
+		return fmt.Sprintf("standby, as %s, %s leads", l.Instance, l.Holder)
+	}
+}
+
+func newLeaderCmd(opts *clientOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "leader",
+		Short: "Show which instance is active, and what a standby knows of it",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp leaderStatus
+			data, err := newClient(opts).do(cmd.Context(), http.MethodGet, "/sync/leader", nil, &resp)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+
+			printf(cmd, "Role:      %s\n", resp.summary())
+			if !resp.Enabled {
+				return nil
+			}
+			printf(cmd, "Lease:     %s\n", resp.Lease)
+			if resp.Holder != "" {
+				printf(cmd, "Leader:    %s at %s\n", resp.Holder, orDash(resp.Address))
+			}
+			if resp.Since != nil {
+				printf(cmd, "Since:     %s\n", formatTime(*resp.Since))
+			}
+			if resp.ExpiresAt != nil {
+				printf(cmd, "Expires:   %s\n", formatTime(*resp.ExpiresAt))
+			}
+			s := resp.Standby
+			if s == nil {
+				return nil
+			}
+			if s.LeaderHealthy {
+				printf(cmd, "Health:    healthy\n")
+			} else {
+				printf(cmd, "Health:    unhealthy: %s\n", s.Reason)
+			}
+			if s.UnhealthySince != nil && s.PromotesAt != nil {
+				printf(cmd, "Failover:  unhealthy since %s, promoting at %s\n", formatTime(*s.UnhealthySince), formatTime(*s.PromotesAt))
+			}
+			if s.CheckedAt != nil {
+				printf(cmd, "Checked:   %s\n", formatTime(*s.CheckedAt))
+			}
+			if len(s.Checkpoints) == 0 {
+				return nil
+			}
+			printf(cmd, "\n")
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "TABLE\tBINLOG\tLAST SYNC\tUPDATED")
+			for _, c := range s.Checkpoints {
+				position := "-"
+				if c.BinlogFile != "" {
+					position = fmt.Sprintf("%s:%d", c.BinlogFile, c.BinlogPosition)
+				}
+				synced := "-"
+				if c.LastSyncTime != nil {
+					synced = formatTime(*c.LastSyncTime)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Table, position, synced, formatTime(c.UpdatedAt))
+			}
+			return tw.Flush()
+		},
+	}
+}
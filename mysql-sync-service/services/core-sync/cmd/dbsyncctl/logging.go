@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+type debugSampling struct {
+	Initial    int `json:"initial"`
+	Thereafter int `json:"thereafter"`
+}
+
+type logConfig struct {
+	Level         string            `json:"level,omitempty"`
+	Modules       map[string]string `json:"modules,omitempty"`
+	DebugSampling *debugSampling    `json:"debug_sampling,omitempty"`
+}
+
+func newLogLevelCmd(opts *clientOptions) *cobra.Command {
+	var modules map[string]string
+	var sampling []int
+
+	cmd := &cobra.Command{
+		Use:   "loglevel [level]",
+		Short: "Show or change log levels and debug sampling without restarting the server",
+		Long: "Show or change log levels and debug sampling without restarting the server.\n\n" +
+			"  dbsyncctl loglevel info --module sync=debug --module store=\n" +
+			"  dbsyncctl loglevel --sampling 10,100",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var change logConfig
+			if len(args) == 1 {
+				change.Level = args[0]
+			}
+			if cmd.Flags().Changed("module") {
+				change.Modules = modules
+			}
+			if cmd.Flags().Changed("sampling") {
+				if len(sampling) != 2 {
+					return fmt.Errorf("--sampling takes initial,thereafter")
+				}
+				change.DebugSampling = &debugSampling{Initial: sampling[0], Thereafter: sampling[1]}
+			}
+
+			c := newClient(opts)
+			var current logConfig
+			var data []byte
+			var err error
+			if change.Level != "" || change.Modules != nil || change.DebugSampling != nil {
+				data, err = c.do(cmd.Context(), http.MethodPut, "/logging/level", change, &current)
+			} else {
+				data, err = c.do(cmd.Context(), http.MethodGet, "/logging/level", nil, &current)
+			}
+			if err != nil {
+				return err
+			}
+
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			printf(cmd, "Level:           %s\n", current.Level)
+			names := make([]string, 0, len(current.Modules))
+			for name := range current.Modules {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				printf(cmd, "  %-14s %s\n", name, current.Modules[name])
+			}
+			if s := current.DebugSampling; s != nil && s.Initial > 0 {
+				printf(cmd, "Debug sampling:  first %d per message per second, then every %d\n", s.Initial, s.Thereafter)
+			} else {
+				printf(cmd, "Debug sampling:  off\n")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringToStringVar(&modules, "module", nil, "module=level, e.g. sync=debug; an empty level returns it to the default")
+	cmd.Flags().IntSliceVar(&sampling, "sampling", nil, "debug sampling as initial,thereafter; 0,0 turns it off")
+	return cmd
+}
@@ -0,0 +1,88 @@
+// Command dbsyncctl is an operator CLI for the sync service HTTP API.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	// Ctrl-C ends streaming and watch commands cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := newRootCmd().ExecuteContext(ctx); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCmd() *cobra.Command {
+	opts := &clientOptions{}
+
+	root := &cobra.Command{
+		Use:          "dbsyncctl",
+		Short:        "Control a running MySQL sync service",
+		SilenceUsage: true,
+	}
+
+	root.PersistentFlags().StringVarP(&opts.server, "server", "s", envOr("DBSYNC_SERVER", "http://localhost:8080"), "sync service base URL (env DBSYNC_SERVER)")
+	root.PersistentFlags().StringVar(&opts.token, "token", os.Getenv("DBSYNC_TOKEN"), "API auth token (env DBSYNC_TOKEN)")
+	root.PersistentFlags().DurationVar(&opts.timeout, "timeout", 30*time.Second, "request timeout, ignored when streaming")
+	root.PersistentFlags().BoolVarP(&opts.json, "json", "j", false, "print raw JSON responses")
+
+	root.AddCommand(
+		newTriggerCmd(opts),
+		newReplayCmd(opts),
+		newResyncCmd(opts),
+		newStopCmd(opts),
+		newRestartCmd(opts),
+		newPauseCmd(opts),
+		newResumeCmd(opts),
+		newStatusCmd(opts),
+		newLeaderCmd(opts),
+		newLagCmd(opts),
+		newProgressCmd(opts),
+		newThrottleCmd(opts),
+		newTuningCmd(opts),
+		newConflictsCmd(opts),
+		newEventsCmd(opts),
+		newHistoryCmd(opts),
+		newAuditCmd(opts),
+		newOperationsCmd(opts),
+		newJobsCmd(opts),
+		newLogLevelCmd(opts),
+		newCapabilitiesCmd(opts),
+	)
+	return root
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func printf(cmd *cobra.Command, format string, args ...interface{}) {
+	fmt.Fprintf(cmd.OutOrStdout(), format, args...)
+}
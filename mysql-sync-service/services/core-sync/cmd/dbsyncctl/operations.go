@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type operation struct {
+	ID       string   `json:"id"`
+	Kind     string   `json:"kind"`
+	State    string   `json:"state"`
+	Tables   []string `json:"tables"`
+	Progress struct {
+		Done  int64  `json:"done"`
+		Total int64  `json:"total"`
+		Unit  string `json:"unit"`
+	} `json:"progress"`
+	Error      string     `json:"error"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+func (o operation) progress() string {
+	if o.Progress.Total > 0 {
+		return fmt.Sprintf("%d/%d %s", o.Progress.Done, o.Progress.Total, o.Progress.Unit)
+	}
+	return fmt.Sprintf("%d %s", o.Progress.Done, o.Progress.Unit)
+}
+
+func newOperationsCmd(opts *clientOptions) *cobra.Command {
+	var (
+		wait     bool
+		interval time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:     "operations [id]",
+		Aliases: []string{"operation", "ops"},
+		Short:   "List long-running operations, or show one by id",
+		Long: `List resyncs, key rotations and bulk conflict resolutions started through
+the API, newest first, or show one by id. With --wait, poll the operation
+until it is done; the command fails if the operation did not succeed.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return listOperations(cmd, opts)
+			}
+
+			path := "/operations/" + url.PathEscape(args[0])
+			for {
+				var op operation
+				data, err := newClient(opts).do(cmd.Context(), http.MethodGet, path, nil, &op)
+				if err != nil {
+					return err
+				}
+				done := op.State != "running"
+				if !wait || done {
+					if opts.json {
+						printf(cmd, "%s\n", data)
+					} else {
+						printf(cmd, "Operation:  %s (%s)\n", op.ID, op.Kind)
+						printf(cmd, "State:      %s\n", op.State)
+						printf(cmd, "Progress:   %s\n", op.progress())
+						printf(cmd, "Started:    %s\n", formatTime(op.StartedAt))
+						if op.FinishedAt != nil {
+							printf(cmd, "Finished:   %s\n", formatTime(*op.FinishedAt))
+						}
+						if op.Error != "" {
+							printf(cmd, "Error:      %s\n", op.Error)
+						}
+					}
+					if wait && op.State != "succeeded" {
+						return fmt.Errorf("operation %s %s", op.ID, op.State)
+					}
+					return nil
+				}
+				if !opts.json {
+					printf(cmd, "%s: %s\n", op.State, op.progress())
+				}
+				select {
+				case <-cmd.Context().Done():
+					return cmd.Context().Err()
+				case <-time.After(interval):
+				}
+			}
+		},
+	}
+	cmd.Flags().BoolVarP(&wait, "wait", "w", false, "poll the operation until it is done")
+	cmd.Flags().DurationVar(&interval, "interval", 2*time.Second, "how often to poll with --wait")
+	return cmd
+}
+
+func listOperations(cmd *cobra.Command, opts *clientOptions) error {
+	var resp struct {
+		Operations []operation `json:"operations"`
+	}
+	data, err := newClient(opts).do(cmd.Context(), http.MethodGet, "/operations", nil, &resp)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		printf(cmd, "%s\n", data)
+		return nil
+	}
+	if len(resp.Operations) == 0 {
+		printf(cmd, "No operations\n")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintf(tw, "ID\tKIND\tTABLES\tSTATE\tPROGRESS\tSTARTED\tERROR\n")
+	for _, op := range resp.Operations {
+		tables := "-"
+		if len(op.Tables) > 0 {
+			tables = fmt.Sprint(op.Tables)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", op.ID, op.Kind, tables, op.State, op.progress(), formatTime(op.StartedAt), orDash(op.Error))
+	}
+	return nil
+}
@@ -0,0 +1,601 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type tableLag struct {
+	Table         string    `json:"table"`
+	LagSeconds    float64   `json:"lag_seconds"`
+	ThresholdSecs float64   `json:"threshold_seconds"`
+	Status        string    `json:"status"`
+	LastEventTime time.Time `json:"last_event_time"`
+	LastAppliedAt time.Time `json:"last_applied_at"`
+}
+
+type queueBacklog struct {
+	Type            string     `json:"type"`
+	Persistent      bool       `json:"persistent"`
+	MemoryEvents    int        `json:"memory_events"`
+	SpilledEvents   int        `json:"spilled_events"`
+	SpilledBytes    int64      `json:"spilled_bytes"`
+	OldestSpilledAt *time.Time `json:"oldest_spilled_at"`
+	OldestPosition  string     `json:"oldest_position"`
+	AgeSeconds      float64    `json:"age_seconds"`
+}
+
+type largeTransaction struct {
+	GTID        string    `json:"gtid"`
+	RowsRead    int       `json:"rows_read"`
+	RowsApplied int       `json:"rows_applied"`
+	RowsFailed  int       `json:"rows_failed"`
+	Committed   bool      `json:"committed"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
+type tableObservation struct {
+	Table     string `json:"table"`
+	Inserts   int64  `json:"inserts"`
+	Updates   int64  `json:"updates"`
+	Deletes   int64  `json:"deletes"`
+	Unchanged int64  `json:"unchanged"`
+	Conflicts int64  `json:"conflicts"`
+}
+
+type tableResync struct {
+	Table      string    `json:"table"`
+	Mode       string    `json:"mode"`
+	Status     string    `json:"status"`
+	RowsCopied int64     `json:"rows_copied"`
+	Replayed   int       `json:"changes_replayed"`
+	StartedAt  time.Time `json:"started_at"`
+	Error      string    `json:"error"`
+	// OperationID is set when the resync is started
+	OperationID string `json:"operation_id"`
+}
+
+// newActionCmd builds a command that POSTs to a sync action endpoint.
+func newActionCmd(opts *clientOptions, use, short, path string) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp struct {
+				Status string `json:"status"`
+			}
+			data, err := newClient(opts).do(cmd.Context(), http.MethodPost, path, nil, &resp)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			printf(cmd, "sync %s\n", resp.Status)
+			return nil
+		},
+	}
+}
+
+func newTriggerCmd(opts *clientOptions) *cobra.Command {
+	var tables []string
+	var dump, schema, snapshot, from, gtid string
+	var csvFiles map[string]string
+
+	cmd := &cobra.Command{
+		Use:   "trigger",
+		Short: "Start a sync run",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var body interface{}
+			if len(tables) > 0 || dump != "" || len(csvFiles) > 0 || schema != "" {
+				fields := map[string]interface{}{"tables": tables, "dump": dump, "csv": csvFiles, "gtid_set": gtid, "schema": schema, "snapshot": snapshot}
+				if from != "" {
+					file, pos, ok := strings.Cut(from, ":")
+					if !ok {
+						return fmt.Errorf("--from must be file:position, got %q", from)
+					}
+					position, err := strconv.ParseUint(pos, 10, 32)
+					if err != nil {
+						return fmt.Errorf("--from position: %w", err)
+					}
+					fields["binlog_file"], fields["binlog_pos"] = file, position
+				}
+				body = fields
+			}
+			var resp struct {
+				Status string   `json:"status"`
+				Tables []string `json:"tables"`
+			}
+			data, err := newClient(opts).do(cmd.Context(), http.MethodPost, "/sync/trigger", body, &resp)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			printf(cmd, "sync %s: %s\n", resp.Status, strings.Join(resp.Tables, ", "))
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&tables, "tables", nil, "sync only these tables (default: every table the token may access)")
+	cmd.Flags().StringVar(&dump, "dump", "", "load this mysqldump file, on the server, then sync from its binlog coordinates")
+	cmd.Flags().StringToStringVar(&csvFiles, "csv", nil, "load these table=file CSV files, on the server, then sync from --from or --gtid")
+	cmd.Flags().StringVar(&from, "from", "", "with --csv, the binlog file:position the CSV files were exported at")
+	cmd.Flags().StringVar(&gtid, "gtid", "", "with --csv, the GTID set the CSV files were exported at")
+	cmd.Flags().StringVar(&snapshot, "snapshot", "", "how to load the dump or CSV files: in_place, or shadow to swap complete tables in at the end (default: sync.snapshot)")
+	cmd.Flags().StringVar(&schema, "schema", "", "create the target tables, if none exist, from this migrations directory or schema file on the server")
+	return cmd
+}
+
+func newReplayCmd(opts *clientOptions) *cobra.Command {
+	var tables []string
+	var from, gtid, since string
+	var upsert bool
+
+	cmd := &cobra.Command{
+		Use:   "replay",
+		Short: "Read the binlog again from a position, GTID set or time and re-apply its changes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			body := map[string]interface{}{"tables": tables, "gtid_set": gtid, "upsert": upsert}
+			if from != "" {
+				file, pos, ok := strings.Cut(from, ":")
+				if !ok {
+					return fmt.Errorf("--from must be file:position, got %q", from)
+				}
+				position, err := strconv.ParseUint(pos, 10, 32)
+				if err != nil {
+					return fmt.Errorf("--from position: %w", err)
+				}
+				body["binlog_file"], body["binlog_pos"] = file, position
+			}
+			if since != "" {
+				t, err := time.Parse(time.RFC3339, since)
+				if err != nil {
+					return fmt.Errorf("--since: %w", err)
+				}
+				body["since"] = t
+			}
+
+			var resp struct {
+				Status string `json:"status"`
+				RunID  string `json:"run_id"`
+				From   struct {
+					BinlogFile string `json:"binlog_file"`
+					BinlogPos  uint32 `json:"binlog_pos"`
+					GTIDSet    string `json:"gtid_set"`
+				} `json:"from"`
+			}
+			data, err := newClient(opts).do(cmd.Context(), http.MethodPost, "/sync/replay", body, &resp)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			start := resp.From.GTIDSet
+			if start == "" {
+				start = fmt.Sprintf("%s:%d", resp.From.BinlogFile, resp.From.BinlogPos)
+			}
+			printf(cmd, "sync %s from %s (run %s)\n", resp.Status, start, resp.RunID)
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&tables, "tables", nil, "re-apply only these tables (default: every table)")
+	cmd.Flags().StringVar(&from, "from", "", "binlog position to replay from, as file:position")
+	cmd.Flags().StringVar(&gtid, "gtid", "", "replay the transactions after this GTID set")
+	cmd.Flags().StringVar(&since, "since", "", "replay the changes made since this time (RFC 3339)")
+	cmd.Flags().BoolVar(&upsert, "upsert", false, "follow each replayed update with an upsert, restoring rows lost on the target")
+	return cmd
+}
+
+func newResyncCmd(opts *clientOptions) *cobra.Command {
+	var truncate bool
+
+	cmd := &cobra.Command{
+		Use:   "resync <table>",
+		Short: "Rebuild a table on the target from the source while the sync keeps running",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mode := "shadow"
+			if truncate {
+				mode = "truncate"
+			}
+			var resp tableResync
+			data, err := newClient(opts).do(cmd.Context(), http.MethodPost, "/tables/"+url.PathEscape(args[0])+"/resync", map[string]string{"mode": mode}, &resp)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			printf(cmd, "resyncing %s (%s), follow it with: dbsyncctl operations --wait %s\n", resp.Table, resp.Mode, resp.OperationID)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&truncate, "truncate", false, "empty the target table and copy into it, instead of building a shadow table and swapping it in")
+	return cmd
+}
+
+func newStopCmd(opts *clientOptions) *cobra.Command {
+	return newActionCmd(opts, "stop", "Stop the running sync", "/sync/stop")
+}
+
+func newRestartCmd(opts *clientOptions) *cobra.Command {
+	return newActionCmd(opts, "restart", "Stop the running sync and start it again over the same tables", "/sync/restart")
+}
+
+func newPauseCmd(opts *clientOptions) *cobra.Command {
+	return newActionCmd(opts, "pause", "Pause the running sync without losing its position", "/sync/pause")
+}
+
+func newResumeCmd(opts *clientOptions) *cobra.Command {
+	return newActionCmd(opts, "resume", "Resume a paused sync", "/sync/resume")
+}
+
+func newStatusCmd(opts *clientOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show sync status and per-table lag",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var resp struct {
+				Status            string             `json:"status"`
+				RunID             string             `json:"run_id"`
+				BufferedBytes     int64              `json:"buffered_bytes"`
+				Backlog           *queueBacklog      `json:"backlog"`
+				Tables            []tableLag         `json:"tables"`
+				LargeTransactions []largeTransaction `json:"large_transactions"`
+				Observed          []tableObservation `json:"observed"`
+				Resyncs           []tableResync      `json:"resyncs"`
+				Leader            *leaderStatus      `json:"leader"`
+			}
+			data, err := newClient(opts).do(cmd.Context(), http.MethodGet, "/sync/status", nil, &resp)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+
+			printf(cmd, "Status:    %s\n", resp.Status)
+			printf(cmd, "Run:       %s\n", orDash(resp.RunID))
+			printf(cmd, "Buffered:  %d bytes\n", resp.BufferedBytes)
+			if l := resp.Leader; l != nil && l.Enabled {
+				printf(cmd, "Role:      %s\n", l.summary())
+			}
+			if b := resp.Backlog; b != nil {
+				printf(cmd, "Queue:     %s, %d in memory, %d spilled (%d bytes)\n", b.Type, b.MemoryEvents, b.SpilledEvents, b.SpilledBytes)
+				if b.OldestSpilledAt != nil {
+					printf(cmd, "Backlog:   oldest spilled %s (%.0fs ago) at %s\n", formatTime(*b.OldestSpilledAt), b.AgeSeconds, orDash(b.OldestPosition))
+				}
+			}
+			if len(resp.Tables) > 0 {
+				printf(cmd, "\n")
+				printLag(cmd, resp.Tables)
+			}
+			if len(resp.LargeTransactions) > 0 {
+				printf(cmd, "\n")
+				printLargeTransactions(cmd, resp.LargeTransactions)
+			}
+			if len(resp.Observed) > 0 {
+				printf(cmd, "\nObserving, nothing is written to the target:\n")
+				printObservations(cmd, resp.Observed)
+			}
+			if len(resp.Resyncs) > 0 {
+				printf(cmd, "\n")
+				printResyncs(cmd, resp.Resyncs)
+			}
+			return nil
+		},
+	}
+}
+
+func printLargeTransactions(cmd *cobra.Command, txns []largeTransaction) {
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TRANSACTION\tREAD\tAPPLIED\tFAILED\tCOMMITTED\tSTARTED")
+	for _, t := range txns {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%t\t%s\n", t.GTID, t.RowsRead, t.RowsApplied, t.RowsFailed, t.Committed, formatTime(t.StartedAt))
+	}
+	tw.Flush()
+}
+
+func printObservations(cmd *cobra.Command, tables []tableObservation) {
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TABLE\tINSERTS\tUPDATES\tDELETES\tUNCHANGED\tCONFLICTS")
+	for _, t := range tables {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\n", t.Table, t.Inserts, t.Updates, t.Deletes, t.Unchanged, t.Conflicts)
+	}
+	tw.Flush()
+}
+
+func printResyncs(cmd *cobra.Command, resyncs []tableResync) {
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESYNC\tMODE\tSTATUS\tROWS\tREPLAYED\tSTARTED\tERROR")
+	for _, r := range resyncs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n", r.Table, r.Mode, r.Status, r.RowsCopied, r.Replayed, formatTime(r.StartedAt), orDash(r.Error))
+	}
+	tw.Flush()
+}
+
+type rateLimits struct {
+	RowsPerSecond         int `json:"rows_per_second"`
+	TransactionsPerSecond int `json:"transactions_per_second"`
+}
+
+type throttle struct {
+	rateLimits
+	Tables map[string]rateLimits `json:"tables,omitempty"`
+}
+
+func newThrottleCmd(opts *clientOptions) *cobra.Command {
+	var (
+		table        string
+		rows         int
+		transactions int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "throttle",
+		Short: "Show or change the apply limits, global or per table (0 = unthrottled)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := newClient(opts)
+			var current throttle
+			data, err := c.do(cmd.Context(), http.MethodGet, "/sync/throttle", nil, &current)
+			if err != nil {
+				return err
+			}
+
+			flags := cmd.Flags()
+			if flags.Changed("rows") || flags.Changed("transactions") {
+				limits := &current.rateLimits
+				if table != "" {
+					if current.Tables == nil {
+						current.Tables = make(map[string]rateLimits)
+					}
+					tableLimits := current.Tables[table]
+					limits = &tableLimits
+				}
+				if flags.Changed("rows") {
+					limits.RowsPerSecond = rows
+				}
+				if flags.Changed("transactions") {
+					limits.TransactionsPerSecond = transactions
+				}
+				if table != "" {
+					current.Tables[table] = *limits
+				}
+				if data, err = c.do(cmd.Context(), http.MethodPut, "/sync/throttle", current, &current); err != nil {
+					return err
+				}
+			}
+
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			printThrottle(cmd, current)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&table, "table", "", "change the limits of this table instead of the global ones")
+	cmd.Flags().IntVar(&rows, "rows", 0, "rows applied per second at most")
+	cmd.Flags().IntVar(&transactions, "transactions", 0, "target transactions per second at most")
+	return cmd
+}
+
+func printThrottle(cmd *cobra.Command, t throttle) {
+	limit := func(n int) string {
+		if n == 0 {
+			return "-"
+		}
+		return strconv.Itoa(n)
+	}
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SCOPE\tROWS/S\tTRANSACTIONS/S")
+	fmt.Fprintf(tw, "global\t%s\t%s\n", limit(t.RowsPerSecond), limit(t.TransactionsPerSecond))
+	tables := make([]string, 0, len(t.Tables))
+	for name := range t.Tables {
+		tables = append(tables, name)
+	}
+	sort.Strings(tables)
+	for _, name := range tables {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, limit(t.Tables[name].RowsPerSecond), limit(t.Tables[name].TransactionsPerSecond))
+	}
+	tw.Flush()
+}
+
+type tuning struct {
+	Workers         int    `json:"workers"`
+	BatchInsertSize int    `json:"batch_insert_size"`
+	FlushInterval   string `json:"flush_interval"`
+	QueueCapacity   int    `json:"queue_capacity"`
+}
+
+func newTuningCmd(opts *clientOptions) *cobra.Command {
+	var change tuning
+
+	cmd := &cobra.Command{
+		Use:   "tuning",
+		Short: "Show or change the worker pool and queue settings without stopping the sync; changes persist across restarts",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := newClient(opts)
+			var current tuning
+			var data []byte
+			var err error
+			flags := cmd.Flags()
+			if flags.Changed("workers") || flags.Changed("batch-size") || flags.Changed("flush-interval") || flags.Changed("queue-capacity") {
+				data, err = c.do(cmd.Context(), http.MethodPatch, "/admin/sync-config", change, &current)
+			} else {
+				data, err = c.do(cmd.Context(), http.MethodGet, "/admin/sync-config", nil, &current)
+			}
+			if err != nil {
+				return err
+			}
+
+			if opts.json {
+				printf(cmd, "%s\n", data)
+				return nil
+			}
+			printf(cmd, "Workers:         %d\n", current.Workers)
+			printf(cmd, "Batch size:      %d\n", current.BatchInsertSize)
+			printf(cmd, "Flush interval:  %s\n", current.FlushInterval)
+			printf(cmd, "Queue capacity:  %d\n", current.QueueCapacity)
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&change.Workers, "workers", 0, "workers applying changes")
+	cmd.Flags().IntVar(&change.BatchInsertSize, "batch-size", 0, "events a worker applies together")
+	cmd.Flags().StringVar(&change.FlushInterval, "flush-interval", "", "how long a worker holds a short batch, e.g. 500ms")
+	cmd.Flags().IntVar(&change.QueueCapacity, "queue-capacity", 0, "events the queue holds in memory")
+	return cmd
+}
+
+type snapshotProgress struct {
+	Table         string   `json:"table"`
+	Kind          string   `json:"kind"`
+	Status        string   `json:"status"`
+	RowsCopied    int64    `json:"rows_copied"`
+	EstimatedRows int64    `json:"estimated_rows"`
+	Percent       float64  `json:"percent"`
+	RowsPerSecond float64  `json:"rows_per_second"`
+	ETASeconds    *float64 `json:"eta_seconds"`
+	Error         string   `json:"error"`
+}
+
+func newProgressCmd(opts *clientOptions) *cobra.Command {
+	var watch time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "progress",
+		Short: "Show how far table copies, by dump loads and resyncs, have got",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for {
+				if err := showProgress(cmd, opts); err != nil {
+					return err
+				}
+				if watch <= 0 {
+					return nil
+				}
+				select {
+				case <-cmd.Context().Done():
+					return nil
+				case <-time.After(watch):
+					printf(cmd, "\n")
+				}
+			}
+		},
+	}
+	cmd.Flags().DurationVarP(&watch, "watch", "w", 0, "refresh at this interval until interrupted")
+	return cmd
+}
+
+func showProgress(cmd *cobra.Command, opts *clientOptions) error {
+	var resp struct {
+		Tables []snapshotProgress `json:"tables"`
+	}
+	data, err := newClient(opts).do(cmd.Context(), http.MethodGet, "/sync/progress", nil, &resp)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		printf(cmd, "%s\n", data)
+		return nil
+	}
+	if len(resp.Tables) == 0 {
+		printf(cmd, "No table copied yet\n")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintf(tw, "TABLE\tKIND\tSTATUS\tROWS\tESTIMATED\tPERCENT\tROWS/S\tETA\tERROR\n")
+	for _, p := range resp.Tables {
+		eta := "-"
+		if p.ETASeconds != nil {
+			eta = (time.Duration(*p.ETASeconds) * time.Second).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%.1f%%\t%.0f\t%s\t%s\n",
+			p.Table, p.Kind, p.Status, p.RowsCopied, p.EstimatedRows, p.Percent, p.RowsPerSecond, eta, orDash(p.Error))
+	}
+	return nil
+}
+
+func newLagCmd(opts *clientOptions) *cobra.Command {
+	var watch time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "lag",
+		Short: "Show replication lag per table",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for {
+				if err := showLag(cmd, opts); err != nil {
+					return err
+				}
+				if watch <= 0 {
+					return nil
+				}
+				select {
+				case <-cmd.Context().Done():
+					return nil
+				case <-time.After(watch):
+					printf(cmd, "\n")
+				}
+			}
+		},
+	}
+	cmd.Flags().DurationVarP(&watch, "watch", "w", 0, "refresh at this interval until interrupted")
+	return cmd
+}
+
+func showLag(cmd *cobra.Command, opts *clientOptions) error {
+	var resp struct {
+		ThresholdSeconds float64    `json:"threshold_seconds"`
+		Tables           []tableLag `json:"tables"`
+	}
+	data, err := newClient(opts).do(cmd.Context(), http.MethodGet, "/sync/lag", nil, &resp)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		printf(cmd, "%s\n", data)
+		return nil
+	}
+
+	printf(cmd, "Threshold: %.0fs\n", resp.ThresholdSeconds)
+	if len(resp.Tables) == 0 {
+		printf(cmd, "No events applied yet\n")
+		return nil
+	}
+	printLag(cmd, resp.Tables)
+	return nil
+}
+
+func printLag(cmd *cobra.Command, tables []tableLag) {
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintf(tw, "TABLE\tSTATUS\tLAG\tLAST EVENT\tLAST APPLIED\n")
+	for _, t := range tables {
+		fmt.Fprintf(tw, "%s\t%s\t%.1fs\t%s\t%s\n", t.Table, t.Status, t.LagSeconds, formatTime(t.LastEventTime), formatTime(t.LastAppliedAt))
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
@@ -9,9 +10,12 @@ import (
 
 	"go.uber.org/zap"
 
+	"mysql-sync-service/internal/alerting"
 	"mysql-sync-service/internal/api"
 	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/ids"
 	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/rpc"
 	"mysql-sync-service/internal/store"
 	"mysql-sync-service/internal/sync"
 )
@@ -30,15 +34,28 @@ func main() {
 		os.Exit(1)
 	}
 	defer logger.Sync()
+	if err := logger.SetModuleLevels(cfg.Logging.Modules); err != nil {
+		logger.Log.Fatal("Invalid logging.modules", zap.Error(err))
+	}
+	if err := logger.SetDebugSampling(cfg.Logging.DebugSampling.Initial, cfg.Logging.DebugSampling.Thereafter); err != nil {
+		logger.Log.Fatal("Invalid logging.debug_sampling", zap.Error(err))
+	}
 
 	logger.Log.Info("Starting MySQL Sync Service")
 
+	// Init record IDs
+	if err := ids.Init(cfg.StateStorage.IDs); err != nil {
+		logger.Log.Fatal("Failed to init id generator", zap.Error(err))
+	}
+
 	// Init State Store
-	// For now, assume MySQL store
-	stateStore, err := store.NewMySQLStore(cfg.StateStorage)
+	stateStore, err := store.NewStore(cfg.StateStorage)
 	if err != nil {
 		logger.Log.Fatal("Failed to init state store", zap.Error(err))
 	}
+	if interval := cfg.StateStorage.GetCheckpointFlushInterval(); interval > 0 {
+		stateStore = store.NewWriteBehind(stateStore, interval)
+	}
 	defer stateStore.Close()
 
 	// Init Sync Manager
@@ -48,8 +65,27 @@ func main() {
 	}
 	defer syncManager.Close()
 
+	// Finish conflict resolutions a crash interrupted
+	if err := syncManager.RecoverResolutions(context.Background()); err != nil {
+		logger.Log.Warn("Failed to recover conflict resolutions", zap.Error(err))
+	}
+
+	// Init Alerting
+	alerts, err := alerting.NewManager(cfg.Alerting)
+	if err != nil {
+		logger.Log.Fatal("Failed to init alerting", zap.Error(err))
+	}
+	syncManager.SetAlerter(alerts)
+
+	// Init Scheduler
+	scheduler := sync.NewScheduler(cfg.Scheduler, syncManager)
+	scheduler.Start()
+
 	// Init API
-	handler := api.NewHandler(syncManager)
+	handler, err := api.NewHandler(syncManager, scheduler, stateStore, cfg.Server)
+	if err != nil {
+		logger.Log.Fatal("Failed to init API", zap.Error(err))
+	}
 	router := handler.Routes()
 
 	// Start Server
@@ -66,12 +102,60 @@ func main() {
 		}
 	}()
 
+	// Start gRPC control plane
+	var grpcServer *rpc.Server
+	if cfg.Server.GRPCPort > 0 {
+		grpcServer, err = rpc.NewServer(syncManager, stateStore, cfg.Server)
+		if err != nil {
+			logger.Log.Fatal("Failed to init gRPC API", zap.Error(err))
+		}
+		grpcAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.GRPCPort)
+		go func() {
+			if err := grpcServer.Serve(grpcAddr); err != nil {
+				logger.Log.Fatal("gRPC server failed", zap.Error(err))
+			}
+		}()
+	}
+
+	// SIGUSR1 toggles debug logging without a restart
+	levelToggle := make(chan os.Signal, 1)
+	signal.Notify(levelToggle, syscall.SIGUSR1)
+	go func() {
+		for range levelToggle {
+			level := logger.ToggleDebug()
+			logger.Log.Info("Log level toggled by SIGUSR1", zap.String("level", level))
+		}
+	}()
+
+	// SIGHUP re-reads config.yaml and applies its worker pool and queue
+	// settings to the running sync; other changes need a restart
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			reloaded, err := config.LoadConfig("config.yaml")
+			if err != nil {
+				logger.Log.Error("Failed to reload config", zap.Error(err))
+				continue
+			}
+			if _, err := syncManager.ReloadTuning(context.Background(), reloaded.Sync); err != nil {
+				logger.Log.Error("Failed to apply reloaded config", zap.Error(err))
+				continue
+			}
+			logger.Log.Info("Config reloaded by SIGHUP")
+		}
+	}()
+
 	// Graceful Shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	logger.Log.Info("Shutting down server...")
+	scheduler.Stop()
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
 	syncManager.Stop()
 	// server.Shutdown(ctx) could be added here
 }
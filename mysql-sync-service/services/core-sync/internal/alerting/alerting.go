@@ -0,0 +1,228 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+)
+
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+func (s Severity) rank() int {
+	switch s {
+	case SeverityCritical:
+		return 2
+	case SeverityWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Alert kinds raised by the sync engine
+const (
+	KindSyncFailure      = "sync_failure"
+	KindDLQGrowth        = "dlq_growth"
+	KindConflictBacklog  = "conflict_backlog"
+	KindConflictStorm    = "conflict_storm"
+	KindReplicationLag   = "replication_lag"
+	KindStateStoreDown   = "state_store_unavailable"
+	KindAlertsSuppressed = "alerts_suppressed"
+)
+
+type Alert struct {
+	Kind     string            `json:"kind"`
+	Severity Severity          `json:"severity"`
+	Subject  string            `json:"subject"` // e.g. table name; part of the dedup key
+	Title    string            `json:"title"`
+	Message  string            `json:"message"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Time     time.Time         `json:"time"`
+	// Resolved marks a recovery notice; it bypasses the cooldown of the
+	// alert it resolves so operators always hear that things are fine again.
+	Resolved bool `json:"resolved"`
+}
+
+func (a Alert) key() string {
+	return fmt.Sprintf("%s:%s:%t", a.Kind, a.Subject, a.Resolved)
+}
+
+// Notifier delivers alerts to one destination.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, alert Alert) error
+}
+
+type registeredNotifier struct {
+	notifier    Notifier
+	minSeverity Severity
+}
+
+// Manager fans alerts out to notifiers with per-key deduplication and a
+// global rate limit. A nil *Manager is valid and drops every alert.
+type Manager struct {
+	cfg       config.AlertingConfig
+	notifiers []registeredNotifier
+	cooldown  time.Duration
+
+	mu          sync.Mutex
+	lastSent    map[string]time.Time
+	windowStart time.Time
+	windowCount int
+	suppressed  int
+}
+
+func NewManager(cfg config.AlertingConfig) (*Manager, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	m := &Manager{
+		cfg:      cfg,
+		cooldown: cfg.GetCooldown(),
+		lastSent: make(map[string]time.Time),
+	}
+
+	for _, notifierConfig := range cfg.Notifiers {
+		notifier, err := newNotifier(notifierConfig)
+		if err != nil {
+			return nil, err
+		}
+		minSeverity := Severity(notifierConfig.MinSeverity)
+		if minSeverity == "" {
+			minSeverity = SeverityWarning
+		}
+		m.notifiers = append(m.notifiers, registeredNotifier{notifier: notifier, minSeverity: minSeverity})
+	}
+
+	logger.Log.Info("Alerting enabled", zap.Int("notifiers", len(m.notifiers)))
+	return m, nil
+}
+
+// Config returns the alerting configuration, including check thresholds.
+func (m *Manager) Config() config.AlertingConfig {
+	if m == nil {
+		return config.AlertingConfig{}
+	}
+	return m.cfg
+}
+
+// Fire queues an alert for delivery. It never blocks the caller.
+func (m *Manager) Fire(alert Alert) {
+	if m == nil {
+		return
+	}
+	if alert.Time.IsZero() {
+		alert.Time = time.Now()
+	}
+
+	if !m.allow(alert) {
+		logger.Log.Debug("Alert suppressed", zap.String("kind", alert.Kind), zap.String("subject", alert.Subject))
+		return
+	}
+
+	go m.deliver(alert)
+}
+
+func (m *Manager) allow(alert Alert) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := alert.Time
+	key := alert.key()
+	if last, ok := m.lastSent[key]; ok && now.Sub(last) < m.cooldown && !alert.Resolved {
+		return false
+	}
+
+	if now.Sub(m.windowStart) >= time.Minute {
+		m.windowStart = now
+		m.windowCount = 0
+	}
+
+	if m.cfg.MaxPerMinute > 0 && m.windowCount >= m.cfg.MaxPerMinute {
+		if m.suppressed == 0 {
+			// Report what the window drops once it ends, whether or not
+			// another alert comes along
+			time.AfterFunc(time.Until(m.windowStart.Add(time.Minute)), m.reportSuppressed)
+		}
+		m.suppressed++
+		return false
+	}
+
+	m.windowCount++
+	m.lastSent[key] = now
+	if alert.Resolved {
+		// A recovery re-arms the original alert
+		delete(m.lastSent, fmt.Sprintf("%s:%s:%t", alert.Kind, alert.Subject, false))
+	}
+	return true
+}
+
+// reportSuppressed sends how many alerts the rate limit dropped since it
+// was last sent.
+func (m *Manager) reportSuppressed() {
+	m.mu.Lock()
+	dropped := m.suppressed
+	m.suppressed = 0
+	m.mu.Unlock()
+	if dropped == 0 {
+		return
+	}
+	m.deliver(Alert{
+		Kind:     KindAlertsSuppressed,
+		Severity: SeverityWarning,
+		Title:    "Alerts suppressed by rate limit",
+		Message:  fmt.Sprintf("%d alerts were dropped in the last minute", dropped),
+		Time:     time.Now(),
+	})
+}
+
+func (m *Manager) deliver(alert Alert) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	for _, registered := range m.notifiers {
+		if alert.Severity.rank() < registered.minSeverity.rank() {
+			continue
+		}
+		if err := registered.notifier.Notify(ctx, alert); err != nil {
+			logger.Log.Error("Failed to deliver alert",
+				zap.String("notifier", registered.notifier.Name()),
+				zap.String("kind", alert.Kind),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+func newNotifier(cfg config.NotifierConfig) (Notifier, error) {
+	switch cfg.Type {
+	case "slack":
+		return NewSlackNotifier(cfg)
+	case "webhook":
+		return NewWebhookNotifier(cfg)
+	case "email":
+		return NewEmailNotifier(cfg)
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", cfg.Type)
+	}
+}
+
+func notifierName(cfg config.NotifierConfig) string {
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+	return cfg.Type
+}
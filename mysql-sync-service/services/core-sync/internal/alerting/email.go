@@ -0,0 +1,74 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"mysql-sync-service/internal/config"
+)
+
+// EmailNotifier sends alerts through an SMTP relay.
+type EmailNotifier struct {
+	name string
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+}
+
+func NewEmailNotifier(cfg config.NotifierConfig) (*EmailNotifier, error) {
+	if cfg.SMTPHost == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, fmt.Errorf("email notifier %s: smtp_host, from and to are required", notifierName(cfg))
+	}
+
+	port := cfg.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.SMTPHost)
+	}
+
+	return &EmailNotifier{
+		name: notifierName(cfg),
+		addr: fmt.Sprintf("%s:%d", cfg.SMTPHost, port),
+		auth: auth,
+		from: cfg.From,
+		to:   cfg.To,
+	}, nil
+}
+
+func (n *EmailNotifier) Name() string { return n.name }
+
+func (n *EmailNotifier) Notify(ctx context.Context, alert Alert) error {
+	subject := fmt.Sprintf("[dbsync %s] %s", alert.Severity, alert.Title)
+	if alert.Resolved {
+		subject = fmt.Sprintf("[dbsync resolved] %s", alert.Title)
+	}
+
+	message := strings.Join([]string{
+		"From: " + n.from,
+		"To: " + strings.Join(n.to, ", "),
+		"Subject: " + subject,
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		formatText(alert),
+	}, "\r\n")
+
+	// net/smtp has no context support; run it so a hung relay can't outlive ctx
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(n.addr, n.auth, n.from, n.to, []byte(message))
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,107 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"mysql-sync-service/internal/config"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// WebhookNotifier POSTs the alert as JSON to an arbitrary endpoint.
+type WebhookNotifier struct {
+	name    string
+	url     string
+	headers map[string]string
+}
+
+func NewWebhookNotifier(cfg config.NotifierConfig) (*WebhookNotifier, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook notifier %s: url is required", notifierName(cfg))
+	}
+	return &WebhookNotifier{name: notifierName(cfg), url: cfg.URL, headers: cfg.Headers}, nil
+}
+
+func (n *WebhookNotifier) Name() string { return n.name }
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	return postJSON(ctx, n.url, n.headers, alert)
+}
+
+// SlackNotifier posts to a Slack incoming webhook.
+type SlackNotifier struct {
+	name    string
+	url     string
+	channel string
+}
+
+func NewSlackNotifier(cfg config.NotifierConfig) (*SlackNotifier, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("slack notifier %s: url is required", notifierName(cfg))
+	}
+	return &SlackNotifier{name: notifierName(cfg), url: cfg.URL, channel: cfg.Channel}, nil
+}
+
+func (n *SlackNotifier) Name() string { return n.name }
+
+func (n *SlackNotifier) Notify(ctx context.Context, alert Alert) error {
+	payload := map[string]string{"text": formatText(alert)}
+	if n.channel != "" {
+		payload["channel"] = n.channel
+	}
+	return postJSON(ctx, n.url, nil, payload)
+}
+
+func postJSON(ctx context.Context, url string, headers map[string]string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return nil
+}
+
+// formatText renders an alert as plain text for chat and email.
+func formatText(alert Alert) string {
+	var b strings.Builder
+	prefix := strings.ToUpper(string(alert.Severity))
+	if alert.Resolved {
+		prefix = "RESOLVED"
+	}
+	fmt.Fprintf(&b, "[%s] %s\n%s", prefix, alert.Title, alert.Message)
+
+	keys := make([]string, 0, len(alert.Fields))
+	for key := range alert.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "\n%s: %s", key, alert.Fields[key])
+	}
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"mysql-sync-service/internal/logger"
+)
+
+type accessKey struct{}
+
+// accessEntry collects what inner middleware learns about a request for
+// its access log line.
+type accessEntry struct {
+	caller string
+}
+
+// accessLog logs every request once it is served, with its request ID,
+// status, size, latency and the token that made it. The request ID is
+// also put in the context for logger.For, so the manager's log entries
+// for the request carry it too. Health checks and scrapes log at debug.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := middleware.GetReqID(r.Context())
+		entry := &accessEntry{}
+		ctx := context.WithValue(logger.WithRequestID(r.Context(), requestID), accessKey{}, entry)
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			level := zapcore.InfoLevel
+			switch {
+			case status >= http.StatusInternalServerError:
+				level = zapcore.ErrorLevel
+			case r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || r.URL.Path == "/health" || r.URL.Path == "/api/v1/metrics":
+				level = zapcore.DebugLevel
+			}
+			fields := []zap.Field{
+				zap.String("request_id", requestID),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Int("status", status),
+				zap.Int("bytes", ww.BytesWritten()),
+				zap.Duration("latency", time.Since(start)),
+				zap.String("remote_addr", r.RemoteAddr),
+			}
+			if route := chi.RouteContext(ctx); route != nil && route.RoutePattern() != "" {
+				fields = append(fields, zap.String("route", route.RoutePattern()))
+			}
+			if entry.caller != "" {
+				fields = append(fields, zap.String("caller", entry.caller))
+			}
+			if ce := logger.Log.Check(level, "API request"); ce != nil {
+				ce.Write(fields...)
+			}
+		}()
+		next.ServeHTTP(ww, r.WithContext(ctx))
+	})
+}
+
+// setAccessCaller names the caller in the request's access log.
+func setAccessCaller(r *http.Request, caller string) {
+	if entry, ok := r.Context().Value(accessKey{}).(*accessEntry); ok {
+		entry.caller = caller
+	}
+}
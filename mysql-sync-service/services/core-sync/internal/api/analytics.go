@@ -0,0 +1,231 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"mysql-sync-service/internal/store"
+)
+
+// maxHeatmapRange bounds a heatmap to about a month of hourly cells.
+const maxHeatmapRange = 31 * 24 * time.Hour
+
+// HeatmapCell is a table's conflicts and errors, i.e. dead-lettered events,
+// in one hour.
+type HeatmapCell struct {
+	Table     string    `json:"table"`
+	Hour      time.Time `json:"hour"`
+	Conflicts int       `json:"conflicts"`
+	Errors    int       `json:"errors"`
+}
+
+// HourOfDay totals a table's cells by hour of the day, in the requested
+// time zone, for spotting daily patterns.
+type HourOfDay struct {
+	Table     string  `json:"table"`
+	Conflicts [24]int `json:"conflicts"`
+	Errors    [24]int `json:"errors"`
+}
+
+// GetHeatmap counts conflicts and errors per table and hour between from
+// and to (RFC 3339, default the last 7 days), optionally for some tables.
+// Hours without either are left out. tz names the time zone hours of the
+// day are reported in, UTC by default.
+func (h *Handler) GetHeatmap(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	to := time.Now()
+	from := to.Add(-7 * 24 * time.Hour)
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, name+" must be an RFC 3339 time", err.Error())
+				return
+			}
+			*t = parsed
+		}
+	}
+	if !from.Before(to) || to.Sub(from) > maxHeatmapRange {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "from must be before to, at most 31 days apart", nil)
+		return
+	}
+	location := time.UTC
+	if tz := query.Get("tz"); tz != "" {
+		var err error
+		if location, err = time.LoadLocation(tz); err != nil {
+			renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "unknown time zone "+tz, nil)
+			return
+		}
+	}
+
+	var tables []string
+	if value := query.Get("tables"); value != "" {
+		tables = strings.Split(value, ",")
+		if !authorize(w, r, "", tables...) {
+			return
+		}
+	} else {
+		tables = principalFrom(r).Tables()
+	}
+
+	cells, err := h.store.Heatmap(r.Context(), from, to, tables)
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, CodeInternal, err.Error(), nil)
+		return
+	}
+
+	resp := make([]HeatmapCell, 0, len(cells))
+	byTable := make(map[string]*HourOfDay)
+	for _, c := range cells {
+		resp = append(resp, HeatmapCell{Table: c.TableName, Hour: c.Hour, Conflicts: c.Conflicts, Errors: c.Errors})
+
+		daily, ok := byTable[c.TableName]
+		if !ok {
+			daily = &HourOfDay{Table: c.TableName}
+			byTable[c.TableName] = daily
+		}
+		hour := c.Hour.In(location).Hour()
+		daily.Conflicts[hour] += c.Conflicts
+		daily.Errors[hour] += c.Errors
+	}
+	hoursOfDay := make([]HourOfDay, 0, len(byTable))
+	for _, daily := range byTable {
+		hoursOfDay = append(hoursOfDay, *daily)
+	}
+	sort.Slice(hoursOfDay, func(i, j int) bool { return hoursOfDay[i].Table < hoursOfDay[j].Table })
+
+	renderJSON(w, http.StatusOK, map[string]interface{}{
+		"from":         from,
+		"to":           to,
+		"time_zone":    location.String(),
+		"cells":        resp,
+		"hours_of_day": hoursOfDay,
+	})
+}
+
+// maxConflictStatsRange bounds conflict statistics to about a year.
+const maxConflictStatsRange = 366 * 24 * time.Hour
+
+// ConflictStatsGroup counts the conflicts sharing a table, type, strategy
+// or day.
+type ConflictStatsGroup struct {
+	Key       string `json:"key"`
+	Conflicts int    `json:"conflicts"`
+	Resolved  int    `json:"resolved"`
+	// MeanTimeToResolution is in seconds, over the resolved ones
+	MeanTimeToResolution *float64 `json:"mean_time_to_resolution_seconds,omitempty"`
+
+	resolutionSeconds float64
+}
+
+func (g *ConflictStatsGroup) add(row *store.ConflictStatsRow) {
+	g.Conflicts += row.Conflicts
+	g.Resolved += row.Resolved
+	g.resolutionSeconds += row.ResolutionSeconds
+}
+
+func (g *ConflictStatsGroup) finish() {
+	if g.Resolved > 0 {
+		mean := g.resolutionSeconds / float64(g.Resolved)
+		g.MeanTimeToResolution = &mean
+	}
+}
+
+// conflictGroups collects groups by key.
+type conflictGroups map[string]*ConflictStatsGroup
+
+func (c conflictGroups) add(key string, row *store.ConflictStatsRow) {
+	group, ok := c[key]
+	if !ok {
+		group = &ConflictStatsGroup{Key: key}
+		c[key] = group
+	}
+	group.add(row)
+}
+
+// sorted returns the groups, the most conflicts first or, byKey, in key
+// order.
+func (c conflictGroups) sorted(byKey bool) []ConflictStatsGroup {
+	groups := make([]ConflictStatsGroup, 0, len(c))
+	for _, group := range c {
+		group.finish()
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if !byKey && groups[i].Conflicts != groups[j].Conflicts {
+			return groups[i].Conflicts > groups[j].Conflicts
+		}
+		return groups[i].Key < groups[j].Key
+	})
+	return groups
+}
+
+// GetConflictStats counts the conflicts detected between from and to (RFC
+// 3339, default the last 30 days) by table, conflict type, resolution
+// strategy and UTC day, with the mean time to resolution of each, so
+// tables that keep conflicting stand out. tables limits it to some tables.
+// Unresolved conflicts are under the strategy "unresolved".
+func (h *Handler) GetConflictStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	to := time.Now()
+	from := to.Add(-30 * 24 * time.Hour)
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, name+" must be an RFC 3339 time", err.Error())
+				return
+			}
+			*t = parsed
+		}
+	}
+	if !from.Before(to) || to.Sub(from) > maxConflictStatsRange {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "from must be before to, at most 366 days apart", nil)
+		return
+	}
+
+	var tables []string
+	if value := query.Get("tables"); value != "" {
+		tables = strings.Split(value, ",")
+		if !authorize(w, r, "", tables...) {
+			return
+		}
+	} else {
+		tables = principalFrom(r).Tables()
+	}
+
+	rows, err := h.store.ConflictStats(r.Context(), from, to, tables)
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, CodeInternal, err.Error(), nil)
+		return
+	}
+
+	total := &ConflictStatsGroup{Key: "total"}
+	byTable, byType, byStrategy, byDay := conflictGroups{}, conflictGroups{}, conflictGroups{}, conflictGroups{}
+	for _, row := range rows {
+		strategy := row.Strategy
+		if strategy == "" {
+			strategy = "unresolved"
+		}
+		total.add(row)
+		byTable.add(row.TableName, row)
+		byType.add(row.ConflictType, row)
+		byStrategy.add(strategy, row)
+		byDay.add(row.Day.Format(time.DateOnly), row)
+	}
+	total.finish()
+
+	renderJSON(w, http.StatusOK, map[string]interface{}{
+		"from":                            from,
+		"to":                              to,
+		"conflicts":                       total.Conflicts,
+		"resolved":                        total.Resolved,
+		"mean_time_to_resolution_seconds": total.MeanTimeToResolution,
+		"by_table":                        byTable.sorted(false),
+		"by_type":                         byType.sorted(false),
+		"by_strategy":                     byStrategy.sorted(false),
+		"by_day":                          byDay.sorted(true),
+	})
+}
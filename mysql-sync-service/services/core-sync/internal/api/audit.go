@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"mysql-sync-service/internal/store"
+	"mysql-sync-service/internal/sync"
+)
+
+const maxAuditLimit = 1000
+
+// ListAudit returns applied changes from the audit log, newest first,
+// filtered by table, pk, operation, run_id and from/to (RFC 3339), and
+// paged with limit and offset.
+func (h *Handler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := store.AuditFilter{
+		PrimaryKey: query.Get("pk"),
+		Operation:  strings.ToUpper(query.Get("operation")),
+		RunID:      query.Get("run_id"),
+		Limit:      min(queryInt(r, "limit", 100), maxAuditLimit),
+		Offset:     queryInt(r, "offset", 0),
+	}
+	for name, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, name+" must be an RFC 3339 time", err.Error())
+				return
+			}
+			*t = parsed
+		}
+	}
+	if table := query.Get("table"); table != "" {
+		if !authorize(w, r, "", table) {
+			return
+		}
+		filter.Tables = []string{table}
+	} else {
+		filter.Tables = principalFrom(r).Tables()
+	}
+
+	entries, err := h.syncManager.Audit(r.Context(), filter)
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	if entries == nil {
+		entries = []sync.AuditEntry{}
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"mysql-sync-service/internal/auth"
+)
+
+// Token actions for config.APITokenConfig.Actions
+const (
+	ActionTrigger = auth.ActionTrigger
+	ActionPause   = auth.ActionPause
+	ActionResolve = auth.ActionResolve
+	ActionAdmin   = auth.ActionAdmin
+)
+
+type principalKey struct{}
+
+// authMiddleware rejects requests without a known bearer token and records
+// what the token allows for the handlers.
+func authMiddleware(tokens *auth.Tokens) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := tokens.Authenticate(r.Header.Get("Authorization"))
+			if p == nil {
+				renderError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing or invalid bearer token", nil)
+				return
+			}
+			setAccessCaller(r, p.Name())
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+		})
+	}
+}
+
+func principalFrom(r *http.Request) *auth.Principal {
+	if p, ok := r.Context().Value(principalKey{}).(*auth.Principal); ok {
+		return p
+	}
+	return auth.FullAccess
+}
+
+// authorizeGlobal is authorize for actions that affect every table, which
+// tokens limited to some tables may not perform.
+func authorizeGlobal(w http.ResponseWriter, r *http.Request, action string) bool {
+	return renderDenied(w, r, principalFrom(r).AuthorizeGlobal(action))
+}
+
+// authorize writes a 403 and returns false unless the caller may perform
+// action on every one of tables.
+func authorize(w http.ResponseWriter, r *http.Request, action string, tables ...string) bool {
+	return renderDenied(w, r, principalFrom(r).Authorize(action, tables...))
+}
+
+// renderDenied writes a 403 for err, an *auth.Denied, and returns whether
+// there was none.
+func renderDenied(w http.ResponseWriter, r *http.Request, err error) bool {
+	var denied *auth.Denied
+	if !errors.As(err, &denied) {
+		return true
+	}
+	details := map[string]string{"token": denied.Token}
+	if denied.Table != "" {
+		details["table"] = denied.Table
+	}
+	renderError(w, r, http.StatusForbidden, CodeForbidden, denied.Message, details)
+	return false
+}
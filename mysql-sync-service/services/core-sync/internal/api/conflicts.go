@@ -0,0 +1,339 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/store"
+	"mysql-sync-service/internal/sync"
+)
+
+// ConflictResponse is the API view of a conflict, flattening nullable columns.
+type ConflictResponse struct {
+	ID                 string          `json:"id"`
+	TableName          string          `json:"table_name"`
+	PrimaryKeyValue    string          `json:"primary_key_value"`
+	ConflictType       string          `json:"conflict_type"`
+	LocalData          json.RawMessage `json:"local_data,omitempty"`
+	CloudData          json.RawMessage `json:"cloud_data,omitempty"`
+	DetectedAt         time.Time       `json:"detected_at"`
+	Resolved           bool            `json:"resolved"`
+	ResolutionStrategy string          `json:"resolution_strategy,omitempty"`
+	ResolvedAt         *time.Time      `json:"resolved_at,omitempty"`
+	ResolvedData       json.RawMessage `json:"resolved_data,omitempty"`
+	SchemaVersion      int64           `json:"schema_version,omitempty"`
+	Version            int             `json:"version"` // pass back when resolving
+	Event              *ConflictEvent  `json:"event,omitempty"`
+	// Diff is the columns the local and cloud rows differ in
+	Diff []sync.ColumnDiff `json:"diff,omitempty"`
+}
+
+// ConflictEvent is the binlog event that surfaced the conflict.
+type ConflictEvent struct {
+	Type           string          `json:"type,omitempty"`
+	BinlogFile     string          `json:"binlog_file,omitempty"`
+	BinlogPosition int64           `json:"binlog_position,omitempty"`
+	GTID           string          `json:"gtid,omitempty"`
+	Before         json.RawMessage `json:"before,omitempty"`
+	After          json.RawMessage `json:"after,omitempty"`
+	Source         *ConflictSource `json:"source,omitempty"`
+}
+
+// ConflictSource is the server the triggering event was read from.
+type ConflictSource struct {
+	SiteID     string `json:"site_id,omitempty"`
+	Host       string `json:"host,omitempty"`
+	ServerUUID string `json:"server_uuid,omitempty"`
+}
+
+func newConflictResponse(c *store.Conflict) ConflictResponse {
+	resp := ConflictResponse{
+		ID:              c.ID,
+		TableName:       c.TableName,
+		PrimaryKeyValue: c.PrimaryKeyValue,
+		ConflictType:    c.ConflictType,
+		LocalData:       c.LocalData,
+		CloudData:       c.CloudData,
+		DetectedAt:      c.DetectedAt,
+		Resolved:        c.Resolved,
+		ResolvedData:    c.ResolvedData,
+		SchemaVersion:   c.SchemaVersion.Int64,
+		Version:         c.Version,
+	}
+	if c.ResolutionStrategy.Valid {
+		resp.ResolutionStrategy = c.ResolutionStrategy.String
+	}
+	if diff, err := sync.ConflictDiff(c); err == nil {
+		resp.Diff = diff
+	}
+	if c.ResolvedAt.Valid {
+		resolvedAt := c.ResolvedAt.Time
+		resp.ResolvedAt = &resolvedAt
+	}
+	if c.BinlogFile.Valid || c.EventType.Valid {
+		resp.Event = &ConflictEvent{
+			Type:           c.EventType.String,
+			BinlogFile:     c.BinlogFile.String,
+			BinlogPosition: c.BinlogPosition.Int64,
+			GTID:           c.GTID.String,
+			Before:         c.EventBefore,
+			After:          c.EventAfter,
+		}
+		if c.SourceSite.Valid || c.SourceHost.Valid || c.SourceServerUUID.Valid {
+			resp.Event.Source = &ConflictSource{
+				SiteID:     c.SourceSite.String,
+				Host:       c.SourceHost.String,
+				ServerUUID: c.SourceServerUUID.String,
+			}
+		}
+	}
+	return resp
+}
+
+func (h *Handler) ListConflicts(w http.ResponseWriter, r *http.Request) {
+	resolved := r.URL.Query().Get("resolved") == "true"
+	limit := queryInt(r, "limit", 50)
+	offset := queryInt(r, "offset", 0)
+
+	conflicts, err := h.store.ListConflicts(r.Context(), resolved, principalFrom(r).Tables(), limit, offset)
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, CodeInternal, err.Error(), nil)
+		return
+	}
+
+	resp := make([]ConflictResponse, 0, len(conflicts))
+	for _, c := range conflicts {
+		resp = append(resp, newConflictResponse(c))
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{"conflicts": resp})
+}
+
+func (h *Handler) GetConflict(w http.ResponseWriter, r *http.Request) {
+	conflict, err := h.store.GetConflict(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, CodeInternal, err.Error(), nil)
+		return
+	}
+	if conflict == nil {
+		renderError(w, r, http.StatusNotFound, CodeNotFound, "conflict not found", map[string]string{"id": chi.URLParam(r, "id")})
+		return
+	}
+	if !authorize(w, r, "", conflict.TableName) {
+		return
+	}
+	renderJSON(w, http.StatusOK, newConflictResponse(conflict))
+}
+
+// GetConflictPatch returns the SQL each resolution option would run on each
+// database. With format=sql it is returned as a script instead.
+func (h *Handler) GetConflictPatch(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	conflict, err := h.store.GetConflict(r.Context(), id)
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, CodeInternal, err.Error(), nil)
+		return
+	}
+	if conflict == nil {
+		renderError(w, r, http.StatusNotFound, CodeNotFound, "conflict not found", map[string]string{"id": id})
+		return
+	}
+	if !authorize(w, r, "", conflict.TableName) {
+		return
+	}
+
+	patch, err := h.syncManager.ConflictPatch(r.Context(), conflict)
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	if r.URL.Query().Get("format") != "sql" {
+		renderJSON(w, http.StatusOK, patch)
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- Conflict %s on %s (key %s)\n", conflict.ID, conflict.TableName, conflict.PrimaryKeyValue)
+	for _, option := range patch.Options {
+		fmt.Fprintf(&b, "\n-- Option: %s", option.Strategy)
+		if option.Note != "" {
+			fmt.Fprintf(&b, " (%s)", option.Note)
+		}
+		b.WriteString("\n")
+		for _, side := range []struct {
+			name       string
+			statements []string
+		}{{"local", option.Local}, {"cloud", option.Cloud}} {
+			fmt.Fprintf(&b, "-- On %s:\n", side.name)
+			if len(side.statements) == 0 {
+				b.WriteString("--   nothing to change\n")
+			}
+			for _, stmt := range side.statements {
+				b.WriteString(stmt + "\n")
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"conflict-%s.sql\"", conflict.ID))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// PreviewConflictResolution returns the row each strategy would resolve
+// the conflict to, and what it would change in each database, without
+// resolving it.
+func (h *Handler) PreviewConflictResolution(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	conflict, err := h.store.GetConflict(r.Context(), id)
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, CodeInternal, err.Error(), nil)
+		return
+	}
+	if conflict == nil {
+		renderError(w, r, http.StatusNotFound, CodeNotFound, "conflict not found", map[string]string{"id": id})
+		return
+	}
+	if !authorize(w, r, "", conflict.TableName) {
+		return
+	}
+
+	preview, err := h.syncManager.PreviewResolutions(r.Context(), conflict)
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusOK, preview)
+}
+
+// ResolveConflict resolves a conflict. With a version, that of the conflict
+// the decision was made on, a conflict changed since is refused with 409.
+func (h *Handler) ResolveConflict(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req struct {
+		Strategy     string          `json:"strategy"`
+		ResolvedData json.RawMessage `json:"resolved_data"`
+		Version      *int            `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid request body", err.Error())
+		return
+	}
+	if req.Strategy == "" {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "strategy is required", nil)
+		return
+	}
+
+	conflict, err := h.store.GetConflict(r.Context(), id)
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, CodeInternal, err.Error(), nil)
+		return
+	}
+	if conflict == nil {
+		renderError(w, r, http.StatusNotFound, CodeNotFound, "conflict not found", map[string]string{"id": id})
+		return
+	}
+	if !authorize(w, r, ActionResolve, conflict.TableName) {
+		return
+	}
+	if conflict.Resolved {
+		renderError(w, r, http.StatusConflict, CodeConflict, "conflict is already resolved", map[string]string{"id": id})
+		return
+	}
+	if req.Version != nil {
+		conflict.Version = *req.Version
+	}
+
+	if err := h.syncManager.ResolveConflict(r.Context(), conflict, req.Strategy, req.ResolvedData); err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+
+	conflict, err = h.store.GetConflict(r.Context(), id)
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, CodeInternal, err.Error(), nil)
+		return
+	}
+	renderJSON(w, http.StatusOK, newConflictResponse(conflict))
+}
+
+// BulkResolveConflicts resolves the conflicts in ids, or every open
+// conflict of tables (default: every table the token may access), with one
+// strategy in the background. It returns the operation to poll at
+// /operations/{id}.
+func (h *Handler) BulkResolveConflicts(w http.ResponseWriter, r *http.Request) {
+	var req sync.BulkResolveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid request body", err.Error())
+		return
+	}
+	if len(req.Tables) == 0 {
+		req.Tables = principalFrom(r).Tables()
+	}
+	if !authorize(w, r, ActionResolve, req.Tables...) {
+		return
+	}
+
+	op, err := h.syncManager.BulkResolve(req)
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusAccepted, op)
+}
+
+// PurgeConflicts deletes conflicts resolved before a cutoff, given as
+// older_than (e.g. 30d or 720h) or before (RFC 3339). unresolved=true also
+// deletes those detected before it and never resolved. Repeated table
+// parameters limit it to those tables, by default every table the token
+// may access.
+func (h *Handler) PurgeConflicts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := sync.PurgeRequest{
+		Tables:     query["table"],
+		Unresolved: query.Get("unresolved") == "true",
+	}
+	switch {
+	case query.Get("older_than") != "":
+		age, err := config.ParseAge(query.Get("older_than"))
+		if err != nil || age <= 0 {
+			renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "older_than must be a positive duration, e.g. 30d", nil)
+			return
+		}
+		req.Before = time.Now().Add(-age)
+	case query.Get("before") != "":
+		before, err := time.Parse(time.RFC3339, query.Get("before"))
+		if err != nil {
+			renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "before must be an RFC 3339 time", err.Error())
+			return
+		}
+		req.Before = before
+	}
+	if len(req.Tables) == 0 {
+		req.Tables = principalFrom(r).Tables()
+	}
+	if !authorize(w, r, ActionResolve, req.Tables...) {
+		return
+	}
+
+	purged, err := h.syncManager.PurgeConflicts(r.Context(), req)
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{"purged": purged})
+}
+
+func queryInt(r *http.Request, name string, fallback int) int {
+	value, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
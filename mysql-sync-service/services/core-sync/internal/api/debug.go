@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ListSampledEvents returns the most recent binlog events sampled, newest
+// first, of table if given, with their row values and the SQL each would
+// be applied with; limit defaults to 50. Row values are as read, bar
+// columns under a column policy, so it takes the admin permission.
+func (h *Handler) ListSampledEvents(w http.ResponseWriter, r *http.Request) {
+	if !authorizeGlobal(w, r, ActionAdmin) {
+		return
+	}
+	events, err := h.syncManager.SampledEvents(r.Context(), r.URL.Query().Get("table"), queryInt(r, "limit", 50))
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{
+		"sampling": h.syncManager.Sampling(),
+		"events":   events,
+	})
+}
+
+// SetEventSampling switches the sampling of binlog events on or off until
+// the next restart.
+func (h *Handler) SetEventSampling(w http.ResponseWriter, r *http.Request) {
+	if !authorizeGlobal(w, r, ActionAdmin) {
+		return
+	}
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid request body", err.Error())
+		return
+	}
+	if req.Enabled == nil {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "enabled is required", nil)
+		return
+	}
+	renderJSON(w, http.StatusOK, h.syncManager.SetSampling(*req.Enabled))
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"mysql-sync-service/internal/encryption"
+)
+
+func (h *Handler) StartKeyRotation(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Table string `json:"table"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Table == "" {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "body must be {\"table\": \"<name>\"}", nil)
+		return
+	}
+	if !authorize(w, r, ActionAdmin, req.Table) {
+		return
+	}
+
+	job, err := h.syncManager.StartKeyRotation(req.Table)
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusAccepted, job)
+}
+
+func (h *Handler) ListKeyRotations(w http.ResponseWriter, r *http.Request) {
+	caller := principalFrom(r)
+	rotations := make([]encryption.RotationJob, 0)
+	for _, job := range h.syncManager.ListKeyRotations() {
+		if caller.CanTable(job.Table) {
+			rotations = append(rotations, job)
+		}
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{"rotations": rotations})
+}
+
+func (h *Handler) GetKeyRotation(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.syncManager.GetKeyRotation(chi.URLParam(r, "id"))
+	if !ok {
+		renderError(w, r, http.StatusNotFound, CodeNotFound, "rotation job not found", nil)
+		return
+	}
+	if !authorize(w, r, "", job.Table) {
+		return
+	}
+	renderJSON(w, http.StatusOK, job)
+}
+
+func (h *Handler) CancelKeyRotation(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.syncManager.GetKeyRotation(chi.URLParam(r, "id"))
+	if !ok {
+		renderError(w, r, http.StatusNotFound, CodeNotFound, "rotation job not found", nil)
+		return
+	}
+	if !authorize(w, r, ActionAdmin, job.Table) {
+		return
+	}
+	if !h.syncManager.CancelKeyRotation(job.ID) {
+		renderError(w, r, http.StatusNotFound, CodeNotFound, "rotation job not found", nil)
+		return
+	}
+	renderJSON(w, http.StatusAccepted, map[string]string{"status": "cancelling"})
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/encryption"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/sync"
+)
+
+// Error codes returned in the "code" field of the error envelope
+const (
+	CodeInvalidRequest = "invalid_request"
+	CodeNotFound       = "not_found"
+	CodeConflict       = "conflict"
+	CodeUnauthorized   = "unauthorized"
+	CodeForbidden      = "forbidden"
+	CodeInternal       = "internal_error"
+)
+
+type errorBody struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+type errorEnvelope struct {
+	Error errorBody `json:"error"`
+}
+
+// renderJSON writes v as a JSON response with the given status.
+func renderJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Log.Warn("Failed to encode response", zap.Error(err))
+	}
+}
+
+// renderError writes the standard error envelope. Server errors are logged
+// with the request ID so they can be matched with the client's report.
+func renderError(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	requestID := middleware.GetReqID(r.Context())
+
+	if status >= http.StatusInternalServerError {
+		logger.Log.Error("API request failed",
+			zap.String("request_id", requestID),
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.String("error", message),
+		)
+	}
+
+	renderJSON(w, status, errorEnvelope{Error: errorBody{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestID,
+	}})
+}
+
+// renderServiceError maps errors returned by the sync layer to a status code.
+func renderServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, sync.ErrUnknownTable), errors.Is(err, sync.ErrAuditDisabled), errors.Is(err, sync.ErrOperationNotFound),
+		errors.Is(err, sync.ErrJobNotFound):
+		renderError(w, r, http.StatusNotFound, CodeNotFound, err.Error(), nil)
+	case errors.Is(err, sync.ErrAlreadyRunning), errors.Is(err, sync.ErrNotRunning), errors.Is(err, encryption.ErrRotationRunning),
+		errors.Is(err, sync.ErrConflictChanged), errors.Is(err, sync.ErrResyncRunning), errors.Is(err, sync.ErrCheckpointLost), errors.Is(err, sync.ErrClosed),
+		errors.Is(err, sync.ErrServerIDInUse), errors.Is(err, sync.ErrNotLeader):
+		renderError(w, r, http.StatusConflict, CodeConflict, err.Error(), nil)
+	case errors.Is(err, encryption.ErrNotConfigured), errors.Is(err, sync.ErrInvalidSchedule), errors.Is(err, sync.ErrPartialGroup),
+		errors.Is(err, sync.ErrInvalidResolution), errors.Is(err, sync.ErrInvalidThrottle), errors.Is(err, sync.ErrInvalidTuning), errors.Is(err, sync.ErrInvalidDump),
+		errors.Is(err, sync.ErrInvalidSchema), errors.Is(err, sync.ErrInvalidReplay), errors.Is(err, sync.ErrInvalidResync),
+		errors.Is(err, sync.ErrInvalidPurge):
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error(), nil)
+	case errors.Is(err, sync.ErrPreflightFailed):
+		var preflightErr *sync.PreflightError
+		errors.As(err, &preflightErr)
+		renderError(w, r, http.StatusConflict, CodeConflict, sync.ErrPreflightFailed.Error(), preflightErr.Problems)
+	default:
+		renderError(w, r, http.StatusInternalServerError, CodeInternal, err.Error(), nil)
+	}
+}
+
+// requestIDHeader echoes the request ID so clients can quote it in reports.
+func requestIDHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestID := middleware.GetReqID(r.Context()); requestID != "" {
+			w.Header().Set(middleware.RequestIDHeader, requestID)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
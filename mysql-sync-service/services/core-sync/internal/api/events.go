@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"mysql-sync-service/internal/auth"
+	"mysql-sync-service/internal/store"
+)
+
+// eventBuffer is how far an SSE client may fall behind before missing events.
+const eventBuffer = 256
+
+// StreamEvents pushes sync activity as server-sent events until the client
+// disconnects. A comment line every 15s keeps idle proxies from closing it.
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		renderError(w, r, http.StatusInternalServerError, CodeInternal, "streaming is not supported", nil)
+		return
+	}
+
+	table := r.URL.Query().Get("table")
+	caller := principalFrom(r)
+	events, cancel := h.syncManager.Subscribe(eventBuffer)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case e := <-events:
+			if table != "" && e.Table != "" && e.Table != table {
+				continue
+			}
+			if e.Table != "" && !caller.CanTable(e.Table) {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// SyncHistoryResponse is the API view of a sync run record.
+type SyncHistoryResponse struct {
+	ID                string          `json:"id"`
+	StartedAt         time.Time       `json:"started_at"`
+	CompletedAt       *time.Time      `json:"completed_at,omitempty"`
+	Direction         string          `json:"direction"`
+	TablesSynced      string          `json:"tables_synced"`
+	TotalRows         int64           `json:"total_rows"`
+	ConflictsDetected int             `json:"conflicts_detected"`
+	Status            string          `json:"status"`
+	ErrorMessage      string          `json:"error_message,omitempty"`
+	Trigger           string          `json:"trigger"`
+	ShutdownReport    json.RawMessage `json:"shutdown_report,omitempty"`
+}
+
+func newSyncHistoryResponse(h *store.SyncHistory) SyncHistoryResponse {
+	resp := SyncHistoryResponse{
+		ID:                h.ID,
+		StartedAt:         h.StartedAt,
+		Direction:         h.Direction,
+		TablesSynced:      h.TablesSynced,
+		TotalRows:         h.TotalRows,
+		ConflictsDetected: h.ConflictsDetected,
+		Status:            h.Status,
+		ErrorMessage:      h.ErrorMessage.String,
+		Trigger:           h.Trigger,
+		ShutdownReport:    h.ShutdownReport,
+	}
+	if h.CompletedAt.Valid {
+		completedAt := h.CompletedAt.Time
+		resp.CompletedAt = &completedAt
+	}
+	return resp
+}
+
+// scopeSyncHistory leaves a run's record with only the tables the caller
+// may access. Shutdown reports cover every table, so callers limited to
+// some don't get them.
+func scopeSyncHistory(caller *auth.Principal, resp SyncHistoryResponse) SyncHistoryResponse {
+	if caller.Tables() == nil {
+		return resp
+	}
+	var tables []string
+	for _, table := range strings.Split(resp.TablesSynced, ",") {
+		if table != "" && caller.CanTable(table) {
+			tables = append(tables, table)
+		}
+	}
+	resp.TablesSynced = strings.Join(tables, ",")
+	resp.ShutdownReport = nil
+	return resp
+}
+
+// GetSyncHistory lists sync runs, the latest first; callers limited to
+// some tables see the runs that synced any of them.
+func (h *Handler) GetSyncHistory(w http.ResponseWriter, r *http.Request) {
+	limit := queryInt(r, "limit", 50)
+	offset := queryInt(r, "offset", 0)
+
+	caller := principalFrom(r)
+	history, err := h.store.GetSyncHistory(r.Context(), caller.Tables(), limit, offset)
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, CodeInternal, err.Error(), nil)
+		return
+	}
+
+	resp := make([]SyncHistoryResponse, 0, len(history))
+	for _, entry := range history {
+		resp = append(resp, scopeSyncHistory(caller, newSyncHistoryResponse(entry)))
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{"history": resp})
+}
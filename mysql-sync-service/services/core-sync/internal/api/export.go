@@ -0,0 +1,266 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/store"
+)
+
+// Export formats
+const (
+	exportCSV  = "csv"
+	exportJSON = "json"
+)
+
+// exportFlushRows is how many records are written between flushes.
+const exportFlushRows = 100
+
+// exporter streams records as a CSV or JSON array download. The response
+// starts with the first record, so an export that fails before it gets an
+// error response instead.
+type exporter struct {
+	w       http.ResponseWriter
+	format  string
+	name    string // the file name, without extension
+	header  []string
+	csv     *csv.Writer
+	started bool
+	written int
+}
+
+// newExporter reads format, csv by default, from the request; it answers
+// the request itself if the format is unknown.
+func newExporter(w http.ResponseWriter, r *http.Request, name string, header []string) (*exporter, bool) {
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = exportCSV
+	case exportCSV, exportJSON:
+	default:
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "format must be csv or json", nil)
+		return nil, false
+	}
+	return &exporter{w: w, format: format, name: name, header: header}, true
+}
+
+func (e *exporter) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	filename := fmt.Sprintf("%s-%s.%s", e.name, time.Now().UTC().Format("20060102T150405Z"), e.format)
+	e.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if e.format == exportJSON {
+		e.w.Header().Set("Content-Type", "application/json")
+		e.w.WriteHeader(http.StatusOK)
+		_, err := e.w.Write([]byte("["))
+		return err
+	}
+	e.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	e.w.WriteHeader(http.StatusOK)
+	e.csv = csv.NewWriter(e.w)
+	return e.csv.Write(e.header)
+}
+
+// write adds a record: v in JSON, or fields in CSV.
+func (e *exporter) write(v interface{}, fields []string) error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	if e.format == exportJSON {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if e.written > 0 {
+			data = append([]byte(","), data...)
+		}
+		if _, err := e.w.Write(data); err != nil {
+			return err
+		}
+	} else if err := e.csv.Write(fields); err != nil {
+		return err
+	}
+	e.written++
+	if e.written%exportFlushRows == 0 {
+		e.flush()
+	}
+	return nil
+}
+
+func (e *exporter) flush() {
+	if e.csv != nil {
+		e.csv.Flush()
+	}
+	if flusher, ok := e.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish ends the download, or answers with err if nothing was written.
+// An error past the first record can only cut the download short.
+func (e *exporter) finish(r *http.Request, err error) {
+	if err != nil && !e.started {
+		renderError(e.w, r, http.StatusInternalServerError, CodeInternal, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		logger.For(r.Context()).Warn("Export cut short", zap.String("export", e.name), zap.Int("written", e.written), zap.Error(err))
+		e.flush()
+		return
+	}
+	if err := e.start(); err != nil {
+		return
+	}
+	if e.format == exportJSON {
+		_, _ = e.w.Write([]byte("]\n"))
+	}
+	e.flush()
+}
+
+// exportRange reads from and to (RFC 3339); it answers the request itself
+// if either is invalid.
+func exportRange(w http.ResponseWriter, r *http.Request) (from, to time.Time, ok bool) {
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := r.URL.Query().Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, name+" must be an RFC 3339 time", err.Error())
+				return from, to, false
+			}
+			*t = parsed
+		}
+	}
+	return from, to, true
+}
+
+var conflictExportHeader = []string{
+	"id", "table_name", "primary_key_value", "conflict_type", "detected_at", "resolved", "resolution_strategy", "resolved_at",
+	"event_type", "binlog_file", "binlog_position", "gtid", "source_site", "local_data", "cloud_data", "resolved_data",
+}
+
+// ExportConflicts downloads conflicts as CSV or, with format=json, as a
+// JSON array of conflicts as GetConflict returns them, in the order they
+// were detected. They are filtered by table, resolved (true or false) and
+// from/to (RFC 3339) on when they were detected, and streamed as they are
+// read.
+func (h *Handler) ExportConflicts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, ok := exportRange(w, r)
+	if !ok {
+		return
+	}
+	filter := store.ConflictExportFilter{From: from, To: to}
+	switch resolved := query.Get("resolved"); resolved {
+	case "":
+	case "true", "false":
+		value := resolved == "true"
+		filter.Resolved = &value
+	default:
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "resolved must be true or false", nil)
+		return
+	}
+	if table := query.Get("table"); table != "" {
+		if !authorize(w, r, "", table) {
+			return
+		}
+		filter.Tables = []string{table}
+	} else {
+		filter.Tables = principalFrom(r).Tables()
+	}
+
+	e, ok := newExporter(w, r, "conflicts", conflictExportHeader)
+	if !ok {
+		return
+	}
+	err := h.store.ExportConflicts(r.Context(), filter, func(c *store.Conflict) error {
+		return e.write(newConflictResponse(c), []string{
+			c.ID,
+			c.TableName,
+			c.PrimaryKeyValue,
+			c.ConflictType,
+			c.DetectedAt.UTC().Format(time.RFC3339),
+			strconv.FormatBool(c.Resolved),
+			c.ResolutionStrategy.String,
+			nullTime(c.ResolvedAt.Time, c.ResolvedAt.Valid),
+			c.EventType.String,
+			c.BinlogFile.String,
+			nullInt(c.BinlogPosition.Int64, c.BinlogPosition.Valid),
+			c.GTID.String,
+			c.SourceSite.String,
+			string(c.LocalData),
+			string(c.CloudData),
+			string(c.ResolvedData),
+		})
+	})
+	e.finish(r, err)
+}
+
+var historyExportHeader = []string{
+	"id", "started_at", "completed_at", "direction", "tables_synced", "total_rows", "conflicts_detected", "status", "error_message", "trigger",
+}
+
+// ExportSyncHistory downloads sync runs as CSV or, with format=json, as a
+// JSON array of runs as GetSyncHistory returns them, in the order they
+// started. They are filtered by table, matching runs that synced it, or
+// the tables the token may access, and from/to (RFC 3339) on when they
+// started.
+func (h *Handler) ExportSyncHistory(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := exportRange(w, r)
+	if !ok {
+		return
+	}
+	caller := principalFrom(r)
+	filter := store.HistoryExportFilter{From: from, To: to}
+	if table := r.URL.Query().Get("table"); table != "" {
+		if !authorize(w, r, "", table) {
+			return
+		}
+		filter.Tables = []string{table}
+	} else {
+		filter.Tables = caller.Tables()
+	}
+
+	e, ok := newExporter(w, r, "sync-history", historyExportHeader)
+	if !ok {
+		return
+	}
+	err := h.store.ExportSyncHistory(r.Context(), filter, func(entry *store.SyncHistory) error {
+		resp := scopeSyncHistory(caller, newSyncHistoryResponse(entry))
+		return e.write(resp, []string{
+			entry.ID,
+			entry.StartedAt.UTC().Format(time.RFC3339),
+			nullTime(entry.CompletedAt.Time, entry.CompletedAt.Valid),
+			entry.Direction,
+			resp.TablesSynced,
+			strconv.FormatInt(entry.TotalRows, 10),
+			strconv.Itoa(entry.ConflictsDetected),
+			entry.Status,
+			entry.ErrorMessage.String,
+			entry.Trigger,
+		})
+	})
+	e.finish(r, err)
+}
+
+func nullTime(t time.Time, valid bool) string {
+	if !valid {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func nullInt(n int64, valid bool) string {
+	if !valid {
+		return ""
+	}
+	return strconv.FormatInt(n, 10)
+}
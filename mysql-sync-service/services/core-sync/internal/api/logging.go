@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/logger"
+)
+
+// logConfig is the runtime logging configuration.
+type logConfig struct {
+	Level         string            `json:"level"`
+	Modules       map[string]string `json:"modules"`
+	DebugSampling debugSampling     `json:"debug_sampling"`
+}
+
+type debugSampling struct {
+	Initial    int `json:"initial"`
+	Thereafter int `json:"thereafter"`
+}
+
+func currentLogConfig() logConfig {
+	initial, thereafter := logger.DebugSampling()
+	return logConfig{
+		Level:         logger.GetLevel(),
+		Modules:       logger.ModuleLevels(),
+		DebugSampling: debugSampling{Initial: initial, Thereafter: thereafter},
+	}
+}
+
+// GetLogConfig returns the log level, the modules with levels of their
+// own and the debug sampling.
+func (h *Handler) GetLogConfig(w http.ResponseWriter, r *http.Request) {
+	renderJSON(w, http.StatusOK, currentLogConfig())
+}
+
+// SetLogConfig changes logging without a restart. Every field is
+// optional: level sets the default level, modules sets the level of the
+// named modules (sync, store, api, ...) with "" returning one to the
+// default, and debug_sampling replaces the sampling, zeros turning it off.
+func (h *Handler) SetLogConfig(w http.ResponseWriter, r *http.Request) {
+	if !authorizeGlobal(w, r, ActionAdmin) {
+		return
+	}
+	var req struct {
+		Level         string            `json:"level"`
+		Modules       map[string]string `json:"modules"`
+		DebugSampling *debugSampling    `json:"debug_sampling"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid request body", err.Error())
+		return
+	}
+
+	// Merge the modules first, so an invalid one changes nothing
+	modules := logger.ModuleLevels()
+	for module, level := range req.Modules {
+		if level == "" {
+			delete(modules, module)
+		} else {
+			modules[module] = level
+		}
+	}
+	if req.Modules != nil {
+		if err := logger.SetModuleLevels(modules); err != nil {
+			renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error(), nil)
+			return
+		}
+	}
+	if req.Level != "" {
+		if err := logger.SetLevel(req.Level); err != nil {
+			renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error(), nil)
+			return
+		}
+	}
+	if req.DebugSampling != nil {
+		if err := logger.SetDebugSampling(req.DebugSampling.Initial, req.DebugSampling.Thereafter); err != nil {
+			renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error(), nil)
+			return
+		}
+	}
+
+	current := currentLogConfig()
+	logger.Log.Info("Logging changed via API",
+		zap.String("level", current.Level),
+		zap.Any("modules", current.Modules),
+		zap.Int("debug_sampling_initial", current.DebugSampling.Initial),
+		zap.Int("debug_sampling_thereafter", current.DebugSampling.Thereafter))
+	renderJSON(w, http.StatusOK, current)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"mysql-sync-service/internal/sync"
+)
+
+// GetOperation returns a long-running operation's state, progress and,
+// once it is done, its result.
+func (h *Handler) GetOperation(w http.ResponseWriter, r *http.Request) {
+	op, err := h.syncManager.Operation(chi.URLParam(r, "id"))
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	if !authorizeOperation(w, r, op) {
+		return
+	}
+	renderJSON(w, http.StatusOK, op)
+}
+
+// ListOperations returns the operations the token may see, newest first.
+func (h *Handler) ListOperations(w http.ResponseWriter, r *http.Request) {
+	caller := principalFrom(r)
+	operations := make([]sync.Operation, 0)
+	for _, op := range h.syncManager.Operations() {
+		visible := len(op.Tables) > 0 || caller.Tables() == nil
+		for _, table := range op.Tables {
+			visible = visible && caller.CanTable(table)
+		}
+		if visible {
+			operations = append(operations, op)
+		}
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{"operations": operations})
+}
+
+// authorizeOperation lets callers see operations on tables they may
+// access; those on every table need an unrestricted token.
+func authorizeOperation(w http.ResponseWriter, r *http.Request, op sync.Operation) bool {
+	if len(op.Tables) == 0 {
+		return authorizeGlobal(w, r, "")
+	}
+	return authorize(w, r, "", op.Tables...)
+}
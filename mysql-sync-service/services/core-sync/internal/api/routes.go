@@ -1,87 +1,519 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	
+
+	"mysql-sync-service/internal/auth"
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/metrics"
+	"mysql-sync-service/internal/store"
 	"mysql-sync-service/internal/sync"
 )
 
 type Handler struct {
 	syncManager *sync.Manager
+	scheduler   *sync.Scheduler
+	store       store.Store
+	tokens      *auth.Tokens
+
+	probeTimeout time.Duration
 }
 
-func NewHandler(manager *sync.Manager) *Handler {
+func NewHandler(manager *sync.Manager, scheduler *sync.Scheduler, store store.Store, cfg config.ServerConfig) (*Handler, error) {
+	tokens, err := auth.NewTokens(cfg)
+	if err != nil {
+		return nil, err
+	}
 	return &Handler{
 		syncManager: manager,
-	}
+		scheduler:   scheduler,
+		store:       store,
+		tokens:      tokens,
+
+		probeTimeout: cfg.GetProbeTimeout(),
+	}, nil
 }
 
 func (h *Handler) Routes() chi.Router {
 	r := chi.NewRouter()
-	
-	r.Use(middleware.Logger)
+
+	r.Use(middleware.RequestID)
+	r.Use(requestIDHeader)
+	r.Use(accessLog)
 	r.Use(middleware.Recoverer)
 	r.Use(CorsMiddleware)
-	
-	r.Get("/health", h.HealthCheck)
-	
+
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		renderError(w, r, http.StatusNotFound, CodeNotFound, "route not found", nil)
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		renderError(w, r, http.StatusMethodNotAllowed, CodeInvalidRequest, "method not allowed", nil)
+	})
+
+	r.Get("/healthz", h.Liveness)
+	r.Get("/readyz", h.Readiness)
+	// The probe path before the split, kept for existing deployments
+	r.Get("/health", h.Readiness)
+
 	r.Route("/api/v1", func(r chi.Router) {
-		r.Use(AuthMiddleware) // Placeholder for auth
-		
+		r.Use(authMiddleware(h.tokens))
+
 		r.Post("/sync/trigger", h.TriggerSync)
 		r.Post("/sync/stop", h.StopSync)
+		r.Post("/sync/restart", h.RestartSync)
+		r.Post("/sync/pause", h.PauseSync)
+		r.Post("/sync/resume", h.ResumeSync)
+		r.Post("/sync/replay", h.ReplaySync)
 		r.Get("/sync/status", h.GetSyncStatus)
+		r.Get("/sync/lag", h.GetSyncLag)
+		r.Get("/sync/progress", h.GetSyncProgress)
+		r.Get("/sync/stats", h.GetSyncStats)
+		r.Get("/sync/events", h.StreamEvents)
+		r.Get("/sync/history", h.GetSyncHistory)
+		r.Get("/sync/history/export", h.ExportSyncHistory)
+		r.Get("/sync/leader", h.GetLeader)
+		r.Get("/sync/throttle", h.GetThrottle)
+		r.Put("/sync/throttle", h.SetThrottle)
+		r.Get("/capabilities", h.GetCapabilities)
+		r.Get("/scheduler", h.GetScheduler)
+		r.Post("/scheduler", h.UpdateScheduler)
+		r.Get("/scheduler/jobs", h.ListScheduledJobs)
+		r.Patch("/scheduler/jobs/{name}", h.UpdateScheduledJob)
+		r.Post("/scheduler/jobs/{name}/run", h.RunScheduledJob)
+		r.Handle("/metrics", metrics.Handler())
+		r.Get("/logging/level", h.GetLogConfig)
+		r.Put("/logging/level", h.SetLogConfig)
+		r.Get("/admin/sync-config", h.GetSyncSettings)
+		r.Patch("/admin/sync-config", h.UpdateSyncSettings)
+		r.Delete("/admin/sync-config", h.ResetSyncSettings)
+
+		r.Get("/conflicts", h.ListConflicts)
+		r.Post("/conflicts/resolve", h.BulkResolveConflicts)
+		r.Delete("/conflicts/purge", h.PurgeConflicts)
+		r.Get("/conflicts/stats", h.GetConflictStats)
+		r.Get("/conflicts/export", h.ExportConflicts)
+		r.Get("/conflicts/{id}", h.GetConflict)
+		r.Get("/conflicts/{id}/patch", h.GetConflictPatch)
+		r.Get("/conflicts/{id}/preview", h.PreviewConflictResolution)
+		r.Post("/conflicts/{id}/resolve", h.ResolveConflict)
+
+		r.Get("/tables/stats", h.GetTableStats)
+		r.Get("/tables/{table}/schema-versions", h.ListSchemaVersions)
+		r.Post("/tables/{table}/resync", h.ResyncTable)
+
+		r.Get("/analytics/heatmap", h.GetHeatmap)
+
+		r.Get("/audit", h.ListAudit)
+
+		r.Get("/debug/events", h.ListSampledEvents)
+		r.Put("/debug/events", h.SetEventSampling)
+
+		r.Get("/operations", h.ListOperations)
+		r.Get("/operations/{id}", h.GetOperation)
+
+		r.Get("/encryption/rotations", h.ListKeyRotations)
+		r.Post("/encryption/rotations", h.StartKeyRotation)
+		r.Get("/encryption/rotations/{id}", h.GetKeyRotation)
+		r.Delete("/encryption/rotations/{id}", h.CancelKeyRotation)
 		// Add other routes
 	})
-	
+
 	return r
 }
 
-func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+// Liveness answers 200 while the process is fit to run, and 503 once the
+// manager is shut down. It probes no dependency, so an outage of one
+// doesn't get the instance restarted.
+func (h *Handler) Liveness(w http.ResponseWriter, r *http.Request) {
+	liveness := h.syncManager.Liveness()
+	status := http.StatusOK
+	if !liveness.Alive {
+		status = http.StatusServiceUnavailable
+	}
+	renderJSON(w, status, liveness)
+}
+
+// Readiness probes the local and cloud databases, the state store and the
+// binlog stream, answering 503 with each one's status if any is down.
+func (h *Handler) Readiness(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.probeTimeout)
+	defer cancel()
+	readiness := h.syncManager.Probe(ctx)
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	renderJSON(w, status, readiness)
 }
 
+// TriggerSync starts a run over the tables in the optional body, or over
+// every table the token may access. With dump, the path of a mysqldump file
+// on the server, the run loads it first and then captures changes from the
+// binlog coordinates it recorded. csv, a map of tables to CSV files on the
+// server, is loaded the same way instead, from binlog_file and binlog_pos or
+// gtid_set, where the source was when they were exported. schema, a
+// migrations directory or schema file on the server, creates the target
+// tables first if none exist. Reading server files needs admin.
 func (h *Handler) TriggerSync(w http.ResponseWriter, r *http.Request) {
-	if err := h.syncManager.Start(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var req struct {
+		Tables     []string          `json:"tables"`
+		Dump       string            `json:"dump"`
+		CSV        map[string]string `json:"csv"`
+		BinlogFile string            `json:"binlog_file"`
+		BinlogPos  uint32            `json:"binlog_pos"`
+		GTIDSet    string            `json:"gtid_set"`
+		Schema     string            `json:"schema"`
+		Snapshot   string            `json:"snapshot"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid request body", err.Error())
+		return
+	}
+
+	tables := req.Tables
+	if len(tables) == 0 {
+		tables = principalFrom(r).Tables()
+	}
+	if !authorize(w, r, ActionTrigger, tables...) {
+		return
+	}
+
+	if req.Dump != "" || len(req.CSV) > 0 || req.Schema != "" {
+		if !authorizeGlobal(w, r, ActionAdmin) {
+			return
+		}
+		opts := sync.BootstrapOptions{
+			Dump:        req.Dump,
+			CSV:         req.CSV,
+			Coordinates: sync.DumpCoordinates{BinlogFile: req.BinlogFile, BinlogPos: req.BinlogPos, GTIDSet: req.GTIDSet},
+			Schema:      req.Schema,
+			Snapshot:    req.Snapshot,
+		}
+		if err := h.syncManager.Bootstrap(tables, opts); err != nil {
+			renderServiceError(w, r, err)
+			return
+		}
+		status := "started"
+		if req.Dump != "" || len(req.CSV) > 0 {
+			status = "loading"
+		}
+		renderJSON(w, http.StatusOK, map[string]interface{}{"status": status, "tables": h.syncManager.RunTables()})
 		return
 	}
-	json.NewEncoder(w).Encode(map[string]string{"status": "started"})
+
+	if err := h.syncManager.StartTables(tables); err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{"status": "started", "tables": h.syncManager.RunTables()})
+}
+
+// ReplaySync starts a run that reads the source binlog again from a
+// position, a GTID set or a time and re-applies the changes of the tables
+// in the body, or of every table. With upsert, replayed updates restore
+// rows lost on the target. Replays rewind the whole pipeline, so they need
+// admin.
+func (h *Handler) ReplaySync(w http.ResponseWriter, r *http.Request) {
+	if !authorizeGlobal(w, r, ActionAdmin) {
+		return
+	}
+	var req struct {
+		Tables     []string  `json:"tables"`
+		BinlogFile string    `json:"binlog_file"`
+		BinlogPos  uint32    `json:"binlog_pos"`
+		GTIDSet    string    `json:"gtid_set"`
+		Since      time.Time `json:"since"`
+		Upsert     bool      `json:"upsert"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid request body", err.Error())
+		return
+	}
+
+	coords, err := h.syncManager.Replay(sync.ReplayOptions{
+		Tables:     req.Tables,
+		BinlogFile: req.BinlogFile,
+		BinlogPos:  req.BinlogPos,
+		GTIDSet:    req.GTIDSet,
+		Since:      req.Since,
+		Upsert:     req.Upsert,
+	})
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{
+		"status": "replaying",
+		"run_id": h.syncManager.RunID(),
+		"from":   coords,
+		"tables": req.Tables,
+	})
+}
+
+// ResyncTable rebuilds one table of the running sync from the source, in
+// the background; its operation_id polls its progress, as does the sync
+// status.
+func (h *Handler) ResyncTable(w http.ResponseWriter, r *http.Request) {
+	if !authorizeGlobal(w, r, ActionAdmin) {
+		return
+	}
+	var req struct {
+		Mode string `json:"mode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid request body", err.Error())
+		return
+	}
+
+	resync, err := h.syncManager.ResyncTable(chi.URLParam(r, "table"), req.Mode)
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusAccepted, resync)
 }
 
 func (h *Handler) StopSync(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, ActionTrigger, h.syncManager.RunTables()...) {
+		return
+	}
 	h.syncManager.Stop()
-	json.NewEncoder(w).Encode(map[string]string{"status": "stopped"})
+	renderJSON(w, http.StatusOK, map[string]string{"status": "stopped"})
 }
 
+// RestartSync stops the running sync and starts it again over the same
+// tables, or runs the last run's tables again if nothing is running.
+func (h *Handler) RestartSync(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, ActionTrigger, h.syncManager.RunTables()...) {
+		return
+	}
+	if err := h.syncManager.Restart(); err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{"status": "restarted", "run_id": h.syncManager.RunID(), "tables": h.syncManager.RunTables()})
+}
+
+func (h *Handler) PauseSync(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, ActionPause, h.syncManager.RunTables()...) {
+		return
+	}
+	if err := h.syncManager.Pause(); err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusOK, map[string]string{"status": "paused"})
+}
+
+func (h *Handler) ResumeSync(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, ActionPause, h.syncManager.RunTables()...) {
+		return
+	}
+	if err := h.syncManager.Resume(); err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusOK, map[string]string{"status": "running"})
+}
+
+// GetSyncStatus reports the run, with the lag, observer counts, resyncs
+// and large transactions of the tables the caller may access. Circuit
+// breakers guard sinks shared by every table, so only callers unlimited
+// by table see them.
 func (h *Handler) GetSyncStatus(w http.ResponseWriter, r *http.Request) {
+	caller := principalFrom(r)
 	status := h.syncManager.GetStatus()
-	json.NewEncoder(w).Encode(map[string]string{"status": status})
+	breakers := []sync.CircuitStatus{}
+	if caller.Tables() == nil {
+		breakers = append(breakers, h.syncManager.CircuitBreakers()...)
+	}
+	transactions := []sync.LargeTransaction{}
+	for _, txn := range h.syncManager.LargeTransactions() {
+		visible := true
+		for _, table := range txn.Tables {
+			visible = visible && caller.CanTable(table)
+		}
+		if visible {
+			transactions = append(transactions, txn)
+		}
+	}
+	observed := []sync.TableObservation{}
+	for _, observation := range h.syncManager.Observations() {
+		if caller.CanTable(observation.Table) {
+			observed = append(observed, observation)
+		}
+	}
+	resyncs := []sync.TableResync{}
+	for _, resync := range h.syncManager.Resyncs() {
+		if caller.CanTable(resync.Table) {
+			resyncs = append(resyncs, resync)
+		}
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{
+		"status":             status,
+		"run_id":             h.syncManager.RunID(),
+		"buffered_bytes":     h.syncManager.BufferedBytes(),
+		"backlog":            h.syncManager.QueueBacklog(),
+		"tables":             h.tableLag(r),
+		"circuit_breakers":   breakers,
+		"large_transactions": transactions,
+		"observed":           observed,
+		"resyncs":            resyncs,
+		"leader":             h.syncManager.Leadership(),
+	})
+}
+
+// GetLeader reports whether this instance leads, and which one does when
+// leader election is enabled.
+func (h *Handler) GetLeader(w http.ResponseWriter, r *http.Request) {
+	renderJSON(w, http.StatusOK, h.syncManager.Leadership())
+}
+
+// GetSyncStats returns the sync's live counters, totals since the service
+// started. It never waits on a run starting or stopping.
+func (h *Handler) GetSyncStats(w http.ResponseWriter, r *http.Request) {
+	renderJSON(w, http.StatusOK, h.syncManager.Stats())
+}
+
+// GetTableStats lists the apply statistics of each table the caller may
+// access, the busiest first; limit keeps the top ones only.
+func (h *Handler) GetTableStats(w http.ResponseWriter, r *http.Request) {
+	caller := principalFrom(r)
+	limit := queryInt(r, "limit", 0)
+	tables := []sync.TableStats{}
+	for _, stats := range h.syncManager.TableStats() {
+		if limit > 0 && len(tables) == limit {
+			break
+		}
+		if caller.CanTable(stats.Table) {
+			tables = append(tables, stats)
+		}
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{"tables": tables})
+}
+
+func (h *Handler) GetThrottle(w http.ResponseWriter, r *http.Request) {
+	renderJSON(w, http.StatusOK, h.syncManager.Throttle())
+}
+
+// SetThrottle replaces the apply limits, global and per table, 0 meaning
+// unthrottled; the change is persisted in the state store and outlives
+// restarts.
+func (h *Handler) SetThrottle(w http.ResponseWriter, r *http.Request) {
+	if !authorizeGlobal(w, r, ActionAdmin) {
+		return
+	}
+	var req sync.Throttle
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid request body", err.Error())
+		return
+	}
+
+	if err := h.syncManager.SetThrottle(r.Context(), req); err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusOK, h.syncManager.Throttle())
+}
+
+func (h *Handler) GetSyncSettings(w http.ResponseWriter, r *http.Request) {
+	renderJSON(w, http.StatusOK, h.syncManager.SyncSettings())
+}
+
+// UpdateSyncSettings changes the worker count, batch size, flush interval,
+// queue capacity and apply limits given, for the running sync and later
+// ones, without stopping it. Omitted settings keep theirs. The change is
+// persisted in the state store, so it survives restarts and config reloads
+// until ResetSyncSettings.
+func (h *Handler) UpdateSyncSettings(w http.ResponseWriter, r *http.Request) {
+	if !authorizeGlobal(w, r, ActionAdmin) {
+		return
+	}
+	var req sync.SyncSettingsChange
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid request body", err.Error())
+		return
+	}
+
+	settings, err := h.syncManager.UpdateSyncSettings(r.Context(), req)
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusOK, settings)
+}
+
+// ResetSyncSettings drops the settings persisted by UpdateSyncSettings and
+// SetThrottle, going back to those of config.yaml.
+func (h *Handler) ResetSyncSettings(w http.ResponseWriter, r *http.Request) {
+	if !authorizeGlobal(w, r, ActionAdmin) {
+		return
+	}
+	settings, err := h.syncManager.ResetSyncSettings(r.Context())
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusOK, settings)
+}
+
+// GetSyncLag reports the lag of each table the caller may access.
+func (h *Handler) GetSyncLag(w http.ResponseWriter, r *http.Request) {
+	renderJSON(w, http.StatusOK, map[string]interface{}{
+		"threshold_seconds": h.syncManager.GetLagThreshold().Seconds(),
+		"tables":            h.tableLag(r),
+	})
+}
+
+// tableLag is the lag of each table the caller may access.
+func (h *Handler) tableLag(r *http.Request) []sync.TableLag {
+	caller := principalFrom(r)
+	tables := []sync.TableLag{}
+	for _, lag := range h.syncManager.GetTableLag() {
+		if caller.CanTable(lag.Table) {
+			tables = append(tables, lag)
+		}
+	}
+	return tables
+}
+
+// GetSyncProgress lists the progress of the latest copy of each table the
+// caller may access, by a dump load or a resync; snapshot_progress events
+// on the event stream carry the same.
+func (h *Handler) GetSyncProgress(w http.ResponseWriter, r *http.Request) {
+	caller := principalFrom(r)
+	tables := []sync.SnapshotProgress{}
+	for _, progress := range h.syncManager.SnapshotProgress() {
+		if caller.CanTable(progress.Table) {
+			tables = append(tables, progress)
+		}
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{"tables": tables})
+}
+
+// GetCapabilities lists what this build supports, for UIs and the CLI.
+func (h *Handler) GetCapabilities(w http.ResponseWriter, r *http.Request) {
+	renderJSON(w, http.StatusOK, sync.GetCapabilities())
 }
 
 // Middleware placeholders
 func CorsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token")
-		
+
 		if r.Method == "OPTIONS" {
 			return
 		}
-		
-		next.ServeHTTP(w, r)
-	})
-}
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// TODO: Implement actual token check
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"mysql-sync-service/internal/sync"
+)
+
+func (h *Handler) GetScheduler(w http.ResponseWriter, r *http.Request) {
+	renderJSON(w, http.StatusOK, h.scheduler.Status())
+}
+
+// UpdateScheduler replaces the cron schedule; the change is persisted in the
+// state store and outlives restarts.
+func (h *Handler) UpdateScheduler(w http.ResponseWriter, r *http.Request) {
+	if !authorizeGlobal(w, r, ActionAdmin) {
+		return
+	}
+	var req struct {
+		Interval string `json:"interval"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Interval == "" {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "body must be {\"interval\": \"<cron expression>\"}", nil)
+		return
+	}
+
+	if err := h.scheduler.SetInterval(r.Context(), req.Interval); err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusOK, h.scheduler.Status())
+}
+
+// ListScheduledJobs lists the named jobs with their next and last runs.
+func (h *Handler) ListScheduledJobs(w http.ResponseWriter, r *http.Request) {
+	renderJSON(w, http.StatusOK, map[string]interface{}{"jobs": h.scheduler.Jobs()})
+}
+
+// UpdateScheduledJob changes a job's cron expression or enables or disables
+// it; the change is persisted in the state store and outlives restarts.
+func (h *Handler) UpdateScheduledJob(w http.ResponseWriter, r *http.Request) {
+	if !authorizeGlobal(w, r, ActionAdmin) {
+		return
+	}
+	var req sync.JobUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid request body", err.Error())
+		return
+	}
+	if req.Schedule == "" && req.Enabled == nil {
+		renderError(w, r, http.StatusBadRequest, CodeInvalidRequest, "schedule or enabled is required", nil)
+		return
+	}
+
+	job, err := h.scheduler.UpdateJob(r.Context(), chi.URLParam(r, "name"), req)
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusOK, job)
+}
+
+// RunScheduledJob runs a job now, even a disabled one, and returns what
+// happened.
+func (h *Handler) RunScheduledJob(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	job, err := h.scheduler.Job(name)
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	if len(job.Tables) == 0 {
+		if !authorizeGlobal(w, r, ActionTrigger) {
+			return
+		}
+	} else if !authorize(w, r, ActionTrigger, job.Tables...) {
+		return
+	}
+
+	run, err := h.scheduler.RunJob(name)
+	if err != nil {
+		renderServiceError(w, r, err)
+		return
+	}
+	renderJSON(w, http.StatusOK, run)
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// SchemaVersionResponse is a stored snapshot of a table's layout.
+type SchemaVersionResponse struct {
+	Version    int             `json:"version"`
+	Columns    json.RawMessage `json:"columns"`
+	PrimaryKey json.RawMessage `json:"primary_key,omitempty"`
+	Checksum   string          `json:"checksum"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// ListSchemaVersions returns a table's schema versions, newest first.
+func (h *Handler) ListSchemaVersions(w http.ResponseWriter, r *http.Request) {
+	table := chi.URLParam(r, "table")
+	if !authorize(w, r, "", table) {
+		return
+	}
+
+	versions, err := h.store.ListSchemaVersions(r.Context(), table)
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, CodeInternal, err.Error(), nil)
+		return
+	}
+
+	resp := make([]SchemaVersionResponse, 0, len(versions))
+	for _, v := range versions {
+		resp = append(resp, SchemaVersionResponse{
+			Version:    v.Version,
+			Columns:    v.Columns,
+			PrimaryKey: v.PrimaryKey,
+			Checksum:   v.Checksum,
+			CreatedAt:  v.CreatedAt,
+		})
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{"table": table, "versions": resp})
+}
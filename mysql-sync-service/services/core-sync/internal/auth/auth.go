@@ -0,0 +1,170 @@
+// Package auth checks the bearer tokens of the HTTP and gRPC APIs and what
+// each token may do.
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"mysql-sync-service/internal/config"
+)
+
+// Token actions for config.APITokenConfig.Actions
+const (
+	ActionTrigger = "trigger" // start and stop runs
+	ActionPause   = "pause"   // pause and resume runs
+	ActionResolve = "resolve" // resolve conflicts
+	ActionAdmin   = "admin"   // scheduler, log level and key rotation
+)
+
+// Principal is what the caller's token allows; nil tables or actions
+// mean all of them.
+type Principal struct {
+	name    string
+	tables  map[string]bool
+	actions map[string]bool
+}
+
+// FullAccess is the principal of the full-access token, and of every
+// caller when no tokens are configured.
+var FullAccess = &Principal{name: "admin"}
+
+// Name is the token's name, for logs and errors.
+func (p *Principal) Name() string {
+	return p.name
+}
+
+func (p *Principal) Can(action string) bool {
+	return p.actions == nil || p.actions[action]
+}
+
+func (p *Principal) CanTable(table string) bool {
+	return p.tables == nil || p.tables[table]
+}
+
+// Tables lists the tables the token is limited to, or nil if it is not.
+func (p *Principal) Tables() []string {
+	if p.tables == nil {
+		return nil
+	}
+	tables := make([]string, 0, len(p.tables))
+	for table := range p.tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// Denied is why a principal may not do something.
+type Denied struct {
+	Token   string
+	Table   string // the table refused, if any
+	Message string
+}
+
+func (e *Denied) Error() string {
+	return e.Message
+}
+
+// Authorize returns a *Denied unless p may perform action, or only read if
+// it is "", on every one of tables.
+func (p *Principal) Authorize(action string, tables ...string) error {
+	if action != "" && !p.Can(action) {
+		return &Denied{Token: p.name, Message: fmt.Sprintf("token may not %s", action)}
+	}
+	for _, table := range tables {
+		if !p.CanTable(table) {
+			return &Denied{Token: p.name, Table: table, Message: "token may not access table " + table}
+		}
+	}
+	return nil
+}
+
+// AuthorizeGlobal is Authorize for actions that affect every table, which
+// tokens limited to some tables may not perform.
+func (p *Principal) AuthorizeGlobal(action string) error {
+	if err := p.Authorize(action); err != nil {
+		return err
+	}
+	if p.tables != nil {
+		return &Denied{Token: p.name, Message: "token is limited to some tables"}
+	}
+	return nil
+}
+
+type tokenEntry struct {
+	token     []byte
+	principal *Principal
+}
+
+// Tokens checks bearer tokens. With no tokens configured every caller gets
+// full access.
+type Tokens struct {
+	tokens []tokenEntry
+}
+
+func NewTokens(cfg config.ServerConfig) (*Tokens, error) {
+	t := &Tokens{}
+	if cfg.AuthToken != "" {
+		t.tokens = append(t.tokens, tokenEntry{token: []byte(cfg.AuthToken), principal: FullAccess})
+	}
+
+	for i, tokenConfig := range cfg.Tokens {
+		name := tokenConfig.Name
+		if name == "" {
+			name = fmt.Sprintf("token %d", i+1)
+		}
+		token := tokenConfig.Token
+		if tokenConfig.TokenEnv != "" {
+			token = os.Getenv(tokenConfig.TokenEnv)
+		}
+		if token == "" {
+			return nil, fmt.Errorf("api token %s has no value", name)
+		}
+
+		p := &Principal{name: name}
+		if len(tokenConfig.Tables) > 0 {
+			p.tables = make(map[string]bool, len(tokenConfig.Tables))
+			for _, table := range tokenConfig.Tables {
+				p.tables[table] = true
+			}
+		}
+		if len(tokenConfig.Actions) > 0 {
+			p.actions = make(map[string]bool, len(tokenConfig.Actions))
+			for _, action := range tokenConfig.Actions {
+				switch action = strings.ToLower(action); action {
+				case ActionTrigger, ActionPause, ActionResolve, ActionAdmin:
+					p.actions[action] = true
+				default:
+					return nil, fmt.Errorf("api token %s: unknown action %q", name, action)
+				}
+			}
+		}
+		t.tokens = append(t.tokens, tokenEntry{token: []byte(token), principal: p})
+	}
+	return t, nil
+}
+
+// Authenticate returns the principal of an Authorization header's bearer
+// token, or nil if it has no known token.
+func (t *Tokens) Authenticate(header string) *Principal {
+	if len(t.tokens) == 0 {
+		return FullAccess
+	}
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil
+	}
+	token := []byte(strings.TrimPrefix(header, "Bearer "))
+
+	// Compare against every token so timing doesn't tell which one matched
+	var found *Principal
+	for _, entry := range t.tokens {
+		if subtle.ConstantTimeCompare(token, entry.token) == 1 && found == nil {
+			found = entry.principal
+		}
+	}
+	return found
+}
@@ -1,16 +1,23 @@
 package config
 
 import (
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Databases    DatabasesConfig `mapstructure:"databases"`
-	StateStorage StateStorage    `mapstructure:"state_storage"`
-	Sync         SyncConfig      `mapstructure:"sync"`
-	Scheduler    SchedulerConfig `mapstructure:"scheduler"`
-	Server       ServerConfig    `mapstructure:"server"`
-	Logging      LoggingConfig   `mapstructure:"logging"`
+	Databases    DatabasesConfig  `mapstructure:"databases"`
+	StateStorage StateStorage     `mapstructure:"state_storage"`
+	Sync         SyncConfig       `mapstructure:"sync"`
+	Scheduler    SchedulerConfig  `mapstructure:"scheduler"`
+	Retention    RetentionConfig  `mapstructure:"retention"`
+	Server       ServerConfig     `mapstructure:"server"`
+	Logging      LoggingConfig    `mapstructure:"logging"`
+	Alerting     AlertingConfig   `mapstructure:"alerting"`
+	Encryption   EncryptionConfig `mapstructure:"encryption"`
+	Audit        AuditConfig      `mapstructure:"audit"`
+	Leader       LeaderConfig     `mapstructure:"leader_election"`
 }
 
 type DatabasesConfig struct {
@@ -19,23 +26,147 @@ type DatabasesConfig struct {
 }
 
 type DatabaseConnection struct {
-	Host                string `mapstructure:"host"`
-	Port                int    `mapstructure:"port"`
-	User                string `mapstructure:"user"`
-	Password            string `mapstructure:"password"`
-	Database            string `mapstructure:"database"`
-	ReplicationUser     string `mapstructure:"replication_user"`
-	ReplicationPassword string `mapstructure:"replication_password"`
+	// Driver is "mysql" (default), "postgres" or "sqlite"; only the cloud
+	// side, i.e. the replication target, may be something other than MySQL
+	Driver              string    `mapstructure:"driver"`
+	FilePath            string    `mapstructure:"file_path"` // For SQLite
+	Host                string    `mapstructure:"host"`
+	Port                int       `mapstructure:"port"`
+	User                string    `mapstructure:"user"`
+	Password            string    `mapstructure:"password"`
+	Database            string    `mapstructure:"database"`
+	ReplicationUser     string    `mapstructure:"replication_user"`
+	ReplicationPassword string    `mapstructure:"replication_password"`
+	TLS                 TLSConfig `mapstructure:"tls"`
+	// SiteID names this server in event metadata, e.g. "store-042"
+	SiteID string `mapstructure:"site_id"`
+	// ServerID is the replica server ID binlog is read with, unique among
+	// the source's replicas. 0 assigns one from the hostname and the
+	// source and target, skipping IDs the source already lists.
+	ServerID uint32 `mapstructure:"server_id"`
+	// Charset is the MySQL character set text is stored in, e.g. "latin1";
+	// connections read and write text in it, and the sync converts text
+	// between the two sides' charsets. Default: utf8mb4
+	Charset string `mapstructure:"charset"`
+	// Collation is the connection collation, e.g. "latin1_swedish_ci";
+	// default: the charset's
+	Collation string `mapstructure:"collation"`
+}
+
+// TLSConfig controls encryption of MySQL connections. Mode follows the MySQL
+// client ssl-mode semantics: disabled, preferred, required, verify_ca, verify_identity.
+type TLSConfig struct {
+	Mode       string `mapstructure:"tls_mode"`
+	CACert     string `mapstructure:"ca_cert"`
+	ClientCert string `mapstructure:"client_cert"`
+	ClientKey  string `mapstructure:"client_key"`
+	SkipVerify bool   `mapstructure:"skip_verify"`
 }
 
 type StateStorage struct {
-	Type     string `mapstructure:"type"`
-	Host     string `mapstructure:"host"`
-	Port     int    `mapstructure:"port"`
-	User     string `mapstructure:"user"`
-	Password string `mapstructure:"password"`
-	Database string `mapstructure:"database"`
-	FilePath string `mapstructure:"file_path"` // For SQLite
+	Type     string    `mapstructure:"type"`
+	Host     string    `mapstructure:"host"`
+	Port     int       `mapstructure:"port"`
+	User     string    `mapstructure:"user"`
+	Password string    `mapstructure:"password"`
+	Database string    `mapstructure:"database"`
+	FilePath string    `mapstructure:"file_path"` // For SQLite
+	TLS      TLSConfig `mapstructure:"tls"`
+	IDs      IDConfig  `mapstructure:"ids"`
+	// Options holds the settings of a backend registered with
+	// store.Register, e.g. a DynamoDB table or etcd endpoints
+	Options map[string]interface{} `mapstructure:"options"`
+	// Buffer holds run state writes while the store is down.
+	Buffer StoreBufferConfig `mapstructure:"buffer"`
+	// CheckpointFlushInterval, if set, holds checkpoints in memory and
+	// writes each table's latest this often instead of after every batch
+	CheckpointFlushInterval string `mapstructure:"checkpoint_flush_interval"`
+
+	// Connection pool; QueryTimeout bounds every state store query
+	MaxOpenConns    int    `mapstructure:"max_open_conns"`
+	MaxIdleConns    int    `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime string `mapstructure:"conn_max_lifetime"`
+	QueryTimeout    string `mapstructure:"query_timeout"`
+}
+
+// StoreBufferConfig bounds what is held in memory while the state store is
+// unavailable. Each table's latest sync state is always kept; dead letters
+// and run history are kept up to MaxBytes, then dropped and counted. Held
+// writes are retried every RetryInterval.
+type StoreBufferConfig struct {
+	MaxBytes      int64  `mapstructure:"max_bytes"`
+	RetryInterval string `mapstructure:"retry_interval"`
+}
+
+func (b StoreBufferConfig) GetMaxBytes() int64 {
+	if b.MaxBytes <= 0 {
+		return 64 << 20
+	}
+	return b.MaxBytes
+}
+
+func (b StoreBufferConfig) GetRetryInterval() time.Duration {
+	d, err := time.ParseDuration(b.RetryInterval)
+	if err != nil || d <= 0 {
+		return 5 * time.Second
+	}
+	return d
+}
+
+// GetCheckpointFlushInterval returns 0, writing every checkpoint through,
+// unless an interval is set.
+func (s StateStorage) GetCheckpointFlushInterval() time.Duration {
+	d, err := time.ParseDuration(s.CheckpointFlushInterval)
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return d
+}
+
+func (s StateStorage) GetMaxOpenConns() int {
+	if s.MaxOpenConns <= 0 {
+		return 10
+	}
+	return s.MaxOpenConns
+}
+
+func (s StateStorage) GetMaxIdleConns() int {
+	if s.MaxIdleConns <= 0 {
+		return 5
+	}
+	return s.MaxIdleConns
+}
+
+func (s StateStorage) GetConnMaxLifetime() time.Duration {
+	d, err := time.ParseDuration(s.ConnMaxLifetime)
+	if err != nil || d <= 0 {
+		return time.Hour
+	}
+	return d
+}
+
+func (s StateStorage) GetQueryTimeout() time.Duration {
+	d, err := time.ParseDuration(s.QueryTimeout)
+	if err != nil || d <= 0 {
+		return 10 * time.Second
+	}
+	return d
+}
+
+// IDConfig picks how conflict, history, dead letter and other record IDs
+// are made: "uuid" (default, random), "ulid" or "snowflake", which sort by
+// creation time. Snowflake IDs embed NodeID, 0-1023, which must differ
+// between instances sharing a state store; 0 derives it from the hostname.
+type IDConfig struct {
+	Format string `mapstructure:"format"`
+	NodeID int    `mapstructure:"node_id"`
+}
+
+func (i IDConfig) GetFormat() string {
+	if i.Format == "" {
+		return "uuid"
+	}
+	return i.Format
 }
 
 type SyncConfig struct {
@@ -44,28 +175,752 @@ type SyncConfig struct {
 	Workers         int           `mapstructure:"workers"`
 	Realtime        bool          `mapstructure:"realtime"`
 	BatchInsertSize int           `mapstructure:"batch_insert_size"`
+	// FlushInterval (e.g. "500ms") is how long a worker holds a batch short
+	// of BatchInsertSize before applying it.
+	FlushInterval string `mapstructure:"flush_interval"`
+	// Scaling grows and shrinks the worker pool with the load, starting
+	// from Workers, instead of running Workers throughout.
+	Scaling WorkerScalingConfig `mapstructure:"scaling"`
+	// MaxBufferedBytes caps the approximate size of events held in memory
+	// between the binlog reader and the workers. 0 disables the limit.
+	MaxBufferedBytes int64 `mapstructure:"max_buffered_bytes"`
+	// LagThreshold (e.g. "30s") marks a table as lagging when apply delay
+	// exceeds it. Tables can override it with their own lag_threshold.
+	LagThreshold string      `mapstructure:"lag_threshold"`
+	Queue        QueueConfig `mapstructure:"queue"`
+	// Sinks receive every applied batch, in order. Empty means the cloud
+	// MySQL target only.
+	Sinks []SinkConfig `mapstructure:"sinks"`
+	// Groups are tables whose changes from one source transaction are
+	// applied to the target in one transaction, e.g. orders + order_items.
+	Groups []GroupConfig `mapstructure:"groups"`
+	// Capture is how changes are read: "binlog" (default) or "polling",
+	// which needs no replication privileges. Tables can override it.
+	Capture      string `mapstructure:"capture"`
+	PollInterval string `mapstructure:"poll_interval"`
+	// CircuitBreaker stops workers hammering a sink whose target is down.
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+	// Transactions keeps source transaction boundaries for binlog tables.
+	Transactions TransactionConfig `mapstructure:"transactions"`
+	// Watchdog reconnects a binlog stream that went silent.
+	Watchdog WatchdogConfig `mapstructure:"watchdog"`
+	// Apply bounds how changes are written to the target.
+	Apply ApplyConfig `mapstructure:"apply"`
+	// ForeignKeys is how target foreign keys are respected: "order"
+	// (default) applies parents before children, "disable_checks" turns
+	// the checks off while applying, "ignore" does neither.
+	ForeignKeys string `mapstructure:"foreign_keys"`
+	// TargetSchema is a directory of migration files, applied in name
+	// order, or a schema dump that creates the target tables when a run
+	// starts and none of them exist yet.
+	TargetSchema string `mapstructure:"target_schema"`
+	// Snapshot is how a dump is loaded: "in_place" (default) writes its
+	// rows straight to the target tables, where readers see them half
+	// loaded; "shadow" loads them into table__sync_new copies, swapped in
+	// with one RENAME TABLE once loaded. Shadow needs a MySQL target and
+	// tables without foreign keys.
+	Snapshot string `mapstructure:"snapshot"`
+	// Observe runs syncs read-only: changes are captured and compared with
+	// the target, and lag, conflicts and would-be changes are reported, but
+	// nothing is written to the target and sync state isn't advanced.
+	Observe bool `mapstructure:"observe"`
+	// ExactlyOnce resumes binlog capture from the positions recorded in the
+	// target's sync_checkpoint table, which is written in the same
+	// transaction as the rows, instead of the source's current position.
+	// Changes already applied are skipped, so none are lost or applied
+	// twice even if the state store is lost. Other sinks are sent the
+	// changes since the earliest table's position again.
+	ExactlyOnce bool `mapstructure:"exactly_once"`
+	// Conflicts bounds how detected conflicts are written and alerted on.
+	Conflicts ConflictConfig `mapstructure:"conflicts"`
+	// Resync bounds table rebuilds started through the API.
+	Resync ResyncConfig `mapstructure:"resync"`
+	// IncludeAll syncs every table of the source database, besides those
+	// in Tables, unless Exclude matches it.
+	IncludeAll bool `mapstructure:"include_all"`
+	// Exclude lists table name patterns, e.g. "tmp_*", that neither
+	// IncludeAll nor the patterns in Tables select.
+	Exclude []string `mapstructure:"exclude"`
+	// DiscoveryInterval is how often the source is checked for new tables
+	// that IncludeAll or a pattern selects, 1m by default and 0 for never.
+	DiscoveryInterval string `mapstructure:"discovery_interval"`
+	// SchemaMappings names the target schema of each source schema whose
+	// tables go elsewhere, {source: target}, for tables qualified as
+	// schema.table without a target_name. Unmapped schemas keep their name.
+	SchemaMappings map[string]string `mapstructure:"schema_mappings"`
+	// Conversion governs how row values are converted to the types of
+	// their columns before they are bound against the target.
+	Conversion ConversionConfig `mapstructure:"conversion"`
+	// Debug keeps recent binlog events for inspection.
+	Debug DebugConfig `mapstructure:"debug"`
+}
+
+// DebugConfig governs the sampling of binlog events for
+// GET /api/v1/debug/events, which can also be switched on and off at
+// runtime.
+type DebugConfig struct {
+	// SampleEvents keeps the most recent binlog events in memory, with
+	// their row values as read.
+	SampleEvents bool `mapstructure:"sample_events"`
+	// SampleSize is how many events are kept; default 500.
+	SampleSize int `mapstructure:"sample_size"`
+}
+
+// GetSampleSize defaults to 500.
+func (d DebugConfig) GetSampleSize() int {
+	if d.SampleSize <= 0 {
+		return 500
+	}
+	return d.SampleSize
+}
+
+// ConversionConfig governs the conversion of row values, as the binlog and
+// the database drivers deliver them, to the types of their columns.
+type ConversionConfig struct {
+	// Strict fails the changes of a row holding a value that doesn't fit
+	// its column, e.g. invalid JSON, an enum index out of range or a zero
+	// date for a target that can't store one. By default such a value is
+	// passed on for the driver to coerce, and counted.
+	Strict bool `mapstructure:"strict"`
+	// Timezone, e.g. "UTC", is the zone TIMESTAMP values read from the
+	// binlog are rendered in, the service's local zone by default. It
+	// should be the time zone of the database sessions; DATETIME values
+	// carry no zone and are copied as they are.
+	Timezone string `mapstructure:"timezone"`
+}
+
+// GetLocation loads Timezone, time.Local if it is unset.
+func (c ConversionConfig) GetLocation() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(c.Timezone)
+}
+
+// GetDiscoveryInterval defaults to a minute; 0 turns discovery off.
+func (s SyncConfig) GetDiscoveryInterval() time.Duration {
+	if s.DiscoveryInterval == "" {
+		return time.Minute
+	}
+	d, err := time.ParseDuration(s.DiscoveryInterval)
+	if err != nil || d < 0 {
+		return time.Minute
+	}
+	return d
+}
+
+// MapSchemas gives tables qualified as schema.table, without a target name,
+// the target name SchemaMappings maps them to. Patterns are mapped as the
+// tables they select are.
+func (s *SyncConfig) MapSchemas() {
+	for i, table := range s.Tables {
+		if !IsTablePattern(table.Name) {
+			s.Tables[i] = s.MapSchema(table)
+		}
+	}
+}
+
+// MapSchema is table with the target name SchemaMappings gives it, if any.
+func (s SyncConfig) MapSchema(table TableConfig) TableConfig {
+	schema, name := SplitTable(table.Name, "")
+	target, ok := s.SchemaMappings[schema]
+	if schema != "" && ok && target != "" && table.TargetName == "" {
+		table.TargetName = target + "." + name
+	}
+	return table
+}
+
+// IsTablePattern reports whether a table name is a pattern, e.g. "orders_*".
+func IsTablePattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// WorkerScalingConfig resizes the worker pool every Interval between
+// MinWorkers and MaxWorkers. The pool grows while the event queue is at
+// least ScaleUpUtilization full and batches apply within MaxApplyLatency,
+// and shrinks once the queue stays below ScaleDownUtilization or batches
+// take longer than MaxApplyLatency, a sign the target is saturated.
+type WorkerScalingConfig struct {
+	Enabled              bool    `mapstructure:"enabled"`
+	MinWorkers           int     `mapstructure:"min_workers"`
+	MaxWorkers           int     `mapstructure:"max_workers"`
+	Interval             string  `mapstructure:"interval"`
+	ScaleUpUtilization   float64 `mapstructure:"scale_up_utilization"`
+	ScaleDownUtilization float64 `mapstructure:"scale_down_utilization"`
+	MaxApplyLatency      string  `mapstructure:"max_apply_latency"`
+}
+
+func (w WorkerScalingConfig) GetMinWorkers() int {
+	if w.MinWorkers <= 0 {
+		return 1
+	}
+	return w.MinWorkers
+}
+
+// GetMaxWorkers defaults to twice the configured workers.
+func (w WorkerScalingConfig) GetMaxWorkers(workers int) int {
+	max := w.MaxWorkers
+	if max <= 0 {
+		max = 2 * workers
+	}
+	if min := w.GetMinWorkers(); max < min {
+		max = min
+	}
+	return max
+}
+
+func (w WorkerScalingConfig) GetInterval() time.Duration {
+	d, err := time.ParseDuration(w.Interval)
+	if err != nil || d <= 0 {
+		return 10 * time.Second
+	}
+	return d
+}
+
+func (w WorkerScalingConfig) GetScaleUpUtilization() float64 {
+	if w.ScaleUpUtilization <= 0 || w.ScaleUpUtilization > 1 {
+		return 0.5
+	}
+	return w.ScaleUpUtilization
+}
+
+func (w WorkerScalingConfig) GetScaleDownUtilization() float64 {
+	if w.ScaleDownUtilization <= 0 || w.ScaleDownUtilization >= w.GetScaleUpUtilization() {
+		return 0.1
+	}
+	return w.ScaleDownUtilization
+}
+
+func (w WorkerScalingConfig) GetMaxApplyLatency() time.Duration {
+	d, err := time.ParseDuration(w.MaxApplyLatency)
+	if err != nil || d <= 0 {
+		return 2 * time.Second
+	}
+	return d
+}
+
+// ResyncConfig bounds a table rebuild. Changes made to the table while it
+// is copied are held in memory to be replayed onto the copy; past
+// MaxBufferedBytes of them the rebuild fails.
+type ResyncConfig struct {
+	MaxBufferedBytes int64 `mapstructure:"max_buffered_bytes"`
+}
+
+func (r ResyncConfig) GetMaxBufferedBytes() int64 {
+	if r.MaxBufferedBytes <= 0 {
+		return 256 << 20
+	}
+	return r.MaxBufferedBytes
+}
+
+// ConflictConfig batches conflict records into the state store, so a burst
+// of conflicts costs few round trips. Waiting conflicts are written
+// BatchSize at a time, at least every FlushInterval and at most
+// MaxPerSecond a second; once MaxBuffered are waiting, new ones are
+// dropped and counted. A minute with StormThreshold or more conflicts
+// sends one summary alert.
+type ConflictConfig struct {
+	BatchSize      int    `mapstructure:"batch_size"`
+	FlushInterval  string `mapstructure:"flush_interval"`
+	MaxPerSecond   int    `mapstructure:"max_per_second"`
+	MaxBuffered    int    `mapstructure:"max_buffered"`
+	StormThreshold int    `mapstructure:"storm_threshold"`
+}
+
+func (c ConflictConfig) GetBatchSize() int {
+	if c.BatchSize <= 0 {
+		return 200
+	}
+	return c.BatchSize
+}
+
+func (c ConflictConfig) GetFlushInterval() time.Duration {
+	d, err := time.ParseDuration(c.FlushInterval)
+	if err != nil || d <= 0 {
+		return time.Second
+	}
+	return d
+}
+
+func (c ConflictConfig) GetMaxPerSecond() int {
+	if c.MaxPerSecond <= 0 {
+		return 1000
+	}
+	return c.MaxPerSecond
+}
+
+func (c ConflictConfig) GetMaxBuffered() int {
+	if c.MaxBuffered <= 0 {
+		return 50000
+	}
+	return c.MaxBuffered
+}
+
+func (c ConflictConfig) GetStormThreshold() int {
+	if c.StormThreshold <= 0 {
+		return 100
+	}
+	return c.StormThreshold
+}
+
+func (s SyncConfig) GetForeignKeys() string {
+	if s.ForeignKeys == "" {
+		return "order"
+	}
+	return s.ForeignKeys
+}
+
+// TransactionConfig applies each source transaction in one target
+// transaction when Preserve is set. Transactions larger than MaxRows or
+// MaxBytes (estimated, in memory) are applied in chunks instead, so one
+// huge transaction can't be held in memory.
+type TransactionConfig struct {
+	Preserve bool  `mapstructure:"preserve"`
+	MaxRows  int   `mapstructure:"max_rows"`
+	MaxBytes int64 `mapstructure:"max_bytes"`
+}
+
+func (t TransactionConfig) GetMaxRows() int {
+	if t.MaxRows <= 0 {
+		return 50000
+	}
+	return t.MaxRows
+}
+
+func (t TransactionConfig) GetMaxBytes() int64 {
+	if t.MaxBytes <= 0 {
+		return 64 << 20
+	}
+	return t.MaxBytes
+}
+
+// ApplyConfig caps the rows written per target transaction, ChunkRows, and
+// the rows and target transactions per second across workers (0 means
+// unthrottled). Source transactions of at least ProgressRows rows are
+// tracked until applied.
+type ApplyConfig struct {
+	ChunkRows                int `mapstructure:"chunk_rows"`
+	MaxRowsPerSecond         int `mapstructure:"max_rows_per_second"`
+	MaxTransactionsPerSecond int `mapstructure:"max_transactions_per_second"`
+	ProgressRows             int `mapstructure:"progress_rows"`
+	// UpsertUpdates writes updated rows that keep their key as upserts,
+	// which a MySQL target merges with neighbouring inserts into multi-row
+	// statements. An updated row missing on the target is then inserted,
+	// as far as the update's columns go, rather than left missing.
+	UpsertUpdates bool `mapstructure:"upsert_updates"`
+}
+
+func (a ApplyConfig) GetChunkRows() int {
+	if a.ChunkRows <= 0 {
+		return 5000
+	}
+	return a.ChunkRows
+}
+
+func (a ApplyConfig) GetProgressRows() int {
+	if a.ProgressRows <= 0 {
+		return 10000
+	}
+	return a.ProgressRows
+}
+
+// CircuitBreakerConfig opens a sink's circuit after FailureThreshold
+// batches fail in a row, then probes the target every ProbeInterval.
+type CircuitBreakerConfig struct {
+	FailureThreshold int    `mapstructure:"failure_threshold"`
+	ProbeInterval    string `mapstructure:"probe_interval"`
+}
+
+func (c CircuitBreakerConfig) GetFailureThreshold() int {
+	if c.FailureThreshold <= 0 {
+		return 5
+	}
+	return c.FailureThreshold
+}
+
+func (c CircuitBreakerConfig) GetProbeInterval() time.Duration {
+	d, err := time.ParseDuration(c.ProbeInterval)
+	if err != nil || d <= 0 {
+		return 10 * time.Second
+	}
+	return d
+}
+
+// WatchdogConfig asks the source for a heartbeat every Heartbeat while the
+// binlog is idle and treats a stream silent for Timeout as dead. A dead
+// stream is reconnected with exponential backoff up to MaxBackoff, and
+// alerted on after AlertAfter reconnects in a row fail.
+type WatchdogConfig struct {
+	Heartbeat  string `mapstructure:"heartbeat"`
+	Timeout    string `mapstructure:"timeout"`
+	MaxBackoff string `mapstructure:"max_backoff"`
+	AlertAfter int    `mapstructure:"alert_after"`
+}
+
+func (w WatchdogConfig) GetHeartbeat() time.Duration {
+	d, err := time.ParseDuration(w.Heartbeat)
+	if err != nil || d <= 0 {
+		return 10 * time.Second
+	}
+	return d
+}
+
+func (w WatchdogConfig) GetTimeout() time.Duration {
+	d, err := time.ParseDuration(w.Timeout)
+	if err != nil || d <= w.GetHeartbeat() {
+		return 3 * w.GetHeartbeat()
+	}
+	return d
+}
+
+func (w WatchdogConfig) GetMaxBackoff() time.Duration {
+	d, err := time.ParseDuration(w.MaxBackoff)
+	if err != nil || d <= 0 {
+		return time.Minute
+	}
+	return d
+}
+
+func (w WatchdogConfig) GetAlertAfter() int {
+	if w.AlertAfter <= 0 {
+		return 3
+	}
+	return w.AlertAfter
+}
+
+func (s SyncConfig) GetSnapshot() string {
+	if s.Snapshot == "" {
+		return "in_place"
+	}
+	return s.Snapshot
+}
+
+func (s SyncConfig) GetPollInterval() time.Duration {
+	d, err := time.ParseDuration(s.PollInterval)
+	if err != nil || d <= 0 {
+		return 10 * time.Second
+	}
+	return d
+}
+
+type GroupConfig struct {
+	Name   string   `mapstructure:"name"`
+	Tables []string `mapstructure:"tables"`
+}
+
+// SinkConfig is one output for replicated changes: "mysql" (the cloud
+// database) or "kafka" (one topic per table, Debezium-style envelopes).
+type SinkConfig struct {
+	Type        string   `mapstructure:"type"`
+	Brokers     []string `mapstructure:"brokers"`
+	TopicPrefix string   `mapstructure:"topic_prefix"`
+	Format      string   `mapstructure:"format"` // json | avro
+}
+
+// QueueConfig selects the buffer between the binlog reader and the workers.
+// "memory" blocks the reader when full; "disk" spills overflow to segment
+// files under Dir so the reader keeps going through target outages.
+type QueueConfig struct {
+	Type         string `mapstructure:"type"`
+	Capacity     int    `mapstructure:"capacity"` // events held in memory
+	Dir          string `mapstructure:"dir"`
+	SegmentBytes int64  `mapstructure:"segment_bytes"`
+	MaxDiskBytes int64  `mapstructure:"max_disk_bytes"` // 0 means unbounded
+	// Persist keeps a disk queue's spilled events across stops and
+	// restarts, to be drained in order before newly read ones, so changes
+	// captured while the target was unreachable survive the binlog being
+	// purged. Events already handed to the workers aren't kept.
+	Persist bool `mapstructure:"persist"`
+}
+
+// GetFlushInterval defaults to 500ms.
+func (s SyncConfig) GetFlushInterval() time.Duration {
+	d, err := time.ParseDuration(s.FlushInterval)
+	if err != nil || d <= 0 {
+		return 500 * time.Millisecond
+	}
+	return d
+}
+
+func (s SyncConfig) GetLagThreshold() time.Duration {
+	d, _ := time.ParseDuration(s.LagThreshold)
+	return d
 }
 
 type TableConfig struct {
+	// Name is qualified as schema.table for a table outside the source
+	// connection's database; the target table is then in the schema of
+	// the same name, unless SyncConfig.SchemaMappings or TargetName say
+	// otherwise. A pattern, e.g. "orders_*" or "billing.*", selects every
+	// source table it matches, with the rest of these settings; a table
+	// without primary_key takes the source's.
 	Name               string `mapstructure:"name"`
 	ConflictResolution string `mapstructure:"conflict_resolution"`
 	BatchSize          int    `mapstructure:"batch_size"`
 	PrimaryKey         string `mapstructure:"primary_key"`
 	TimestampColumn    string `mapstructure:"timestamp_column"`
+	LagThreshold       string `mapstructure:"lag_threshold"`
+	// EncryptedColumns hold ciphertext on the target, sealed with the keyring
+	EncryptedColumns []string `mapstructure:"encrypted_columns"`
+	// ColumnPolicies transform sensitive columns before rows reach the
+	// target, e.g. {email: {policy: hash}, ssn: {policy: mask, keep: 4}}.
+	// Primary key columns may only be hashed.
+	ColumnPolicies map[string]ColumnPolicy `mapstructure:"column_policies"`
+	// ColumnDirections restricts single columns of a bidirectional table to
+	// one direction, e.g. {price: cloud_to_local, stock_count: local_to_cloud}
+	ColumnDirections map[string]string `mapstructure:"column_directions"`
+	// TriggerColumns, when set, drops UPDATE rows where none of these
+	// columns changed, e.g. to ignore touches of last_seen_at alone
+	TriggerColumns []string `mapstructure:"trigger_columns"`
+	// Operations, when set, are the only binlog operations replicated:
+	// "insert", "update" and "delete", e.g. [insert] for an append-only
+	// table. The others are dropped as they are read.
+	Operations []string `mapstructure:"operations"`
+	// Routes split rows across target tables by predicate. The first
+	// matching route wins; rows matching none are not replicated.
+	Routes []RouteConfig `mapstructure:"routes"`
+	// Capture overrides SyncConfig.Capture for this table
+	Capture string `mapstructure:"capture"`
+	// DeleteMode is how source deletes reach the target: "hard" (default)
+	// deletes the row, "soft" marks it via SoftDeleteColumn and "ignore"
+	// leaves it in place.
+	DeleteMode string `mapstructure:"delete_mode"`
+	// SoftDeleteColumn is set to the delete time on soft deletes, or to
+	// true if SoftDeleteFlag is set (e.g. for an is_deleted column).
+	SoftDeleteColumn string `mapstructure:"soft_delete_column"`
+	SoftDeleteFlag   bool   `mapstructure:"soft_delete_flag"`
+	// TargetName is the target table when it is named differently from
+	// the source table; routes name their own targets.
+	TargetName string `mapstructure:"target_name"`
+	// ColumnMappings renames source columns on the target, {source: target}.
+	// Everything else in the table config names source columns.
+	ColumnMappings map[string]string `mapstructure:"column_mappings"`
+	// MaxRowsPerSecond and MaxTransactionsPerSecond throttle this table on
+	// top of SyncConfig.Apply; 0 means unthrottled.
+	MaxRowsPerSecond         int `mapstructure:"max_rows_per_second"`
+	MaxTransactionsPerSecond int `mapstructure:"max_transactions_per_second"`
+}
+
+// ColumnPolicy is how one column is transformed on its way to the target.
+type ColumnPolicy struct {
+	// Policy is "mask", "hash" (keyed HMAC-SHA256, hex), "encrypt" (with
+	// the keyring, as EncryptedColumns) or "nullify"
+	Policy string `mapstructure:"policy"`
+	// Keep leaves this many trailing characters unmasked
+	Keep int `mapstructure:"keep"`
+}
+
+// SplitTable splits a table name qualified as schema.table; an unqualified
+// one is in defaultSchema.
+func SplitTable(name, defaultSchema string) (schema, table string) {
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		return name[:i], name[i+1:]
+	}
+	return defaultSchema, name
+}
+
+func (t TableConfig) GetTargetName() string {
+	if t.TargetName == "" {
+		return t.Name
+	}
+	return t.TargetName
+}
+
+// TargetColumn returns the target name of a source column.
+func (t TableConfig) TargetColumn(column string) string {
+	for source, target := range t.ColumnMappings {
+		if strings.EqualFold(source, column) && target != "" {
+			return target
+		}
+	}
+	return column
+}
+
+func (t TableConfig) GetDeleteMode() string {
+	if t.DeleteMode == "" {
+		return "hard"
+	}
+	return strings.ToLower(t.DeleteMode)
+}
+
+func (t TableConfig) GetSoftDeleteColumn() string {
+	if t.SoftDeleteColumn == "" {
+		return "deleted_at"
+	}
+	return t.SoftDeleteColumn
+}
+
+// GetCapture returns the table's capture mode, falling back to the default.
+func (t TableConfig) GetCapture(defaultCapture string) string {
+	if t.Capture != "" {
+		return t.Capture
+	}
+	if defaultCapture != "" {
+		return defaultCapture
+	}
+	return "binlog"
+}
+
+// RouteConfig sends rows matching every condition in Filter to Target.
+// A route with no filter matches all remaining rows.
+type RouteConfig struct {
+	Target string            `mapstructure:"target"`
+	Filter []FilterCondition `mapstructure:"filter"`
+}
+
+// FilterCondition compares one column of the source row. Operator is one of
+// eq, ne, in, not_in, is_null, not_null.
+type FilterCondition struct {
+	Column   string   `mapstructure:"column"`
+	Operator string   `mapstructure:"operator"`
+	Value    string   `mapstructure:"value"`
+	Values   []string `mapstructure:"values"`
+}
+
+func (t TableConfig) GetLagThreshold() time.Duration {
+	d, _ := time.ParseDuration(t.LagThreshold)
+	return d
 }
 
 type SchedulerConfig struct {
 	Enabled  bool   `mapstructure:"enabled"`
 	Interval string `mapstructure:"interval"`
+	// MaxLag (e.g. "5m") skips scheduled runs while any table lags further
+	// behind. Defaults to the sync lag threshold.
+	MaxLag string `mapstructure:"max_lag"`
+	// CatchUp runs one sync at startup when a window was missed while down;
+	// windows older than CatchUpMaxStaleness (e.g. "24h") are not caught up.
+	CatchUp             bool   `mapstructure:"catch_up"`
+	CatchUpMaxStaleness string `mapstructure:"catch_up_max_staleness"`
+	// Jobs are named schedules of their own besides Interval's, e.g. a
+	// weekly resync of every table and a sync of a few tables every five
+	// minutes. Interval may be left empty when jobs are given.
+	Jobs []ScheduledJob `mapstructure:"jobs"`
+	// Blackouts are recurring windows in which scheduled syncs don't
+	// start, e.g. while the target is backed up
+	Blackouts []BlackoutWindow `mapstructure:"blackouts"`
+}
+
+// BlackoutWindow is a recurring period, e.g. 02:00-04:00 on Sundays. An End
+// before Start ends the window the next day. With PauseApplies a running
+// sync is paused for the window as well, changes waiting in the source's
+// binlog until it ends, unless the sync is resumed by hand.
+type BlackoutWindow struct {
+	Name         string   `mapstructure:"name"`
+	Days         []string `mapstructure:"days"` // e.g. [sat, sun]; every day if empty
+	Start        string   `mapstructure:"start"`
+	End          string   `mapstructure:"end"`
+	Timezone     string   `mapstructure:"timezone"` // IANA name; the server's if empty
+	PauseApplies bool     `mapstructure:"pause_applies"`
+}
+
+// ScheduledJob runs Job on a cron Schedule. A sync job starts a run of
+// Tables, every table if empty, unless one is running; a resync job
+// rebuilds Tables, every table of the current run if empty, in Mode
+// (shadow or truncate) while a run is going. A disabled job is only run
+// when triggered through the API.
+type ScheduledJob struct {
+	Name     string   `mapstructure:"name"`
+	Schedule string   `mapstructure:"schedule"`
+	Job      string   `mapstructure:"job"`
+	Tables   []string `mapstructure:"tables"`
+	Mode     string   `mapstructure:"mode"`
+	Disabled bool     `mapstructure:"disabled"`
+}
+
+// GetJob defaults to sync.
+func (j ScheduledJob) GetJob() string {
+	if j.Job == "" {
+		return "sync"
+	}
+	return j.Job
+}
+
+func (s SchedulerConfig) GetMaxLag() time.Duration {
+	d, _ := time.ParseDuration(s.MaxLag)
+	return d
+}
+
+func (s SchedulerConfig) GetCatchUpMaxStaleness() time.Duration {
+	d, _ := time.ParseDuration(s.CatchUpMaxStaleness)
+	return d
+}
+
+// RetentionConfig purges old records from the state store on the
+// scheduler's cron. Ages are durations, with d for days, e.g. "30d"; an
+// empty one keeps those records forever.
+type RetentionConfig struct {
+	Schedule            string `mapstructure:"schedule"`
+	ResolvedConflicts   string `mapstructure:"resolved_conflicts"`
+	UnresolvedConflicts string `mapstructure:"unresolved_conflicts"`
+	History             string `mapstructure:"history"`
+}
+
+// GetSchedule defaults to daily at 03:00.
+func (r RetentionConfig) GetSchedule() string {
+	if r.Schedule == "" {
+		return "0 3 * * *"
+	}
+	return r.Schedule
+}
+
+func (r RetentionConfig) GetResolvedConflicts() time.Duration {
+	d, _ := ParseAge(r.ResolvedConflicts)
+	return d
+}
+
+func (r RetentionConfig) GetUnresolvedConflicts() time.Duration {
+	d, _ := ParseAge(r.UnresolvedConflicts)
+	return d
+}
+
+func (r RetentionConfig) GetHistory() time.Duration {
+	d, _ := ParseAge(r.History)
+	return d
+}
+
+// Enabled reports whether anything is ever purged.
+func (r RetentionConfig) Enabled() bool {
+	return r.GetResolvedConflicts() > 0 || r.GetUnresolvedConflicts() > 0 || r.GetHistory() > 0
+}
+
+// ParseAge parses a duration that may also be a whole number of days,
+// e.g. "30d".
+func ParseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
 }
 
 type ServerConfig struct {
 	Port         int      `mapstructure:"port"`
+	GRPCPort     int      `mapstructure:"grpc_port"` // 0 disables the gRPC API
 	Host         string   `mapstructure:"host"`
 	AuthToken    string   `mapstructure:"auth_token"`
 	ReadTimeout  string   `mapstructure:"read_timeout"`
 	WriteTimeout string   `mapstructure:"write_timeout"`
 	CorsOrigins  []string `mapstructure:"cors_origins"`
+	// Tokens are bearer tokens limited to some tables and actions, next to
+	// the full-access AuthToken. Without either the API is open.
+	Tokens []APITokenConfig `mapstructure:"tokens"`
+	// ProbeTimeout bounds each dependency probe of /readyz
+	ProbeTimeout string `mapstructure:"probe_timeout"`
+}
+
+// APITokenConfig is a bearer token restricted to Tables (all if empty) and
+// Actions: trigger, pause, resolve and admin (all if empty). Any token may
+// read status; table-scoped reads only see its tables.
+type APITokenConfig struct {
+	Name     string   `mapstructure:"name"`
+	Token    string   `mapstructure:"token"`
+	TokenEnv string   `mapstructure:"token_env"` // or the environment variable holding it
+	Tables   []string `mapstructure:"tables"`
+	Actions  []string `mapstructure:"actions"`
 }
 
 func (s ServerConfig) GetReadTimeout() time.Duration {
@@ -73,6 +928,15 @@ func (s ServerConfig) GetReadTimeout() time.Duration {
 	return d
 }
 
+// GetProbeTimeout defaults to 2s.
+func (s ServerConfig) GetProbeTimeout() time.Duration {
+	d, err := time.ParseDuration(s.ProbeTimeout)
+	if err != nil || d <= 0 {
+		return 2 * time.Second
+	}
+	return d
+}
+
 func (s ServerConfig) GetWriteTimeout() time.Duration {
 	d, _ := time.ParseDuration(s.WriteTimeout)
 	return d
@@ -81,4 +945,174 @@ func (s ServerConfig) GetWriteTimeout() time.Duration {
 type LoggingConfig struct {
 	Level  string `mapstructure:"level"`
 	Format string `mapstructure:"format"`
+	// Modules sets the level of single packages, e.g. sync: debug
+	Modules       map[string]string   `mapstructure:"modules"`
+	DebugSampling DebugSamplingConfig `mapstructure:"debug_sampling"`
+}
+
+// DebugSamplingConfig limits debug logging to the first Initial entries
+// of each message per second, then every Thereafter-th. Zero Initial logs
+// every entry.
+type DebugSamplingConfig struct {
+	Initial    int `mapstructure:"initial"`
+	Thereafter int `mapstructure:"thereafter"`
+}
+
+type AlertingConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Cooldown suppresses repeats of the same alert (same kind and subject)
+	Cooldown string `mapstructure:"cooldown"`
+	// MaxPerMinute caps total notifications across all alert kinds
+	MaxPerMinute             int              `mapstructure:"max_per_minute"`
+	CheckInterval            string           `mapstructure:"check_interval"`
+	ConflictBacklogThreshold int              `mapstructure:"conflict_backlog_threshold"`
+	DLQThreshold             int              `mapstructure:"dlq_threshold"`
+	Notifiers                []NotifierConfig `mapstructure:"notifiers"`
+}
+
+func (a AlertingConfig) GetCooldown() time.Duration {
+	d, err := time.ParseDuration(a.Cooldown)
+	if err != nil || d <= 0 {
+		return 10 * time.Minute
+	}
+	return d
+}
+
+func (a AlertingConfig) GetCheckInterval() time.Duration {
+	d, err := time.ParseDuration(a.CheckInterval)
+	if err != nil || d <= 0 {
+		return time.Minute
+	}
+	return d
+}
+
+type NotifierConfig struct {
+	Type        string `mapstructure:"type"` // slack | webhook | email
+	Name        string `mapstructure:"name"`
+	MinSeverity string `mapstructure:"min_severity"`
+
+	// slack / webhook
+	URL     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers"`
+	Channel string            `mapstructure:"channel"`
+
+	// email
+	SMTPHost string   `mapstructure:"smtp_host"`
+	SMTPPort int      `mapstructure:"smtp_port"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+}
+
+type EncryptionConfig struct {
+	Keys []EncryptionKey `mapstructure:"keys"`
+	// ActiveVersion selects the key for new ciphertext; defaults to the highest version
+	ActiveVersion     int `mapstructure:"active_version"`
+	RotationChunkSize int `mapstructure:"rotation_chunk_size"`
+	// HashKey keys the HMAC of "hash" column policies; its version is unused
+	HashKey EncryptionKey `mapstructure:"hash_key"`
+}
+
+type EncryptionKey struct {
+	Version int    `mapstructure:"version"`
+	Key     string `mapstructure:"key"`     // base64-encoded 32-byte AES key
+	KeyEnv  string `mapstructure:"key_env"` // or the environment variable holding it
+	// KeyCommand runs e.g. a KMS or vault CLI that prints the base64 key
+	KeyCommand []string `mapstructure:"key_command"`
+	// Provider names a registered key provider plugin, which fetches KeyID
+	Provider string `mapstructure:"provider"`
+	KeyID    string `mapstructure:"key_id"`
+}
+
+// AuditConfig records every change applied to the target, for compliance.
+type AuditConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Type is "file" (default), JSON lines rotated by size, or "table",
+	// the state store's audit_log table
+	Type         string `mapstructure:"type"`
+	Path         string `mapstructure:"path"`
+	MaxFileBytes int64  `mapstructure:"max_file_bytes"`
+	MaxFiles     int    `mapstructure:"max_files"` // rotated files kept
+}
+
+// GetPath defaults to ./data/audit/audit.jsonl.
+func (a AuditConfig) GetPath() string {
+	if a.Path == "" {
+		return "./data/audit/audit.jsonl"
+	}
+	return a.Path
+}
+
+// GetMaxFileBytes defaults to 100MB.
+func (a AuditConfig) GetMaxFileBytes() int64 {
+	if a.MaxFileBytes <= 0 {
+		return 100 << 20
+	}
+	return a.MaxFileBytes
+}
+
+// GetMaxFiles defaults to 10.
+func (a AuditConfig) GetMaxFiles() int {
+	if a.MaxFiles <= 0 {
+		return 10
+	}
+	return a.MaxFiles
+}
+
+// LeaderConfig elects one of several instances sharing a config to sync,
+// through a lease in the state store. The others stand by, refusing to
+// start runs while they keep track of the checkpoints and health-check the
+// leader, and one of them takes over once the leader's lease expires or
+// the leader has been unhealthy for FailoverWindow.
+type LeaderConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Lease names what is led; instances syncing the same source to the
+	// same target must share it. Defaults to one derived from both.
+	Lease string `mapstructure:"lease"`
+	// Instance names this instance; defaults to hostname and process ID
+	Instance string `mapstructure:"instance"`
+	// TTL is how long a lease outlives its holder's last renewal, and so
+	// how long a failed leader's work waits for another instance
+	TTL string `mapstructure:"ttl"`
+	// RenewInterval defaults to a third of TTL; standbys check the
+	// leader's health as often
+	RenewInterval string `mapstructure:"renew_interval"`
+	// Advertise is the URL of this instance's API, e.g. "http://sync-a:8080",
+	// which standbys health-check while it leads. Without it they go by
+	// lease renewals alone.
+	Advertise string `mapstructure:"advertise"`
+	// FailoverWindow is how long the leader may fail its health checks, or
+	// go without renewing its lease, before a standby takes over; a leader
+	// unable to renew steps down after as long. Defaults to TTL, and is
+	// kept within it.
+	FailoverWindow string `mapstructure:"failover_window"`
+}
+
+// GetTTL defaults to 15s.
+func (l LeaderConfig) GetTTL() time.Duration {
+	d, err := time.ParseDuration(l.TTL)
+	if err != nil || d <= 0 {
+		return 15 * time.Second
+	}
+	return d
+}
+
+// GetRenewInterval defaults to a third of the TTL, and is kept below it.
+func (l LeaderConfig) GetRenewInterval() time.Duration {
+	d, err := time.ParseDuration(l.RenewInterval)
+	if err != nil || d <= 0 || d >= l.GetTTL() {
+		return l.GetTTL() / 3
+	}
+	return d
+}
+
+// GetFailoverWindow defaults to the TTL, and is kept between the renewal
+// interval and the TTL.
+func (l LeaderConfig) GetFailoverWindow() time.Duration {
+	d, err := time.ParseDuration(l.FailoverWindow)
+	if err != nil || d <= l.GetRenewInterval() || d > l.GetTTL() {
+		return l.GetTTL()
+	}
+	return d
 }
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	xunicode "golang.org/x/text/encoding/unicode"
+)
+
+// DefaultCharset is the character set of connections that declare none.
+const DefaultCharset = "utf8mb4"
+
+// charsetEncodings maps MySQL character sets to their encodings; those of
+// the UTF-8 family and ascii are in utf8Charsets instead.
+var charsetEncodings = map[string]encoding.Encoding{
+	"latin1":   charmap.Windows1252, // MySQL's latin1 is cp1252
+	"latin2":   charmap.ISO8859_2,
+	"latin5":   charmap.ISO8859_9,
+	"latin7":   charmap.ISO8859_13,
+	"greek":    charmap.ISO8859_7,
+	"hebrew":   charmap.ISO8859_8,
+	"cp1250":   charmap.Windows1250,
+	"cp1251":   charmap.Windows1251,
+	"cp1256":   charmap.Windows1256,
+	"cp1257":   charmap.Windows1257,
+	"cp850":    charmap.CodePage850,
+	"cp852":    charmap.CodePage852,
+	"cp866":    charmap.CodePage866,
+	"koi8r":    charmap.KOI8R,
+	"koi8u":    charmap.KOI8U,
+	"macroman": charmap.Macintosh,
+	"sjis":     japanese.ShiftJIS,
+	"cp932":    japanese.ShiftJIS,
+	"ujis":     japanese.EUCJP,
+	"eucjpms":  japanese.EUCJP,
+	"euckr":    korean.EUCKR,
+	"gbk":      simplifiedchinese.GBK,
+	"gb2312":   simplifiedchinese.GBK,
+	"gb18030":  simplifiedchinese.GB18030,
+	"big5":     traditionalchinese.Big5,
+	"utf16":    xunicode.UTF16(xunicode.BigEndian, xunicode.IgnoreBOM),
+	"utf16le":  xunicode.UTF16(xunicode.LittleEndian, xunicode.IgnoreBOM),
+	"ucs2":     xunicode.UTF16(xunicode.BigEndian, xunicode.IgnoreBOM),
+}
+
+// utf8Charsets maps the character sets stored as UTF-8, or a subset of it,
+// to the highest character each holds.
+var utf8Charsets = map[string]rune{
+	"utf8mb4": unicode.MaxRune,
+	"utf8mb3": 0xFFFF,
+	"ascii":   0x7F,
+}
+
+// charset is a MySQL character set text is stored in.
+type charset struct {
+	name     string
+	encoding encoding.Encoding // nil if stored as UTF-8
+	maxRune  rune              // the highest character held, if stored as UTF-8
+}
+
+// lookupCharset finds a MySQL character set by name, e.g. "latin1"; ""
+// is DefaultCharset and "utf8" utf8mb3.
+func lookupCharset(name string) (*charset, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "":
+		name = DefaultCharset
+	case "utf8":
+		name = "utf8mb3"
+	}
+	if maxRune, ok := utf8Charsets[name]; ok {
+		return &charset{name: name, maxRune: maxRune}, nil
+	}
+	if enc, ok := charsetEncodings[name]; ok {
+		return &charset{name: name, encoding: enc}, nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q", name)
+}
+
+// CheckCharset reports a character set that isn't supported.
+func CheckCharset(name string) error {
+	_, err := lookupCharset(name)
+	return err
+}
+
+func (cs *charset) utf8() bool {
+	return cs.encoding == nil
+}
+
+// decode reads text stored in cs as UTF-8. Bytes that aren't valid in cs
+// become U+FFFD, and valid is false.
+func (cs *charset) decode(text string) (decoded string, valid bool) {
+	if cs.utf8() {
+		if !utf8.ValidString(text) {
+			return strings.ToValidUTF8(text, string(utf8.RuneError)), false
+		}
+		for _, r := range text {
+			if r > cs.maxRune {
+				return text, false
+			}
+		}
+		return text, true
+	}
+	decoded, err := cs.encoding.NewDecoder().String(text)
+	if err != nil {
+		return strings.ToValidUTF8(text, string(utf8.RuneError)), false
+	}
+	return decoded, !strings.ContainsRune(decoded, utf8.RuneError)
+}
+
+// encode writes UTF-8 text as stored in cs, with '?' for each character cs
+// can't hold, as MySQL does. It returns the text so encoded, the same
+// text in UTF-8, and the characters lost.
+func (cs *charset) encode(text string) (encoded, replaced, lost string) {
+	if cs.utf8() {
+		if cs.maxRune == unicode.MaxRune {
+			return text, text, ""
+		}
+		var b, lostChars strings.Builder
+		for _, r := range text {
+			if r > cs.maxRune {
+				b.WriteByte('?')
+				lostChars.WriteRune(r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+		return b.String(), b.String(), lostChars.String()
+	}
+
+	encoder := cs.encoding.NewEncoder()
+	if encoded, err := encoder.String(text); err == nil {
+		return encoded, text, ""
+	}
+	// Character by character, to find the ones lost
+	var b, utf8Text, lostChars strings.Builder
+	for _, r := range text {
+		char, err := encoder.String(string(r))
+		if err != nil {
+			b.WriteByte('?')
+			utf8Text.WriteByte('?')
+			lostChars.WriteRune(r)
+			continue
+		}
+		b.WriteString(char)
+		utf8Text.WriteRune(r)
+	}
+	return b.String(), utf8Text.String(), lostChars.String()
+}
@@ -0,0 +1,583 @@
+package database
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// errZeroDate marks a zero date, e.g. "0000-00-00", which only MySQL
+// stores.
+var errZeroDate = errors.New("zero date")
+
+// ConversionError describes a value that doesn't fit its column's type.
+type ConversionError struct {
+	Type   string // The column's MySQL type, e.g. "decimal(10,2)"
+	Value  interface{}
+	Reason string
+	// Lossy text was converted between charsets with characters lost;
+	// the value falls back to the text as converted
+	Lossy bool
+}
+
+// lossyText is text converted between charsets with characters lost.
+type lossyText struct {
+	text   string
+	reason string
+}
+
+func (e *lossyText) Error() string {
+	return e.reason
+}
+
+func (e *ConversionError) Error() string {
+	return fmt.Sprintf("%s value %s: %s", e.Type, describeValue(e.Value), e.Reason)
+}
+
+// maxDescribed cuts long values short in errors.
+const maxDescribed = 64
+
+// describeValue shows a value, cut short, and the Go type it came as.
+func describeValue(value interface{}) string {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = strconv.Quote(truncate(v))
+	case []byte:
+		if utf8.Valid(v) {
+			text = strconv.Quote(truncate(string(v)))
+		} else {
+			text = "0x" + truncate(hex.EncodeToString(v))
+		}
+	default:
+		text = truncate(fmt.Sprint(v))
+	}
+	return fmt.Sprintf("%s (%T)", text, value)
+}
+
+func truncate(text string) string {
+	if len(text) <= maxDescribed {
+		return text
+	}
+	return text[:maxDescribed] + "..."
+}
+
+// Converter maps row values, as the binlog or a driver delivers them, to
+// the Go type their MySQL column type calls for before the dialect binds
+// them: integers as int64 (uint64 past its range), decimals as exact
+// strings, enums and sets by name, text as strings and binary as []byte,
+// with JSON, dates and spatial values checked. Nothing is left to driver
+// coercion that can be converted here.
+type Converter struct {
+	dialect Dialect
+	// Strict callers fail on a ConversionError instead of binding the
+	// value Convert falls back to.
+	Strict bool
+	// source and target are the charsets text is read and written in,
+	// nil if it needs no converting
+	source, target *charset
+}
+
+// NewConverter converts values for dialect, text from sourceCharset, the
+// charset the source stores and reads it in, to targetCharset. Text a
+// target other than MySQL gets is UTF-8 whatever its charset.
+func NewConverter(dialect Dialect, strict bool, sourceCharset, targetCharset string) (*Converter, error) {
+	source, err := lookupCharset(sourceCharset)
+	if err != nil {
+		return nil, fmt.Errorf("source: %w", err)
+	}
+	target, err := lookupCharset(targetCharset)
+	if err != nil {
+		return nil, fmt.Errorf("target: %w", err)
+	}
+	c := &Converter{dialect: dialect, Strict: strict}
+	if source.name != target.name || (dialect.Name() != DriverMySQL && !source.utf8()) {
+		c.source, c.target = source, target
+	}
+	return c, nil
+}
+
+// Convert converts value, read from a column of mysqlType, for binding. A
+// value that doesn't fit the type comes back as the dialect alone binds
+// it, along with a *ConversionError. NULLs, and values of columns whose
+// type is unknown or has no conversion, pass through the dialect only.
+func (c *Converter) Convert(mysqlType string, value interface{}) (interface{}, error) {
+	if value == nil || mysqlType == "" {
+		return c.dialect.ConvertValue(mysqlType, value), nil
+	}
+	converted, err := c.convert(mysqlType, value)
+	var lossy *lossyText
+	if errors.As(err, &lossy) {
+		return c.dialect.ConvertValue(mysqlType, lossy.text), &ConversionError{Type: mysqlType, Value: value, Reason: err.Error(), Lossy: true}
+	}
+	if err != nil {
+		return c.dialect.ConvertValue(mysqlType, value), &ConversionError{Type: mysqlType, Value: value, Reason: err.Error()}
+	}
+	return c.dialect.ConvertValue(mysqlType, converted), nil
+}
+
+func (c *Converter) convert(mysqlType string, value interface{}) (interface{}, error) {
+	t := strings.ToLower(strings.TrimSpace(mysqlType))
+	base := t
+	if i := strings.IndexAny(base, "( "); i >= 0 {
+		base = base[:i]
+	}
+
+	switch base {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "year":
+		return toInteger(value)
+	case "bit":
+		return toBits(value)
+	case "decimal", "numeric":
+		return toDecimal(t, value)
+	case "float", "double", "real":
+		return toFloat(value)
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext":
+		return c.toText(value)
+	case "binary":
+		return toFixedBytes(t, value)
+	case "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return toBytes(value)
+	case "enum":
+		return toEnum(mysqlType, value)
+	case "set":
+		return toSet(mysqlType, value)
+	case "json":
+		return toJSON(value)
+	case "date", "datetime", "timestamp":
+		return c.toTime(base, value)
+	case "time":
+		return toClock(value)
+	case "geometry", "point", "linestring", "polygon", "multipoint", "multilinestring",
+		"multipolygon", "geometrycollection", "geomcollection":
+		return c.toSpatial(value)
+	default:
+		return value, nil
+	}
+}
+
+// textOf returns a value that came as text, canal's strings or a driver's
+// bytes.
+func textOf(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	}
+	return "", false
+}
+
+func toInteger(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return unsignedInteger(uint64(v)), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return unsignedInteger(v), nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) > 1<<53 {
+			return nil, fmt.Errorf("not an integer")
+		}
+		return int64(v), nil
+	}
+	text, ok := textOf(value)
+	if !ok {
+		return nil, fmt.Errorf("not an integer")
+	}
+	text = strings.TrimSpace(text)
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n, nil
+	}
+	n, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("not an integer")
+	}
+	return unsignedInteger(n), nil
+}
+
+// unsignedInteger keeps an unsigned value as int64 when it fits.
+func unsignedInteger(n uint64) interface{} {
+	if n > math.MaxInt64 {
+		return n
+	}
+	return int64(n)
+}
+
+// toBits reads a BIT value: canal's integer, or a driver's big-endian
+// bytes.
+func toBits(value interface{}) (interface{}, error) {
+	b, ok := value.([]byte)
+	if !ok {
+		return toInteger(value)
+	}
+	if len(b) > 8 {
+		return nil, fmt.Errorf("more than 64 bits")
+	}
+	var n uint64
+	for _, octet := range b {
+		n = n<<8 | uint64(octet)
+	}
+	return unsignedInteger(n), nil
+}
+
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+
+// toDecimal keeps decimals as exact strings, checking they fit the
+// column's precision and scale, e.g. decimal(10,2), if it has them.
+func toDecimal(t string, value interface{}) (interface{}, error) {
+	var text string
+	switch v := value.(type) {
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		text = strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case fmt.Stringer: // e.g. canal's decimal.Decimal with use_decimal
+		text = v.String()
+	default:
+		var ok bool
+		if text, ok = textOf(value); !ok {
+			n, err := toInteger(value)
+			if err != nil {
+				return nil, fmt.Errorf("not a decimal")
+			}
+			text = fmt.Sprint(n)
+		}
+	}
+	text = strings.TrimSpace(text)
+	if !decimalPattern.MatchString(text) {
+		return nil, fmt.Errorf("not a decimal")
+	}
+
+	precision, scale, ok := decimalArgs(t)
+	if !ok {
+		return text, nil
+	}
+	digits := strings.TrimLeft(strings.TrimLeft(text, "+-"), "0")
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		digits = digits[:i]
+	}
+	if len(digits) > precision-scale {
+		return nil, fmt.Errorf("more than %d digits before the decimal point", precision-scale)
+	}
+	return text, nil
+}
+
+// decimalArgs reads the precision and scale of a decimal type.
+func decimalArgs(t string) (precision, scale int, ok bool) {
+	args := strings.Trim(typeArgs(t), "()")
+	if args == "" {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(args, ",", 2)
+	precision, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, false
+	}
+	if len(parts) == 2 {
+		if scale, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+			return 0, 0, false
+		}
+	}
+	return precision, scale, true
+}
+
+func toFloat(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		// Through its shortest decimal form, so 0.1 doesn't become
+		// 0.10000000149011612
+		return strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
+	}
+	if n, err := toInteger(value); err == nil {
+		switch n := n.(type) {
+		case int64:
+			return float64(n), nil
+		case uint64:
+			return float64(n), nil
+		}
+	}
+	text, ok := textOf(value)
+	if !ok {
+		return nil, fmt.Errorf("not a number")
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil {
+		return nil, fmt.Errorf("not a number")
+	}
+	return f, nil
+}
+
+// toText converts text from the source charset to the target's, with
+// '?' for each character the target can't hold, as MySQL does. Text that
+// loses characters, or isn't valid in the source charset, is lossy.
+func (c *Converter) toText(value interface{}) (interface{}, error) {
+	text, ok := textOf(value)
+	if !ok {
+		return nil, fmt.Errorf("not text")
+	}
+	if c.source == nil {
+		return text, nil
+	}
+	decoded, valid := c.source.decode(text)
+	encoded, replaced, lost := c.target.encode(decoded)
+	if c.dialect.Name() == DriverMySQL {
+		replaced = encoded
+	}
+	switch {
+	case !valid:
+		return nil, &lossyText{text: replaced, reason: fmt.Sprintf("not valid %s text", c.source.name)}
+	case lost != "":
+		return nil, &lossyText{text: replaced, reason: fmt.Sprintf("%s can't hold %q", c.target.name, lost)}
+	}
+	return replaced, nil
+}
+
+func toBytes(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("not binary")
+}
+
+// toFixedBytes pads a BINARY(n) value back to n bytes: the binlog drops
+// the trailing zero bytes MySQL stores it with.
+func toFixedBytes(t string, value interface{}) (interface{}, error) {
+	converted, err := toBytes(value)
+	if err != nil {
+		return nil, err
+	}
+	b := converted.([]byte)
+	size, err := strconv.Atoi(strings.Trim(typeArgs(t), "()"))
+	if err != nil || len(b) >= size {
+		return b, nil
+	}
+	padded := make([]byte, size)
+	copy(padded, b)
+	return padded, nil
+}
+
+// toEnum names an enum value canal read as its 1-based index, 0 being
+// the empty string MySQL stores for invalid values.
+func toEnum(mysqlType string, value interface{}) (interface{}, error) {
+	members := typeMembers(mysqlType)
+	if text, ok := textOf(value); ok {
+		if text != "" && !containsString(members, text) {
+			return nil, fmt.Errorf("not a member of the enum")
+		}
+		return text, nil
+	}
+	index, err := toInteger(value)
+	if err != nil {
+		return nil, fmt.Errorf("not an enum index")
+	}
+	i, ok := index.(int64)
+	switch {
+	case !ok || i < 0 || i > int64(len(members)):
+		return nil, fmt.Errorf("enum index out of range 0-%d", len(members))
+	case i == 0:
+		return "", nil
+	}
+	return members[i-1], nil
+}
+
+// toSet names the members of a set canal read as a bitmask.
+func toSet(mysqlType string, value interface{}) (interface{}, error) {
+	members := typeMembers(mysqlType)
+	if text, ok := textOf(value); ok {
+		if text != "" {
+			for _, member := range strings.Split(text, ",") {
+				if !containsString(members, member) {
+					return nil, fmt.Errorf("%q is not a member of the set", member)
+				}
+			}
+		}
+		return text, nil
+	}
+	mask, err := toInteger(value)
+	if err != nil {
+		return nil, fmt.Errorf("not a set bitmask")
+	}
+	bits, ok := mask.(int64)
+	if !ok || bits < 0 || bits >= 1<<len(members) {
+		return nil, fmt.Errorf("set bitmask has bits past its %d members", len(members))
+	}
+	var names []string
+	for i, member := range members {
+		if bits&(1<<i) != 0 {
+			names = append(names, member)
+		}
+	}
+	return strings.Join(names, ","), nil
+}
+
+// typeMembers reads the quoted members of an enum or set type, e.g.
+// "enum('a','b')", in order; a doubled quote inside one is a quote.
+func typeMembers(mysqlType string) []string {
+	start, end := strings.IndexByte(mysqlType, '('), strings.LastIndexByte(mysqlType, ')')
+	if start < 0 || end < start {
+		return nil
+	}
+	var members []string
+	var member strings.Builder
+	quoted := false
+	args := mysqlType[start+1 : end]
+	for i := 0; i < len(args); i++ {
+		switch ch := args[i]; {
+		case !quoted && ch == '\'':
+			quoted = true
+			member.Reset()
+		case quoted && ch == '\'' && i+1 < len(args) && args[i+1] == '\'':
+			member.WriteByte('\'')
+			i++
+		case quoted && ch == '\'':
+			quoted = false
+			members = append(members, member.String())
+		case quoted:
+			member.WriteByte(ch)
+		}
+	}
+	return members
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func toJSON(value interface{}) (interface{}, error) {
+	text, ok := textOf(value)
+	if !ok {
+		return nil, fmt.Errorf("not JSON text")
+	}
+	if !json.Valid([]byte(text)) {
+		return nil, fmt.Errorf("invalid JSON")
+	}
+	return text, nil
+}
+
+// toTime renders dates as "2006-01-02" and datetimes and timestamps as
+// "2006-01-02 15:04:05.999999". A time.Time a driver read is taken by its
+// wall clock, the database session's; canal renders TIMESTAMP values in
+// the listener's zone. Zero dates pass to MySQL only.
+func (c *Converter) toTime(base string, value interface{}) (interface{}, error) {
+	layout := "2006-01-02 15:04:05"
+	if base == "date" {
+		layout = "2006-01-02"
+	}
+	if t, ok := value.(time.Time); ok {
+		if base == "date" {
+			return t.Format(layout), nil
+		}
+		return t.Format("2006-01-02 15:04:05.999999"), nil
+	}
+
+	text, ok := textOf(value)
+	if !ok {
+		return nil, fmt.Errorf("not a date")
+	}
+	if _, err := time.Parse(layout, text); err == nil {
+		return text, nil
+	}
+	if zeroDate(text) {
+		if c.dialect.Name() == DriverMySQL {
+			return text, nil
+		}
+		return nil, errZeroDate
+	}
+	return nil, fmt.Errorf("not a date in the form %s", layout)
+}
+
+var zeroDatePattern = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})`)
+
+// zeroDate reports whether a date has a zero year, month or day.
+func zeroDate(text string) bool {
+	parts := zeroDatePattern.FindStringSubmatch(text)
+	if parts == nil {
+		return false
+	}
+	return parts[1] == "0000" || parts[2] == "00" || parts[3] == "00"
+}
+
+var clockPattern = regexp.MustCompile(`^-?\d{1,3}:\d{2}:\d{2}(\.\d{1,6})?$`)
+
+// toClock checks a TIME value, which spans -838:59:59 to 838:59:59.
+func toClock(value interface{}) (interface{}, error) {
+	text, ok := textOf(value)
+	if !ok || !clockPattern.MatchString(text) {
+		return nil, fmt.Errorf("not a time of day")
+	}
+	return text, nil
+}
+
+// toSpatial checks a spatial value in MySQL's internal format, a 4-byte
+// little-endian SRID before the WKB. MySQL takes it as it is; other
+// targets get it as hex EWKB, the SRID moved into the WKB type as PostGIS
+// reads it.
+func (c *Converter) toSpatial(value interface{}) (interface{}, error) {
+	raw, err := toBytes(value)
+	if err != nil {
+		return nil, err
+	}
+	b := raw.([]byte)
+	if len(b) < 9 || b[4] > 1 {
+		return nil, fmt.Errorf("not a geometry in MySQL's internal format")
+	}
+	if c.dialect.Name() == DriverMySQL {
+		return b, nil
+	}
+
+	srid, wkb := binary.LittleEndian.Uint32(b[:4]), b[4:]
+	if srid == 0 {
+		return strings.ToUpper(hex.EncodeToString(wkb)), nil
+	}
+	var order binary.AppendByteOrder = binary.LittleEndian
+	var read binary.ByteOrder = binary.LittleEndian
+	if wkb[0] == 0 {
+		order, read = binary.BigEndian, binary.BigEndian
+	}
+	const ewkbSRID = 0x20000000
+	ewkb := make([]byte, 0, len(wkb)+4)
+	ewkb = append(ewkb, wkb[0])
+	ewkb = order.AppendUint32(ewkb, read.Uint32(wkb[1:5])|ewkbSRID)
+	ewkb = order.AppendUint32(ewkb, srid)
+	ewkb = append(ewkb, wkb[5:]...)
+	return strings.ToUpper(hex.EncodeToString(ewkb)), nil
+}
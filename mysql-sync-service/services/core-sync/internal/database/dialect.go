@@ -0,0 +1,117 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Database drivers for DatabaseConnection.Driver
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite3"
+)
+
+// Dialect hides the SQL differences between target databases.
+type Dialect interface {
+	Name() string
+	// QuoteIdentifier quotes a table or column name; "schema.table" is quoted per part.
+	QuoteIdentifier(name string) string
+	// Placeholder returns the bind parameter for the n-th argument, counting from 1.
+	Placeholder(n int) string
+	// MaxPlaceholders is the most bind parameters one statement may carry.
+	MaxPlaceholders() int
+	// NullSafeEqual compares column to placeholder, treating two NULLs as equal.
+	NullSafeEqual(column, placeholder string) string
+	// Upsert returns the text around the VALUES rows of an insert that
+	// overwrites rows already present under the same key. Columns and
+	// keyColumns are unquoted.
+	Upsert(table string, columns, keyColumns []string) (prefix, suffix string)
+	// ColumnType maps a MySQL column type, e.g. "tinyint(1)", to this dialect.
+	ColumnType(mysqlType string) string
+	// ConvertValue adapts a value read from a MySQL binlog column of
+	// mysqlType for binding against this dialect.
+	ConvertValue(mysqlType string, value interface{}) interface{}
+	// ForeignKeyChecksOff returns the statements that suspend foreign key
+	// checks for the rest of a transaction and restore them, either of
+	// which may be empty.
+	ForeignKeyChecksOff() (off, on string)
+}
+
+// NewDialect returns the dialect for a driver name; "" means MySQL.
+func NewDialect(driver string) (Dialect, error) {
+	switch strings.ToLower(driver) {
+	case "", DriverMySQL:
+		return mysqlDialect{}, nil
+	case DriverPostgres, "postgresql":
+		return postgresDialect{}, nil
+	case DriverSQLite, "sqlite":
+		return sqliteDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driver)
+	}
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string {
+	return DriverMySQL
+}
+
+func (mysqlDialect) QuoteIdentifier(name string) string {
+	return QuoteIdentifier(name)
+}
+
+func (mysqlDialect) Placeholder(int) string {
+	return "?"
+}
+
+func (mysqlDialect) MaxPlaceholders() int {
+	return 65535
+}
+
+func (mysqlDialect) NullSafeEqual(column, placeholder string) string {
+	return column + " <=> " + placeholder
+}
+
+func (d mysqlDialect) Upsert(table string, columns, keyColumns []string) (string, string) {
+	quotedColumns := make([]string, len(columns))
+	var updates []string
+	for i, column := range columns {
+		quotedColumns[i] = d.QuoteIdentifier(column)
+		if !containsFold(keyColumns, column) {
+			updates = append(updates, fmt.Sprintf("%s = VALUES(%s)", quotedColumns[i], quotedColumns[i]))
+		}
+	}
+
+	if len(updates) == 0 {
+		// Key-only rows: nothing to refresh, just don't fail on replay
+		return fmt.Sprintf("INSERT IGNORE INTO %s (%s) VALUES ", d.QuoteIdentifier(table), strings.Join(quotedColumns, ", ")), ""
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES ", d.QuoteIdentifier(table), strings.Join(quotedColumns, ", ")),
+		" ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+}
+
+// ColumnType is the identity: the source is MySQL too.
+func (mysqlDialect) ColumnType(mysqlType string) string {
+	return mysqlType
+}
+
+func (mysqlDialect) ConvertValue(_ string, value interface{}) interface{} {
+	return value
+}
+
+func (mysqlDialect) ForeignKeyChecksOff() (string, string) {
+	// A session variable, so it must be restored before the connection
+	// goes back to the pool
+	return "SET FOREIGN_KEY_CHECKS = 0", "SET FOREIGN_KEY_CHECKS = 1"
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,26 +3,85 @@ package database
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"net/url"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	"mysql-sync-service/internal/config"
 	"mysql-sync-service/internal/logger"
 	"go.uber.org/zap"
 )
 
 type Database struct {
-	DB     *sql.DB
-	Config config.DatabaseConnection
+	DB      *sql.DB
+	Config  config.DatabaseConnection
+	Dialect Dialect
+	// Converter converts row values for binding; lenient unless the sync
+	// configures it otherwise
+	Converter *Converter
+	// Stmts caches prepared statements for applying changes
+	Stmts *StmtCache
 }
 
 func NewDatabase(cfg config.DatabaseConnection) (*Database, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&multiStatements=true",
-		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Database)
-
-	db, err := sql.Open("mysql", dsn)
+	dialect, err := NewDialect(cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+	converter, err := NewConverter(dialect, false, cfg.Charset, cfg.Charset)
 	if err != nil {
+		return nil, err
+	}
+
+	var dsn string
+	tlsEnabled := TLSEnabled(cfg.TLS)
+	switch dialect.Name() {
+	case DriverPostgres:
+		dsn, err = postgresDSN(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure tls: %w", err)
+		}
+	case DriverSQLite:
+		dsn, err = sqliteDSN(cfg)
+		if err != nil {
+			return nil, err
+		}
+		tlsEnabled = false
+	default:
+		dsn = fmt.Sprintf("%s:%s@%s(%s:%d)/%s?parseTime=true&multiStatements=true",
+			cfg.User, cfg.Password, countedMySQLNetwork(), cfg.Host, cfg.Port, cfg.Database)
+		if cfg.Charset != "" {
+			dsn += "&charset=" + url.QueryEscape(cfg.Charset)
+		}
+		if cfg.Collation != "" {
+			dsn += "&collation=" + url.QueryEscape(cfg.Collation)
+		}
+
+		tlsParam, err := RegisterDriverTLS(fmt.Sprintf("db-%s-%d", cfg.Host, cfg.Port), cfg.TLS, cfg.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure tls: %w", err)
+		}
+		if tlsParam != "" {
+			dsn += "&tls=" + tlsParam
+		}
+		tlsEnabled = tlsParam != ""
+	}
+
+	var db *sql.DB
+	if dialect.Name() == DriverPostgres {
+		// Through a connector, so connections count their bytes as
+		// MySQL's do
+		connector, err := pq.NewConnector(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database connection: %w", err)
+		}
+		connector.Dialer(countingDialer{})
+		db = sql.OpenDB(connector)
+	} else if db, err = sql.Open(dialect.Name(), dsn); err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
 
@@ -34,25 +93,41 @@ func NewDatabase(cfg config.DatabaseConnection) (*Database, error) {
 	db.SetMaxOpenConns(20)
 	db.SetMaxIdleConns(10)
 	db.SetConnMaxLifetime(time.Hour)
+	if dialect.Name() == DriverSQLite {
+		// SQLite has a single writer; queue transactions instead of failing with SQLITE_BUSY
+		db.SetMaxOpenConns(1)
+	}
 
 	logger.Log.Info("Connected to database",
 		zap.String("host", cfg.Host),
 		zap.String("database", cfg.Database),
+		zap.String("driver", dialect.Name()),
+		zap.Bool("tls", tlsEnabled),
 	)
 
 	return &Database{
-		DB:     db,
-		Config: cfg,
+		DB:        db,
+		Config:    cfg,
+		Dialect:   dialect,
+		Converter: converter,
+		Stmts:     newStmtCache(db, defaultStmtCacheSize),
 	}, nil
 }
 
 func (d *Database) Close() error {
+	d.Stmts.Close()
 	return d.DB.Close()
 }
 
 // ExecTx executes a function within a transaction
 func (d *Database) ExecTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
-	tx, err := d.DB.BeginTx(ctx, nil)
+	return execTx(ctx, d.DB.BeginTx, fn)
+}
+
+// execTx runs fn in a transaction begun by begin, on the pool or on one
+// connection.
+func execTx(ctx context.Context, begin func(context.Context, *sql.TxOptions) (*sql.Tx, error), fn func(tx *sql.Tx) error) error {
+	tx, err := begin(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -66,3 +141,38 @@ func (d *Database) ExecTx(ctx context.Context, fn func(tx *sql.Tx) error) error
 
 	return tx.Commit()
 }
+
+// ExecTxForeignKeyChecksOff is ExecTx with foreign key checks off for the
+// transaction. Where turning them off lasts for the session, as on MySQL,
+// the transaction has a connection of its own, and the checks are turned
+// back on once it ends, however it ends; a connection they can't be turned
+// back on for is discarded rather than pooled with them off.
+func (d *Database) ExecTxForeignKeyChecksOff(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	off, on := d.Dialect.ForeignKeyChecksOff()
+	withChecksOff := func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, off); err != nil {
+			return fmt.Errorf("failed to turn off foreign key checks: %w", err)
+		}
+		return fn(tx)
+	}
+	if on == "" {
+		return d.ExecTx(ctx, withChecksOff)
+	}
+
+	conn, err := d.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = execTx(ctx, conn.BeginTx, withChecksOff)
+	// Not on ctx: a cancelled apply must still restore the checks
+	if _, onErr := conn.ExecContext(context.WithoutCancel(ctx), on); onErr != nil {
+		// Discarded, so no later transaction runs on it unchecked
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		if err == nil {
+			err = fmt.Errorf("failed to turn foreign key checks back on: %w", onErr)
+		}
+	}
+	return err
+}
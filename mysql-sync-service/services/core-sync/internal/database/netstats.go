@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"mysql-sync-service/internal/metrics"
+)
+
+// countedNetwork is the MySQL driver network whose connections count the
+// bytes they carry; DSNs use it in place of tcp.
+const countedNetwork = "dbsync-tcp"
+
+var registerCountedNetwork sync.Once
+
+// countedMySQLNetwork registers countedNetwork with the MySQL driver.
+func countedMySQLNetwork() string {
+	registerCountedNetwork.Do(func() {
+		mysql.RegisterDialContext(countedNetwork, func(ctx context.Context, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return dialCounted(ctx, &d, "tcp", addr)
+		})
+	})
+	return countedNetwork
+}
+
+// countingDialer is a lib/pq dialer whose connections count their bytes.
+type countingDialer struct {
+	net.Dialer
+}
+
+func (d countingDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+func (d countingDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, address)
+}
+
+func (d countingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return dialCounted(ctx, &d.Dialer, network, address)
+}
+
+func dialCounted(ctx context.Context, d *net.Dialer, network, address string) (net.Conn, error) {
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{
+		Conn:     conn,
+		sent:     metrics.DatabaseBytes.WithLabelValues(address, "sent"),
+		received: metrics.DatabaseBytes.WithLabelValues(address, "received"),
+	}, nil
+}
+
+// countingConn counts the bytes sent and received over a database
+// connection as they cross the wire, i.e. after TLS.
+type countingConn struct {
+	net.Conn
+	sent, received prometheus.Counter
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.received.Add(float64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.sent.Add(float64(n))
+	return n, err
+}
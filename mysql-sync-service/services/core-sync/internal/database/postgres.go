@@ -0,0 +1,208 @@
+package database
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"mysql-sync-service/internal/config"
+)
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string {
+	return DriverPostgres
+}
+
+func (postgresDialect) QuoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+func (postgresDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (postgresDialect) MaxPlaceholders() int {
+	return 65535
+}
+
+func (postgresDialect) NullSafeEqual(column, placeholder string) string {
+	return column + " IS NOT DISTINCT FROM " + placeholder
+}
+
+func (d postgresDialect) Upsert(table string, columns, keyColumns []string) (string, string) {
+	quotedColumns := make([]string, len(columns))
+	var quotedKeys, updates []string
+	for i, column := range columns {
+		quotedColumns[i] = d.QuoteIdentifier(column)
+		if containsFold(keyColumns, column) {
+			quotedKeys = append(quotedKeys, quotedColumns[i])
+		} else {
+			updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", quotedColumns[i], quotedColumns[i]))
+		}
+	}
+
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", d.QuoteIdentifier(table), strings.Join(quotedColumns, ", "))
+	if len(quotedKeys) == 0 || len(updates) == 0 {
+		// ON CONFLICT DO UPDATE needs the key columns and something to set
+		return prefix, " ON CONFLICT DO NOTHING"
+	}
+	return prefix, fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(quotedKeys, ", "), strings.Join(updates, ", "))
+}
+
+// ColumnType maps MySQL types to their closest Postgres equivalent. Unsigned
+// integers move up a size since Postgres has no unsigned types.
+func (postgresDialect) ColumnType(mysqlType string) string {
+	t := strings.ToLower(strings.TrimSpace(mysqlType))
+	unsigned := strings.Contains(t, "unsigned")
+	base := t
+	if i := strings.IndexAny(base, "( "); i >= 0 {
+		base = base[:i]
+	}
+
+	switch base {
+	case "tinyint":
+		if strings.HasPrefix(t, "tinyint(1)") {
+			return "boolean"
+		}
+		return "smallint"
+	case "smallint", "year":
+		if unsigned {
+			return "integer"
+		}
+		return "smallint"
+	case "mediumint":
+		return "integer"
+	case "int", "integer":
+		if unsigned {
+			return "bigint"
+		}
+		return "integer"
+	case "bigint":
+		if unsigned {
+			return "numeric(20)"
+		}
+		return "bigint"
+	case "float":
+		return "real"
+	case "double", "real":
+		return "double precision"
+	case "decimal", "numeric":
+		return "numeric" + typeArgs(t)
+	case "char", "varchar":
+		return base + typeArgs(t)
+	case "tinytext", "text", "mediumtext", "longtext", "enum", "set":
+		return "text"
+	case "json":
+		return "jsonb"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob", "bit":
+		return "bytea"
+	case "date":
+		return "date"
+	case "datetime", "timestamp":
+		return "timestamp"
+	case "time":
+		return "time"
+	default:
+		return "text"
+	}
+}
+
+// ConvertValue binds binlog values the way Postgres expects them: text as
+// strings (lib/pq sends []byte as bytea), tinyint(1) as booleans and MySQL
+// zero dates as NULL.
+func (d postgresDialect) ConvertValue(mysqlType string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	switch d.ColumnType(mysqlType) {
+	case "boolean":
+		switch v := value.(type) {
+		case int8:
+			return v != 0
+		case int16:
+			return v != 0
+		case int32:
+			return v != 0
+		case int64:
+			return v != 0
+		case int:
+			return v != 0
+		}
+	case "bytea":
+		if s, ok := value.(string); ok {
+			return []byte(s)
+		}
+		return value
+	case "date", "timestamp":
+		if s, ok := value.(string); ok && strings.HasPrefix(s, "0000-00-00") {
+			return nil
+		}
+	}
+
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return value
+}
+
+// typeArgs returns the "(p,s)" part of a column type, if any.
+func typeArgs(t string) string {
+	start := strings.Index(t, "(")
+	end := strings.Index(t, ")")
+	if start < 0 || end < start {
+		return ""
+	}
+	return t[start : end+1]
+}
+
+// ForeignKeyChecksOff defers the checks to commit instead, which works
+// for constraints declared DEFERRABLE only.
+func (postgresDialect) ForeignKeyChecksOff() (string, string) {
+	return "SET CONSTRAINTS ALL DEFERRED", ""
+}
+
+// postgresDSN builds a lib/pq connection URL. TLS modes map onto sslmode;
+// lib/pq has no plaintext fallback, so "preferred" behaves like "required".
+func postgresDSN(cfg config.DatabaseConnection) (string, error) {
+	query := url.Values{}
+
+	switch strings.ToLower(cfg.TLS.Mode) {
+	case "", TLSModeDisabled:
+		query.Set("sslmode", "disable")
+	case TLSModePreferred, TLSModeRequired:
+		query.Set("sslmode", "require")
+	case TLSModeVerifyCA:
+		query.Set("sslmode", "verify-ca")
+	case TLSModeVerifyIdentity:
+		query.Set("sslmode", "verify-full")
+	default:
+		return "", fmt.Errorf("unknown tls_mode %q", cfg.TLS.Mode)
+	}
+	if TLSEnabled(cfg.TLS) && cfg.TLS.SkipVerify {
+		query.Set("sslmode", "require")
+	}
+	if cfg.TLS.CACert != "" {
+		query.Set("sslrootcert", cfg.TLS.CACert)
+	}
+	if cfg.TLS.ClientCert != "" {
+		query.Set("sslcert", cfg.TLS.ClientCert)
+		query.Set("sslkey", cfg.TLS.ClientKey)
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Path:     "/" + cfg.Database,
+		RawQuery: query.Encode(),
+	}
+	return dsn.String(), nil
+}
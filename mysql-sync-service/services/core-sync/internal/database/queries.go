@@ -0,0 +1,13 @@
+package database
+
+import "strings"
+
+// QuoteIdentifier quotes a MySQL identifier (table or column) with backticks.
+// A schema-qualified name such as "db.table" is quoted per part.
+func QuoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = "`" + strings.ReplaceAll(part, "`", "``") + "`"
+	}
+	return strings.Join(parts, ".")
+}
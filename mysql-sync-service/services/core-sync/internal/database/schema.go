@@ -0,0 +1,436 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+
+	"mysql-sync-service/internal/config"
+)
+
+// TableSchema is a table's layout as the database reports it.
+type TableSchema struct {
+	Name        string
+	Columns     []string // In ordinal order
+	ColumnTypes []string // E.g. "tinyint(1)" on MySQL, "integer" on Postgres
+	PrimaryKey  []string
+	UniqueKeys  [][]string // Unique indexes other than the primary key
+	// Generated columns, which the database computes itself; read from
+	// MySQL only
+	Generated []string
+}
+
+// HasColumn reports whether the table has column, ignoring case.
+func (s *TableSchema) HasColumn(column string) bool {
+	for _, c := range s.Columns {
+		if strings.EqualFold(c, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// DescribeTable reads a table's columns and keys.
+func (d *Database) DescribeTable(ctx context.Context, table string) (*TableSchema, error) {
+	var (
+		schema *TableSchema
+		err    error
+	)
+	switch d.Dialect.Name() {
+	case DriverPostgres:
+		schema, err = d.describePostgres(ctx, table)
+	case DriverSQLite:
+		schema, err = d.describeSQLite(ctx, table)
+	default:
+		schema, err = d.describeMySQL(ctx, table)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(schema.Columns) == 0 {
+		return nil, fmt.Errorf("table %s not found", table)
+	}
+	return schema, nil
+}
+
+// IsUnknownColumn reports whether err is the database rejecting a column
+// that does not exist, i.e. a cached layout is out of date.
+func IsUnknownColumn(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1054
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "42703"
+	}
+	return err != nil && strings.Contains(err.Error(), "no such column")
+}
+
+// IsDuplicateKey reports whether err is the database refusing a row whose
+// primary or unique key another row already holds.
+func IsDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// splitTable splits a table name qualified as schema.table; an
+// unqualified one is in the connection's database.
+func (d *Database) splitTable(table string) (string, string) {
+	return config.SplitTable(table, d.Config.Database)
+}
+
+// qualifyTable names a table of schema as this connection's tables are
+// named: qualified only outside its database.
+func (d *Database) qualifyTable(schema, table string) string {
+	if schema == d.Config.Database {
+		return table
+	}
+	return schema + "." + table
+}
+
+func (d *Database) describeMySQL(ctx context.Context, table string) (*TableSchema, error) {
+	schema := &TableSchema{Name: table}
+	database, name := d.splitTable(table)
+	err := scanRows(ctx, d.DB,
+		`SELECT COLUMN_NAME, COLUMN_TYPE, EXTRA FROM information_schema.COLUMNS
+		 WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION`,
+		[]interface{}{database, name},
+		func(rows *sql.Rows) error {
+			var name, columnType, extra string
+			if err := rows.Scan(&name, &columnType, &extra); err != nil {
+				return err
+			}
+			schema.Columns = append(schema.Columns, name)
+			schema.ColumnTypes = append(schema.ColumnTypes, columnType)
+			// Not DEFAULT_GENERATED, which marks an expression default
+			extra = strings.ToUpper(extra)
+			if strings.Contains(extra, "VIRTUAL GENERATED") || strings.Contains(extra, "STORED GENERATED") {
+				schema.Generated = append(schema.Generated, name)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := newKeyCollector()
+	err = scanRows(ctx, d.DB,
+		`SELECT INDEX_NAME, COLUMN_NAME FROM information_schema.STATISTICS
+		 WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND NON_UNIQUE = 0 ORDER BY INDEX_NAME, SEQ_IN_INDEX`,
+		[]interface{}{database, name},
+		func(rows *sql.Rows) error {
+			var index, column string
+			if err := rows.Scan(&index, &column); err != nil {
+				return err
+			}
+			keys.add(index, index == "PRIMARY", column)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	schema.PrimaryKey, schema.UniqueKeys = keys.result()
+	return schema, nil
+}
+
+func (d *Database) describePostgres(ctx context.Context, table string) (*TableSchema, error) {
+	schema := &TableSchema{Name: table}
+	// An unqualified table is in the search path's first schema
+	namespace, name := config.SplitTable(table, "")
+	err := scanRows(ctx, d.DB,
+		`SELECT column_name, data_type FROM information_schema.columns
+		 WHERE table_schema = COALESCE(NULLIF($2, ''), current_schema()) AND table_name = $1 ORDER BY ordinal_position`,
+		[]interface{}{name, namespace},
+		func(rows *sql.Rows) error {
+			var name, columnType string
+			if err := rows.Scan(&name, &columnType); err != nil {
+				return err
+			}
+			schema.Columns = append(schema.Columns, name)
+			schema.ColumnTypes = append(schema.ColumnTypes, columnType)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := newKeyCollector()
+	err = scanRows(ctx, d.DB,
+		`SELECT ic.relname, i.indisprimary, a.attname
+		 FROM pg_index i
+		 JOIN pg_class c ON c.oid = i.indrelid
+		 JOIN pg_namespace n ON n.oid = c.relnamespace
+		 JOIN pg_class ic ON ic.oid = i.indexrelid
+		 JOIN LATERAL unnest(i.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+		 JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = k.attnum
+		 WHERE n.nspname = COALESCE(NULLIF($2, ''), current_schema()) AND c.relname = $1 AND i.indisunique
+		 ORDER BY ic.relname, k.ord`,
+		[]interface{}{name, namespace},
+		func(rows *sql.Rows) error {
+			var index, column string
+			var primary bool
+			if err := rows.Scan(&index, &primary, &column); err != nil {
+				return err
+			}
+			keys.add(index, primary, column)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	schema.PrimaryKey, schema.UniqueKeys = keys.result()
+	return schema, nil
+}
+
+func (d *Database) describeSQLite(ctx context.Context, table string) (*TableSchema, error) {
+	schema := &TableSchema{Name: table}
+	quoted := d.Dialect.QuoteIdentifier(table)
+
+	// pk is the column's position in the primary key, 0 if not part of it
+	pkPositions := make(map[int]string)
+	err := scanRows(ctx, d.DB, "PRAGMA table_info("+quoted+")", nil, func(rows *sql.Rows) error {
+		var (
+			cid, notNull, pk int
+			name, columnType string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		schema.Columns = append(schema.Columns, name)
+		schema.ColumnTypes = append(schema.ColumnTypes, columnType)
+		if pk > 0 {
+			pkPositions[pk] = name
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i <= len(pkPositions); i++ {
+		schema.PrimaryKey = append(schema.PrimaryKey, pkPositions[i])
+	}
+
+	var indexes []string
+	err = scanRows(ctx, d.DB, "PRAGMA index_list("+quoted+")", nil, func(rows *sql.Rows) error {
+		var (
+			seq, unique, partial int
+			name, origin         string
+		)
+		if err := rows.Scan(&seq, &name, &unique, &origin, &partial); err != nil {
+			return err
+		}
+		// Origin "pk" is the primary key's own index
+		if unique == 1 && origin != "pk" {
+			indexes = append(indexes, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, index := range indexes {
+		var key []string
+		err := scanRows(ctx, d.DB, "PRAGMA index_info("+d.Dialect.QuoteIdentifier(index)+")", nil, func(rows *sql.Rows) error {
+			var seqno, cid int
+			var name sql.NullString
+			if err := rows.Scan(&seqno, &cid, &name); err != nil {
+				return err
+			}
+			key = append(key, name.String)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		schema.UniqueKeys = append(schema.UniqueKeys, key)
+	}
+	return schema, nil
+}
+
+// ForeignKeys maps each table of the database that references another to
+// the tables it references; self-references are left out.
+func (d *Database) ForeignKeys(ctx context.Context) (map[string][]string, error) {
+	parents := make(map[string][]string)
+	add := func(rows *sql.Rows) error {
+		var table, parent string
+		if err := rows.Scan(&table, &parent); err != nil {
+			return err
+		}
+		if table != parent {
+			parents[table] = append(parents[table], parent)
+		}
+		return nil
+	}
+
+	var err error
+	switch d.Dialect.Name() {
+	case DriverPostgres:
+		err = scanRows(ctx, d.DB,
+			`SELECT DISTINCT c.relname, p.relname
+			 FROM pg_constraint k
+			 JOIN pg_class c ON c.oid = k.conrelid
+			 JOIN pg_class p ON p.oid = k.confrelid
+			 JOIN pg_namespace n ON n.oid = c.relnamespace
+			 WHERE k.contype = 'f' AND n.nspname = current_schema()`,
+			nil, add)
+	case DriverSQLite:
+		var tables []string
+		err = scanRows(ctx, d.DB, "SELECT name FROM sqlite_master WHERE type = 'table'", nil, func(rows *sql.Rows) error {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			tables = append(tables, name)
+			return nil
+		})
+		for i := 0; err == nil && i < len(tables); i++ {
+			err = scanRows(ctx, d.DB, "SELECT DISTINCT ?, \"table\" FROM pragma_foreign_key_list(?)", []interface{}{tables[i], tables[i]}, add)
+		}
+	default:
+		// Tables outside the connection's database are named schema.table
+		err = scanRows(ctx, d.DB,
+			`SELECT DISTINCT TABLE_SCHEMA, TABLE_NAME, REFERENCED_TABLE_SCHEMA, REFERENCED_TABLE_NAME
+			 FROM information_schema.KEY_COLUMN_USAGE
+			 WHERE REFERENCED_TABLE_NAME IS NOT NULL
+			 AND TABLE_SCHEMA NOT IN ('mysql', 'sys', 'information_schema', 'performance_schema')`,
+			nil, func(rows *sql.Rows) error {
+				var schema, table, parentSchema, parent string
+				if err := rows.Scan(&schema, &table, &parentSchema, &parent); err != nil {
+					return err
+				}
+				if table, parent = d.qualifyTable(schema, table), d.qualifyTable(parentSchema, parent); table != parent {
+					parents[table] = append(parents[table], parent)
+				}
+				return nil
+			})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read foreign keys: %w", err)
+	}
+	return parents, nil
+}
+
+// ListTables lists the base tables of a MySQL schema, in name order.
+func (d *Database) ListTables(ctx context.Context, schema string) ([]string, error) {
+	var tables []string
+	err := scanRows(ctx, d.DB,
+		`SELECT TABLE_NAME FROM information_schema.TABLES
+		 WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME`,
+		[]interface{}{schema},
+		func(rows *sql.Rows) error {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			tables = append(tables, name)
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables of %s: %w", schema, err)
+	}
+	return tables, nil
+}
+
+// EstimatedRows is the table's row count from its statistics, which is
+// cheap to read but approximate; 0 if the database keeps none.
+func (d *Database) EstimatedRows(ctx context.Context, table string) (int64, error) {
+	var rows sql.NullFloat64
+	var err error
+	switch d.Dialect.Name() {
+	case DriverPostgres:
+		namespace, name := config.SplitTable(table, "")
+		err = d.DB.QueryRowContext(ctx,
+			`SELECT c.reltuples FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+			 WHERE c.relname = $1 AND n.nspname = COALESCE(NULLIF($2, ''), current_schema())`, name, namespace).Scan(&rows)
+	case DriverSQLite:
+		return 0, nil
+	default:
+		database, name := d.splitTable(table)
+		err = d.DB.QueryRowContext(ctx,
+			"SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?",
+			database, name).Scan(&rows)
+	}
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read table statistics: %w", err)
+	}
+	if rows.Float64 < 0 {
+		// Never analyzed
+		return 0, nil
+	}
+	return int64(rows.Float64), nil
+}
+
+// MaxAllowedPacket is the largest statement the server accepts, in bytes;
+// 0 for databases without such a limit.
+func (d *Database) MaxAllowedPacket(ctx context.Context) (int64, error) {
+	if d.Dialect.Name() != DriverMySQL {
+		return 0, nil
+	}
+	var size int64
+	if err := d.DB.QueryRowContext(ctx, "SELECT @@max_allowed_packet").Scan(&size); err != nil {
+		return 0, fmt.Errorf("failed to read max_allowed_packet: %w", err)
+	}
+	return size, nil
+}
+
+func scanRows(ctx context.Context, db *sql.DB, query string, args []interface{}, scan func(*sql.Rows) error) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// keyCollector groups index columns, read in index order, into keys.
+type keyCollector struct {
+	primary []string
+	unique  [][]string
+	index   map[string]int
+}
+
+func newKeyCollector() *keyCollector {
+	return &keyCollector{index: make(map[string]int)}
+}
+
+func (k *keyCollector) add(index string, primary bool, column string) {
+	if primary {
+		k.primary = append(k.primary, column)
+		return
+	}
+	i, ok := k.index[index]
+	if !ok {
+		i = len(k.unique)
+		k.index[index] = i
+		k.unique = append(k.unique, nil)
+	}
+	k.unique[i] = append(k.unique[i], column)
+}
+
+func (k *keyCollector) result() ([]string, [][]string) {
+	return k.primary, k.unique
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"mysql-sync-service/internal/config"
+)
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string {
+	return DriverSQLite
+}
+
+func (sqliteDialect) QuoteIdentifier(name string) string {
+	return postgresDialect{}.QuoteIdentifier(name)
+}
+
+func (sqliteDialect) Placeholder(int) string {
+	return "?"
+}
+
+// MaxPlaceholders is SQLITE_MAX_VARIABLE_NUMBER for SQLite 3.32 and later.
+func (sqliteDialect) MaxPlaceholders() int {
+	return 32766
+}
+
+func (sqliteDialect) NullSafeEqual(column, placeholder string) string {
+	return column + " IS " + placeholder
+}
+
+func (d sqliteDialect) Upsert(table string, columns, keyColumns []string) (string, string) {
+	quotedColumns := make([]string, len(columns))
+	var quotedKeys, updates []string
+	for i, column := range columns {
+		quotedColumns[i] = d.QuoteIdentifier(column)
+		if containsFold(keyColumns, column) {
+			quotedKeys = append(quotedKeys, quotedColumns[i])
+		} else {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", quotedColumns[i], quotedColumns[i]))
+		}
+	}
+
+	if len(quotedKeys) == 0 || len(updates) == 0 {
+		return fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES ", d.QuoteIdentifier(table), strings.Join(quotedColumns, ", ")), ""
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES ", d.QuoteIdentifier(table), strings.Join(quotedColumns, ", ")),
+		fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(quotedKeys, ", "), strings.Join(updates, ", "))
+}
+
+// ColumnType maps MySQL types onto SQLite's storage classes. Booleans are
+// kept as 0/1 integers and temporal types as text, as SQLite has neither.
+func (sqliteDialect) ColumnType(mysqlType string) string {
+	t := strings.ToLower(strings.TrimSpace(mysqlType))
+	base := t
+	if i := strings.IndexAny(base, "( "); i >= 0 {
+		base = base[:i]
+	}
+
+	switch base {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "year", "bit":
+		return "INTEGER"
+	case "float", "double", "real":
+		return "REAL"
+	case "decimal", "numeric":
+		return "NUMERIC"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return "BLOB"
+	default:
+		return "TEXT"
+	}
+}
+
+// ConvertValue binds text as strings: the driver stores []byte as a BLOB,
+// which never compares equal to TEXT.
+func (d sqliteDialect) ConvertValue(mysqlType string, value interface{}) interface{} {
+	if b, ok := value.([]byte); ok && d.ColumnType(mysqlType) != "BLOB" {
+		return string(b)
+	}
+	return value
+}
+
+// ForeignKeyChecksOff defers the checks to commit; SQLite resets the
+// pragma when the transaction ends.
+func (sqliteDialect) ForeignKeyChecksOff() (string, string) {
+	return "PRAGMA defer_foreign_keys = ON", ""
+}
+
+// sqliteDSN opens the file in WAL mode so offline readers are not blocked
+// while the worker pool writes.
+func sqliteDSN(cfg config.DatabaseConnection) (string, error) {
+	if cfg.FilePath == "" {
+		return "", fmt.Errorf("file_path is required for sqlite")
+	}
+
+	query := url.Values{}
+	query.Set("_journal_mode", "WAL")
+	query.Set("_busy_timeout", "5000")
+	return "file:" + cfg.FilePath + "?" + query.Encode(), nil
+}
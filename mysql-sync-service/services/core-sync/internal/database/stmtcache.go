@@ -0,0 +1,178 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/logger"
+)
+
+const (
+	defaultStmtCacheSize = 256
+	stmtPrepareTimeout   = 30 * time.Second
+)
+
+// StmtKey names a prepared statement: the query built for one table,
+// operation and column set.
+type StmtKey struct {
+	Table     string
+	Operation string
+	Query     string
+}
+
+// StmtCache keeps prepared statements for queries run batch after batch,
+// least recently used evicted first. database/sql prepares a statement on
+// each pooled connection the first time it's used there and keeps it for
+// the connection's lifetime, so a cached query is parsed once per
+// connection rather than on every execution.
+//
+// A query that isn't cached yet runs unprepared while it is prepared in the
+// background: preparing it in line would take a second connection from the
+// pool while the transaction holds one. A nil cache runs every query
+// unprepared.
+type StmtCache struct {
+	db      *sql.DB
+	max     int
+	mu      sync.Mutex
+	stmts   map[StmtKey]*list.Element
+	order   *list.List // Of *cachedStmt, most recently used first
+	pending map[StmtKey]bool
+	gen     int // Bumped by evictions, so statements prepared before one are dropped
+	closed  bool
+}
+
+type cachedStmt struct {
+	key     StmtKey
+	stmt    *sql.Stmt
+	users   int  // Execs running it; it is closed once none are
+	removed bool // Evicted, to be closed by its last user
+}
+
+func newStmtCache(db *sql.DB, max int) *StmtCache {
+	return &StmtCache{
+		db:      db,
+		max:     max,
+		stmts:   make(map[StmtKey]*list.Element),
+		order:   list.New(),
+		pending: make(map[StmtKey]bool),
+	}
+}
+
+// Exec runs key's query with args in tx, as a prepared statement once it
+// is cached.
+func (c *StmtCache) Exec(ctx context.Context, tx *sql.Tx, key StmtKey, args ...interface{}) (sql.Result, error) {
+	if cached := c.get(key); cached != nil {
+		defer c.release(cached)
+		return tx.StmtContext(ctx, cached.stmt).ExecContext(ctx, args...)
+	}
+	return tx.ExecContext(ctx, key.Query, args...)
+}
+
+// get returns key's statement, held until released so it isn't closed
+// under the caller, or nil after starting to prepare it.
+func (c *StmtCache) get(key StmtKey) *cachedStmt {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.stmts[key]; ok {
+		c.order.MoveToFront(element)
+		cached := element.Value.(*cachedStmt)
+		cached.users++
+		return cached
+	}
+	if !c.closed && !c.pending[key] {
+		c.pending[key] = true
+		go c.prepare(key, c.gen)
+	}
+	return nil
+}
+
+func (c *StmtCache) prepare(key StmtKey, gen int) {
+	ctx, cancel := context.WithTimeout(context.Background(), stmtPrepareTimeout)
+	defer cancel()
+	stmt, err := c.db.PrepareContext(ctx, key.Query)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, key)
+	if err != nil {
+		logger.Log.Debug("Failed to prepare statement", zap.String("table", key.Table), zap.String("operation", key.Operation), zap.Error(err))
+		return
+	}
+	if c.closed || gen != c.gen {
+		stmt.Close()
+		return
+	}
+	c.stmts[key] = c.order.PushFront(&cachedStmt{key: key, stmt: stmt})
+	for c.order.Len() > c.max {
+		c.remove(c.order.Back())
+	}
+}
+
+// release lets cached go once an Exec is done with it.
+func (c *StmtCache) release(cached *cachedStmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached.users--
+	if cached.removed && cached.users == 0 {
+		cached.stmt.Close()
+	}
+}
+
+// remove forgets element's statement and closes it once no Exec is
+// running it; c.mu must be held.
+func (c *StmtCache) remove(element *list.Element) {
+	cached := c.order.Remove(element).(*cachedStmt)
+	delete(c.stmts, cached.key)
+	cached.removed = true
+	if cached.users == 0 {
+		cached.stmt.Close()
+	}
+}
+
+// Evict drops the statements for table, e.g. once its schema changed.
+func (c *StmtCache) Evict(table string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for key, element := range c.stmts {
+		if strings.EqualFold(key.Table, table) {
+			c.remove(element)
+		}
+	}
+}
+
+// Reset drops every statement.
+func (c *StmtCache) Reset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+}
+
+// Close drops every statement and stops caching new ones.
+func (c *StmtCache) Close() {
+	if c == nil {
+		return
+	}
+	c.Reset()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+
+	"mysql-sync-service/internal/config"
+)
+
+const (
+	TLSModeDisabled       = "disabled"
+	TLSModePreferred      = "preferred"
+	TLSModeRequired       = "required"
+	TLSModeVerifyCA       = "verify_ca"
+	TLSModeVerifyIdentity = "verify_identity"
+)
+
+// TLSEnabled reports whether the connection should be encrypted at all.
+func TLSEnabled(cfg config.TLSConfig) bool {
+	mode := strings.ToLower(cfg.Mode)
+	return mode != "" && mode != TLSModeDisabled
+}
+
+// BuildTLSConfig turns the YAML TLS settings into a *tls.Config.
+// It returns nil when TLS is disabled.
+func BuildTLSConfig(cfg config.TLSConfig, serverName string) (*tls.Config, error) {
+	if !TLSEnabled(cfg) {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if cfg.CACert != "" {
+		caPEM, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca cert %s: %w", cfg.CACert, err)
+		}
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no valid certificates found in %s", cfg.CACert)
+		}
+		tlsConfig.RootCAs = certPool
+	}
+
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		clientCert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client cert/key: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+
+	switch strings.ToLower(cfg.Mode) {
+	case TLSModePreferred, TLSModeRequired:
+		// Encrypt only, like the MySQL client: the certificate is not checked
+		tlsConfig.InsecureSkipVerify = true
+	case TLSModeVerifyCA:
+		// Verify the chain against the CA but not the hostname
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = verifyChainOnly(tlsConfig.RootCAs)
+	case TLSModeVerifyIdentity:
+		// Default crypto/tls behaviour: chain and hostname
+	default:
+		return nil, fmt.Errorf("unknown tls_mode %q", cfg.Mode)
+	}
+
+	if cfg.SkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = nil
+	}
+
+	return tlsConfig, nil
+}
+
+// RegisterDriverTLS registers the TLS settings with the MySQL driver under name
+// and returns the value to use for the DSN "tls" parameter ("" when disabled).
+func RegisterDriverTLS(name string, cfg config.TLSConfig, serverName string) (string, error) {
+	tlsConfig, err := BuildTLSConfig(cfg, serverName)
+	if err != nil || tlsConfig == nil {
+		return "", err
+	}
+
+	if err := mysql.RegisterTLSConfig(name, tlsConfig); err != nil {
+		return "", fmt.Errorf("failed to register tls config %s: %w", name, err)
+	}
+
+	// "preferred" keeps the driver's plaintext fallback when the server has no TLS
+	if strings.ToLower(cfg.Mode) == TLSModePreferred && cfg.CACert == "" && cfg.ClientCert == "" {
+		return TLSModePreferred, nil
+	}
+
+	return name, nil
+}
+
+func verifyChainOnly(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("server presented no certificate")
+		}
+
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("failed to parse server certificate: %w", err)
+			}
+			certs = append(certs, cert)
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		return err
+	}
+}
@@ -0,0 +1,36 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"mysql-sync-service/internal/config"
+)
+
+// Hasher pseudonymizes values with a keyed HMAC, so equal values still
+// join and compare on the target without being reversible by anyone
+// lacking the key.
+type Hasher struct {
+	key []byte
+}
+
+// NewHasher loads the hash key, or returns nil if none is configured.
+func NewHasher(cfg config.EncryptionConfig) (*Hasher, error) {
+	if !configured(cfg.HashKey) {
+		return nil, nil
+	}
+	key, err := loadKey(cfg.HashKey)
+	if err != nil {
+		return nil, fmt.Errorf("hash key: %w", err)
+	}
+	return &Hasher{key: key}, nil
+}
+
+// Hash returns the hex HMAC-SHA256 of value.
+func (h *Hasher) Hash(value []byte) string {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write(value)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,137 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mysql-sync-service/internal/config"
+)
+
+// Encrypted values are stored as "enc:v<version>:<base64(nonce|ciphertext)>"
+// so any row can be decrypted with the key that wrote it, and rotation can
+// tell which rows still carry an old key.
+const valuePrefix = "enc:v"
+
+var ErrNotEncrypted = errors.New("value is not encrypted")
+
+// Keyring holds every configured key version; new values are always
+// encrypted with the active one.
+type Keyring struct {
+	aeads  map[int]cipher.AEAD
+	active int
+}
+
+func NewKeyring(cfg config.EncryptionConfig) (*Keyring, error) {
+	if len(cfg.Keys) == 0 {
+		return nil, nil
+	}
+
+	k := &Keyring{aeads: make(map[int]cipher.AEAD)}
+	for _, keyConfig := range cfg.Keys {
+		keyBytes, err := loadKey(keyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key version %d: %w", keyConfig.Version, err)
+		}
+
+		block, err := aes.NewCipher(keyBytes)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[keyConfig.Version] = aead
+		if keyConfig.Version > k.active {
+			k.active = keyConfig.Version
+		}
+	}
+
+	if cfg.ActiveVersion != 0 {
+		if _, ok := k.aeads[cfg.ActiveVersion]; !ok {
+			return nil, fmt.Errorf("active encryption key version %d is not configured", cfg.ActiveVersion)
+		}
+		k.active = cfg.ActiveVersion
+	}
+
+	return k, nil
+}
+
+// ActiveVersion is the key version used for new ciphertext.
+func (k *Keyring) ActiveVersion() int {
+	return k.active
+}
+
+// Encrypt seals plaintext with the active key.
+func (k *Keyring) Encrypt(plaintext []byte) (string, error) {
+	return k.encryptWith(k.active, plaintext)
+}
+
+func (k *Keyring) encryptWith(version int, plaintext []byte) (string, error) {
+	aead, ok := k.aeads[version]
+	if !ok {
+		return "", fmt.Errorf("unknown encryption key version %d", version)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+	return valuePrefix + strconv.Itoa(version) + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt with whichever key wrote it.
+func (k *Keyring) Decrypt(value string) ([]byte, error) {
+	version, payload, err := parseValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, ok := k.aeads[version]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key version %d", version)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("malformed ciphertext: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// KeyVersion reports which key encrypted value.
+func KeyVersion(value string) (int, error) {
+	version, _, err := parseValue(value)
+	return version, err
+}
+
+func parseValue(value string) (int, string, error) {
+	if !strings.HasPrefix(value, valuePrefix) {
+		return 0, "", ErrNotEncrypted
+	}
+
+	rest := value[len(valuePrefix):]
+	sep := strings.IndexByte(rest, ':')
+	if sep <= 0 {
+		return 0, "", fmt.Errorf("malformed encrypted value")
+	}
+
+	version, err := strconv.Atoi(rest[:sep])
+	if err != nil {
+		return 0, "", fmt.Errorf("malformed key version: %w", err)
+	}
+	return version, rest[sep+1:], nil
+}
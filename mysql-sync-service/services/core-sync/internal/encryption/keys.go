@@ -0,0 +1,95 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"mysql-sync-service/internal/config"
+)
+
+// keyFetchTimeout bounds a key command or provider call at startup.
+const keyFetchTimeout = 30 * time.Second
+
+// KeyProvider fetches key material from a key management service. A build
+// that links one in registers it from an init func, and keys select it
+// with provider and key_id.
+type KeyProvider interface {
+	// Key returns the raw key bytes for keyID
+	Key(ctx context.Context, keyID string) ([]byte, error)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]KeyProvider)
+)
+
+// RegisterKeyProvider makes a key provider available by name. It panics
+// if the name is taken, as registration happens at init.
+func RegisterKeyProvider(name string, provider KeyProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if _, ok := providers[name]; ok {
+		panic("encryption: key provider " + name + " registered twice")
+	}
+	providers[name] = provider
+}
+
+func configured(k config.EncryptionKey) bool {
+	return k.Key != "" || k.KeyEnv != "" || len(k.KeyCommand) > 0 || k.Provider != ""
+}
+
+// loadKey resolves a key's material from, in order of precedence, its
+// provider, command, environment variable or inline value, and checks it
+// is 32 bytes.
+func loadKey(k config.EncryptionKey) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyFetchTimeout)
+	defer cancel()
+
+	var keyBytes []byte
+	switch {
+	case k.Provider != "":
+		providersMu.RLock()
+		provider, ok := providers[k.Provider]
+		providersMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown key provider %q", k.Provider)
+		}
+		var err error
+		if keyBytes, err = provider.Key(ctx, k.KeyID); err != nil {
+			return nil, fmt.Errorf("key provider %s: %w", k.Provider, err)
+		}
+	default:
+		raw := k.Key
+		if len(k.KeyCommand) > 0 {
+			var stdout, stderr bytes.Buffer
+			cmd := exec.CommandContext(ctx, k.KeyCommand[0], k.KeyCommand[1:]...)
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err != nil {
+				return nil, fmt.Errorf("key command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+			}
+			raw = strings.TrimSpace(stdout.String())
+		} else if k.KeyEnv != "" {
+			raw = os.Getenv(k.KeyEnv)
+		}
+		if raw == "" {
+			return nil, fmt.Errorf("no key material")
+		}
+		var err error
+		if keyBytes, err = base64.StdEncoding.DecodeString(raw); err != nil {
+			return nil, fmt.Errorf("not valid base64: %w", err)
+		}
+	}
+
+	if len(keyBytes) != 32 {
+		return nil, fmt.Errorf("must be 32 bytes, got %d", len(keyBytes))
+	}
+	return keyBytes, nil
+}
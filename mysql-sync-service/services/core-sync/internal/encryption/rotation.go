@@ -0,0 +1,360 @@
+package encryption
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/database"
+	"mysql-sync-service/internal/ids"
+	"mysql-sync-service/internal/logger"
+)
+
+const (
+	RotationRunning   = "running"
+	RotationCompleted = "completed"
+	RotationFailed    = "failed"
+	RotationCancelled = "cancelled"
+)
+
+var (
+	ErrNotConfigured   = errors.New("encryption is not configured")
+	ErrRotationRunning = errors.New("rotation already running for table")
+)
+
+// RotationJob tracks re-encryption of one table's columns with the active key.
+type RotationJob struct {
+	ID            string     `json:"id"`
+	Table         string     `json:"table"`
+	Columns       []string   `json:"columns"`
+	TargetVersion int        `json:"target_version"`
+	Status        string     `json:"status"`
+	RowsScanned   int64      `json:"rows_scanned"`
+	RowsRotated   int64      `json:"rows_rotated"`
+	RowsSkipped   int64      `json:"rows_skipped"` // changed concurrently by CDC
+	LastKey       string     `json:"last_key,omitempty"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	Error         string     `json:"error,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+// RotationTarget describes the table to rotate on the target database.
+type RotationTarget struct {
+	Table      string
+	PrimaryKey string
+	Columns    []string
+}
+
+// Rotator re-encrypts target data in primary-key ordered chunks.
+//
+// It cooperates with CDC without locking the table: every row update is a
+// compare-and-set on the ciphertext it read, so a row rewritten by the
+// worker in the meantime (already under the active key) is left alone.
+type Rotator struct {
+	keyring   *Keyring
+	db        *database.Database
+	chunkSize int
+
+	mu   sync.RWMutex
+	jobs map[string]*RotationJob
+}
+
+func NewRotator(keyring *Keyring, db *database.Database, chunkSize int) *Rotator {
+	if chunkSize <= 0 {
+		chunkSize = 500
+	}
+	return &Rotator{
+		keyring:   keyring,
+		db:        db,
+		chunkSize: chunkSize,
+		jobs:      make(map[string]*RotationJob),
+	}
+}
+
+// Start launches a rotation job in the background and returns it immediately.
+func (r *Rotator) Start(target RotationTarget) (*RotationJob, error) {
+	if r == nil || r.keyring == nil {
+		return nil, ErrNotConfigured
+	}
+	if target.PrimaryKey == "" || len(target.Columns) == 0 {
+		return nil, fmt.Errorf("%w: table %s has no primary key or encrypted columns", ErrNotConfigured, target.Table)
+	}
+
+	r.mu.Lock()
+	for _, job := range r.jobs {
+		if job.Table == target.Table && job.Status == RotationRunning {
+			r.mu.Unlock()
+			return nil, fmt.Errorf("%w %s (job %s)", ErrRotationRunning, target.Table, job.ID)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &RotationJob{
+		ID:            ids.New(),
+		Table:         target.Table,
+		Columns:       target.Columns,
+		TargetVersion: r.keyring.ActiveVersion(),
+		Status:        RotationRunning,
+		StartedAt:     time.Now(),
+		cancel:        cancel,
+	}
+	r.jobs[job.ID] = job
+	r.mu.Unlock()
+
+	go r.run(ctx, job, target)
+
+	snapshot := r.snapshot(job)
+	return &snapshot, nil
+}
+
+// Get returns a copy of the job's current progress.
+func (r *Rotator) Get(id string) (*RotationJob, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	job, ok := r.jobs[id]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	snapshot := r.snapshot(job)
+	return &snapshot, true
+}
+
+// List returns all known jobs.
+func (r *Rotator) List() []RotationJob {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	ids := make([]*RotationJob, 0, len(r.jobs))
+	for _, job := range r.jobs {
+		ids = append(ids, job)
+	}
+	r.mu.RUnlock()
+
+	jobs := make([]RotationJob, 0, len(ids))
+	for _, job := range ids {
+		jobs = append(jobs, r.snapshot(job))
+	}
+	return jobs
+}
+
+// Cancel stops a running job after its current chunk.
+func (r *Rotator) Cancel(id string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.RLock()
+	job, ok := r.jobs[id]
+	r.mu.RUnlock()
+	if ok {
+		job.cancel()
+	}
+	return ok
+}
+
+func (r *Rotator) snapshot(job *RotationJob) RotationJob {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	copied := *job
+	copied.Columns = append([]string(nil), job.Columns...)
+	copied.cancel = nil
+	return copied
+}
+
+func (r *Rotator) run(ctx context.Context, job *RotationJob, target RotationTarget) {
+	logger.Log.Info("Starting key rotation",
+		zap.String("job_id", job.ID),
+		zap.String("table", target.Table),
+		zap.Int("target_version", job.TargetVersion),
+	)
+
+	var lastKey interface{}
+	var err error
+	for {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			break
+		}
+
+		var done bool
+		lastKey, done, err = r.rotateChunk(ctx, job, target, lastKey)
+		if err != nil || done {
+			break
+		}
+	}
+
+	finishedAt := time.Now()
+	r.mu.Lock()
+	job.FinishedAt = &finishedAt
+	switch {
+	case errors.Is(err, context.Canceled):
+		job.Status = RotationCancelled
+	case err != nil:
+		job.Status = RotationFailed
+		job.Error = err.Error()
+	default:
+		job.Status = RotationCompleted
+	}
+	r.mu.Unlock()
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.Log.Error("Key rotation failed", zap.String("job_id", job.ID), zap.String("table", target.Table), zap.Error(err))
+		return
+	}
+	logger.Log.Info("Key rotation finished",
+		zap.String("job_id", job.ID),
+		zap.String("table", target.Table),
+		zap.String("status", job.Status),
+		zap.Int64("rows_rotated", job.RowsRotated),
+	)
+}
+
+// rotateChunk re-encrypts up to chunkSize rows after lastKey in one transaction.
+func (r *Rotator) rotateChunk(ctx context.Context, job *RotationJob, target RotationTarget, lastKey interface{}) (interface{}, bool, error) {
+	dialect := r.db.Dialect
+	table := dialect.QuoteIdentifier(target.Table)
+	pk := dialect.QuoteIdentifier(target.PrimaryKey)
+
+	quotedColumns := make([]string, len(target.Columns))
+	for i, column := range target.Columns {
+		quotedColumns[i] = dialect.QuoteIdentifier(column)
+	}
+
+	query := fmt.Sprintf("SELECT %s, %s FROM %s", pk, strings.Join(quotedColumns, ", "), table)
+	args := []interface{}{}
+	if lastKey != nil {
+		query += fmt.Sprintf(" WHERE %s > %s", pk, dialect.Placeholder(1))
+		args = append(args, lastKey)
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT %d", pk, r.chunkSize)
+
+	var scanned, rotated, skipped int64
+	var nextKey interface{}
+
+	err := r.db.ExecTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to read chunk: %w", err)
+		}
+
+		type pendingRow struct {
+			key    interface{}
+			values []sql.NullString
+		}
+		var pending []pendingRow
+		for rows.Next() {
+			var key interface{}
+			values := make([]sql.NullString, len(target.Columns))
+			dest := []interface{}{&key}
+			for i := range values {
+				dest = append(dest, &values[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return err
+			}
+			pending = append(pending, pendingRow{key: key, values: values})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, row := range pending {
+			scanned++
+			nextKey = row.key
+
+			newValues, changed, err := r.reencrypt(row.values, job.TargetVersion)
+			if err != nil {
+				return fmt.Errorf("row %v: %w", row.key, err)
+			}
+			if !changed {
+				continue
+			}
+
+			setClauses := make([]string, len(quotedColumns))
+			updateArgs := make([]interface{}, 0, len(quotedColumns)*2+1)
+			for i, column := range quotedColumns {
+				updateArgs = append(updateArgs, newValues[i])
+				setClauses[i] = column + " = " + dialect.Placeholder(len(updateArgs))
+			}
+			updateArgs = append(updateArgs, row.key)
+			whereClauses := []string{pk + " = " + dialect.Placeholder(len(updateArgs))}
+			for i, column := range quotedColumns {
+				// Compare-and-set: skip rows CDC rewrote since we read them
+				updateArgs = append(updateArgs, row.values[i])
+				whereClauses = append(whereClauses, dialect.NullSafeEqual(column, dialect.Placeholder(len(updateArgs))))
+			}
+
+			update := fmt.Sprintf("UPDATE %s SET %s WHERE %s", table, strings.Join(setClauses, ", "), strings.Join(whereClauses, " AND "))
+			result, err := tx.ExecContext(ctx, update, updateArgs...)
+			if err != nil {
+				return fmt.Errorf("failed to update row %v: %w", row.key, err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				skipped++
+			} else {
+				rotated++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return lastKey, false, err
+	}
+
+	r.mu.Lock()
+	job.RowsScanned += scanned
+	job.RowsRotated += rotated
+	job.RowsSkipped += skipped
+	if nextKey != nil {
+		job.LastKey = fmt.Sprintf("%s", nextKey)
+	}
+	r.mu.Unlock()
+
+	return nextKey, scanned < int64(r.chunkSize), nil
+}
+
+// reencrypt returns the values sealed with targetVersion and whether any changed.
+func (r *Rotator) reencrypt(values []sql.NullString, targetVersion int) ([]interface{}, bool, error) {
+	result := make([]interface{}, len(values))
+	changed := false
+	for i, value := range values {
+		if !value.Valid {
+			result[i] = nil
+			continue
+		}
+		result[i] = value.String
+
+		version, err := KeyVersion(value.String)
+		if errors.Is(err, ErrNotEncrypted) || version == targetVersion {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		plaintext, err := r.keyring.Decrypt(value.String)
+		if err != nil {
+			return nil, false, err
+		}
+		sealed, err := r.keyring.encryptWith(targetVersion, plaintext)
+		if err != nil {
+			return nil, false, err
+		}
+		result[i] = sealed
+		changed = true
+	}
+	return result, changed, nil
+}
@@ -0,0 +1,184 @@
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"mysql-sync-service/internal/config"
+)
+
+// ID formats for StateStorage.IDs.Format
+const (
+	FormatUUID      = "uuid"
+	FormatULID      = "ulid"
+	FormatSnowflake = "snowflake"
+)
+
+// Generator makes the primary keys of state store records.
+type Generator interface {
+	New() string
+}
+
+var (
+	mu      sync.RWMutex
+	current Generator = uuidGenerator{}
+)
+
+// Init sets the generator New uses. Until it is called New returns UUIDs.
+func Init(cfg config.IDConfig) error {
+	g, err := NewGenerator(cfg)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	current = g
+	return nil
+}
+
+// New returns a new record ID.
+func New() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current.New()
+}
+
+func NewGenerator(cfg config.IDConfig) (Generator, error) {
+	switch cfg.GetFormat() {
+	case FormatUUID:
+		return uuidGenerator{}, nil
+	case FormatULID:
+		return &ulidGenerator{}, nil
+	case FormatSnowflake:
+		node := cfg.NodeID
+		if node == 0 {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read hostname for snowflake node id: %w", err)
+			}
+			h := fnv.New32a()
+			h.Write([]byte(hostname))
+			node = int(h.Sum32() % (maxNode + 1))
+		}
+		if node < 0 || node > maxNode {
+			return nil, fmt.Errorf("snowflake node id must be between 0 and %d, got %d", maxNode, node)
+		}
+		return &snowflakeGenerator{node: int64(node)}, nil
+	default:
+		return nil, fmt.Errorf("unknown id format %q", cfg.Format)
+	}
+}
+
+// uuidGenerator makes random (version 4) UUIDs, which don't sort by time.
+type uuidGenerator struct{}
+
+func (uuidGenerator) New() string {
+	return uuid.New().String()
+}
+
+// crockford is the ULID alphabet; it sorts in byte order.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidGenerator makes ULIDs: 26 characters encoding a millisecond
+// timestamp and 80 random bits. IDs made in the same millisecond
+// increment the random bits, so they sort in the order they were made.
+type ulidGenerator struct {
+	mu      sync.Mutex
+	lastMs  uint64
+	entropy [10]byte
+}
+
+func (g *ulidGenerator) New() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(time.Now().UnixMilli())
+	if ms > g.lastMs {
+		g.lastMs = ms
+		if _, err := rand.Read(g.entropy[:]); err != nil {
+			panic(fmt.Sprintf("ids: reading random bytes: %v", err))
+		}
+	} else {
+		// Same millisecond, or the clock went back: carry on from the
+		// last ID; 80 bits don't run out
+		for i := len(g.entropy) - 1; i >= 0; i-- {
+			if g.entropy[i]++; g.entropy[i] != 0 {
+				break
+			}
+		}
+	}
+
+	var id [16]byte
+	id[0], id[1], id[2] = byte(g.lastMs>>40), byte(g.lastMs>>32), byte(g.lastMs>>24)
+	id[3], id[4], id[5] = byte(g.lastMs>>16), byte(g.lastMs>>8), byte(g.lastMs)
+	copy(id[6:], g.entropy[:])
+	return encodeULID(id)
+}
+
+// encodeULID writes 128 bits as 26 base32 characters, 5 bits each from the
+// most significant, the first character holding the top 3.
+func encodeULID(id [16]byte) string {
+	hi, lo := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+const (
+	nodeBits     = 10
+	sequenceBits = 12
+	maxNode      = 1<<nodeBits - 1
+	maxSequence  = 1<<sequenceBits - 1
+)
+
+// snowflakeEpoch keeps snowflake timestamps small; 41 bits of
+// milliseconds after it last until 2089.
+var snowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+
+// snowflakeGenerator makes 64-bit IDs from a millisecond timestamp, the
+// node ID and a per-millisecond sequence. They are written as 20 zero
+// padded digits, so they sort as strings too.
+type snowflakeGenerator struct {
+	mu       sync.Mutex
+	node     int64
+	lastMs   int64
+	sequence int64
+}
+
+func (g *snowflakeGenerator) New() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := time.Now().UnixMilli() - snowflakeEpoch
+	if ms < g.lastMs {
+		// The clock went back; keep counting from the last millisecond
+		ms = g.lastMs
+	}
+	if ms == g.lastMs {
+		g.sequence = (g.sequence + 1) & maxSequence
+		if g.sequence == 0 {
+			// Sequence used up: wait for the next millisecond
+			for ms <= g.lastMs {
+				time.Sleep(100 * time.Microsecond)
+				ms = time.Now().UnixMilli() - snowflakeEpoch
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastMs = ms
+
+	id := ms<<(nodeBits+sequenceBits) | g.node<<sequenceBits | g.sequence
+	return fmt.Sprintf("%020d", id)
+}
@@ -0,0 +1,29 @@
+package logger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the ID of the API request it serves.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID ctx carries, or "".
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// For returns Log, tagged with the request ID ctx carries so entries
+// logged while serving a request can be matched with its access log.
+func For(ctx context.Context) *zap.Logger {
+	if requestID := RequestID(ctx); requestID != "" {
+		return Log.With(zap.String("request_id", requestID))
+	}
+	return Log
+}
@@ -1,12 +1,37 @@
 package logger
 
 import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 var Log *zap.Logger
 
+// Level is shared by every core built from InitLogger, so changing it takes
+// effect immediately without rebuilding the logger. It is the level of
+// every module without one of its own.
+var Level = zap.NewAtomicLevelAt(zap.InfoLevel)
+
+// coreLevel gates the core: the lowest of Level and every module's level,
+// so whatever some module logs reaches moduleCore to be filtered.
+var coreLevel = zap.NewAtomicLevelAt(zap.InfoLevel)
+
+var (
+	baseMu    sync.Mutex // serializes level changes
+	baseLevel = zap.InfoLevel
+
+	// modules maps a module, the package that logged an entry (sync, store,
+	// api, ...), to its own level
+	modules  atomic.Pointer[map[string]zapcore.Level]
+	sampling atomic.Pointer[debugSampler]
+)
+
 func InitLogger(level string, format string) error {
 	var config zap.Config
 
@@ -19,30 +44,279 @@ func InitLogger(level string, format string) error {
 	// Set log level
 	switch level {
 	case "debug":
-		config.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
+		Level.SetLevel(zap.DebugLevel)
 	case "info":
-		config.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
+		Level.SetLevel(zap.InfoLevel)
 	case "warn":
-		config.Level = zap.NewAtomicLevelAt(zap.WarnLevel)
+		Level.SetLevel(zap.WarnLevel)
 	case "error":
-		config.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
+		Level.SetLevel(zap.ErrorLevel)
 	default:
-		config.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
+		Level.SetLevel(zap.InfoLevel)
 	}
+	config.Level = coreLevel
+
+	baseMu.Lock()
+	baseLevel = Level.Level()
+	updateCoreLevel()
+	baseMu.Unlock()
 
 	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	
+
 	var err error
-	Log, err = config.Build()
+	Log, err = config.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &moduleCore{Core: core}
+	}))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetLevel changes the active log level at runtime.
+func SetLevel(level string) error {
+	parsed, err := parseLevel(level)
 	if err != nil {
 		return err
 	}
 
+	baseMu.Lock()
+	defer baseMu.Unlock()
+
+	// Remember non-debug choices so the SIGUSR1 toggle returns to them
+	if parsed != zap.DebugLevel {
+		baseLevel = parsed
+	}
+	Level.SetLevel(parsed)
+	updateCoreLevel()
+	return nil
+}
+
+// GetLevel returns the active log level name.
+func GetLevel() string {
+	return Level.Level().String()
+}
+
+// SetModuleLevel gives a module its own level, e.g. debug for sync alone;
+// an empty level returns it to Level.
+func SetModuleLevel(name, level string) error {
+	if err := checkModule(name); err != nil {
+		return err
+	}
+	var parsed zapcore.Level
+	if level != "" {
+		var err error
+		if parsed, err = parseLevel(level); err != nil {
+			return err
+		}
+	}
+
+	baseMu.Lock()
+	defer baseMu.Unlock()
+
+	levels := make(map[string]zapcore.Level)
+	if current := modules.Load(); current != nil {
+		for module, l := range *current {
+			levels[module] = l
+		}
+	}
+	if level == "" {
+		delete(levels, name)
+	} else {
+		levels[name] = parsed
+	}
+	modules.Store(&levels)
+	updateCoreLevel()
+	return nil
+}
+
+// SetModuleLevels replaces the level of every module at once.
+func SetModuleLevels(levels map[string]string) error {
+	parsed := make(map[string]zapcore.Level, len(levels))
+	for name, level := range levels {
+		if err := checkModule(name); err != nil {
+			return err
+		}
+		l, err := parseLevel(level)
+		if err != nil {
+			return fmt.Errorf("module %s: %w", name, err)
+		}
+		parsed[name] = l
+	}
+
+	baseMu.Lock()
+	defer baseMu.Unlock()
+	modules.Store(&parsed)
+	updateCoreLevel()
 	return nil
 }
 
+// ModuleLevels returns the modules with a level of their own.
+func ModuleLevels() map[string]string {
+	levels := make(map[string]string)
+	if current := modules.Load(); current != nil {
+		for module, level := range *current {
+			levels[module] = level.String()
+		}
+	}
+	return levels
+}
+
+// SetDebugSampling limits debug entries to the first initial of each
+// message every second, and every thereafter-th one after that, so debug
+// logging of every event stays affordable. Zero initial turns it off.
+func SetDebugSampling(initial, thereafter int) error {
+	if initial < 0 || thereafter < 0 {
+		return fmt.Errorf("debug sampling must not be negative")
+	}
+	if initial == 0 {
+		sampling.Store(nil)
+		return nil
+	}
+	sampling.Store(&debugSampler{initial: initial, thereafter: thereafter, counts: make(map[string]int)})
+	return nil
+}
+
+// DebugSampling returns the debug sampling, zeros when it is off.
+func DebugSampling() (initial, thereafter int) {
+	if s := sampling.Load(); s != nil {
+		return s.initial, s.thereafter
+	}
+	return 0, 0
+}
+
+// ToggleDebug flips between debug and the level the logger was started with,
+// returning the new level. Used by the SIGUSR1 handler.
+func ToggleDebug() string {
+	baseMu.Lock()
+	defer baseMu.Unlock()
+
+	if Level.Level() == zap.DebugLevel && baseLevel != zap.DebugLevel {
+		Level.SetLevel(baseLevel)
+	} else {
+		Level.SetLevel(zap.DebugLevel)
+	}
+	updateCoreLevel()
+	return Level.Level().String()
+}
+
 func Sync() {
 	if Log != nil {
 		_ = Log.Sync()
 	}
 }
+
+func checkModule(name string) error {
+	if name == "" || strings.ContainsAny(name, " /.") {
+		return fmt.Errorf("invalid log module %q", name)
+	}
+	return nil
+}
+
+func parseLevel(level string) (zapcore.Level, error) {
+	var parsed zapcore.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return parsed, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	return parsed, nil
+}
+
+// updateCoreLevel lowers the core's level to what the most verbose module
+// needs. baseMu must be held.
+func updateCoreLevel() {
+	lowest := Level.Level()
+	if current := modules.Load(); current != nil {
+		for _, level := range *current {
+			if level < lowest {
+				lowest = level
+			}
+		}
+	}
+	coreLevel.SetLevel(lowest)
+}
+
+// moduleLevel is the level entries logged from caller must reach.
+func moduleLevel(caller zapcore.EntryCaller) zapcore.Level {
+	current := modules.Load()
+	if current == nil || len(*current) == 0 {
+		return Level.Level()
+	}
+	if level, ok := (*current)[module(caller)]; ok {
+		return level
+	}
+	return Level.Level()
+}
+
+// module is the last element of the caller's package path, e.g. "sync"
+// for mysql-sync-service/internal/sync.(*Worker).processBatch.
+func module(caller zapcore.EntryCaller) string {
+	if caller.Function == "" {
+		return path.Base(path.Dir(caller.File))
+	}
+	function := caller.Function
+	pkg := function
+	if slash := strings.LastIndexByte(function, '/'); slash >= 0 {
+		pkg = function[slash+1:]
+	}
+	if dot := strings.IndexByte(pkg, '.'); dot >= 0 {
+		pkg = pkg[:dot]
+	}
+	return pkg
+}
+
+// moduleCore filters entries by the level of the module that logged them,
+// and samples debug entries. The caller is only known once an entry is
+// written, so the wrapped core is checked at the lowest module level and
+// the module's own applied in Write.
+type moduleCore struct {
+	zapcore.Core
+}
+
+func (c *moduleCore) With(fields []zapcore.Field) zapcore.Core {
+	return &moduleCore{Core: c.Core.With(fields)}
+}
+
+func (c *moduleCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	// The wrapped core checks the level and applies the production sampler
+	if c.Core.Check(ent, nil) == nil {
+		return ce
+	}
+	return ce.AddCore(ent, c)
+}
+
+func (c *moduleCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Level < moduleLevel(ent.Caller) {
+		return nil
+	}
+	if ent.Level == zapcore.DebugLevel {
+		if s := sampling.Load(); s != nil && !s.allow(ent) {
+			return nil
+		}
+	}
+	return c.Core.Write(ent, fields)
+}
+
+// debugSampler counts each debug message per second.
+type debugSampler struct {
+	initial, thereafter int
+
+	mu     sync.Mutex
+	second int64
+	counts map[string]int
+}
+
+func (s *debugSampler) allow(ent zapcore.Entry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if second := ent.Time.Unix(); second != s.second {
+		s.second = second
+		s.counts = make(map[string]int)
+	}
+	s.counts[ent.Message]++
+	n := s.counts[ent.Message]
+	if n <= s.initial {
+		return true
+	}
+	return s.thereafter > 0 && (n-s.initial)%s.thereafter == 0
+}
@@ -0,0 +1,240 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "dbsync"
+
+var (
+	// ReplicationLag is the delay between a binlog event being written on the
+	// source and the worker applying it to the target.
+	ReplicationLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "replication_lag_seconds",
+		Help:      "Seconds between the binlog event timestamp and its apply time, per table.",
+	}, []string{"table"})
+
+	// TableLagging is 1 while a table's lag exceeds its configured threshold.
+	TableLagging = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "table_lagging",
+		Help:      "1 when the table's replication lag is above its threshold, 0 otherwise.",
+	}, []string{"table"})
+
+	// UpdatesSuppressed counts update rows skipped because no trigger column changed.
+	UpdatesSuppressed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_suppressed_total",
+		Help:      "Update rows dropped because none of the table's trigger columns changed.",
+	}, []string{"table"})
+
+	// OperationsFiltered counts rows dropped because the table doesn't
+	// replicate their operation.
+	OperationsFiltered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operations_filtered_total",
+		Help:      "Rows dropped because their operation isn't among the table's replicated operations.",
+	}, []string{"table", "operation"})
+
+	// ConversionErrors counts row values that didn't fit their column's
+	// type, failing their event under strict conversion.
+	ConversionErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "conversion_errors_total",
+		Help:      "Row values that didn't fit the type of their column.",
+	}, []string{"table", "column"})
+
+	// LossyConversions counts text values that lost characters converting
+	// between the two sides' charsets; they count as conversion errors too.
+	LossyConversions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lossy_conversions_total",
+		Help:      "Text values that lost characters converting between charsets.",
+	}, []string{"table", "column"})
+
+	// QueueSpilledBytes is the size of events currently spilled to disk.
+	QueueSpilledBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_spilled_bytes",
+		Help:      "Bytes of binlog events waiting in on-disk spill segments.",
+	})
+
+	// EventsDeduplicated counts events skipped because the target's
+	// checkpoint shows they were already applied.
+	EventsDeduplicated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_deduplicated_total",
+		Help:      "Re-delivered binlog events skipped because the target already applied them.",
+	}, []string{"table"})
+
+	// TransactionsSplit counts source transactions too large to apply in
+	// one target transaction.
+	TransactionsSplit = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transactions_split_total",
+		Help:      "Source transactions over sync.transactions.max_rows, applied in several target transactions.",
+	})
+
+	// CircuitBreakerState is a sink's circuit: 0 closed, 1 open, 2 probing.
+	CircuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_state",
+		Help:      "Circuit state per sink: 0 closed, 1 open, 2 half-open (probing the target).",
+	}, []string{"sink"})
+
+	// CircuitBreakerTrips counts how often a sink's circuit opened.
+	CircuitBreakerTrips = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_trips_total",
+		Help:      "Times a sink's circuit opened after consecutive failed batches.",
+	}, []string{"sink"})
+
+	// ConflictsPending is the number of conflicts waiting to be written to
+	// the state store.
+	ConflictsPending = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "conflicts_pending",
+		Help:      "Conflicts detected but not yet written to the state store.",
+	})
+
+	// ConflictsDropped counts conflicts not recorded because too many were
+	// waiting to be written.
+	ConflictsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "conflicts_dropped_total",
+		Help:      "Conflicts dropped, per table, because the state store write buffer was full.",
+	}, []string{"table"})
+
+	// StateStoreBufferedWrites is the number of writes held while the state
+	// store is unavailable.
+	StateStoreBufferedWrites = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "state_store_buffered_writes",
+		Help:      "Writes held in memory until the state store is available again.",
+	})
+
+	StateStoreBufferedBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "state_store_buffered_bytes",
+		Help:      "Approximate size of the writes held for the state store.",
+	})
+
+	// AuditWriteFailures counts failed writes to the audit log, which are
+	// retried.
+	AuditWriteFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_write_failures_total",
+		Help:      "Failed writes to the audit log of applied changes; the records are held and retried.",
+	})
+
+	// CheckpointsHeld is the number of tables whose latest checkpoint is
+	// held in memory until the next write-behind flush.
+	CheckpointsHeld = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "checkpoints_held",
+		Help:      "Tables whose latest checkpoint waits for the next flush to the state store.",
+	})
+
+	// RetentionPurged counts records purged from the state store, by kind:
+	// conflicts or history.
+	RetentionPurged = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retention_purged_total",
+		Help:      "Records purged from the state store, by kind.",
+	}, []string{"kind"})
+
+	// StateStoreWritesDropped counts writes lost because the state store
+	// was unavailable and the buffer was full.
+	StateStoreWritesDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "state_store_writes_dropped_total",
+		Help:      "Writes dropped because the state store was unavailable and its write buffer was full.",
+	})
+
+	// Workers is the number of workers applying changes.
+	Workers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workers",
+		Help:      "Workers currently applying changes to the target.",
+	})
+
+	// WorkerScaling counts worker pool resizes by direction, up or down.
+	WorkerScaling = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "worker_scaling_total",
+		Help:      "Worker pool resizes, by direction: up or down.",
+	}, []string{"direction"})
+
+	// CheckpointWriteFailures counts failed writes of a table's sync state,
+	// the binlog position a restart resumes from.
+	CheckpointWriteFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "checkpoint_write_failures_total",
+		Help:      "Failed writes of a table's checkpoint to the state store, retried until one succeeds.",
+	}, []string{"table"})
+
+	// CheckpointsUnpersisted is the number of tables whose latest checkpoint
+	// isn't in the state store yet.
+	CheckpointsUnpersisted = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "checkpoints_unpersisted",
+		Help:      "Tables whose latest checkpoint is held in memory, not yet in the state store.",
+	})
+
+	// DatabaseBytes counts the bytes sent to and received from each
+	// database server, as they cross the network.
+	DatabaseBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "database_bytes_total",
+		Help:      "Bytes sent to and received from database servers over the network, by address and direction.",
+	}, []string{"address", "direction"})
+
+	// ObservedChanges counts row changes seen in observer mode by what
+	// applying them would have done.
+	ObservedChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "observed_changes_total",
+		Help:      "Row changes seen in observer mode, by outcome: insert, update, delete, unchanged or conflict.",
+	}, []string{"table", "outcome"})
+)
+
+// StatsReaders read the sync's live statistics at scrape time.
+type StatsReaders struct {
+	EventsQueued    func() float64
+	EventsProcessed func() float64
+	RowsApplied     func() float64
+	BatchesApplied  func() float64
+	BatchesFailed   func() float64
+	DeadLetters     func() float64
+	Running         func() float64
+	LastAppliedAt   func() float64
+}
+
+// RegisterStats exports the sync's statistics registry. It must be called
+// once.
+func RegisterStats(r StatsReaders) {
+	counter := func(name, help string, read func() float64) {
+		promauto.NewCounterFunc(prometheus.CounterOpts{Namespace: namespace, Name: name, Help: help}, read)
+	}
+	gauge := func(name, help string, read func() float64) {
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{Namespace: namespace, Name: name, Help: help}, read)
+	}
+	counter("events_queued_total", "Change events read from the source and queued for the workers.", r.EventsQueued)
+	counter("events_processed_total", "Change events applied to the target or dead-lettered.", r.EventsProcessed)
+	counter("rows_applied_total", "Rows applied to the target.", r.RowsApplied)
+	counter("batches_applied_total", "Batches applied to every sink.", r.BatchesApplied)
+	counter("batches_failed_total", "Batches that failed to apply.", r.BatchesFailed)
+	counter("dead_letters_total", "Events parked in the dead letter table.", r.DeadLetters)
+	gauge("running", "1 while a sync run is running or paused, 0 when idle.", r.Running)
+	gauge("last_applied_timestamp_seconds", "Unix time a batch was last applied, 0 if none has been.", r.LastAppliedAt)
+}
+
+// Handler serves the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,95 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"mysql-sync-service/internal/auth"
+	syncv1 "mysql-sync-service/proto/sync/v1"
+)
+
+// methodActions is the token action each method takes, on top of reading;
+// methods not listed only read. Tables are checked by the methods.
+var methodActions = map[string]string{
+	syncv1.SyncService_Trigger_FullMethodName:         auth.ActionTrigger,
+	syncv1.SyncService_Stop_FullMethodName:            auth.ActionTrigger,
+	syncv1.SyncService_ResolveConflict_FullMethodName: auth.ActionResolve,
+}
+
+type principalKey struct{}
+
+// authenticate checks the bearer token in the call's authorization
+// metadata, as the HTTP API checks its header, and the action the method
+// takes. It returns ctx with the token's principal.
+func authenticate(ctx context.Context, tokens *auth.Tokens, method string) (context.Context, error) {
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			header = values[0]
+		}
+	}
+	p := tokens.Authenticate(header)
+	if p == nil {
+		return nil, status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+	}
+	if err := p.Authorize(methodActions[method]); err != nil {
+		return nil, permissionError(err)
+	}
+	return context.WithValue(ctx, principalKey{}, p), nil
+}
+
+func unaryAuth(tokens *auth.Tokens) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, tokens, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamAuth(tokens *auth.Tokens) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), tokens, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// authStream carries the principal in its context.
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
+
+func principalFrom(ctx context.Context) *auth.Principal {
+	if p, ok := ctx.Value(principalKey{}).(*auth.Principal); ok {
+		return p
+	}
+	return auth.FullAccess
+}
+
+// authorize returns a PermissionDenied status unless the caller may
+// perform action on every one of tables.
+func authorize(ctx context.Context, action string, tables ...string) error {
+	return permissionError(principalFrom(ctx).Authorize(action, tables...))
+}
+
+func permissionError(err error) error {
+	var denied *auth.Denied
+	if !errors.As(err, &denied) {
+		return err
+	}
+	return status.Error(codes.PermissionDenied, denied.Message)
+}
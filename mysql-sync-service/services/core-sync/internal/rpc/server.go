@@ -0,0 +1,241 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"mysql-sync-service/internal/auth"
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/encryption"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/store"
+	"mysql-sync-service/internal/sync"
+	syncv1 "mysql-sync-service/proto/sync/v1"
+)
+
+// eventBuffer is how many events a slow stream may fall behind before
+// it starts missing them.
+const eventBuffer = 256
+
+// Server exposes the sync manager over gRPC for internal services.
+type Server struct {
+	syncv1.UnimplementedSyncServiceServer
+
+	syncManager *sync.Manager
+	store       store.Store
+	grpcServer  *grpc.Server
+}
+
+// NewServer takes the same bearer tokens as the HTTP API, in authorization
+// metadata, with the same limits on tables and actions.
+func NewServer(manager *sync.Manager, store store.Store, cfg config.ServerConfig) (*Server, error) {
+	tokens, err := auth.NewTokens(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		syncManager: manager,
+		store:       store,
+		grpcServer: grpc.NewServer(
+			grpc.UnaryInterceptor(unaryAuth(tokens)),
+			grpc.StreamInterceptor(streamAuth(tokens)),
+		),
+	}
+	syncv1.RegisterSyncServiceServer(s.grpcServer, s)
+	return s, nil
+}
+
+// Serve blocks until the listener fails or GracefulStop is called.
+func (s *Server) Serve(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	logger.Log.Info("gRPC server listening", zap.String("addr", addr))
+	return s.grpcServer.Serve(lis)
+}
+
+func (s *Server) GracefulStop() {
+	s.grpcServer.GracefulStop()
+}
+
+// Trigger starts a run over every table the token may access.
+func (s *Server) Trigger(ctx context.Context, req *syncv1.TriggerRequest) (*syncv1.TriggerResponse, error) {
+	if err := s.syncManager.StartTables(principalFrom(ctx).Tables()); err != nil {
+		return nil, serviceError(err)
+	}
+	return &syncv1.TriggerResponse{Status: "started", RunId: s.syncManager.RunID()}, nil
+}
+
+func (s *Server) Stop(ctx context.Context, req *syncv1.StopRequest) (*syncv1.StopResponse, error) {
+	if err := authorize(ctx, auth.ActionTrigger, s.syncManager.RunTables()...); err != nil {
+		return nil, err
+	}
+	s.syncManager.Stop()
+	return &syncv1.StopResponse{Status: "stopped"}, nil
+}
+
+func (s *Server) Status(ctx context.Context, req *syncv1.StatusRequest) (*syncv1.StatusResponse, error) {
+	resp := &syncv1.StatusResponse{
+		Status:        s.syncManager.GetStatus(),
+		RunId:         s.syncManager.RunID(),
+		BufferedBytes: s.syncManager.BufferedBytes(),
+	}
+	p := principalFrom(ctx)
+	for _, lag := range s.syncManager.GetTableLag() {
+		if !p.CanTable(lag.Table) {
+			continue
+		}
+		resp.Tables = append(resp.Tables, &syncv1.TableLag{
+			Table:         lag.Table,
+			Status:        lag.Status,
+			LagSeconds:    lag.LagSeconds,
+			LastEventTime: timestamppb.New(lag.LastEventTime),
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) StreamEvents(req *syncv1.StreamEventsRequest, stream syncv1.SyncService_StreamEventsServer) error {
+	p := principalFrom(stream.Context())
+	tables := make(map[string]bool, len(req.Tables))
+	for _, table := range req.Tables {
+		tables[table] = true
+	}
+
+	events, cancel := s.syncManager.Subscribe(eventBuffer)
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e := <-events:
+			// Run-level events carry no table and always pass the filters
+			if e.Table != "" && (len(tables) > 0 && !tables[e.Table] || !p.CanTable(e.Table)) {
+				continue
+			}
+			if err := stream.Send(newSyncEvent(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Server) ListConflicts(ctx context.Context, req *syncv1.ListConflictsRequest) (*syncv1.ListConflictsResponse, error) {
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = 50
+	}
+	if req.Offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "offset must not be negative")
+	}
+
+	conflicts, err := s.store.ListConflicts(ctx, req.Resolved, principalFrom(ctx).Tables(), limit, int(req.Offset))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &syncv1.ListConflictsResponse{}
+	for _, c := range conflicts {
+		resp.Conflicts = append(resp.Conflicts, newConflict(c))
+	}
+	return resp, nil
+}
+
+func (s *Server) ResolveConflict(ctx context.Context, req *syncv1.ResolveConflictRequest) (*syncv1.ResolveConflictResponse, error) {
+	if req.Id == "" || req.Strategy == "" {
+		return nil, status.Error(codes.InvalidArgument, "id and strategy are required")
+	}
+
+	conflict, err := s.store.GetConflict(ctx, req.Id)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if conflict == nil {
+		return nil, status.Errorf(codes.NotFound, "conflict %s not found", req.Id)
+	}
+	if err := authorize(ctx, auth.ActionResolve, conflict.TableName); err != nil {
+		return nil, err
+	}
+	if conflict.Resolved {
+		return nil, status.Errorf(codes.FailedPrecondition, "conflict %s is already resolved", req.Id)
+	}
+
+	if err := s.syncManager.ResolveConflict(ctx, conflict, req.Strategy, req.ResolvedData); err != nil {
+		return nil, serviceError(err)
+	}
+
+	conflict, err = s.store.GetConflict(ctx, req.Id)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &syncv1.ResolveConflictResponse{Conflict: newConflict(conflict)}, nil
+}
+
+// serviceError maps sync manager errors onto gRPC status codes.
+func serviceError(err error) error {
+	switch {
+	case errors.Is(err, sync.ErrUnknownTable):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, sync.ErrAlreadyRunning), errors.Is(err, sync.ErrNotRunning), errors.Is(err, encryption.ErrRotationRunning):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, encryption.ErrNotConfigured), errors.Is(err, sync.ErrInvalidResolution):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, sync.ErrConflictChanged):
+		return status.Error(codes.Aborted, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func newSyncEvent(e sync.SyncEvent) *syncv1.SyncEvent {
+	return &syncv1.SyncEvent{
+		Type:           e.Type,
+		RunId:          e.RunID,
+		Table:          e.Table,
+		Status:         e.Status,
+		Events:         int32(e.Events),
+		BinlogFile:     e.BinlogFile,
+		BinlogPosition: e.BinlogPos,
+		Error:          e.Error,
+		Time:           timestamppb.New(e.Time),
+		SourceSite:     e.SourceSite,
+	}
+}
+
+func newConflict(c *store.Conflict) *syncv1.Conflict {
+	conflict := &syncv1.Conflict{
+		Id:              c.ID,
+		TableName:       c.TableName,
+		PrimaryKeyValue: c.PrimaryKeyValue,
+		ConflictType:    c.ConflictType,
+		LocalData:       c.LocalData,
+		CloudData:       c.CloudData,
+		DetectedAt:      timestamppb.New(c.DetectedAt),
+		Resolved:        c.Resolved,
+		ResolvedData:    c.ResolvedData,
+	}
+	if c.ResolutionStrategy.Valid {
+		conflict.ResolutionStrategy = c.ResolutionStrategy.String
+	}
+	if c.ResolvedAt.Valid {
+		conflict.ResolvedAt = timestamppb.New(c.ResolvedAt.Time)
+	}
+	if c.SourceSite.Valid || c.SourceHost.Valid || c.SourceServerUUID.Valid {
+		conflict.Source = &syncv1.Source{
+			SiteId:     c.SourceSite.String,
+			Host:       c.SourceHost.String,
+			ServerUuid: c.SourceServerUUID.String,
+		}
+	}
+	return conflict
+}
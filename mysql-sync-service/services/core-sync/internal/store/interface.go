@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"time"
 )
 
 type Store interface {
@@ -11,15 +12,84 @@ type Store interface {
 	
 	// Conflicts
 	CreateConflict(ctx context.Context, conflict *Conflict) error
+	// CreateConflicts writes conflicts in one statement
+	CreateConflicts(ctx context.Context, conflicts []*Conflict) error
 	GetConflict(ctx context.Context, id string) (*Conflict, error)
-	ListConflicts(ctx context.Context, resolved bool, limit, offset int) ([]*Conflict, error)
+	// ListConflicts with no tables matches every table
+	ListConflicts(ctx context.Context, resolved bool, tables []string, limit, offset int) ([]*Conflict, error)
+	// ExportConflicts calls fn with each matching conflict as it is read,
+	// in the order they were detected, until fn fails
+	ExportConflicts(ctx context.Context, filter ConflictExportFilter, fn func(*Conflict) error) error
 	ResolveConflict(ctx context.Context, id string, strategy string, resolvedData []byte) error
+	CountUnresolvedConflicts(ctx context.Context) (int, error)
+	// PurgeConflicts deletes matching conflicts, and their finished
+	// resolution intents, returning how many conflicts went
+	PurgeConflicts(ctx context.Context, filter ConflictPurgeFilter) (int64, error)
+
+	// Resolution intents; pending ones were interrupted mid-resolution.
+	// ClaimConflict records one only for an unclaimed conflict at version.
+	ClaimConflict(ctx context.Context, intent *ResolutionIntent, version int) (bool, error)
+	UpdateResolutionIntent(ctx context.Context, intent *ResolutionIntent) error
+	ListPendingResolutionIntents(ctx context.Context) ([]*ResolutionIntent, error)
 	
+	// Dead letters; an empty runID matches every run
+	CreateDeadLetter(ctx context.Context, deadLetter *DeadLetter) error
+	ListDeadLetters(ctx context.Context, runID string, limit, offset int) ([]*DeadLetter, error)
+	CountDeadLetters(ctx context.Context, runID string) (int, error)
+
+	// Audit records of applied changes; ListAuditRecords returns the newest
+	// first
+	CreateAuditRecords(ctx context.Context, records []*AuditRecord) error
+	ListAuditRecords(ctx context.Context, filter AuditFilter) ([]*AuditRecord, error)
+
+	// Heatmap counts conflicts and dead letters per table and hour in
+	// [from, to); no tables matches every table. Empty hours are left out.
+	Heatmap(ctx context.Context, from, to time.Time, tables []string) ([]*HeatmapCell, error)
+	// ConflictStats counts conflicts detected in [from, to) per table,
+	// type, strategy and day; no tables matches every table
+	ConflictStats(ctx context.Context, from, to time.Time, tables []string) ([]*ConflictStatsRow, error)
+
+	// Schema versions; CreateSchemaVersion assigns the next version number
+	CreateSchemaVersion(ctx context.Context, version *SchemaVersion) error
+	GetLatestSchemaVersion(ctx context.Context, tableName string) (*SchemaVersion, error)
+	ListSchemaVersions(ctx context.Context, tableName string) ([]*SchemaVersion, error)
+
 	// History
 	CreateSyncHistory(ctx context.Context, history *SyncHistory) error
 	UpdateSyncHistory(ctx context.Context, history *SyncHistory) error
-	GetSyncHistory(ctx context.Context, limit, offset int) ([]*SyncHistory, error)
+	// GetSyncHistory lists the runs that synced any of tables, or every run
+	// if nil, the latest first
+	GetSyncHistory(ctx context.Context, tables []string, limit, offset int) ([]*SyncHistory, error)
+	// ExportSyncHistory calls fn with each matching run as it is read, in
+	// the order they started, until fn fails
+	ExportSyncHistory(ctx context.Context, filter HistoryExportFilter, fn func(*SyncHistory) error) error
+	// PurgeSyncHistory deletes finished runs started before before
+	PurgeSyncHistory(ctx context.Context, before time.Time) (int64, error)
+
+	// Replication server IDs claimed per source. ClaimServerID claims
+	// serverID for owner, giving up owner's other claim on the source,
+	// unless another owner holds it, and returns the ID's holder.
+	// GetServerID returns owner's claimed ID, 0 if it has none.
+	ClaimServerID(ctx context.Context, source string, serverID uint32, owner string) (string, error)
+	GetServerID(ctx context.Context, source, owner string) (uint32, error)
+
+	// Leases elect one instance among several. AcquireLease takes or
+	// renews the named lease for holder, for ttl from now, unless another
+	// holder's lease hasn't expired, and returns the lease as it stands.
+	// Expiry is judged by the state store's clock. TakeLease takes the
+	// lease over from holder from, expired or not, if from still holds it.
+	// ReleaseLease gives up holder's lease; GetLease returns nil for a
+	// lease never taken.
+	AcquireLease(ctx context.Context, name, holder, address string, ttl time.Duration) (*Lease, error)
+	TakeLease(ctx context.Context, name, holder, address, from string, ttl time.Duration) (*Lease, error)
+	ReleaseLease(ctx context.Context, name, holder string) error
+	GetLease(ctx context.Context, name string) (*Lease, error)
+
+	// Settings override config at runtime; a missing setting reads as ""
+	GetSetting(ctx context.Context, name string) (string, error)
+	SetSetting(ctx context.Context, name, value string) error
 	
 	// General
+	Ping(ctx context.Context) error
 	Close() error
 }
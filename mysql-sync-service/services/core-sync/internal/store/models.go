@@ -19,17 +19,36 @@ type SyncState struct {
 }
 
 type Conflict struct {
-	ID                 string         `db:"id"`
-	TableName          string         `db:"table_name"`
-	PrimaryKeyValue    string         `db:"primary_key_value"`
+	ID                 string          `db:"id"`
+	TableName          string          `db:"table_name"`
+	PrimaryKeyValue    string          `db:"primary_key_value"`
 	LocalData          json.RawMessage `db:"local_data"`
 	CloudData          json.RawMessage `db:"cloud_data"`
-	ConflictType       string         `db:"conflict_type"`
-	DetectedAt         time.Time      `db:"detected_at"`
-	Resolved           bool           `db:"resolved"`
-	ResolutionStrategy sql.NullString `db:"resolution_strategy"`
-	ResolvedAt         sql.NullTime   `db:"resolved_at"`
+	ConflictType       string          `db:"conflict_type"`
+	DetectedAt         time.Time       `db:"detected_at"`
+	Resolved           bool            `db:"resolved"`
+	ResolutionStrategy sql.NullString  `db:"resolution_strategy"`
+	ResolvedAt         sql.NullTime    `db:"resolved_at"`
 	ResolvedData       json.RawMessage `db:"resolved_data"`
+
+	// Binlog event that surfaced the conflict
+	BinlogFile     sql.NullString  `db:"binlog_file"`
+	BinlogPosition sql.NullInt64   `db:"binlog_position"`
+	GTID           sql.NullString  `db:"gtid"`
+	EventType      sql.NullString  `db:"event_type"`
+	EventBefore    json.RawMessage `db:"event_before"`
+	EventAfter     json.RawMessage `db:"event_after"`
+
+	// Source that produced the triggering event
+	SourceSite       sql.NullString `db:"source_site"`
+	SourceHost       sql.NullString `db:"source_host"`
+	SourceServerUUID sql.NullString `db:"source_server_uuid"`
+
+	// Version of the table's schema the event was read under
+	SchemaVersion sql.NullInt64 `db:"schema_version"`
+
+	// Bumped by each resolution claiming the conflict
+	Version int `db:"version"`
 }
 
 type SyncHistory struct {
@@ -42,4 +61,140 @@ type SyncHistory struct {
 	ConflictsDetected int            `db:"conflicts_detected"`
 	Status            string         `db:"status"`
 	ErrorMessage      sql.NullString `db:"error_message"`
+	Trigger           string         `db:"trigger_type"`
+	// Where the run left off when it was stopped
+	ShutdownReport json.RawMessage `db:"shutdown_report"`
+}
+
+// DeadLetter is an event that failed to apply, with the error it hit.
+type DeadLetter struct {
+	ID             string          `db:"id"`
+	RunID          string          `db:"run_id"`
+	TableName      string          `db:"table_name"`
+	EventType      string          `db:"event_type"`
+	BinlogFile     sql.NullString  `db:"binlog_file"`
+	BinlogPosition sql.NullInt64   `db:"binlog_position"`
+	GTID           sql.NullString  `db:"gtid"`
+	Payload        json.RawMessage `db:"payload"`
+	ErrorMessage   string          `db:"error_message"`
+	CreatedAt      time.Time       `db:"created_at"`
+	SchemaVersion  sql.NullInt64   `db:"schema_version"`
+}
+
+// AuditRecord is a change applied to the target, kept for compliance. Row
+// images are kept as hashes only.
+type AuditRecord struct {
+	ID              string         `db:"id"`
+	RunID           string         `db:"run_id"`
+	TableName       string         `db:"table_name"`
+	PrimaryKeyValue string         `db:"primary_key_value"`
+	Operation       string         `db:"operation"`
+	BeforeHash      sql.NullString `db:"before_hash"`
+	AfterHash       sql.NullString `db:"after_hash"`
+	BinlogFile      sql.NullString `db:"binlog_file"`
+	BinlogPosition  sql.NullInt64  `db:"binlog_position"`
+	GTID            sql.NullString `db:"gtid"`
+	Worker          int            `db:"worker"`
+	LatencyMs       float64        `db:"latency_ms"`
+	AppliedAt       time.Time      `db:"applied_at"`
+}
+
+// AuditFilter selects audit records; zero fields match every record and no
+// tables matches every table.
+type AuditFilter struct {
+	Tables     []string
+	PrimaryKey string
+	Operation  string
+	RunID      string
+	From       time.Time // applied at or after
+	To         time.Time // applied before
+	Limit      int
+	Offset     int
+}
+
+// ConflictExportFilter selects conflicts to export; zero fields match every
+// conflict and no tables matches every table.
+type ConflictExportFilter struct {
+	Tables   []string
+	Resolved *bool
+	From     time.Time // detected at or after
+	To       time.Time // detected before
+}
+
+// HistoryExportFilter selects runs to export; zero fields match every run.
+// A run matches Tables if it synced any of them.
+type HistoryExportFilter struct {
+	Tables []string
+	From   time.Time // started at or after
+	To     time.Time // started before
+}
+
+// ConflictPurgeFilter selects conflicts to delete: resolved ones resolved
+// before Before, and with Unresolved also unresolved ones detected before
+// it. No tables matches every table.
+type ConflictPurgeFilter struct {
+	Before     time.Time
+	Tables     []string
+	Unresolved bool
+}
+
+// SchemaVersion is a snapshot of a table's layout. Versions count up from 1
+// per table and a new one is stored whenever columns, types or keys change.
+type SchemaVersion struct {
+	TableName  string          `db:"table_name"`
+	Version    int             `db:"version"`
+	Columns    json.RawMessage `db:"columns"` // [{"name": ..., "type": ...}] in ordinal order
+	PrimaryKey json.RawMessage `db:"primary_key"`
+	Checksum   string          `db:"checksum"`
+	CreatedAt  time.Time       `db:"created_at"`
+}
+
+// Lease is held by one instance at a time, until ExpiresAt unless renewed.
+type Lease struct {
+	Name       string    `db:"name"`
+	Holder     string    `db:"holder"`
+	AcquiredAt time.Time `db:"acquired_at"` // when Holder took it over
+	RenewedAt  time.Time `db:"renewed_at"`
+	ExpiresAt  time.Time `db:"expires_at"`
+	// Address is where Holder's API is reached, for standbys to
+	// health-check it; empty if it doesn't advertise one
+	Address string `db:"address"`
+}
+
+// ResolutionIntent records a conflict resolution before it is applied. It
+// stays pending until both databases hold ResolvedData, the winning row;
+// null ResolvedData means the row is deleted on both.
+type ResolutionIntent struct {
+	ID           string          `db:"id"`
+	ConflictID   string          `db:"conflict_id"`
+	Strategy     string          `db:"strategy"`
+	ResolvedData json.RawMessage `db:"resolved_data"`
+	Status       string          `db:"status"` // pending, completed or rolled_back
+	LocalApplied bool            `db:"local_applied"`
+	CloudApplied bool            `db:"cloud_applied"`
+	ErrorMessage sql.NullString  `db:"error_message"`
+	CreatedAt    time.Time       `db:"created_at"`
+	CompletedAt  sql.NullTime    `db:"completed_at"`
+}
+
+// ConflictStatsRow counts the conflicts of one table and type detected on
+// one day, per resolution strategy.
+type ConflictStatsRow struct {
+	TableName    string
+	ConflictType string
+	Strategy     string    // "" for those still unresolved
+	Day          time.Time // start of the day, UTC
+	Conflicts    int
+	Resolved     int
+	// ResolutionSeconds is the total time the resolved ones took to resolve
+	ResolutionSeconds float64
+}
+
+// HeatmapCell counts the conflicts detected and events dead-lettered for a
+// table in one hour.
+type HeatmapCell struct {
+	TableName string    `db:"table_name"`
+	Hour      time.Time `db:"hour"` // start of the hour, UTC
+	Conflicts int       `db:"conflicts"`
+	Errors    int       `db:"errors"`
 }
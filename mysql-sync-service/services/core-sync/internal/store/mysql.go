@@ -3,28 +3,41 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
-	
+
 	_ "github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
 	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
 	"mysql-sync-service/internal/logger"
-	"go.uber.org/zap"
 )
 
 type MySQLStore struct {
-	db *sql.DB
+	db      *sql.DB
+	timeout time.Duration // of each query
 }
 
 func NewMySQLStore(cfg config.StateStorage) (*MySQLStore, error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true",
 		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Database)
-	
+
+	tlsParam, err := database.RegisterDriverTLS(fmt.Sprintf("state-%s-%d", cfg.Host, cfg.Port), cfg.TLS, cfg.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure tls: %w", err)
+	}
+	if tlsParam != "" {
+		dsn += "&tls=" + tlsParam
+	}
+
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open mysql connection: %w", err)
 	}
-	
+
 	// Retry loop for Ping
 	maxRetries := 30
 	for i := 0; i < maxRetries; i++ {
@@ -39,24 +52,39 @@ func NewMySQLStore(cfg config.StateStorage) (*MySQLStore, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to ping mysql after retries: %w", err)
 	}
-	
+
 	// Set connection pool settings
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
-	
-	return &MySQLStore{db: db}, nil
+	db.SetMaxOpenConns(cfg.GetMaxOpenConns())
+	db.SetMaxIdleConns(cfg.GetMaxIdleConns())
+	db.SetConnMaxLifetime(cfg.GetConnMaxLifetime())
+
+	return &MySQLStore{db: db, timeout: cfg.GetQueryTimeout()}, nil
+}
+
+// withTimeout bounds a query by the store's timeout, so a stalled state
+// database fails the caller instead of holding it.
+func (s *MySQLStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.timeout)
 }
 
 func (s *MySQLStore) Close() error {
 	return s.db.Close()
 }
 
+func (s *MySQLStore) Ping(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return s.db.PingContext(ctx)
+}
+
 func (s *MySQLStore) GetSyncState(ctx context.Context, tableName string) (*SyncState, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 	query := `SELECT table_name, last_sync_time, binlog_file, binlog_position, rows_synced, sync_direction, status, error_message, updated_at 
 			  FROM sync_state WHERE table_name = ?`
-	
+
 	row := s.db.QueryRowContext(ctx, query, tableName)
-	
+
 	var state SyncState
 	err := row.Scan(
 		&state.TableName,
@@ -69,18 +97,20 @@ func (s *MySQLStore) GetSyncState(ctx context.Context, tableName string) (*SyncS
 		&state.ErrorMessage,
 		&state.UpdatedAt,
 	)
-	
+
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	
+
 	return &state, nil
 }
 
 func (s *MySQLStore) UpdateSyncState(ctx context.Context, state *SyncState) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 	query := `INSERT INTO sync_state (table_name, last_sync_time, binlog_file, binlog_position, rows_synced, sync_direction, status, error_message, updated_at)
 			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW())
 			  ON DUPLICATE KEY UPDATE
@@ -92,7 +122,7 @@ func (s *MySQLStore) UpdateSyncState(ctx context.Context, state *SyncState) erro
 			  status = VALUES(status),
 			  error_message = VALUES(error_message),
 			  updated_at = NOW()`
-			  
+
 	_, err := s.db.ExecContext(ctx, query,
 		state.TableName,
 		state.LastSyncTime,
@@ -103,34 +133,62 @@ func (s *MySQLStore) UpdateSyncState(ctx context.Context, state *SyncState) erro
 		state.Status,
 		state.ErrorMessage,
 	)
-	
+
 	return err
 }
 
 func (s *MySQLStore) CreateConflict(ctx context.Context, conflict *Conflict) error {
-	query := `INSERT INTO conflicts (id, table_name, primary_key_value, local_data, cloud_data, conflict_type, detected_at, resolved)
-			  VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
-			  
-	_, err := s.db.ExecContext(ctx, query,
-		conflict.ID,
-		conflict.TableName,
-		conflict.PrimaryKeyValue,
-		conflict.LocalData,
-		conflict.CloudData,
-		conflict.ConflictType,
-		conflict.DetectedAt,
-		conflict.Resolved,
-	)
-	
+	return s.CreateConflicts(ctx, []*Conflict{conflict})
+}
+
+func (s *MySQLStore) CreateConflicts(ctx context.Context, conflicts []*Conflict) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO conflicts (id, table_name, primary_key_value, local_data, cloud_data, conflict_type, detected_at, resolved,
+			  binlog_file, binlog_position, gtid, event_type, event_before, event_after, source_site, source_host, source_server_uuid, schema_version)
+			  VALUES ` + strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?), ", len(conflicts)), ", ")
+
+	args := make([]interface{}, 0, 18*len(conflicts))
+	for _, conflict := range conflicts {
+		args = append(args,
+			conflict.ID,
+			conflict.TableName,
+			conflict.PrimaryKeyValue,
+			conflict.LocalData,
+			conflict.CloudData,
+			conflict.ConflictType,
+			conflict.DetectedAt,
+			conflict.Resolved,
+			conflict.BinlogFile,
+			conflict.BinlogPosition,
+			conflict.GTID,
+			conflict.EventType,
+			nullJSON(conflict.EventBefore),
+			nullJSON(conflict.EventAfter),
+			conflict.SourceSite,
+			conflict.SourceHost,
+			conflict.SourceServerUUID,
+			conflict.SchemaVersion,
+		)
+	}
+
+	_, err := s.db.ExecContext(ctx, query, args...)
 	return err
 }
 
 func (s *MySQLStore) GetConflict(ctx context.Context, id string) (*Conflict, error) {
-	query := `SELECT id, table_name, primary_key_value, local_data, cloud_data, conflict_type, detected_at, resolved, resolution_strategy, resolved_at, resolved_data
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	query := `SELECT id, table_name, primary_key_value, local_data, cloud_data, conflict_type, detected_at, resolved, resolution_strategy, resolved_at, resolved_data,
+			  binlog_file, binlog_position, gtid, event_type, event_before, event_after, source_site, source_host, source_server_uuid, schema_version, version
 			  FROM conflicts WHERE id = ?`
-			  
+
 	row := s.db.QueryRowContext(ctx, query, id)
-	
+
 	var c Conflict
 	err := row.Scan(
 		&c.ID,
@@ -144,28 +202,53 @@ func (s *MySQLStore) GetConflict(ctx context.Context, id string) (*Conflict, err
 		&c.ResolutionStrategy,
 		&c.ResolvedAt,
 		&c.ResolvedData,
+		&c.BinlogFile,
+		&c.BinlogPosition,
+		&c.GTID,
+		&c.EventType,
+		&c.EventBefore,
+		&c.EventAfter,
+		&c.SourceSite,
+		&c.SourceHost,
+		&c.SourceServerUUID,
+		&c.SchemaVersion,
+		&c.Version,
 	)
-	
+
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	
+
 	return &c, nil
 }
 
-func (s *MySQLStore) ListConflicts(ctx context.Context, resolved bool, limit, offset int) ([]*Conflict, error) {
-	query := `SELECT id, table_name, primary_key_value, local_data, cloud_data, conflict_type, detected_at, resolved, resolution_strategy, resolved_at, resolved_data
-			  FROM conflicts WHERE resolved = ? LIMIT ? OFFSET ?`
-			  
-	rows, err := s.db.QueryContext(ctx, query, resolved, limit, offset)
+func (s *MySQLStore) ListConflicts(ctx context.Context, resolved bool, tables []string, limit, offset int) ([]*Conflict, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	query := `SELECT id, table_name, primary_key_value, local_data, cloud_data, conflict_type, detected_at, resolved, resolution_strategy, resolved_at, resolved_data,
+			  binlog_file, binlog_position, gtid, event_type, event_before, event_after, source_site, source_host, source_server_uuid, schema_version, version
+			  FROM conflicts WHERE resolved = ?`
+	args := []interface{}{resolved}
+	if len(tables) > 0 {
+		query += " AND table_name IN (?" + strings.Repeat(", ?", len(tables)-1) + ")"
+		for _, table := range tables {
+			args = append(args, table)
+		}
+	}
+	// The order they were detected in; ids break ties so pages don't
+	// overlap, but are only time-ordered with some id schemes
+	query += " ORDER BY detected_at, id LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	
+
 	var conflicts []*Conflict
 	for rows.Next() {
 		var c Conflict
@@ -181,27 +264,594 @@ func (s *MySQLStore) ListConflicts(ctx context.Context, resolved bool, limit, of
 			&c.ResolutionStrategy,
 			&c.ResolvedAt,
 			&c.ResolvedData,
+			&c.BinlogFile,
+			&c.BinlogPosition,
+			&c.GTID,
+			&c.EventType,
+			&c.EventBefore,
+			&c.EventAfter,
+			&c.SourceSite,
+			&c.SourceHost,
+			&c.SourceServerUUID,
+			&c.SchemaVersion,
+			&c.Version,
 		)
 		if err != nil {
 			return nil, err
 		}
 		conflicts = append(conflicts, &c)
 	}
-	
+
 	return conflicts, nil
 }
 
+// ExportConflicts reads without the store's timeout: an export takes as
+// long as it takes to stream, until ctx ends.
+func (s *MySQLStore) ExportConflicts(ctx context.Context, filter ConflictExportFilter, fn func(*Conflict) error) error {
+	var conditions []string
+	var args []interface{}
+	if len(filter.Tables) > 0 {
+		conditions = append(conditions, "table_name IN (?"+strings.Repeat(", ?", len(filter.Tables)-1)+")")
+		for _, table := range filter.Tables {
+			args = append(args, table)
+		}
+	}
+	if filter.Resolved != nil {
+		conditions = append(conditions, "resolved = ?")
+		args = append(args, *filter.Resolved)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "detected_at >= ?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "detected_at < ?")
+		args = append(args, filter.To)
+	}
+
+	query := `SELECT id, table_name, primary_key_value, local_data, cloud_data, conflict_type, detected_at, resolved, resolution_strategy, resolved_at, resolved_data,
+			  binlog_file, binlog_position, gtid, event_type, event_before, event_after, source_site, source_host, source_server_uuid, schema_version, version
+			  FROM conflicts`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY detected_at, id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Conflict
+		err := rows.Scan(
+			&c.ID,
+			&c.TableName,
+			&c.PrimaryKeyValue,
+			&c.LocalData,
+			&c.CloudData,
+			&c.ConflictType,
+			&c.DetectedAt,
+			&c.Resolved,
+			&c.ResolutionStrategy,
+			&c.ResolvedAt,
+			&c.ResolvedData,
+			&c.BinlogFile,
+			&c.BinlogPosition,
+			&c.GTID,
+			&c.EventType,
+			&c.EventBefore,
+			&c.EventAfter,
+			&c.SourceSite,
+			&c.SourceHost,
+			&c.SourceServerUUID,
+			&c.SchemaVersion,
+			&c.Version,
+		)
+		if err != nil {
+			return err
+		}
+		if err := fn(&c); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 func (s *MySQLStore) ResolveConflict(ctx context.Context, id string, strategy string, resolvedData []byte) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 	query := `UPDATE conflicts SET resolved = TRUE, resolution_strategy = ?, resolved_data = ?, resolved_at = NOW() WHERE id = ?`
-	
+
 	_, err := s.db.ExecContext(ctx, query, strategy, resolvedData, id)
 	return err
 }
 
+func (s *MySQLStore) CountUnresolvedConflicts(ctx context.Context) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM conflicts WHERE resolved = FALSE`).Scan(&count)
+	return count, err
+}
+
+// ClaimConflict bumps the version of the intent's conflict and records the
+// intent, if the conflict is unresolved, still at version and not claimed
+// by a pending intent. It reports whether it did.
+func (s *MySQLStore) ClaimConflict(ctx context.Context, intent *ResolutionIntent, version int) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE conflicts SET version = version + 1
+		 WHERE id = ? AND version = ? AND resolved = FALSE
+		 AND NOT EXISTS (SELECT 1 FROM resolution_intents WHERE conflict_id = ? AND status = 'pending')`,
+		intent.ConflictID, version, intent.ConflictID)
+	if err != nil {
+		return false, err
+	}
+	if claimed, err := result.RowsAffected(); err != nil || claimed == 0 {
+		return false, err
+	}
+
+	query := `INSERT INTO resolution_intents (id, conflict_id, strategy, resolved_data, status, local_applied, cloud_applied, error_message, created_at, completed_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err = tx.ExecContext(ctx, query,
+		intent.ID,
+		intent.ConflictID,
+		intent.Strategy,
+		nullJSON(intent.ResolvedData),
+		intent.Status,
+		intent.LocalApplied,
+		intent.CloudApplied,
+		intent.ErrorMessage,
+		intent.CreatedAt,
+		intent.CompletedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (s *MySQLStore) UpdateResolutionIntent(ctx context.Context, intent *ResolutionIntent) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	query := `UPDATE resolution_intents SET status = ?, local_applied = ?, cloud_applied = ?, error_message = ?, completed_at = ? WHERE id = ?`
+
+	_, err := s.db.ExecContext(ctx, query,
+		intent.Status,
+		intent.LocalApplied,
+		intent.CloudApplied,
+		intent.ErrorMessage,
+		intent.CompletedAt,
+		intent.ID,
+	)
+	return err
+}
+
+func (s *MySQLStore) ListPendingResolutionIntents(ctx context.Context) ([]*ResolutionIntent, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	query := `SELECT id, conflict_id, strategy, resolved_data, status, local_applied, cloud_applied, error_message, created_at, completed_at
+			  FROM resolution_intents WHERE status = 'pending' ORDER BY created_at`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var intents []*ResolutionIntent
+	for rows.Next() {
+		var i ResolutionIntent
+		err := rows.Scan(
+			&i.ID,
+			&i.ConflictID,
+			&i.Strategy,
+			&i.ResolvedData,
+			&i.Status,
+			&i.LocalApplied,
+			&i.CloudApplied,
+			&i.ErrorMessage,
+			&i.CreatedAt,
+			&i.CompletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		intents = append(intents, &i)
+	}
+
+	return intents, rows.Err()
+}
+
+func (s *MySQLStore) CreateDeadLetter(ctx context.Context, deadLetter *DeadLetter) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	query := `INSERT INTO dead_letters (id, run_id, table_name, event_type, binlog_file, binlog_position, gtid, payload, error_message, created_at, schema_version)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := s.db.ExecContext(ctx, query,
+		deadLetter.ID,
+		deadLetter.RunID,
+		deadLetter.TableName,
+		deadLetter.EventType,
+		deadLetter.BinlogFile,
+		deadLetter.BinlogPosition,
+		deadLetter.GTID,
+		nullJSON(deadLetter.Payload),
+		deadLetter.ErrorMessage,
+		deadLetter.CreatedAt,
+		deadLetter.SchemaVersion,
+	)
+	return err
+}
+
+func (s *MySQLStore) ListDeadLetters(ctx context.Context, runID string, limit, offset int) ([]*DeadLetter, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	query := `SELECT id, run_id, table_name, event_type, binlog_file, binlog_position, gtid, payload, error_message, created_at, schema_version
+			  FROM dead_letters WHERE (? = '' OR run_id = ?) ORDER BY created_at DESC LIMIT ? OFFSET ?`
+
+	rows, err := s.db.QueryContext(ctx, query, runID, runID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deadLetters []*DeadLetter
+	for rows.Next() {
+		var d DeadLetter
+		err := rows.Scan(
+			&d.ID,
+			&d.RunID,
+			&d.TableName,
+			&d.EventType,
+			&d.BinlogFile,
+			&d.BinlogPosition,
+			&d.GTID,
+			&d.Payload,
+			&d.ErrorMessage,
+			&d.CreatedAt,
+			&d.SchemaVersion,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deadLetters = append(deadLetters, &d)
+	}
+
+	return deadLetters, rows.Err()
+}
+
+func (s *MySQLStore) CountDeadLetters(ctx context.Context, runID string) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM dead_letters WHERE (? = '' OR run_id = ?)`, runID, runID).Scan(&count)
+	return count, err
+}
+
+// auditInsertRows bounds the rows of one audit insert, well within the
+// placeholder limit.
+const auditInsertRows = 500
+
+func (s *MySQLStore) CreateAuditRecords(ctx context.Context, records []*AuditRecord) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	for len(records) > 0 {
+		chunk := records[:min(len(records), auditInsertRows)]
+		records = records[len(chunk):]
+
+		query := `INSERT INTO audit_log (id, run_id, table_name, primary_key_value, operation, before_hash, after_hash,
+				  binlog_file, binlog_position, gtid, worker, latency_ms, applied_at)
+				  VALUES ` + strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?), ", len(chunk)), ", ")
+		args := make([]interface{}, 0, 13*len(chunk))
+		for _, record := range chunk {
+			args = append(args,
+				record.ID,
+				record.RunID,
+				record.TableName,
+				record.PrimaryKeyValue,
+				record.Operation,
+				record.BeforeHash,
+				record.AfterHash,
+				record.BinlogFile,
+				record.BinlogPosition,
+				record.GTID,
+				record.Worker,
+				record.LatencyMs,
+				record.AppliedAt,
+			)
+		}
+		if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MySQLStore) ListAuditRecords(ctx context.Context, filter AuditFilter) ([]*AuditRecord, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var conditions []string
+	var args []interface{}
+	if len(filter.Tables) > 0 {
+		conditions = append(conditions, "table_name IN (?"+strings.Repeat(", ?", len(filter.Tables)-1)+")")
+		for _, table := range filter.Tables {
+			args = append(args, table)
+		}
+	}
+	for column, value := range map[string]string{"primary_key_value": filter.PrimaryKey, "operation": filter.Operation, "run_id": filter.RunID} {
+		if value != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "applied_at >= ?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "applied_at < ?")
+		args = append(args, filter.To)
+	}
+
+	query := `SELECT id, run_id, table_name, primary_key_value, operation, before_hash, after_hash,
+			  binlog_file, binlog_position, gtid, worker, latency_ms, applied_at FROM audit_log`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY applied_at DESC, id DESC LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*AuditRecord
+	for rows.Next() {
+		var a AuditRecord
+		err := rows.Scan(
+			&a.ID,
+			&a.RunID,
+			&a.TableName,
+			&a.PrimaryKeyValue,
+			&a.Operation,
+			&a.BeforeHash,
+			&a.AfterHash,
+			&a.BinlogFile,
+			&a.BinlogPosition,
+			&a.GTID,
+			&a.Worker,
+			&a.LatencyMs,
+			&a.AppliedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, &a)
+	}
+	return records, rows.Err()
+}
+
+func (s *MySQLStore) ConflictStats(ctx context.Context, from, to time.Time, tables []string) ([]*ConflictStatsRow, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	args := []interface{}{from, to}
+	var tableFilter string
+	if len(tables) > 0 {
+		tableFilter = " AND table_name IN (?" + strings.Repeat(", ?", len(tables)-1) + ")"
+		for _, table := range tables {
+			args = append(args, table)
+		}
+	}
+	// Days since the epoch don't depend on the session time zone
+	query := `SELECT table_name, COALESCE(conflict_type, ''), COALESCE(resolution_strategy, ''),
+			  FLOOR(UNIX_TIMESTAMP(detected_at) / 86400) AS day, COUNT(*), COALESCE(SUM(resolved), 0),
+			  COALESCE(SUM(CASE WHEN resolved THEN TIMESTAMPDIFF(SECOND, detected_at, resolved_at) END), 0)
+			  FROM conflicts WHERE detected_at >= ? AND detected_at < ?` + tableFilter + `
+			  GROUP BY table_name, conflict_type, resolution_strategy, day
+			  ORDER BY day, table_name`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*ConflictStatsRow
+	for rows.Next() {
+		var row ConflictStatsRow
+		var day int64
+		if err := rows.Scan(&row.TableName, &row.ConflictType, &row.Strategy, &day, &row.Conflicts, &row.Resolved, &row.ResolutionSeconds); err != nil {
+			return nil, err
+		}
+		row.Day = time.Unix(day*86400, 0).UTC()
+		stats = append(stats, &row)
+	}
+	return stats, rows.Err()
+}
+
+func (s *MySQLStore) Heatmap(ctx context.Context, from, to time.Time, tables []string) ([]*HeatmapCell, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var tableFilter string
+	if len(tables) > 0 {
+		tableFilter = " AND table_name IN (?" + strings.Repeat(", ?", len(tables)-1) + ")"
+	}
+	// Hours since the epoch don't depend on the session time zone
+	query := `SELECT table_name, FLOOR(UNIX_TIMESTAMP(detected_at) / 3600) AS hour, COUNT(*), 0
+			  FROM conflicts WHERE detected_at >= ? AND detected_at < ?` + tableFilter + `
+			  GROUP BY table_name, hour
+			  UNION ALL
+			  SELECT table_name, FLOOR(UNIX_TIMESTAMP(created_at) / 3600) AS hour, 0, COUNT(*)
+			  FROM dead_letters WHERE created_at >= ? AND created_at < ?` + tableFilter + `
+			  GROUP BY table_name, hour`
+
+	var args []interface{}
+	for i := 0; i < 2; i++ {
+		args = append(args, from, to)
+		for _, table := range tables {
+			args = append(args, table)
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type cellKey struct {
+		table string
+		hour  int64
+	}
+	index := make(map[cellKey]*HeatmapCell)
+	var cells []*HeatmapCell
+	for rows.Next() {
+		var (
+			table             string
+			hour              int64
+			conflicts, errors int
+		)
+		if err := rows.Scan(&table, &hour, &conflicts, &errors); err != nil {
+			return nil, err
+		}
+		key := cellKey{table, hour}
+		cell, ok := index[key]
+		if !ok {
+			cell = &HeatmapCell{TableName: table, Hour: time.Unix(hour*3600, 0).UTC()}
+			index[key] = cell
+			cells = append(cells, cell)
+		}
+		cell.Conflicts += conflicts
+		cell.Errors += errors
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(cells, func(i, j int) bool {
+		if !cells[i].Hour.Equal(cells[j].Hour) {
+			return cells[i].Hour.Before(cells[j].Hour)
+		}
+		return cells[i].TableName < cells[j].TableName
+	})
+	return cells, nil
+}
+
+func (s *MySQLStore) CreateSchemaVersion(ctx context.Context, version *SchemaVersion) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var latest int
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_versions WHERE table_name = ? FOR UPDATE`,
+		version.TableName).Scan(&latest)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO schema_versions (table_name, version, columns, primary_key, checksum, created_at)
+			  VALUES (?, ?, ?, ?, ?, ?)`
+
+	_, err = tx.ExecContext(ctx, query,
+		version.TableName,
+		latest+1,
+		nullJSON(version.Columns),
+		nullJSON(version.PrimaryKey),
+		version.Checksum,
+		version.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	version.Version = latest + 1
+	return nil
+}
+
+func (s *MySQLStore) GetLatestSchemaVersion(ctx context.Context, tableName string) (*SchemaVersion, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	query := `SELECT table_name, version, columns, primary_key, checksum, created_at
+			  FROM schema_versions WHERE table_name = ? ORDER BY version DESC LIMIT 1`
+
+	var v SchemaVersion
+	err := s.db.QueryRowContext(ctx, query, tableName).Scan(
+		&v.TableName,
+		&v.Version,
+		&v.Columns,
+		&v.PrimaryKey,
+		&v.Checksum,
+		&v.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+func (s *MySQLStore) ListSchemaVersions(ctx context.Context, tableName string) ([]*SchemaVersion, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	query := `SELECT table_name, version, columns, primary_key, checksum, created_at
+			  FROM schema_versions WHERE table_name = ? ORDER BY version DESC`
+
+	rows, err := s.db.QueryContext(ctx, query, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*SchemaVersion
+	for rows.Next() {
+		var v SchemaVersion
+		err := rows.Scan(
+			&v.TableName,
+			&v.Version,
+			&v.Columns,
+			&v.PrimaryKey,
+			&v.Checksum,
+			&v.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, &v)
+	}
+
+	return versions, rows.Err()
+}
+
 func (s *MySQLStore) CreateSyncHistory(ctx context.Context, history *SyncHistory) error {
-	query := `INSERT INTO sync_history (id, started_at, completed_at, direction, tables_synced, total_rows, conflicts_detected, status, error_message)
-			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
-			  
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	query := `INSERT INTO sync_history (id, started_at, completed_at, direction, tables_synced, total_rows, conflicts_detected, status, error_message, trigger_type)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
 	_, err := s.db.ExecContext(ctx, query,
 		history.ID,
 		history.StartedAt,
@@ -212,36 +862,144 @@ func (s *MySQLStore) CreateSyncHistory(ctx context.Context, history *SyncHistory
 		history.ConflictsDetected,
 		history.Status,
 		history.ErrorMessage,
+		history.Trigger,
 	)
-	
+
 	return err
 }
 
 func (s *MySQLStore) UpdateSyncHistory(ctx context.Context, history *SyncHistory) error {
-	query := `UPDATE sync_history SET completed_at = ?, total_rows = ?, conflicts_detected = ?, status = ?, error_message = ? WHERE id = ?`
-	
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	query := `UPDATE sync_history SET completed_at = ?, total_rows = ?, conflicts_detected = ?, status = ?, error_message = ?, shutdown_report = ? WHERE id = ?`
+
 	_, err := s.db.ExecContext(ctx, query,
 		history.CompletedAt,
 		history.TotalRows,
 		history.ConflictsDetected,
 		history.Status,
 		history.ErrorMessage,
+		nullJSON(history.ShutdownReport),
 		history.ID,
 	)
-	
+
 	return err
 }
 
-func (s *MySQLStore) GetSyncHistory(ctx context.Context, limit, offset int) ([]*SyncHistory, error) {
-	query := `SELECT id, started_at, completed_at, direction, tables_synced, total_rows, conflicts_detected, status, error_message
-			  FROM sync_history ORDER BY started_at DESC LIMIT ? OFFSET ?`
-			  
-	rows, err := s.db.QueryContext(ctx, query, limit, offset)
+// purgeBatchSize is how many rows a purge deletes per statement, keeping
+// locks short on a store that is being written to.
+const purgeBatchSize = 1000
+
+func (s *MySQLStore) PurgeConflicts(ctx context.Context, filter ConflictPurgeFilter) (int64, error) {
+	// Conflicts being resolved, with a pending intent, are left alone
+	query := `SELECT id FROM conflicts c
+			  WHERE ((c.resolved = TRUE AND c.resolved_at < ?) OR (? AND c.resolved = FALSE AND c.detected_at < ?))
+			  AND NOT EXISTS (SELECT 1 FROM resolution_intents i WHERE i.conflict_id = c.id AND i.status = 'pending')`
+	args := []interface{}{filter.Before, filter.Unresolved, filter.Before}
+	if len(filter.Tables) > 0 {
+		query += " AND c.table_name IN (?" + strings.Repeat(", ?", len(filter.Tables)-1) + ")"
+		for _, table := range filter.Tables {
+			args = append(args, table)
+		}
+	}
+	query += " LIMIT " + fmt.Sprint(purgeBatchSize)
+
+	var purged int64
+	for {
+		n, err := s.purgeConflictBatch(ctx, query, args)
+		purged += n
+		if err != nil || n < purgeBatchSize {
+			return purged, err
+		}
+	}
+}
+
+func (s *MySQLStore) purgeConflictBatch(ctx context.Context, query string, args []interface{}) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	var ids []interface{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	in := "(?" + strings.Repeat(", ?", len(ids)-1) + ")"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM resolution_intents WHERE status <> 'pending' AND conflict_id IN `+in, ids...); err != nil {
+		return 0, err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM conflicts WHERE id IN `+in, ids...)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *MySQLStore) PurgeSyncHistory(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	for {
+		n, err := s.purgeHistoryBatch(ctx, before)
+		purged += n
+		if err != nil || n < purgeBatchSize {
+			return purged, err
+		}
+	}
+}
+
+func (s *MySQLStore) purgeHistoryBatch(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM sync_history WHERE started_at < ? AND completed_at IS NOT NULL LIMIT `+fmt.Sprint(purgeBatchSize), before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *MySQLStore) GetSyncHistory(ctx context.Context, tables []string, limit, offset int) ([]*SyncHistory, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	query := `SELECT id, started_at, completed_at, direction, tables_synced, total_rows, conflicts_detected, status, error_message, trigger_type, shutdown_report
+			  FROM sync_history`
+	var args []interface{}
+	if len(tables) > 0 {
+		condition, tableArgs := historyTablesCondition(tables)
+		query += " WHERE " + condition
+		args = append(args, tableArgs...)
+	}
+	query += " ORDER BY started_at DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	
+
 	var history []*SyncHistory
 	for rows.Next() {
 		var h SyncHistory
@@ -255,12 +1013,226 @@ func (s *MySQLStore) GetSyncHistory(ctx context.Context, limit, offset int) ([]*
 			&h.ConflictsDetected,
 			&h.Status,
 			&h.ErrorMessage,
+			&h.Trigger,
+			&h.ShutdownReport,
 		)
 		if err != nil {
 			return nil, err
 		}
 		history = append(history, &h)
 	}
-	
+
 	return history, nil
 }
+
+// historyTablesCondition matches runs that synced any of tables.
+func historyTablesCondition(tables []string) (string, []interface{}) {
+	matches := make([]string, len(tables))
+	args := make([]interface{}, len(tables))
+	for i, table := range tables {
+		matches[i] = "FIND_IN_SET(?, tables_synced) > 0"
+		args[i] = table
+	}
+	return "(" + strings.Join(matches, " OR ") + ")", args
+}
+
+// ExportSyncHistory reads without the store's timeout, as ExportConflicts.
+func (s *MySQLStore) ExportSyncHistory(ctx context.Context, filter HistoryExportFilter, fn func(*SyncHistory) error) error {
+	var conditions []string
+	var args []interface{}
+	if len(filter.Tables) > 0 {
+		condition, tableArgs := historyTablesCondition(filter.Tables)
+		conditions = append(conditions, condition)
+		args = append(args, tableArgs...)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "started_at >= ?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "started_at < ?")
+		args = append(args, filter.To)
+	}
+
+	query := `SELECT id, started_at, completed_at, direction, tables_synced, total_rows, conflicts_detected, status, error_message, trigger_type, shutdown_report
+			  FROM sync_history`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY started_at, id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h SyncHistory
+		err := rows.Scan(
+			&h.ID,
+			&h.StartedAt,
+			&h.CompletedAt,
+			&h.Direction,
+			&h.TablesSynced,
+			&h.TotalRows,
+			&h.ConflictsDetected,
+			&h.Status,
+			&h.ErrorMessage,
+			&h.Trigger,
+			&h.ShutdownReport,
+		)
+		if err != nil {
+			return err
+		}
+		if err := fn(&h); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *MySQLStore) GetSetting(ctx context.Context, name string) (string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var value sql.NullString
+	err := s.db.QueryRowContext(ctx, `SELECT value FROM settings WHERE name = ?`, name).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value.String, err
+}
+
+func (s *MySQLStore) SetSetting(ctx context.Context, name, value string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	query := `INSERT INTO settings (name, value) VALUES (?, ?)
+			  ON DUPLICATE KEY UPDATE value = VALUES(value)`
+
+	_, err := s.db.ExecContext(ctx, query, name, value)
+	return err
+}
+
+func (s *MySQLStore) ClaimServerID(ctx context.Context, source string, serverID uint32, owner string) (string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var holder string
+	err = tx.QueryRowContext(ctx, `SELECT owner FROM server_ids WHERE source = ? AND server_id = ? FOR UPDATE`, source, serverID).Scan(&holder)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return "", err
+	case holder != owner:
+		return holder, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM server_ids WHERE source = ? AND owner = ? AND server_id <> ?`, source, owner, serverID); err != nil {
+		return "", err
+	}
+	query := `INSERT INTO server_ids (source, server_id, owner, claimed_at) VALUES (?, ?, ?, ?)
+			  ON DUPLICATE KEY UPDATE claimed_at = VALUES(claimed_at)`
+	if _, err := tx.ExecContext(ctx, query, source, serverID, owner, time.Now()); err != nil {
+		return "", err
+	}
+	return owner, tx.Commit()
+}
+
+func (s *MySQLStore) GetServerID(ctx context.Context, source, owner string) (uint32, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var serverID uint32
+	err := s.db.QueryRowContext(ctx, `SELECT server_id FROM server_ids WHERE source = ? AND owner = ?`, source, owner).Scan(&serverID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return serverID, err
+}
+
+func (s *MySQLStore) AcquireLease(ctx context.Context, name, holder, address string, ttl time.Duration) (*Lease, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var current string
+	var expired bool
+	err = tx.QueryRowContext(ctx, `SELECT holder, expires_at <= NOW(6) FROM leases WHERE name = ? FOR UPDATE`, name).Scan(&current, &expired)
+	switch {
+	case err == sql.ErrNoRows:
+		query := `INSERT INTO leases (name, holder, acquired_at, renewed_at, expires_at, address)
+				  VALUES (?, ?, NOW(6), NOW(6), NOW(6) + INTERVAL ? MICROSECOND, ?)`
+		if _, err := tx.ExecContext(ctx, query, name, holder, ttl.Microseconds(), address); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case current == holder || expired:
+		// acquired_at is set before holder changes, as MySQL assigns in order
+		query := `UPDATE leases SET acquired_at = IF(holder = ?, acquired_at, NOW(6)), holder = ?,
+				  renewed_at = NOW(6), expires_at = NOW(6) + INTERVAL ? MICROSECOND, address = ? WHERE name = ?`
+		if _, err := tx.ExecContext(ctx, query, holder, holder, ttl.Microseconds(), address, name); err != nil {
+			return nil, err
+		}
+	}
+
+	lease, err := scanLease(tx.QueryRowContext(ctx, leaseQuery, name))
+	if err != nil {
+		return nil, err
+	}
+	return lease, tx.Commit()
+}
+
+func (s *MySQLStore) TakeLease(ctx context.Context, name, holder, address, from string, ttl time.Duration) (*Lease, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	query := `UPDATE leases SET acquired_at = NOW(6), holder = ?, renewed_at = NOW(6),
+			  expires_at = NOW(6) + INTERVAL ? MICROSECOND, address = ? WHERE name = ? AND holder = ?`
+	if _, err := s.db.ExecContext(ctx, query, holder, ttl.Microseconds(), address, name, from); err != nil {
+		return nil, err
+	}
+	return scanLease(s.db.QueryRowContext(ctx, leaseQuery, name))
+}
+
+func (s *MySQLStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM leases WHERE name = ? AND holder = ?`, name, holder)
+	return err
+}
+
+func (s *MySQLStore) GetLease(ctx context.Context, name string) (*Lease, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	lease, err := scanLease(s.db.QueryRowContext(ctx, leaseQuery, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return lease, err
+}
+
+const leaseQuery = `SELECT name, holder, acquired_at, renewed_at, expires_at, COALESCE(address, '') FROM leases WHERE name = ?`
+
+func scanLease(row *sql.Row) (*Lease, error) {
+	lease := &Lease{}
+	if err := row.Scan(&lease.Name, &lease.Holder, &lease.AcquiredAt, &lease.RenewedAt, &lease.ExpiresAt, &lease.Address); err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// nullJSON maps an empty payload to SQL NULL; MySQL rejects ” in JSON columns.
+func nullJSON(data json.RawMessage) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return []byte(data)
+}
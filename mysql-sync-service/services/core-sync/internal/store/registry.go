@@ -0,0 +1,65 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"mysql-sync-service/internal/config"
+)
+
+// BackendMySQL is the built-in state store, used when state_storage.type
+// is not set.
+const BackendMySQL = "mysql"
+
+// Factory opens a state store from its config. Backend specific settings
+// are in cfg.Options.
+type Factory func(cfg config.StateStorage) (Store, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{
+		BackendMySQL: func(cfg config.StateStorage) (Store, error) { return NewMySQLStore(cfg) },
+	}
+)
+
+// Register makes a state store backend available as a state_storage.type,
+// so a build embedding the service can keep its state elsewhere without
+// changing this package. It panics if the name is taken, as registration
+// happens at init.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic("store: backend " + name + " registered twice")
+	}
+	factories[name] = factory
+}
+
+// Backends lists the registered backends by name.
+func Backends() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewStore opens the backend cfg.Type names.
+func NewStore(cfg config.StateStorage) (Store, error) {
+	backend := cfg.Type
+	if backend == "" {
+		backend = BackendMySQL
+	}
+	factoriesMu.RLock()
+	factory, ok := factories[backend]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown state storage type %q, registered: %s", backend, strings.Join(Backends(), ", "))
+	}
+	return factory(cfg)
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/metrics"
+)
+
+// flushTimeout bounds one flush of held checkpoints.
+const flushTimeout = 30 * time.Second
+
+// WriteBehind keeps sync states, the checkpoint written after every batch,
+// in memory and writes each table's latest to the backing store every
+// interval, so checkpointing at high event rates costs one write per table
+// per interval rather than one per batch. Everything else goes straight
+// to the backing store.
+//
+// A crash loses the checkpoints of the last interval at most; the next
+// run resumes from the last flushed ones and reapplies what came after.
+type WriteBehind struct {
+	Store
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*SyncState // by table, not yet flushed
+
+	// flushMu keeps flushes from overlapping, so an older state can't
+	// overwrite a newer one
+	flushMu sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewWriteBehind wraps backing, flushing held sync states every interval
+// until Close.
+func NewWriteBehind(backing Store, interval time.Duration) *WriteBehind {
+	w := &WriteBehind{
+		Store:    backing,
+		interval: interval,
+		pending:  make(map[string]*SyncState),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// UpdateSyncState holds state until the next flush, replacing any held
+// for the table. It never fails.
+func (w *WriteBehind) UpdateSyncState(ctx context.Context, state *SyncState) error {
+	held := *state
+	w.mu.Lock()
+	w.pending[state.TableName] = &held
+	metrics.CheckpointsHeld.Set(float64(len(w.pending)))
+	w.mu.Unlock()
+	return nil
+}
+
+// GetSyncState returns the held state of the table, if one is waiting,
+// else the backing store's.
+func (w *WriteBehind) GetSyncState(ctx context.Context, tableName string) (*SyncState, error) {
+	w.mu.Lock()
+	held, ok := w.pending[tableName]
+	w.mu.Unlock()
+	if ok {
+		state := *held
+		return &state, nil
+	}
+	return w.Store.GetSyncState(ctx, tableName)
+}
+
+// Flush writes the held sync states to the backing store. States that
+// fail to write are held again, unless a newer one has replaced them.
+func (w *WriteBehind) Flush(ctx context.Context) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	states := w.pending
+	w.pending = make(map[string]*SyncState)
+	w.mu.Unlock()
+
+	var firstErr error
+	for table, state := range states {
+		err := w.Store.UpdateSyncState(ctx, state)
+		if err == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		w.mu.Lock()
+		if _, newer := w.pending[table]; !newer {
+			w.pending[table] = state
+		}
+		w.mu.Unlock()
+	}
+
+	w.mu.Lock()
+	metrics.CheckpointsHeld.Set(float64(len(w.pending)))
+	w.mu.Unlock()
+	return firstErr
+}
+
+func (w *WriteBehind) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+			if err := w.Flush(ctx); err != nil {
+				logger.Log.Warn("Failed to flush checkpoints to the state store, retrying", zap.Error(err))
+			}
+			cancel()
+		}
+	}
+}
+
+// Close flushes the held sync states and closes the backing store.
+func (w *WriteBehind) Close() error {
+	close(w.stop)
+	<-w.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	if err := w.Flush(ctx); err != nil {
+		logger.Log.Error("Failed to flush checkpoints on close; the next run resumes from older ones", zap.Error(err))
+	}
+	return w.Store.Close()
+}
@@ -0,0 +1,139 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/alerting"
+	"mysql-sync-service/internal/logger"
+)
+
+// SetAlerter attaches the alerting subsystem: lag transitions, apply
+// failures and the periodic backlog/state store checks report through it.
+func (m *Manager) SetAlerter(alerts *alerting.Manager) {
+	if alerts == nil {
+		return
+	}
+
+	m.mu.Lock()
+	m.alerts = alerts
+	m.lagAlert = m.fireLagAlert
+	m.mu.Unlock()
+	m.conflicts.SetAlerter(alerts)
+
+	go m.runAlertChecks(alerts.Config().GetCheckInterval())
+}
+
+func (m *Manager) fireLagAlert(table string, lag, threshold time.Duration, lagging bool) {
+	alert := alerting.Alert{
+		Kind:     alerting.KindReplicationLag,
+		Severity: alerting.SeverityWarning,
+		Subject:  table,
+		Title:    fmt.Sprintf("Replication lag on %s", table),
+		Message:  fmt.Sprintf("Lag is %s (threshold %s)", lag.Round(time.Second), threshold),
+		Fields:   map[string]string{"table": table},
+		Resolved: !lagging,
+	}
+	if !lagging {
+		alert.Severity = alerting.SeverityInfo
+		alert.Message = fmt.Sprintf("Lag is back to %s", lag.Round(time.Second))
+	}
+	m.alerts.Fire(alert)
+}
+
+func (m *Manager) runAlertChecks(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	storeDown := false
+	backlogHigh := false
+	dlqHigh := false
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
+
+		if err := m.store.Ping(ctx); err != nil {
+			if !storeDown {
+				logger.Log.Error("State store unavailable", zap.Error(err))
+			}
+			storeDown = true
+			m.alerts.Fire(alerting.Alert{
+				Kind:     alerting.KindStateStoreDown,
+				Severity: alerting.SeverityCritical,
+				Title:    "State store unavailable",
+				Message:  err.Error(),
+			})
+			cancel()
+			continue
+		} else if storeDown {
+			storeDown = false
+			m.alerts.Fire(alerting.Alert{
+				Kind:     alerting.KindStateStoreDown,
+				Severity: alerting.SeverityInfo,
+				Title:    "State store reachable again",
+				Resolved: true,
+			})
+		}
+
+		threshold := m.alerts.Config().ConflictBacklogThreshold
+		if threshold > 0 {
+			count, err := m.store.CountUnresolvedConflicts(ctx)
+			if err != nil {
+				logger.Log.Warn("Failed to count unresolved conflicts", zap.Error(err))
+			} else if count > threshold {
+				backlogHigh = true
+				m.alerts.Fire(alerting.Alert{
+					Kind:     alerting.KindConflictBacklog,
+					Severity: alerting.SeverityWarning,
+					Title:    "Conflict backlog above threshold",
+					Message:  fmt.Sprintf("%d unresolved conflicts (threshold %d)", count, threshold),
+				})
+			} else if backlogHigh {
+				backlogHigh = false
+				m.alerts.Fire(alerting.Alert{
+					Kind:     alerting.KindConflictBacklog,
+					Severity: alerting.SeverityInfo,
+					Title:    "Conflict backlog back under threshold",
+					Message:  fmt.Sprintf("%d unresolved conflicts", count),
+					Resolved: true,
+				})
+			}
+		}
+
+		dlqThreshold := m.alerts.Config().DLQThreshold
+		if dlqThreshold > 0 {
+			count, err := m.store.CountDeadLetters(ctx, "")
+			if err != nil {
+				logger.Log.Warn("Failed to count dead letters", zap.Error(err))
+			} else if count > dlqThreshold {
+				dlqHigh = true
+				m.alerts.Fire(alerting.Alert{
+					Kind:     alerting.KindDLQGrowth,
+					Severity: alerting.SeverityWarning,
+					Title:    "Dead letters above threshold",
+					Message:  fmt.Sprintf("%d dead letters (threshold %d)", count, dlqThreshold),
+				})
+			} else if dlqHigh {
+				dlqHigh = false
+				m.alerts.Fire(alerting.Alert{
+					Kind:     alerting.KindDLQGrowth,
+					Severity: alerting.SeverityInfo,
+					Title:    "Dead letters back under threshold",
+					Message:  fmt.Sprintf("%d dead letters", count),
+					Resolved: true,
+				})
+			}
+		}
+
+		cancel()
+	}
+}
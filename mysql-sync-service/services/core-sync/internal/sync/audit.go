@@ -0,0 +1,480 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/ids"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/metrics"
+	"mysql-sync-service/internal/store"
+)
+
+// Audit log destinations for AuditConfig.Type
+const (
+	AuditFile  = "file"
+	AuditTable = "table"
+)
+
+const (
+	auditQueueBatches = 1024
+	auditRetry        = 5 * time.Second
+	auditCloseTimeout = 10 * time.Second
+)
+
+// ErrAuditDisabled is returned when querying the audit log while it is off.
+var ErrAuditDisabled = errors.New("audit log is not enabled")
+
+// AuditEntry is a row change applied to the target. The row images before
+// and after it are recorded as SHA-256 hashes of their JSON form.
+type AuditEntry struct {
+	ID         string    `json:"id"`
+	RunID      string    `json:"run_id"`
+	Table      string    `json:"table"`
+	PrimaryKey string    `json:"primary_key"`
+	Operation  string    `json:"operation"`
+	BeforeHash string    `json:"before_hash,omitempty"`
+	AfterHash  string    `json:"after_hash,omitempty"`
+	BinlogFile string    `json:"binlog_file,omitempty"`
+	BinlogPos  uint32    `json:"binlog_pos,omitempty"`
+	GTID       string    `json:"gtid,omitempty"`
+	Worker     int       `json:"worker"`
+	LatencyMs  float64   `json:"latency_ms"` // of the batch the change was applied in
+	AppliedAt  time.Time `json:"applied_at"`
+}
+
+// auditWriter is where audit entries are kept.
+type auditWriter interface {
+	Write(ctx context.Context, entries []AuditEntry) error
+	// Query returns the entries filter selects, newest first
+	Query(ctx context.Context, filter store.AuditFilter) ([]AuditEntry, error)
+	Close() error
+}
+
+// auditor writes the audit log in the background, in the order batches
+// were applied. A failed write is retried until it succeeds: once the
+// queue is full, workers wait rather than leave changes unaudited.
+type auditor struct {
+	writer  auditWriter
+	batches chan []AuditEntry
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newAuditor(cfg config.AuditConfig, s store.Store) (*auditor, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	var writer auditWriter
+	switch cfg.Type {
+	case "", AuditFile:
+		fileWriter, err := newFileAuditWriter(cfg.GetPath(), cfg.GetMaxFileBytes(), cfg.GetMaxFiles())
+		if err != nil {
+			return nil, err
+		}
+		writer = fileWriter
+	case AuditTable:
+		writer = &storeAuditWriter{store: s}
+	default:
+		return nil, fmt.Errorf("unknown audit type %q", cfg.Type)
+	}
+
+	a := &auditor{
+		writer:  writer,
+		batches: make(chan []AuditEntry, auditQueueBatches),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a, nil
+}
+
+// record queues the audit entries of events, applied by worker in one
+// batch that took latency.
+func (a *auditor) record(ctx context.Context, runID string, worker int, events []BinlogEvent, latency time.Duration) {
+	if a == nil {
+		return
+	}
+	entries := auditEntries(runID, worker, events, latency, time.Now())
+	if len(entries) == 0 {
+		return
+	}
+	select {
+	case a.batches <- entries:
+	case <-a.done:
+	case <-ctx.Done():
+		logger.Log.Warn("Audit entries not recorded, sync stopping", zap.String("run_id", runID), zap.Int("entries", len(entries)))
+	}
+}
+
+func (a *auditor) run() {
+	defer close(a.done)
+	for {
+		select {
+		case entries := <-a.batches:
+			a.write(entries)
+		case <-a.stop:
+			// Write what is queued, then stop
+			for {
+				select {
+				case entries := <-a.batches:
+					a.write(entries)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write keeps trying entries, together with whatever else is queued, until
+// they are written or the auditor is closing.
+func (a *auditor) write(entries []AuditEntry) {
+	for {
+		select {
+		case more := <-a.batches:
+			entries = append(entries, more...)
+			continue
+		default:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), auditRetry)
+		err := a.writer.Write(ctx, entries)
+		cancel()
+		if err == nil {
+			return
+		}
+		metrics.AuditWriteFailures.Inc()
+		logger.Log.Error("Failed to write audit log, retrying", zap.Int("entries", len(entries)), zap.Error(err))
+		select {
+		case <-time.After(auditRetry):
+		case <-a.stop:
+			logger.Log.Error("Audit entries lost on shutdown", zap.Int("entries", len(entries)))
+			return
+		}
+	}
+}
+
+// Query returns the audit entries filter selects, newest first.
+func (a *auditor) Query(ctx context.Context, filter store.AuditFilter) ([]AuditEntry, error) {
+	if a == nil {
+		return nil, ErrAuditDisabled
+	}
+	return a.writer.Query(ctx, filter)
+}
+
+// Close writes what is queued, for up to auditCloseTimeout, and closes the
+// writer.
+func (a *auditor) Close() {
+	if a == nil {
+		return
+	}
+	close(a.stop)
+	select {
+	case <-a.done:
+	case <-time.After(auditCloseTimeout):
+		logger.Log.Warn("Audit log did not flush in time")
+	}
+	if err := a.writer.Close(); err != nil {
+		logger.Log.Warn("Failed to close audit log", zap.Error(err))
+	}
+}
+
+// auditEntries lists the row changes of events, with the key each row was
+// logged under and hashes of its images.
+func auditEntries(runID string, worker int, events []BinlogEvent, latency time.Duration, appliedAt time.Time) []AuditEntry {
+	var entries []AuditEntry
+	for _, e := range events {
+		if e.Type == Group {
+			entries = append(entries, auditEntries(runID, worker, e.Members, latency, appliedAt)...)
+			continue
+		}
+		for i, row := range e.Rows {
+			entry := AuditEntry{
+				ID:         ids.New(),
+				RunID:      runID,
+				Table:      e.Table,
+				Operation:  string(e.Type),
+				BinlogFile: e.BinlogFile,
+				BinlogPos:  e.BinlogPos,
+				GTID:       e.GTID,
+				Worker:     worker,
+				LatencyMs:  float64(latency.Microseconds()) / 1000,
+				AppliedAt:  appliedAt,
+			}
+			if i < len(e.PrimaryKeys) {
+				entry.PrimaryKey = e.PrimaryKeys[i]
+			}
+			switch e.Type {
+			case Insert:
+				entry.AfterHash = rowHash(e, row)
+			case Update:
+				if i < len(e.Before) {
+					entry.BeforeHash = rowHash(e, e.Before[i])
+				}
+				entry.AfterHash = rowHash(e, row)
+			case Delete:
+				entry.BeforeHash = rowHash(e, row)
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Audit queries the audit log of applied changes, newest first.
+func (m *Manager) Audit(ctx context.Context, filter store.AuditFilter) ([]AuditEntry, error) {
+	return m.audit.Query(ctx, filter)
+}
+
+// storeAuditWriter keeps the audit log in the state store.
+type storeAuditWriter struct {
+	store store.Store
+}
+
+func (w *storeAuditWriter) Write(ctx context.Context, entries []AuditEntry) error {
+	records := make([]*store.AuditRecord, len(entries))
+	for i, entry := range entries {
+		records[i] = &store.AuditRecord{
+			ID:              entry.ID,
+			RunID:           entry.RunID,
+			TableName:       entry.Table,
+			PrimaryKeyValue: entry.PrimaryKey,
+			Operation:       entry.Operation,
+			BeforeHash:      sql.NullString{String: entry.BeforeHash, Valid: entry.BeforeHash != ""},
+			AfterHash:       sql.NullString{String: entry.AfterHash, Valid: entry.AfterHash != ""},
+			BinlogFile:      sql.NullString{String: entry.BinlogFile, Valid: entry.BinlogFile != ""},
+			BinlogPosition:  sql.NullInt64{Int64: int64(entry.BinlogPos), Valid: entry.BinlogFile != ""},
+			GTID:            sql.NullString{String: entry.GTID, Valid: entry.GTID != ""},
+			Worker:          entry.Worker,
+			LatencyMs:       entry.LatencyMs,
+			AppliedAt:       entry.AppliedAt,
+		}
+	}
+	return w.store.CreateAuditRecords(ctx, records)
+}
+
+func (w *storeAuditWriter) Query(ctx context.Context, filter store.AuditFilter) ([]AuditEntry, error) {
+	records, err := w.store.ListAuditRecords(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]AuditEntry, len(records))
+	for i, record := range records {
+		entries[i] = AuditEntry{
+			ID:         record.ID,
+			RunID:      record.RunID,
+			Table:      record.TableName,
+			PrimaryKey: record.PrimaryKeyValue,
+			Operation:  record.Operation,
+			BeforeHash: record.BeforeHash.String,
+			AfterHash:  record.AfterHash.String,
+			BinlogFile: record.BinlogFile.String,
+			BinlogPos:  uint32(record.BinlogPosition.Int64),
+			GTID:       record.GTID.String,
+			Worker:     record.Worker,
+			LatencyMs:  record.LatencyMs,
+			AppliedAt:  record.AppliedAt,
+		}
+	}
+	return entries, nil
+}
+
+func (w *storeAuditWriter) Close() error {
+	return nil
+}
+
+// fileAuditWriter appends the audit log to a JSON lines file, rotated to
+// path.1, path.2, ... once it reaches maxBytes; the oldest beyond maxFiles
+// are deleted.
+type fileAuditWriter struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func newFileAuditWriter(path string, maxBytes int64, maxFiles int) (*fileAuditWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create audit dir: %w", err)
+	}
+	w := &fileAuditWriter{path: path, maxBytes: maxBytes, maxFiles: maxFiles}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *fileAuditWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	w.file, w.size = f, info.Size()
+	return nil
+}
+
+func (w *fileAuditWriter) Write(ctx context.Context, entries []AuditEntry) error {
+	var buf strings.Builder
+	encoder := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	if w.size > 0 && w.size+int64(buf.Len()) > w.maxBytes {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := w.file.WriteString(buf.String())
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+	// The changes are applied already, so their record must survive a crash
+	return w.file.Sync()
+}
+
+// rotate shifts the rotated files up by one and starts a new file; w.mu
+// must be held.
+func (w *fileAuditWriter) rotate() error {
+	w.file.Close()
+	w.file = nil
+	os.Remove(w.rotatedPath(w.maxFiles))
+	for i := w.maxFiles - 1; i >= 1; i-- {
+		os.Rename(w.rotatedPath(i), w.rotatedPath(i+1))
+	}
+	if err := os.Rename(w.path, w.rotatedPath(1)); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	return w.open()
+}
+
+func (w *fileAuditWriter) rotatedPath(i int) string {
+	return fmt.Sprintf("%s.%d", w.path, i)
+}
+
+// Query scans the files from the oldest, keeping the newest matches.
+func (w *fileAuditWriter) Query(ctx context.Context, filter store.AuditFilter) ([]AuditEntry, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	keep := filter.Offset + filter.Limit
+	var matches []AuditEntry
+	for i := w.maxFiles; i >= 0; i-- {
+		path := w.path
+		if i > 0 {
+			path = w.rotatedPath(i)
+		}
+		if err := scanAuditFile(ctx, path, func(entry AuditEntry) {
+			if !auditMatches(entry, filter) {
+				return
+			}
+			matches = append(matches, entry)
+			if len(matches) > 2*keep {
+				matches = append(matches[:0], matches[len(matches)-keep:]...)
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(matches) > keep {
+		matches = matches[len(matches)-keep:]
+	}
+	entries := make([]AuditEntry, 0, filter.Limit)
+	for i := len(matches) - 1 - filter.Offset; i >= 0 && len(entries) < filter.Limit; i-- {
+		entries = append(entries, matches[i])
+	}
+	return entries, nil
+}
+
+func scanAuditFile(ctx context.Context, path string, visit func(AuditEntry)) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A line cut short by a crash
+			continue
+		}
+		visit(entry)
+	}
+	return scanner.Err()
+}
+
+func auditMatches(entry AuditEntry, filter store.AuditFilter) bool {
+	if len(filter.Tables) > 0 {
+		found := false
+		for _, table := range filter.Tables {
+			if table == entry.Table {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	switch {
+	case filter.PrimaryKey != "" && entry.PrimaryKey != filter.PrimaryKey,
+		filter.Operation != "" && !strings.EqualFold(entry.Operation, filter.Operation),
+		filter.RunID != "" && entry.RunID != filter.RunID,
+		!filter.From.IsZero() && entry.AppliedAt.Before(filter.From),
+		!filter.To.IsZero() && !entry.AppliedAt.Before(filter.To):
+		return false
+	}
+	return true
+}
+
+func (w *fileAuditWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
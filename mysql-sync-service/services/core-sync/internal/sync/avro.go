@@ -0,0 +1,180 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// avroColumnType accepts any MySQL value: the binlog carries no column types
+// we could map precisely, so each value picks its branch at encode time.
+var avroColumnType = []string{"null", "long", "double", "string", "bytes"}
+
+var avroInvalidName = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// avroEncoder writes Debezium-shaped envelopes in Avro single-object
+// encoding, which prefixes each value with its schema fingerprint. Codecs are
+// cached per table and column layout.
+type avroEncoder struct {
+	namespace string
+	mu        sync.Mutex
+	codecs    map[string]*goavro.Codec
+}
+
+func newAvroEncoder(topicPrefix string) *avroEncoder {
+	return &avroEncoder{
+		namespace: strings.Trim(avroName(topicPrefix), "_"),
+		codecs:    make(map[string]*goavro.Codec),
+	}
+}
+
+func (a *avroEncoder) Encode(e BinlogEvent, change rowChange, source debeziumSource, tsMs int64) ([]byte, error) {
+	codec, err := a.codec(e.Table, e.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	valueType := a.recordNamespace(e.Table) + ".Value"
+	native := map[string]interface{}{
+		"before": avroRow(valueType, e.Columns, change.before),
+		"after":  avroRow(valueType, e.Columns, change.after),
+		"source": map[string]interface{}{
+			"connector":   source.Connector,
+			"name":        source.Name,
+			"server_uuid": source.ServerUUID,
+			"ts_ms":       source.TsMs,
+			"db":          source.DB,
+			"table":       source.Table,
+			"gtid":        source.GTID,
+			"file":        source.File,
+			"pos":         source.Pos,
+			"row":         int32(source.Row),
+		},
+		"op":    change.op,
+		"ts_ms": tsMs,
+	}
+	return codec.SingleFromNative(nil, native)
+}
+
+func (a *avroEncoder) codec(table string, columns []string) (*goavro.Codec, error) {
+	cacheKey := table + "\x00" + strings.Join(columns, "\x00")
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if codec, ok := a.codecs[cacheKey]; ok {
+		return codec, nil
+	}
+
+	fields := make([]map[string]interface{}, len(columns))
+	for i, column := range columns {
+		fields[i] = map[string]interface{}{"name": avroName(column), "type": avroColumnType, "default": nil}
+	}
+
+	schema := map[string]interface{}{
+		"type":      "record",
+		"name":      "Envelope",
+		"namespace": a.recordNamespace(table),
+		"fields": []interface{}{
+			map[string]interface{}{"name": "before", "type": []interface{}{"null", map[string]interface{}{
+				"type": "record", "name": "Value", "fields": fields,
+			}}, "default": nil},
+			map[string]interface{}{"name": "after", "type": []interface{}{"null", "Value"}, "default": nil},
+			map[string]interface{}{"name": "source", "type": map[string]interface{}{
+				"type": "record", "name": "Source", "fields": []interface{}{
+					map[string]interface{}{"name": "connector", "type": "string"},
+					map[string]interface{}{"name": "name", "type": "string"},
+					map[string]interface{}{"name": "server_uuid", "type": "string"},
+					map[string]interface{}{"name": "ts_ms", "type": "long"},
+					map[string]interface{}{"name": "db", "type": "string"},
+					map[string]interface{}{"name": "table", "type": "string"},
+					map[string]interface{}{"name": "gtid", "type": "string"},
+					map[string]interface{}{"name": "file", "type": "string"},
+					map[string]interface{}{"name": "pos", "type": "long"},
+					map[string]interface{}{"name": "row", "type": "int"},
+				},
+			}},
+			map[string]interface{}{"name": "op", "type": "string"},
+			map[string]interface{}{"name": "ts_ms", "type": "long"},
+		},
+	}
+
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := goavro.NewCodec(string(schemaJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build avro schema for %s: %w", table, err)
+	}
+	a.codecs[cacheKey] = codec
+	return codec, nil
+}
+
+func (a *avroEncoder) recordNamespace(table string) string {
+	if a.namespace == "" {
+		return avroName(table)
+	}
+	return a.namespace + "." + avroName(table)
+}
+
+func avroRow(valueType string, columns []string, row []interface{}) interface{} {
+	if row == nil {
+		return nil
+	}
+	values := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		if i < len(row) {
+			values[avroName(column)] = avroValue(row[i])
+		}
+	}
+	return goavro.Union(valueType, values)
+}
+
+// avroValue wraps a row value in the union branch matching its Go type.
+func avroValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case int:
+		return goavro.Union("long", int64(v))
+	case int8:
+		return goavro.Union("long", int64(v))
+	case int16:
+		return goavro.Union("long", int64(v))
+	case int32:
+		return goavro.Union("long", int64(v))
+	case int64:
+		return goavro.Union("long", v)
+	case uint8:
+		return goavro.Union("long", int64(v))
+	case uint16:
+		return goavro.Union("long", int64(v))
+	case uint32:
+		return goavro.Union("long", int64(v))
+	case uint64:
+		return goavro.Union("long", int64(v))
+	case float32:
+		return goavro.Union("double", float64(v))
+	case float64:
+		return goavro.Union("double", v)
+	case string:
+		return goavro.Union("string", v)
+	case []byte:
+		return goavro.Union("bytes", v)
+	default:
+		return goavro.Union("string", fmt.Sprint(v))
+	}
+}
+
+// avroName makes a valid Avro name out of a MySQL identifier.
+func avroName(name string) string {
+	name = avroInvalidName.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
@@ -3,42 +3,110 @@ package sync
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
 	"go.uber.org/zap"
 
+	"mysql-sync-service/internal/alerting"
 	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
 	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/metrics"
 )
 
 type BinlogListener struct {
-	cfg        config.DatabaseConnection
-	canal      *canal.Canal
-	eventChan  chan BinlogEvent
-	ctx        context.Context
-	cancel     context.CancelFunc
-	tables     map[string]bool // Whitelist of tables
+	cfg      config.DatabaseConnection
+	canalCfg *canal.Config
+	watchdog config.WatchdogConfig
+	mu       sync.Mutex // Guards canal, replaced on reconnect, and started
+	canal    *canal.Canal
+	started  bool
+	stopped  chan struct{} // Closed once supervise returns
+	degraded atomic.Bool   // The stream is down and being reconnected
+	lastRead atomic.Int64  // When an event last arrived, in Unix nanoseconds; 0 before any
+	queue    eventQueue
+	ctx      context.Context
+	cancel   context.CancelFunc
+	tables   map[string]bool            // Whitelist of tables
+	triggers map[string]map[string]bool // Per-table trigger columns, lowercased
+	// Per-table replicated operations; every one for tables absent
+	ops      map[string]map[EventType]bool
+	run      *syncRun
+	source   SourceInfo
+	lastGTID string     // Only touched from canal's handler goroutine
+	groups   *txnGroups // Likewise
+	startPos mysql.Position
+	startSet mysql.GTIDSet
+	skipTime uint32 // Rows changed before it are skipped, 0 for none
 }
 
-func NewBinlogListener(cfg config.DatabaseConnection, tables []config.TableConfig) (*BinlogListener, error) {
+func NewBinlogListener(cfg config.DatabaseConnection, serverID uint32, tables []config.TableConfig, groups []config.GroupConfig, txns config.TransactionConfig, watchdog config.WatchdogConfig, conversion config.ConversionConfig, queue eventQueue, run *syncRun) (*BinlogListener, error) {
 	tableMap := make(map[string]bool)
+	triggers := make(map[string]map[string]bool)
+	ops := make(map[string]map[EventType]bool)
 	var tableRegex []string
 	for _, t := range tables {
 		tableMap[t.Name] = true
-		tableRegex = append(tableRegex, fmt.Sprintf("^%s\\.%s$", cfg.Database, t.Name))
+		if len(t.Operations) > 0 {
+			allowed, err := parseOperations(t.Operations)
+			if err != nil {
+				return nil, fmt.Errorf("table %s: %w", t.Name, err)
+			}
+			ops[t.Name] = allowed
+		}
+		if len(t.TriggerColumns) > 0 {
+			triggers[t.Name] = make(map[string]bool, len(t.TriggerColumns))
+			for _, column := range t.TriggerColumns {
+				triggers[t.Name][strings.ToLower(column)] = true
+			}
+		}
+		schema, name := config.SplitTable(t.Name, cfg.Database)
+		tableRegex = append(tableRegex, fmt.Sprintf("^%s\\.%s$", regexp.QuoteMeta(schema), regexp.QuoteMeta(name)))
+	}
+
+	txnGroups, err := newTxnGroups(groups, tableMap, txns)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := database.BuildTLSConfig(cfg.TLS, cfg.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build tls config: %w", err)
+	}
+	timestamps, err := conversion.GetLocation()
+	if err != nil {
+		return nil, fmt.Errorf("invalid conversion timezone: %w", err)
 	}
 
-	c, err := canal.NewCanal(&canal.Config{
+	canalCfg := &canal.Config{
 		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
 		User:     cfg.ReplicationUser,
 		Password: cfg.ReplicationPassword,
 		Flavor:   "mysql",
-		ServerID: 100, // Should be unique
+		ServerID: serverID,
 		Dump: canal.DumpConfig{
 			ExecutionPath: "", // We don't want to dump, just sync binlog
 		},
 		IncludeTableRegex: tableRegex,
-	})
+		TLSConfig:         tlsConfig,
+		// The source sends heartbeats while idle, so a read timing out
+		// means the stream is dead
+		HeartbeatPeriod: watchdog.GetHeartbeat(),
+		ReadTimeout:     watchdog.GetTimeout(),
+		// TIMESTAMP values are rendered in the configured zone rather
+		// than wherever the service happens to run
+		TimestampStringLocation: timestamps,
+	}
+	c, err := canal.NewCanal(canalCfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create canal: %w", err)
 	}
@@ -46,12 +114,26 @@ func NewBinlogListener(cfg config.DatabaseConnection, tables []config.TableConfi
 	ctx, cancel := context.WithCancel(context.Background())
 
 	l := &BinlogListener{
-		cfg:       cfg,
-		canal:     c,
-		eventChan: make(chan BinlogEvent, 10000), // Buffered queue 10K
-		ctx:       ctx,
-		cancel:    cancel,
-		tables:    tableMap,
+		cfg:      cfg,
+		canalCfg: canalCfg,
+		watchdog: watchdog,
+		canal:    c,
+		queue:    queue,
+		stopped:  make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		tables:   tableMap,
+		triggers: triggers,
+		ops:      ops,
+		run:      run,
+		groups:   txnGroups,
+	}
+
+	l.source = SourceInfo{SiteID: cfg.SiteID, Host: cfg.Host}
+	if result, err := c.Execute("SELECT @@server_uuid"); err != nil {
+		logger.Log.Warn("Failed to read source server uuid", zap.String("host", cfg.Host), zap.Error(err))
+	} else if uuid, err := result.GetString(0, 0); err == nil {
+		l.source.ServerUUID = uuid
 	}
 
 	c.SetEventHandler(&eventHandler{listener: l})
@@ -59,74 +141,406 @@ func NewBinlogListener(cfg config.DatabaseConnection, tables []config.TableConfi
 	return l, nil
 }
 
+// StartAt makes the listener start at coords, e.g. those of a dump, rather
+// than where canal starts by default. It must be called before Start.
+func (l *BinlogListener) StartAt(coords DumpCoordinates) error {
+	if coords.GTIDSet != "" {
+		set, err := mysql.ParseGTIDSet(mysql.MySQLFlavor, coords.GTIDSet)
+		if err != nil {
+			return fmt.Errorf("invalid gtid set %q: %w", coords.GTIDSet, err)
+		}
+		l.startSet = set
+	}
+	l.startPos = mysql.Position{Name: coords.BinlogFile, Pos: coords.BinlogPos}
+	return nil
+}
+
+// SkipBefore drops the changes made before t, e.g. those at the start of
+// the binlog file a replay from t starts at. It must be called before
+// Start.
+func (l *BinlogListener) SkipBefore(t time.Time) {
+	if !t.IsZero() {
+		l.skipTime = uint32(t.Unix())
+	}
+}
+
+// sourcePosition is the source's current binlog position.
+func (l *BinlogListener) sourcePosition() (binlogPosition, error) {
+	l.mu.Lock()
+	c := l.canal
+	l.mu.Unlock()
+	pos, err := c.GetMasterPos()
+	if err != nil {
+		return binlogPosition{}, fmt.Errorf("failed to read source binlog position: %w", err)
+	}
+	return binlogPosition{file: pos.Name, pos: pos.Pos}, nil
+}
+
 func (l *BinlogListener) Start() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ctx.Err() != nil {
+		return fmt.Errorf("binlog listener is stopped")
+	}
+	if l.started {
+		return nil
+	}
+	l.started = true
 	logger.Log.Info("Starting binlog listener", zap.String("host", l.cfg.Host))
-	
-	// Start canal in a goroutine
-	go func() {
-		if err := l.canal.Run(); err != nil {
-			logger.Log.Error("Canal run error", zap.Error(err))
-		}
-	}()
-	
+
+	go l.supervise()
+
 	return nil
 }
 
+// supervise runs the binlog stream and reconnects it whenever it dies,
+// resuming after the last transaction read. Canal reports a dead stream
+// once nothing, not even a heartbeat, arrived for the watchdog timeout.
+// Reconnects back off exponentially; the run is degraded until one stays
+// up for a timeout.
+func (l *BinlogListener) supervise() {
+	defer close(l.stopped)
+	timeout := l.watchdog.GetTimeout()
+	backoff := time.Second
+	failures := 0
+	c := l.canal
+	start := runFrom(c, l.startPos, l.startSet)
+
+	for {
+		done := make(chan error, 1)
+		go func(run func() error) { done <- run() }(start)
+
+		var err error
+		select {
+		case err = <-done:
+		case <-time.After(timeout):
+			if failures > 0 {
+				l.restored(failures)
+			}
+			failures, backoff = 0, time.Second
+			err = <-done
+		}
+		if l.ctx.Err() != nil {
+			return
+		}
+
+		pos, gtids := c.SyncedPosition(), c.SyncedGTIDSet()
+		failures++
+		l.lost(err, pos, failures)
+
+		select {
+		case <-time.After(backoff):
+		case <-l.ctx.Done():
+			return
+		}
+		if backoff *= 2; backoff > l.watchdog.GetMaxBackoff() {
+			backoff = l.watchdog.GetMaxBackoff()
+		}
+
+		next, err := l.reconnect()
+		if err != nil {
+			start = func() error { return err }
+			continue
+		}
+		c = next
+		start = runFrom(next, pos, gtids)
+	}
+}
+
+// runFrom starts c after gtids, else at pos, else where canal starts by
+// default.
+func runFrom(c *canal.Canal, pos mysql.Position, gtids mysql.GTIDSet) func() error {
+	return func() error {
+		if gtids != nil && gtids.String() != "" {
+			return c.StartFromGTID(gtids)
+		}
+		if pos.Name != "" {
+			return c.RunFrom(pos)
+		}
+		return c.Run()
+	}
+}
+
+// reconnect replaces canal with a new one. The transaction that was being
+// read is read again from its start, so its held groups are dropped.
+func (l *BinlogListener) reconnect() (*canal.Canal, error) {
+	c, err := canal.NewCanal(l.canalCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create canal: %w", err)
+	}
+	c.SetEventHandler(&eventHandler{listener: l})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ctx.Err() != nil {
+		c.Close()
+		return nil, l.ctx.Err()
+	}
+	l.canal = c
+	l.groups.Reset()
+	l.lastGTID = ""
+	return c, nil
+}
+
+func (l *BinlogListener) lost(err error, pos mysql.Position, failures int) {
+	if err == nil {
+		err = fmt.Errorf("binlog stream ended")
+	}
+	logger.Log.Error("Binlog stream lost, reconnecting",
+		zap.String("run_id", l.run.id),
+		zap.String("binlog_file", pos.Name),
+		zap.Uint32("binlog_pos", pos.Pos),
+		zap.Int("failures", failures),
+		zap.Error(err),
+	)
+	if !l.degraded.Swap(true) {
+		l.run.health.RecordFailure(fmt.Sprintf("binlog stream lost: %v", err))
+		l.run.events.publish(SyncEvent{Type: EventStreamLost, RunID: l.run.id, Status: "degraded", Error: err.Error()})
+	}
+	if failures == l.watchdog.GetAlertAfter() {
+		l.run.alerts.Fire(alerting.Alert{
+			Kind:     alerting.KindSyncFailure,
+			Severity: alerting.SeverityCritical,
+			Subject:  "binlog",
+			Title:    "Binlog stream can't be reconnected",
+			Message:  fmt.Sprintf("%d attempts in a row failed: %v", failures, err),
+			Fields:   map[string]string{"host": l.cfg.Host, "attempts": strconv.Itoa(failures)},
+		})
+	}
+}
+
+func (l *BinlogListener) restored(failures int) {
+	l.degraded.Store(false)
+	logger.Log.Info("Binlog stream restored", zap.String("run_id", l.run.id), zap.Int("failures", failures))
+	l.run.events.publish(SyncEvent{Type: EventStreamRestored, RunID: l.run.id, Status: "running"})
+	if failures >= l.watchdog.GetAlertAfter() {
+		l.run.alerts.Fire(alerting.Alert{
+			Kind:     alerting.KindSyncFailure,
+			Severity: alerting.SeverityInfo,
+			Subject:  "binlog",
+			Title:    "Binlog stream reconnected",
+			Fields:   map[string]string{"host": l.cfg.Host},
+			Resolved: true,
+		})
+	}
+}
+
+// table returns the configured name of a source table, qualified as
+// schema.table outside the source database, and whether it is synced.
+func (l *BinlogListener) table(schema, name string) (string, bool) {
+	if qualified := schema + "." + name; l.tables[qualified] {
+		return qualified, true
+	}
+	return name, schema == l.cfg.Database && l.tables[name]
+}
+
+// Degraded reports whether the binlog stream is down and being reconnected.
+func (l *BinlogListener) Degraded() bool {
+	return l.degraded.Load()
+}
+
+// LastRead is when the stream last delivered an event, zero before the
+// first. Heartbeats don't count; a stream silent past the watchdog timeout
+// is Degraded instead.
+func (l *BinlogListener) LastRead() time.Time {
+	if nanos := l.lastRead.Load(); nanos != 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
+}
+
+// Stop closes the stream and waits until no event is being handed to the
+// queue, which may then be closed.
 func (l *BinlogListener) Stop() {
 	l.cancel()
+	l.mu.Lock()
 	l.canal.Close()
-	close(l.eventChan)
+	started := l.started
+	l.mu.Unlock()
+	if started {
+		<-l.stopped
+	}
 	logger.Log.Info("Stopped binlog listener")
 }
 
-func (l *BinlogListener) Events() <-chan BinlogEvent {
-	return l.eventChan
-}
-
 type eventHandler struct {
 	canal.DummyEventHandler
 	listener *BinlogListener
 }
 
 func (h *eventHandler) OnRow(e *canal.RowsEvent) error {
+	h.listener.lastRead.Store(time.Now().UnixNano())
 	// Filter tables if needed (though regex should handle it)
-	if _, ok := h.listener.tables[e.Table.Name]; !ok {
+	table, ok := h.listener.table(e.Table.Schema, e.Table.Name)
+	if !ok {
+		return nil
+	}
+	if e.Header != nil && e.Header.Timestamp < h.listener.skipTime {
+		return nil
+	}
+	// canal's actions are the operations, lowercased
+	if allowed, ok := h.listener.ops[table]; ok && !allowed[EventType(strings.ToUpper(e.Action))] {
+		dropped := len(e.Rows)
+		if e.Action == canal.UpdateAction {
+			dropped /= 2
+		}
+		metrics.OperationsFiltered.WithLabelValues(table, e.Action).Add(float64(dropped))
 		return nil
 	}
 
 	var eventType EventType
+	rows := e.Rows
+	var before [][]interface{}
 	switch e.Action {
 	case canal.InsertAction:
 		eventType = Insert
 	case canal.UpdateAction:
 		eventType = Update
+		before, rows = splitUpdateRows(e.Rows)
+		if triggers, ok := h.listener.triggers[table]; ok {
+			changed := len(rows)
+			before, rows = filterTriggeredUpdates(e.Table, before, rows, triggers)
+			if dropped := changed - len(rows); dropped > 0 {
+				metrics.UpdatesSuppressed.WithLabelValues(table).Add(float64(dropped))
+			}
+			if len(rows) == 0 {
+				return nil
+			}
+		}
 	case canal.DeleteAction:
 		eventType = Delete
 	default:
 		return nil
 	}
 
-	// Get current binlog position
+	// Get current binlog position. canal only advances it per transaction,
+	// so the event's own end position tells rows events apart.
 	pos := h.listener.canal.SyncedPosition()
+	if e.Header != nil && e.Header.LogPos > 0 {
+		pos.Pos = e.Header.LogPos
+	}
 
 	binlogEvent := BinlogEvent{
-		Type:       eventType,
-		Schema:     e.Table.Schema,
-		Table:      e.Table.Name,
-		Rows:       e.Rows,
-		Timestamp:  e.Header.Timestamp,
-		BinlogFile: pos.Name,
-		BinlogPos:  pos.Pos,
+		Type:        eventType,
+		Schema:      e.Table.Schema,
+		Table:       table,
+		Rows:        rows,
+		Before:      before,
+		Timestamp:   e.Header.Timestamp,
+		BinlogFile:  pos.Name,
+		BinlogPos:   pos.Pos,
+		Size:        estimateRowsSize(before) + estimateRowsSize(rows),
+		GTID:        h.listener.lastGTID,
+		PrimaryKeys: formatPrimaryKeys(e.Table, rows),
+		Columns:     columnNames(e.Table),
+		ColumnTypes: columnTypes(e.Table),
+		KeyColumns:  keyColumnNames(e.Table),
+		Generated:   generatedColumns(e.Table),
+		Source:      h.listener.source,
+	}
+
+	h.listener.run.progress.Read(binlogEvent)
+	h.listener.run.sampler.sample(binlogEvent)
+
+	// Grouped tables wait for their transaction to commit
+	if held, full := h.listener.groups.Add(binlogEvent); held {
+		if full != nil {
+			return h.push(*full)
+		}
+		return nil
+	}
+
+	return h.push(binlogEvent)
+}
+
+// OnTableChanged is called by canal, which refreshes its own table cache,
+// before DDL on a table is applied.
+func (h *eventHandler) OnTableChanged(header *replication.EventHeader, schema string, name string) error {
+	if table, ok := h.listener.table(schema, name); ok {
+		logger.Log.Info("Source table changed", zap.String("run_id", h.listener.run.id), zap.String("table", table))
+		h.listener.run.registry.InvalidateSource(table)
+	}
+	return nil
+}
+
+// OnXID hands the committed transaction's sync groups, and with
+// transactions preserved the rest of it, to the workers.
+func (h *eventHandler) OnXID(header *replication.EventHeader, nextPos mysql.Position) error {
+	h.listener.lastRead.Store(time.Now().UnixNano())
+	h.listener.run.progress.Commit(h.listener.lastGTID)
+	for _, group := range h.listener.groups.Commit() {
+		group.BinlogFile = nextPos.Name
+		group.BinlogPos = nextPos.Pos
+		if err := h.push(group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *eventHandler) push(binlogEvent BinlogEvent) error {
+	// Hold the listener while the run is paused
+	if err := h.listener.run.gate.Wait(h.listener.ctx); err != nil {
+		return err
+	}
+
+	// Blocks only when the queue is at its memory (or disk) limit, which
+	// applies backpressure to the binlog reader
+	if err := h.listener.queue.Push(h.listener.ctx, binlogEvent); err != nil {
+		logger.Log.Warn("Binlog event dropped while queueing",
+			append(eventFields(h.listener.run.id, binlogEvent), zap.Error(err))...,
+		)
+		return err
+	}
+	h.listener.run.stats.Queued()
+
+	return nil
+}
+
+// parseOperations reads TableConfig.Operations.
+func parseOperations(operations []string) (map[EventType]bool, error) {
+	allowed := make(map[EventType]bool, len(operations))
+	for _, operation := range operations {
+		eventType := EventType(strings.ToUpper(strings.TrimSpace(operation)))
+		switch eventType {
+		case Insert, Update, Delete:
+			allowed[eventType] = true
+		default:
+			return nil, fmt.Errorf("unknown operation %q, want insert, update or delete", operation)
+		}
 	}
+	return allowed, nil
+}
 
-	// Non-blocking send or block? Spec says "Push changes to buffered queue"
-	// If queue is full, we should probably block to apply backpressure
-	select {
-	case h.listener.eventChan <- binlogEvent:
-	case <-h.listener.ctx.Done():
-		return h.listener.ctx.Err()
+// filterTriggeredUpdates keeps the updated rows, old and new images, in
+// which at least one trigger column changed.
+func filterTriggeredUpdates(table *schema.Table, before, after [][]interface{}, triggers map[string]bool) ([][]interface{}, [][]interface{}) {
+	keptBefore := make([][]interface{}, 0, len(before))
+	keptAfter := make([][]interface{}, 0, len(after))
+	for i := range after {
+		old, row := before[i], after[i]
+		for columnIndex, column := range table.Columns {
+			if !triggers[strings.ToLower(column.Name)] || columnIndex >= len(old) || columnIndex >= len(row) {
+				continue
+			}
+			if !valuesEqual(old[columnIndex], row[columnIndex]) {
+				keptBefore = append(keptBefore, old)
+				keptAfter = append(keptAfter, row)
+				break
+			}
+		}
 	}
+	return keptBefore, keptAfter
+}
 
+func (h *eventHandler) OnGTID(header *replication.EventHeader, gtid mysql.GTIDSet) error {
+	h.listener.lastRead.Store(time.Now().UnixNano())
+	if gtid != nil {
+		// Transactions without an XID, on non-transactional tables, end
+		// with the next one
+		h.listener.run.progress.Commit(h.listener.lastGTID)
+		h.listener.lastGTID = gtid.String()
+	}
 	return nil
 }
 
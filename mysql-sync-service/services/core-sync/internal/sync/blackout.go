@@ -0,0 +1,207 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+)
+
+// BlackoutStatus is the blackout window in effect.
+type BlackoutStatus struct {
+	Name   string    `json:"name"`
+	Until  time.Time `json:"until"`
+	Paused bool      `json:"paused"` // the scheduler paused the run for it
+}
+
+// blackout is a parsed config.BlackoutWindow.
+type blackout struct {
+	name       string
+	days       [7]bool // by time.Weekday
+	start, end int     // minutes into the day
+	loc        *time.Location
+	pause      bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseBlackout(window config.BlackoutWindow) (blackout, error) {
+	b := blackout{name: window.Name, pause: window.PauseApplies, loc: time.Local}
+	if b.name == "" {
+		b.name = fmt.Sprintf("%s-%s", window.Start, window.End)
+	}
+
+	var err error
+	if b.start, err = parseClock(window.Start); err != nil {
+		return blackout{}, fmt.Errorf("start: %w", err)
+	}
+	if b.end, err = parseClock(window.End); err != nil {
+		return blackout{}, fmt.Errorf("end: %w", err)
+	}
+	if b.start == b.end {
+		return blackout{}, fmt.Errorf("start and end are both %s", window.Start)
+	}
+	if window.Timezone != "" {
+		if b.loc, err = time.LoadLocation(window.Timezone); err != nil {
+			return blackout{}, fmt.Errorf("timezone: %w", err)
+		}
+	}
+
+	if len(window.Days) == 0 {
+		for i := range b.days {
+			b.days[i] = true
+		}
+	}
+	for _, day := range window.Days {
+		name := strings.ToLower(strings.TrimSpace(day))
+		if len(name) > 3 {
+			name = name[:3]
+		}
+		weekday, ok := weekdays[name]
+		if !ok {
+			return blackout{}, fmt.Errorf("unknown day %q", day)
+		}
+		b.days[weekday] = true
+	}
+	return b, nil
+}
+
+// parseClock reads "HH:MM" as minutes into the day.
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// active reports whether now falls in the window and, if so, when it ends.
+// A window that ends the next day belongs to the day it starts on.
+func (b blackout) active(now time.Time) (bool, time.Time) {
+	t := now.In(b.loc)
+	minute := t.Hour()*60 + t.Minute()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, b.loc)
+	at := func(day time.Time, minutes int) time.Time {
+		return day.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	if b.start < b.end {
+		if b.days[t.Weekday()] && minute >= b.start && minute < b.end {
+			return true, at(midnight, b.end)
+		}
+		return false, time.Time{}
+	}
+	switch {
+	case b.days[t.Weekday()] && minute >= b.start:
+		return true, at(midnight.AddDate(0, 0, 1), b.end)
+	case b.days[t.AddDate(0, 0, -1).Weekday()] && minute < b.end:
+		return true, at(midnight, b.end)
+	}
+	return false, time.Time{}
+}
+
+// loadBlackouts parses the configured windows and, if any pauses the
+// sync, checks every minute whether a run is to be paused or resumed. A
+// window that isn't valid is logged and left out.
+func (s *Scheduler) loadBlackouts() {
+	pausing := false
+	for _, window := range s.cfg.Blackouts {
+		b, err := parseBlackout(window)
+		if err != nil {
+			logger.Log.Error("Ignoring invalid blackout window", zap.String("window", window.Name), zap.Error(err))
+			continue
+		}
+		s.blackouts = append(s.blackouts, b)
+		pausing = pausing || b.pause
+	}
+	if !pausing {
+		return
+	}
+	schedule, _ := cron.ParseStandard("* * * * *")
+	s.mu.Lock()
+	s.blackoutID = s.cron.Schedule(schedule, cron.FuncJob(s.enforceBlackouts))
+	s.mu.Unlock()
+}
+
+// activeBlackout returns the window now falls in, the one ending last if
+// several do, and when it ends. Only pausing windows are looked at if
+// pausing is set.
+func (s *Scheduler) activeBlackout(now time.Time, pausing bool) (*blackout, time.Time) {
+	var active *blackout
+	var until time.Time
+	for i := range s.blackouts {
+		b := &s.blackouts[i]
+		if pausing && !b.pause {
+			continue
+		}
+		if ok, end := b.active(now); ok && end.After(until) {
+			active, until = b, end
+		}
+	}
+	return active, until
+}
+
+// blackoutReason explains why no run may be started now, or returns "" if
+// one may.
+func (s *Scheduler) blackoutReason() string {
+	if b, until := s.activeBlackout(time.Now(), false); b != nil {
+		return fmt.Sprintf("in blackout window %s until %s", b.name, until.Format("2006-01-02 15:04 MST"))
+	}
+	return ""
+}
+
+// enforceBlackouts pauses the running sync when a pausing window starts,
+// and resumes it when the window ends, unless it was resumed, or stopped,
+// in between.
+func (s *Scheduler) enforceBlackouts() {
+	b, until := s.activeBlackout(time.Now(), true)
+	runID := s.manager.RunID()
+
+	s.mu.Lock()
+	pausedRun := s.blackoutRun
+	s.mu.Unlock()
+
+	switch {
+	case b != nil && pausedRun != runID && s.manager.GetStatus() != "idle":
+		if s.manager.stats.state() != "running" {
+			return
+		}
+		if err := s.manager.Pause(); err != nil {
+			logger.Log.Warn("Failed to pause sync for blackout window", zap.String("window", b.name), zap.Error(err))
+			return
+		}
+		logger.Log.Info("Paused sync for blackout window", zap.String("window", b.name), zap.String("run_id", runID), zap.Time("until", until))
+		s.mu.Lock()
+		s.blackoutRun = runID
+		s.mu.Unlock()
+	case b == nil && pausedRun != "":
+		s.mu.Lock()
+		s.blackoutRun = ""
+		s.mu.Unlock()
+		if pausedRun != runID || s.manager.stats.state() != "paused" {
+			return
+		}
+		if err := s.manager.Resume(); err != nil {
+			logger.Log.Warn("Failed to resume sync after blackout window", zap.Error(err))
+			return
+		}
+		logger.Log.Info("Resumed sync after blackout window", zap.String("run_id", runID))
+	}
+}
+
+// blackoutStatus is the window in effect, if any. s.mu must be held.
+func (s *Scheduler) blackoutStatus() *BlackoutStatus {
+	b, until := s.activeBlackout(time.Now(), false)
+	if b == nil {
+		return nil
+	}
+	return &BlackoutStatus{Name: b.name, Until: until, Paused: s.blackoutRun != ""}
+}
@@ -0,0 +1,270 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+)
+
+// ErrInvalidSchema is returned for target schemas that can't be read.
+var ErrInvalidSchema = errors.New("invalid target schema")
+
+const targetSchemaTimeout = 10 * time.Minute
+
+// BootstrapOptions stand up a new target in the run that starts syncing it.
+type BootstrapOptions struct {
+	// Dump is a mysqldump file, on this host, loaded before changes are
+	// captured from the binlog coordinates it recorded.
+	Dump string
+	// CSV maps tables to CSV files, on this host, loaded instead of a dump
+	// before changes are captured from Coordinates, where the source was
+	// when they were exported. See NewCSVLoader.
+	CSV         map[string]string
+	Coordinates DumpCoordinates
+	// Schema overrides sync.target_schema: migration files or a schema
+	// dump creating the target tables if none exist yet.
+	Schema string
+	// Snapshot overrides sync.snapshot: how the dump or CSV files are
+	// loaded.
+	Snapshot string
+}
+
+// Bootstrap begins a manually triggered run over tables, or every table if
+// nil, that first creates the target's tables and loads a dump or CSV
+// files as opts say.
+func (m *Manager) Bootstrap(tables []string, opts BootstrapOptions) error {
+	if opts.Dump != "" && len(opts.CSV) > 0 {
+		return fmt.Errorf("%w: load a dump or CSV files, not both", ErrInvalidDump)
+	}
+	trigger := TriggerManual
+	if opts.Dump != "" || len(opts.CSV) > 0 {
+		trigger = TriggerDump
+	}
+	return m.start(trigger, tables, runOptions{BootstrapOptions: opts})
+}
+
+// prepareSnapshot sets run up to load the dump of tables into shadow tables
+// if strategy, or sync.snapshot, says so. m.mu must be held.
+func (m *Manager) prepareSnapshot(syncCfg config.SyncConfig, strategy string, tables []config.TableConfig, run *syncRun) error {
+	if strategy == "" {
+		strategy = syncCfg.GetSnapshot()
+	}
+	switch strategy {
+	case SnapshotInPlace:
+		return nil
+	case SnapshotShadow:
+	default:
+		return fmt.Errorf("%w: unknown snapshot strategy %q", ErrInvalidDump, strategy)
+	}
+	if !m.writesToTarget() || syncCfg.Observe {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, preflightTimeout)
+	defer cancel()
+	shadows, err := newSnapshotShadows(ctx, tables, m.cloudDB, run.direction, run.registry)
+	if err != nil {
+		return fmt.Errorf("%w: shadow snapshot: %v", ErrInvalidDump, err)
+	}
+	run.snapshot = shadows
+	return nil
+}
+
+// applyTargetSchema creates the target tables from path, a directory of
+// migration files applied in name order or a single schema file, when none
+// of the tables exist yet. A target with some of them is left alone, and
+// preflight reports what it lacks.
+//
+// Statements are run on one connection in the target's dialect. USE and
+// CREATE DATABASE are skipped so a dump taken with --databases lands in the
+// target database, and so are a schema file's rows, which come from the
+// dump load or the binlog.
+func (m *Manager) applyTargetSchema(tables []config.TableConfig, path string) error {
+	ctx, cancel := context.WithTimeout(m.ctx, targetSchemaTimeout)
+	defer cancel()
+
+	for _, tableConfig := range tables {
+		router, err := newTableRouter(tableConfig, DirectionLocalToCloud, m.cloudDB)
+		if err != nil {
+			return err
+		}
+		for _, rt := range router.routes {
+			if _, err := m.cloudDB.DescribeTable(ctx, rt.builder.table); err == nil {
+				logger.Log.Debug("Target table exists, not applying target schema", zap.String("table", rt.builder.table))
+				return nil
+			}
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	files := []string{path}
+	if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*.sql")); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("%w: no .sql files in %s", ErrInvalidSchema, path)
+		}
+		sort.Strings(files)
+	}
+
+	conn, err := m.cloudDB.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("target database unreachable: %w", err)
+	}
+	defer conn.Close()
+
+	logger.Log.Info("Target is empty, applying target schema", zap.String("path", path), zap.Int("files", len(files)))
+	for _, file := range files {
+		statements := 0
+		err := forEachStatement(file, func(statement string) error {
+			if skipSchemaStatement(statement, !info.IsDir()) {
+				return nil
+			}
+			statements++
+			if _, err := conn.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("statement %d: %w", statements, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply %s, the target schema is partly applied: %w", filepath.Base(file), err)
+		}
+		logger.Log.Info("Applied target schema file", zap.String("file", filepath.Base(file)), zap.Int("statements", statements))
+	}
+	return nil
+}
+
+// skipSchemaStatement reports whether statement is left out of the target
+// schema; rows and replication state are only left out of schema files,
+// not migrations.
+func skipSchemaStatement(statement string, file bool) bool {
+	upper := strings.ToUpper(statement)
+	if strings.HasPrefix(upper, "USE ") || strings.HasPrefix(upper, "CREATE DATABASE") || strings.HasPrefix(upper, "CREATE SCHEMA") {
+		return true
+	}
+	if !file {
+		return false
+	}
+	// Replication state is the source's, not the target's
+	for _, prefix := range []string{"INSERT ", "REPLACE ", "LOCK TABLES", "UNLOCK TABLES", "SET @@GLOBAL.", "SET @@SESSION.SQL_LOG_BIN", "CHANGE MASTER", "CHANGE REPLICATION"} {
+		if strings.HasPrefix(upper, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachStatement calls fn with each statement of a SQL file, gunzipped
+// if it ends in .gz, without its delimiter. Comment lines are dropped and
+// DELIMITER lines, as used around triggers and procedures, are honoured.
+// Rows of a mysqldump file come one INSERT per line and aren't buffered
+// longer than that line.
+func forEachStatement(path string, fn func(string) error) error {
+	r, closeFile, err := openDump(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	defer closeFile()
+
+	s := &statementSplitter{delimiter: ";"}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line != "" {
+			if err := s.line(line, fn); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if rest := strings.TrimSpace(s.buf.String()); rest != "" {
+		return fn(rest)
+	}
+	return nil
+}
+
+// statementSplitter finds statement delimiters outside of quotes and
+// comments.
+type statementSplitter struct {
+	delimiter string
+	buf       strings.Builder
+	quote     byte // the open quote, or 0
+	comment   bool // inside /* */
+}
+
+func (s *statementSplitter) line(line string, fn func(string) error) error {
+	if s.buf.Len() == 0 && s.quote == 0 && !s.comment {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "", strings.HasPrefix(trimmed, "--"), strings.HasPrefix(trimmed, "#"):
+			return nil
+		case strings.HasPrefix(strings.ToUpper(trimmed), "DELIMITER "):
+			s.delimiter = strings.TrimSpace(trimmed[len("DELIMITER "):])
+			return nil
+		}
+	}
+
+	start := 0
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case s.comment:
+			if c == '*' && i+1 < len(line) && line[i+1] == '/' {
+				s.comment = false
+				i++
+			}
+		case s.quote != 0:
+			if c == '\\' && s.quote != '`' {
+				i++
+			} else if c == s.quote {
+				s.quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			s.quote = c
+		case c == '/' && i+1 < len(line) && line[i+1] == '*':
+			s.comment = true
+			i++
+		case c == '#' || (c == '-' && (strings.HasPrefix(line[i:], "-- ") || strings.HasPrefix(line[i:], "--\n"))):
+			// The rest of the line is a comment
+			s.buf.WriteString(line[start:i])
+			s.buf.WriteByte('\n')
+			start = len(line)
+			i = len(line)
+		case strings.HasPrefix(line[i:], s.delimiter):
+			s.buf.WriteString(line[start:i])
+			statement := strings.TrimSpace(s.buf.String())
+			s.buf.Reset()
+			if statement != "" {
+				if err := fn(statement); err != nil {
+					return err
+				}
+			}
+			i += len(s.delimiter) - 1
+			start = i + 1
+		}
+	}
+	s.buf.WriteString(line[start:])
+	if s.quote == 0 && !s.comment && strings.TrimSpace(s.buf.String()) == "" {
+		s.buf.Reset()
+	}
+	return nil
+}
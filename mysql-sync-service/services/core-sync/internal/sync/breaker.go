@@ -0,0 +1,205 @@
+package sync
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/metrics"
+)
+
+// Circuit states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open" // probing the target
+)
+
+// CircuitStatus is a point-in-time view of a sink's circuit breaker.
+type CircuitStatus struct {
+	Sink                string     `json:"sink"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Trips               int        `json:"trips"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+// prober is implemented by sinks that can check their target is reachable
+// without writing to it.
+type prober interface {
+	Ping(ctx context.Context) error
+}
+
+// circuitBreaker stops applying to a sink after consecutive failed batches.
+// While it is open workers hold their batch instead of dead-lettering it,
+// so the queue backs up, the listener stops reading and the saved binlog
+// positions stay put. A probe every interval closes it once the target
+// answers again.
+type circuitBreaker struct {
+	threshold int
+	interval  time.Duration
+	probe     func(ctx context.Context) error
+
+	mu     sync.Mutex
+	status CircuitStatus
+	closed chan struct{} // nil while closed, closed when the circuit closes
+}
+
+func newCircuitBreaker(cfg config.CircuitBreakerConfig, sink Sink) *circuitBreaker {
+	b := &circuitBreaker{
+		threshold: cfg.GetFailureThreshold(),
+		interval:  cfg.GetProbeInterval(),
+		status:    CircuitStatus{Sink: sink.Name(), State: CircuitClosed},
+	}
+	if p, ok := sink.(prober); ok {
+		b.probe = p.Ping
+	}
+	metrics.CircuitBreakerState.WithLabelValues(b.status.Sink).Set(0)
+	return b
+}
+
+func (b *circuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.status.ConsecutiveFailures = 0
+	if b.status.State != CircuitClosed {
+		b.close()
+	}
+}
+
+// RecordFailure counts a failed batch and reports whether the circuit is
+// open, in which case the batch should be retried once it closes.
+func (b *circuitBreaker) RecordFailure(ctx context.Context, err error) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.status.ConsecutiveFailures++
+	b.status.LastError = err.Error()
+	switch {
+	case b.closed != nil:
+		// Already holding; the batch was in flight when the circuit opened
+		return true
+	case b.status.State == CircuitClosed && b.status.ConsecutiveFailures < b.threshold:
+		return false
+	}
+
+	// Too many failures in a row, or the half-open trial batch failed
+	now := time.Now()
+	b.status.State = CircuitOpen
+	if b.status.OpenedAt == nil {
+		b.status.OpenedAt = &now
+		b.status.Trips++
+		metrics.CircuitBreakerTrips.WithLabelValues(b.status.Sink).Inc()
+	}
+	b.closed = make(chan struct{})
+	metrics.CircuitBreakerState.WithLabelValues(b.status.Sink).Set(1)
+	logger.Log.Warn("Circuit opened, holding batches until the target recovers",
+		zap.String("sink", b.status.Sink),
+		zap.Int("consecutive_failures", b.status.ConsecutiveFailures),
+		zap.Duration("probe_interval", b.interval),
+		zap.Error(err),
+	)
+	go b.probeUntilClosed(ctx, b.closed)
+	return true
+}
+
+// Wait blocks while the circuit is open or until ctx is done.
+func (b *circuitBreaker) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	closed := b.closed
+	b.mu.Unlock()
+	if closed == nil {
+		return nil
+	}
+
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *circuitBreaker) Snapshot() CircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.status
+}
+
+// probeUntilClosed probes the target until it answers or the circuit is
+// closed by a batch that got through.
+func (b *circuitBreaker) probeUntilClosed(ctx context.Context, closed <-chan struct{}) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+
+		b.setState(CircuitHalfOpen, 2)
+		if b.probe == nil {
+			// Let the waiting batches through as the probe; the next
+			// failure opens the circuit again
+			b.mu.Lock()
+			if b.closed != nil {
+				close(b.closed)
+				b.closed = nil
+			}
+			b.mu.Unlock()
+			return
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, b.interval)
+		err := b.probe(probeCtx)
+		cancel()
+		if err == nil {
+			b.mu.Lock()
+			if b.status.State != CircuitClosed {
+				b.close()
+			}
+			b.mu.Unlock()
+			return
+		}
+
+		logger.Log.Debug("Target still unavailable", zap.String("sink", b.status.Sink), zap.Error(err))
+		b.mu.Lock()
+		b.status.LastError = err.Error()
+		b.mu.Unlock()
+		b.setState(CircuitOpen, 1)
+	}
+}
+
+func (b *circuitBreaker) setState(state string, gauge float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.status.State == CircuitClosed {
+		return
+	}
+	b.status.State = state
+	metrics.CircuitBreakerState.WithLabelValues(b.status.Sink).Set(gauge)
+}
+
+// close must be called with b.mu held.
+func (b *circuitBreaker) close() {
+	logger.Log.Info("Circuit closed, resuming", zap.String("sink", b.status.Sink), zap.Int("trips", b.status.Trips))
+	b.status.State = CircuitClosed
+	b.status.ConsecutiveFailures = 0
+	b.status.OpenedAt = nil
+	b.status.LastError = ""
+	if b.closed != nil {
+		close(b.closed)
+		b.closed = nil
+	}
+	metrics.CircuitBreakerState.WithLabelValues(b.status.Sink).Set(0)
+}
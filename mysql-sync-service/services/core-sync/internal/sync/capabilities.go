@@ -0,0 +1,210 @@
+package sync
+
+import (
+	"mysql-sync-service/internal/alerting"
+	"mysql-sync-service/internal/database"
+	"mysql-sync-service/internal/store"
+)
+
+// Config field types
+const (
+	FieldString   = "string"
+	FieldInt      = "int"
+	FieldBool     = "bool"
+	FieldDuration = "duration" // e.g. "30s"
+	FieldList     = "list"     // of strings
+	FieldMap      = "map"      // of string to string
+	FieldObject   = "object"
+)
+
+// ConfigField describes one setting of a component, named as in config.yaml.
+type ConfigField struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// Component is one implementation compiled into this build.
+type Component struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	ConfigPath  string        `json:"config_path,omitempty"` // where its settings live
+	Config      []ConfigField `json:"config,omitempty"`
+}
+
+// Capabilities lists what this build supports, per extension point, with
+// enough of each config schema to build a form from.
+type Capabilities struct {
+	Sources            []Component `json:"sources"`
+	Targets            []Component `json:"targets"`
+	Sinks              []Component `json:"sinks"`
+	StoreBackends      []Component `json:"store_backends"`
+	ConflictStrategies []Component `json:"conflict_strategies"`
+	DeleteModes        []Component `json:"delete_modes"`
+	Notifiers          []Component `json:"notifiers"`
+}
+
+var connectionFields = []ConfigField{
+	{Name: "host", Type: FieldString, Required: true},
+	{Name: "port", Type: FieldInt, Default: "3306"},
+	{Name: "user", Type: FieldString, Required: true},
+	{Name: "password", Type: FieldString},
+	{Name: "database", Type: FieldString, Required: true},
+	{Name: "tls", Type: FieldObject, Description: "tls_mode (disabled | preferred | required | verify_ca | verify_identity), ca_cert, client_cert, client_key, skip_verify"},
+}
+
+var minSeverityField = ConfigField{
+	Name:    "min_severity",
+	Type:    FieldString,
+	Default: string(alerting.SeverityWarning),
+	Enum:    []string{string(alerting.SeverityInfo), string(alerting.SeverityWarning), string(alerting.SeverityCritical)},
+}
+
+// GetCapabilities reports the sources, targets, sinks, state stores and
+// strategies compiled into this build.
+func GetCapabilities() Capabilities {
+	caps := Capabilities{
+		Sources: []Component{
+			{
+				Name:        CaptureBinlog,
+				Description: "Reads row changes from the local MySQL binlog; needs replication privileges and row-based logging.",
+				ConfigPath:  "databases.local",
+				Config: append(append([]ConfigField{}, connectionFields...),
+					ConfigField{Name: "replication_user", Type: FieldString, Required: true},
+					ConfigField{Name: "replication_password", Type: FieldString},
+					ConfigField{Name: "site_id", Type: FieldString, Description: "Names this server in event metadata"},
+				),
+			},
+			{
+				Name:        CapturePolling,
+				Description: "Selects rows whose timestamp column moved past a watermark; sees inserts and updates but not deletes.",
+				ConfigPath:  "sync",
+				Config: []ConfigField{
+					{Name: "poll_interval", Type: FieldDuration, Default: "10s"},
+					{Name: "tables[].timestamp_column", Type: FieldString, Required: true},
+					{Name: "tables[].primary_key", Type: FieldString, Required: true},
+				},
+			},
+		},
+		Targets: []Component{
+			{
+				Name:        database.DriverMySQL,
+				Description: "MySQL or MariaDB.",
+				ConfigPath:  "databases.cloud",
+				Config:      connectionFields,
+			},
+			{
+				Name:        database.DriverPostgres,
+				Description: "PostgreSQL; column types are mapped from MySQL.",
+				ConfigPath:  "databases.cloud",
+				Config:      append([]ConfigField{{Name: "driver", Type: FieldString, Required: true, Enum: []string{database.DriverPostgres}}}, connectionFields...),
+			},
+			{
+				Name:        database.DriverSQLite,
+				Description: "SQLite file, e.g. for an edge node mirroring tables for offline reads.",
+				ConfigPath:  "databases.cloud",
+				Config: []ConfigField{
+					{Name: "driver", Type: FieldString, Required: true, Enum: []string{"sqlite"}},
+					{Name: "file_path", Type: FieldString, Required: true},
+				},
+			},
+		},
+		Sinks: []Component{
+			{
+				Name:        SinkMySQL,
+				Description: "Applies changes to the target database in one transaction per batch.",
+				ConfigPath:  "sync.sinks[]",
+				Config: []ConfigField{
+					{Name: "type", Type: FieldString, Required: true, Enum: []string{SinkMySQL}},
+				},
+			},
+			{
+				Name:        SinkKafka,
+				Description: "Publishes one message per changed row to a topic per table, keyed by primary key.",
+				ConfigPath:  "sync.sinks[]",
+				Config: []ConfigField{
+					{Name: "type", Type: FieldString, Required: true, Enum: []string{SinkKafka}},
+					{Name: "brokers", Type: FieldList, Required: true},
+					{Name: "topic_prefix", Type: FieldString, Default: defaultTopicPrefix},
+					{Name: "format", Type: FieldString, Default: FormatJSON, Enum: []string{FormatJSON, FormatAvro}},
+				},
+			},
+		},
+		StoreBackends: []Component{
+			{
+				Name:        store.BackendMySQL,
+				Description: "Keeps sync state, history, conflicts and dead letters in MySQL.",
+				ConfigPath:  "state_storage",
+				Config:      connectionFields,
+			},
+		},
+		ConflictStrategies: []Component{
+			{Name: ResolveLastWriteWins, Description: "The row with the later timestamp_column value wins."},
+			{Name: ResolveLocalWins, Description: "The local row wins; set on a table, its conflicts are resolved as they are recorded."},
+			{Name: ResolveCloudWins, Description: "The cloud row wins; set on a table, its conflicts are resolved as they are recorded."},
+			{Name: ResolveManual, Description: "Conflicts wait for an operator to resolve them."},
+		},
+		DeleteModes: []Component{
+			{Name: DeleteHard, Description: "Deletes the target row."},
+			{
+				Name:        DeleteSoft,
+				Description: "Marks the target row as deleted.",
+				ConfigPath:  "sync.tables[]",
+				Config: []ConfigField{
+					{Name: "soft_delete_column", Type: FieldString, Default: "deleted_at"},
+					{Name: "soft_delete_flag", Type: FieldBool, Description: "Set the column to true instead of the delete time"},
+				},
+			},
+			{Name: DeleteIgnore, Description: "Leaves the target row in place."},
+		},
+		Notifiers: []Component{
+			{
+				Name:        "slack",
+				Description: "Posts alerts to a Slack incoming webhook.",
+				ConfigPath:  "alerting.notifiers[]",
+				Config: []ConfigField{
+					{Name: "url", Type: FieldString, Required: true},
+					{Name: "channel", Type: FieldString},
+					minSeverityField,
+				},
+			},
+			{
+				Name:        "webhook",
+				Description: "POSTs alerts as JSON.",
+				ConfigPath:  "alerting.notifiers[]",
+				Config: []ConfigField{
+					{Name: "url", Type: FieldString, Required: true},
+					{Name: "headers", Type: FieldMap},
+					minSeverityField,
+				},
+			},
+			{
+				Name:        "email",
+				Description: "Sends alerts over SMTP.",
+				ConfigPath:  "alerting.notifiers[]",
+				Config: []ConfigField{
+					{Name: "smtp_host", Type: FieldString, Required: true},
+					{Name: "smtp_port", Type: FieldInt, Default: "587"},
+					{Name: "username", Type: FieldString},
+					{Name: "password", Type: FieldString},
+					{Name: "from", Type: FieldString, Required: true},
+					{Name: "to", Type: FieldList, Required: true},
+					minSeverityField,
+				},
+			},
+		},
+	}
+	for _, backend := range store.Backends() {
+		if backend != store.BackendMySQL {
+			caps.StoreBackends = append(caps.StoreBackends, Component{
+				Name:        backend,
+				Description: "State store registered by this build; its settings go under options.",
+				ConfigPath:  "state_storage",
+			})
+		}
+	}
+	return caps
+}
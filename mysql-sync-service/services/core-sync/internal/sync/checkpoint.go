@@ -0,0 +1,256 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/database"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/metrics"
+)
+
+// ErrCheckpointLost is returned when the binlog a target checkpoint points
+// into has been purged from the source.
+var ErrCheckpointLost = errors.New("target checkpoint lost")
+
+// checkpointTable holds, on the target, the binlog position of the last
+// event applied per source and table. It is written in the same
+// transaction as the rows, so after a crash re-delivered events are
+// recognised and skipped.
+const checkpointTable = "sync_checkpoint"
+
+var checkpointColumns = []string{"source_id", "table_name", "binlog_file", "binlog_position", "gtid", "updated_at"}
+
+// binlogPosition orders events of one source.
+type binlogPosition struct {
+	file string
+	pos  uint32
+}
+
+// after reports whether p comes later in the binlog than other. Binlog
+// file names carry a zero-padded sequence number, so they sort as strings.
+func (p binlogPosition) after(other binlogPosition) bool {
+	if p.file != other.file {
+		return p.file > other.file
+	}
+	return p.pos > other.pos
+}
+
+func ensureCheckpointTable(ctx context.Context, db *database.Database) error {
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		source_id VARCHAR(255) NOT NULL,
+		table_name VARCHAR(255) NOT NULL,
+		binlog_file VARCHAR(255) NOT NULL,
+		binlog_position BIGINT NOT NULL,
+		gtid TEXT,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (source_id, table_name)
+	)`, db.Dialect.QuoteIdentifier(checkpointTable))
+	if _, err := db.DB.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create %s: %w", checkpointTable, err)
+	}
+	return nil
+}
+
+// rewindCheckpoints forgets how far tables, or every table if nil, were
+// applied, so changes read again aren't skipped as already applied.
+func rewindCheckpoints(ctx context.Context, db *database.Database, tables []string) error {
+	if err := ensureCheckpointTable(ctx, db); err != nil {
+		return err
+	}
+	query := "DELETE FROM " + db.Dialect.QuoteIdentifier(checkpointTable)
+	args := make([]interface{}, len(tables))
+	if len(tables) > 0 {
+		placeholders := make([]string, len(tables))
+		for i, table := range tables {
+			args[i] = table
+			placeholders[i] = db.Dialect.Placeholder(i + 1)
+		}
+		query += " WHERE table_name IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+	if _, err := db.DB.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to rewind checkpoints: %w", err)
+	}
+	return nil
+}
+
+// checkpointSource names the server an event was read from.
+func checkpointSource(source SourceInfo) string {
+	switch {
+	case source.ServerUUID != "":
+		return source.ServerUUID
+	case source.SiteID != "":
+		return source.SiteID
+	default:
+		return source.Host
+	}
+}
+
+// checkpointKey is a checkpoint row: a source and one of its tables.
+type checkpointKey struct {
+	source string
+	table  string
+}
+
+// dedupEvents drops the events at or before their table's checkpoint and
+// returns the rest, along with the last of them per source and table, to
+// checkpoint once applied. Events without a binlog position, i.e. polled
+// ones, are always applied; they are upserts.
+func dedupEvents(ctx context.Context, tx *sql.Tx, dialect database.Dialect, events []BinlogEvent) ([]BinlogEvent, []BinlogEvent, error) {
+	checkpoints := make(map[checkpointKey]*binlogPosition)
+	lastIndex := make(map[checkpointKey]int)
+	skipped := make(map[string]int)
+	var kept, last []BinlogEvent
+	for _, e := range events {
+		if e.BinlogFile == "" {
+			kept = append(kept, e)
+			continue
+		}
+
+		key := checkpointKey{source: checkpointSource(e.Source), table: e.Table}
+		checkpoint, ok := checkpoints[key]
+		if !ok {
+			var err error
+			if checkpoint, err = readCheckpoint(ctx, tx, dialect, key.source, key.table); err != nil {
+				return nil, nil, err
+			}
+			checkpoints[key] = checkpoint
+		}
+
+		pos := binlogPosition{file: e.BinlogFile, pos: e.BinlogPos}
+		if checkpoint != nil && !pos.after(*checkpoint) {
+			skipped[e.Table]++
+			continue
+		}
+		kept = append(kept, e)
+		if i, ok := lastIndex[key]; ok {
+			last[i] = e
+		} else {
+			lastIndex[key] = len(last)
+			last = append(last, e)
+		}
+	}
+
+	for table, count := range skipped {
+		metrics.EventsDeduplicated.WithLabelValues(table).Add(float64(count))
+		logger.Log.Info("Skipped events already applied to the target",
+			zap.String("table", table),
+			zap.Int("skipped", count),
+		)
+	}
+	return kept, last, nil
+}
+
+// earliestCheckpoint is the earliest of the positions applied from source
+// to tables, nil if none of them has one.
+func earliestCheckpoint(ctx context.Context, db *database.Database, source string, tables []string) (*binlogPosition, error) {
+	if len(tables) == 0 {
+		return nil, nil
+	}
+	if err := ensureCheckpointTable(ctx, db); err != nil {
+		return nil, err
+	}
+	args := []interface{}{source}
+	placeholders := make([]string, len(tables))
+	for i, table := range tables {
+		args = append(args, table)
+		placeholders[i] = db.Dialect.Placeholder(i + 2)
+	}
+	query := fmt.Sprintf("SELECT binlog_file, binlog_position FROM %s WHERE source_id = %s AND table_name IN (%s)",
+		db.Dialect.QuoteIdentifier(checkpointTable), db.Dialect.Placeholder(1), strings.Join(placeholders, ", "))
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var earliest *binlogPosition
+	for rows.Next() {
+		var pos binlogPosition
+		if err := rows.Scan(&pos.file, &pos.pos); err != nil {
+			return nil, fmt.Errorf("failed to read checkpoints: %w", err)
+		}
+		if earliest == nil || earliest.after(pos) {
+			earliest = &pos
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoints: %w", err)
+	}
+	return earliest, nil
+}
+
+// resumeFromTarget starts listener at the beginning of the binlog file
+// holding the earliest change applied to tables, per the target's
+// checkpoints; the file's start is the nearest position the listener can
+// read whole transactions from. The target skips the changes it already
+// has. Without checkpoints the listener starts as usual.
+func (m *Manager) resumeFromTarget(listener *BinlogListener, tables []string) error {
+	ctx, cancel := context.WithTimeout(m.ctx, preflightTimeout)
+	defer cancel()
+	source := checkpointSource(listener.source)
+	earliest, err := earliestCheckpoint(ctx, m.cloudDB, source, tables)
+	if err != nil {
+		return err
+	}
+	if earliest == nil {
+		logger.Log.Info("No target checkpoints to resume from, starting at the source's current position", zap.String("source", source))
+		return nil
+	}
+
+	files, err := binlogFiles(m.cfg.Databases.Local)
+	if err != nil {
+		return err
+	}
+	kept := false
+	for _, file := range files {
+		kept = kept || file == earliest.file
+	}
+	if !kept {
+		return fmt.Errorf("%w: binlog file %s, last applied to the target, is no longer on the source", ErrCheckpointLost, earliest.file)
+	}
+
+	logger.Log.Info("Resuming from the target's checkpoints",
+		zap.String("source", source),
+		zap.String("binlog_file", earliest.file),
+		zap.Uint32("applied_pos", earliest.pos),
+	)
+	return listener.StartAt(DumpCoordinates{BinlogFile: earliest.file, BinlogPos: 4})
+}
+
+func readCheckpoint(ctx context.Context, tx *sql.Tx, dialect database.Dialect, source, table string) (*binlogPosition, error) {
+	query := fmt.Sprintf("SELECT binlog_file, binlog_position FROM %s WHERE source_id = %s AND table_name = %s",
+		dialect.QuoteIdentifier(checkpointTable), dialect.Placeholder(1), dialect.Placeholder(2))
+
+	var pos binlogPosition
+	err := tx.QueryRowContext(ctx, query, source, table).Scan(&pos.file, &pos.pos)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	return &pos, nil
+}
+
+// writeCheckpoint records the last applied event, in the apply transaction.
+func writeCheckpoint(ctx context.Context, tx *sql.Tx, dialect database.Dialect, e BinlogEvent) error {
+	prefix, suffix := dialect.Upsert(checkpointTable, checkpointColumns, checkpointColumns[:2])
+	placeholders := make([]string, len(checkpointColumns))
+	for i := range placeholders {
+		placeholders[i] = dialect.Placeholder(i + 1)
+	}
+	query := prefix + "(" + strings.Join(placeholders, ", ") + ")" + suffix
+
+	_, err := tx.ExecContext(ctx, query, checkpointSource(e.Source), e.Table, e.BinlogFile, e.BinlogPos, e.GTID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package sync
+
+import (
+	"strings"
+)
+
+const (
+	// Merged upserts stay this far under the target's max_allowed_packet,
+	// which the size estimate doesn't account for exactly
+	packetHeadroom = 4
+	// The statement size cap when the target's limit can't be read, the
+	// server default
+	defaultMaxStatementBytes = 4 << 20
+)
+
+// pendingStatement is a statement the sink has yet to run, with the event
+// and router it was built from, for errors.
+type pendingStatement struct {
+	stmt   statement
+	event  BinlogEvent
+	router *tableRouter
+}
+
+// upsertKey is the key columns an update of the table can be upserted on
+// instead: nil for a table without a key, whose upserts would only add
+// rows, or with filtered routes, between which an update can move a row.
+func (r *tableRouter) upsertKey() []string {
+	if len(r.routes) != 1 || len(r.routes[0].filter) != 0 {
+		return nil
+	}
+	return r.routes[0].builder.pkColumns
+}
+
+// splitUpserts splits an update into runs of rows, in order, where rows
+// that keep their key become inserts, to be upserted.
+func splitUpserts(e BinlogEvent, key []string) ([]BinlogEvent, error) {
+	if e.Type != Update || len(key) == 0 {
+		return []BinlogEvent{e}, nil
+	}
+	if err := e.checkImages(); err != nil {
+		return nil, err
+	}
+	var keyIndexes []int
+	for columnIndex, column := range e.Columns {
+		for _, keyColumn := range key {
+			if strings.EqualFold(keyColumn, column) {
+				keyIndexes = append(keyIndexes, columnIndex)
+			}
+		}
+	}
+	if len(keyIndexes) != len(key) {
+		return []BinlogEvent{e}, nil
+	}
+
+	var parts []BinlogEvent
+	start := 0
+	for rowIndex := range e.Rows {
+		upsert := true
+		for _, columnIndex := range keyIndexes {
+			if !valuesEqual(e.Before[rowIndex][columnIndex], e.Rows[rowIndex][columnIndex]) {
+				upsert = false
+				break
+			}
+		}
+		if rowIndex > start && upsert != (parts[len(parts)-1].Type == Insert) {
+			start = rowIndex
+		}
+		if rowIndex == start {
+			part := e
+			if upsert {
+				part = upsertOf(e)
+			}
+			part.Rows, part.Before = nil, nil
+			parts = append(parts, part)
+		}
+		part := &parts[len(parts)-1]
+		part.Rows = append(part.Rows, e.Rows[rowIndex])
+		if !upsert {
+			part.Before = append(part.Before, e.Before[rowIndex])
+		}
+	}
+	return parts, nil
+}
+
+// coalesceUpserts merges consecutive upserts into the same table and
+// columns into multi-row statements of at most maxBytes, as estimated, and
+// the dialect's placeholder limit. A merged statement keeps the event and
+// router of its first part.
+func (s *mysqlSink) coalesceUpserts(pending []pendingStatement) []pendingStatement {
+	merged := make([]pendingStatement, 0, len(pending))
+	var (
+		run          *upsertRows // merged into the last statement so far
+		runParts     int
+		runBytes     int64
+		placeholders int
+	)
+	flush := func() {
+		if run != nil && runParts > 1 {
+			last := &merged[len(merged)-1]
+			stmt := renderUpsert(s.db.Dialect, run.prefix, run.suffix, run.rows)
+			stmt.table, stmt.operation = last.stmt.table, last.stmt.operation
+			last.stmt = stmt
+		}
+		run = nil
+	}
+	for _, p := range pending {
+		u := p.stmt.upsert
+		if u == nil {
+			flush()
+			merged = append(merged, p)
+			continue
+		}
+		size := estimateRowsSize(u.rows)
+		if run != nil && u.prefix == run.prefix && u.suffix == run.suffix &&
+			runBytes+size <= s.maxStatementBytes && placeholders+len(p.stmt.args) <= s.db.Dialect.MaxPlaceholders() {
+			run.rows = append(run.rows, u.rows...)
+			runParts++
+			runBytes += size
+			placeholders += len(p.stmt.args)
+			continue
+		}
+		flush()
+		merged = append(merged, p)
+		run = &upsertRows{prefix: u.prefix, suffix: u.suffix, rows: append([][]interface{}(nil), u.rows...)}
+		runParts = 1
+		runBytes = int64(len(u.prefix)+len(u.suffix)) + size
+		placeholders = len(p.stmt.args)
+	}
+	flush()
+	return merged
+}
@@ -3,81 +3,505 @@ package sync
 import (
 	"context"
 	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/google/uuid"
-	
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/alerting"
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/ids"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/metrics"
 	"mysql-sync-service/internal/store"
 )
 
+// Conflict types
+const (
+	// ConflictDataMismatch is a row changed on both sides to different values
+	ConflictDataMismatch = "data_mismatch"
+	// ConflictDeleteUpdate is a row deleted on one side and updated on
+	// the other
+	ConflictDeleteUpdate = "delete_update"
+	// ConflictInsertInsert is a row inserted on both sides under the same
+	// primary key with different data
+	ConflictInsertInsert = "insert_insert"
+	// ConflictUniqueKey is a row the target refused because a row with
+	// another primary key holds one of its unique keys
+	ConflictUniqueKey = "unique_key"
+)
+
+// conflictFlushTimeout bounds writing the waiting conflicts on Close.
+const conflictFlushTimeout = 10 * time.Second
+
+// ConflictManager records conflicts in the state store in batches, written
+// in the background within a rate limit, so a storm of conflicts, say after
+// a bad deploy, neither floods the store row by row nor pages once per
+// conflict: storms are summarized in one alert a minute.
 type ConflictManager struct {
-	store store.Store
+	store   store.Store
+	cfg     config.ConflictConfig
+	limiter *rateLimiter
+	flush   chan struct{}
+
+	mu      sync.Mutex
+	alerts  *alerting.Manager
+	written func(context.Context, []*store.Conflict) // see OnRecorded
+	pending []*store.Conflict
+	window  conflictWindow
+	storm   bool
+	failing bool // the last write failed; logged once until one succeeds
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
-func NewConflictManager(store store.Store) *ConflictManager {
-	return &ConflictManager{
-		store: store,
+// conflictWindow counts the conflicts of the current minute.
+type conflictWindow struct {
+	start   time.Time
+	total   int
+	dropped int
+	tables  map[string]int
+}
+
+func newConflictWindow() conflictWindow {
+	return conflictWindow{start: time.Now(), tables: make(map[string]int)}
+}
+
+func NewConflictManager(store store.Store, cfg config.ConflictConfig) *ConflictManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	cm := &ConflictManager{
+		store:   store,
+		cfg:     cfg,
+		limiter: &rateLimiter{rate: cfg.GetMaxPerSecond()},
+		flush:   make(chan struct{}, 1),
+		window:  newConflictWindow(),
+		ctx:     ctx,
+		cancel:  cancel,
 	}
+	cm.wg.Add(1)
+	go cm.run()
+	return cm
+}
+
+// SetAlerter sends storm summaries through alerts.
+func (cm *ConflictManager) SetAlerter(alerts *alerting.Manager) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.alerts = alerts
+}
+
+// OnRecorded calls fn with each batch of conflicts once it is written.
+func (cm *ConflictManager) OnRecorded(fn func(context.Context, []*store.Conflict)) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.written = fn
 }
 
-func (cm *ConflictManager) DetectConflict(ctx context.Context, table string, pk string, localData, cloudData map[string]interface{}) (bool, *store.Conflict) {
+// ConflictTrigger is the binlog event, and the row images within it, that
+// surfaced a conflict. It is stored with the conflict for investigation.
+type ConflictTrigger struct {
+	Event  BinlogEvent
+	Before map[string]interface{}
+	After  map[string]interface{}
+}
+
+// DetectConflict compares the local and cloud rows a change of eventType
+// touched, nil where a side has no row, and classifies any difference.
+// Rows are row images, as rowImage writes them.
+func (cm *ConflictManager) DetectConflict(ctx context.Context, table string, pk string, eventType EventType, localData, cloudData map[string]interface{}, trigger *ConflictTrigger) (bool, *store.Conflict) {
 	localHash := calculateHash(localData)
 	cloudHash := calculateHash(cloudData)
-	
+
 	if localHash == cloudHash {
 		return false, nil
 	}
-	
-	// Conflict detected
+	return true, newConflict(classifyConflict(eventType, localData != nil, cloudData != nil), table, pk, localData, cloudData, trigger)
+}
+
+// classifyConflict names the conflict a change of eventType ran into,
+// given which sides have the row.
+func classifyConflict(eventType EventType, sourceExists, targetExists bool) string {
+	switch {
+	case !sourceExists || !targetExists:
+		return ConflictDeleteUpdate
+	case eventType == Insert:
+		return ConflictInsertInsert
+	default:
+		return ConflictDataMismatch
+	}
+}
+
+// DefaultResolution is the strategy a conflict is resolved with unless
+// an operator picks another: the table's conflict_resolution, else last
+// write wins if the table has a timestamp column. Last write wins keeps
+// the updated row of a delete-update conflict, as a missing row never
+// wins. Unique key collisions involve two different rows, so only an
+// operator can resolve them.
+func DefaultResolution(table config.TableConfig, conflictType string) string {
+	switch {
+	case conflictType == ConflictUniqueKey:
+		return ResolveManual
+	case table.ConflictResolution != "":
+		return table.ConflictResolution
+	case table.TimestampColumn != "":
+		return ResolveLastWriteWins
+	default:
+		return ResolveManual
+	}
+}
+
+// uniqueKeyError is a change the target refused because another row holds
+// one of its unique keys.
+type uniqueKeyError struct {
+	event BinlogEvent
+	err   error
+}
+
+func (e *uniqueKeyError) Error() string { return e.err.Error() }
+func (e *uniqueKeyError) Unwrap() error { return e.err }
+
+// recordUniqueKeyConflicts records a unique key conflict for each row of
+// the change the target refused. The row holding the key isn't known, so
+// the cloud side is left empty.
+func (cm *ConflictManager) recordUniqueKeyConflicts(ctx context.Context, collision *uniqueKeyError) {
+	e := collision.event
+	for i, row := range e.Rows {
+		pk := ""
+		if i < len(e.PrimaryKeys) {
+			pk = e.PrimaryKeys[i]
+		}
+		local := rowImage(e, row)
+		conflict := newConflict(ConflictUniqueKey, e.Table, pk, local, nil, &ConflictTrigger{Event: e, After: local})
+		cm.RecordConflict(ctx, conflict)
+	}
+}
+
+// rowImage is one of e's rows as conflicts store it: binary values as the
+// hex of their exact bytes, which typedRow reads back by column type, and
+// other values as jsonRow writes them.
+func rowImage(e BinlogEvent, row []interface{}) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+	values := make(map[string]interface{}, len(e.Columns))
+	for i, column := range e.Columns {
+		if i >= len(row) {
+			break
+		}
+		value := jsonValue(row[i])
+		if i < len(e.ColumnTypes) && isBinaryType(e.ColumnTypes[i]) {
+			switch v := row[i].(type) {
+			case []byte:
+				value = hex.EncodeToString(v)
+			case string:
+				value = hex.EncodeToString([]byte(v))
+			}
+		}
+		values[column] = value
+	}
+	return values
+}
+
+func newConflict(conflictType, table, pk string, localData, cloudData map[string]interface{}, trigger *ConflictTrigger) *store.Conflict {
 	conflict := &store.Conflict{
-		ID:              uuid.New().String(),
+		ID:              ids.New(),
 		TableName:       table,
 		PrimaryKeyValue: pk,
-		ConflictType:    "data_mismatch",
+		ConflictType:    conflictType,
 		DetectedAt:      time.Now(),
 		Resolved:        false,
 	}
-	
+
 	localBytes, _ := json.Marshal(localData)
 	cloudBytes, _ := json.Marshal(cloudData)
-	
+
 	conflict.LocalData = json.RawMessage(localBytes)
 	conflict.CloudData = json.RawMessage(cloudBytes)
-	
-	return true, conflict
+
+	if trigger != nil {
+		attachTrigger(conflict, trigger)
+	}
+	return conflict
 }
 
+// RecordConflict queues conflict for the next batch and never blocks. When
+// the buffer is full the conflict is dropped; drops are counted and
+// reported in the storm summary.
 func (cm *ConflictManager) RecordConflict(ctx context.Context, conflict *store.Conflict) error {
-	return cm.store.CreateConflict(ctx, conflict)
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.window.total++
+	cm.window.tables[conflict.TableName]++
+	if len(cm.pending) >= cm.cfg.GetMaxBuffered() {
+		cm.window.dropped++
+		metrics.ConflictsDropped.WithLabelValues(conflict.TableName).Inc()
+		return nil
+	}
+	cm.pending = append(cm.pending, conflict)
+	metrics.ConflictsPending.Set(float64(len(cm.pending)))
+	if len(cm.pending) >= cm.cfg.GetBatchSize() {
+		select {
+		case cm.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
 }
 
+// Close writes the conflicts still waiting, giving up after
+// conflictFlushTimeout.
+func (cm *ConflictManager) Close() {
+	cm.cancel()
+	cm.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), conflictFlushTimeout)
+	defer cancel()
+	if err := cm.writePending(ctx); err != nil {
+		cm.mu.Lock()
+		lost := len(cm.pending)
+		cm.mu.Unlock()
+		logger.Log.Error("Failed to write conflicts on shutdown", zap.Int("conflicts", lost), zap.Error(err))
+	}
+}
+
+func (cm *ConflictManager) run() {
+	defer cm.wg.Done()
+	ticker := time.NewTicker(cm.cfg.GetFlushInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cm.ctx.Done():
+			return
+		case <-ticker.C:
+			cm.summarize()
+		case <-cm.flush:
+		}
+		cm.writePending(cm.ctx)
+	}
+}
+
+// writePending writes the waiting conflicts a batch at a time. A batch that
+// fails is put back, to be retried on the next flush.
+func (cm *ConflictManager) writePending(ctx context.Context) error {
+	batchSize := cm.cfg.GetBatchSize()
+	for {
+		cm.mu.Lock()
+		n := len(cm.pending)
+		if n > batchSize {
+			n = batchSize
+		}
+		batch := cm.pending[:n:n]
+		cm.pending = cm.pending[n:]
+		cm.mu.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err := cm.limiter.Wait(ctx, len(batch))
+		if err == nil {
+			err = cm.store.CreateConflicts(ctx, batch)
+		}
+		cm.mu.Lock()
+		if err != nil {
+			cm.pending = append(batch, cm.pending...)
+		}
+		metrics.ConflictsPending.Set(float64(len(cm.pending)))
+		wasFailing, failing, pending := cm.failing, err != nil && ctx.Err() == nil, len(cm.pending)
+		cm.failing = failing
+		written := cm.written
+		cm.mu.Unlock()
+		if err != nil {
+			if failing && !wasFailing {
+				logger.Log.Warn("Failed to write conflicts, holding them until the state store is back", zap.Int("conflicts", pending), zap.Error(err))
+			}
+			return err
+		}
+		if wasFailing {
+			logger.Log.Info("State store back, writing held conflicts", zap.Int("conflicts", pending+len(batch)))
+		}
+		if written != nil {
+			written(ctx, batch)
+		}
+	}
+}
+
+// summarize closes the current minute, alerting on it if it was a storm
+// and on the storm's end.
+func (cm *ConflictManager) summarize() {
+	cm.mu.Lock()
+	elapsed := time.Since(cm.window.start)
+	if elapsed < time.Minute {
+		cm.mu.Unlock()
+		return
+	}
+	window := cm.window
+	cm.window = newConflictWindow()
+	wasStorm, storm := cm.storm, window.total >= cm.cfg.GetStormThreshold()
+	cm.storm = storm
+	alerts := cm.alerts
+	cm.mu.Unlock()
+
+	switch {
+	case storm:
+		message := fmt.Sprintf("%d conflicts in the last %s: %s", window.total, elapsed.Round(time.Second), summarizeTables(window.tables))
+		if window.dropped > 0 {
+			message += fmt.Sprintf("; %d dropped, not recorded", window.dropped)
+		}
+		logger.Log.Warn("Conflict storm", zap.Int("conflicts", window.total), zap.Int("dropped", window.dropped), zap.Int("tables", len(window.tables)))
+		alerts.Fire(alerting.Alert{
+			Kind:     alerting.KindConflictStorm,
+			Severity: alerting.SeverityWarning,
+			Title:    "Conflict storm",
+			Message:  message,
+			Fields:   map[string]string{"conflicts": fmt.Sprint(window.total), "dropped": fmt.Sprint(window.dropped)},
+		})
+	case wasStorm:
+		alerts.Fire(alerting.Alert{
+			Kind:     alerting.KindConflictStorm,
+			Severity: alerting.SeverityInfo,
+			Title:    "Conflict storm over",
+			Message:  fmt.Sprintf("%d conflicts in the last %s", window.total, elapsed.Round(time.Second)),
+			Resolved: true,
+		})
+	}
+}
+
+// summarizeTables lists the tables with the most conflicts first.
+func summarizeTables(tables map[string]int) string {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if tables[names[i]] != tables[names[j]] {
+			return tables[names[i]] > tables[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	const shown = 5
+	parts := make([]string, 0, shown+1)
+	for i, name := range names {
+		if i == shown {
+			parts = append(parts, fmt.Sprintf("%d more tables", len(names)-shown))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s (%d)", name, tables[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func attachTrigger(conflict *store.Conflict, trigger *ConflictTrigger) {
+	event := trigger.Event
+	conflict.BinlogFile = sql.NullString{String: event.BinlogFile, Valid: event.BinlogFile != ""}
+	conflict.BinlogPosition = sql.NullInt64{Int64: int64(event.BinlogPos), Valid: event.BinlogFile != ""}
+	conflict.GTID = sql.NullString{String: event.GTID, Valid: event.GTID != ""}
+	conflict.EventType = sql.NullString{String: string(event.Type), Valid: event.Type != ""}
+	conflict.SourceSite = sql.NullString{String: event.Source.SiteID, Valid: event.Source.SiteID != ""}
+	conflict.SourceHost = sql.NullString{String: event.Source.Host, Valid: event.Source.Host != ""}
+	conflict.SourceServerUUID = sql.NullString{String: event.Source.ServerUUID, Valid: event.Source.ServerUUID != ""}
+	conflict.SchemaVersion = sql.NullInt64{Int64: int64(event.SchemaVersion), Valid: event.SchemaVersion > 0}
+
+	if trigger.Before != nil {
+		beforeBytes, _ := json.Marshal(trigger.Before)
+		conflict.EventBefore = json.RawMessage(beforeBytes)
+	}
+	if trigger.After != nil {
+		afterBytes, _ := json.Marshal(trigger.After)
+		conflict.EventAfter = json.RawMessage(afterBytes)
+	}
+}
+
+// calculateHash hashes a row by its JSON encoding, which orders columns by
+// name, with values made canonical; rowHash gives typed ones theirs.
 func calculateHash(data map[string]interface{}) string {
-	// TODO: Implement consistent hashing (sort keys, handle types)
-	// For now, simple JSON string hash
-	bytes, _ := json.Marshal(data)
+	if data == nil {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte("null")))
+	}
+	canonical := make(map[string]interface{}, len(data))
+	for column, value := range data {
+		canonical[column] = canonicalValue("", value)
+	}
+	bytes, _ := json.Marshal(canonical)
 	sum := sha256.Sum256(bytes)
 	return fmt.Sprintf("%x", sum)
 }
 
-// Strategy interface for resolution
+// ResolutionStrategy picks the row a conflict is resolved to, from the
+// rows recorded with it; nil deletes the row.
 type ResolutionStrategy interface {
 	Resolve(conflict *store.Conflict) (map[string]interface{}, error)
 }
 
+// NewResolutionStrategy returns the strategy called name for table. Manual
+// resolution has none: an operator supplies the row.
+func NewResolutionStrategy(name string, table config.TableConfig) (ResolutionStrategy, error) {
+	switch name {
+	case ResolveLocalWins:
+		return &LocalWinsStrategy{}, nil
+	case ResolveCloudWins:
+		return &CloudWinsStrategy{}, nil
+	case ResolveLastWriteWins:
+		if table.TimestampColumn == "" {
+			return nil, fmt.Errorf("%w: %s has no timestamp_column for last_write_wins", ErrInvalidResolution, table.Name)
+		}
+		return &LastWriteWinsStrategy{TimestampColumn: table.TimestampColumn}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown strategy %q", ErrInvalidResolution, name)
+	}
+}
+
+// LocalWinsStrategy resolves to the local row, for tables whose system of
+// record is the local database. A row deleted locally stays deleted.
+type LocalWinsStrategy struct{}
+
+func (s *LocalWinsStrategy) Resolve(conflict *store.Conflict) (map[string]interface{}, error) {
+	row, err := decodeRow(conflict.LocalData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local data: %w", err)
+	}
+	return row, nil
+}
+
+// CloudWinsStrategy resolves to the cloud row, for tables whose system of
+// record is the cloud database.
+type CloudWinsStrategy struct{}
+
+func (s *CloudWinsStrategy) Resolve(conflict *store.Conflict) (map[string]interface{}, error) {
+	row, err := decodeRow(conflict.CloudData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cloud data: %w", err)
+	}
+	return row, nil
+}
+
+// LastWriteWinsStrategy resolves to the row with the later TimestampColumn.
 type LastWriteWinsStrategy struct {
 	TimestampColumn string
 }
 
 func (s *LastWriteWinsStrategy) Resolve(conflict *store.Conflict) (map[string]interface{}, error) {
-	// Parse local and cloud data to maps
-	var local, cloud map[string]interface{}
-	json.Unmarshal(conflict.LocalData, &local)
-	json.Unmarshal(conflict.CloudData, &cloud)
-	
-	// Compare timestamps
-	// ... logic to compare s.TimestampColumn
-	
-	return local, nil // Placeholder
+	local, err := decodeRow(conflict.LocalData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local data: %w", err)
+	}
+	cloud, err := decodeRow(conflict.CloudData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cloud data: %w", err)
+	}
+	winner, _, ok := newerRow(s.TimestampColumn, local, cloud)
+	if !ok {
+		return nil, fmt.Errorf("%w: the rows can't be compared on the table's timestamp_column", ErrInvalidResolution)
+	}
+	return winner, nil
 }
@@ -0,0 +1,205 @@
+package sync
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/database"
+	"mysql-sync-service/internal/logger"
+)
+
+// Kinds of table copies
+const (
+	CopyDump   = "dump"
+	CopyResync = "resync"
+)
+
+// Table copy statuses
+const (
+	CopyPending   = "pending"
+	CopyCopying   = "copying"
+	CopyApplying  = "applying" // read in full, the last rows being applied
+	CopyCompleted = "completed"
+	CopyFailed    = "failed"
+)
+
+const (
+	// A table's progress is published to subscribers at most this often,
+	// and on every status change
+	copyPublishInterval = time.Second
+	copyEstimateTimeout = 10 * time.Second
+)
+
+// SnapshotProgress is how far the copy of a table, by a dump load or a
+// resync, has got. The estimate comes from the source's table statistics,
+// so the percentage and ETA are approximate.
+type SnapshotProgress struct {
+	Table         string     `json:"table"`
+	RunID         string     `json:"run_id"`
+	Kind          string     `json:"kind"`
+	Status        string     `json:"status"`
+	RowsCopied    int64      `json:"rows_copied"`
+	EstimatedRows int64      `json:"estimated_rows"`
+	Percent       float64    `json:"percent"`
+	RowsPerSecond float64    `json:"rows_per_second"`
+	ETASeconds    *float64   `json:"eta_seconds,omitempty"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// copyProgress tracks table copies for the API and the event stream. It
+// outlives runs, so the last copy of each table can still be looked at.
+type copyProgress struct {
+	mu     sync.Mutex
+	events *eventHub
+	tables map[string]*tableCopy
+}
+
+type tableCopy struct {
+	progress  SnapshotProgress
+	copiedAt  time.Time // when the last rows were copied
+	published time.Time
+}
+
+func newCopyProgress(events *eventHub) *copyProgress {
+	return &copyProgress{events: events, tables: make(map[string]*tableCopy)}
+}
+
+// begin tracks a copy of tables as pending, replacing their last one, with
+// row estimates from source.
+func (p *copyProgress) begin(ctx context.Context, source *database.Database, runID, kind string, tables []string) {
+	ctx, cancel := context.WithTimeout(ctx, copyEstimateTimeout)
+	defer cancel()
+	estimates := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		rows, err := source.EstimatedRows(ctx, table)
+		if err != nil {
+			logger.Log.Debug("Failed to estimate table rows", zap.String("table", table), zap.Error(err))
+		}
+		estimates[table] = rows
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, table := range tables {
+		p.tables[table] = &tableCopy{progress: SnapshotProgress{
+			Table:         table,
+			RunID:         runID,
+			Kind:          kind,
+			Status:        CopyPending,
+			EstimatedRows: estimates[table],
+		}}
+	}
+}
+
+// copied counts rows of table as copied.
+func (p *copyProgress) copied(table string, rows int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.tables[table]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	changed := t.progress.Status == CopyPending
+	if changed {
+		t.progress.Status = CopyCopying
+		t.progress.StartedAt = &now
+	}
+	t.progress.RowsCopied += int64(rows)
+	t.copiedAt = now
+	if changed || now.Sub(t.published) >= copyPublishInterval {
+		p.publish(t, now)
+	}
+}
+
+// setStatus moves the unfinished copies of tables to status; completed and
+// failed finish them, failed with err.
+func (p *copyProgress) setStatus(tables []string, status string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for _, table := range tables {
+		t, ok := p.tables[table]
+		if !ok || t.progress.FinishedAt != nil {
+			continue
+		}
+		t.progress.Status = status
+		if status == CopyCompleted || status == CopyFailed {
+			t.progress.FinishedAt = &now
+		}
+		if err != nil {
+			t.progress.Error = err.Error()
+		}
+		p.publish(t, now)
+	}
+}
+
+// publish sends t's progress to subscribers; p.mu must be held.
+func (p *copyProgress) publish(t *tableCopy, now time.Time) {
+	t.published = now
+	view := t.view(now)
+	p.events.publish(SyncEvent{
+		Type:     EventSnapshotProgress,
+		RunID:    view.RunID,
+		Table:    view.Table,
+		Status:   view.Status,
+		Error:    view.Error,
+		Progress: &view,
+		Time:     now,
+	})
+}
+
+// view works out the rate, percentage and ETA as of now. The rate is over
+// the whole copy so far; once the rows are all read it stops at the last.
+func (t *tableCopy) view(now time.Time) SnapshotProgress {
+	view := t.progress
+	if view.StartedAt != nil {
+		end := now
+		if view.Status != CopyCopying {
+			end = t.copiedAt
+		}
+		if elapsed := end.Sub(*view.StartedAt).Seconds(); elapsed > 0 {
+			view.RowsPerSecond = float64(view.RowsCopied) / elapsed
+		}
+	}
+	switch {
+	case view.Status == CopyCompleted:
+		view.Percent = 100
+	case view.EstimatedRows > 0:
+		view.Percent = float64(view.RowsCopied) * 100 / float64(view.EstimatedRows)
+		if view.Percent > 100 {
+			// The estimate was low; the copy isn't done until it says so
+			view.Percent = 99.9
+		}
+	}
+	if view.Status == CopyCopying && view.RowsPerSecond > 0 && view.EstimatedRows > view.RowsCopied {
+		eta := float64(view.EstimatedRows-view.RowsCopied) / view.RowsPerSecond
+		view.ETASeconds = &eta
+	}
+	return view
+}
+
+// Snapshot lists the tracked copies by table.
+func (p *copyProgress) Snapshot() []SnapshotProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	snapshot := make([]SnapshotProgress, 0, len(p.tables))
+	for _, t := range p.tables {
+		snapshot = append(snapshot, t.view(now))
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Table < snapshot[j].Table })
+	return snapshot
+}
+
+// SnapshotProgress lists the progress of the latest copy of each table
+// loaded from a dump or resynced.
+func (m *Manager) SnapshotProgress() []SnapshotProgress {
+	return m.copies.Snapshot()
+}
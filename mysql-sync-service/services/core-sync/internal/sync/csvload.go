@@ -0,0 +1,144 @@
+package sync
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+)
+
+// csvNull is how a NULL is written in CSV files, as SELECT ... INTO OUTFILE
+// and mysqlimport do.
+const csvNull = `\N`
+
+// NewCSVLoader bootstraps the target from a CSV file per table, e.g. where
+// a live snapshot of the source is impractical, instead of a mysqldump
+// file. The files must have been exported at coords, read off the source
+// with SHOW MASTER STATUS when it was, so changes made since are replayed
+// from there once they are applied.
+//
+// Each file, gzipped if it ends in .gz, starts with a header row naming
+// its columns; \N is NULL. Only the tables given files are loaded, and
+// they must be captured from the binlog.
+func NewCSVLoader(files map[string]string, coords DumpCoordinates, cfg config.DatabaseConnection, tables []config.TableConfig, queue eventQueue, run *syncRun) (*DumpLoader, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: no CSV files", ErrInvalidDump)
+	}
+	if err := checkCoordinates(coords); err != nil {
+		return nil, err
+	}
+
+	tableMap := make(map[string]config.TableConfig, len(files))
+	paths := make([]string, 0, len(files))
+	var taken os.FileInfo
+	for table, path := range files {
+		for _, tableConfig := range tables {
+			if tableConfig.Name == table {
+				tableMap[table] = tableConfig
+			}
+		}
+		if _, ok := tableMap[table]; !ok {
+			return nil, fmt.Errorf("%w: table %s isn't captured from the binlog in this run", ErrInvalidDump, table)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+		}
+		if taken == nil || info.ModTime().After(taken.ModTime()) {
+			taken = info
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	d := newDumpLoader(strings.Join(paths, ","), coords, cfg, tableMap, queue, run, taken.ModTime())
+	d.csv = files
+	return d, nil
+}
+
+// loadCSV queues the rows of each table's CSV file and returns how many it
+// queued.
+func (d *DumpLoader) loadCSV() (int, error) {
+	tables := make([]string, 0, len(d.csv))
+	for table := range d.csv {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	total := 0
+	for _, table := range tables {
+		rows, err := d.loadCSVFile(d.tables[table], d.csv[table])
+		total += rows
+		if err != nil {
+			return total, fmt.Errorf("table %s: %w", table, err)
+		}
+		logger.Log.Info("CSV file loaded",
+			zap.String("run_id", d.run.id),
+			zap.String("table", table),
+			zap.String("path", d.csv[table]),
+			zap.Int("rows", rows),
+		)
+	}
+	return total, nil
+}
+
+func (d *DumpLoader) loadCSVFile(table config.TableConfig, path string) (int, error) {
+	f, closeFile, err := openDump(path)
+	if err != nil {
+		return 0, err
+	}
+	defer closeFile()
+
+	r := csv.NewReader(f)
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err == io.EOF {
+		return 0, fmt.Errorf("%w: no header row", ErrInvalidDump)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+	}
+	columns := make([]string, len(header))
+	for i, column := range header {
+		columns[i] = strings.TrimSpace(column)
+	}
+	columns[0] = strings.TrimPrefix(columns[0], "\ufeff") // a byte order mark
+
+	t, err := d.newDumpTable(table, columns)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return t.total, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+			}
+			return t.total, err
+		}
+		row := make([]interface{}, len(record))
+		for i, field := range record {
+			if field == csvNull {
+				row[i] = nil
+			} else {
+				row[i] = field
+			}
+		}
+		if err := t.add(row); err != nil {
+			return t.total, err
+		}
+	}
+	return t.total, t.flush()
+}
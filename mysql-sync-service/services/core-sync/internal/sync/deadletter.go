@@ -0,0 +1,69 @@
+package sync
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/ids"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/store"
+)
+
+// deadLetterPayload is the stored form of a failed event's rows.
+type deadLetterPayload struct {
+	Schema      string                   `json:"schema"`
+	Columns     []string                 `json:"columns"`
+	ColumnMeta  []EventColumn            `json:"column_meta,omitempty"`
+	Rows        []map[string]interface{} `json:"rows"`
+	Before      []map[string]interface{} `json:"before,omitempty"` // updates' old images, one per row
+	PrimaryKeys []string                 `json:"primary_keys,omitempty"`
+	SourceSite  string                   `json:"source_site,omitempty"`
+}
+
+// deadLetter parks events that failed to apply so the batch can move on.
+// Rows are kept in full so they can be replayed by hand.
+func (w *Worker) deadLetter(events []BinlogEvent, applyErr error) {
+	for _, e := range events {
+		payload := deadLetterPayload{
+			Schema:      e.Schema,
+			Columns:     e.Columns,
+			ColumnMeta:  e.ColumnMeta(),
+			PrimaryKeys: e.PrimaryKeys,
+			SourceSite:  e.Source.SiteID,
+		}
+		for _, row := range e.Rows {
+			payload.Rows = append(payload.Rows, jsonRow(e.Columns, row))
+		}
+		for _, row := range e.Before {
+			payload.Before = append(payload.Before, jsonRow(e.Columns, row))
+		}
+		data, err := json.Marshal(payload)
+		if err != nil {
+			logger.Log.Error("Failed to encode dead letter", append(eventFields(w.pool.run.id, e), zap.Error(err))...)
+			continue
+		}
+
+		err = w.pool.store.CreateDeadLetter(w.pool.ctx, &store.DeadLetter{
+			ID:             ids.New(),
+			RunID:          w.pool.run.id,
+			TableName:      e.Table,
+			EventType:      string(e.Type),
+			BinlogFile:     sql.NullString{String: e.BinlogFile, Valid: e.BinlogFile != ""},
+			BinlogPosition: sql.NullInt64{Int64: int64(e.BinlogPos), Valid: e.BinlogFile != ""},
+			GTID:           sql.NullString{String: e.GTID, Valid: e.GTID != ""},
+			Payload:        data,
+			ErrorMessage:   applyErr.Error(),
+			CreatedAt:      time.Now(),
+			SchemaVersion:  sql.NullInt64{Int64: int64(e.SchemaVersion), Valid: e.SchemaVersion > 0},
+		})
+		if err != nil {
+			logger.Log.Error("Failed to store dead letter", append(eventFields(w.pool.run.id, e), zap.Error(err))...)
+			w.pool.run.stats.DeadLetterUnsaved()
+			continue
+		}
+		w.pool.run.stats.DeadLettered()
+	}
+}
@@ -0,0 +1,183 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"mysql-sync-service/internal/store"
+)
+
+// Value types of a ColumnDiff, as the values were recorded
+const (
+	ValueNull    = "null"
+	ValueString  = "string"
+	ValueNumber  = "number"
+	ValueBool    = "bool"
+	ValueObject  = "object"
+	ValueArray   = "array"
+	ValueMissing = "missing" // the row, or the column, isn't on that side
+)
+
+// ColumnDiff is a column that differs between two rows.
+type ColumnDiff struct {
+	Column    string      `json:"column"`
+	Local     interface{} `json:"local"`
+	Cloud     interface{} `json:"cloud"`
+	LocalType string      `json:"local_type"`
+	CloudType string      `json:"cloud_type"`
+}
+
+// ConflictDiff lists the columns the conflict's local and cloud rows
+// differ in, by column name.
+func ConflictDiff(conflict *store.Conflict) ([]ColumnDiff, error) {
+	local, err := decodeRow(conflict.LocalData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local data: %w", err)
+	}
+	cloud, err := decodeRow(conflict.CloudData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cloud data: %w", err)
+	}
+	return diffRows(local, cloud), nil
+}
+
+// diffRows compares two rows column by column; a nil row is missing
+// every column.
+func diffRows(local, cloud map[string]interface{}) []ColumnDiff {
+	seen := make(map[string]bool, len(local)+len(cloud))
+	columns := make([]string, 0, len(local)+len(cloud))
+	for _, row := range []map[string]interface{}{local, cloud} {
+		for column := range row {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	sort.Strings(columns)
+
+	diffs := make([]ColumnDiff, 0)
+	for _, column := range columns {
+		localValue, inLocal := local[column]
+		cloudValue, inCloud := cloud[column]
+		if inLocal == inCloud && reflect.DeepEqual(localValue, cloudValue) {
+			continue
+		}
+		diffs = append(diffs, ColumnDiff{
+			Column:    column,
+			Local:     localValue,
+			Cloud:     cloudValue,
+			LocalType: valueType(localValue, inLocal),
+			CloudType: valueType(cloudValue, inCloud),
+		})
+	}
+	return diffs
+}
+
+func valueType(value interface{}, present bool) string {
+	if !present {
+		return ValueMissing
+	}
+	switch value.(type) {
+	case nil:
+		return ValueNull
+	case string:
+		return ValueString
+	case json.Number:
+		return ValueNumber
+	case bool:
+		return ValueBool
+	case map[string]interface{}:
+		return ValueObject
+	case []interface{}:
+		return ValueArray
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// ResolutionPreview is what each strategy would resolve a conflict to.
+type ResolutionPreview struct {
+	ConflictID string              `json:"conflict_id"`
+	Table      string              `json:"table"`
+	Diff       []ColumnDiff        `json:"diff"`
+	Options    []PreviewedStrategy `json:"options"`
+}
+
+// PreviewedStrategy is one strategy's resolved row, nil if the row would be
+// deleted, and the columns each database would change to get it. A
+// strategy that can't resolve the conflict has Error set instead.
+type PreviewedStrategy struct {
+	Strategy     string                 `json:"strategy"`
+	Default      bool                   `json:"default,omitempty"` // the table's DefaultResolution
+	Row          map[string]interface{} `json:"row"`
+	Delete       bool                   `json:"delete,omitempty"`
+	LocalChanges []ColumnChange         `json:"local_changes,omitempty"`
+	CloudChanges []ColumnChange         `json:"cloud_changes,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+// ColumnChange is a column a resolution would change in one database.
+type ColumnChange struct {
+	Column   string      `json:"column"`
+	From     interface{} `json:"from"`
+	To       interface{} `json:"to"`
+	FromType string      `json:"from_type"`
+	ToType   string      `json:"to_type"`
+}
+
+// resolutionChanges lists the columns that change when from becomes to.
+func resolutionChanges(from, to map[string]interface{}) []ColumnChange {
+	diffs := diffRows(from, to)
+	changes := make([]ColumnChange, len(diffs))
+	for i, d := range diffs {
+		changes[i] = ColumnChange{Column: d.Column, From: d.Local, To: d.Cloud, FromType: d.LocalType, ToType: d.CloudType}
+	}
+	return changes
+}
+
+// PreviewResolutions resolves the conflict with every automatic strategy,
+// and the manually resolved row if there is one, without writing either
+// database.
+func (m *Manager) PreviewResolutions(ctx context.Context, conflict *store.Conflict) (*ResolutionPreview, error) {
+	sides, err := m.conflictSides(ctx, conflict)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := ConflictDiff(conflict)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &ResolutionPreview{ConflictID: conflict.ID, Table: conflict.TableName, Diff: diff}
+	defaultStrategy := DefaultResolution(*sides.table, conflict.ConflictType)
+	add := func(strategy string, row map[string]interface{}, err error) {
+		option := PreviewedStrategy{Strategy: strategy, Default: strategy == defaultStrategy}
+		if err != nil {
+			option.Error = err.Error()
+		} else {
+			option.Row = row
+			option.Delete = row == nil
+			option.LocalChanges = resolutionChanges(sides.local.row, row)
+			option.CloudChanges = resolutionChanges(sides.cloud.row, row)
+		}
+		preview.Options = append(preview.Options, option)
+	}
+
+	for _, strategy := range []string{ResolveLocalWins, ResolveCloudWins, ResolveLastWriteWins} {
+		if conflict.ConflictType == ConflictUniqueKey {
+			add(strategy, nil, fmt.Errorf("%w: a unique key collision can only be resolved manually", ErrInvalidResolution))
+			continue
+		}
+		row, err := resolutionWinner(strategy, conflict, sides, nil)
+		add(strategy, row, err)
+	}
+	if len(conflict.ResolvedData) > 0 {
+		row, err := resolutionWinner(ResolveManual, conflict, sides, conflict.ResolvedData)
+		add(ResolveManual, row, err)
+	}
+	return preview, nil
+}
@@ -0,0 +1,219 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
+	"mysql-sync-service/internal/logger"
+)
+
+// hasTablePatterns reports whether cfg selects tables by pattern rather
+// than by name alone.
+func hasTablePatterns(cfg config.SyncConfig) bool {
+	if cfg.IncludeAll {
+		return true
+	}
+	for _, table := range cfg.Tables {
+		if config.IsTablePattern(table.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectTables expands the patterns of cfg against the source: the tables
+// named in cfg.Tables come first, as they are, then in name order every
+// other source table a pattern selects, with the first matching pattern's
+// settings, or that IncludeAll selects, with none, unless Exclude matches
+// it. Patterns match table names within one schema. A selected table is
+// left out, and recorded in skipped, while it has no primary key or, for a
+// MySQL target, no target table.
+func selectTables(ctx context.Context, cfg config.SyncConfig, source, target *database.Database, skipped map[string]string) ([]config.TableConfig, error) {
+	var tables, patterns []config.TableConfig
+	named := make(map[string]bool)
+	schemas := make(map[string]bool)
+	if cfg.IncludeAll {
+		schemas[source.Config.Database] = true
+	}
+	for _, table := range cfg.Tables {
+		if !config.IsTablePattern(table.Name) {
+			tables = append(tables, table)
+			named[table.Name] = true
+			continue
+		}
+		schema, name := config.SplitTable(table.Name, source.Config.Database)
+		if _, err := path.Match(name, ""); err != nil || config.IsTablePattern(schema) {
+			return nil, fmt.Errorf("table %s: invalid pattern, only table names may hold wildcards", table.Name)
+		}
+		schemas[schema] = true
+		patterns = append(patterns, table)
+	}
+	for _, exclude := range cfg.Exclude {
+		if _, err := path.Match(exclude, ""); err != nil {
+			return nil, fmt.Errorf("exclude %s: invalid pattern", exclude)
+		}
+	}
+
+	names := make([]string, 0, len(schemas))
+	for schema := range schemas {
+		names = append(names, schema)
+	}
+	sort.Strings(names)
+	for _, schema := range names {
+		sourceTables, err := source.ListTables(ctx, schema)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range sourceTables {
+			qualified := name
+			if schema != source.Config.Database {
+				qualified = schema + "." + name
+			}
+			if named[qualified] || excluded(cfg.Exclude, qualified, name) {
+				continue
+			}
+			table, ok := matchPattern(patterns, source.Config.Database, schema, name)
+			if !ok && !(cfg.IncludeAll && schema == source.Config.Database) {
+				continue
+			}
+			table.Name = qualified
+			table = cfg.MapSchema(table)
+
+			if reason := checkSelected(ctx, &table, source, target, writesToTarget(cfg)); reason != "" {
+				if skipped[qualified] != reason {
+					logger.Log.Warn("Leaving out table selected by pattern", zap.String("table", qualified), zap.String("reason", reason))
+				}
+				skipped[qualified] = reason
+				continue
+			}
+			delete(skipped, qualified)
+			tables = append(tables, table)
+		}
+	}
+	return tables, nil
+}
+
+// excluded reports whether an exclude pattern matches the table, by its
+// qualified name or its name alone.
+func excluded(excludes []string, qualified, name string) bool {
+	for _, exclude := range excludes {
+		if ok, _ := path.Match(exclude, qualified); ok {
+			return true
+		}
+		if ok, _ := path.Match(exclude, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern returns a copy of the first pattern selecting schema.name.
+func matchPattern(patterns []config.TableConfig, database, schema, name string) (config.TableConfig, bool) {
+	for _, pattern := range patterns {
+		patternSchema, patternName := config.SplitTable(pattern.Name, database)
+		if ok, _ := path.Match(patternName, name); ok && patternSchema == schema {
+			return pattern, true
+		}
+	}
+	return config.TableConfig{}, false
+}
+
+// checkSelected gives a selected table the source's primary key if it
+// names none, and returns why it can't be synced, or "" if it can.
+func checkSelected(ctx context.Context, table *config.TableConfig, source, target *database.Database, checkTarget bool) string {
+	if table.PrimaryKey == "" {
+		schema, err := source.DescribeTable(ctx, table.Name)
+		if err != nil {
+			return err.Error()
+		}
+		if len(schema.PrimaryKey) == 0 {
+			return "no primary key"
+		}
+		table.PrimaryKey = strings.Join(schema.PrimaryKey, ",")
+	}
+	if checkTarget && len(table.Routes) == 0 {
+		if _, err := target.DescribeTable(ctx, table.GetTargetName()); err != nil {
+			return fmt.Sprintf("target table %s: %v", table.GetTargetName(), err)
+		}
+	}
+	return ""
+}
+
+// discoverTables checks the source for new tables the patterns select
+// every interval, until the manager closes.
+func (m *Manager) discoverTables(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(m.ctx, 30*time.Second)
+		selected, err := selectTables(ctx, *m.selection, m.localDB, m.cloudDB, m.skipped)
+		cancel()
+		if err != nil {
+			logger.Log.Warn("Failed to discover tables", zap.Error(err))
+			continue
+		}
+		m.addTables(selected)
+	}
+}
+
+// addTables syncs the selected tables not synced yet. A running run over
+// every table is restarted to stream them too, and their rows copied.
+// Tables dropped from the source stay synced until the service restarts.
+func (m *Manager) addTables(selected []config.TableConfig) {
+	current := m.tableConfigs()
+	known := make(map[string]bool, len(current))
+	for _, table := range current {
+		known[table.Name] = true
+	}
+	var added []config.TableConfig
+	for _, table := range selected {
+		if !known[table.Name] {
+			added = append(added, table)
+		}
+	}
+	if len(added) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	tables := make([]config.TableConfig, 0, len(current)+len(added))
+	tables = append(append(tables, current...), added...)
+	m.tablesMu.Lock()
+	m.tables = tables
+	m.tablesMu.Unlock()
+
+	names := tableNames(added)
+	logger.Log.Info("Discovered new tables", zap.Strings("tables", names))
+	restart := m.stats.state() == "running" && m.run != nil && len(m.run.tables) == len(current)
+	if restart {
+		m.stop("completed", nil)
+		if err := m.startLocked(TriggerDiscovery, nil, runOptions{}); err != nil {
+			logger.Log.Error("Failed to restart sync for new tables", zap.Strings("tables", names), zap.Error(err))
+			restart = false
+		}
+	}
+	m.mu.Unlock()
+
+	if !restart {
+		return
+	}
+	for _, name := range names {
+		if _, err := m.ResyncTable(name, ""); err != nil {
+			logger.Log.Warn("Failed to copy new table", zap.String("table", name), zap.Error(err))
+		}
+	}
+}
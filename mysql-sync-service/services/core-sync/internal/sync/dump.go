@@ -0,0 +1,724 @@
+package sync
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/alerting"
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+)
+
+// ErrInvalidDump is returned for dump files that can't be loaded.
+var ErrInvalidDump = errors.New("invalid dump file")
+
+var (
+	// Written by --source-data (--master-data before MySQL 8.0.26), as a
+	// comment with =2
+	dumpPositionPattern = regexp.MustCompile(`(?i)CHANGE (?:MASTER|REPLICATION SOURCE) TO (?:MASTER|SOURCE)_LOG_FILE\s*=\s*'([^']+)',\s*(?:MASTER|SOURCE)_LOG_POS\s*=\s*(\d+)`)
+	// Written with GTIDs on; long sets are wrapped over several lines
+	dumpGTIDPattern = regexp.MustCompile(`(?is)^SET @@GLOBAL\.GTID_PURGED\s*=.*'([^']*)'\s*;`)
+)
+
+// DumpCoordinates is the source position a dump was taken at.
+type DumpCoordinates struct {
+	BinlogFile string `json:"binlog_file"`
+	BinlogPos  uint32 `json:"binlog_pos"`
+	GTIDSet    string `json:"gtid_set,omitempty"`
+}
+
+// DumpLoader bootstraps the target from a mysqldump file instead of copying
+// the source again. The dump's rows are queued as inserts, which are
+// applied as upserts, and once they are applied the binlog listener starts
+// at the coordinates the dump recorded, so changes made since are replayed.
+//
+// Only binlog-captured tables are loaded; polled tables catch up by
+// polling. An interrupted load isn't resumed, the dump is loaded again.
+type DumpLoader struct {
+	path     string
+	csv      map[string]string // CSV files by table, loaded instead of path
+	coords   DumpCoordinates
+	database string
+	tables   map[string]config.TableConfig
+	queue    eventQueue
+	run      *syncRun
+	source   SourceInfo
+	taken    time.Time // the file's modification time, as the rows' change time
+	loading  atomic.Bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func NewDumpLoader(path string, cfg config.DatabaseConnection, tables []config.TableConfig, queue eventQueue, run *syncRun) (*DumpLoader, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+	}
+	coords, err := readDumpCoordinates(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tableMap := make(map[string]config.TableConfig, len(tables))
+	for _, table := range tables {
+		tableMap[table.Name] = table
+	}
+	return newDumpLoader(path, coords, cfg, tableMap, queue, run, info.ModTime()), nil
+}
+
+func newDumpLoader(path string, coords DumpCoordinates, cfg config.DatabaseConnection, tables map[string]config.TableConfig, queue eventQueue, run *syncRun, taken time.Time) *DumpLoader {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &DumpLoader{
+		path:     path,
+		coords:   coords,
+		database: cfg.Database,
+		tables:   tables,
+		queue:    queue,
+		run:      run,
+		source:   SourceInfo{SiteID: cfg.SiteID, Host: cfg.Host},
+		taken:    taken,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// tableConfigs lists the tables loaded, by name.
+func (d *DumpLoader) tableConfigs() []config.TableConfig {
+	tables := make([]config.TableConfig, 0, len(d.tables))
+	for _, table := range d.tables {
+		tables = append(tables, table)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	return tables
+}
+
+// Coordinates is where capture resumes once the dump is applied.
+func (d *DumpLoader) Coordinates() DumpCoordinates {
+	return d.coords
+}
+
+// Start loads the dump in the background and calls capture once its rows
+// are applied, or fail if loading them failed.
+func (d *DumpLoader) Start(capture func(), fail func(error)) {
+	logger.Log.Info("Loading dump",
+		zap.String("run_id", d.run.id),
+		zap.String("path", d.path),
+		zap.String("binlog_file", d.coords.BinlogFile),
+		zap.Uint32("binlog_pos", d.coords.BinlogPos),
+		zap.String("gtid_set", d.coords.GTIDSet),
+	)
+	d.loading.Store(true)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer d.loading.Store(false)
+
+		started := time.Now()
+		tables := make([]string, 0, len(d.tables))
+		for table := range d.tables {
+			tables = append(tables, table)
+		}
+		d.run.copies.begin(d.ctx, d.run.registry.source, d.run.id, CopyDump, tables)
+
+		var rows int
+		err := d.run.snapshot.create(d.ctx)
+		if err == nil {
+			rows, err = d.load()
+		}
+		if err == nil {
+			d.run.copies.setStatus(tables, CopyApplying, nil)
+			err = d.waitApplied()
+		}
+		if err == nil {
+			err = d.run.snapshot.swap(d.ctx)
+		}
+		if err != nil || d.ctx.Err() != nil {
+			d.run.snapshot.drop()
+		}
+		if d.ctx.Err() != nil {
+			d.run.copies.setStatus(tables, CopyFailed, errors.New("run stopped"))
+			return
+		}
+		if err != nil {
+			d.run.copies.setStatus(tables, CopyFailed, err)
+		} else {
+			d.run.copies.setStatus(tables, CopyCompleted, nil)
+		}
+		if err != nil {
+			logger.Log.Error("Loading dump failed", zap.String("run_id", d.run.id), zap.String("path", d.path), zap.Error(err))
+			d.run.health.RecordFailure(fmt.Sprintf("loading dump failed: %v", err))
+			d.run.alerts.Fire(alerting.Alert{
+				Kind:     alerting.KindSyncFailure,
+				Severity: alerting.SeverityCritical,
+				Subject:  "dump",
+				Title:    "Loading dump failed",
+				Message:  err.Error(),
+				Fields:   map[string]string{"path": d.path},
+			})
+			fail(err)
+			return
+		}
+		logger.Log.Info("Dump loaded, capturing changes from its coordinates",
+			zap.String("run_id", d.run.id),
+			zap.Int("rows", rows),
+			zap.Duration("duration", time.Since(started)),
+		)
+		capture()
+	}()
+}
+
+// Loading reports whether the dump is still being loaded.
+func (d *DumpLoader) Loading() bool {
+	return d.loading.Load()
+}
+
+func (d *DumpLoader) Stop() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+// waitApplied blocks until the workers have processed every queued event,
+// so changes replayed from the binlog can't be overwritten by dump rows.
+func (d *DumpLoader) waitApplied() error {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		d.run.stats.mu.Lock()
+		done := d.run.stats.processed >= d.run.stats.queued
+		d.run.stats.mu.Unlock()
+		if done {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-d.ctx.Done():
+			return d.ctx.Err()
+		}
+	}
+}
+
+// load queues the rows of the dump's INSERT statements for the run's
+// tables and returns how many it queued.
+func (d *DumpLoader) load() (int, error) {
+	if d.csv != nil {
+		return d.loadCSV()
+	}
+	r, closeDump, err := openDump(d.path)
+	if err != nil {
+		return 0, err
+	}
+	defer closeDump()
+
+	database := d.database
+	columns := make(map[string][]string) // by CREATE TABLE, in dump order
+	var creating string
+	total := 0
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return total, err
+		}
+		if line == "" && err == io.EOF {
+			return total, nil
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case creating != "":
+			if strings.HasPrefix(line, ")") {
+				creating = ""
+			} else if strings.HasPrefix(line, "  `") {
+				s := &dumpScanner{s: line}
+				column, err := s.identifier()
+				if err != nil {
+					return total, fmt.Errorf("table %s: %w", creating, err)
+				}
+				columns[creating] = append(columns[creating], column)
+			}
+		case strings.HasPrefix(line, "USE "):
+			s := &dumpScanner{s: line[len("USE "):]}
+			if database, err = s.identifier(); err != nil {
+				return total, err
+			}
+		case strings.HasPrefix(line, "CREATE TABLE "):
+			s := &dumpScanner{s: line[len("CREATE TABLE "):]}
+			s.keyword("IF NOT EXISTS")
+			table, err := s.identifier()
+			if err != nil {
+				return total, err
+			}
+			if _, ok := d.tables[table]; ok && database == d.database {
+				creating = table
+				columns[table] = nil
+			}
+		default:
+			s := &dumpScanner{s: line}
+			if !s.keyword("INSERT INTO") && !s.keyword("INSERT IGNORE INTO") && !s.keyword("REPLACE INTO") {
+				break
+			}
+			table, err := s.identifier()
+			if err != nil {
+				return total, err
+			}
+			tableConfig, ok := d.tables[table]
+			if !ok || database != d.database {
+				break
+			}
+			rows, err := d.loadInsert(tableConfig, columns[table], s)
+			total += rows
+			if err != nil {
+				return total, fmt.Errorf("table %s: %w", table, err)
+			}
+		}
+	}
+}
+
+// loadInsert queues the rows of an INSERT statement, after its table name,
+// in batches of the table's batch size.
+func (d *DumpLoader) loadInsert(table config.TableConfig, columns []string, s *dumpScanner) (int, error) {
+	if s.peek() == '(' {
+		// --complete-insert lists the columns
+		s.i++
+		columns = nil
+		for {
+			column, err := s.identifier()
+			if err != nil {
+				return 0, err
+			}
+			columns = append(columns, column)
+			if !s.consume(',') {
+				break
+			}
+		}
+		if !s.consume(')') {
+			return 0, s.errorf("expected )")
+		}
+	}
+	if !s.keyword("VALUES") {
+		return 0, s.errorf("expected VALUES")
+	}
+
+	t, err := d.newDumpTable(table, columns)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		if !s.consume('(') {
+			return t.total, s.errorf("expected (")
+		}
+		row := make([]interface{}, 0, len(t.columns))
+		for {
+			value, err := s.value()
+			if err != nil {
+				return t.total, err
+			}
+			row = append(row, value)
+			if !s.consume(',') {
+				break
+			}
+		}
+		if !s.consume(')') {
+			return t.total, s.errorf("expected )")
+		}
+		if err := t.add(row); err != nil {
+			return t.total, err
+		}
+		if !s.consume(',') {
+			break
+		}
+	}
+	if !s.consume(';') {
+		return t.total, s.errorf("expected ;")
+	}
+	return t.total, t.flush()
+}
+
+// dumpTable queues a table's rows, of the columns given, as inserts in
+// batches of the table's batch size.
+type dumpTable struct {
+	d           *DumpLoader
+	table       config.TableConfig
+	columns     []string
+	columnTypes []string
+	keyColumns  []string
+	keyIndexes  []int
+	generated   []string
+	batchSize   int
+	batch       [][]interface{}
+	total       int // rows queued
+}
+
+// newDumpTable checks columns, or the source table's if nil, against the
+// source table.
+func (d *DumpLoader) newDumpTable(table config.TableConfig, columns []string) (*dumpTable, error) {
+	schema, err := d.run.registry.Source(d.ctx, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	if columns == nil {
+		columns = schema.Columns
+	}
+	columnTypes := make([]string, len(columns))
+	for i, column := range columns {
+		index := columnIndex(schema.Columns, column)
+		if index < 0 {
+			return nil, fmt.Errorf("column %s of the dump is no longer in the source table", column)
+		}
+		columnTypes[i] = schema.ColumnTypes[index]
+	}
+	keyColumns := schema.PrimaryKey
+	if len(keyColumns) == 0 {
+		keyColumns = splitColumns(table.PrimaryKey)
+	}
+	var keyIndexes []int
+	for _, column := range keyColumns {
+		if index := columnIndex(columns, column); index >= 0 {
+			keyIndexes = append(keyIndexes, index)
+		}
+	}
+
+	batchSize := table.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultPollBatchSize
+	}
+	return &dumpTable{
+		d:           d,
+		table:       table,
+		columns:     columns,
+		columnTypes: columnTypes,
+		keyColumns:  keyColumns,
+		keyIndexes:  keyIndexes,
+		generated:   schema.Generated,
+		batchSize:   batchSize,
+	}, nil
+}
+
+// add queues row once its batch is full.
+func (t *dumpTable) add(row []interface{}) error {
+	if len(row) != len(t.columns) {
+		return fmt.Errorf("row has %d values for %d columns", len(row), len(t.columns))
+	}
+	t.batch = append(t.batch, row)
+	if len(t.batch) >= t.batchSize {
+		return t.flush()
+	}
+	return nil
+}
+
+// flush queues the rows added since the last batch.
+func (t *dumpTable) flush() error {
+	if len(t.batch) == 0 {
+		return nil
+	}
+	d, batch := t.d, t.batch
+	keys := make([]string, len(batch))
+	for i, row := range batch {
+		parts := make([]string, len(t.keyIndexes))
+		for j, index := range t.keyIndexes {
+			parts[j] = fmt.Sprint(row[index])
+		}
+		keys[i] = strings.Join(parts, ",")
+	}
+
+	// No binlog position: the rows are applied whatever the table's
+	// checkpoint, like polled ones
+	e := BinlogEvent{
+		Type:        Insert,
+		Schema:      d.database,
+		Table:       t.table.Name,
+		Rows:        batch,
+		Timestamp:   uint32(d.taken.Unix()),
+		Size:        estimateRowsSize(batch),
+		PrimaryKeys: keys,
+		Columns:     t.columns,
+		ColumnTypes: t.columnTypes,
+		KeyColumns:  t.keyColumns,
+		Generated:   t.generated,
+		Source:      d.source,
+	}
+	if err := d.run.gate.Wait(d.ctx); err != nil {
+		return err
+	}
+	if err := d.queue.Push(d.ctx, e); err != nil {
+		return err
+	}
+	d.run.stats.Queued()
+	d.run.copies.copied(t.table.Name, len(batch))
+	t.total += len(batch)
+	t.batch = nil
+	return nil
+}
+
+// readDumpCoordinates reads the coordinates from the dump's header, which
+// ends at its first table.
+func readDumpCoordinates(path string) (DumpCoordinates, error) {
+	r, closeDump, err := openDump(path)
+	if err != nil {
+		return DumpCoordinates{}, err
+	}
+	defer closeDump()
+
+	var coords DumpCoordinates
+	var gtid string // the GTID_PURGED statement, until its ;
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return coords, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+		}
+		if strings.HasPrefix(line, "CREATE TABLE ") || strings.HasPrefix(line, "INSERT ") || strings.HasPrefix(line, "REPLACE ") {
+			break
+		}
+
+		if gtid != "" || strings.HasPrefix(strings.ToUpper(line), "SET @@GLOBAL.GTID_PURGED") {
+			gtid += line
+			if strings.Contains(line, ";") {
+				match := dumpGTIDPattern.FindStringSubmatch(strings.TrimSpace(gtid))
+				if match == nil {
+					return coords, fmt.Errorf("%w: can't read GTID_PURGED", ErrInvalidDump)
+				}
+				coords.GTIDSet = strings.Join(strings.Fields(match[1]), "")
+				gtid = ""
+			}
+		} else if match := dumpPositionPattern.FindStringSubmatch(line); match != nil {
+			pos, err := strconv.ParseUint(match[2], 10, 32)
+			if err != nil {
+				return coords, fmt.Errorf("%w: binlog position %s", ErrInvalidDump, match[2])
+			}
+			coords.BinlogFile = match[1]
+			coords.BinlogPos = uint32(pos)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if coords.BinlogFile == "" && coords.GTIDSet == "" {
+		return coords, fmt.Errorf("%w: no binlog coordinates, take it with --source-data", ErrInvalidDump)
+	}
+	return coords, checkCoordinates(coords)
+}
+
+// checkCoordinates reports coordinates capture can't resume from.
+func checkCoordinates(coords DumpCoordinates) error {
+	if coords.BinlogFile == "" && coords.GTIDSet == "" {
+		return fmt.Errorf("%w: no binlog coordinates", ErrInvalidDump)
+	}
+	if coords.GTIDSet != "" {
+		if _, err := mysql.ParseGTIDSet(mysql.MySQLFlavor, coords.GTIDSet); err != nil {
+			return fmt.Errorf("%w: GTID set: %v", ErrInvalidDump, err)
+		}
+	}
+	return nil
+}
+
+// openDump opens a dump, gunzipping it if it ends in .gz.
+func openDump(path string) (*bufio.Reader, func(), error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return bufio.NewReaderSize(f, 1<<20), func() { f.Close() }, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+	}
+	return bufio.NewReaderSize(gz, 1<<20), func() { gz.Close(); f.Close() }, nil
+}
+
+// dumpScanner reads identifiers and literals the way mysqldump writes them.
+type dumpScanner struct {
+	s string
+	i int
+}
+
+func (s *dumpScanner) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s at offset %d", ErrInvalidDump, fmt.Sprintf(format, args...), s.i)
+}
+
+func (s *dumpScanner) skipSpace() {
+	for s.i < len(s.s) && (s.s[s.i] == ' ' || s.s[s.i] == '\t') {
+		s.i++
+	}
+}
+
+func (s *dumpScanner) peek() byte {
+	s.skipSpace()
+	if s.i < len(s.s) {
+		return s.s[s.i]
+	}
+	return 0
+}
+
+func (s *dumpScanner) consume(c byte) bool {
+	if s.peek() != c {
+		return false
+	}
+	s.i++
+	return true
+}
+
+// keyword consumes words, ignoring case, if they come next.
+func (s *dumpScanner) keyword(words string) bool {
+	s.skipSpace()
+	end := s.i + len(words)
+	if end > len(s.s) || !strings.EqualFold(s.s[s.i:end], words) {
+		return false
+	}
+	if end < len(s.s) && isWordChar(s.s[end]) {
+		return false
+	}
+	s.i = end
+	return true
+}
+
+// identifier reads a backquoted name.
+func (s *dumpScanner) identifier() (string, error) {
+	if !s.consume('`') {
+		return "", s.errorf("expected identifier")
+	}
+	var b strings.Builder
+	for s.i < len(s.s) {
+		c := s.s[s.i]
+		s.i++
+		if c != '`' {
+			b.WriteByte(c)
+			continue
+		}
+		if s.i < len(s.s) && s.s[s.i] == '`' {
+			b.WriteByte('`')
+			s.i++
+			continue
+		}
+		return b.String(), nil
+	}
+	return "", s.errorf("unterminated identifier")
+}
+
+// value reads a literal: NULL, a number, a quoted string, which is binary
+// with the _binary prefix, a 0x hex string or a b'0101' bit value.
+func (s *dumpScanner) value() (interface{}, error) {
+	switch c := s.peek(); {
+	case c == '\'':
+		return s.quoted()
+	case s.keyword("NULL"):
+		return nil, nil
+	case s.keyword("_binary"):
+		if s.peek() != '\'' {
+			return nil, s.errorf("expected string")
+		}
+		text, err := s.quoted()
+		return []byte(text), err
+	case strings.HasPrefix(s.s[s.i:], "0x"):
+		start := s.i + 2
+		s.i = start
+		for s.i < len(s.s) && isHexDigit(s.s[s.i]) {
+			s.i++
+		}
+		value, err := hex.DecodeString(s.s[start:s.i])
+		if err != nil {
+			return nil, s.errorf("invalid hex literal")
+		}
+		return value, nil
+	case strings.HasPrefix(s.s[s.i:], "b'"):
+		s.i += 2
+		end := strings.IndexByte(s.s[s.i:], '\'')
+		if end < 0 {
+			return nil, s.errorf("unterminated bit literal")
+		}
+		bits := s.s[s.i : s.i+end]
+		s.i += end + 1
+		if bits == "" {
+			return int64(0), nil
+		}
+		value, err := strconv.ParseUint(bits, 2, 64)
+		if err != nil {
+			return nil, s.errorf("invalid bit literal")
+		}
+		return int64(value), nil
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		start := s.i
+		for s.i < len(s.s) && strings.IndexByte("+-.0123456789eE", s.s[s.i]) >= 0 {
+			s.i++
+		}
+		number := s.s[start:s.i]
+		if value, err := strconv.ParseInt(number, 10, 64); err == nil {
+			return value, nil
+		}
+		// Kept as text so decimals and unsigned bigints lose no precision
+		return number, nil
+	default:
+		return nil, s.errorf("unexpected %q", c)
+	}
+}
+
+// quoted reads a single-quoted string with mysqldump's escapes.
+func (s *dumpScanner) quoted() (string, error) {
+	s.i++ // opening quote
+	var b strings.Builder
+	for s.i < len(s.s) {
+		c := s.s[s.i]
+		s.i++
+		switch c {
+		case '\'':
+			if s.i < len(s.s) && s.s[s.i] == '\'' {
+				b.WriteByte('\'')
+				s.i++
+				continue
+			}
+			return b.String(), nil
+		case '\\':
+			if s.i >= len(s.s) {
+				return "", s.errorf("unterminated string")
+			}
+			escaped := s.s[s.i]
+			s.i++
+			switch escaped {
+			case '0':
+				b.WriteByte(0)
+			case 'b':
+				b.WriteByte('\b')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'Z':
+				b.WriteByte(26)
+			default:
+				b.WriteByte(escaped)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", s.errorf("unterminated string")
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
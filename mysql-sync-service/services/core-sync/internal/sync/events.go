@@ -0,0 +1,87 @@
+package sync
+
+import (
+	"sync"
+	"time"
+)
+
+// Sync activity types published to subscribers
+const (
+	EventRunStarted      = "run_started"
+	EventRunStopped      = "run_stopped"
+	EventRunPaused       = "run_paused"
+	EventRunResumed      = "run_resumed"
+	EventRunSkipped      = "run_skipped"
+	EventBatchApplied    = "batch_applied"
+	EventBatchFailed     = "batch_failed"
+	EventStreamLost      = "stream_lost"
+	EventStreamRestored  = "stream_restored"
+	EventResyncStarted   = "resync_started"
+	EventResyncCompleted = "resync_completed"
+	EventResyncFailed    = "resync_failed"
+	// Published at most once a second per table while it is copied
+	EventSnapshotProgress = "snapshot_progress"
+)
+
+// SyncEvent describes sync activity for streaming clients.
+type SyncEvent struct {
+	Type       string    `json:"type"`
+	RunID      string    `json:"run_id"`
+	Table      string    `json:"table,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	Events     int       `json:"events,omitempty"`
+	BinlogFile string    `json:"binlog_file,omitempty"`
+	BinlogPos  uint32    `json:"binlog_position,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	SourceSite string    `json:"source_site,omitempty"`
+	Time       time.Time `json:"time"`
+	// Progress is set on snapshot progress events
+	Progress *SnapshotProgress `json:"progress,omitempty"`
+}
+
+// eventHub fans sync activity out to subscribers. Slow subscribers miss
+// events rather than stalling the apply path.
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[chan SyncEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[chan SyncEvent]struct{})}
+}
+
+func (h *eventHub) subscribe(buffer int) (<-chan SyncEvent, func()) {
+	ch := make(chan SyncEvent, buffer)
+
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, ch)
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (h *eventHub) publish(e SyncEvent) {
+	if h == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package sync
+
+// NewTestManager is newTestManager for the package's external tests.
+var NewTestManager = newTestManager
+
+// InsertItem and WaitForItem are insertItem and waitForItem for the
+// package's external tests.
+var (
+	InsertItem  = insertItem
+	WaitForItem = waitForItem
+)
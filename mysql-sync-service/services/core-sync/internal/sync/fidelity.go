@@ -0,0 +1,113 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// baseType is a MySQL column type without its arguments and attributes,
+// e.g. "varbinary" for "varbinary(16)".
+func baseType(columnType string) string {
+	base := strings.ToLower(strings.TrimSpace(columnType))
+	if i := strings.IndexAny(base, "( "); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+// isBinaryType reports whether a MySQL column type holds bytes rather than
+// text.
+func isBinaryType(columnType string) bool {
+	switch baseType(columnType) {
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return true
+	}
+	return false
+}
+
+func isJSONType(columnType string) bool {
+	return baseType(columnType) == "json"
+}
+
+// canonicalValue is a value as rows are hashed and compared by: binary
+// values as the hex of their exact bytes, however they were read, JSON
+// documents decoded so neither formatting nor key order counts, and other
+// bytes as the text they hold. Bytes that aren't UTF-8 stay bytes, which
+// encoding/json writes byte-exact as base64.
+func canonicalValue(columnType string, value interface{}) interface{} {
+	switch {
+	case value == nil:
+		return nil
+	case isBinaryType(columnType):
+		switch v := value.(type) {
+		case []byte:
+			return hex.EncodeToString(v)
+		case string:
+			return hex.EncodeToString([]byte(v))
+		}
+	case isJSONType(columnType):
+		if document, ok := decodeJSON(value); ok {
+			return document
+		}
+	}
+	if b, ok := value.([]byte); ok && utf8.Valid(b) {
+		return string(b)
+	}
+	return value
+}
+
+// decodeJSON decodes a JSON column's text, keeping numbers as written.
+func decodeJSON(value interface{}) (interface{}, bool) {
+	var text []byte
+	switch v := value.(type) {
+	case string:
+		text = []byte(v)
+	case []byte:
+		text = v
+	default:
+		return nil, false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(text))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil || decoder.More() {
+		return nil, false
+	}
+	return document, true
+}
+
+// jsonEqual reports whether two JSON texts hold the same document, e.g.
+// `{"a": 1, "b": 2}` and `{"b":2,"a":1}`.
+func jsonEqual(a, b string) bool {
+	left, ok := decodeJSON(a)
+	if !ok {
+		return a == b
+	}
+	right, ok := decodeJSON(b)
+	if !ok {
+		return false
+	}
+	leftText, _ := json.Marshal(left)
+	rightText, _ := json.Marshal(right)
+	return bytes.Equal(leftText, rightText)
+}
+
+// rowHash hashes one of e's rows by canonical value, so rows holding the
+// same data hash alike whichever path read them.
+func rowHash(e BinlogEvent, row []interface{}) string {
+	values := make(map[string]interface{}, len(e.Columns))
+	for i, column := range e.Columns {
+		if i >= len(row) {
+			break
+		}
+		var columnType string
+		if i < len(e.ColumnTypes) {
+			columnType = e.ColumnTypes[i]
+		}
+		values[column] = canonicalValue(columnType, row[i])
+	}
+	return calculateHash(values)
+}
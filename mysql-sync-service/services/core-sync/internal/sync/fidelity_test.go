@@ -0,0 +1,64 @@
+package sync
+
+import (
+	"testing"
+)
+
+func TestJSONEqual(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{"same text", `{"a":1}`, `{"a":1}`, true},
+		{"spacing", `{"a":1,"b":[1,2]}`, `{"a": 1, "b": [1, 2]}`, true},
+		{"key order", `{"a":1,"b":{"c":null,"d":"x"}}`, `{"b":{"d":"x","c":null},"a":1}`, true},
+		{"different value", `{"a":1}`, `{"a":2}`, false},
+		{"array order", `[1,2]`, `[2,1]`, false},
+		{"large integers kept exact", `{"id":12345678901234567890}`, `{"id":12345678901234567891}`, false},
+		{"not JSON, same text", `{"a":`, `{"a":`, true},
+		{"not JSON, different text", `{"a":`, `{"a": `, false},
+		{"only one is JSON", `{"a":1}`, `{"a":1`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jsonEqual(tt.a, tt.b); got != tt.want {
+				t.Errorf("jsonEqual(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRowHash(t *testing.T) {
+	raw := []byte{0x00, 0xff, 0xfe, 0x80}
+	event := BinlogEvent{
+		Columns:     []string{"id", "data", "doc", "name"},
+		ColumnTypes: []string{"int", "varbinary(16)", "json", "varchar(32)"},
+	}
+	hash := func(row ...interface{}) string {
+		return rowHash(event, row)
+	}
+	base := hash(int64(1), raw, `{"a":1,"b":2}`, []byte("Ann"))
+
+	tests := []struct {
+		name string
+		row  []interface{}
+		same bool
+	}{
+		{"binary read as a string", []interface{}{int64(1), string(raw), `{"a":1,"b":2}`, []byte("Ann")}, true},
+		{"JSON formatted differently", []interface{}{int64(1), raw, `{"b": 2, "a": 1}`, []byte("Ann")}, true},
+		{"JSON read as bytes", []interface{}{int64(1), raw, []byte(`{"a":1,"b":2}`), []byte("Ann")}, true},
+		{"text read as a string", []interface{}{int64(1), raw, `{"a":1,"b":2}`, "Ann"}, true},
+		{"one binary byte differs", []interface{}{int64(1), []byte{0x00, 0xff, 0xfe, 0x81}, `{"a":1,"b":2}`, []byte("Ann")}, false},
+		{"binary trailing zero", []interface{}{int64(1), append(append([]byte{}, raw...), 0), `{"a":1,"b":2}`, []byte("Ann")}, false},
+		{"binary NULL", []interface{}{int64(1), nil, `{"a":1,"b":2}`, []byte("Ann")}, false},
+		{"JSON value differs", []interface{}{int64(1), raw, `{"a":1,"b":3}`, []byte("Ann")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hash(tt.row...) == base; got != tt.same {
+				t.Errorf("hash matches: %v, want %v", got, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package sync
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
+)
+
+// Foreign key modes for sync.foreign_keys
+const (
+	ForeignKeysOrder   = "order"
+	ForeignKeysDisable = "disable_checks"
+	ForeignKeysIgnore  = "ignore"
+)
+
+// fkGraph holds the foreign keys the target declares between synced
+// tables, by source table name. Tables linked by foreign keys, directly or
+// not, form a component whose events are dispatched to one worker and
+// applied in one target transaction per batch, parents first.
+type fkGraph struct {
+	parents   map[string][]string
+	children  map[string][]string
+	component map[string]string // table to its component's tables joined by "+"
+}
+
+func loadFKGraph(ctx context.Context, db *database.Database, tables []config.TableConfig) (*fkGraph, error) {
+	targetParents, err := db.ForeignKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Source tables writing to each target table
+	sources := make(map[string][]string)
+	for _, table := range tables {
+		for _, target := range targetTables(table) {
+			sources[target] = append(sources[target], table.Name)
+		}
+	}
+
+	g := &fkGraph{
+		parents:   make(map[string][]string),
+		children:  make(map[string][]string),
+		component: make(map[string]string),
+	}
+	seen := make(map[[2]string]bool)
+	for _, table := range tables {
+		for _, target := range targetTables(table) {
+			for _, parentTarget := range targetParents[target] {
+				for _, parent := range sources[parentTarget] {
+					edge := [2]string{table.Name, parent}
+					if parent == table.Name || seen[edge] {
+						continue
+					}
+					seen[edge] = true
+					g.parents[table.Name] = append(g.parents[table.Name], parent)
+					g.children[parent] = append(g.children[parent], table.Name)
+				}
+			}
+		}
+	}
+
+	for _, table := range tables {
+		if _, ok := g.component[table.Name]; ok || (len(g.parents[table.Name]) == 0 && len(g.children[table.Name]) == 0) {
+			continue
+		}
+		members := []string{table.Name}
+		visited := map[string]bool{table.Name: true}
+		for i := 0; i < len(members); i++ {
+			for _, linked := range [][]string{g.parents[members[i]], g.children[members[i]]} {
+				for _, next := range linked {
+					if !visited[next] {
+						visited[next] = true
+						members = append(members, next)
+					}
+				}
+			}
+		}
+		sort.Strings(members)
+		name := strings.Join(members, "+")
+		for _, member := range members {
+			g.component[member] = name
+		}
+	}
+	return g, nil
+}
+
+// targetTables lists the target tables a source table is applied to.
+func targetTables(table config.TableConfig) []string {
+	if len(table.Routes) == 0 {
+		return []string{table.GetTargetName()}
+	}
+	targets := make([]string, len(table.Routes))
+	for i, route := range table.Routes {
+		targets[i] = route.Target
+	}
+	return targets
+}
+
+// components lists the groups of tables linked by foreign keys.
+func (g *fkGraph) components() []string {
+	seen := make(map[string]bool)
+	var components []string
+	for _, name := range g.component {
+		if !seen[name] {
+			seen[name] = true
+			components = append(components, name)
+		}
+	}
+	sort.Strings(components)
+	return components
+}
+
+// key is what a table's events are dispatched and batched under: its
+// component, or the table itself. Safe on a nil graph.
+func (g *fkGraph) key(table string) string {
+	if g != nil {
+		if name, ok := g.component[table]; ok {
+			return name
+		}
+	}
+	return table
+}
+
+// order moves a child's inserts and updates after those of its parents,
+// and a parent's deletes after those of its children. Each table's events
+// keep their order, and otherwise the earliest event goes first; tables
+// referencing each other in a cycle fall back to binlog order.
+func (g *fkGraph) order(events []BinlogEvent) []BinlogEvent {
+	if g == nil || len(g.parents) == 0 {
+		return events
+	}
+
+	// Indexes of each table's events not yet ordered
+	queues := make(map[string][]int)
+	var tables []string
+	for i, e := range events {
+		if _, ok := queues[e.Table]; !ok {
+			tables = append(tables, e.Table)
+		}
+		queues[e.Table] = append(queues[e.Table], i)
+	}
+	if len(tables) < 2 {
+		return events
+	}
+
+	waiting := func(tables []string, deletes bool) bool {
+		for _, table := range tables {
+			if q := queues[table]; len(q) > 0 && (events[q[0]].Type == Delete) == deletes {
+				return true
+			}
+		}
+		return false
+	}
+	blocked := func(e BinlogEvent) bool {
+		if e.Type == Delete {
+			return waiting(g.children[e.Table], true)
+		}
+		return waiting(g.parents[e.Table], false)
+	}
+
+	ordered := make([]BinlogEvent, 0, len(events))
+	for len(ordered) < len(events) {
+		next, earliest := "", ""
+		for _, table := range tables {
+			q := queues[table]
+			if len(q) == 0 {
+				continue
+			}
+			if earliest == "" || q[0] < queues[earliest][0] {
+				earliest = table
+			}
+			if (next == "" || q[0] < queues[next][0]) && !blocked(events[q[0]]) {
+				next = table
+			}
+		}
+		if next == "" {
+			next = earliest
+		}
+		ordered = append(ordered, events[queues[next][0]])
+		queues[next] = queues[next][1:]
+	}
+	return ordered
+}
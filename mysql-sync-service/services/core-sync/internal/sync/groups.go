@@ -0,0 +1,161 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/metrics"
+)
+
+// txnGroups holds changes to grouped tables until their source transaction
+// commits, so the whole transaction reaches a worker as one Group event and
+// is applied in one target transaction. Groups rely on XID events, i.e. on
+// transactional (InnoDB) source tables.
+//
+// With transactions preserved, changes to the other tables are held too and
+// handed over as one more Group event, named after the tables it touches.
+type txnGroups struct {
+	tableGroup map[string]string
+	preserve   bool
+	maxRows    int
+	maxBytes   int64
+	pending    map[string]*BinlogEvent
+	rows       map[string]int
+	order      []string
+	split      bool // the open transaction went over a limit
+}
+
+// transactionKey holds the ungrouped tables of a preserved transaction;
+// group names can't be empty.
+const transactionKey = ""
+
+func newTxnGroups(groups []config.GroupConfig, tables map[string]bool, txns config.TransactionConfig) (*txnGroups, error) {
+	tableGroup := make(map[string]string)
+	for _, group := range groups {
+		if group.Name == "" {
+			return nil, fmt.Errorf("sync group needs a name")
+		}
+		if tables[group.Name] {
+			return nil, fmt.Errorf("sync group %s is named like a table", group.Name)
+		}
+		for _, table := range group.Tables {
+			if !tables[table] {
+				return nil, fmt.Errorf("sync group %s: %w: %s", group.Name, ErrUnknownTable, table)
+			}
+			if other, ok := tableGroup[table]; ok {
+				return nil, fmt.Errorf("table %s is in sync groups %s and %s", table, other, group.Name)
+			}
+			tableGroup[table] = group.Name
+		}
+	}
+	return &txnGroups{
+		tableGroup: tableGroup,
+		preserve:   txns.Preserve,
+		maxRows:    txns.GetMaxRows(),
+		maxBytes:   txns.GetMaxBytes(),
+		pending:    make(map[string]*BinlogEvent),
+		rows:       make(map[string]int),
+	}, nil
+}
+
+// Add holds e if its table belongs to a group, or transactions are
+// preserved, and reports whether it did. Once a held group goes over the
+// row or byte limit it is returned as full, to be pushed right away.
+func (g *txnGroups) Add(e BinlogEvent) (held bool, full *BinlogEvent) {
+	name, ok := g.tableGroup[e.Table]
+	if !ok {
+		if !g.preserve {
+			return false, nil
+		}
+		name = transactionKey
+	}
+
+	group, ok := g.pending[name]
+	if !ok {
+		group = &BinlogEvent{Type: Group, Schema: e.Schema, Table: name, Source: e.Source}
+		g.pending[name] = group
+		g.order = append(g.order, name)
+	}
+	group.Members = append(group.Members, e)
+	group.Size += e.Size
+	group.Timestamp = e.Timestamp
+	group.GTID = e.GTID
+	g.rows[name] += eventRows(e)
+
+	if g.rows[name] <= g.maxRows && group.Size <= g.maxBytes {
+		return true, nil
+	}
+
+	if !g.split {
+		g.split = true
+		metrics.TransactionsSplit.Inc()
+		logger.Log.Warn("Source transaction is too large to apply at once, applying it in chunks",
+			zap.String("gtid", e.GTID),
+			zap.String("binlog_file", e.BinlogFile),
+			zap.Uint32("binlog_pos", e.BinlogPos),
+			zap.Int("max_rows", g.maxRows),
+			zap.Int64("max_bytes", g.maxBytes),
+		)
+	}
+	chunk := g.take(name)
+	chunk.BinlogFile = e.BinlogFile
+	chunk.BinlogPos = e.BinlogPos
+	for i, pending := range g.order {
+		if pending == name {
+			g.order = append(g.order[:i], g.order[i+1:]...)
+			break
+		}
+	}
+	return true, &chunk
+}
+
+// Commit returns the held groups of the transaction that just committed.
+func (g *txnGroups) Commit() []BinlogEvent {
+	g.split = false
+	if len(g.order) == 0 {
+		return nil
+	}
+
+	events := make([]BinlogEvent, 0, len(g.order))
+	for _, name := range g.order {
+		events = append(events, g.take(name))
+	}
+	g.order = g.order[:0]
+	return events
+}
+
+// Reset drops the held groups of the open transaction.
+func (g *txnGroups) Reset() {
+	g.pending = make(map[string]*BinlogEvent)
+	g.rows = make(map[string]int)
+	g.order = g.order[:0]
+	g.split = false
+}
+
+func (g *txnGroups) take(name string) BinlogEvent {
+	group := *g.pending[name]
+	delete(g.pending, name)
+	delete(g.rows, name)
+	if name == transactionKey {
+		group.Table = strings.Join(memberTables(group.Members), "+")
+	}
+	return group
+}
+
+// memberTables lists the tables of a Group event's members, in order of
+// first appearance.
+func memberTables(members []BinlogEvent) []string {
+	seen := make(map[string]bool)
+	var tables []string
+	for _, e := range members {
+		if !seen[e.Table] {
+			seen[e.Table] = true
+			tables = append(tables, e.Table)
+		}
+	}
+	return tables
+}
@@ -0,0 +1,103 @@
+package sync
+
+import (
+	"sync"
+	"time"
+)
+
+// Health states, from best to worst
+const (
+	HealthHealthy  = "healthy"
+	HealthDegraded = "degraded"
+	HealthFailing  = "failing"
+)
+
+// failingAfter is the number of consecutive failed batches that turns a
+// degraded sync into a failing one.
+const failingAfter = 3
+
+// HealthStatus is a point-in-time view of the sync health.
+type HealthStatus struct {
+	State               string    `json:"state"`
+	Reason              string    `json:"reason,omitempty"`
+	Since               time.Time `json:"since"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
+
+// healthTracker moves between healthy, degraded and failing as batches
+// succeed or fail. It outlives runs so the scheduler can see how the last
+// one ended.
+type healthTracker struct {
+	mu     sync.Mutex
+	status HealthStatus
+	// checkpoints is why checkpoints aren't being persisted, or empty. A
+	// restart meanwhile would resume from older positions, so the sync is
+	// degraded at best until they are.
+	checkpoints string
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{status: HealthStatus{State: HealthHealthy, Since: time.Now()}}
+}
+
+func (h *healthTracker) RecordSuccess() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.status.ConsecutiveFailures = 0
+	if h.checkpoints != "" {
+		h.transition(HealthDegraded, h.checkpoints)
+		return
+	}
+	h.transition(HealthHealthy, "")
+}
+
+func (h *healthTracker) RecordFailure(reason string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.status.ConsecutiveFailures++
+	if h.status.ConsecutiveFailures >= failingAfter {
+		h.transition(HealthFailing, reason)
+	} else {
+		h.transition(HealthDegraded, reason)
+	}
+}
+
+// CheckpointsFailing degrades a healthy sync until CheckpointsPersisted.
+func (h *healthTracker) CheckpointsFailing(reason string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checkpoints = reason
+	if h.status.State == HealthHealthy {
+		h.transition(HealthDegraded, reason)
+	}
+}
+
+func (h *healthTracker) CheckpointsPersisted() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.checkpoints == "" {
+		return
+	}
+	if h.status.State == HealthDegraded && h.status.Reason == h.checkpoints {
+		h.transition(HealthHealthy, "")
+	}
+	h.checkpoints = ""
+}
+
+func (h *healthTracker) transition(state, reason string) {
+	if h.status.State != state {
+		h.status.Since = time.Now()
+	}
+	h.status.State = state
+	h.status.Reason = reason
+}
+
+func (h *healthTracker) Snapshot() HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
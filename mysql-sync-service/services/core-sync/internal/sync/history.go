@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/store"
+)
+
+// What started a run, as recorded in sync history
+const (
+	TriggerManual    = "manual"
+	TriggerScheduled = "scheduled"
+	TriggerCatchUp   = "catch_up"
+	TriggerDump      = "dump"
+	TriggerReplay    = "replay"
+	TriggerRestart   = "restart"
+	TriggerFailover  = "failover"  // resumes a run a failed leader left behind
+	TriggerDiscovery = "discovery" // restarts a run to add newly created tables
+)
+
+// recordRunStart adds the run to sync history. A history failure is logged
+// rather than failing a run that is already replicating.
+func (m *Manager) recordRunStart(run *syncRun) {
+	history := &store.SyncHistory{
+		ID:           run.id,
+		StartedAt:    run.startedAt,
+		Direction:    run.direction,
+		TablesSynced: strings.Join(run.tables, ","),
+		Status:       "running",
+		Trigger:      run.trigger,
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
+	defer cancel()
+	if err := m.stateWrites.CreateSyncHistory(ctx, history); err != nil {
+		logger.Log.Error("Failed to record sync run", zap.String("run_id", run.id), zap.Error(err))
+	}
+}
+
+// recordRunEnd closes the run's sync history record with status and the
+// error that ended it, if any.
+func (m *Manager) recordRunEnd(run *syncRun, status string, report *ShutdownReport, cause error) {
+	history := &store.SyncHistory{
+		ID:          run.id,
+		CompletedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		Status:      status,
+	}
+	if cause != nil {
+		history.ErrorMessage = sql.NullString{String: cause.Error(), Valid: true}
+	}
+	if report != nil {
+		history.TotalRows = report.RowsApplied
+		if data, err := json.Marshal(report); err == nil {
+			history.ShutdownReport = data
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.stateWrites.UpdateSyncHistory(ctx, history); err != nil {
+		logger.Log.Error("Failed to record sync run end", zap.String("run_id", run.id), zap.Error(err))
+	}
+}
+
+// recordRunFailure keeps a run that failed to start in sync history, so
+// failed starts aren't only in the logs.
+func (m *Manager) recordRunFailure(id, trigger string, startedAt time.Time, tables []config.TableConfig, cause error) {
+	logger.Log.Error("Sync run failed to start", zap.String("run_id", id), zap.String("trigger", trigger), zap.Error(cause))
+
+	history := &store.SyncHistory{
+		ID:           id,
+		StartedAt:    startedAt,
+		CompletedAt:  sql.NullTime{Time: time.Now(), Valid: true},
+		Direction:    DirectionLocalToCloud,
+		TablesSynced: strings.Join(tableNames(tables), ","),
+		Status:       "failed",
+		ErrorMessage: sql.NullString{String: cause.Error(), Valid: true},
+		Trigger:      trigger,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.stateWrites.CreateSyncHistory(ctx, history); err != nil {
+		logger.Log.Error("Failed to record sync run", zap.String("run_id", id), zap.Error(err))
+	}
+}
@@ -0,0 +1,355 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+)
+
+// settingSchedulerJobs holds the named jobs' schedules and whether they are
+// enabled, as changed through the API, as JSON by job name; they take
+// precedence over config.yaml.
+const settingSchedulerJobs = "scheduler.jobs"
+
+// ErrJobNotFound is returned for a named job that isn't configured.
+var ErrJobNotFound = errors.New("scheduled job not found")
+
+// namedJob is a job of SchedulerConfig.Jobs, with the changes made to it
+// through the API.
+type namedJob struct {
+	config.ScheduledJob
+	entryID cron.EntryID // 0 while not on the cron
+	lastRun *ScheduledRun
+}
+
+// jobOverride is a change to a named job made through the API.
+type jobOverride struct {
+	Schedule string `json:"schedule,omitempty"`
+	Enabled  *bool  `json:"enabled,omitempty"`
+}
+
+// JobStatus describes a named job for the API.
+type JobStatus struct {
+	Name     string        `json:"name"`
+	Job      string        `json:"job"`
+	Tables   []string      `json:"tables,omitempty"`
+	Mode     string        `json:"mode,omitempty"`
+	Schedule string        `json:"schedule"`
+	Enabled  bool          `json:"enabled"`
+	NextRun  *time.Time    `json:"next_run,omitempty"` // unset while not scheduled
+	PrevRun  *time.Time    `json:"prev_run,omitempty"`
+	LastRun  *ScheduledRun `json:"last_run,omitempty"`
+}
+
+// JobUpdate changes a named job; unset fields are left as they are.
+type JobUpdate struct {
+	Schedule string `json:"schedule"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+// loadJobs reads the named jobs, with the changes persisted by UpdateJob
+// applied. A job that isn't valid is logged and left out.
+func (s *Scheduler) loadJobs() {
+	s.overrides = s.loadJobOverrides()
+
+	names := make(map[string]bool)
+	for _, job := range s.cfg.Jobs {
+		if override, ok := s.overrides[job.Name]; ok {
+			if override.Schedule != "" {
+				job.Schedule = override.Schedule
+			}
+			if override.Enabled != nil {
+				job.Disabled = !*override.Enabled
+			}
+		}
+		if _, err := s.checkJob(job, names); err != nil {
+			logger.Log.Error("Failed to schedule job", zap.String("job", job.Name), zap.Error(err))
+			continue
+		}
+		names[job.Name] = true
+		s.jobs = append(s.jobs, &namedJob{ScheduledJob: job})
+	}
+}
+
+func (s *Scheduler) loadJobOverrides() map[string]jobOverride {
+	overrides := make(map[string]jobOverride)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	value, err := s.manager.store.GetSetting(ctx, settingSchedulerJobs)
+	if err != nil {
+		logger.Log.Warn("Failed to load persisted job schedules, using config", zap.Error(err))
+		return overrides
+	}
+	if value == "" {
+		return overrides
+	}
+	if err := json.Unmarshal([]byte(value), &overrides); err != nil {
+		logger.Log.Warn("Ignoring invalid persisted job schedules", zap.String("value", value), zap.Error(err))
+		return make(map[string]jobOverride)
+	}
+	logger.Log.Info("Using persisted job schedules", zap.String("jobs", value))
+	return overrides
+}
+
+// scheduleJob puts job on the cron with its current schedule, or takes it
+// off if it is disabled or scheduling is. s.mu must be held.
+func (s *Scheduler) scheduleJob(job *namedJob) {
+	if job.entryID != 0 {
+		s.cron.Remove(job.entryID)
+		job.entryID = 0
+	}
+	if !s.cfg.Enabled || job.Disabled {
+		return
+	}
+	schedule, err := cron.ParseStandard(job.Schedule)
+	if err != nil {
+		logger.Log.Error("Failed to schedule job", zap.String("job", job.Name), zap.Error(err))
+		return
+	}
+	run := job.ScheduledJob
+	job.entryID = s.cron.Schedule(schedule, cron.FuncJob(func() { s.runJob(run, TriggerScheduled) }))
+	logger.Log.Info("Scheduled job",
+		zap.String("job", job.Name),
+		zap.String("type", job.GetJob()),
+		zap.String("schedule", job.Schedule),
+		zap.Strings("tables", job.Tables))
+}
+
+// checkJob parses job's schedule once its name, type and tables are known
+// to be fine.
+func (s *Scheduler) checkJob(job config.ScheduledJob, names map[string]bool) (cron.Schedule, error) {
+	switch {
+	case job.Name == "":
+		return nil, fmt.Errorf("job has no name")
+	case names[job.Name]:
+		return nil, fmt.Errorf("job %s is defined twice", job.Name)
+	}
+	switch job.GetJob() {
+	case JobSync:
+	case JobResync:
+		if job.Mode != "" && job.Mode != ResyncShadow && job.Mode != ResyncTruncate {
+			return nil, fmt.Errorf("unknown resync mode %q", job.Mode)
+		}
+	default:
+		return nil, fmt.Errorf("unknown job %q", job.Job)
+	}
+	for _, table := range job.Tables {
+		known := false
+		for _, t := range s.manager.tableConfigs() {
+			known = known || t.Name == table
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownTable, table)
+		}
+	}
+	schedule, err := cron.ParseStandard(job.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	return schedule, nil
+}
+
+// job returns the named job, nil if there is none. s.mu must be held.
+func (s *Scheduler) job(name string) *namedJob {
+	if name == "" {
+		return nil
+	}
+	for _, job := range s.jobs {
+		if job.Name == name {
+			return job
+		}
+	}
+	return nil
+}
+
+// Jobs lists the named jobs with their next and last runs.
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make(map[cron.EntryID]cron.Entry)
+	for _, entry := range s.cron.Entries() {
+		entries[entry.ID] = entry
+	}
+	jobs := make([]JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, s.jobStatus(job, entries))
+	}
+	return jobs
+}
+
+// Job returns the named job.
+func (s *Scheduler) Job(name string) (JobStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.job(name)
+	if job == nil {
+		return JobStatus{}, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	return s.jobStatus(job, nil), nil
+}
+
+// jobStatus describes job, looking up its cron entry unless entries has
+// it. s.mu must be held.
+func (s *Scheduler) jobStatus(job *namedJob, entries map[cron.EntryID]cron.Entry) JobStatus {
+	status := JobStatus{
+		Name:     job.Name,
+		Job:      job.GetJob(),
+		Tables:   job.Tables,
+		Mode:     job.Mode,
+		Schedule: job.Schedule,
+		Enabled:  !job.Disabled,
+	}
+	if job.entryID != 0 {
+		entry, ok := entries[job.entryID]
+		if !ok {
+			entry = s.cron.Entry(job.entryID)
+		}
+		if !entry.Next.IsZero() {
+			next := entry.Next
+			status.NextRun = &next
+		}
+		if !entry.Prev.IsZero() {
+			prev := entry.Prev
+			status.PrevRun = &prev
+		}
+	}
+	if job.lastRun != nil {
+		lastRun := *job.lastRun
+		status.LastRun = &lastRun
+	}
+	return status
+}
+
+// UpdateJob changes a named job's schedule or enables or disables it, and
+// persists the change so it survives restarts.
+func (s *Scheduler) UpdateJob(ctx context.Context, name string, update JobUpdate) (JobStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.job(name)
+	if job == nil {
+		return JobStatus{}, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	if update.Schedule != "" {
+		if _, err := cron.ParseStandard(update.Schedule); err != nil {
+			return JobStatus{}, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+	}
+
+	overrides := make(map[string]jobOverride, len(s.overrides)+1)
+	for jobName, override := range s.overrides {
+		overrides[jobName] = override
+	}
+	override := overrides[name]
+	if update.Schedule != "" {
+		override.Schedule = update.Schedule
+	}
+	if update.Enabled != nil {
+		enabled := *update.Enabled
+		override.Enabled = &enabled
+	}
+	overrides[name] = override
+	value, err := json.Marshal(overrides)
+	if err != nil {
+		return JobStatus{}, err
+	}
+	if err := s.manager.store.SetSetting(ctx, settingSchedulerJobs, string(value)); err != nil {
+		return JobStatus{}, fmt.Errorf("failed to persist job schedule: %w", err)
+	}
+	s.overrides = overrides
+
+	previous := job.Schedule
+	if update.Schedule != "" {
+		job.Schedule = update.Schedule
+	}
+	if update.Enabled != nil {
+		job.Disabled = !*update.Enabled
+	}
+	s.scheduleJob(job)
+
+	logger.For(ctx).Info("Scheduled job updated",
+		zap.String("job", name),
+		zap.String("schedule", job.Schedule),
+		zap.String("previous", previous),
+		zap.Bool("enabled", !job.Disabled))
+	return s.jobStatus(job, nil), nil
+}
+
+// RunJob runs a named job now, whether or not it is enabled, and returns
+// what happened.
+func (s *Scheduler) RunJob(name string) (ScheduledRun, error) {
+	s.mu.Lock()
+	job := s.job(name)
+	var run config.ScheduledJob
+	if job != nil {
+		run = job.ScheduledJob
+	}
+	s.mu.Unlock()
+	if job == nil {
+		return ScheduledRun{}, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+
+	s.runJob(run, TriggerManual)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job.lastRun == nil {
+		return ScheduledRun{}, nil
+	}
+	return *job.lastRun, nil
+}
+
+// runJob runs a named job.
+func (s *Scheduler) runJob(job config.ScheduledJob, trigger string) {
+	logger.Log.Info("Triggering scheduled job", zap.String("job", job.Name), zap.String("type", job.GetJob()), zap.String("trigger", trigger))
+	switch job.GetJob() {
+	case JobSync:
+		s.runSync(job.Name, trigger, job.Tables)
+	case JobResync:
+		s.runResync(job, trigger)
+	}
+}
+
+// runResync starts a rebuild of each of the job's tables, skipping those
+// already being rebuilt. Nothing is rebuilt between runs.
+func (s *Scheduler) runResync(job config.ScheduledJob, trigger string) {
+	if status := s.manager.GetStatus(); status == "idle" || status == "stopping" {
+		s.recordOutcome(job.Name, trigger, OutcomeSkipped, "no sync is running")
+		return
+	}
+	if trigger != TriggerManual {
+		if reason := s.blackoutReason(); reason != "" {
+			s.recordOutcome(job.Name, trigger, OutcomeSkipped, reason)
+			return
+		}
+	}
+	tables := job.Tables
+	if len(tables) == 0 {
+		tables = s.manager.RunTables()
+	}
+
+	var failed []string
+	for _, table := range tables {
+		if _, err := s.manager.ResyncTable(table, job.Mode); err != nil && !errors.Is(err, ErrResyncRunning) {
+			logger.Log.Error("Failed to start scheduled resync", zap.String("job", job.Name), zap.String("table", table), zap.Error(err))
+			failed = append(failed, fmt.Sprintf("%s: %v", table, err))
+		}
+	}
+	if len(failed) > 0 {
+		s.recordOutcome(job.Name, trigger, OutcomeFailed, strings.Join(failed, "; "))
+		return
+	}
+	s.recordOutcome(job.Name, trigger, OutcomeStarted, "")
+}
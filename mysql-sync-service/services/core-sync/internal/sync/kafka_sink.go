@@ -0,0 +1,273 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/segmentio/kafka-go"
+
+	"mysql-sync-service/internal/config"
+)
+
+// Kafka message formats
+const (
+	FormatJSON = "json"
+	FormatAvro = "avro"
+)
+
+const defaultTopicPrefix = "dbsync."
+
+// kafkaSink publishes one message per changed row to a topic per table,
+// keyed by primary key so all changes to a row land in one partition.
+type kafkaSink struct {
+	writer      *kafka.Writer
+	brokers     []string
+	topicPrefix string
+	format      string
+	pkColumns   map[string][]string
+	avro        *avroEncoder
+}
+
+func newKafkaSink(cfg config.SinkConfig, tables []config.TableConfig) (*kafkaSink, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka sink needs at least one broker")
+	}
+
+	format := cfg.Format
+	if format == "" {
+		format = FormatJSON
+	}
+	if format != FormatJSON && format != FormatAvro {
+		return nil, fmt.Errorf("unknown kafka format %q", cfg.Format)
+	}
+
+	topicPrefix := cfg.TopicPrefix
+	if topicPrefix == "" {
+		topicPrefix = defaultTopicPrefix
+	}
+
+	pkColumns := make(map[string][]string, len(tables))
+	for _, tableConfig := range tables {
+		for _, column := range strings.Split(tableConfig.PrimaryKey, ",") {
+			if column = strings.TrimSpace(column); column != "" {
+				pkColumns[tableConfig.Name] = append(pkColumns[tableConfig.Name], column)
+			}
+		}
+	}
+
+	sink := &kafkaSink{
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(cfg.Brokers...),
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+		},
+		brokers:     cfg.Brokers,
+		topicPrefix: topicPrefix,
+		format:      format,
+		pkColumns:   pkColumns,
+	}
+	if format == FormatAvro {
+		sink.avro = newAvroEncoder(topicPrefix)
+	}
+	return sink, nil
+}
+
+func (s *kafkaSink) Name() string {
+	return SinkKafka
+}
+
+func (s *kafkaSink) Apply(ctx context.Context, table string, events []BinlogEvent) error {
+	var messages []kafka.Message
+	for _, e := range events {
+		if err := e.checkImages(); err != nil {
+			return err
+		}
+		for _, change := range rowChanges(e) {
+			message, err := s.message(e, change)
+			if err != nil {
+				return fmt.Errorf("failed to encode %s at %s:%d: %w", e.Type, e.BinlogFile, e.BinlogPos, err)
+			}
+			messages = append(messages, message)
+		}
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return s.writer.WriteMessages(ctx, messages...)
+}
+
+// Ping checks that at least one broker accepts connections.
+func (s *kafkaSink) Ping(ctx context.Context) error {
+	var err error
+	for _, broker := range s.brokers {
+		var conn *kafka.Conn
+		if conn, err = kafka.DialContext(ctx, "tcp", broker); err == nil {
+			return conn.Close()
+		}
+	}
+	return err
+}
+
+func (s *kafkaSink) Close() error {
+	return s.writer.Close()
+}
+
+// rowChange is one row of an event in Debezium terms.
+type rowChange struct {
+	op     string // c, u or d
+	before []interface{}
+	after  []interface{}
+	row    int
+}
+
+func rowChanges(e BinlogEvent) []rowChange {
+	var changes []rowChange
+	switch e.Type {
+	case Insert:
+		for i, row := range e.Rows {
+			changes = append(changes, rowChange{op: "c", after: row, row: i})
+		}
+	case Update:
+		for i, row := range e.Rows {
+			changes = append(changes, rowChange{op: "u", before: e.Before[i], after: row, row: i})
+		}
+	case Delete:
+		for i, row := range e.Rows {
+			changes = append(changes, rowChange{op: "d", before: row, row: i})
+		}
+	}
+	return changes
+}
+
+// debeziumEnvelope follows the Debezium MySQL connector value layout
+// (without the inline schema), so existing consumers can read it.
+type debeziumEnvelope struct {
+	Before map[string]interface{} `json:"before"`
+	After  map[string]interface{} `json:"after"`
+	Source debeziumSource         `json:"source"`
+	Op     string                 `json:"op"`
+	TsMs   int64                  `json:"ts_ms"`
+}
+
+type debeziumSource struct {
+	Connector  string `json:"connector"`
+	Name       string `json:"name"`
+	ServerUUID string `json:"server_uuid,omitempty"`
+	TsMs       int64  `json:"ts_ms"`
+	DB         string `json:"db"`
+	Table      string `json:"table"`
+	GTID       string `json:"gtid,omitempty"`
+	File       string `json:"file"`
+	Pos        int64  `json:"pos"`
+	Row        int    `json:"row"`
+}
+
+func (s *kafkaSink) message(e BinlogEvent, change rowChange) (kafka.Message, error) {
+	// Tables outside the source database are named schema.table
+	_, table := config.SplitTable(e.Table, e.Schema)
+	source := debeziumSource{
+		Connector:  "mysql",
+		Name:       e.Source.SiteID,
+		ServerUUID: e.Source.ServerUUID,
+		TsMs:       int64(e.Timestamp) * 1000,
+		DB:         e.Schema,
+		Table:      table,
+		GTID:       e.GTID,
+		File:       e.BinlogFile,
+		Pos:        int64(e.BinlogPos),
+		Row:        change.row,
+	}
+	now := time.Now().UnixMilli()
+
+	keyRow := change.after
+	if keyRow == nil {
+		keyRow = change.before
+	}
+	key, err := s.key(e, keyRow)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+
+	var (
+		value       []byte
+		contentType string
+	)
+	if s.format == FormatAvro {
+		value, err = s.avro.Encode(e, change, source, now)
+		contentType = "application/avro"
+	} else {
+		value, err = json.Marshal(debeziumEnvelope{
+			Before: jsonRow(e.Columns, change.before),
+			After:  jsonRow(e.Columns, change.after),
+			Source: source,
+			Op:     change.op,
+			TsMs:   now,
+		})
+		contentType = "application/json"
+	}
+	if err != nil {
+		return kafka.Message{}, err
+	}
+
+	return kafka.Message{
+		Topic:   s.topicPrefix + e.Table,
+		Key:     key,
+		Value:   value,
+		Headers: []kafka.Header{{Key: "content-type", Value: []byte(contentType)}},
+	}, nil
+}
+
+// key is the JSON object of primary key values: the configured key's, else
+// the source's as the event describes it, or nil for a table with neither.
+func (s *kafkaSink) key(e BinlogEvent, row []interface{}) ([]byte, error) {
+	if row == nil {
+		return nil, nil
+	}
+	key := make(map[string]interface{})
+	if pkColumns := s.pkColumns[e.Table]; len(pkColumns) > 0 {
+		for _, pkColumn := range pkColumns {
+			for i, column := range e.Columns {
+				if strings.EqualFold(column, pkColumn) && i < len(row) {
+					key[column] = jsonValue(row[i])
+				}
+			}
+		}
+	} else {
+		for i, column := range e.ColumnMeta() {
+			if column.Key && i < len(row) {
+				key[column.Name] = jsonValue(row[i])
+			}
+		}
+	}
+	if len(key) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(key)
+}
+
+func jsonRow(columns []string, row []interface{}) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+	values := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		if i < len(row) {
+			values[column] = jsonValue(row[i])
+		}
+	}
+	return values
+}
+
+// jsonValue keeps text readable: canal hands text columns over as bytes.
+// Binary data stays []byte and is base64-encoded by encoding/json.
+func jsonValue(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok && utf8.Valid(b) {
+		return string(b)
+	}
+	return value
+}
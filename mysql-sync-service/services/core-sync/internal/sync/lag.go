@@ -0,0 +1,135 @@
+package sync
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/metrics"
+)
+
+const (
+	TableStatusRunning = "running"
+	TableStatusLagging = "lagging"
+)
+
+// LagAlertFunc is invoked when a table crosses its lag threshold in either
+// direction. lagging is true on the way up and false on recovery.
+type LagAlertFunc func(table string, lag, threshold time.Duration, lagging bool)
+
+// TableLag is the per-table replication lag snapshot exposed by the API.
+type TableLag struct {
+	Table         string    `json:"table"`
+	LagSeconds    float64   `json:"lag_seconds"`
+	ThresholdSecs float64   `json:"threshold_seconds,omitempty"`
+	Status        string    `json:"status"`
+	LastEventTime time.Time `json:"last_event_time"`
+	LastAppliedAt time.Time `json:"last_applied_at"`
+}
+
+// lagTracker records the event-to-apply delay for each table and flips a
+// table to "lagging" when it exceeds the configured threshold.
+type lagTracker struct {
+	mu         sync.RWMutex
+	thresholds map[string]time.Duration
+	tables     map[string]*TableLag
+	onAlert    LagAlertFunc
+}
+
+func newLagTracker(cfg config.SyncConfig, onAlert LagAlertFunc) *lagTracker {
+	thresholds := make(map[string]time.Duration)
+	for _, tableConfig := range cfg.Tables {
+		if threshold := tableConfig.GetLagThreshold(); threshold > 0 {
+			thresholds[tableConfig.Name] = threshold
+		} else if threshold := cfg.GetLagThreshold(); threshold > 0 {
+			thresholds[tableConfig.Name] = threshold
+		}
+	}
+
+	return &lagTracker{
+		thresholds: thresholds,
+		tables:     make(map[string]*TableLag),
+		onAlert:    onAlert,
+	}
+}
+
+// Observe records that an event written at eventTimestamp (unix seconds) was
+// applied now, and returns the table's resulting status.
+func (t *lagTracker) Observe(table string, eventTimestamp uint32) string {
+	if t == nil {
+		return TableStatusRunning
+	}
+
+	now := time.Now()
+	eventTime := time.Unix(int64(eventTimestamp), 0)
+	lag := now.Sub(eventTime)
+	if lag < 0 {
+		lag = 0
+	}
+	threshold := t.thresholds[table]
+
+	t.mu.Lock()
+	tableLag, ok := t.tables[table]
+	if !ok {
+		tableLag = &TableLag{Table: table, Status: TableStatusRunning}
+		t.tables[table] = tableLag
+	}
+	previousStatus := tableLag.Status
+	tableLag.LagSeconds = lag.Seconds()
+	tableLag.ThresholdSecs = threshold.Seconds()
+	tableLag.LastEventTime = eventTime
+	tableLag.LastAppliedAt = now
+	if threshold > 0 && lag > threshold {
+		tableLag.Status = TableStatusLagging
+	} else {
+		tableLag.Status = TableStatusRunning
+	}
+	status := tableLag.Status
+	t.mu.Unlock()
+
+	metrics.ReplicationLag.WithLabelValues(table).Set(lag.Seconds())
+	if status == TableStatusLagging {
+		metrics.TableLagging.WithLabelValues(table).Set(1)
+	} else {
+		metrics.TableLagging.WithLabelValues(table).Set(0)
+	}
+
+	if status != previousStatus {
+		if status == TableStatusLagging {
+			logger.Log.Warn("Table replication lag above threshold",
+				zap.String("table", table),
+				zap.Duration("lag", lag),
+				zap.Duration("threshold", threshold),
+			)
+		} else {
+			logger.Log.Info("Table replication lag recovered",
+				zap.String("table", table),
+				zap.Duration("lag", lag),
+			)
+		}
+		if t.onAlert != nil {
+			t.onAlert(table, lag, threshold, status == TableStatusLagging)
+		}
+	}
+
+	return status
+}
+
+// Snapshot returns a copy of the current per-table lag.
+func (t *lagTracker) Snapshot() []TableLag {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	snapshot := make([]TableLag, 0, len(t.tables))
+	for _, tableLag := range t.tables {
+		snapshot = append(snapshot, *tableLag)
+	}
+	return snapshot
+}
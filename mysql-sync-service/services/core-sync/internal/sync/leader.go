@@ -0,0 +1,258 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/store"
+)
+
+// ErrNotLeader is returned when starting a run on an instance standing by
+// while another one leads.
+var ErrNotLeader = errors.New("another instance is leading the sync")
+
+// ErrLeadershipLost ends the run of an instance that lost its lease.
+var ErrLeadershipLost = errors.New("leadership lost to another instance")
+
+// Roles of an instance in leader election
+const (
+	RoleLeader  = "leader"
+	RoleStandby = "standby"
+)
+
+// LeaderStatus is where the instance stands in leader election.
+type LeaderStatus struct {
+	Enabled   bool       `json:"enabled"`
+	Instance  string     `json:"instance,omitempty"`
+	Lease     string     `json:"lease,omitempty"`
+	Role      string     `json:"role,omitempty"`
+	Leader    bool       `json:"leader"`
+	Holder    string     `json:"holder,omitempty"`     // the leading instance, as last seen
+	Address   string     `json:"address,omitempty"`    // Holder's advertised API
+	Since     *time.Time `json:"since,omitempty"`      // when Holder took the lease
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // by the state store's clock
+
+	Standby *StandbyStatus `json:"standby,omitempty"`
+}
+
+// leaderElector campaigns for the lease of config.LeaderConfig every
+// renewal interval.
+type leaderElector struct {
+	lease    string
+	instance string
+	address  string
+	ttl      time.Duration
+	renew    time.Duration
+	window   time.Duration
+	client   *http.Client
+
+	mu         sync.Mutex
+	leader     bool
+	validUntil time.Time    // by the local clock; the lease is surely held until then
+	current    *store.Lease // as last read
+	failing    bool         // the last campaign failed; logged once until one succeeds
+	standby    standby
+}
+
+func newLeaderElector(cfg *config.Config) (*leaderElector, error) {
+	if !cfg.Leader.Enabled {
+		return nil, nil
+	}
+	e := &leaderElector{
+		lease:    cfg.Leader.Lease,
+		instance: cfg.Leader.Instance,
+		address:  strings.TrimRight(cfg.Leader.Advertise, "/"),
+		ttl:      cfg.Leader.GetTTL(),
+		renew:    cfg.Leader.GetRenewInterval(),
+		window:   cfg.Leader.GetFailoverWindow(),
+	}
+	e.client = &http.Client{Timeout: e.renew}
+	if e.lease == "" {
+		local, cloud := cfg.Databases.Local, cfg.Databases.Cloud
+		e.lease = fmt.Sprintf("sync|%s:%d|%s:%d/%s", local.Host, local.Port, cloud.Host, cloud.Port, cloud.Database)
+	}
+	if e.instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read hostname for leader election: %w", err)
+		}
+		e.instance = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	return e, nil
+}
+
+func (e *leaderElector) isLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// lead campaigns for the lease until the manager closes, then releases it
+// if held.
+func (m *Manager) lead() {
+	e := m.leader
+	logger.Log.Info("Standing for leader election",
+		zap.String("lease", e.lease),
+		zap.String("instance", e.instance),
+		zap.Duration("ttl", e.ttl),
+		zap.Duration("failover_window", e.window))
+
+	ticker := time.NewTicker(e.renew)
+	defer ticker.Stop()
+	for {
+		m.campaign()
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign takes or renews the lease, or, standing by, watches the leader
+// and takes the lease over from it once it has been unhealthy for the
+// failover window. An instance elected resumes what a failed leader left
+// running; one that lost the lease stops its run at once, before the new
+// leader starts applying the same changes.
+func (m *Manager) campaign() {
+	e := m.leader
+	started := time.Now()
+	ctx, cancel := context.WithTimeout(m.ctx, e.renew)
+	lease, err := m.store.AcquireLease(ctx, e.lease, e.instance, e.address, e.ttl)
+	cancel()
+	if err != nil && m.ctx.Err() != nil {
+		return
+	}
+	if err == nil && lease.Holder != e.instance {
+		if taken := m.watchLeader(lease); taken != nil {
+			lease = taken
+		}
+	}
+
+	e.mu.Lock()
+	was, wasFailing := e.leader, e.failing
+	e.failing = err != nil
+	switch {
+	case err != nil:
+		// Whether the lease was renewed isn't known; it is surely held
+		// until validUntil, and a standby may take it after
+		if e.leader && time.Now().After(e.validUntil) {
+			e.leader = false
+		}
+	case lease.Holder == e.instance:
+		e.leader, e.validUntil, e.current = true, started.Add(e.window), lease
+		e.standby = standby{}
+	default:
+		e.leader, e.current = false, lease
+	}
+	is := e.leader
+	e.mu.Unlock()
+
+	switch {
+	case err != nil && !wasFailing:
+		logger.Log.Warn("Failed to renew leader lease", zap.String("lease", e.lease), zap.Error(err))
+	case err == nil && wasFailing:
+		logger.Log.Info("Leader lease reachable again", zap.String("lease", e.lease), zap.String("holder", lease.Holder))
+	}
+	switch {
+	case is && !was:
+		logger.Log.Info("Elected leader", zap.String("lease", e.lease), zap.String("instance", e.instance))
+		m.takeOver()
+	case was && !is:
+		logger.Log.Warn("Lost leadership, stopping sync", zap.String("lease", e.lease), zap.String("instance", e.instance))
+		m.mu.Lock()
+		m.stop("failed", ErrLeadershipLost)
+		m.mu.Unlock()
+	}
+}
+
+// takeOver resumes the run a failed leader left unfinished: the newest run
+// in recent sync history still marked running is closed as failed, and its
+// tables synced again from their checkpoints.
+func (m *Manager) takeOver() {
+	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
+	defer cancel()
+
+	history, err := m.store.GetSyncHistory(ctx, nil, 20, 0)
+	if err != nil {
+		logger.Log.Warn("Failed to read sync history, not resuming the previous leader's run", zap.Error(err))
+		return
+	}
+	var orphan *store.SyncHistory
+	for _, run := range history {
+		if run.Status == "running" && run.ID != m.RunID() {
+			orphan = run
+			break
+		}
+	}
+	if orphan == nil {
+		return
+	}
+
+	orphan.Status = "failed"
+	orphan.CompletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	orphan.ErrorMessage = sql.NullString{String: "abandoned by the previous leader", Valid: true}
+	if err := m.stateWrites.UpdateSyncHistory(ctx, orphan); err != nil {
+		logger.Log.Warn("Failed to close the previous leader's run", zap.String("run_id", orphan.ID), zap.Error(err))
+	}
+
+	var tables []string
+	if orphan.TablesSynced != "" {
+		tables = strings.Split(orphan.TablesSynced, ",")
+	}
+	logger.Log.Info("Resuming the previous leader's run", zap.String("run_id", orphan.ID), zap.Strings("tables", tables))
+	if err := m.start(TriggerFailover, tables, runOptions{}); err != nil {
+		logger.Log.Error("Failed to resume the previous leader's run", zap.String("run_id", orphan.ID), zap.Error(err))
+	}
+}
+
+// releaseLeadership gives up the lease on shutdown, so another instance
+// takes over without waiting for it to expire.
+func (m *Manager) releaseLeadership() {
+	e := m.leader
+	if e == nil || !e.isLeader() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.store.ReleaseLease(ctx, e.lease, e.instance); err != nil {
+		logger.Log.Warn("Failed to release leader lease", zap.String("lease", e.lease), zap.Error(err))
+		return
+	}
+	e.mu.Lock()
+	e.leader = false
+	e.mu.Unlock()
+	logger.Log.Info("Released leader lease", zap.String("lease", e.lease))
+}
+
+// Leadership reports where the instance stands in leader election.
+func (m *Manager) Leadership() LeaderStatus {
+	e := m.leader
+	if e == nil {
+		return LeaderStatus{Leader: true}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	status := LeaderStatus{Enabled: true, Instance: e.instance, Lease: e.lease, Role: RoleStandby, Leader: e.leader}
+	if e.leader {
+		status.Role = RoleLeader
+	} else {
+		status.Standby = e.standby.status(e.window)
+	}
+	if e.current != nil {
+		since, expires := e.current.AcquiredAt, e.current.ExpiresAt
+		status.Holder, status.Address, status.Since, status.ExpiresAt = e.current.Holder, e.current.Address, &since, &expires
+	}
+	return status
+}
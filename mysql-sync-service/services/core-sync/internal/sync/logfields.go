@@ -0,0 +1,143 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/schema"
+	"go.uber.org/zap"
+)
+
+// eventFields returns the structured fields that locate a single event in
+// the binlog, so log lines can be matched with positions during recovery.
+func eventFields(runID string, e BinlogEvent) []zap.Field {
+	fields := []zap.Field{
+		zap.String("run_id", runID),
+		zap.String("table", e.Table),
+		zap.String("binlog_file", e.BinlogFile),
+		zap.Uint32("binlog_pos", e.BinlogPos),
+	}
+	if e.GTID != "" {
+		fields = append(fields, zap.String("gtid", e.GTID))
+	}
+	if e.Source.SiteID != "" {
+		fields = append(fields, zap.String("source_site", e.Source.SiteID))
+	}
+	if len(e.PrimaryKeys) > 0 {
+		fields = append(fields,
+			zap.String("pk_first", e.PrimaryKeys[0]),
+			zap.String("pk_last", e.PrimaryKeys[len(e.PrimaryKeys)-1]),
+		)
+	}
+	return fields
+}
+
+// batchFields describes the binlog span covered by a group of events for
+// one table: first/last coordinates and the primary key range touched.
+func batchFields(runID string, table string, events []BinlogEvent) []zap.Field {
+	fields := []zap.Field{
+		zap.String("run_id", runID),
+		zap.String("table", table),
+		zap.Int("events", len(events)),
+	}
+	if len(events) == 0 {
+		return fields
+	}
+
+	first := events[0]
+	last := events[len(events)-1]
+	fields = append(fields,
+		zap.String("binlog_file", first.BinlogFile),
+		zap.Uint32("binlog_pos", first.BinlogPos),
+		zap.String("binlog_end_file", last.BinlogFile),
+		zap.Uint32("binlog_end_pos", last.BinlogPos),
+	)
+	if last.GTID != "" {
+		fields = append(fields, zap.String("gtid", last.GTID))
+	}
+	if last.Source.SiteID != "" {
+		fields = append(fields, zap.String("source_site", last.Source.SiteID))
+	}
+
+	var pkFirst, pkLast string
+	for _, e := range events {
+		if len(e.PrimaryKeys) == 0 {
+			continue
+		}
+		if pkFirst == "" {
+			pkFirst = e.PrimaryKeys[0]
+		}
+		pkLast = e.PrimaryKeys[len(e.PrimaryKeys)-1]
+	}
+	if pkFirst != "" {
+		fields = append(fields, zap.String("pk_first", pkFirst), zap.String("pk_last", pkLast))
+	}
+	return fields
+}
+
+// formatPrimaryKeys renders the primary key of every row image; for updates
+// that is the new image.
+func formatPrimaryKeys(table *schema.Table, rows [][]interface{}) []string {
+	if table == nil || len(table.PKColumns) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(rows))
+	for _, row := range rows {
+		parts := make([]string, 0, len(table.PKColumns))
+		for _, columnIndex := range table.PKColumns {
+			if columnIndex < len(row) {
+				parts = append(parts, fmt.Sprint(row[columnIndex]))
+			}
+		}
+		keys = append(keys, strings.Join(parts, ","))
+	}
+	return keys
+}
+
+func columnNames(table *schema.Table) []string {
+	if table == nil {
+		return nil
+	}
+	names := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+func keyColumnNames(table *schema.Table) []string {
+	if table == nil {
+		return nil
+	}
+	names := make([]string, 0, len(table.PKColumns))
+	for _, index := range table.PKColumns {
+		names = append(names, table.Columns[index].Name)
+	}
+	return names
+}
+
+func columnTypes(table *schema.Table) []string {
+	if table == nil {
+		return nil
+	}
+	types := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		types[i] = column.RawType
+	}
+	return types
+}
+
+// generatedColumns lists the table's virtual and stored generated columns.
+func generatedColumns(table *schema.Table) []string {
+	if table == nil {
+		return nil
+	}
+	var names []string
+	for _, column := range table.Columns {
+		if column.IsVirtual || column.IsStored {
+			names = append(names, column.Name)
+		}
+	}
+	return names
+}
@@ -2,29 +2,97 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
-	
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/alerting"
 	"mysql-sync-service/internal/config"
 	"mysql-sync-service/internal/database"
+	"mysql-sync-service/internal/encryption"
+	"mysql-sync-service/internal/ids"
 	"mysql-sync-service/internal/logger"
 	"mysql-sync-service/internal/store"
 )
 
+// ErrAlreadyRunning is returned by Start when a sync run is in progress.
+var ErrAlreadyRunning = errors.New("sync is already running")
+
+// ErrNotRunning is returned when pausing or resuming without an active run.
+var ErrNotRunning = errors.New("sync is not running")
+
+// ErrUnknownTable is returned for tables that are not in the sync config.
+var ErrUnknownTable = errors.New("table is not configured for sync")
+
+// ErrPartialGroup is returned when a run selects some, but not all, tables
+// of a sync group.
+var ErrPartialGroup = errors.New("sync group tables must be synced together")
+
+// ErrClosed is returned when starting a run after the Manager was closed.
+var ErrClosed = errors.New("sync manager is closed")
+
 type Manager struct {
 	cfg            *config.Config
 	localDB        *database.Database
 	cloudDB        *database.Database
 	store          store.Store
 	binlogListener *BinlogListener
+	poller         *Poller
+	dumpLoader     *DumpLoader
+	queue          eventQueue
 	workerPool     *WorkerPool
 	ctx            context.Context
 	cancel         context.CancelFunc
 	mu             sync.Mutex
-	status         string
+	stats          *Stats
+	run            *syncRun
+	lagAlert       LagAlertFunc
+	alerts         *alerting.Manager
+	keyring        *encryption.Keyring
+	hasher         *encryption.Hasher
+	rotator        *encryption.Rotator
+	events         *eventHub
+	copies         *copyProgress
+	health         *healthTracker
+	schemas        *schemaTracker
+	registry       *schemaRegistry
+	throttle       *applyThrottle
+	tuning         Tuning
+	tuned          Tuning // the settings UpdateSyncSettings persisted; zero ones weren't
+	configured     Tuning // config.yaml's, as last loaded
+	audit          *auditor
+	conflicts      *ConflictManager
+	operations     *operations
+	stateWrites    *storeBuffer
+	rows           *rowCounts
+	sampler        *eventSampler
+	serverID       uint32
+	closed         bool
+	leader         *leaderElector // nil unless leader election is enabled
+
+	// The synced tables, patterns expanded; discovery adds to them
+	tablesMu sync.RWMutex
+	tables   []config.TableConfig
+	// The tables as configured, patterns and all; nil without patterns
+	selection *config.SyncConfig
+	skipped   map[string]string // tables selection matched but left out, and why
 }
 
 func NewManager(cfg *config.Config, store store.Store) (*Manager, error) {
+	// Changes are read from the local binlog, so only the cloud side may use another driver
+	if dialect, err := database.NewDialect(cfg.Databases.Local.Driver); err != nil {
+		return nil, err
+	} else if dialect.Name() != database.DriverMySQL {
+		return nil, fmt.Errorf("local database must be mysql, got %s", dialect.Name())
+	}
+	if _, err := cfg.Sync.Conversion.GetLocation(); err != nil {
+		return nil, fmt.Errorf("invalid conversion timezone: %w", err)
+	}
+
 	// Connect to local DB
 	localDB, err := database.NewDatabase(cfg.Databases.Local)
 	if err != nil {
@@ -37,83 +105,723 @@ func NewManager(cfg *config.Config, store store.Store) (*Manager, error) {
 		localDB.Close()
 		return nil, fmt.Errorf("failed to connect to cloud db: %w", err)
 	}
+	return newManager(cfg, store, localDB, cloudDB)
+}
+
+// newManager builds the Manager over connected databases, closing them if
+// it fails.
+func newManager(cfg *config.Config, store store.Store, localDB, cloudDB *database.Database) (*Manager, error) {
+	var err error
+	// Each side converts what it is sent from the other's charset
+	local, cloud := cfg.Databases.Local.Charset, cfg.Databases.Cloud.Charset
+	if localDB.Converter, err = database.NewConverter(localDB.Dialect, cfg.Sync.Conversion.Strict, cloud, local); err == nil {
+		cloudDB.Converter, err = database.NewConverter(cloudDB.Dialect, cfg.Sync.Conversion.Strict, local, cloud)
+	}
+	if err != nil {
+		localDB.Close()
+		cloudDB.Close()
+		return nil, fmt.Errorf("invalid charset: %w", err)
+	}
+
+	// Patterns select the tables there are now; discovery adds new ones
+	var selection *config.SyncConfig
+	skipped := make(map[string]string)
+	if hasTablePatterns(cfg.Sync) {
+		configured := cfg.Sync
+		selection = &configured
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		tables, err := selectTables(ctx, configured, localDB, cloudDB, skipped)
+		cancel()
+		if err != nil {
+			localDB.Close()
+			cloudDB.Close()
+			return nil, fmt.Errorf("failed to select tables: %w", err)
+		}
+		cfg.Sync.Tables = tables
+	}
+
+	keyring, err := encryption.NewKeyring(cfg.Encryption)
+	if err != nil {
+		localDB.Close()
+		cloudDB.Close()
+		return nil, fmt.Errorf("failed to load encryption keys: %w", err)
+	}
+	hasher, err := encryption.NewHasher(cfg.Encryption)
+	if err != nil {
+		localDB.Close()
+		cloudDB.Close()
+		return nil, fmt.Errorf("failed to load encryption keys: %w", err)
+	}
+
+	audit, err := newAuditor(cfg.Audit, store)
+	if err != nil {
+		localDB.Close()
+		cloudDB.Close()
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	leader, err := newLeaderElector(cfg)
+	if err != nil {
+		localDB.Close()
+		cloudDB.Close()
+		audit.Close()
+		return nil, err
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Manager{
-		cfg:     cfg,
-		localDB: localDB,
-		cloudDB: cloudDB,
-		store:   store,
-		ctx:     ctx,
-		cancel:  cancel,
-		status:  "idle",
-	}, nil
+	m := &Manager{
+		cfg:       cfg,
+		localDB:   localDB,
+		cloudDB:   cloudDB,
+		store:     store,
+		ctx:       ctx,
+		cancel:    cancel,
+		stats:     newStats(),
+		keyring:   keyring,
+		hasher:    hasher,
+		rotator:   encryption.NewRotator(keyring, cloudDB, cfg.Encryption.RotationChunkSize),
+		events:    newEventHub(),
+		health:    newHealthTracker(),
+		schemas:   newSchemaTracker(store),
+		registry:  newSchemaRegistry(localDB, cloudDB),
+		throttle:  newApplyThrottle(throttleFromConfig(cfg.Sync)),
+		tuning:    tuningFromConfig(cfg.Sync),
+		audit:     audit,
+		conflicts: NewConflictManager(store, cfg.Sync.Conflicts),
+	}
+	m.stateWrites = newStoreBuffer(store, cfg.StateStorage.Buffer, m.health)
+	m.copies = newCopyProgress(m.events)
+	m.operations = newOperations()
+	m.conflicts.OnRecorded(m.autoResolve)
+	m.stats.export()
+	m.rows = newRowCounts(store)
+	m.sampler = newEventSampler(cfg.Sync.Debug)
+	m.leader = leader
+	m.tables, m.selection, m.skipped = cfg.Sync.Tables, selection, skipped
+	go m.stateWrites.run(ctx)
+	m.configured = m.tuning
+	m.loadThrottle()
+	m.loadTuning()
+	m.loadTableStats()
+	go m.persistTableStats()
+	if m.leader != nil {
+		go m.lead()
+	}
+	if interval := cfg.Sync.GetDiscoveryInterval(); m.selection != nil && interval > 0 {
+		go m.discoverTables(interval)
+	}
+	return m, nil
 }
 
+// Start begins a manually triggered sync run.
 func (m *Manager) Start() error {
+	return m.start(TriggerManual, nil, runOptions{})
+}
+
+// StartTables begins a manually triggered run that syncs only tables.
+func (m *Manager) StartTables(tables []string) error {
+	return m.start(TriggerManual, tables, runOptions{})
+}
+
+// runOptions are how a run starts, besides its tables.
+type runOptions struct {
+	BootstrapOptions
+	replay *ReplayOptions
+}
+
+// Restart stops the current run, if any, and starts another over the same
+// tables, or over the last run's if none is running, e.g. to recover from
+// a failed run. Nothing else can start a run in between.
+func (m *Manager) Restart() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tables []string
+	if m.run != nil {
+		tables = m.run.tables
+	}
+	m.stop("completed", nil)
+	return m.startLocked(TriggerRestart, tables, runOptions{})
+}
+
+// start begins a run over tables, or over every configured table if nil,
+// bootstrapping the target or replaying first as opts say.
+func (m *Manager) start(trigger string, tables []string, opts runOptions) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.startLocked(trigger, tables, opts)
+}
+
+// startLocked is start with m.mu held. A run that fails to start leaves
+// nothing running and the last run current.
+func (m *Manager) startLocked(trigger string, tables []string, opts runOptions) (err error) {
+	if m.closed {
+		return ErrClosed
+	}
+	if m.stats.state() == "running" || m.stats.state() == "paused" {
+		return ErrAlreadyRunning
+	}
+	if m.leader != nil && !m.leader.isLeader() {
+		return ErrNotLeader
+	}
 
-	if m.status == "running" {
-		return fmt.Errorf("sync is already running")
+	syncCfg, err := m.runConfig(tables)
+	if err != nil {
+		return err
 	}
+	syncCfg = m.tuning.apply(syncCfg)
+
+	// From here a failure is the run's, and is kept in sync history
+	runID, startedAt := ids.New(), time.Now()
+	defer func() {
+		if err != nil {
+			m.recordRunFailure(runID, trigger, startedAt, syncCfg.Tables, err)
+		}
+	}()
 
-	logger.Log.Info("Starting sync manager")
+	logger.Log.Info("Starting sync manager", zap.Int("tables", len(syncCfg.Tables)))
+
+	// A new target gets its tables before preflight checks them
+	schema := opts.Schema
+	if schema == "" {
+		schema = syncCfg.TargetSchema
+	}
+	if schema != "" && m.writesToTarget() && !syncCfg.Observe {
+		if err := m.applyTargetSchema(syncCfg.Tables, schema); err != nil {
+			return err
+		}
+	}
+
+	// Tables may have changed while no run was watching for DDL
+	m.registry.Reset()
+	if err := m.preflight(syncCfg.Tables); err != nil {
+		return err
+	}
+
+	var replay *replayState
+	if opts.replay != nil {
+		if replay, err = m.prepareReplay(syncCfg, *opts.replay); err != nil {
+			return err
+		}
+		if m.writesToTarget() && !syncCfg.Observe {
+			ctx, cancel := context.WithTimeout(m.ctx, preflightTimeout)
+			err := rewindCheckpoints(ctx, m.cloudDB, opts.replay.Tables)
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+	}
 
 	// Initialize Binlog Listener
 	// Determine source based on config. For bidirectional, we might need two listeners.
 	// For simplicity, let's assume Local -> Cloud for now as per "Phase 2"
-	
-	listener, err := NewBinlogListener(m.cfg.Databases.Local, m.cfg.Sync.Tables)
-	if err != nil {
+
+	// Fresh budget per run: events left in a closed channel are never released
+	run := &syncRun{
+		id:        runID,
+		direction: DirectionLocalToCloud,
+		trigger:   trigger,
+		startedAt: startedAt,
+		tables:    tableNames(syncCfg.Tables),
+		budget:    newByteBudget(syncCfg.MaxBufferedBytes),
+		lag:       newLagTracker(syncCfg, m.lagAlert),
+		alerts:    m.alerts,
+		events:    m.events,
+		copies:    m.copies,
+		health:    m.health,
+		schemas:   m.schemas,
+		registry:  m.registry,
+		stats:     newRunStats(m.stats),
+		rows:      m.rows,
+		sampler:   m.sampler,
+		throttle:  m.throttle,
+		resyncs:   newResyncs(),
+	}
+	run.progress = newTxnProgress(run.id, syncCfg.Apply.GetProgressRows())
+	if syncCfg.Observe {
+		run.observed = newObservations()
+	} else {
+		run.audit = m.audit
+		run.conflicts = m.conflicts
+	}
+	run.replay = replay
+	if run.policies, err = newColumnPolicies(syncCfg.Tables, m.keyring, m.hasher); err != nil {
 		return err
 	}
-	m.binlogListener = listener
+	logger.Log.Info("Sync run starting", zap.String("run_id", run.id), zap.String("direction", run.direction), zap.String("trigger", trigger), zap.Bool("observe", syncCfg.Observe))
+
+	queue, err := newEventQueue(syncCfg.Queue, run.budget)
+	if err != nil {
+		return fmt.Errorf("failed to create event queue: %w", err)
+	}
+
+	// Tables without binlog access are polled instead
+	var binlogTables, pollTables []config.TableConfig
+	for _, table := range syncCfg.Tables {
+		switch capture := table.GetCapture(syncCfg.Capture); capture {
+		case CaptureBinlog:
+			binlogTables = append(binlogTables, table)
+		case CapturePolling:
+			pollTables = append(pollTables, table)
+		default:
+			queue.Close()
+			return fmt.Errorf("table %s: unknown capture mode %q", table.Name, capture)
+		}
+	}
+
+	var listener *BinlogListener
+	if len(binlogTables) > 0 || len(syncCfg.Groups) > 0 {
+		// Groups need the listener's transaction boundaries, so their
+		// tables must be captured from the binlog
+		serverID, err := m.replicaServerID()
+		if err != nil {
+			queue.Close()
+			return err
+		}
+		listener, err = NewBinlogListener(m.cfg.Databases.Local, serverID, binlogTables, syncCfg.Groups, syncCfg.Transactions, syncCfg.Watchdog, syncCfg.Conversion, queue, run)
+		if err != nil {
+			queue.Close()
+			return err
+		}
+	}
+
+	var poller *Poller
+	if len(pollTables) > 0 {
+		poller, err = NewPoller(syncCfg, m.localDB, pollTables, queue, m.store, run)
+		if err != nil {
+			if listener != nil {
+				listener.canal.Close()
+			}
+			queue.Close()
+			return err
+		}
+	}
+
+	if replay != nil {
+		if listener == nil {
+			queue.Close()
+			return fmt.Errorf("%w: no table is captured from the binlog", ErrInvalidReplay)
+		}
+		err := listener.StartAt(replay.coords)
+		if err == nil {
+			replay.until, err = listener.sourcePosition()
+		}
+		if err != nil {
+			listener.canal.Close()
+			queue.Close()
+			return err
+		}
+		listener.SkipBefore(replay.since)
+		logger.Log.Info("Replaying binlog",
+			zap.String("run_id", run.id),
+			zap.String("binlog_file", replay.coords.BinlogFile),
+			zap.Uint32("binlog_pos", replay.coords.BinlogPos),
+			zap.String("gtid_set", replay.coords.GTIDSet),
+			zap.Time("since", replay.since),
+			zap.Strings("tables", opts.replay.Tables),
+			zap.Bool("upsert", replay.upsert),
+		)
+	}
+
+	// Polled tables aren't in the dump's coordinates, so only binlog
+	// tables are loaded from it
+	var loader *DumpLoader
+	if opts.Dump != "" || len(opts.CSV) > 0 {
+		if listener == nil {
+			queue.Close()
+			return fmt.Errorf("%w: no table is captured from the binlog", ErrInvalidDump)
+		}
+		if opts.Dump != "" {
+			loader, err = NewDumpLoader(opts.Dump, m.cfg.Databases.Local, binlogTables, queue, run)
+		} else {
+			loader, err = NewCSVLoader(opts.CSV, opts.Coordinates, m.cfg.Databases.Local, binlogTables, queue, run)
+		}
+		if err == nil {
+			err = m.prepareSnapshot(syncCfg, opts.Snapshot, loader.tableConfigs(), run)
+		}
+		if err == nil {
+			err = listener.StartAt(loader.Coordinates())
+		}
+		if err != nil {
+			listener.canal.Close()
+			queue.Close()
+			return err
+		}
+	}
+
+	if syncCfg.ExactlyOnce && listener != nil && replay == nil && loader == nil && m.writesToTarget() && !syncCfg.Observe {
+		tables := make([]string, 0, len(binlogTables)+len(syncCfg.Groups))
+		for _, tableConfig := range binlogTables {
+			tables = append(tables, tableConfig.Name)
+		}
+		for _, group := range syncCfg.Groups {
+			// A group's changes are checkpointed under its name
+			tables = append(tables, group.Name)
+		}
+		if err := m.resumeFromTarget(listener, tables); err != nil {
+			listener.canal.Close()
+			queue.Close()
+			return err
+		}
+	}
 
 	// Initialize Worker Pool (target is Cloud)
-	m.workerPool = NewWorkerPool(m.cfg.Sync, m.cloudDB, m.store, listener.Events())
+	pool, err := NewWorkerPool(syncCfg, m.cloudDB, m.stateWrites, queue, run)
+	if err != nil {
+		if listener != nil {
+			listener.canal.Close()
+		}
+		queue.Close()
+		return fmt.Errorf("failed to create worker pool: %w", err)
+	}
+	m.binlogListener = listener
+	m.poller = poller
+	m.dumpLoader = loader
+	m.queue = queue
+	m.workerPool = pool
 	m.workerPool.Start()
 
-	// Start Listener
-	if err := m.binlogListener.Start(); err != nil {
-		m.workerPool.Stop()
-		return err
+	// Start capturing, from a dump's coordinates once it is applied
+	if loader != nil {
+		loader.Start(func() {
+			if err := listener.Start(); err != nil {
+				logger.Log.Error("Failed to start binlog listener", zap.String("run_id", run.id), zap.Error(err))
+			}
+		}, func(err error) {
+			go m.abort(run, err)
+		})
+	} else if listener != nil {
+		if err := listener.Start(); err != nil {
+			listener.Stop()
+			queue.Close()
+			pool.Stop()
+			m.binlogListener, m.poller, m.dumpLoader, m.queue = nil, nil, nil, nil
+			return err
+		}
+	}
+	if poller != nil {
+		poller.Start()
 	}
 
-	m.status = "running"
+	m.run = run
+	m.stats.runStarted(run, listener, loader)
+	m.stats.setState("running")
+	m.recordRunStart(run)
+	run.stopHistory = m.recordRunRows(run)
+	m.events.publish(SyncEvent{Type: EventRunStarted, RunID: run.id, Status: m.stats.state()})
 	return nil
 }
 
+// runConfig narrows the sync config to tables; nil selects every table.
+// Sync groups are kept when all their tables are selected.
+func (m *Manager) runConfig(tables []string) (config.SyncConfig, error) {
+	cfg := m.cfg.Sync
+	cfg.Tables = m.tableConfigs()
+	if len(tables) == 0 {
+		return cfg, nil
+	}
+
+	selected := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		if !m.hasTable(table) {
+			return cfg, fmt.Errorf("%w: %s", ErrUnknownTable, table)
+		}
+		selected[table] = true
+	}
+
+	all := cfg.Tables
+	cfg.Tables = nil
+	for _, table := range all {
+		if selected[table.Name] {
+			cfg.Tables = append(cfg.Tables, table)
+		}
+	}
+	cfg.Groups = nil
+	for _, group := range m.cfg.Sync.Groups {
+		var count int
+		for _, table := range group.Tables {
+			if selected[table] {
+				count++
+			}
+		}
+		switch count {
+		case 0:
+		case len(group.Tables):
+			cfg.Groups = append(cfg.Groups, group)
+		default:
+			return cfg, fmt.Errorf("%w: %s needs %s", ErrPartialGroup, group.Name, strings.Join(group.Tables, ", "))
+		}
+	}
+	return cfg, nil
+}
+
+// tableConfigs returns the synced tables. The slice is never modified, so
+// it may be kept.
+func (m *Manager) tableConfigs() []config.TableConfig {
+	m.tablesMu.RLock()
+	defer m.tablesMu.RUnlock()
+	return m.tables
+}
+
+func (m *Manager) hasTable(name string) bool {
+	for _, table := range m.tableConfigs() {
+		if table.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func tableNames(tables []config.TableConfig) []string {
+	names := make([]string, len(tables))
+	for i, table := range tables {
+		names[i] = table.Name
+	}
+	return names
+}
+
 func (m *Manager) Stop() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.stop("completed", nil)
+}
 
-	if m.status != "running" {
+// abort ends run, if it is still the current one, as failed by cause.
+func (m *Manager) abort(run *syncRun, cause error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.run == run {
+		m.stop("failed", cause)
+	}
+}
+
+// stop tears the current run down and records it with status, and the
+// error that ended it if any. m.mu must be held.
+func (m *Manager) stop(status string, cause error) {
+	if m.stats.state() != "running" && m.stats.state() != "paused" {
 		return
 	}
 
 	logger.Log.Info("Stopping sync manager")
+	m.stats.setState("stopping")
+	processed, batches := m.run.stats.progress()
 
+	if m.dumpLoader != nil {
+		m.dumpLoader.Stop()
+	}
 	if m.binlogListener != nil {
 		m.binlogListener.Stop()
 	}
+	if m.poller != nil {
+		m.poller.Stop()
+	}
+	if m.queue != nil {
+		m.queue.Close()
+	}
+	// Before the workers, which may be waiting on a rebuild's swap
+	m.run.resyncs.Stop()
 
 	if m.workerPool != nil {
 		m.workerPool.Stop()
 	}
+	// The pool stays, for the last run's circuit breakers
+	m.binlogListener, m.poller, m.dumpLoader, m.queue = nil, nil, nil, nil
+	m.stats.runStopped()
+
+	report := m.shutdownReport(m.run, processed, batches)
+	m.stats.setState("idle")
+	m.run.stopHistory()
+	m.recordRunEnd(m.run, status, report, cause)
+	stopped := SyncEvent{Type: EventRunStopped, RunID: m.run.id, Status: m.stats.state()}
+	if cause != nil {
+		stopped.Error = cause.Error()
+	}
+	m.events.publish(stopped)
+}
+
+// Pause holds the binlog listener without tearing the run down. Workers
+// drain what is already buffered.
+func (m *Manager) Pause() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stats.state() == "paused" {
+		return nil
+	}
+	if m.stats.state() != "running" {
+		return ErrNotRunning
+	}
 
-	m.status = "idle"
+	logger.Log.Info("Pausing sync manager", zap.String("run_id", m.run.id))
+	m.run.gate.Pause()
+	m.stats.setState("paused")
+	m.events.publish(SyncEvent{Type: EventRunPaused, RunID: m.run.id, Status: m.stats.state()})
+	return nil
 }
 
+// Resume continues a paused run from where the listener stopped.
+func (m *Manager) Resume() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stats.state() == "running" {
+		return nil
+	}
+	if m.stats.state() != "paused" {
+		return ErrNotRunning
+	}
+
+	logger.Log.Info("Resuming sync manager", zap.String("run_id", m.run.id))
+	m.run.gate.Resume()
+	m.stats.setState("running")
+	m.events.publish(SyncEvent{Type: EventRunResumed, RunID: m.run.id, Status: m.stats.state()})
+	return nil
+}
+
+// Close stops the current run and releases the databases; no run can be
+// started afterwards.
 func (m *Manager) Close() {
-	m.Stop()
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.stop("completed", nil)
+	m.closed = true
+	m.mu.Unlock()
+	m.releaseLeadership()
+
+	m.conflicts.Close()
+	m.audit.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	m.saveTableStats(ctx)
+	cancel()
+	if m.stateWrites.waiting() {
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		if err := m.stateWrites.Flush(ctx); err != nil {
+			logger.Log.Error("State store unavailable, held writes lost; the next start resumes from the last persisted checkpoints",
+				zap.Int("checkpoints", m.stateWrites.heldStates()), zap.Error(err))
+		}
+		cancel()
+	}
+	m.cancel()
 	m.localDB.Close()
 	m.cloudDB.Close()
 }
 
-func (m *Manager) GetStatus() string {
+// SetLagAlertHandler registers a callback fired when a table starts or stops
+// lagging. It takes effect on the next Start.
+func (m *Manager) SetLagAlertHandler(fn LagAlertFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lagAlert = fn
+}
+
+// GetTableLag returns the replication lag of every table seen this run.
+func (m *Manager) GetTableLag() []TableLag {
+	m.mu.Lock()
+	run := m.run
+	m.mu.Unlock()
+	if run == nil {
+		return nil
+	}
+	return run.lag.Snapshot()
+}
+
+// GetLagThreshold reports the global lag threshold, for display purposes.
+func (m *Manager) GetLagThreshold() time.Duration {
+	return m.cfg.Sync.GetLagThreshold()
+}
+
+// BufferedBytes returns the approximate size of events waiting to be applied.
+func (m *Manager) BufferedBytes() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.run == nil {
+		return 0
+	}
+	return m.run.budget.InFlight()
+}
+
+// QueueBacklog reports the running sync's event queue: what it holds for
+// the workers, and how long the oldest spilled event has waited. Nil when
+// no sync is running.
+func (m *Manager) QueueBacklog() *QueueBacklog {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.queue == nil {
+		return nil
+	}
+	backlog := m.queue.Backlog()
+	return &backlog
+}
+
+// RunTables lists the tables of the current (or last) sync run.
+func (m *Manager) RunTables() []string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	return m.status
+	if m.run == nil {
+		return nil
+	}
+	return m.run.tables
+}
+
+// RunID identifies the current (or last) sync run in logs.
+func (m *Manager) RunID() string {
+	return m.stats.runID.Load().(string)
+}
+
+// LargeTransactions reports the progress of the current run's large source
+// transactions.
+func (m *Manager) LargeTransactions() []LargeTransaction {
+	m.mu.Lock()
+	run := m.run
+	m.mu.Unlock()
+	if run == nil {
+		return nil
+	}
+	return run.progress.Snapshot()
+}
+
+// Observations reports what the current run's changes would have done to
+// the target, per table, or nil unless the run is observing.
+func (m *Manager) Observations() []TableObservation {
+	m.mu.Lock()
+	run := m.run
+	m.mu.Unlock()
+	if run == nil || run.observed == nil {
+		return nil
+	}
+	return run.observed.Snapshot()
+}
+
+// Subscribe streams sync activity until the returned cancel func is called.
+func (m *Manager) Subscribe(buffer int) (<-chan SyncEvent, func()) {
+	return m.events.subscribe(buffer)
+}
+
+// CircuitBreakers reports the circuit breaker of each sink of the current
+// (or last) run.
+func (m *Manager) CircuitBreakers() []CircuitStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.workerPool == nil {
+		return nil
+	}
+	return m.workerPool.Breakers()
+}
+
+// Health reports whether recent batches have been applying cleanly.
+func (m *Manager) Health() HealthStatus {
+	return m.health.Snapshot()
+}
+
+// GetStatus reports idle, running, paused, stopping while a run drains,
+// loading while a run loads a dump, or degraded while a running run's
+// binlog stream is being reconnected. It doesn't wait for a run that is
+// starting or stopping.
+func (m *Manager) GetStatus() string {
+	return m.stats.Status()
 }
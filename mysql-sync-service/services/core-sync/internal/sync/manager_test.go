@@ -0,0 +1,303 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/store"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+// memoryStore keeps the state a run reads and writes in memory. Calls it
+// doesn't implement panic, through the nil embedded Store.
+type memoryStore struct {
+	store.Store
+
+	mu       gosync.Mutex
+	states   map[string]*store.SyncState
+	history  map[string]*store.SyncHistory
+	settings map[string]string
+	schemas  map[string][]store.SchemaVersion
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		states:   make(map[string]*store.SyncState),
+		history:  make(map[string]*store.SyncHistory),
+		settings: make(map[string]string),
+		schemas:  make(map[string][]store.SchemaVersion),
+	}
+}
+
+func (s *memoryStore) GetSyncState(_ context.Context, tableName string) (*store.SyncState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.states[tableName]; ok {
+		copied := *state
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (s *memoryStore) UpdateSyncState(_ context.Context, state *store.SyncState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *state
+	s.states[state.TableName] = &copied
+	return nil
+}
+
+func (s *memoryStore) CreateSyncHistory(_ context.Context, history *store.SyncHistory) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *history
+	s.history[history.ID] = &copied
+	return nil
+}
+
+func (s *memoryStore) UpdateSyncHistory(ctx context.Context, history *store.SyncHistory) error {
+	return s.CreateSyncHistory(ctx, history)
+}
+
+func (s *memoryStore) runs() map[string]store.SyncHistory {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := make(map[string]store.SyncHistory, len(s.history))
+	for id, history := range s.history {
+		runs[id] = *history
+	}
+	return runs
+}
+
+func (s *memoryStore) CreateSchemaVersion(_ context.Context, version *store.SchemaVersion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	version.Version = len(s.schemas[version.TableName]) + 1
+	s.schemas[version.TableName] = append(s.schemas[version.TableName], *version)
+	return nil
+}
+
+func (s *memoryStore) GetLatestSchemaVersion(_ context.Context, tableName string) (*store.SchemaVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versions := s.schemas[tableName]
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	latest := versions[len(versions)-1]
+	return &latest, nil
+}
+
+// Runs here apply without failing, so no dead letters are written.
+func (s *memoryStore) CountDeadLetters(context.Context, string) (int, error) {
+	return 0, nil
+}
+
+func (s *memoryStore) GetSetting(_ context.Context, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settings[name], nil
+}
+
+func (s *memoryStore) SetSetting(_ context.Context, name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings[name] = value
+	return nil
+}
+
+func (s *memoryStore) Ping(context.Context) error {
+	return nil
+}
+
+const testItemsTable = `CREATE TABLE items (
+	id INTEGER PRIMARY KEY,
+	name TEXT,
+	updated_at DATETIME
+)`
+
+// newTestManager returns a Manager polling an items table from one SQLite
+// database into another, in t's temporary directory, and closes it when t
+// ends. SQLite stands in for the local MySQL database: polling needs no
+// binlog.
+func newTestManager(t *testing.T) (*Manager, *database.Database, *database.Database, *memoryStore) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Databases: config.DatabasesConfig{
+			Local: config.DatabaseConnection{Driver: database.DriverSQLite, FilePath: filepath.Join(dir, "local.db")},
+			Cloud: config.DatabaseConnection{Driver: database.DriverSQLite, FilePath: filepath.Join(dir, "cloud.db")},
+		},
+		Sync: config.SyncConfig{
+			Workers:      2,
+			Capture:      CapturePolling,
+			PollInterval: "10ms",
+			Tables:       []config.TableConfig{{Name: "items", PrimaryKey: "id", TimestampColumn: "updated_at"}},
+		},
+	}
+
+	var dbs []*database.Database
+	for _, connection := range []config.DatabaseConnection{cfg.Databases.Local, cfg.Databases.Cloud} {
+		db, err := database.NewDatabase(connection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.DB.Exec(testItemsTable); err != nil {
+			t.Fatal(err)
+		}
+		dbs = append(dbs, db)
+	}
+
+	states := newMemoryStore()
+	m, err := newManager(cfg, states, dbs[0], dbs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+	return m, dbs[0], dbs[1], states
+}
+
+// insertItem writes a row to the local items table.
+func insertItem(t *testing.T, db *database.Database, id int, name string) {
+	t.Helper()
+	if _, err := db.DB.Exec("INSERT INTO items (id, name, updated_at) VALUES (?, ?, ?)", id, name, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForItem waits for the row with id to reach the cloud items table.
+func waitForItem(t *testing.T, db *database.Database, id int, name string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var got string
+		err := db.DB.QueryRow("SELECT name FROM items WHERE id = ?", id).Scan(&got)
+		if err == nil && got == name {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("item %d not synced: got %q, err %v", id, got, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForGoroutines waits for the goroutine count to fall back to at most
+// want, as goroutines of a stopped run may still be returning.
+func waitForGoroutines(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := runtime.NumGoroutine()
+		if got <= want {
+			return
+		}
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Fatalf("%d goroutines after stop, want at most %d:\n%s", got, want, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestManagerStartStopCycles(t *testing.T) {
+	m, local, cloud, states := newTestManager(t)
+
+	var baseline int
+	runIDs := make(map[string]bool)
+	for cycle := 1; cycle <= 3; cycle++ {
+		if err := m.Start(); err != nil {
+			t.Fatalf("cycle %d: start: %v", cycle, err)
+		}
+		if err := m.Start(); err != ErrAlreadyRunning {
+			t.Fatalf("cycle %d: second start: got %v, want ErrAlreadyRunning", cycle, err)
+		}
+		runID := m.RunID()
+		if runIDs[runID] {
+			t.Fatalf("cycle %d: run ID %s reused", cycle, runID)
+		}
+		runIDs[runID] = true
+
+		// Each run syncs, not just the first
+		insertItem(t, local, cycle, "item")
+		waitForItem(t, cloud, cycle, "item")
+
+		m.Stop()
+		if state := m.GetStatus(); state != "idle" {
+			t.Fatalf("cycle %d: state %q after stop, want idle", cycle, state)
+		}
+		m.mu.Lock()
+		if m.binlogListener != nil || m.poller != nil || m.dumpLoader != nil || m.queue != nil {
+			t.Errorf("cycle %d: stop left the run's capture or queue behind", cycle)
+		}
+		m.mu.Unlock()
+
+		if cycle == 1 {
+			// The databases' and the Manager's own goroutines stay; the
+			// run's must not pile up
+			waitForGoroutines(t, runtime.NumGoroutine())
+			baseline = runtime.NumGoroutine()
+		} else {
+			waitForGoroutines(t, baseline)
+		}
+	}
+
+	runs := states.runs()
+	if len(runs) != len(runIDs) {
+		t.Fatalf("%d runs in sync history, want %d", len(runs), len(runIDs))
+	}
+	for id, run := range runs {
+		if !runIDs[id] || run.Status != "completed" {
+			t.Errorf("run %s: status %q, want completed", id, run.Status)
+		}
+	}
+}
+
+func TestManagerRestart(t *testing.T) {
+	m, local, cloud, _ := newTestManager(t)
+
+	// With nothing running, a restart starts the last run's tables again
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	stopped := m.RunID()
+	m.Stop()
+	if err := m.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if m.RunID() == stopped {
+		t.Fatal("restart after stop didn't start a new run")
+	}
+	insertItem(t, local, 1, "item")
+	waitForItem(t, cloud, 1, "item")
+
+	// A running run is replaced by a new one
+	running := m.RunID()
+	if err := m.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if m.RunID() == running || m.GetStatus() != "running" {
+		t.Fatalf("restart of run %s: run %s, state %q", running, m.RunID(), m.GetStatus())
+	}
+	insertItem(t, local, 2, "item")
+	waitForItem(t, cloud, 2, "item")
+
+	m.Close()
+	if err := m.Restart(); err != ErrClosed {
+		t.Fatalf("restart after close: got %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,117 @@
+package sync
+
+import (
+	"context"
+	"sync"
+)
+
+// byteBudget bounds the approximate number of event bytes held in memory
+// between the binlog listener and the workers. Acquire blocks when the
+// budget is exhausted, which stalls the listener and applies backpressure.
+type byteBudget struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int64
+	inFlight int64
+}
+
+func newByteBudget(limit int64) *byteBudget {
+	b := &byteBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Acquire reserves size bytes, waiting until they fit or ctx is done.
+// An event larger than the whole budget is admitted once nothing else is
+// buffered so it cannot deadlock the pipeline.
+func (b *byteBudget) Acquire(ctx context.Context, size int64) error {
+	if b == nil || b.limit <= 0 {
+		return nil
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		b.cond.Broadcast()
+		b.mu.Unlock()
+	})
+	defer stop()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.inFlight > 0 && b.inFlight+size > b.limit {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b.cond.Wait()
+	}
+
+	b.inFlight += size
+	return nil
+}
+
+// TryAcquire reserves size bytes only if they fit right now.
+func (b *byteBudget) TryAcquire(size int64) bool {
+	if b == nil || b.limit <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.inFlight > 0 && b.inFlight+size > b.limit {
+		return false
+	}
+	b.inFlight += size
+	return true
+}
+
+// Release returns size bytes to the budget and wakes blocked producers.
+func (b *byteBudget) Release(size int64) {
+	if b == nil || b.limit <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	b.inFlight -= size
+	if b.inFlight < 0 {
+		b.inFlight = 0
+	}
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// InFlight returns the bytes currently buffered.
+func (b *byteBudget) InFlight() int64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.inFlight
+}
+
+// estimateRowsSize approximates the memory held by decoded row values.
+func estimateRowsSize(rows [][]interface{}) int64 {
+	var total int64
+	for _, row := range rows {
+		for _, value := range row {
+			total += estimateValueSize(value)
+		}
+	}
+	return total
+}
+
+func estimateValueSize(value interface{}) int64 {
+	// 16 bytes covers the interface header itself
+	const headerSize = 16
+	switch v := value.(type) {
+	case nil:
+		return headerSize
+	case string:
+		return headerSize + int64(len(v))
+	case []byte:
+		return headerSize + int64(len(v))
+	default:
+		return headerSize + 8
+	}
+}
@@ -0,0 +1,303 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/metrics"
+)
+
+// Outcomes of an observed row change, i.e. what applying it would do
+const (
+	ObservedInsert    = "insert"
+	ObservedUpdate    = "update"
+	ObservedDelete    = "delete"
+	ObservedUnchanged = "unchanged" // the target already has it
+	ObservedConflict  = "conflict"  // the target row isn't what the source changed
+)
+
+// TableObservation counts a table's row changes by what applying them to
+// the target would have done.
+type TableObservation struct {
+	Table     string `json:"table"`
+	Inserts   int64  `json:"inserts"`
+	Updates   int64  `json:"updates"`
+	Deletes   int64  `json:"deletes"`
+	Unchanged int64  `json:"unchanged"`
+	Conflicts int64  `json:"conflicts"`
+}
+
+// observations are a run's counts in observer mode.
+type observations struct {
+	mu     sync.Mutex
+	tables map[string]*TableObservation
+}
+
+func newObservations() *observations {
+	return &observations{tables: make(map[string]*TableObservation)}
+}
+
+func (o *observations) record(table, outcome string) {
+	metrics.ObservedChanges.WithLabelValues(table, outcome).Inc()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	t, ok := o.tables[table]
+	if !ok {
+		t = &TableObservation{Table: table}
+		o.tables[table] = t
+	}
+	switch outcome {
+	case ObservedInsert:
+		t.Inserts++
+	case ObservedUpdate:
+		t.Updates++
+	case ObservedDelete:
+		t.Deletes++
+	case ObservedUnchanged:
+		t.Unchanged++
+	case ObservedConflict:
+		t.Conflicts++
+	}
+}
+
+func (o *observations) Snapshot() []TableObservation {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	tables := make([]TableObservation, 0, len(o.tables))
+	for _, t := range o.tables {
+		tables = append(tables, *t)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Table < tables[j].Table })
+	return tables
+}
+
+// observerSink stands in for every sink in observer mode. It writes
+// nothing: each changed row is looked up on the target and compared, as
+// text, with the row images of the change to tell what applying it would
+// do. Target rows that match neither the source's before nor after image
+// are conflicts.
+type observerSink struct {
+	db       *database.Database
+	routers  map[string]*tableRouter
+	observed *observations
+	runID    string
+}
+
+func newObserverSink(tables []config.TableConfig, db *database.Database, observed *observations, runID string) (*observerSink, error) {
+	routers := make(map[string]*tableRouter, len(tables))
+	for _, tableConfig := range tables {
+		router, err := newTableRouter(tableConfig, DirectionLocalToCloud, db)
+		if err != nil {
+			return nil, err
+		}
+		routers[tableConfig.Name] = router
+	}
+	return &observerSink{db: db, routers: routers, observed: observed, runID: runID}, nil
+}
+
+func (s *observerSink) Name() string {
+	return "observer"
+}
+
+func (s *observerSink) Apply(ctx context.Context, table string, events []BinlogEvent) error {
+	for _, e := range events {
+		members := []BinlogEvent{e}
+		if e.Type == Group {
+			members = e.Members
+		}
+		for _, member := range members {
+			if err := s.observe(ctx, member); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *observerSink) observe(ctx context.Context, e BinlogEvent) error {
+	router, ok := s.routers[e.Table]
+	if !ok {
+		return fmt.Errorf("no table config for %s", e.Table)
+	}
+	if len(e.Columns) == 0 {
+		return fmt.Errorf("event for %s carries no column names", e.Table)
+	}
+
+	if err := e.checkImages(); err != nil {
+		return err
+	}
+	for rowIndex, after := range e.Rows {
+		// The before image finds the row; updates are looked up on the
+		// target of their new route
+		before := after
+		if e.Type == Update {
+			before = e.Before[rowIndex]
+		}
+		routeIndex, err := router.match(e.Columns, after)
+		if err != nil {
+			return err
+		}
+		if routeIndex < 0 {
+			continue
+		}
+		b := router.routes[routeIndex].builder
+
+		target, err := s.targetRow(ctx, b, e, before)
+		if err != nil {
+			return fmt.Errorf("failed to read %s at %s:%d: %w", b.table, e.BinlogFile, e.BinlogPos, err)
+		}
+
+		var outcome string
+		switch {
+		case e.Type == Insert && target == nil:
+			outcome = ObservedInsert
+		case e.Type == Insert:
+			outcome = observedOutcome(b, e, target, nil, after, ObservedConflict)
+		case e.Type == Update && target == nil:
+			outcome = ObservedConflict
+		case e.Type == Update:
+			outcome = observedOutcome(b, e, target, before, after, ObservedUpdate)
+		case target == nil:
+			outcome = ObservedUnchanged
+		default:
+			outcome = observedOutcome(b, e, target, before, nil, ObservedDelete)
+		}
+
+		s.observed.record(e.Table, outcome)
+		if outcome == ObservedConflict {
+			logger.Log.Info("Observed conflict",
+				zap.String("run_id", s.runID),
+				zap.String("table", e.Table),
+				zap.String("target", b.table),
+				zap.String("conflict_type", classifyConflict(e.Type, e.Type != Delete, target != nil)),
+				zap.String("event_type", string(e.Type)),
+				zap.String("binlog_file", e.BinlogFile),
+				zap.Uint32("binlog_pos", e.BinlogPos),
+				zap.Strings("primary_key", keyValues(b, e, before)),
+			)
+		}
+	}
+	return nil
+}
+
+// observedOutcome is ifBefore if the target row matches the source's before
+// image, unchanged if it matches the after image, and a conflict otherwise.
+func observedOutcome(b *statementBuilder, e BinlogEvent, target map[string]string, before, after []interface{}, ifBefore string) string {
+	switch {
+	case before != nil && rowMatches(b, e, before, target):
+		return ifBefore
+	case after != nil && rowMatches(b, e, after, target):
+		return ObservedUnchanged
+	default:
+		return ObservedConflict
+	}
+}
+
+// targetRow reads the target row the source row maps to, as text by
+// target column, or nil if there is none. NULLs are left out.
+func (s *observerSink) targetRow(ctx context.Context, b *statementBuilder, e BinlogEvent, row []interface{}) (map[string]string, error) {
+	var columns []string
+	for _, column := range e.Columns {
+		if b.columnAllowed(column) {
+			columns = append(columns, b.config.TargetColumn(column))
+		}
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = b.dialect.QuoteIdentifier(column)
+	}
+	where, args, err := b.whereClause(e, row, nil)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s LIMIT 1", strings.Join(quoted, ", "), b.dialect.QuoteIdentifier(b.table), where)
+
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := s.db.DB.QueryRowContext(ctx, query, args...).Scan(dest...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	target := make(map[string]string, len(columns))
+	for i, column := range columns {
+		if text, ok := observedText(values[i]); ok {
+			target[strings.ToLower(column)] = text
+		}
+	}
+	return target, nil
+}
+
+// rowMatches reports whether the target row holds the source row's values.
+func rowMatches(b *statementBuilder, e BinlogEvent, row []interface{}, target map[string]string) bool {
+	for columnIndex, column := range e.Columns {
+		if !b.columnAllowed(column) {
+			continue
+		}
+		value, err := b.value(e, columnIndex, row[columnIndex])
+		if err != nil {
+			return false
+		}
+		text, ok := observedText(value)
+		targetText, targetOK := target[strings.ToLower(b.config.TargetColumn(column))]
+		if ok != targetOK {
+			return false
+		}
+		// The target may format a document differently, e.g. MySQL
+		// spaces out what the binlog packs tight
+		if columnIndex < len(e.ColumnTypes) && isJSONType(e.ColumnTypes[columnIndex]) {
+			if !jsonEqual(text, targetText) {
+				return false
+			}
+		} else if text != targetText {
+			return false
+		}
+	}
+	return true
+}
+
+func keyValues(b *statementBuilder, e BinlogEvent, row []interface{}) []string {
+	var values []string
+	for columnIndex, column := range e.Columns {
+		if b.isPrimaryKey(column) {
+			values = append(values, fmt.Sprint(row[columnIndex]))
+		}
+	}
+	return values
+}
+
+// observedText is a value as compared between source and target, or false
+// for NULL. Times are compared as MySQL writes them.
+func observedText(v interface{}) (string, bool) {
+	switch value := v.(type) {
+	case nil:
+		return "", false
+	case []byte:
+		return string(value), true
+	case time.Time:
+		return value.Format("2006-01-02 15:04:05.999999"), true
+	default:
+		return fmt.Sprint(value), true
+	}
+}
+
+// Close is a no-op: the database belongs to the Manager.
+func (s *observerSink) Close() error {
+	return nil
+}
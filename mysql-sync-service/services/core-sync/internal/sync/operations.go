@@ -0,0 +1,238 @@
+package sync
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"mysql-sync-service/internal/encryption"
+	"mysql-sync-service/internal/ids"
+)
+
+// Kinds of long-running operation
+const (
+	OperationResync      = "resync"
+	OperationKeyRotation = "key_rotation"
+	OperationBulkResolve = "bulk_resolve"
+)
+
+// Operation states
+const (
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+	OperationCancelled = "cancelled"
+)
+
+// maxFinishedOperations is how many finished operations are kept to be
+// polled; the oldest go first.
+const maxFinishedOperations = 200
+
+// ErrOperationNotFound is returned for an unknown or long finished
+// operation.
+var ErrOperationNotFound = errors.New("operation not found")
+
+// Operation is a job started through the API that outlives the request,
+// polled by ID until it is done.
+type Operation struct {
+	ID         string            `json:"id"`
+	Kind       string            `json:"kind"`
+	State      string            `json:"state"`
+	Tables     []string          `json:"tables,omitempty"`
+	Progress   OperationProgress `json:"progress"`
+	Result     interface{}       `json:"result,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+}
+
+// OperationProgress counts what the operation has done so far.
+type OperationProgress struct {
+	Done  int64  `json:"done"`
+	Total int64  `json:"total,omitempty"` // 0 if not known up front
+	Unit  string `json:"unit"`            // e.g. "rows" or "conflicts"
+}
+
+// Done reports whether the operation has finished, either way.
+func (o Operation) Done() bool {
+	return o.State != OperationRunning
+}
+
+// operations tracks the manager's long-running operations. Those backed
+// by a job with state of its own, a resync or a key rotation, read it
+// through poll whenever they are looked at.
+type operations struct {
+	mu  sync.Mutex
+	ops map[string]*trackedOperation
+}
+
+type trackedOperation struct {
+	op   Operation
+	poll func(*Operation) // nil if updated by whoever runs it
+}
+
+func newOperations() *operations {
+	return &operations{ops: make(map[string]*trackedOperation)}
+}
+
+// add tracks a new running operation and returns its ID.
+func (o *operations) add(kind string, tables []string, poll func(*Operation)) string {
+	return o.addWithID(ids.New(), kind, tables, poll)
+}
+
+func (o *operations) addWithID(id, kind string, tables []string, poll func(*Operation)) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.ops[id] = &trackedOperation{
+		op: Operation{
+			ID:        id,
+			Kind:      kind,
+			State:     OperationRunning,
+			Tables:    tables,
+			StartedAt: time.Now(),
+		},
+		poll: poll,
+	}
+	o.prune()
+	return id
+}
+
+// update changes an operation run by the caller.
+func (o *operations) update(id string, change func(*Operation)) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if t, ok := o.ops[id]; ok {
+		change(&t.op)
+	}
+}
+
+// finish ends an operation run by the caller, as failed if err is set.
+func (o *operations) finish(id string, result interface{}, err error) {
+	o.update(id, func(op *Operation) {
+		now := time.Now()
+		op.FinishedAt = &now
+		op.Result = result
+		op.State = OperationSucceeded
+		if err != nil {
+			op.State = OperationFailed
+			op.Error = err.Error()
+		}
+	})
+}
+
+func (o *operations) get(id string) (Operation, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	t, ok := o.ops[id]
+	if !ok {
+		return Operation{}, false
+	}
+	return t.read(), true
+}
+
+// list returns every tracked operation, newest first.
+func (o *operations) list() []Operation {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	list := make([]Operation, 0, len(o.ops))
+	for _, t := range o.ops {
+		list = append(list, t.read())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.After(list[j].StartedAt) })
+	return list
+}
+
+// read refreshes a polled operation, which stops polling once it is done.
+func (t *trackedOperation) read() Operation {
+	if t.poll != nil {
+		t.poll(&t.op)
+		if t.op.Done() {
+			t.poll = nil
+		}
+	}
+	op := t.op
+	op.Tables = append([]string(nil), t.op.Tables...)
+	return op
+}
+
+// prune drops the oldest finished operations past maxFinishedOperations.
+// o.mu must be held.
+func (o *operations) prune() {
+	var finished []*trackedOperation
+	for _, t := range o.ops {
+		if t.read().Done() {
+			finished = append(finished, t)
+		}
+	}
+	if len(finished) <= maxFinishedOperations {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].op.StartedAt.Before(finished[j].op.StartedAt) })
+	for _, t := range finished[:len(finished)-maxFinishedOperations] {
+		delete(o.ops, t.op.ID)
+	}
+}
+
+// Operation returns a long-running operation by ID.
+func (m *Manager) Operation(id string) (Operation, error) {
+	op, ok := m.operations.get(id)
+	if !ok {
+		return Operation{}, ErrOperationNotFound
+	}
+	return op, nil
+}
+
+// Operations lists the tracked operations, newest first.
+func (m *Manager) Operations() []Operation {
+	return m.operations.list()
+}
+
+// trackResync adds a table rebuild as an operation under its OperationID.
+// Its progress is the rows copied so far, and its result the rebuild's
+// final status.
+func (m *Manager) trackResync(r *resyncs, t *tableResync) {
+	m.operations.addWithID(t.status.OperationID, OperationResync, []string{t.config.Name}, func(op *Operation) {
+		r.mu.Lock()
+		status := t.status
+		r.mu.Unlock()
+
+		op.Progress = OperationProgress{Done: status.RowsCopied, Unit: "rows"}
+		switch status.Status {
+		case ResyncCompleted:
+			op.State = OperationSucceeded
+		case ResyncFailed:
+			op.State = OperationFailed
+			op.Error = status.Error
+		default:
+			return
+		}
+		op.FinishedAt = status.FinishedAt
+		op.Result = status
+	})
+}
+
+// trackKeyRotation adds a key rotation job of table as an operation under
+// the job's own ID. Its progress is the rows scanned so far.
+func (m *Manager) trackKeyRotation(job *encryption.RotationJob, table string) {
+	m.operations.addWithID(job.ID, OperationKeyRotation, []string{table}, func(op *Operation) {
+		current, ok := m.rotator.Get(op.ID)
+		if !ok {
+			return
+		}
+		op.Progress = OperationProgress{Done: current.RowsScanned, Unit: "rows"}
+		switch current.Status {
+		case encryption.RotationCompleted:
+			op.State = OperationSucceeded
+		case encryption.RotationFailed:
+			op.State = OperationFailed
+			op.Error = current.Error
+		case encryption.RotationCancelled:
+			op.State = OperationCancelled
+		default:
+			return
+		}
+		op.FinishedAt = current.FinishedAt
+		op.Result = current
+	})
+}
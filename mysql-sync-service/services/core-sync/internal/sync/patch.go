@@ -0,0 +1,384 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
+	"mysql-sync-service/internal/store"
+)
+
+// Resolution strategies covered by a conflict patch
+const (
+	ResolveLocalWins     = "local_wins"
+	ResolveCloudWins     = "cloud_wins"
+	ResolveLastWriteWins = "last_write_wins"
+	ResolveManual        = "manual"
+)
+
+// ResolveDefault resolves each of many conflicts with its DefaultResolution.
+const ResolveDefault = "default"
+
+// ConflictPatch is the SQL each resolution of a conflict would run.
+type ConflictPatch struct {
+	ConflictID string        `json:"conflict_id"`
+	Table      string        `json:"table"`
+	Options    []PatchOption `json:"options"`
+}
+
+// PatchOption is one resolution's statements per database, with values
+// inlined so they can be run by hand.
+type PatchOption struct {
+	Strategy string   `json:"strategy"`
+	Note     string   `json:"note,omitempty"`
+	Local    []string `json:"local"`
+	Cloud    []string `json:"cloud"`
+}
+
+// ConflictPatch renders the statements that would bring both databases to
+// the local row, the cloud row, the newer of the two and, once resolved by
+// hand, the resolved row. Statements go through the same routing, column
+// mapping and delete mode as replication.
+func (m *Manager) ConflictPatch(ctx context.Context, conflict *store.Conflict) (*ConflictPatch, error) {
+	sides, err := m.conflictSides(ctx, conflict)
+	if err != nil {
+		return nil, err
+	}
+	local, cloud := sides.local.row, sides.cloud.row
+
+	// converge renders the statements that make a database hold want
+	converge := func(side conflictSide, want map[string]interface{}) ([]string, error) {
+		statements, err := side.converge(conflict.TableName, want)
+		if err != nil {
+			return nil, err
+		}
+		rendered := make([]string, len(statements))
+		for i, stmt := range statements {
+			rendered[i] = renderStatement(side.db.Dialect, stmt)
+		}
+		return rendered, nil
+	}
+	option := func(strategy, note string, winner map[string]interface{}) (PatchOption, error) {
+		localSQL, err := converge(sides.local, winner)
+		if err != nil {
+			return PatchOption{}, err
+		}
+		cloudSQL, err := converge(sides.cloud, winner)
+		if err != nil {
+			return PatchOption{}, err
+		}
+		return PatchOption{Strategy: strategy, Note: note, Local: localSQL, Cloud: cloudSQL}, nil
+	}
+
+	patch := &ConflictPatch{ConflictID: conflict.ID, Table: conflict.TableName}
+	add := func(strategy, note string, winner map[string]interface{}) error {
+		opt, err := option(strategy, note, winner)
+		if err != nil {
+			return fmt.Errorf("%s: %w", strategy, err)
+		}
+		patch.Options = append(patch.Options, opt)
+		return nil
+	}
+
+	if err := add(ResolveLocalWins, "", local); err != nil {
+		return nil, err
+	}
+	if err := add(ResolveCloudWins, "", cloud); err != nil {
+		return nil, err
+	}
+	if winner, note, ok := newerRow(sides.table.TimestampColumn, local, cloud); ok {
+		if err := add(ResolveLastWriteWins, note, winner); err != nil {
+			return nil, err
+		}
+	}
+	if len(conflict.ResolvedData) > 0 {
+		resolved, err := decodeRow(conflict.ResolvedData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resolved data: %w", err)
+		}
+		if err := add(ResolveManual, "applies the resolved data", resolved); err != nil {
+			return nil, err
+		}
+	}
+	return patch, nil
+}
+
+// conflictSide is one database of a conflict: the row it held, the router
+// that writes the table there and the source schema its row image follows.
+type conflictSide struct {
+	db     *database.Database
+	router *tableRouter
+	schema *database.TableSchema
+	row    map[string]interface{}
+}
+
+// converge returns the statements that make the database hold want
+// instead of the conflicting row.
+func (s conflictSide) converge(table string, want map[string]interface{}) ([]statement, error) {
+	switch {
+	case want != nil:
+		row, err := typedRow(want, s.schema)
+		if err != nil {
+			return nil, err
+		}
+		return s.router.Build(rowEvent(Insert, table, row))
+	case s.row != nil:
+		row, err := typedRow(s.row, s.schema)
+		if err != nil {
+			return nil, err
+		}
+		return s.router.Build(rowEvent(Delete, table, row))
+	default:
+		return []statement{}, nil
+	}
+}
+
+type conflictSides struct {
+	table        *config.TableConfig
+	local, cloud conflictSide
+}
+
+func (m *Manager) conflictSides(ctx context.Context, conflict *store.Conflict) (*conflictSides, error) {
+	var tableConfig *config.TableConfig
+	tables := m.tableConfigs()
+	for i := range tables {
+		if tables[i].Name == conflict.TableName {
+			tableConfig = &tables[i]
+		}
+	}
+	if tableConfig == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTable, conflict.TableName)
+	}
+
+	local, err := decodeRow(conflict.LocalData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local data: %w", err)
+	}
+	cloud, err := decodeRow(conflict.CloudData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cloud data: %w", err)
+	}
+	schema, err := m.registry.Source(ctx, conflict.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	// The local side has no renames or routes: rows land in the source table
+	localConfig := *tableConfig
+	localConfig.TargetName = ""
+	localConfig.ColumnMappings = nil
+	localConfig.Routes = nil
+	localRouter, err := newTableRouter(localConfig, DirectionCloudToLocal, m.localDB)
+	if err != nil {
+		return nil, err
+	}
+	cloudRouter, err := newTableRouter(*tableConfig, DirectionLocalToCloud, m.cloudDB)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conflictSides{
+		table: tableConfig,
+		local: conflictSide{db: m.localDB, router: localRouter, schema: schema, row: local},
+		cloud: conflictSide{db: m.cloudDB, router: cloudRouter, schema: schema, row: cloud},
+	}, nil
+}
+
+// decodeRow reads a stored row image; a missing row decodes to nil.
+// Numbers stay json.Numbers, so BIGINTs past 2^53 keep every digit.
+func decodeRow(data json.RawMessage) (map[string]interface{}, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var row map[string]interface{}
+	if err := decoder.Decode(&row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// typedRow turns a row image back into the values it was read as, by the
+// columns' types in schema: binary values from the hex they are stored as,
+// and whole numbers into integers.
+func typedRow(row map[string]interface{}, schema *database.TableSchema) (map[string]interface{}, error) {
+	if row == nil {
+		return nil, nil
+	}
+	columnTypes := make(map[string]string, len(schema.Columns))
+	for i, column := range schema.Columns {
+		if i < len(schema.ColumnTypes) {
+			columnTypes[strings.ToLower(column)] = schema.ColumnTypes[i]
+		}
+	}
+
+	typed := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		switch v := value.(type) {
+		case string:
+			if isBinaryType(columnTypes[strings.ToLower(column)]) {
+				data, err := hex.DecodeString(v)
+				if err != nil {
+					return nil, fmt.Errorf("column %s: binary values are written as hex: %w", column, err)
+				}
+				value = data
+			}
+		case json.Number:
+			value = numberValue(v)
+		}
+		typed[column] = value
+	}
+	return typed, nil
+}
+
+// numberValue is n as an int64, or a uint64 past that, when it is a whole
+// number. Others stay text, which the database parses at full precision.
+func numberValue(n json.Number) interface{} {
+	if i, err := strconv.ParseInt(n.String(), 10, 64); err == nil {
+		return i
+	}
+	if u, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+		return u
+	}
+	return n.String()
+}
+
+// rowEvent turns a row image into a single-row event, columns sorted by name.
+func rowEvent(eventType EventType, table string, row map[string]interface{}) BinlogEvent {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		values[i] = row[column]
+	}
+	return BinlogEvent{Type: eventType, Table: table, Columns: columns, Rows: [][]interface{}{values}}
+}
+
+// newerRow picks the row with the later timestamp column value. A missing
+// row never wins; ok is false when the rows can't be compared.
+func newerRow(timestampColumn string, local, cloud map[string]interface{}) (map[string]interface{}, string, bool) {
+	if timestampColumn == "" {
+		return nil, "", false
+	}
+	localTime, localOK := parseRowTime(local[timestampColumn])
+	cloudTime, cloudOK := parseRowTime(cloud[timestampColumn])
+	switch {
+	case localOK && cloudOK && !cloudTime.After(localTime):
+		return local, fmt.Sprintf("local %s is not older", timestampColumn), true
+	case localOK && cloudOK:
+		return cloud, fmt.Sprintf("cloud %s is newer", timestampColumn), true
+	case localOK && cloud == nil:
+		return local, "only the local row exists", true
+	case cloudOK && local == nil:
+		return cloud, "only the cloud row exists", true
+	default:
+		return nil, "", false
+	}
+}
+
+func parseRowTime(value interface{}) (time.Time, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// renderStatement inlines a statement's arguments as SQL literals. Only
+// placeholders outside quoted identifiers and strings are replaced.
+func renderStatement(dialect database.Dialect, stmt statement) string {
+	var b strings.Builder
+	var quote byte
+	next := 0
+	query := stmt.query
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '`' || c == '"' || c == '\'':
+			quote = c
+		case c == '?' && next < len(stmt.args):
+			b.WriteString(sqlLiteral(dialect, stmt.args[next]))
+			next++
+			continue
+		case c == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			end := i + 1
+			for end < len(query) && query[end] >= '0' && query[end] <= '9' {
+				end++
+			}
+			if n, err := strconv.Atoi(query[i+1 : end]); err == nil && n >= 1 && n <= len(stmt.args) {
+				b.WriteString(sqlLiteral(dialect, stmt.args[n-1]))
+				i = end - 1
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String() + ";"
+}
+
+func sqlLiteral(dialect database.Dialect, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	case time.Time:
+		return quoteString(dialect, v.Format("2006-01-02 15:04:05.999999"))
+	case []byte:
+		if dialect.Name() == database.DriverPostgres {
+			return `'\x` + hex.EncodeToString(v) + `'`
+		}
+		return "X'" + hex.EncodeToString(v) + "'"
+	case string:
+		return quoteString(dialect, v)
+	default:
+		// JSON objects and arrays from the stored row images
+		data, err := json.Marshal(v)
+		if err != nil {
+			return quoteString(dialect, fmt.Sprint(v))
+		}
+		return quoteString(dialect, string(data))
+	}
+}
+
+// quoteString quotes a string literal. MySQL also treats backslashes as
+// escapes by default.
+func quoteString(dialect database.Dialect, s string) string {
+	if dialect.Name() == database.DriverMySQL {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,49 @@
+package sync
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"mysql-sync-service/internal/database"
+)
+
+func TestTypedRowKeepsStoredValues(t *testing.T) {
+	schema := &database.TableSchema{
+		Name:        "files",
+		Columns:     []string{"id", "Data", "price", "name"},
+		ColumnTypes: []string{"bigint unsigned", "varbinary(16)", "decimal(20,4)", "varchar(64)"},
+	}
+	image := json.RawMessage(`{"id": 18446744073709551615, "Data": "00fffe80", "price": 12345678901234.5678, "name": "00ff"}`)
+
+	row, err := decodeRow(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// What a resolution stores is what it read
+	encoded, err := json.Marshal(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Data":"00fffe80","id":18446744073709551615,"name":"00ff","price":12345678901234.5678}`; string(encoded) != want {
+		t.Errorf("re-encoded as %s, want %s", encoded, want)
+	}
+
+	typed, err := typedRow(row, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"id":    uint64(18446744073709551615),
+		"Data":  []byte{0x00, 0xff, 0xfe, 0x80},
+		"price": "12345678901234.5678",
+		"name":  "00ff",
+	}
+	if !reflect.DeepEqual(typed, want) {
+		t.Errorf("got %#v, want %#v", typed, want)
+	}
+
+	if _, err := typedRow(map[string]interface{}{"data": "not hex"}, schema); err == nil {
+		t.Error("binary value not in hex was accepted")
+	}
+}
@@ -0,0 +1,47 @@
+package sync
+
+import (
+	"context"
+	"sync"
+)
+
+// pauseGate holds the binlog listener while a run is paused. Blocking in
+// the event handler stops canal from reading further, so nothing is lost.
+type pauseGate struct {
+	mu     sync.Mutex
+	paused chan struct{} // nil while running, closed on resume
+}
+
+func (g *pauseGate) Pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused == nil {
+		g.paused = make(chan struct{})
+	}
+}
+
+func (g *pauseGate) Resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused != nil {
+		close(g.paused)
+		g.paused = nil
+	}
+}
+
+// Wait blocks while the gate is paused or until ctx is done.
+func (g *pauseGate) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	paused := g.paused
+	g.mu.Unlock()
+	if paused == nil {
+		return nil
+	}
+
+	select {
+	case <-paused:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
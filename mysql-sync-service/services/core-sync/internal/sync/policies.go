@@ -0,0 +1,196 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/encryption"
+	"mysql-sync-service/internal/logger"
+)
+
+// Column policies of TableConfig.ColumnPolicies
+const (
+	PolicyMask    = "mask"
+	PolicyHash    = "hash"
+	PolicyEncrypt = "encrypt"
+	PolicyNullify = "nullify"
+)
+
+// columnPolicies transforms sensitive columns before rows are applied, so
+// the target only ever holds them masked, pseudonymized, encrypted or
+// not at all. Rows are rewritten in place as workers take them, and by
+// table copies, which don't go through the workers.
+type columnPolicies struct {
+	tables  map[string]map[string]config.ColumnPolicy // by table, then lowercased column
+	keyring *encryption.Keyring
+	hasher  *encryption.Hasher
+}
+
+// newColumnPolicies checks the tables' policies against the configured
+// keys. It returns nil if no table has any.
+func newColumnPolicies(tables []config.TableConfig, keyring *encryption.Keyring, hasher *encryption.Hasher) (*columnPolicies, error) {
+	p := &columnPolicies{
+		tables:  make(map[string]map[string]config.ColumnPolicy),
+		keyring: keyring,
+		hasher:  hasher,
+	}
+	for _, table := range tables {
+		if len(table.ColumnPolicies) == 0 {
+			continue
+		}
+		keys := splitColumns(table.PrimaryKey)
+		columns := make(map[string]config.ColumnPolicy, len(table.ColumnPolicies))
+		for column, policy := range table.ColumnPolicies {
+			switch policy.Policy {
+			case PolicyMask, PolicyNullify:
+			case PolicyHash:
+				if hasher == nil {
+					return nil, fmt.Errorf("table %s: column %s is hashed but encryption.hash_key is not configured", table.Name, column)
+				}
+			case PolicyEncrypt:
+				if keyring == nil {
+					return nil, fmt.Errorf("table %s: column %s is encrypted but no encryption keys are configured", table.Name, column)
+				}
+			default:
+				return nil, fmt.Errorf("table %s: column %s has unknown policy %q", table.Name, column, policy.Policy)
+			}
+			// Anything but a hash would collide or change on every write,
+			// and rows could no longer be matched on the target
+			if policy.Policy != PolicyHash && columnIndex(keys, column) >= 0 {
+				return nil, fmt.Errorf("table %s: primary key column %s can only be hashed", table.Name, column)
+			}
+			if policy.Keep < 0 {
+				return nil, fmt.Errorf("table %s: column %s keeps a negative number of characters", table.Name, column)
+			}
+			columns[strings.ToLower(column)] = policy
+		}
+		p.tables[table.Name] = columns
+	}
+	if len(p.tables) == 0 {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// apply transforms e's rows, and those of a group's members.
+func (p *columnPolicies) apply(e *BinlogEvent) {
+	if p == nil {
+		return
+	}
+	if e.Type == Group {
+		for i := range e.Members {
+			p.apply(&e.Members[i])
+		}
+		return
+	}
+
+	policies := p.tables[e.Table]
+	if len(policies) == 0 {
+		return
+	}
+	keyChanged := false
+	for i, column := range e.Columns {
+		policy, ok := policies[strings.ToLower(column)]
+		if !ok {
+			continue
+		}
+		for _, rows := range [][][]interface{}{e.Rows, e.Before} {
+			for _, row := range rows {
+				if i < len(row) {
+					row[i] = p.transform(e.Table, column, policy, row[i])
+				}
+			}
+		}
+		if columnIndex(e.KeyColumns, column) >= 0 {
+			keyChanged = true
+		}
+	}
+	// Logged keys must not give away what the hash hides
+	if keyChanged {
+		e.PrimaryKeys = eventKeys(e)
+	}
+}
+
+// transform applies one policy to a value. NULL stays NULL. A value that
+// fails to encrypt is nulled rather than sent in the clear.
+func (p *columnPolicies) transform(table, column string, policy config.ColumnPolicy, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	switch policy.Policy {
+	case PolicyMask:
+		return maskValue(filterValue(value), policy.Keep)
+	case PolicyHash:
+		return p.hasher.Hash([]byte(filterValue(value)))
+	case PolicyEncrypt:
+		sealed, err := p.keyring.Encrypt([]byte(filterValue(value)))
+		if err != nil {
+			logger.Log.Error("Failed to encrypt column, replicating NULL",
+				zap.String("table", table), zap.String("column", column), zap.Error(err))
+			return nil
+		}
+		return sealed
+	default:
+		return nil
+	}
+}
+
+// maskValue replaces all but the last keep characters with '*'.
+func maskValue(text string, keep int) string {
+	count := utf8.RuneCountInString(text)
+	if keep >= count {
+		return text
+	}
+	var b strings.Builder
+	b.Grow(len(text))
+	masked := 0
+	for _, r := range text {
+		if masked < count-keep {
+			b.WriteByte('*')
+			masked++
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// eventKeys formats the primary key of each of e's rows.
+func eventKeys(e *BinlogEvent) []string {
+	indexes := make([]int, 0, len(e.KeyColumns))
+	for _, key := range e.KeyColumns {
+		if index := columnIndex(e.Columns, key); index >= 0 {
+			indexes = append(indexes, index)
+		}
+	}
+	if len(indexes) == 0 {
+		return e.PrimaryKeys
+	}
+
+	keys := make([]string, len(e.Rows))
+	for i, row := range e.Rows {
+		parts := make([]string, 0, len(indexes))
+		for _, index := range indexes {
+			if index < len(row) {
+				parts = append(parts, fmt.Sprint(row[index]))
+			}
+		}
+		keys[i] = strings.Join(parts, ",")
+	}
+	return keys
+}
+
+// policyColumns lists the table's columns the policy applies to.
+func policyColumns(table config.TableConfig, policy string) []string {
+	var columns []string
+	for column, p := range table.ColumnPolicies {
+		if p.Policy == policy {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,292 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/store"
+)
+
+// Capture modes for SyncConfig.Capture and TableConfig.Capture
+const (
+	CaptureBinlog  = "binlog"
+	CapturePolling = "polling"
+)
+
+const defaultPollBatchSize = 1000
+
+// Poller captures changes without binlog access by selecting rows whose
+// timestamp column moved past the table's watermark. It sees inserts and
+// updates but not deletes, and rows with a NULL timestamp are never picked up.
+type Poller struct {
+	db       *database.Database
+	tables   []config.TableConfig
+	queue    eventQueue
+	store    store.Store
+	run      *syncRun
+	interval time.Duration
+	source   SourceInfo
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func NewPoller(cfg config.SyncConfig, db *database.Database, tables []config.TableConfig, queue eventQueue, store store.Store, run *syncRun) (*Poller, error) {
+	for _, table := range tables {
+		if table.TimestampColumn == "" || table.PrimaryKey == "" {
+			return nil, fmt.Errorf("table %s: polling needs timestamp_column and primary_key", table.Name)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Poller{
+		db:       db,
+		tables:   tables,
+		queue:    queue,
+		store:    store,
+		run:      run,
+		interval: cfg.GetPollInterval(),
+		source:   SourceInfo{SiteID: db.Config.SiteID, Host: db.Config.Host},
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+func (p *Poller) Start() {
+	logger.Log.Info("Starting poller", zap.Int("tables", len(p.tables)), zap.Duration("interval", p.interval))
+	for _, table := range p.tables {
+		p.wg.Add(1)
+		go p.pollTable(table)
+	}
+}
+
+func (p *Poller) Stop() {
+	p.cancel()
+	p.wg.Wait()
+	logger.Log.Info("Stopped poller")
+}
+
+// pollWatermark is the (timestamp, primary key) of the last row read.
+type pollWatermark struct {
+	ts  time.Time
+	key []interface{}
+}
+
+// polledTable is a table's config with its column layout resolved.
+type polledTable struct {
+	config.TableConfig
+	columns     []string
+	columnTypes []string
+	generated   []string
+	pkColumns   []string
+	tsIndex     int
+	pkIndexes   []int
+}
+
+func (p *Poller) pollTable(tableConfig config.TableConfig) {
+	defer p.wg.Done()
+
+	// Resume from the last applied change; re-reading rows of that second
+	// is harmless since rows are upserted
+	var mark pollWatermark
+	if state, err := p.store.GetSyncState(p.ctx, tableConfig.Name); err != nil {
+		logger.Log.Warn("Failed to load sync state, polling from the start", zap.String("table", tableConfig.Name), zap.Error(err))
+	} else if state != nil && state.LastSyncTime.Valid {
+		mark.ts = state.LastSyncTime.Time
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		// Resolved every round, from the schema registry, so column
+		// changes are picked up without binlog DDL events
+		table, err := p.describe(tableConfig)
+		if err != nil && p.ctx.Err() == nil {
+			logger.Log.Error("Failed to read table columns", zap.String("run_id", p.run.id), zap.String("table", tableConfig.Name), zap.Error(err))
+		}
+		for table != nil {
+			next, rows, err := p.pollBatch(table, mark)
+			if err != nil {
+				if database.IsUnknownColumn(err) {
+					p.run.registry.InvalidateSource(table.Name)
+				}
+				if p.ctx.Err() == nil {
+					logger.Log.Error("Polling failed", zap.String("run_id", p.run.id), zap.String("table", table.Name), zap.Error(err))
+				}
+				break
+			}
+			mark = next
+			if rows < p.batchSize(table.TableConfig) {
+				break
+			}
+		}
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Poller) batchSize(table config.TableConfig) int {
+	if table.BatchSize > 0 {
+		return table.BatchSize
+	}
+	return defaultPollBatchSize
+}
+
+// pollBatch reads the next rows past mark, in (timestamp, key) order, and
+// queues them as one insert event; inserts are applied as upserts.
+func (p *Poller) pollBatch(table *polledTable, mark pollWatermark) (pollWatermark, int, error) {
+	order := append([]string{table.TimestampColumn}, table.pkColumns...)
+	for i, column := range order {
+		order[i] = database.QuoteIdentifier(column)
+	}
+
+	quotedColumns := make([]string, len(table.columns))
+	for i, column := range table.columns {
+		quotedColumns[i] = database.QuoteIdentifier(column)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quotedColumns, ", "), database.QuoteIdentifier(table.Name))
+	var args []interface{}
+	switch {
+	case mark.key != nil:
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(order)), ", ")
+		query += fmt.Sprintf(" WHERE (%s) > (%s)", strings.Join(order, ", "), placeholders)
+		args = append(append(args, mark.ts), mark.key...)
+	case !mark.ts.IsZero():
+		query += fmt.Sprintf(" WHERE %s >= ?", order[0])
+		args = append(args, mark.ts)
+	default:
+		query += fmt.Sprintf(" WHERE %s IS NOT NULL", order[0])
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT %d", strings.Join(order, ", "), p.batchSize(table.TableConfig))
+
+	rows, err := p.db.DB.QueryContext(p.ctx, query, args...)
+	if err != nil {
+		return mark, 0, err
+	}
+	defer rows.Close()
+
+	var batch [][]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(table.columns))
+		dest := make([]interface{}, len(table.columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return mark, 0, err
+		}
+		batch = append(batch, values)
+
+		ts, ok := values[table.tsIndex].(time.Time)
+		if !ok {
+			return mark, 0, fmt.Errorf("timestamp column %s is not a date/time column", table.TimestampColumn)
+		}
+		mark.ts = ts
+		mark.key = make([]interface{}, len(table.pkIndexes))
+		for i, index := range table.pkIndexes {
+			mark.key[i] = values[index]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return mark, 0, err
+	}
+	if len(batch) == 0 {
+		return mark, 0, nil
+	}
+
+	keys := make([]string, len(batch))
+	for i, row := range batch {
+		parts := make([]string, len(table.pkIndexes))
+		for j, index := range table.pkIndexes {
+			parts[j] = fmt.Sprint(row[index])
+		}
+		keys[i] = strings.Join(parts, ",")
+	}
+
+	schema, _ := config.SplitTable(table.Name, p.db.Config.Database)
+	e := BinlogEvent{
+		Type:        Insert,
+		Schema:      schema,
+		Table:       table.Name,
+		Rows:        batch,
+		Timestamp:   uint32(mark.ts.Unix()),
+		Size:        estimateRowsSize(batch),
+		PrimaryKeys: keys,
+		Columns:     table.columns,
+		ColumnTypes: table.columnTypes,
+		KeyColumns:  table.pkColumns,
+		Generated:   table.generated,
+		Source:      p.source,
+	}
+
+	if err := p.run.gate.Wait(p.ctx); err != nil {
+		return mark, 0, err
+	}
+	if err := p.queue.Push(p.ctx, e); err != nil {
+		return mark, 0, err
+	}
+	p.run.stats.Queued()
+	return mark, len(batch), nil
+}
+
+// describe resolves the table's columns, in ordinal order, and the
+// positions of its timestamp and key columns.
+func (p *Poller) describe(tableConfig config.TableConfig) (*polledTable, error) {
+	schema, err := p.run.registry.Source(p.ctx, tableConfig.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &polledTable{
+		TableConfig: tableConfig,
+		columns:     schema.Columns,
+		columnTypes: schema.ColumnTypes,
+		generated:   schema.Generated,
+		pkColumns:   splitColumns(tableConfig.PrimaryKey),
+	}
+
+	if table.tsIndex = columnIndex(table.columns, tableConfig.TimestampColumn); table.tsIndex < 0 {
+		return nil, fmt.Errorf("timestamp column %s not found", tableConfig.TimestampColumn)
+	}
+	for _, column := range table.pkColumns {
+		index := columnIndex(table.columns, column)
+		if index < 0 {
+			return nil, fmt.Errorf("primary key column %s not found", column)
+		}
+		table.pkIndexes = append(table.pkIndexes, index)
+	}
+	return table, nil
+}
+
+func splitColumns(list string) []string {
+	var columns []string
+	for _, column := range strings.Split(list, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+func columnIndex(columns []string, column string) int {
+	for i, c := range columns {
+		if strings.EqualFold(c, column) {
+			return i
+		}
+	}
+	return -1
+}
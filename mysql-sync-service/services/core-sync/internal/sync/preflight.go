@@ -0,0 +1,208 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+)
+
+// ErrPreflightFailed is returned by Start when a target table cannot take
+// the configured table's rows; the error is a *PreflightError.
+var ErrPreflightFailed = errors.New("target preflight failed")
+
+const preflightTimeout = 30 * time.Second
+
+// PreflightProblem is one reason a target table is not ready.
+type PreflightProblem struct {
+	Table   string `json:"table"`
+	Target  string `json:"target,omitempty"`
+	Problem string `json:"problem"`
+}
+
+// PreflightError lists every problem found, so they can be fixed in one go.
+type PreflightError struct {
+	Problems []PreflightProblem
+}
+
+func (e *PreflightError) Error() string {
+	parts := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		if p.Target == "" {
+			parts[i] = fmt.Sprintf("%s: %s", p.Table, p.Problem)
+		} else {
+			parts[i] = fmt.Sprintf("%s -> %s: %s", p.Table, p.Target, p.Problem)
+		}
+	}
+	return fmt.Sprintf("%s: %s", ErrPreflightFailed, strings.Join(parts, "; "))
+}
+
+func (e *PreflightError) Unwrap() error {
+	return ErrPreflightFailed
+}
+
+// preflight checks, before anything is read from the source, that every
+// target table exists with the columns replicated into it and that the
+// target user may insert, update and delete there. It also opens the
+// workers' connections up front. Sinks other than the database target are
+// not checked.
+func (m *Manager) preflight(tables []config.TableConfig) error {
+	if !m.writesToTarget() && !m.cfg.Sync.Observe {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, preflightTimeout)
+	defer cancel()
+
+	if err := m.warmUp(ctx); err != nil {
+		return fmt.Errorf("target database unreachable: %w", err)
+	}
+
+	var problems []PreflightProblem
+	for _, tableConfig := range tables {
+		problems = append(problems, m.checkTable(ctx, tableConfig)...)
+	}
+	if len(problems) == 0 {
+		logger.Log.Info("Target preflight passed", zap.Int("tables", len(tables)))
+		return nil
+	}
+
+	for _, p := range problems {
+		logger.Log.Error("Target preflight problem", zap.String("table", p.Table), zap.String("target", p.Target), zap.String("problem", p.Problem))
+	}
+	return &PreflightError{Problems: problems}
+}
+
+func (m *Manager) writesToTarget() bool {
+	return writesToTarget(m.cfg.Sync)
+}
+
+func writesToTarget(cfg config.SyncConfig) bool {
+	if len(cfg.Sinks) == 0 {
+		return true
+	}
+	for _, sink := range cfg.Sinks {
+		if sink.Type == SinkMySQL {
+			return true
+		}
+	}
+	return false
+}
+
+// warmUp opens one target connection per worker, so the first batches
+// don't pay for connection setup.
+func (m *Manager) warmUp(ctx context.Context) error {
+	var conns []*sql.Conn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	count := m.cfg.Sync.Workers
+	if limit := m.cloudDB.DB.Stats().MaxOpenConnections; limit > 0 && count > limit {
+		count = limit
+	}
+	if count < 1 {
+		count = 1
+	}
+
+	for i := 0; i < count; i++ {
+		conn, err := m.cloudDB.DB.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, conn)
+		if err := conn.PingContext(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTable checks each target table the source table replicates into.
+func (m *Manager) checkTable(ctx context.Context, tableConfig config.TableConfig) []PreflightProblem {
+	problem := func(target, format string, args ...interface{}) []PreflightProblem {
+		return []PreflightProblem{{Table: tableConfig.Name, Target: target, Problem: fmt.Sprintf(format, args...)}}
+	}
+
+	router, err := newTableRouter(tableConfig, DirectionLocalToCloud, m.cloudDB)
+	if err != nil {
+		return problem("", "invalid config: %v", err)
+	}
+	if strategy := tableConfig.ConflictResolution; strategy != "" && strategy != ResolveManual {
+		if _, err := NewResolutionStrategy(strategy, tableConfig); err != nil {
+			return problem("", "invalid config: %v", err)
+		}
+	}
+	source, err := m.registry.Source(ctx, tableConfig.Name)
+	if err != nil {
+		return problem("", "source table not readable: %v", err)
+	}
+
+	var problems []PreflightProblem
+	for _, rt := range router.routes {
+		b := rt.builder
+		target, err := m.registry.Target(ctx, b.table)
+		if err != nil {
+			problems = append(problems, problem(b.table, "target table missing or not readable: %v", err)...)
+			continue
+		}
+
+		var missing []string
+		for _, column := range source.Columns {
+			if b.columnAllowed(column) && !target.HasColumn(tableConfig.TargetColumn(column)) {
+				missing = append(missing, tableConfig.TargetColumn(column))
+			}
+		}
+		if b.deleteMode == DeleteSoft && !target.HasColumn(b.softColumn) {
+			missing = append(missing, b.softColumn)
+		}
+		if len(missing) > 0 {
+			problems = append(problems, problem(b.table, "missing columns: %s", strings.Join(missing, ", "))...)
+			continue
+		}
+
+		if m.cfg.Sync.Observe {
+			// Only read
+			continue
+		}
+		if err := m.checkWritable(ctx, b, target.Columns[0]); err != nil {
+			problems = append(problems, problem(b.table, "not writable: %v", err)...)
+		}
+	}
+	return problems
+}
+
+// checkWritable runs an insert, update and delete that match no rows, in a
+// transaction that is rolled back; privileges are checked all the same.
+func (m *Manager) checkWritable(ctx context.Context, b *statementBuilder, column string) error {
+	tx, err := m.cloudDB.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	table, quoted := b.dialect.QuoteIdentifier(b.table), b.dialect.QuoteIdentifier(column)
+	checks := []struct {
+		privilege string
+		query     string
+	}{
+		{"INSERT", fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s WHERE 1 = 0", table, quoted, quoted, table)},
+		{"UPDATE", fmt.Sprintf("UPDATE %s SET %s = %s WHERE 1 = 0", table, quoted, quoted)},
+		{"DELETE", fmt.Sprintf("DELETE FROM %s WHERE 1 = 0", table)},
+	}
+	for _, check := range checks {
+		if _, err := tx.ExecContext(ctx, check.query); err != nil {
+			return fmt.Errorf("%s: %w", check.privilege, err)
+		}
+	}
+	return nil
+}
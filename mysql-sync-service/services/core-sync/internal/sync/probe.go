@@ -0,0 +1,115 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Outcomes of a dependency probe
+const (
+	ProbeUp      = "up"
+	ProbeDown    = "down"
+	ProbeSkipped = "skipped" // not in use right now, e.g. the binlog stream between runs
+)
+
+// ProbeResult is one dependency's state.
+type ProbeResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Detail    string  `json:"detail,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Readiness is the outcome of probing every dependency; the instance is
+// ready only if none is down.
+type Readiness struct {
+	Ready  bool          `json:"ready"`
+	Status string        `json:"status"` // the sync's, as GetStatus
+	Checks []ProbeResult `json:"checks"`
+}
+
+// Liveness reports whether the process is fit to keep running; it probes
+// no dependency, so an outage elsewhere doesn't get it restarted.
+type Liveness struct {
+	Alive  bool   `json:"alive"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Liveness fails only once the manager is shut down.
+func (m *Manager) Liveness() Liveness {
+	m.mu.Lock()
+	closed := m.closed
+	m.mu.Unlock()
+	if closed {
+		return Liveness{Status: m.GetStatus(), Reason: ErrClosed.Error()}
+	}
+	return Liveness{Alive: true, Status: m.GetStatus()}
+}
+
+// Probe checks the local and cloud databases and the state store in
+// parallel, each within ctx, and the binlog stream of the running run.
+func (m *Manager) Probe(ctx context.Context) Readiness {
+	probes := []struct {
+		name string
+		ping func(context.Context) error
+	}{
+		{"local_db", m.localDB.DB.PingContext},
+		{"cloud_db", m.cloudDB.DB.PingContext},
+		{"state_store", m.store.Ping},
+	}
+
+	checks := make([]ProbeResult, len(probes)+1)
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		wg.Add(1)
+		go func(i int, name string, ping func(context.Context) error) {
+			defer wg.Done()
+			started := time.Now()
+			err := ping(ctx)
+			checks[i] = ProbeResult{Name: name, Status: ProbeUp, LatencyMs: float64(time.Since(started).Microseconds()) / 1000}
+			if err != nil {
+				checks[i].Status, checks[i].Error = ProbeDown, err.Error()
+			}
+		}(i, probe.name, probe.ping)
+	}
+	wg.Wait()
+	checks[len(probes)] = m.probeBinlog()
+
+	readiness := Readiness{Ready: true, Status: m.GetStatus(), Checks: checks}
+	for _, check := range checks {
+		if check.Status == ProbeDown {
+			readiness.Ready = false
+		}
+	}
+	return readiness
+}
+
+// probeBinlog is down while the running run's binlog stream is being
+// reconnected, and skipped if no run streams the binlog.
+func (m *Manager) probeBinlog() ProbeResult {
+	result := ProbeResult{Name: "binlog", Status: ProbeSkipped}
+	listener := m.stats.listener.Load()
+	if listener == nil {
+		result.Detail = "no run is streaming the binlog"
+		return result
+	}
+	if state := m.stats.state(); state != "running" {
+		result.Detail = fmt.Sprintf("run is %s", state)
+		return result
+	}
+
+	result.Status = ProbeUp
+	if last := listener.LastRead(); !last.IsZero() {
+		result.Detail = fmt.Sprintf("last event %s ago", time.Since(last).Round(time.Second))
+	} else {
+		result.Detail = "no event yet"
+	}
+	if listener.Degraded() {
+		result.Status, result.Error = ProbeDown, "stream lost, reconnecting"
+	}
+	return result
+}
@@ -0,0 +1,170 @@
+package sync
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/logger"
+)
+
+// LargeTransaction is the progress of a source transaction of at least
+// sync.apply.progress_rows rows.
+type LargeTransaction struct {
+	GTID        string    `json:"gtid"`
+	Tables      []string  `json:"tables"` // changed so far, in order of first change
+	BinlogFile  string    `json:"binlog_file"`
+	BinlogPos   uint32    `json:"binlog_pos"`
+	RowsRead    int       `json:"rows_read"`
+	RowsApplied int       `json:"rows_applied"`
+	RowsFailed  int       `json:"rows_failed"`
+	Committed   bool      `json:"committed"` // every row has been read
+	StartedAt   time.Time `json:"started_at"`
+}
+
+// txnProgress follows source transactions from the listener reading them
+// to the workers applying them. Transactions are told apart by GTID, so
+// sources without GTIDs aren't tracked.
+type txnProgress struct {
+	mu        sync.Mutex
+	runID     string
+	threshold int
+	active    map[string]*LargeTransaction
+}
+
+func newTxnProgress(runID string, threshold int) *txnProgress {
+	return &txnProgress{
+		runID:     runID,
+		threshold: threshold,
+		active:    make(map[string]*LargeTransaction),
+	}
+}
+
+// Read counts the rows of e, read by the listener.
+func (p *txnProgress) Read(e BinlogEvent) {
+	if e.GTID == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	txn, ok := p.active[e.GTID]
+	if !ok {
+		txn = &LargeTransaction{GTID: e.GTID, BinlogFile: e.BinlogFile, BinlogPos: e.BinlogPos, StartedAt: time.Now()}
+		p.active[e.GTID] = txn
+	}
+	seen := false
+	for _, table := range txn.Tables {
+		seen = seen || table == e.Table
+	}
+	if !seen {
+		txn.Tables = append(txn.Tables, e.Table)
+	}
+	before := txn.RowsRead
+	txn.RowsRead += eventRows(e)
+	if before < p.threshold && txn.RowsRead >= p.threshold {
+		logger.Log.Info("Large source transaction",
+			zap.String("run_id", p.runID),
+			zap.String("gtid", txn.GTID),
+			zap.String("binlog_file", txn.BinlogFile),
+			zap.Uint32("binlog_pos", txn.BinlogPos),
+			zap.Int("rows_read", txn.RowsRead),
+		)
+	}
+}
+
+// Commit marks the transaction fully read.
+func (p *txnProgress) Commit(gtid string) {
+	if gtid == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if txn, ok := p.active[gtid]; ok {
+		txn.Committed = true
+		p.finish(txn)
+	}
+}
+
+// Applied counts the rows of events as written to the target.
+func (p *txnProgress) Applied(events []BinlogEvent) {
+	p.count(events, false)
+}
+
+// Failed counts the rows of events as dead-lettered.
+func (p *txnProgress) Failed(events []BinlogEvent) {
+	p.count(events, true)
+}
+
+func (p *txnProgress) count(events []BinlogEvent, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, e := range events {
+		txn, ok := p.active[e.GTID]
+		if !ok {
+			continue
+		}
+		rows := eventRows(e)
+		done := txn.RowsApplied + txn.RowsFailed
+		if failed {
+			txn.RowsFailed += rows
+		} else {
+			txn.RowsApplied += rows
+		}
+		if txn.RowsRead >= p.threshold && (done+rows)/p.threshold > done/p.threshold {
+			logger.Log.Info("Applying large source transaction",
+				zap.String("run_id", p.runID),
+				zap.String("gtid", txn.GTID),
+				zap.Int("rows_read", txn.RowsRead),
+				zap.Int("rows_applied", txn.RowsApplied),
+				zap.Int("rows_failed", txn.RowsFailed),
+				zap.Bool("committed", txn.Committed),
+			)
+		}
+		p.finish(txn)
+	}
+}
+
+// finish drops a transaction once every row of it was read and applied.
+func (p *txnProgress) finish(txn *LargeTransaction) {
+	if !txn.Committed || txn.RowsApplied+txn.RowsFailed < txn.RowsRead {
+		return
+	}
+	delete(p.active, txn.GTID)
+	if txn.RowsRead >= p.threshold {
+		logger.Log.Info("Large source transaction applied",
+			zap.String("run_id", p.runID),
+			zap.String("gtid", txn.GTID),
+			zap.Int("rows", txn.RowsRead),
+			zap.Int("rows_failed", txn.RowsFailed),
+			zap.Duration("duration", time.Since(txn.StartedAt)),
+		)
+	}
+}
+
+// Snapshot lists the large transactions not yet applied, oldest first.
+func (p *txnProgress) Snapshot() []LargeTransaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var txns []LargeTransaction
+	for _, txn := range p.active {
+		if txn.RowsRead >= p.threshold {
+			snapshot := *txn
+			snapshot.Tables = append([]string(nil), txn.Tables...)
+			txns = append(txns, snapshot)
+		}
+	}
+	sort.Slice(txns, func(i, j int) bool { return txns[i].StartedAt.Before(txns[j].StartedAt) })
+	return txns
+}
+
+// eventRows is the number of rows an event changes; updates carry a
+// before and after image of each.
+func eventRows(e BinlogEvent) int {
+	return len(e.Rows)
+}
@@ -0,0 +1,183 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"mysql-sync-service/internal/config"
+)
+
+// Queue types for SyncConfig.Queue.Type
+const (
+	QueueMemory = "memory"
+	QueueDisk   = "disk"
+)
+
+const defaultQueueCapacity = 10000
+
+var errQueueClosed = errors.New("event queue is closed")
+
+// eventQueue buffers binlog events between the listener and the workers.
+// Implementations account for in-memory events against the run's budget;
+// workers release it once a batch is applied.
+type eventQueue interface {
+	// Push hands an event to the workers, blocking only when the queue
+	// cannot take more without exceeding its limits.
+	Push(ctx context.Context, e BinlogEvent) error
+	// Events is the channel events are delivered on. Resize closes it once
+	// drained and moves to a new one, which Events then returns.
+	Events() <-chan BinlogEvent
+	// Resize changes how many events are held in memory. Events already
+	// buffered are delivered first, on the old channel.
+	Resize(capacity int)
+	// Close stops delivery and closes the Events channel. Buffered events
+	// are dropped, unless a persistent disk queue keeps those it spilled
+	// for the next run; others are re-read from the binlog.
+	Close()
+	// Backlog reports what the queue holds that workers haven't taken.
+	Backlog() QueueBacklog
+}
+
+// QueueBacklog is what the event queue holds for the workers: events in
+// memory and, for a disk queue, spilled to disk. While a target is down a
+// disk queue keeps taking events, and the backlog drains in order once
+// the target is back.
+type QueueBacklog struct {
+	Type          string `json:"type"`
+	Persistent    bool   `json:"persistent"`
+	MemoryEvents  int    `json:"memory_events"`
+	SpilledEvents int    `json:"spilled_events"`
+	SpilledBytes  int64  `json:"spilled_bytes"`
+	// The oldest spilled event: when it was spilled and where it was read
+	OldestSpilledAt *time.Time `json:"oldest_spilled_at,omitempty"`
+	OldestPosition  string     `json:"oldest_position,omitempty"`
+	AgeSeconds      float64    `json:"age_seconds"`
+}
+
+func newEventQueue(cfg config.QueueConfig, budget *byteBudget) (eventQueue, error) {
+	capacity := cfg.Capacity
+	if capacity <= 0 {
+		capacity = defaultQueueCapacity
+	}
+
+	switch cfg.Type {
+	case "", QueueMemory:
+		return newMemoryQueue(capacity, budget), nil
+	case QueueDisk:
+		return newSpillQueue(cfg, capacity, budget)
+	default:
+		return nil, fmt.Errorf("unknown queue type %q", cfg.Type)
+	}
+}
+
+// memoryQueue is a bounded channel: a full queue or an exhausted budget
+// stalls the binlog reader.
+type memoryQueue struct {
+	budget *byteBudget
+
+	mu      sync.Mutex
+	events  chan BinlogEvent
+	swapped chan struct{} // closed when events is replaced or closed
+	closed  bool
+
+	// Held for reading while sending, so a channel is only closed once no
+	// send can reach it
+	sends sync.RWMutex
+}
+
+func newMemoryQueue(capacity int, budget *byteBudget) *memoryQueue {
+	return &memoryQueue{
+		events:  make(chan BinlogEvent, capacity),
+		swapped: make(chan struct{}),
+		budget:  budget,
+	}
+}
+
+func (q *memoryQueue) Push(ctx context.Context, e BinlogEvent) error {
+	q.mu.Lock()
+	closed := q.closed
+	q.mu.Unlock()
+	if closed {
+		return errQueueClosed
+	}
+
+	// Wait for buffer room so wide rows can't pile up unbounded in memory
+	if err := q.budget.Acquire(ctx, e.Size); err != nil {
+		return err
+	}
+
+	for {
+		q.sends.RLock()
+		q.mu.Lock()
+		events, swapped, closed := q.events, q.swapped, q.closed
+		q.mu.Unlock()
+		if closed {
+			q.sends.RUnlock()
+			q.budget.Release(e.Size)
+			return errQueueClosed
+		}
+
+		select {
+		case events <- e:
+			q.sends.RUnlock()
+			return nil
+		case <-swapped:
+			// Resized or closed; look again
+			q.sends.RUnlock()
+		case <-ctx.Done():
+			q.sends.RUnlock()
+			q.budget.Release(e.Size)
+			return ctx.Err()
+		}
+	}
+}
+
+func (q *memoryQueue) Events() <-chan BinlogEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.events
+}
+
+func (q *memoryQueue) Resize(capacity int) {
+	q.mu.Lock()
+	if q.closed || capacity == cap(q.events) {
+		q.mu.Unlock()
+		return
+	}
+	old := q.events
+	q.events = make(chan BinlogEvent, capacity)
+	close(q.swapped)
+	q.swapped = make(chan struct{})
+	q.mu.Unlock()
+
+	q.sends.Lock()
+	defer q.sends.Unlock()
+	close(old)
+}
+
+// Close wakes pushes waiting on a full queue, which then fail. Closing
+// again does nothing.
+func (q *memoryQueue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.swapped)
+	events := q.events
+	q.mu.Unlock()
+
+	q.sends.Lock()
+	defer q.sends.Unlock()
+	close(events)
+}
+
+func (q *memoryQueue) Backlog() QueueBacklog {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueBacklog{Type: QueueMemory, MemoryEvents: len(q.events)}
+}
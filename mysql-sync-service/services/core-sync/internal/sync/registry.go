@@ -0,0 +1,87 @@
+package sync
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"mysql-sync-service/internal/database"
+)
+
+// schemaRegistry caches table layouts of the source and target databases so
+// they are read once rather than per batch. An entry is dropped when DDL
+// touches the table or a statement fails on an unknown column, and is read
+// again on next use. It outlives runs.
+type schemaRegistry struct {
+	source *database.Database
+	target *database.Database
+	mu     sync.Mutex
+	tables map[string]*database.TableSchema // Keyed by side + "/" + table
+}
+
+func newSchemaRegistry(source, target *database.Database) *schemaRegistry {
+	return &schemaRegistry{source: source, target: target, tables: make(map[string]*database.TableSchema)}
+}
+
+func (r *schemaRegistry) Source(ctx context.Context, table string) (*database.TableSchema, error) {
+	return r.get(ctx, r.source, "source/"+table, table)
+}
+
+func (r *schemaRegistry) Target(ctx context.Context, table string) (*database.TableSchema, error) {
+	return r.get(ctx, r.target, "target/"+table, table)
+}
+
+func (r *schemaRegistry) InvalidateSource(table string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tables, "source/"+table)
+}
+
+// InvalidateTarget forgets the target table's schema and the statements
+// prepared for it.
+func (r *schemaRegistry) InvalidateTarget(table string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tables, "target/"+table)
+	r.target.Stmts.Evict(table)
+}
+
+// Reset drops every entry, e.g. before a run since DDL may have happened
+// while nothing was listening.
+func (r *schemaRegistry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tables = make(map[string]*database.TableSchema)
+	r.target.Stmts.Reset()
+}
+
+func (r *schemaRegistry) get(ctx context.Context, db *database.Database, key, table string) (*database.TableSchema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if schema, ok := r.tables[key]; ok {
+		return schema, nil
+	}
+	schema, err := db.DescribeTable(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	r.tables[key] = schema
+	return schema, nil
+}
+
+// sourceKey returns the source table's primary key, or its first unique
+// key, as a primary_key config value; "" if it has neither.
+func (r *schemaRegistry) sourceKey(ctx context.Context, table string) (string, error) {
+	schema, err := r.Source(ctx, table)
+	if err != nil {
+		return "", err
+	}
+	if len(schema.PrimaryKey) > 0 {
+		return strings.Join(schema.PrimaryKey, ","), nil
+	}
+	if len(schema.UniqueKeys) > 0 {
+		return strings.Join(schema.UniqueKeys[0], ","), nil
+	}
+	return "", nil
+}
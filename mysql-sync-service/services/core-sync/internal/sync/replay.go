@@ -0,0 +1,244 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
+)
+
+// ErrInvalidReplay is returned for replays that can't start where asked.
+var ErrInvalidReplay = errors.New("invalid replay")
+
+const binlogStartTimeout = 10 * time.Second
+
+// ReplayOptions rewind capture to an earlier point of the source binlog,
+// given by exactly one of a position, a GTID set or a time. The binlog must
+// still be on the source from that point.
+type ReplayOptions struct {
+	// Tables are re-applied from that point; nil re-applies every table.
+	Tables     []string
+	BinlogFile string
+	BinlogPos  uint32
+	// GTIDSet starts after the transactions in it.
+	GTIDSet string
+	// Since starts at the first change made at or after it.
+	Since time.Time
+	// Upsert makes replayed updates idempotent: each is followed by an
+	// upsert of its new row, so rows lost on the target come back.
+	Upsert bool
+}
+
+// replayState is what a replay run rewound.
+type replayState struct {
+	coords DumpCoordinates
+	since  time.Time
+	tables map[string]bool // nil: every table
+	upsert bool
+	until  binlogPosition // where the source was when the replay began
+}
+
+// Replay begins a run, over every table, that reads the binlog again from
+// the point opts give and re-applies the changes of opts' tables. Only
+// their target checkpoints are rewound, so other tables' changes are still
+// skipped up to where they had been applied; other sinks get them again.
+// The run carries on past the replayed changes like any other. It returns
+// where the binlog is read from.
+func (m *Manager) Replay(opts ReplayOptions) (DumpCoordinates, error) {
+	if err := m.start(TriggerReplay, nil, runOptions{replay: &opts}); err != nil {
+		return DumpCoordinates{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.run.replay.coords, nil
+}
+
+// prepareReplay checks opts against the run's tables and resolves where the
+// binlog is read from. m.mu must be held.
+func (m *Manager) prepareReplay(syncCfg config.SyncConfig, opts ReplayOptions) (*replayState, error) {
+	points := 0
+	for _, given := range []bool{opts.BinlogFile != "", opts.GTIDSet != "", !opts.Since.IsZero()} {
+		if given {
+			points++
+		}
+	}
+	if points != 1 {
+		return nil, fmt.Errorf("%w: give one of a binlog position, a gtid set or a time", ErrInvalidReplay)
+	}
+
+	state := &replayState{since: opts.Since, upsert: opts.Upsert}
+	if len(opts.Tables) > 0 {
+		captures := make(map[string]string, len(syncCfg.Tables))
+		for _, tableConfig := range syncCfg.Tables {
+			captures[tableConfig.Name] = tableConfig.GetCapture(syncCfg.Capture)
+		}
+		state.tables = make(map[string]bool, len(opts.Tables))
+		for _, table := range opts.Tables {
+			capture, ok := captures[table]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownTable, table)
+			}
+			if capture != CaptureBinlog {
+				return nil, fmt.Errorf("%w: %s is polled, not captured from the binlog", ErrInvalidReplay, table)
+			}
+			state.tables[table] = true
+		}
+	}
+
+	switch {
+	case opts.GTIDSet != "":
+		if _, err := mysql.ParseGTIDSet(mysql.MySQLFlavor, opts.GTIDSet); err != nil {
+			return nil, fmt.Errorf("%w: gtid set: %v", ErrInvalidReplay, err)
+		}
+		state.coords.GTIDSet = opts.GTIDSet
+	case opts.BinlogFile != "":
+		state.coords.BinlogFile, state.coords.BinlogPos = opts.BinlogFile, opts.BinlogPos
+		if state.coords.BinlogPos < 4 {
+			// Past the file's magic number
+			state.coords.BinlogPos = 4
+		}
+	default:
+		serverID, err := m.replicaServerID()
+		if err != nil {
+			return nil, err
+		}
+		pos, err := binlogFileAt(m.cfg.Databases.Local, serverID, opts.Since)
+		if err != nil {
+			return nil, err
+		}
+		state.coords.BinlogFile, state.coords.BinlogPos = pos.Name, pos.Pos
+	}
+	return state, nil
+}
+
+// upserts reports whether e is a replayed update to follow with an upsert.
+// Changes made after the replay began are applied as usual.
+func (r *replayState) upserts(e BinlogEvent) bool {
+	if r == nil || !r.upsert || e.Type != Update || e.BinlogFile == "" {
+		return false
+	}
+	if r.tables != nil && !r.tables[e.Table] {
+		return false
+	}
+	return !binlogPosition{file: e.BinlogFile, pos: e.BinlogPos}.after(r.until)
+}
+
+// upsertOf is the new rows of an update, as an insert, which is applied as
+// an upsert.
+func upsertOf(e BinlogEvent) BinlogEvent {
+	upsert := e
+	upsert.Type = Insert
+	upsert.Before = nil
+	return upsert
+}
+
+// binlogFileAt finds the binlog file holding the changes made at since: the
+// last one started at or before it. The source's files are searched by the
+// time of their first event.
+func binlogFileAt(cfg config.DatabaseConnection, serverID uint32, since time.Time) (mysql.Position, error) {
+	tlsConfig, err := database.BuildTLSConfig(cfg.TLS, cfg.Host)
+	if err != nil {
+		return mysql.Position{}, fmt.Errorf("failed to build tls config: %w", err)
+	}
+	files, err := binlogFiles(cfg)
+	if err != nil {
+		return mysql.Position{}, err
+	}
+
+	syncerCfg := replication.BinlogSyncerConfig{
+		ServerID:       serverID,
+		Flavor:         mysql.MySQLFlavor,
+		Host:           cfg.Host,
+		Port:           uint16(cfg.Port),
+		User:           cfg.ReplicationUser,
+		Password:       cfg.ReplicationPassword,
+		TLSConfig:      tlsConfig,
+		RawModeEnabled: true,
+	}
+	var searchErr error
+	first := time.Time{}
+	i := sort.Search(len(files), func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		started, err := binlogStarted(syncerCfg, files[i])
+		if err != nil {
+			searchErr = fmt.Errorf("failed to read start of %s: %w", files[i], err)
+			return true
+		}
+		if i == 0 {
+			first = started
+		}
+		return started.After(since)
+	})
+	if searchErr != nil {
+		return mysql.Position{}, searchErr
+	}
+	if i == 0 {
+		if len(files) == 0 {
+			return mysql.Position{}, fmt.Errorf("%w: the source keeps no binlog", ErrInvalidReplay)
+		}
+		return mysql.Position{}, fmt.Errorf("%w: the source's binlog starts at %s, after %s", ErrInvalidReplay, first.UTC().Format(time.RFC3339), since.UTC().Format(time.RFC3339))
+	}
+	return mysql.Position{Name: files[i-1], Pos: 4}, nil
+}
+
+// binlogFiles lists the binlog files the source still keeps, oldest first.
+func binlogFiles(cfg config.DatabaseConnection) ([]string, error) {
+	tlsConfig, err := database.BuildTLSConfig(cfg.TLS, cfg.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build tls config: %w", err)
+	}
+	conn, err := client.Connect(fmt.Sprintf("%s:%d", cfg.Host, cfg.Port), cfg.ReplicationUser, cfg.ReplicationPassword, "", func(c *client.Conn) {
+		if tlsConfig != nil {
+			c.SetTLSConfig(tlsConfig)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	result, err := conn.Execute("SHOW BINARY LOGS")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list binlog files: %w", err)
+	}
+	files := make([]string, 0, result.RowNumber())
+	for row := 0; row < result.RowNumber(); row++ {
+		if name, err := result.GetString(row, 0); err == nil {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// binlogStarted reads when a binlog file was started, from its first event.
+func binlogStarted(cfg replication.BinlogSyncerConfig, file string) (time.Time, error) {
+	syncer := replication.NewBinlogSyncer(cfg)
+	defer syncer.Close()
+	streamer, err := syncer.StartSync(mysql.Position{Name: file, Pos: 4})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), binlogStartTimeout)
+	defer cancel()
+	for {
+		ev, err := streamer.GetEvent(ctx)
+		if err != nil {
+			return time.Time{}, err
+		}
+		// The rotate event sent ahead of the file has no timestamp
+		if ev.Header.Timestamp != 0 {
+			return time.Unix(int64(ev.Header.Timestamp), 0), nil
+		}
+	}
+}
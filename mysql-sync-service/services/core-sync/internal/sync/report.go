@@ -0,0 +1,199 @@
+package sync
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/logger"
+)
+
+// drainTimeout bounds how long Stop waits for workers to apply what is
+// still queued before cancelling them.
+const drainTimeout = 30 * time.Second
+
+// TablePosition is the last change applied to a table.
+type TablePosition struct {
+	Table      string    `json:"table"`
+	BinlogFile string    `json:"binlog_file,omitempty"`
+	BinlogPos  uint32    `json:"binlog_pos,omitempty"`
+	GTID       string    `json:"gtid,omitempty"`
+	LastChange time.Time `json:"last_change"` // Source time of the change
+}
+
+// ShutdownReport tells operators where a stopped run left off. Events count
+// queue entries; a sync group's transaction is one event.
+type ShutdownReport struct {
+	RunID              string          `json:"run_id"`
+	StoppedAt          time.Time       `json:"stopped_at"`
+	EventsProcessed    int64           `json:"events_processed"` // Applied or dead-lettered
+	RowsApplied        int64           `json:"rows_applied"`
+	EventsDrained      int64           `json:"events_drained"`   // Processed while stopping
+	BatchesFlushed     int64           `json:"batches_flushed"`  // Applied while stopping
+	EventsUnapplied    int64           `json:"events_unapplied"` // Dropped with the queue; read again on the next start
+	DeadLetters        int             `json:"dead_letters"`
+	DeadLettersUnsaved int64           `json:"dead_letters_unsaved"` // Failed events the store did not take
+	Tables             []TablePosition `json:"tables"`
+}
+
+// runStats counts a run's progress for its shutdown report, and adds it to
+// the manager's live Stats.
+type runStats struct {
+	live               *Stats
+	mu                 sync.Mutex
+	queued             int64
+	processed          int64
+	batches            int64
+	rows               int64
+	deadLettersUnsaved int64
+	positions          map[string]TablePosition
+}
+
+func newRunStats(live *Stats) *runStats {
+	return &runStats{live: live, positions: make(map[string]TablePosition)}
+}
+
+func (s *runStats) Queued() {
+	s.live.queued()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queued++
+}
+
+func (s *runStats) Processed(events int) {
+	s.live.eventsProcessed.Add(int64(events))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processed += int64(events)
+}
+
+// Applied records a batch applied to every sink in latency, with the last
+// event of each table in it.
+func (s *runStats) Applied(events []BinlogEvent, last []BinlogEvent, latency time.Duration) {
+	var rows int64
+	tableRows := make(map[string]int)
+	for _, e := range events {
+		rows += int64(eventRows(e))
+		tableRows[e.Table] += eventRows(e)
+	}
+	s.live.applied(rows)
+	s.live.tables.applied(tableRows, latency)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches++
+	s.rows += rows
+	for _, e := range last {
+		position := TablePosition{
+			Table:      e.Table,
+			BinlogFile: e.BinlogFile,
+			BinlogPos:  e.BinlogPos,
+			GTID:       e.GTID,
+			LastChange: time.Unix(int64(e.Timestamp), 0),
+		}
+		// Workers finish out of order; keep the furthest position
+		if current, ok := s.positions[e.Table]; !ok || !position.before(current) {
+			s.positions[e.Table] = position
+		}
+	}
+}
+
+// before reports whether p is earlier in the binlog than other. Binlog file
+// names sort in order; polled changes have none and compare by time.
+func (p TablePosition) before(other TablePosition) bool {
+	if p.BinlogFile == "" || other.BinlogFile == "" {
+		return p.LastChange.Before(other.LastChange)
+	}
+	if p.BinlogFile != other.BinlogFile {
+		return p.BinlogFile < other.BinlogFile
+	}
+	return p.BinlogPos < other.BinlogPos
+}
+
+// Failed records a batch that failed to apply.
+func (s *runStats) Failed(events []BinlogEvent) {
+	s.live.batchesFailed.Add(1)
+	s.live.tables.failed(memberTables(events))
+}
+
+// DeadLettered records an event parked in the dead letter table.
+func (s *runStats) DeadLettered() {
+	s.live.deadLetters.Add(1)
+}
+
+func (s *runStats) DeadLetterUnsaved() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadLettersUnsaved++
+}
+
+// Rows returns the rows applied so far.
+func (s *runStats) Rows() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rows
+}
+
+// progress returns the processed events and applied batches so far.
+func (s *runStats) progress() (int64, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.processed, s.batches
+}
+
+// shutdownReport summarises a run whose workers have stopped. processed and
+// batches are the run's progress when stopping began.
+func (m *Manager) shutdownReport(run *syncRun, processed, batches int64) *ShutdownReport {
+	stats := run.stats
+	stats.mu.Lock()
+	report := &ShutdownReport{
+		RunID:              run.id,
+		StoppedAt:          time.Now(),
+		EventsProcessed:    stats.processed,
+		RowsApplied:        stats.rows,
+		EventsDrained:      stats.processed - processed,
+		BatchesFlushed:     stats.batches - batches,
+		EventsUnapplied:    stats.queued - stats.processed,
+		DeadLettersUnsaved: stats.deadLettersUnsaved,
+		Tables:             make([]TablePosition, 0, len(stats.positions)),
+	}
+	for _, position := range stats.positions {
+		report.Tables = append(report.Tables, position)
+	}
+	stats.mu.Unlock()
+	sort.Slice(report.Tables, func(i, j int) bool { return report.Tables[i].Table < report.Tables[j].Table })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if count, err := m.store.CountDeadLetters(ctx, run.id); err != nil {
+		logger.Log.Warn("Failed to count dead letters for shutdown report", zap.String("run_id", run.id), zap.Error(err))
+	} else {
+		report.DeadLetters = count
+	}
+
+	logger.Log.Info("Shutdown report",
+		zap.String("run_id", report.RunID),
+		zap.Int64("events_processed", report.EventsProcessed),
+		zap.Int64("rows_applied", report.RowsApplied),
+		zap.Int64("events_drained", report.EventsDrained),
+		zap.Int64("batches_flushed", report.BatchesFlushed),
+		zap.Int64("events_unapplied", report.EventsUnapplied),
+		zap.Int("dead_letters", report.DeadLetters),
+		zap.Int64("dead_letters_unsaved", report.DeadLettersUnsaved),
+	)
+	for _, position := range report.Tables {
+		logger.Log.Info("Final table position",
+			zap.String("run_id", report.RunID),
+			zap.String("table", position.Table),
+			zap.String("binlog_file", position.BinlogFile),
+			zap.Uint32("binlog_pos", position.BinlogPos),
+			zap.String("gtid", position.GTID),
+			zap.Time("last_change", position.LastChange),
+		)
+	}
+	return report
+}
@@ -0,0 +1,414 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/ids"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/store"
+)
+
+// Resolution intent states
+const (
+	IntentPending    = "pending"
+	IntentCompleted  = "completed"
+	IntentRolledBack = "rolled_back"
+)
+
+// ErrInvalidResolution is returned for a strategy that can't be applied to
+// a conflict.
+var ErrInvalidResolution = errors.New("invalid conflict resolution")
+
+// ErrConflictChanged is returned when a conflict was resolved, or claimed
+// by another resolution, since its version was read.
+var ErrConflictChanged = errors.New("conflict was changed or is being resolved")
+
+// ResolveConflict writes the winning row of strategy to both databases and
+// marks the conflict resolved. An intent is recorded before either database
+// is written and updated after each, so a resolution interrupted by a crash
+// is finished by RecoverResolutions. If a database can't be written, those
+// already written get their own row back.
+//
+// Recording the intent claims the conflict at conflict.Version; a conflict
+// resolved or claimed since fails with ErrConflictChanged, so two resolvers
+// can't both resolve it.
+//
+// A manual resolution without resolved data only marks the conflict
+// resolved, for rows fixed by hand.
+func (m *Manager) ResolveConflict(ctx context.Context, conflict *store.Conflict, strategy string, resolvedData json.RawMessage) error {
+	if conflict.ConflictType == ConflictUniqueKey && strategy != ResolveManual {
+		return fmt.Errorf("%w: a unique key collision can only be resolved manually", ErrInvalidResolution)
+	}
+	intent := &store.ResolutionIntent{
+		ID:         ids.New(),
+		ConflictID: conflict.ID,
+		Strategy:   strategy,
+		Status:     IntentPending,
+		CreatedAt:  time.Now(),
+	}
+
+	sides := &conflictSides{}
+	if strategy == ResolveManual && len(resolvedData) == 0 {
+		// Nothing to write to either database
+		intent.LocalApplied, intent.CloudApplied = true, true
+	} else {
+		var err error
+		if sides, err = m.conflictSides(ctx, conflict); err != nil {
+			return err
+		}
+		winner, err := resolutionWinner(strategy, conflict, sides, resolvedData)
+		if err != nil {
+			return err
+		}
+		if winner != nil {
+			if intent.ResolvedData, err = json.Marshal(winner); err != nil {
+				return fmt.Errorf("failed to encode resolved row: %w", err)
+			}
+		}
+	}
+
+	claimed, err := m.store.ClaimConflict(ctx, intent, conflict.Version)
+	if err != nil {
+		return fmt.Errorf("failed to record resolution intent: %w", err)
+	}
+	if !claimed {
+		return ErrConflictChanged
+	}
+	conflict.Version++
+	return m.applyResolution(ctx, conflict, sides, intent)
+}
+
+// resolutionWinner is the row both databases end up with; nil deletes it.
+// Resolved data is a row image: binary values are written as hex.
+func resolutionWinner(strategy string, conflict *store.Conflict, sides *conflictSides, resolvedData json.RawMessage) (map[string]interface{}, error) {
+	if strategy == ResolveManual {
+		row, err := decodeRow(resolvedData)
+		if err == nil {
+			_, err = typedRow(row, sides.local.schema)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: resolved_data: %v", ErrInvalidResolution, err)
+		}
+		return row, nil
+	}
+	resolver, err := NewResolutionStrategy(strategy, *sides.table)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.Resolve(conflict)
+}
+
+// autoResolve resolves the just recorded conflicts of tables with a system
+// of record. Those it can't are left for an operator.
+func (m *Manager) autoResolve(ctx context.Context, conflicts []*store.Conflict) {
+	for _, conflict := range conflicts {
+		strategy := m.defaultResolution(conflict)
+		if strategy != ResolveLocalWins && strategy != ResolveCloudWins {
+			continue
+		}
+		if err := m.ResolveConflict(ctx, conflict, strategy, nil); err != nil {
+			logger.Log.Warn("Failed to resolve conflict automatically",
+				zap.String("conflict_id", conflict.ID),
+				zap.String("table", conflict.TableName),
+				zap.String("strategy", strategy),
+				zap.Error(err))
+		}
+	}
+}
+
+type resolutionStep struct {
+	name    string
+	side    conflictSide
+	applied *bool
+}
+
+func resolutionSteps(sides *conflictSides, intent *store.ResolutionIntent) []resolutionStep {
+	return []resolutionStep{
+		{name: "local", side: sides.local, applied: &intent.LocalApplied},
+		{name: "cloud", side: sides.cloud, applied: &intent.CloudApplied},
+	}
+}
+
+// applyResolution writes the intent's row to each database that doesn't
+// have it yet, then marks the conflict resolved and the intent completed.
+// Writing a database twice is harmless: inserts are upserts.
+func (m *Manager) applyResolution(ctx context.Context, conflict *store.Conflict, sides *conflictSides, intent *store.ResolutionIntent) error {
+	winner, err := decodeRow(intent.ResolvedData)
+	if err != nil {
+		return fmt.Errorf("invalid resolved data: %w", err)
+	}
+
+	for _, step := range resolutionSteps(sides, intent) {
+		if *step.applied {
+			continue
+		}
+		if err := applyRow(ctx, step.side, conflict.TableName, winner); err != nil {
+			return m.rollbackResolution(ctx, conflict, sides, intent, fmt.Errorf("failed to apply resolution to %s database: %w", step.name, err))
+		}
+		*step.applied = true
+		if err := m.store.UpdateResolutionIntent(ctx, intent); err != nil {
+			return fmt.Errorf("failed to record resolution progress: %w", err)
+		}
+	}
+
+	if err := m.store.ResolveConflict(ctx, conflict.ID, intent.Strategy, intent.ResolvedData); err != nil {
+		return fmt.Errorf("failed to mark conflict resolved: %w", err)
+	}
+	intent.Status = IntentCompleted
+	intent.CompletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	if err := m.store.UpdateResolutionIntent(ctx, intent); err != nil {
+		return fmt.Errorf("failed to complete resolution intent: %w", err)
+	}
+
+	logger.For(ctx).Info("Conflict resolved",
+		zap.String("conflict_id", conflict.ID),
+		zap.String("table", conflict.TableName),
+		zap.String("strategy", intent.Strategy),
+	)
+	return nil
+}
+
+// rollbackResolution gives each database already written its own row back
+// and marks the intent rolled back. If that fails too the intent stays
+// pending, to be retried on restart.
+func (m *Manager) rollbackResolution(ctx context.Context, conflict *store.Conflict, sides *conflictSides, intent *store.ResolutionIntent, cause error) error {
+	intent.ErrorMessage = sql.NullString{String: cause.Error(), Valid: true}
+	for _, step := range resolutionSteps(sides, intent) {
+		if !*step.applied {
+			continue
+		}
+		if err := applyRow(ctx, step.side, conflict.TableName, step.side.row); err != nil {
+			logger.For(ctx).Error("Failed to roll back conflict resolution, retrying on restart",
+				zap.String("conflict_id", conflict.ID),
+				zap.String("database", step.name),
+				zap.Error(err),
+			)
+			if err := m.store.UpdateResolutionIntent(ctx, intent); err != nil {
+				logger.For(ctx).Warn("Failed to record resolution error", zap.String("intent_id", intent.ID), zap.Error(err))
+			}
+			return fmt.Errorf("%w; rolling back the %s database failed: %v", cause, step.name, err)
+		}
+		*step.applied = false
+	}
+
+	intent.Status = IntentRolledBack
+	intent.CompletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	if err := m.store.UpdateResolutionIntent(ctx, intent); err != nil {
+		logger.For(ctx).Warn("Failed to record resolution rollback", zap.String("intent_id", intent.ID), zap.Error(err))
+	}
+	logger.For(ctx).Warn("Conflict resolution rolled back",
+		zap.String("conflict_id", conflict.ID),
+		zap.String("table", conflict.TableName),
+		zap.Error(cause),
+	)
+	return cause
+}
+
+// applyRow makes one database hold row, in one transaction.
+func applyRow(ctx context.Context, side conflictSide, table string, row map[string]interface{}) error {
+	statements, err := side.converge(table, row)
+	if err != nil {
+		return err
+	}
+	return side.db.ExecTx(ctx, func(tx *sql.Tx) error {
+		for _, stmt := range statements {
+			if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RecoverResolutions finishes the resolutions a crash left pending, or
+// rolls them back if they can't be finished. It runs once at startup.
+func (m *Manager) RecoverResolutions(ctx context.Context) error {
+	intents, err := m.store.ListPendingResolutionIntents(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list pending resolutions: %w", err)
+	}
+
+	for _, intent := range intents {
+		logger.Log.Warn("Finishing interrupted conflict resolution",
+			zap.String("intent_id", intent.ID),
+			zap.String("conflict_id", intent.ConflictID),
+			zap.Bool("local_applied", intent.LocalApplied),
+			zap.Bool("cloud_applied", intent.CloudApplied),
+		)
+
+		conflict, err := m.store.GetConflict(ctx, intent.ConflictID)
+		if err != nil {
+			return fmt.Errorf("failed to read conflict %s: %w", intent.ConflictID, err)
+		}
+		if conflict == nil {
+			intent.Status = IntentRolledBack
+			intent.ErrorMessage = sql.NullString{String: "conflict no longer exists", Valid: true}
+			intent.CompletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			if err := m.store.UpdateResolutionIntent(ctx, intent); err != nil {
+				return fmt.Errorf("failed to update resolution intent: %w", err)
+			}
+			continue
+		}
+
+		sides := &conflictSides{}
+		if !intent.LocalApplied || !intent.CloudApplied {
+			sides, err = m.conflictSides(ctx, conflict)
+		}
+		if err == nil {
+			err = m.applyResolution(ctx, conflict, sides, intent)
+		}
+		if err != nil {
+			logger.Log.Error("Failed to finish conflict resolution",
+				zap.String("intent_id", intent.ID),
+				zap.String("conflict_id", conflict.ID),
+				zap.Error(err),
+			)
+		}
+	}
+	return nil
+}
+
+// maxBulkResolveFailures caps the failures listed in a bulk resolution's
+// result; the rest are only counted.
+const maxBulkResolveFailures = 100
+
+// BulkResolveRequest selects the open conflicts to resolve with one
+// strategy: those in IDs, or with no IDs every open conflict of Tables.
+// Conflicts outside Tables are skipped either way; no tables allows any.
+type BulkResolveRequest struct {
+	IDs      []string `json:"ids"`
+	Tables   []string `json:"tables"`
+	Strategy string   `json:"strategy"`
+}
+
+// BulkResolveResult is a bulk resolution's outcome.
+type BulkResolveResult struct {
+	Resolved int                  `json:"resolved"`
+	Failed   int                  `json:"failed"`
+	Failures []BulkResolveFailure `json:"failures,omitempty"`
+}
+
+type BulkResolveFailure struct {
+	ConflictID string `json:"conflict_id"`
+	Error      string `json:"error"`
+}
+
+// BulkResolve resolves many conflicts in the background, one at a time as
+// ResolveConflict does, and returns the operation tracking it. A conflict
+// that fails is listed and the rest carry on.
+func (m *Manager) BulkResolve(req BulkResolveRequest) (Operation, error) {
+	switch req.Strategy {
+	case ResolveLocalWins, ResolveCloudWins, ResolveLastWriteWins, ResolveDefault:
+	case ResolveManual:
+		return Operation{}, fmt.Errorf("%w: manual resolution needs each conflict's resolved data", ErrInvalidResolution)
+	default:
+		return Operation{}, fmt.Errorf("%w: unknown strategy %q", ErrInvalidResolution, req.Strategy)
+	}
+
+	id := m.operations.add(OperationBulkResolve, req.Tables, nil)
+	m.operations.update(id, func(op *Operation) {
+		op.Progress = OperationProgress{Total: int64(len(req.IDs)), Unit: "conflicts"}
+	})
+	go func() {
+		result, err := m.bulkResolve(m.ctx, id, req)
+		m.operations.finish(id, result, err)
+	}()
+	op, _ := m.operations.get(id)
+	return op, nil
+}
+
+// defaultResolution is DefaultResolution for the conflict's table; manual
+// if the table is no longer synced.
+func (m *Manager) defaultResolution(conflict *store.Conflict) string {
+	for _, table := range m.tableConfigs() {
+		if table.Name == conflict.TableName {
+			return DefaultResolution(table, conflict.ConflictType)
+		}
+	}
+	return ResolveManual
+}
+
+func (m *Manager) bulkResolve(ctx context.Context, id string, req BulkResolveRequest) (*BulkResolveResult, error) {
+	result := &BulkResolveResult{}
+	allowed := make(map[string]bool, len(req.Tables))
+	for _, table := range req.Tables {
+		allowed[table] = true
+	}
+	count := func(conflictID string, err error) {
+		if err != nil {
+			result.Failed++
+			if len(result.Failures) < maxBulkResolveFailures {
+				result.Failures = append(result.Failures, BulkResolveFailure{ConflictID: conflictID, Error: err.Error()})
+			}
+		} else {
+			result.Resolved++
+		}
+		m.operations.update(id, func(op *Operation) {
+			op.Progress.Done = int64(result.Resolved + result.Failed)
+		})
+	}
+	resolve := func(conflict *store.Conflict) {
+		var err error
+		switch {
+		case len(allowed) > 0 && !allowed[conflict.TableName]:
+			err = fmt.Errorf("table %s is not included", conflict.TableName)
+		case conflict.Resolved:
+			err = ErrConflictChanged
+		default:
+			strategy := req.Strategy
+			if strategy == ResolveDefault {
+				strategy = m.defaultResolution(conflict)
+			}
+			if strategy == ResolveManual {
+				err = fmt.Errorf("%w: a %s conflict of %s needs manual resolution", ErrInvalidResolution, conflict.ConflictType, conflict.TableName)
+				break
+			}
+			err = m.ResolveConflict(ctx, conflict, strategy, nil)
+		}
+		count(conflict.ID, err)
+	}
+
+	if len(req.IDs) > 0 {
+		for _, conflictID := range req.IDs {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			conflict, err := m.store.GetConflict(ctx, conflictID)
+			if err != nil {
+				return result, fmt.Errorf("failed to read conflict %s: %w", conflictID, err)
+			}
+			if conflict == nil {
+				count(conflictID, errors.New("conflict not found"))
+				continue
+			}
+			resolve(conflict)
+		}
+		return result, nil
+	}
+
+	// Resolved conflicts drop out of the open list, so each page starts
+	// past only those that failed
+	const page = 500
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		conflicts, err := m.store.ListConflicts(ctx, false, req.Tables, page, result.Failed)
+		if err != nil {
+			return result, fmt.Errorf("failed to list conflicts: %w", err)
+		}
+		for _, conflict := range conflicts {
+			resolve(conflict)
+		}
+		if len(conflicts) < page {
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package sync_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"mysql-sync-service/internal/api"
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/sync"
+)
+
+// The API's tests can't build a Manager without a MySQL source, so the
+// restart endpoint is tested from here.
+func TestRestartThroughAPI(t *testing.T) {
+	m, local, cloud, _ := sync.NewTestManager(t)
+	handler, err := api.NewHandler(m, nil, nil, config.ServerConfig{
+		Tokens: []config.APITokenConfig{
+			{Name: "operator", Token: "operator-token", Actions: []string{api.ActionTrigger}},
+			{Name: "orders", Token: "orders-token", Tables: []string{"orders"}, Actions: []string{api.ActionTrigger}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler.Routes())
+	defer server.Close()
+
+	restart := func(token string) (int, map[string]interface{}) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/sync/restart", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, body
+	}
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		before := m.RunID()
+		status, body := restart("operator-token")
+		if status != http.StatusOK {
+			t.Fatalf("restart %d: status %d: %v", i, status, body)
+		}
+		if body["run_id"] != m.RunID() || m.RunID() == before {
+			t.Fatalf("restart %d: run %v replaced %s, current run %s", i, body["run_id"], before, m.RunID())
+		}
+		sync.InsertItem(t, local, i, "item")
+		sync.WaitForItem(t, cloud, i, "item")
+	}
+
+	// A token limited to other tables may not restart the run
+	before := m.RunID()
+	if status, body := restart("orders-token"); status != http.StatusForbidden {
+		t.Fatalf("restart with another table's token: status %d: %v", status, body)
+	}
+	if m.RunID() != before {
+		t.Fatal("forbidden restart replaced the run")
+	}
+
+	// With nothing running, the last run's tables start again
+	m.Stop()
+	if status, body := restart("operator-token"); status != http.StatusOK {
+		t.Fatalf("restart after stop: status %d: %v", status, body)
+	}
+	sync.InsertItem(t, local, 3, "item")
+	sync.WaitForItem(t, cloud, 3, "item")
+}
@@ -0,0 +1,594 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/alerting"
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
+	"mysql-sync-service/internal/ids"
+	"mysql-sync-service/internal/logger"
+)
+
+// ErrInvalidResync is returned for table resyncs that can't start.
+var ErrInvalidResync = errors.New("invalid table resync")
+
+// ErrResyncRunning is returned when the table is already being resynced.
+var ErrResyncRunning = errors.New("table is already being resynced")
+
+// Resync modes
+const (
+	// ResyncShadow copies into a new table and swaps it in when done; the
+	// target keeps its old rows until then. MySQL targets only.
+	ResyncShadow = "shadow"
+	// ResyncTruncate empties the target table and copies into it.
+	ResyncTruncate = "truncate"
+)
+
+// Resync statuses
+const (
+	ResyncCopying   = "copying"
+	ResyncCompleted = "completed"
+	ResyncFailed    = "failed"
+)
+
+const (
+	resyncSetupTimeout = 30 * time.Second
+	// Changes that came in during the copy are replayed without holding
+	// the table's worker until fewer than this are left
+	resyncFinalChanges = 1000
+	resyncReplayBatch  = 500
+)
+
+// TableResync is the progress of a table's rebuild.
+type TableResync struct {
+	Table      string     `json:"table"`
+	Mode       string     `json:"mode"`
+	Status     string     `json:"status"`
+	RowsCopied int64      `json:"rows_copied"`
+	Replayed   int        `json:"changes_replayed"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	// OperationID polls the rebuild at GET /api/v1/operations/{id}
+	OperationID string `json:"operation_id"`
+}
+
+// resyncs are a run's table rebuilds. A rebuild copies the source table
+// while the table keeps streaming; changes the workers apply to it in the
+// meantime are also recorded, and replayed onto the copy once it is done,
+// updates as upserts, so whatever the copy read before or after a change
+// it ends up where the table is.
+type resyncs struct {
+	mu     sync.Mutex
+	active map[string]*tableResync
+	done   []TableResync
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newResyncs() *resyncs {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &resyncs{active: make(map[string]*tableResync), ctx: ctx, cancel: cancel}
+}
+
+// tableResync rebuilds one table. Its mu is held by a worker applying the
+// table's changes, so none are missed between the last replay and the swap.
+type tableResync struct {
+	status   TableResync
+	run      *syncRun
+	source   *database.Database
+	target   *database.Database
+	config   config.TableConfig
+	live     *tableRouter
+	copyTo   *tableRouter      // the shadow tables, or the live ones on truncate
+	targets  map[string]string // target tables to their shadows
+	shadows  *shadowTables     // nil on truncate
+	maxBytes int64
+
+	mu       sync.Mutex
+	recorded bool // changes are recorded until the rebuild ends
+	changes  []BinlogEvent
+	bytes    int64
+	overflow bool
+}
+
+// ResyncTable rebuilds table on the target from the source while the
+// current run goes on streaming every other table, and this one too. In
+// shadow mode the table is copied next to the target and swapped in with
+// one RENAME; in truncate mode the target is emptied first. Only the MySQL
+// sink is rebuilt, and the target keeps the source's rows only, so soft
+// deleted rows are gone. Tables other tables' foreign keys reference
+// can't be rebuilt.
+func (m *Manager) ResyncTable(table, mode string) (TableResync, error) {
+	if mode == "" {
+		mode = ResyncShadow
+	}
+	if mode != ResyncShadow && mode != ResyncTruncate {
+		return TableResync{}, fmt.Errorf("%w: unknown mode %q", ErrInvalidResync, mode)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stats.state() != "running" && m.stats.state() != "paused" {
+		return TableResync{}, ErrNotRunning
+	}
+	var tableConfig *config.TableConfig
+	tables := m.tableConfigs()
+	for i := range tables {
+		if tables[i].Name == table {
+			tableConfig = &tables[i]
+		}
+	}
+	if tableConfig == nil {
+		return TableResync{}, fmt.Errorf("%w: %s", ErrUnknownTable, table)
+	}
+	run := m.run
+	inRun := false
+	for _, name := range run.tables {
+		inRun = inRun || name == table
+	}
+	switch {
+	case !inRun:
+		return TableResync{}, fmt.Errorf("%w: %s is not synced by the current run", ErrInvalidResync, table)
+	case run.observed != nil:
+		return TableResync{}, fmt.Errorf("%w: the run is observing, nothing is written to the target", ErrInvalidResync)
+	case !m.writesToTarget():
+		return TableResync{}, fmt.Errorf("%w: no sink writes to the target database", ErrInvalidResync)
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, resyncSetupTimeout)
+	defer cancel()
+	t, err := m.newTableResync(ctx, run, *tableConfig, mode)
+	if err != nil {
+		return TableResync{}, err
+	}
+	t.status.OperationID = ids.New()
+	status, err := run.resyncs.start(t)
+	if err != nil {
+		return TableResync{}, err
+	}
+	m.trackResync(run.resyncs, t)
+	return status, nil
+}
+
+func (m *Manager) newTableResync(ctx context.Context, run *syncRun, tableConfig config.TableConfig, mode string) (*tableResync, error) {
+	if tableConfig.PrimaryKey == "" {
+		key, err := run.registry.sourceKey(ctx, tableConfig.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read source keys: %w", err)
+		}
+		if key == "" {
+			return nil, fmt.Errorf("%w: %s has no primary or unique key to copy it by", ErrInvalidResync, tableConfig.Name)
+		}
+		tableConfig.PrimaryKey = key
+	}
+	live, err := newTableRouter(tableConfig, run.direction, m.cloudDB)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &tableResync{
+		status:   TableResync{Table: tableConfig.Name, Mode: mode, Status: ResyncCopying, StartedAt: time.Now()},
+		run:      run,
+		source:   m.localDB,
+		target:   m.cloudDB,
+		config:   tableConfig,
+		live:     live,
+		copyTo:   live,
+		maxBytes: m.cfg.Sync.Resync.GetMaxBufferedBytes(),
+	}
+	if mode == ResyncShadow {
+		t.targets = make(map[string]string)
+		if t.copyTo, err = shadowRouter(tableConfig, run.direction, m.cloudDB, t.targets); err != nil {
+			return nil, err
+		}
+		if err := checkShadowable(ctx, m.cloudDB, t.targets); err != nil {
+			return nil, fmt.Errorf("%w: %v; use truncate", ErrInvalidResync, err)
+		}
+		return t, nil
+	}
+
+	// Emptying a table other tables reference cascades
+	references, err := m.cloudDB.ForeignKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, rt := range live.routes {
+		for child, parents := range references {
+			for _, parent := range parents {
+				if strings.EqualFold(parent, rt.builder.table) {
+					return nil, fmt.Errorf("%w: %s is referenced by foreign keys of %s", ErrInvalidResync, parent, child)
+				}
+			}
+		}
+	}
+	return t, nil
+}
+
+// start records t's table's changes from now on and rebuilds it in the
+// background.
+func (r *resyncs) start(t *tableResync) (TableResync, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx.Err() != nil {
+		return TableResync{}, ErrNotRunning
+	}
+	if _, ok := r.active[t.config.Name]; ok {
+		return TableResync{}, fmt.Errorf("%w: %s", ErrResyncRunning, t.config.Name)
+	}
+	t.recorded = true
+	r.active[t.config.Name] = t
+
+	logger.Log.Info("Resyncing table", zap.String("run_id", t.run.id), zap.String("table", t.config.Name), zap.String("mode", t.status.Mode))
+	t.run.events.publish(SyncEvent{Type: EventResyncStarted, RunID: t.run.id, Table: t.config.Name, Status: ResyncCopying})
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		t.run.copies.begin(r.ctx, t.source, t.run.id, CopyResync, []string{t.config.Name})
+		err := t.rebuild(r.ctx, r)
+		r.finish(t, err)
+	}()
+	return t.status, nil
+}
+
+func (r *resyncs) finish(t *tableResync, err error) {
+	t.mu.Lock()
+	t.recorded = false
+	t.changes = nil
+	t.mu.Unlock()
+
+	r.mu.Lock()
+	now := time.Now()
+	t.status.FinishedAt = &now
+	t.status.Status = ResyncCompleted
+	if err != nil {
+		t.status.Status = ResyncFailed
+		t.status.Error = err.Error()
+	}
+	delete(r.active, t.config.Name)
+	r.done = append(r.done, t.status)
+	status := t.status
+	r.mu.Unlock()
+	if err != nil {
+		t.run.copies.setStatus([]string{t.config.Name}, CopyFailed, err)
+	} else {
+		t.run.copies.setStatus([]string{t.config.Name}, CopyCompleted, nil)
+	}
+
+	if err == nil {
+		logger.Log.Info("Table resynced",
+			zap.String("run_id", t.run.id),
+			zap.String("table", t.config.Name),
+			zap.Int64("rows", status.RowsCopied),
+			zap.Int("changes_replayed", status.Replayed),
+			zap.Duration("duration", now.Sub(status.StartedAt)),
+		)
+		t.run.events.publish(SyncEvent{Type: EventResyncCompleted, RunID: t.run.id, Table: t.config.Name, Status: status.Status})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resyncSetupTimeout)
+	t.shadows.Drop(ctx)
+	cancel()
+	message := err.Error()
+	if t.targets == nil {
+		message += "; the target table is partly copied, resync it again"
+	}
+	logger.Log.Error("Table resync failed", zap.String("run_id", t.run.id), zap.String("table", t.config.Name), zap.Error(err))
+	t.run.events.publish(SyncEvent{Type: EventResyncFailed, RunID: t.run.id, Table: t.config.Name, Status: status.Status, Error: err.Error()})
+	t.run.alerts.Fire(alerting.Alert{
+		Kind:     alerting.KindSyncFailure,
+		Severity: alerting.SeverityCritical,
+		Subject:  t.config.Name,
+		Title:    fmt.Sprintf("Resyncing %s failed", t.config.Name),
+		Message:  message,
+		Fields:   map[string]string{"table": t.config.Name, "mode": status.Mode},
+	})
+}
+
+// Snapshot lists the run's rebuilds, finished ones first.
+func (r *resyncs) Snapshot() []TableResync {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshot := append([]TableResync(nil), r.done...)
+	var active []TableResync
+	for _, t := range r.active {
+		active = append(active, t.status)
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].StartedAt.Before(active[j].StartedAt) })
+	return append(snapshot, active...)
+}
+
+// Stop cancels the rebuilds still going and waits for them to clean up.
+func (r *resyncs) Stop() {
+	r.mu.Lock()
+	r.cancel()
+	r.mu.Unlock()
+	r.wg.Wait()
+}
+
+// hold is called around applying events to the target. It blocks while a
+// rebuild of one of their tables is swapping, and the returned func records
+// them for the rebuilds if they were applied.
+func (r *resyncs) hold(events []BinlogEvent) func(applied bool) {
+	noop := func(bool) {}
+	r.mu.Lock()
+	if len(r.active) == 0 {
+		r.mu.Unlock()
+		return noop
+	}
+	var held []*tableResync
+	for _, table := range memberTables(events) {
+		if t, ok := r.active[table]; ok {
+			held = append(held, t)
+		}
+	}
+	r.mu.Unlock()
+	if len(held) == 0 {
+		return noop
+	}
+
+	for _, t := range held {
+		t.mu.Lock()
+	}
+	return func(applied bool) {
+		for _, t := range held {
+			if applied && t.recorded {
+				t.record(events)
+			}
+			t.mu.Unlock()
+		}
+	}
+}
+
+// record keeps the table's changes for replay; t.mu must be held. Past the
+// size bound they are dropped and the rebuild fails.
+func (t *tableResync) record(events []BinlogEvent) {
+	for _, e := range events {
+		if e.Table != t.config.Name || t.overflow {
+			continue
+		}
+		size := e.Size
+		if size == 0 {
+			size = estimateRowsSize(e.Before) + estimateRowsSize(e.Rows)
+		}
+		if t.bytes+size > t.maxBytes {
+			t.overflow = true
+			t.changes, t.bytes = nil, 0
+			return
+		}
+		t.changes = append(t.changes, e)
+		t.bytes += size
+	}
+}
+
+// rebuild copies the table, replays the changes recorded meanwhile and, in
+// shadow mode, swaps the copy in.
+func (t *tableResync) rebuild(ctx context.Context, r *resyncs) error {
+	if t.targets != nil {
+		shadows, err := createShadowTables(ctx, t.target, t.targets)
+		if err != nil {
+			return err
+		}
+		t.shadows = shadows
+	} else {
+		for _, rt := range t.live.routes {
+			if _, err := t.target.DB.ExecContext(ctx, "DELETE FROM "+t.target.Dialect.QuoteIdentifier(rt.builder.table)); err != nil {
+				return fmt.Errorf("failed to empty %s: %w", rt.builder.table, err)
+			}
+		}
+	}
+
+	if err := t.copy(ctx, r); err != nil {
+		return err
+	}
+	t.run.copies.setStatus([]string{t.config.Name}, CopyApplying, nil)
+
+	for {
+		t.mu.Lock()
+		if t.overflow {
+			t.mu.Unlock()
+			return fmt.Errorf("more than %d bytes of changes came in during the copy", t.maxBytes)
+		}
+		changes := t.changes
+		t.changes, t.bytes = nil, 0
+		if len(changes) > resyncFinalChanges {
+			t.mu.Unlock()
+			if err := t.replay(ctx, r, changes); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// The table's worker waits from here until the swap is done
+		err := t.replay(ctx, r, changes)
+		if err == nil && t.shadows != nil {
+			err = t.shadows.Swap(ctx, t.run.registry)
+		}
+		t.recorded = false
+		t.mu.Unlock()
+		return err
+	}
+}
+
+// copy reads the source table in key order, a batch at a time, and writes
+// each batch as upserts.
+func (t *tableResync) copy(ctx context.Context, r *resyncs) error {
+	schema, err := t.run.registry.Source(ctx, t.config.Name)
+	if err != nil {
+		return err
+	}
+	keyColumns := splitColumns(t.config.PrimaryKey)
+	var keyIndexes []int
+	for _, column := range keyColumns {
+		index := columnIndex(schema.Columns, column)
+		if index < 0 {
+			return fmt.Errorf("key column %s not found", column)
+		}
+		keyIndexes = append(keyIndexes, index)
+	}
+
+	quotedColumns := make([]string, len(schema.Columns))
+	for i, column := range schema.Columns {
+		quotedColumns[i] = database.QuoteIdentifier(column)
+	}
+	order := make([]string, len(keyColumns))
+	for i, column := range keyColumns {
+		order[i] = database.QuoteIdentifier(column)
+	}
+	batchSize := t.config.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultPollBatchSize
+	}
+	source := SourceInfo{SiteID: t.source.Config.SiteID, Host: t.source.Config.Host}
+
+	var last []interface{}
+	for {
+		if err := t.run.gate.Wait(ctx); err != nil {
+			return err
+		}
+
+		query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quotedColumns, ", "), database.QuoteIdentifier(t.config.Name))
+		if last != nil {
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(order)), ", ")
+			query += fmt.Sprintf(" WHERE (%s) > (%s)", strings.Join(order, ", "), placeholders)
+		}
+		query += fmt.Sprintf(" ORDER BY %s LIMIT %d", strings.Join(order, ", "), batchSize)
+		batch, err := t.readBatch(ctx, query, last, len(schema.Columns))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", t.config.Name, err)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		keys := make([]string, len(batch))
+		for i, row := range batch {
+			parts := make([]string, len(keyIndexes))
+			for j, index := range keyIndexes {
+				parts[j] = fmt.Sprint(row[index])
+			}
+			keys[i] = strings.Join(parts, ",")
+		}
+		sourceSchema, _ := config.SplitTable(t.config.Name, t.source.Config.Database)
+		e := BinlogEvent{
+			Type:        Insert,
+			Schema:      sourceSchema,
+			Table:       t.config.Name,
+			Rows:        batch,
+			Timestamp:   uint32(time.Now().Unix()),
+			Size:        estimateRowsSize(batch),
+			PrimaryKeys: keys,
+			Columns:     schema.Columns,
+			ColumnTypes: schema.ColumnTypes,
+			KeyColumns:  keyColumns,
+			Generated:   schema.Generated,
+			Source:      source,
+		}
+		t.run.policies.apply(&e)
+		if err := t.run.throttle.Wait(ctx, map[string]int{t.config.Name: len(batch)}); err != nil {
+			return err
+		}
+		if err := t.apply(ctx, []BinlogEvent{e}); err != nil {
+			return err
+		}
+
+		r.mu.Lock()
+		t.status.RowsCopied += int64(len(batch))
+		r.mu.Unlock()
+		t.run.copies.copied(t.config.Name, len(batch))
+		if len(batch) < batchSize {
+			return nil
+		}
+		lastRow := batch[len(batch)-1]
+		last = make([]interface{}, len(keyIndexes))
+		for i, index := range keyIndexes {
+			last[i] = lastRow[index]
+		}
+	}
+}
+
+func (t *tableResync) readBatch(ctx context.Context, query string, args []interface{}, columns int) ([][]interface{}, error) {
+	rows, err := t.source.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch [][]interface{}
+	for rows.Next() {
+		values := make([]interface{}, columns)
+		dest := make([]interface{}, columns)
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		batch = append(batch, values)
+	}
+	return batch, rows.Err()
+}
+
+// replay applies recorded changes to the copy, a batch per transaction.
+func (t *tableResync) replay(ctx context.Context, r *resyncs, changes []BinlogEvent) error {
+	for start := 0; start < len(changes); start += resyncReplayBatch {
+		end := start + resyncReplayBatch
+		if end > len(changes) {
+			end = len(changes)
+		}
+		if err := t.apply(ctx, changes[start:end]); err != nil {
+			return fmt.Errorf("failed to replay changes made during the copy: %w", err)
+		}
+		r.mu.Lock()
+		t.status.Replayed += end - start
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+// apply writes events to the copy in one transaction. Updates are followed
+// by an upsert of their new row, which the copy may not have yet.
+func (t *tableResync) apply(ctx context.Context, events []BinlogEvent) error {
+	return t.target.ExecTx(ctx, func(tx *sql.Tx) error {
+		for _, e := range events {
+			statements, err := t.copyTo.Build(e)
+			if err == nil && e.Type == Update {
+				var upserts []statement
+				upserts, err = t.copyTo.Build(upsertOf(e))
+				statements = append(statements, upserts...)
+			}
+			if err != nil {
+				return err
+			}
+			for _, stmt := range statements {
+				if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Resyncs lists the current run's table rebuilds, or nil without a run.
+func (m *Manager) Resyncs() []TableResync {
+	m.mu.Lock()
+	run := m.run
+	m.mu.Unlock()
+	if run == nil {
+		return nil
+	}
+	return run.resyncs.Snapshot()
+}
@@ -0,0 +1,81 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/metrics"
+	"mysql-sync-service/internal/store"
+)
+
+// retentionTimeout bounds one scheduled purge.
+const retentionTimeout = 30 * time.Minute
+
+// ErrInvalidPurge is returned for a purge without a cutoff.
+var ErrInvalidPurge = errors.New("invalid purge")
+
+// PurgeRequest selects conflicts to purge: those resolved before Before
+// and, with Unresolved, those detected before it and never resolved. No
+// tables purges every table's.
+type PurgeRequest struct {
+	Before     time.Time
+	Tables     []string
+	Unresolved bool
+}
+
+// PurgeConflicts deletes old conflicts from the state store and returns
+// how many went. Conflicts being resolved are kept.
+func (m *Manager) PurgeConflicts(ctx context.Context, req PurgeRequest) (int64, error) {
+	if req.Before.IsZero() {
+		return 0, fmt.Errorf("%w: a cutoff is required", ErrInvalidPurge)
+	}
+	if req.Before.After(time.Now()) {
+		return 0, fmt.Errorf("%w: the cutoff is in the future", ErrInvalidPurge)
+	}
+	purged, err := m.store.PurgeConflicts(ctx, store.ConflictPurgeFilter{Before: req.Before, Tables: req.Tables, Unresolved: req.Unresolved})
+	metrics.RetentionPurged.WithLabelValues("conflicts").Add(float64(purged))
+	if err != nil {
+		return purged, fmt.Errorf("failed to purge conflicts: %w", err)
+	}
+	logger.For(ctx).Info("Conflicts purged",
+		zap.Int64("conflicts", purged),
+		zap.Time("before", req.Before),
+		zap.Strings("tables", req.Tables),
+		zap.Bool("unresolved", req.Unresolved),
+	)
+	return purged, nil
+}
+
+// applyRetention purges what the retention config says has been kept long
+// enough. Run on the scheduler's cron.
+func (m *Manager) applyRetention(cfg config.RetentionConfig) {
+	ctx, cancel := context.WithTimeout(m.ctx, retentionTimeout)
+	defer cancel()
+	now := time.Now()
+
+	if age := cfg.GetResolvedConflicts(); age > 0 {
+		if _, err := m.PurgeConflicts(ctx, PurgeRequest{Before: now.Add(-age)}); err != nil {
+			logger.Log.Error("Retention failed to purge resolved conflicts", zap.Error(err))
+		}
+	}
+	if age := cfg.GetUnresolvedConflicts(); age > 0 {
+		if _, err := m.PurgeConflicts(ctx, PurgeRequest{Before: now.Add(-age), Unresolved: true}); err != nil {
+			logger.Log.Error("Retention failed to purge unresolved conflicts", zap.Error(err))
+		}
+	}
+	if age := cfg.GetHistory(); age > 0 {
+		purged, err := m.store.PurgeSyncHistory(ctx, now.Add(-age))
+		metrics.RetentionPurged.WithLabelValues("history").Add(float64(purged))
+		if err != nil {
+			logger.Log.Error("Retention failed to purge sync history", zap.Error(err))
+		} else {
+			logger.Log.Info("Sync history purged", zap.Int64("runs", purged), zap.Duration("older_than", age))
+		}
+	}
+}
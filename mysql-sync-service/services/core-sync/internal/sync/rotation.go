@@ -0,0 +1,53 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+
+	"mysql-sync-service/internal/encryption"
+)
+
+// StartKeyRotation re-encrypts a table's encrypted columns on the target
+// with the active key version, in chunks alongside ongoing CDC.
+func (m *Manager) StartKeyRotation(table string) (*encryption.RotationJob, error) {
+	for _, tableConfig := range m.tableConfigs() {
+		if tableConfig.Name != table {
+			continue
+		}
+		// Rotation works on the target, under the target's names
+		var pkColumns []string
+		for _, column := range splitColumns(tableConfig.PrimaryKey) {
+			pkColumns = append(pkColumns, tableConfig.TargetColumn(column))
+		}
+		var columns []string
+		for _, column := range tableConfig.EncryptedColumns {
+			columns = append(columns, tableConfig.TargetColumn(column))
+		}
+		for _, column := range policyColumns(tableConfig, PolicyEncrypt) {
+			columns = append(columns, tableConfig.TargetColumn(column))
+		}
+		job, err := m.rotator.Start(encryption.RotationTarget{
+			Table:      tableConfig.GetTargetName(),
+			PrimaryKey: strings.Join(pkColumns, ","),
+			Columns:    columns,
+		})
+		if err != nil {
+			return nil, err
+		}
+		m.trackKeyRotation(job, table)
+		return job, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownTable, table)
+}
+
+func (m *Manager) GetKeyRotation(id string) (*encryption.RotationJob, bool) {
+	return m.rotator.Get(id)
+}
+
+func (m *Manager) ListKeyRotations() []encryption.RotationJob {
+	return m.rotator.List()
+}
+
+func (m *Manager) CancelKeyRotation(id string) bool {
+	return m.rotator.Cancel(id)
+}
@@ -0,0 +1,251 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
+)
+
+// Filter operators accepted in route config
+const (
+	FilterEq      = "eq"
+	FilterNe      = "ne"
+	FilterIn      = "in"
+	FilterNotIn   = "not_in"
+	FilterIsNull  = "is_null"
+	FilterNotNull = "not_null"
+)
+
+// tableRouter splits the rows of one source table across target tables.
+// Every path that applies rows to the target goes through Build, so routing
+// holds for streamed changes and bulk copies alike.
+type tableRouter struct {
+	table  string
+	routes []route
+}
+
+type route struct {
+	filter  []condition
+	builder *statementBuilder
+}
+
+type condition struct {
+	column   string
+	operator string
+	values   []string
+}
+
+func newTableRouter(tableConfig config.TableConfig, direction string, db *database.Database) (*tableRouter, error) {
+	switch tableConfig.GetDeleteMode() {
+	case DeleteHard, DeleteSoft, DeleteIgnore:
+	default:
+		return nil, fmt.Errorf("table %s: unknown delete_mode %q", tableConfig.Name, tableConfig.DeleteMode)
+	}
+
+	r := &tableRouter{table: tableConfig.Name}
+
+	// No routes: everything goes to the one target table
+	if len(tableConfig.Routes) == 0 {
+		r.routes = []route{{builder: newStatementBuilder(tableConfig, tableConfig.GetTargetName(), direction, db)}}
+		return r, nil
+	}
+
+	for i, routeConfig := range tableConfig.Routes {
+		if routeConfig.Target == "" {
+			return nil, fmt.Errorf("table %s route %d: target is required", tableConfig.Name, i)
+		}
+		filter, err := parseFilter(routeConfig.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("table %s route %d: %w", tableConfig.Name, i, err)
+		}
+		r.routes = append(r.routes, route{
+			filter:  filter,
+			builder: newStatementBuilder(tableConfig, routeConfig.Target, direction, db),
+		})
+	}
+	return r, nil
+}
+
+func parseFilter(conditions []config.FilterCondition) ([]condition, error) {
+	parsed := make([]condition, 0, len(conditions))
+	for _, c := range conditions {
+		if c.Column == "" {
+			return nil, fmt.Errorf("filter column is required")
+		}
+		operator := strings.ToLower(c.Operator)
+		if operator == "" {
+			operator = FilterEq
+		}
+
+		values := c.Values
+		switch operator {
+		case FilterEq, FilterNe:
+			values = []string{c.Value}
+		case FilterIn, FilterNotIn:
+			if len(values) == 0 {
+				return nil, fmt.Errorf("filter on %s: %s needs values", c.Column, operator)
+			}
+		case FilterIsNull, FilterNotNull:
+			values = nil
+		default:
+			return nil, fmt.Errorf("filter on %s: unknown operator %q", c.Column, c.Operator)
+		}
+		parsed = append(parsed, condition{column: c.Column, operator: operator, values: values})
+	}
+	return parsed, nil
+}
+
+// Build applies e to whichever targets its rows route to. An update whose
+// row moves between routes becomes a delete on the old target and an
+// upsert on the new one; the row still exists, so the move always deletes
+// whatever the table's delete mode.
+func (r *tableRouter) Build(e BinlogEvent) ([]statement, error) {
+	if len(r.routes) == 1 && len(r.routes[0].filter) == 0 {
+		return r.routes[0].builder.Build(e)
+	}
+
+	var statements []statement
+	add := func(routeIndex int, eventType EventType, before, rows [][]interface{}) error {
+		if routeIndex < 0 {
+			return nil
+		}
+		sub := e
+		sub.Type = eventType
+		sub.Rows, sub.Before = rows, before
+		built, err := r.routes[routeIndex].builder.Build(sub)
+		if err != nil {
+			return err
+		}
+		statements = append(statements, built...)
+		return nil
+	}
+
+	if e.Type == Update {
+		if err := e.checkImages(); err != nil {
+			return nil, err
+		}
+		for rowIndex, after := range e.Rows {
+			before := e.Before[rowIndex]
+			beforeRoute, err := r.match(e.Columns, before)
+			if err != nil {
+				return nil, err
+			}
+			afterRoute, err := r.match(e.Columns, after)
+			if err != nil {
+				return nil, err
+			}
+
+			if beforeRoute == afterRoute {
+				err = add(afterRoute, Update, [][]interface{}{before}, [][]interface{}{after})
+			} else {
+				if beforeRoute >= 0 {
+					moved := e
+					moved.Type = Delete
+					moved.Rows, moved.Before = [][]interface{}{before}, nil
+					removals, err := r.routes[beforeRoute].builder.buildRemovals(moved)
+					if err != nil {
+						return nil, err
+					}
+					statements = append(statements, removals...)
+				}
+				err = add(afterRoute, Insert, nil, [][]interface{}{after})
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return statements, nil
+	}
+
+	// Group rows per route so each target still gets batched statements
+	rowsByRoute := make([][][]interface{}, len(r.routes))
+	for _, row := range e.Rows {
+		routeIndex, err := r.match(e.Columns, row)
+		if err != nil {
+			return nil, err
+		}
+		if routeIndex >= 0 {
+			rowsByRoute[routeIndex] = append(rowsByRoute[routeIndex], row)
+		}
+	}
+	for routeIndex, rows := range rowsByRoute {
+		if len(rows) == 0 {
+			continue
+		}
+		if err := add(routeIndex, e.Type, nil, rows); err != nil {
+			return nil, err
+		}
+	}
+	return statements, nil
+}
+
+// match returns the index of the first route the row satisfies, or -1.
+func (r *tableRouter) match(columns []string, row []interface{}) (int, error) {
+	for routeIndex, rt := range r.routes {
+		matched := true
+		for _, c := range rt.filter {
+			ok, err := c.matches(columns, row)
+			if err != nil {
+				return -1, fmt.Errorf("table %s: %w", r.table, err)
+			}
+			if !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return routeIndex, nil
+		}
+	}
+	return -1, nil
+}
+
+// matches compares by string form, since binlog values arrive as assorted
+// Go types while config values are always strings. NULL never equals a value.
+func (c condition) matches(columns []string, row []interface{}) (bool, error) {
+	columnIndex := -1
+	for i, column := range columns {
+		if strings.EqualFold(column, c.column) {
+			columnIndex = i
+			break
+		}
+	}
+	if columnIndex < 0 || columnIndex >= len(row) {
+		return false, fmt.Errorf("filter column %s not in row", c.column)
+	}
+
+	value := row[columnIndex]
+	switch c.operator {
+	case FilterIsNull:
+		return value == nil, nil
+	case FilterNotNull:
+		return value != nil, nil
+	}
+
+	in := false
+	if value != nil {
+		formatted := filterValue(value)
+		for _, candidate := range c.values {
+			if formatted == candidate {
+				in = true
+				break
+			}
+		}
+	}
+
+	switch c.operator {
+	case FilterEq, FilterIn:
+		return in, nil
+	default:
+		return !in, nil
+	}
+}
+
+func filterValue(value interface{}) string {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(value)
+}
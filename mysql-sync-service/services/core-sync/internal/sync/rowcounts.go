@@ -0,0 +1,108 @@
+package sync
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/store"
+)
+
+const (
+	// A table whose stored count couldn't be read is retried this often
+	rowCountRetry = 30 * time.Second
+	// How often a running run's row total is written to sync history
+	historyRowsInterval = 30 * time.Second
+)
+
+// rowCounts are the rows synced to each table over its lifetime, written
+// with its checkpoint as sync_state.rows_synced. A table's count picks up
+// from the state store the first time it is counted, so it carries on
+// across runs and restarts.
+type rowCounts struct {
+	store  store.Store
+	mu     sync.Mutex
+	tables map[string]*tableRows
+}
+
+type tableRows struct {
+	rows    atomic.Int64
+	loaded  bool      // the stored count was added; guarded by rowCounts.mu
+	retryAt time.Time // when to try reading it again
+}
+
+func newRowCounts(s store.Store) *rowCounts {
+	return &rowCounts{store: s, tables: make(map[string]*tableRows)}
+}
+
+// add counts rows synced to table and returns its total.
+func (c *rowCounts) add(ctx context.Context, table string, rows int) int64 {
+	return c.table(ctx, table).rows.Add(int64(rows))
+}
+
+func (c *rowCounts) table(ctx context.Context, table string) *tableRows {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tables[table]
+	if !ok {
+		t = &tableRows{}
+		c.tables[table] = t
+	}
+	if t.loaded || time.Now().Before(t.retryAt) {
+		return t
+	}
+
+	state, err := c.store.GetSyncState(ctx, table)
+	if err != nil {
+		// Counted from here meanwhile; the stored count is added once read
+		t.retryAt = time.Now().Add(rowCountRetry)
+		logger.Log.Warn("Failed to read the table's synced row count", zap.String("table", table), zap.Error(err))
+		return t
+	}
+	if state != nil {
+		t.rows.Add(state.RowsSynced)
+	}
+	t.loaded = true
+	return t
+}
+
+// recordRunRows writes run's row total to sync history every
+// historyRowsInterval while it runs, so a long run isn't shown as having
+// synced nothing until it ends. The returned func stops it, and must be
+// called before the run's end is recorded.
+func (m *Manager) recordRunRows(run *syncRun) func() {
+	ctx, cancel := context.WithCancel(m.ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(historyRowsInterval)
+		defer ticker.Stop()
+
+		var recorded int64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			rows := run.stats.Rows()
+			if rows == recorded {
+				continue
+			}
+			history := &store.SyncHistory{ID: run.id, Status: "running", TotalRows: rows}
+			if err := m.stateWrites.UpdateSyncHistory(ctx, history); err != nil {
+				logger.Log.Debug("Failed to record the run's synced rows", zap.String("run_id", run.id), zap.Error(err))
+				continue
+			}
+			recorded = rows
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
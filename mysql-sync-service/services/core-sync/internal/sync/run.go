@@ -0,0 +1,46 @@
+package sync
+
+import (
+	"time"
+
+	"mysql-sync-service/internal/alerting"
+)
+
+// Sync directions, as used by SyncConfig.Mode and per-column overrides
+const (
+	DirectionLocalToCloud  = "local_to_cloud"
+	DirectionCloudToLocal  = "cloud_to_local"
+	DirectionBidirectional = "bidirectional"
+)
+
+// syncRun carries the per-run state shared by a listener and its workers.
+type syncRun struct {
+	id        string
+	direction string
+	trigger   string
+	tables    []string
+	startedAt time.Time
+	budget    *byteBudget
+	lag       *lagTracker
+	alerts    *alerting.Manager
+	events    *eventHub
+	copies    *copyProgress
+	health    *healthTracker
+	schemas   *schemaTracker
+	registry  *schemaRegistry
+	stats     *runStats
+	rows      *rowCounts
+	sampler   *eventSampler
+	gate      pauseGate
+	throttle  *applyThrottle
+	progress  *txnProgress
+	observed  *observations // nil unless observing
+	replay    *replayState  // nil unless replaying
+	resyncs   *resyncs
+	snapshot  *snapshotShadows // nil unless loading a dump into shadows
+	audit     *auditor         // nil unless auditing applied changes
+	policies  *columnPolicies  // nil unless a table has column policies
+	conflicts *ConflictManager // nil unless applying changes
+
+	stopHistory func() // stops recording the run's rows in sync history
+}
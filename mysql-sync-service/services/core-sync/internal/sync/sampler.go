@@ -0,0 +1,203 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mysql-sync-service/internal/config"
+)
+
+// SampledEvent is a binlog event as it was read, with the statements the
+// cloud sink would build for it. Columns under a column policy show their
+// values as the target gets them.
+type SampledEvent struct {
+	SampledAt  time.Time                `json:"sampled_at"`
+	Type       EventType                `json:"type"`
+	Schema     string                   `json:"schema"`
+	Table      string                   `json:"table"`
+	BinlogFile string                   `json:"binlog_file,omitempty"`
+	BinlogPos  uint32                   `json:"binlog_pos,omitempty"`
+	GTID       string                   `json:"gtid,omitempty"`
+	Timestamp  time.Time                `json:"timestamp"` // Source time of the change
+	Columns    []EventColumn            `json:"columns"`
+	Rows       []map[string]interface{} `json:"rows"`
+	Before     []map[string]interface{} `json:"before,omitempty"` // updates' old images, one per row
+	SQL        []string                 `json:"sql"`              // values inlined
+	Error      string                   `json:"error,omitempty"`  // why no SQL could be built
+}
+
+// Sampling is whether binlog events are being sampled, and how many of the
+// most recent are kept.
+type Sampling struct {
+	Enabled  bool `json:"enabled"`
+	Capacity int  `json:"capacity"`
+	Sampled  int  `json:"sampled"` // events held now
+}
+
+// eventSampler keeps the most recent binlog events read, across runs, for
+// inspection. Sampling costs a copy of each event's rows, so it is off
+// unless switched on.
+type eventSampler struct {
+	enabled atomic.Bool
+	mu      sync.Mutex
+	events  []sampled // a ring, of which next is the oldest once it is full
+	next    int
+}
+
+type sampled struct {
+	at    time.Time
+	event BinlogEvent
+}
+
+func newEventSampler(cfg config.DebugConfig) *eventSampler {
+	s := &eventSampler{events: make([]sampled, 0, cfg.GetSampleSize())}
+	s.enabled.Store(cfg.SampleEvents)
+	return s
+}
+
+// sample keeps a copy of e if sampling is on.
+func (s *eventSampler) sample(e BinlogEvent) {
+	if s == nil || !s.enabled.Load() {
+		return
+	}
+	// Workers rewrite rows in place, e.g. under column policies
+	e.Rows, e.Before = copyRows(e.Rows), copyRows(e.Before)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := sampled{at: time.Now(), event: e}
+	if len(s.events) < cap(s.events) {
+		s.events = append(s.events, entry)
+	} else {
+		s.events[s.next] = entry
+	}
+	s.next = (s.next + 1) % cap(s.events)
+}
+
+// recent returns up to limit of the events of table, or of every table if
+// it is "", the newest first.
+func (s *eventSampler) recent(table string, limit int) []sampled {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []sampled
+	for k := 1; k <= len(s.events) && len(events) < limit; k++ {
+		entry := s.events[(s.next-k+len(s.events))%len(s.events)]
+		if table == "" || entry.event.Table == table {
+			events = append(events, entry)
+		}
+	}
+	return events
+}
+
+func (s *eventSampler) status() Sampling {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Sampling{Enabled: s.enabled.Load(), Capacity: cap(s.events), Sampled: len(s.events)}
+}
+
+func copyRows(rows [][]interface{}) [][]interface{} {
+	if rows == nil {
+		return nil
+	}
+	copied := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		copied[i] = append([]interface{}(nil), row...)
+	}
+	return copied
+}
+
+// Sampling reports whether binlog events are being sampled.
+func (m *Manager) Sampling() Sampling {
+	return m.sampler.status()
+}
+
+// SetSampling switches the sampling of binlog events on or off; the events
+// sampled so far are kept. The change lasts until a restart.
+func (m *Manager) SetSampling(enabled bool) Sampling {
+	m.sampler.enabled.Store(enabled)
+	return m.sampler.status()
+}
+
+// SampledEvents returns up to limit of the most recent binlog events of
+// table, or of every table if it is "", the newest first, with the SQL
+// each would be applied with.
+func (m *Manager) SampledEvents(ctx context.Context, table string, limit int) ([]SampledEvent, error) {
+	tables := m.tableConfigs()
+	if table != "" && !m.hasTable(table) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTable, table)
+	}
+	policies, err := newColumnPolicies(tables, m.keyring, m.hasher)
+	if err != nil {
+		return nil, err
+	}
+
+	routers := make(map[string]*tableRouter)
+	router := func(name string) (*tableRouter, error) {
+		if router, ok := routers[name]; ok {
+			return router, nil
+		}
+		for _, tableConfig := range tables {
+			if tableConfig.Name != name {
+				continue
+			}
+			if tableConfig.PrimaryKey == "" {
+				key, err := m.registry.sourceKey(ctx, name)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read source keys: %w", err)
+				}
+				tableConfig.PrimaryKey = key
+			}
+			router, err := newTableRouter(tableConfig, DirectionLocalToCloud, m.cloudDB)
+			if err != nil {
+				return nil, err
+			}
+			routers[name] = router
+			return router, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTable, name)
+	}
+
+	recent := m.sampler.recent(table, limit)
+	events := make([]SampledEvent, 0, len(recent))
+	for _, entry := range recent {
+		e := entry.event
+		e.Rows, e.Before = copyRows(e.Rows), copyRows(e.Before)
+		policies.apply(&e)
+
+		sampledEvent := SampledEvent{
+			SampledAt:  entry.at,
+			Type:       e.Type,
+			Schema:     e.Schema,
+			Table:      e.Table,
+			BinlogFile: e.BinlogFile,
+			BinlogPos:  e.BinlogPos,
+			GTID:       e.GTID,
+			Timestamp:  time.Unix(int64(e.Timestamp), 0),
+			Columns:    e.ColumnMeta(),
+			SQL:        []string{},
+		}
+		for _, row := range e.Rows {
+			sampledEvent.Rows = append(sampledEvent.Rows, jsonRow(e.Columns, row))
+		}
+		for _, row := range e.Before {
+			sampledEvent.Before = append(sampledEvent.Before, jsonRow(e.Columns, row))
+		}
+
+		r, err := router(e.Table)
+		var statements []statement
+		if err == nil {
+			statements, err = r.Build(e)
+		}
+		if err != nil {
+			sampledEvent.Error = err.Error()
+		}
+		for _, stmt := range statements {
+			sampledEvent.SQL = append(sampledEvent.SQL, renderStatement(m.cloudDB.Dialect, stmt))
+		}
+		events = append(events, sampledEvent)
+	}
+	return events, nil
+}
@@ -0,0 +1,230 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/metrics"
+)
+
+// The pool shrinks for a quiet queue only after this many intervals in a
+// row, so a lull between bursts doesn't cost the workers the burst needs.
+const scaleDownAfter = 3
+
+var errPoolStopped = errors.New("worker pool is stopped")
+
+// applyLatency averages how long batches took to apply between reads.
+type applyLatency struct {
+	mu    sync.Mutex
+	total time.Duration
+	count int
+}
+
+func (l *applyLatency) observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total += d
+	l.count++
+}
+
+// take returns the average since the last take, 0 if nothing was applied.
+func (l *applyLatency) take() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.count == 0 {
+		return 0
+	}
+	average := l.total / time.Duration(l.count)
+	l.total, l.count = 0, 0
+	return average
+}
+
+// scale asks the dispatcher to resize the pool every scaling interval, by
+// how full the event queue is and how long batches take, until dispatch
+// ends.
+func (p *WorkerPool) scale() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.scaling.GetInterval())
+	defer ticker.Stop()
+
+	quiet := 0
+	for {
+		select {
+		case <-p.dispatched:
+			return
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var utilization float64
+		events := p.queue.Events()
+		if capacity := cap(events); capacity > 0 {
+			utilization = float64(len(events)) / float64(capacity)
+		}
+		workers := int(p.size.Load())
+		var target int
+		target, quiet = p.scaleTarget(workers, utilization, p.latency.take(), quiet)
+		if target == workers {
+			continue
+		}
+		select {
+		case p.resize <- target:
+		default:
+			// The last resize is still waiting for the workers
+		}
+	}
+}
+
+// scaleTarget is how many workers to run, and the quiet intervals so far,
+// given the queue's utilization and the average apply latency.
+func (p *WorkerPool) scaleTarget(workers int, utilization float64, latency time.Duration, quiet int) (int, int) {
+	switch {
+	case latency > p.scaling.GetMaxApplyLatency():
+		// More writers would only add to a saturated target's load
+		return max(workers-1, p.minWorkers), 0
+	case utilization >= p.scaling.GetScaleUpUtilization():
+		return min(workers+max(workers/2, 1), p.maxWorkers), 0
+	case utilization <= p.scaling.GetScaleDownUtilization():
+		quiet++
+		if quiet < scaleDownAfter {
+			return workers, quiet
+		}
+		return max(workers-1, p.minWorkers), 0
+	}
+	return workers, 0
+}
+
+// resizeTo runs workers workers, once the current ones have applied what
+// was dispatched to them: with another count tables move to other workers,
+// and each table's changes must still be applied in order. Only dispatch
+// calls it.
+func (p *WorkerPool) resizeTo(workers int) bool {
+	if !p.drain() {
+		return false
+	}
+
+	from := len(p.workers)
+	for len(p.workers) > workers {
+		last := p.workers[len(p.workers)-1]
+		close(last.items)
+		p.workers = p.workers[:len(p.workers)-1]
+	}
+	for len(p.workers) < workers {
+		w := newWorker(len(p.workers), p)
+		p.workers = append(p.workers, w)
+		p.wg.Add(1)
+		go w.run()
+	}
+	p.size.Store(int32(workers))
+	metrics.Workers.Set(float64(workers))
+
+	direction := "up"
+	if workers < from {
+		direction = "down"
+	}
+	metrics.WorkerScaling.WithLabelValues(direction).Inc()
+	logger.Log.Info("Resized worker pool", zap.String("run_id", p.run.id), zap.Int("from", from), zap.Int("to", workers))
+	return true
+}
+
+// drain waits for the workers to apply what was dispatched to them. Only
+// dispatch calls it.
+func (p *WorkerPool) drain() bool {
+	acks := make(chan struct{}, len(p.workers))
+	for _, w := range p.workers {
+		select {
+		case w.items <- workItem{barrier: acks}:
+		case <-p.ctx.Done():
+			return false
+		}
+	}
+	for range p.workers {
+		select {
+		case <-acks:
+		case <-p.ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// poolChange changes the pool's settings while it runs; zero fields keep
+// theirs. done is closed once it is applied.
+type poolChange struct {
+	workers       int
+	batchSize     int
+	flushInterval time.Duration
+	done          chan struct{}
+}
+
+// Reconfigure applies change once the workers have applied what was
+// dispatched to them, so no event is lost or reordered. With scaling on,
+// the worker count is kept within the scaling bounds and scaling carries
+// on from it.
+func (p *WorkerPool) Reconfigure(ctx context.Context, change poolChange) error {
+	change.done = make(chan struct{})
+	select {
+	case p.reconfigure <- change:
+	case <-p.dispatched:
+		return errPoolStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-change.done:
+		return nil
+	case <-ctx.Done():
+		// Applied all the same once the workers are drained
+		return ctx.Err()
+	}
+}
+
+// reconfigureTo applies change. A new batch size or flush interval
+// replaces every worker, as workers keep theirs; a new count alone resizes
+// the pool. Only dispatch calls it.
+func (p *WorkerPool) reconfigureTo(change poolChange) bool {
+	workers := len(p.workers)
+	if change.workers > 0 {
+		workers = change.workers
+		if p.scaling.Enabled {
+			workers = min(max(workers, p.minWorkers), p.maxWorkers)
+		}
+	}
+	batchSize, flushInterval := p.batchSize, p.flushInterval
+	if change.batchSize > 0 {
+		batchSize = change.batchSize
+	}
+	if change.flushInterval > 0 {
+		flushInterval = change.flushInterval
+	}
+	if batchSize == p.batchSize && flushInterval == p.flushInterval {
+		if workers == len(p.workers) {
+			return true
+		}
+		return p.resizeTo(workers)
+	}
+
+	if !p.drain() {
+		return false
+	}
+	for _, w := range p.workers {
+		close(w.items)
+	}
+	p.batchSize, p.flushInterval = batchSize, flushInterval
+	p.workers = make([]*Worker, workers)
+	for i := range p.workers {
+		p.workers[i] = newWorker(i, p)
+		p.wg.Add(1)
+		go p.workers[i].run()
+	}
+	p.size.Store(int32(workers))
+	metrics.Workers.Set(float64(workers))
+	logger.Log.Info("Rebuilt worker pool", zap.String("run_id", p.run.id), zap.Int("workers", workers), zap.Int("batch_size", batchSize), zap.Duration("flush_interval", flushInterval))
+	return true
+}
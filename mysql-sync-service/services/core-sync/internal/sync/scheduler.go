@@ -1,18 +1,90 @@
 package sync
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/robfig/cron/v3"
 	"go.uber.org/zap"
-	
+
 	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/ids"
 	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/store"
 )
 
+// settingSchedulerInterval holds a schedule changed through the API; it
+// takes precedence over config.yaml.
+const settingSchedulerInterval = "scheduler.interval"
+
+// ErrInvalidSchedule is returned for cron expressions that do not parse.
+var ErrInvalidSchedule = errors.New("invalid cron schedule")
+
+// Outcomes of a scheduler-initiated run
+const (
+	OutcomeStarted        = "started"
+	OutcomeSkipped        = "skipped"
+	OutcomeAlreadyRunning = "already_running"
+	OutcomeFailed         = "failed"
+)
+
+// ScheduledRun is what happened the last time the scheduler fired.
+type ScheduledRun struct {
+	Job     string    `json:"job,omitempty"` // the named job, if one fired
+	Trigger string    `json:"trigger"`
+	Time    time.Time `json:"time"`
+	Outcome string    `json:"outcome"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+// Jobs the scheduler runs
+const (
+	JobSync      = "sync"
+	JobResync    = "resync"
+	JobRetention = "retention"
+	JobBlackout  = "blackout" // pauses and resumes runs for blackout windows
+)
+
+// ScheduleEntry is an active cron entry.
+type ScheduleEntry struct {
+	ID       int           `json:"id"`
+	Name     string        `json:"name,omitempty"` // set for named jobs
+	Job      string        `json:"job"`
+	Tables   []string      `json:"tables,omitempty"`
+	Schedule string        `json:"schedule"`
+	NextRun  time.Time     `json:"next_run"`
+	PrevRun  *time.Time    `json:"prev_run,omitempty"`
+	LastRun  *ScheduledRun `json:"last_run,omitempty"` // of a named job
+}
+
+// SchedulerStatus describes the schedule for the API.
+type SchedulerStatus struct {
+	Enabled  bool            `json:"enabled"`
+	Interval string          `json:"interval"`
+	Entries  []ScheduleEntry `json:"entries"`
+	LastRun  *ScheduledRun   `json:"last_run,omitempty"`
+	Blackout *BlackoutStatus `json:"blackout,omitempty"` // the window in effect
+}
+
 type Scheduler struct {
 	cfg     config.SchedulerConfig
 	manager *Manager
 	cron    *cron.Cron
 	entryID cron.EntryID
+	mu      sync.Mutex
+	lastRun *ScheduledRun
+
+	retentionID cron.EntryID           // 0 if nothing is ever purged
+	jobs        []*namedJob            // in config order
+	overrides   map[string]jobOverride // by job name
+
+	blackouts   []blackout
+	blackoutID  cron.EntryID // 0 if no window pauses runs
+	blackoutRun string       // the run paused for a blackout window
 }
 
 func NewScheduler(cfg config.SchedulerConfig, manager *Manager) *Scheduler {
@@ -24,24 +96,206 @@ func NewScheduler(cfg config.SchedulerConfig, manager *Manager) *Scheduler {
 }
 
 func (s *Scheduler) Start() {
+	s.loadInterval()
+
+	// The cron runs even with a bad schedule so a fixed one can be set via
+	// the API, and while syncs aren't scheduled for retention and blackouts
+	defer s.cron.Start()
+	s.scheduleRetention()
+	s.loadBlackouts()
+	s.loadJobs()
+
 	if !s.cfg.Enabled {
 		logger.Log.Info("Scheduler is disabled")
 		return
 	}
-	
-	logger.Log.Info("Starting scheduler", zap.String("interval", s.cfg.Interval))
-	
-	id, err := s.cron.AddFunc(s.cfg.Interval, func() {
-		s.triggerSync()
-	})
-	
+
+	logger.Log.Info("Starting scheduler", zap.String("interval", s.cfg.Interval), zap.Int("jobs", len(s.jobs)))
+	s.mu.Lock()
+	for _, job := range s.jobs {
+		s.scheduleJob(job)
+	}
+	s.mu.Unlock()
+	if s.cfg.Interval == "" && len(s.cfg.Jobs) > 0 {
+		return
+	}
+
+	schedule, err := cron.ParseStandard(s.cfg.Interval)
 	if err != nil {
 		logger.Log.Error("Failed to schedule job", zap.Error(err))
 		return
 	}
-	
-	s.entryID = id
-	s.cron.Start()
+
+	s.mu.Lock()
+	s.entryID = s.cron.Schedule(schedule, cron.FuncJob(s.triggerSync))
+	s.mu.Unlock()
+
+	if s.cfg.CatchUp {
+		s.catchUp(schedule)
+	}
+}
+
+// scheduleRetention adds the retention purge to the cron, if anything is
+// to be purged.
+func (s *Scheduler) scheduleRetention() {
+	cfg := s.manager.cfg.Retention
+	if !cfg.Enabled() {
+		return
+	}
+	schedule, err := cron.ParseStandard(cfg.GetSchedule())
+	if err != nil {
+		logger.Log.Error("Failed to schedule retention", zap.String("schedule", cfg.GetSchedule()), zap.Error(err))
+		return
+	}
+	s.mu.Lock()
+	s.retentionID = s.cron.Schedule(schedule, cron.FuncJob(func() { s.manager.applyRetention(cfg) }))
+	s.mu.Unlock()
+	logger.Log.Info("Scheduled retention", zap.String("schedule", cfg.GetSchedule()))
+}
+
+// loadInterval applies a schedule persisted by SetInterval.
+func (s *Scheduler) loadInterval() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	interval, err := s.manager.store.GetSetting(ctx, settingSchedulerInterval)
+	if err != nil {
+		logger.Log.Warn("Failed to load persisted schedule, using config", zap.Error(err))
+		return
+	}
+	if interval != "" && interval != s.cfg.Interval {
+		logger.Log.Info("Using persisted schedule", zap.String("interval", interval), zap.String("config_interval", s.cfg.Interval))
+		s.cfg.Interval = interval
+	}
+}
+
+// SetInterval replaces the schedule and persists it so it survives restarts.
+func (s *Scheduler) SetInterval(ctx context.Context, interval string) error {
+	schedule, err := cron.ParseStandard(interval)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	if err := s.manager.store.SetSetting(ctx, settingSchedulerInterval, interval); err != nil {
+		return fmt.Errorf("failed to persist schedule: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.cfg.Interval
+	s.cfg.Interval = interval
+	if s.cfg.Enabled {
+		if s.entryID != 0 {
+			s.cron.Remove(s.entryID)
+		}
+		s.entryID = s.cron.Schedule(schedule, cron.FuncJob(s.triggerSync))
+	}
+
+	logger.Log.Info("Schedule updated", zap.String("interval", interval), zap.String("previous", previous))
+	return nil
+}
+
+// Status lists the active cron entries and the outcome of the last run.
+func (s *Scheduler) Status() SchedulerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := SchedulerStatus{
+		Enabled:  s.cfg.Enabled,
+		Interval: s.cfg.Interval,
+		Entries:  []ScheduleEntry{},
+	}
+	for _, entry := range s.cron.Entries() {
+		scheduleEntry := ScheduleEntry{
+			ID:       int(entry.ID),
+			Job:      JobSync,
+			Schedule: s.cfg.Interval,
+			NextRun:  entry.Next,
+		}
+		switch entry.ID {
+		case s.retentionID:
+			scheduleEntry.Job = JobRetention
+			scheduleEntry.Schedule = s.manager.cfg.Retention.GetSchedule()
+		case s.blackoutID:
+			scheduleEntry.Job = JobBlackout
+			scheduleEntry.Schedule = "* * * * *"
+		}
+		for _, job := range s.jobs {
+			if job.entryID != entry.ID {
+				continue
+			}
+			scheduleEntry.Name = job.Name
+			scheduleEntry.Job = job.GetJob()
+			scheduleEntry.Tables = job.Tables
+			scheduleEntry.Schedule = job.Schedule
+			if job.lastRun != nil {
+				lastRun := *job.lastRun
+				scheduleEntry.LastRun = &lastRun
+			}
+		}
+		if !entry.Prev.IsZero() {
+			prev := entry.Prev
+			scheduleEntry.PrevRun = &prev
+		}
+		status.Entries = append(status.Entries, scheduleEntry)
+	}
+	if s.lastRun != nil {
+		lastRun := *s.lastRun
+		status.LastRun = &lastRun
+	}
+	status.Blackout = s.blackoutStatus()
+	return status
+}
+
+// recordOutcome records what happened when the interval, or the named
+// job, fired.
+func (s *Scheduler) recordOutcome(job, trigger, outcome, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRun = &ScheduledRun{Job: job, Trigger: trigger, Time: time.Now(), Outcome: outcome, Reason: reason}
+	if named := s.job(job); named != nil {
+		named.lastRun = s.lastRun
+	}
+}
+
+// catchUp runs a single sync when the last recorded run predates a window
+// that has already passed, i.e. the process was down when it was due.
+func (s *Scheduler) catchUp(schedule cron.Schedule) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	history, err := s.manager.store.GetSyncHistory(ctx, nil, 1, 0)
+	if err != nil {
+		logger.Log.Warn("Failed to read sync history, skipping catch-up", zap.Error(err))
+		return
+	}
+	if len(history) == 0 {
+		return
+	}
+
+	now := time.Now()
+	lastRun := history[0].StartedAt
+	missed := schedule.Next(lastRun)
+	if missed.After(now) {
+		return
+	}
+	for next := schedule.Next(missed); !next.After(now); next = schedule.Next(next) {
+		missed = next
+	}
+
+	if maxStaleness := s.cfg.GetCatchUpMaxStaleness(); maxStaleness > 0 && now.Sub(missed) > maxStaleness {
+		logger.Log.Info("Missed window is too old to catch up",
+			zap.Time("missed_window", missed),
+			zap.Duration("max_staleness", maxStaleness),
+		)
+		return
+	}
+
+	logger.Log.Info("Running catch-up sync for missed window",
+		zap.Time("missed_window", missed),
+		zap.Time("last_run", lastRun),
+	)
+	s.runSync("", TriggerCatchUp, nil)
 }
 
 func (s *Scheduler) Stop() {
@@ -53,14 +307,99 @@ func (s *Scheduler) Stop() {
 
 func (s *Scheduler) triggerSync() {
 	logger.Log.Info("Triggering scheduled sync")
-	
+	s.runSync("", TriggerScheduled, nil)
+}
+
+// runSync starts a run of tables, every table if nil, for the named job or
+// the interval.
+func (s *Scheduler) runSync(job, trigger string, tables []string) {
 	status := s.manager.GetStatus()
-	if status == "running" {
-		logger.Log.Info("Sync already running, skipping scheduled run")
+	if status != "idle" {
+		logger.Log.Info("Sync already running, skipping scheduled run", zap.String("job", job), zap.String("status", status))
+		s.recordOutcome(job, trigger, OutcomeAlreadyRunning, "")
 		return
 	}
-	
-	if err := s.manager.Start(); err != nil {
-		logger.Log.Error("Failed to start scheduled sync", zap.Error(err))
+
+	reason := s.skipReason()
+	if reason == "" && trigger != TriggerManual {
+		reason = s.blackoutReason()
+	}
+	if reason != "" {
+		s.recordSkip(trigger, reason)
+		s.recordOutcome(job, trigger, OutcomeSkipped, reason)
+		return
 	}
+
+	if err := s.manager.start(trigger, tables, runOptions{}); err != nil {
+		logger.Log.Error("Failed to start scheduled sync", zap.String("job", job), zap.Error(err))
+		s.recordOutcome(job, trigger, OutcomeFailed, err.Error())
+		return
+	}
+	s.recordOutcome(job, trigger, OutcomeStarted, "")
+}
+
+// skipReason explains why the system is in no state for another run, or
+// returns "" when it is.
+func (s *Scheduler) skipReason() string {
+	if leader := s.manager.Leadership(); !leader.Leader {
+		holder := leader.Holder
+		if holder == "" {
+			holder = "another instance"
+		}
+		return fmt.Sprintf("standing by, %s leads", holder)
+	}
+
+	if health := s.manager.Health(); health.State == HealthFailing {
+		return fmt.Sprintf("sync is failing: %s", health.Reason)
+	}
+
+	if runID := s.manager.RunID(); runID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		count, err := s.manager.store.CountDeadLetters(ctx, runID)
+		if err != nil {
+			logger.Log.Warn("Failed to count dead letters", zap.String("run_id", runID), zap.Error(err))
+		} else if count > 0 {
+			return fmt.Sprintf("previous run %s left %d dead letters", runID, count)
+		}
+	}
+
+	maxLag := s.cfg.GetMaxLag()
+	if maxLag <= 0 {
+		maxLag = s.manager.GetLagThreshold()
+	}
+	if maxLag > 0 {
+		for _, lag := range s.manager.GetTableLag() {
+			if lag.LagSeconds > maxLag.Seconds() {
+				return fmt.Sprintf("table %s is %.0fs behind (max %s)", lag.Table, lag.LagSeconds, maxLag)
+			}
+		}
+	}
+
+	return ""
+}
+
+// recordSkip keeps skipped runs in the sync history so gaps are explained.
+func (s *Scheduler) recordSkip(trigger, reason string) {
+	logger.Log.Warn("Skipping scheduled sync", zap.String("trigger", trigger), zap.String("reason", reason))
+
+	now := time.Now()
+	history := &store.SyncHistory{
+		ID:           ids.New(),
+		StartedAt:    now,
+		CompletedAt:  sql.NullTime{Time: now, Valid: true},
+		Direction:    s.manager.cfg.Sync.Mode,
+		Status:       "skipped",
+		ErrorMessage: sql.NullString{String: reason, Valid: true},
+		Trigger:      trigger,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.manager.stateWrites.CreateSyncHistory(ctx, history); err != nil {
+		logger.Log.Error("Failed to record skipped sync", zap.Error(err))
+	}
+
+	s.manager.events.publish(SyncEvent{Type: EventRunSkipped, RunID: history.ID, Status: history.Status, Error: reason})
 }
@@ -0,0 +1,131 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/store"
+)
+
+// schemaColumn is one column of a stored schema snapshot.
+type schemaColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// trackedSchema is the layout last seen for a table and its version.
+type trackedSchema struct {
+	columns []string
+	types   []string
+	keys    []string
+	version int
+}
+
+func (s *trackedSchema) matches(e *BinlogEvent) bool {
+	return equalStrings(s.columns, e.Columns) && equalStrings(s.types, e.ColumnTypes) && equalStrings(s.keys, e.KeyColumns)
+}
+
+// schemaTracker stores a new schema version whenever the layout of a table's
+// events changes, and stamps each event with the version it was read under.
+// It outlives runs; a table's latest version is loaded from the store the
+// first time the table is seen.
+type schemaTracker struct {
+	store  store.Store
+	mu     sync.Mutex
+	latest map[string]*trackedSchema
+}
+
+func newSchemaTracker(store store.Store) *schemaTracker {
+	return &schemaTracker{store: store, latest: make(map[string]*trackedSchema)}
+}
+
+// Stamp sets e.SchemaVersion, or that of each member of a group. Events
+// without column information keep version 0.
+func (t *schemaTracker) Stamp(ctx context.Context, e *BinlogEvent) {
+	if e.Type == Group {
+		for i := range e.Members {
+			t.Stamp(ctx, &e.Members[i])
+		}
+		return
+	}
+	if len(e.Columns) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if current, ok := t.latest[e.Table]; ok && current.matches(e) {
+		e.SchemaVersion = current.version
+		return
+	}
+
+	version, err := t.record(ctx, e)
+	if err != nil {
+		logger.Log.Warn("Failed to record schema version", zap.String("table", e.Table), zap.Error(err))
+		return
+	}
+	t.latest[e.Table] = &trackedSchema{columns: e.Columns, types: e.ColumnTypes, keys: e.KeyColumns, version: version}
+	e.SchemaVersion = version
+}
+
+// record returns the version matching e's layout, storing a new one unless
+// the latest stored version already matches.
+func (t *schemaTracker) record(ctx context.Context, e *BinlogEvent) (int, error) {
+	columns := make([]schemaColumn, len(e.Columns))
+	for i, name := range e.Columns {
+		columns[i] = schemaColumn{Name: name}
+		if i < len(e.ColumnTypes) {
+			columns[i].Type = e.ColumnTypes[i]
+		}
+	}
+	columnsJSON, err := json.Marshal(columns)
+	if err != nil {
+		return 0, err
+	}
+	keysJSON, err := json.Marshal(e.KeyColumns)
+	if err != nil {
+		return 0, err
+	}
+	checksum := fmt.Sprintf("%x", sha256.Sum256(append(append(columnsJSON, '|'), keysJSON...)))
+
+	latest, err := t.store.GetLatestSchemaVersion(ctx, e.Table)
+	if err != nil {
+		return 0, err
+	}
+	if latest != nil && latest.Checksum == checksum {
+		return latest.Version, nil
+	}
+
+	version := &store.SchemaVersion{
+		TableName:  e.Table,
+		Columns:    columnsJSON,
+		PrimaryKey: keysJSON,
+		Checksum:   checksum,
+		CreatedAt:  time.Now(),
+	}
+	if err := t.store.CreateSchemaVersion(ctx, version); err != nil {
+		return 0, err
+	}
+	logger.Log.Info("Recorded table schema version", zap.String("table", e.Table), zap.Int("version", version.Version))
+	return version.Version, nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
+	"mysql-sync-service/internal/logger"
+)
+
+// ErrServerIDInUse is returned when the configured server ID is claimed by
+// another service instance reading the same source.
+var ErrServerIDInUse = errors.New("server id is claimed by another instance")
+
+const (
+	// minAutoServerID keeps assigned IDs clear of the small ones usually
+	// given to servers by hand.
+	minAutoServerID = 1 << 16
+	// How many IDs are tried before giving up on a claim
+	maxServerIDClaims = 1000
+	serverIDTimeout   = 10 * time.Second
+)
+
+// replicaServerID is the server ID the binlog listener registers with,
+// resolved on the first run and kept, so reconnects and later runs replace
+// the same replica rather than leaving stale ones behind. m.mu must be held.
+//
+// IDs are claimed in the state store per source, so instances sharing a
+// source, e.g. a fleet syncing one database to several targets, never
+// register with the same one even while one of them is disconnected. An
+// instance keeps its claim across restarts. Without the state store the
+// ID is only checked against the replicas connected to the source.
+func (m *Manager) replicaServerID() (uint32, error) {
+	if m.serverID != 0 {
+		return m.serverID, nil
+	}
+
+	local := m.cfg.Databases.Local
+	used, err := usedServerIDs(local)
+	if err != nil {
+		// Without the check the ID may clash; the source then drops
+		// whichever replica connected first
+		logger.Log.Warn("Failed to list the source's replicas, server id not checked for collisions", zap.Error(err))
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read hostname for server id: %w", err)
+	}
+	cloud := m.cfg.Databases.Cloud
+	source := fmt.Sprintf("%s:%d", local.Host, local.Port)
+	owner := fmt.Sprintf("%s|%s:%d/%s", hostname, cloud.Host, cloud.Port, cloud.Database)
+	ctx, cancel := context.WithTimeout(m.ctx, serverIDTimeout)
+	defer cancel()
+
+	if local.ServerID != 0 {
+		holder, err := m.store.ClaimServerID(ctx, source, local.ServerID, owner)
+		switch {
+		case err != nil:
+			logger.Log.Warn("Failed to claim the server id in the state store", zap.Uint32("server_id", local.ServerID), zap.Error(err))
+		case holder != owner:
+			return 0, fmt.Errorf("%w: %d on %s is held by %s", ErrServerIDInUse, local.ServerID, source, holder)
+		}
+		// Possibly by this service's own replica, until the source
+		// notices it disconnected
+		if used[local.ServerID] {
+			logger.Log.Warn("Configured server id is in use on the source", zap.Uint32("server_id", local.ServerID), zap.String("host", local.Host))
+		}
+		m.serverID = local.ServerID
+		return m.serverID, nil
+	}
+
+	claimed, err := m.store.GetServerID(ctx, source, owner)
+	if err != nil {
+		logger.Log.Warn("Failed to read the claimed server id from the state store", zap.Error(err))
+	}
+	if claimed != 0 {
+		// The source may still list this instance's last connection
+		logger.Log.Info("Reusing claimed binlog server id", zap.Uint32("server_id", claimed), zap.String("hostname", hostname))
+		m.serverID = claimed
+		return claimed, nil
+	}
+
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s|%s:%d/%s|%s:%d/%s", hostname, local.Host, local.Port, local.Database, cloud.Host, cloud.Port, cloud.Database)
+	span := uint64(math.MaxUint32 - minAutoServerID + 1)
+	id := uint32(minAutoServerID + uint64(h.Sum32())%span)
+	next := func() {
+		if id++; id < minAutoServerID {
+			id = minAutoServerID
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		if attempt == maxServerIDClaims {
+			return 0, fmt.Errorf("no free server id found on %s after %d tries", source, maxServerIDClaims)
+		}
+		if used[id] {
+			next()
+			continue
+		}
+		holder, err := m.store.ClaimServerID(ctx, source, id, owner)
+		if err != nil {
+			logger.Log.Warn("Failed to claim the server id in the state store, checked against the source only", zap.Uint32("server_id", id), zap.Error(err))
+			break
+		}
+		if holder == owner {
+			break
+		}
+		next()
+	}
+	logger.Log.Info("Assigned binlog server id", zap.Uint32("server_id", id), zap.String("hostname", hostname))
+	m.serverID = id
+	return id, nil
+}
+
+// usedServerIDs lists the server IDs of the source and of the replicas
+// registered with it.
+func usedServerIDs(cfg config.DatabaseConnection) (map[uint32]bool, error) {
+	tlsConfig, err := database.BuildTLSConfig(cfg.TLS, cfg.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build tls config: %w", err)
+	}
+	conn, err := client.Connect(fmt.Sprintf("%s:%d", cfg.Host, cfg.Port), cfg.ReplicationUser, cfg.ReplicationPassword, "", func(c *client.Conn) {
+		if tlsConfig != nil {
+			c.SetTLSConfig(tlsConfig)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	used := make(map[uint32]bool)
+	result, err := conn.Execute("SELECT @@server_id")
+	if err != nil {
+		return nil, err
+	}
+	if id, err := result.GetUint(0, 0); err == nil {
+		used[uint32(id)] = true
+	}
+
+	// SHOW REPLICAS replaced SHOW SLAVE HOSTS in MySQL 8.0.22
+	result, err = conn.Execute("SHOW REPLICAS")
+	if err != nil {
+		if result, err = conn.Execute("SHOW SLAVE HOSTS"); err != nil {
+			return used, err
+		}
+	}
+	for row := 0; row < result.RowNumber(); row++ {
+		if id, err := result.GetUint(row, 0); err == nil {
+			used[uint32(id)] = true
+		}
+	}
+	return used, nil
+}
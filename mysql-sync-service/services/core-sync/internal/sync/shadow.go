@@ -0,0 +1,227 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
+	"mysql-sync-service/internal/logger"
+)
+
+// Suffixes of the tables a shadow load works with
+const (
+	shadowSuffix = "__sync_new"
+	oldSuffix    = "__sync_old"
+)
+
+const shadowDropTimeout = 30 * time.Second
+
+// shadowTables are empty copies of target tables, loaded while readers go
+// on seeing the targets and then swapped in with one RENAME TABLE, so they
+// only ever see complete data. MySQL targets only.
+type shadowTables struct {
+	db      *database.Database
+	shadows map[string]string // by target table
+}
+
+// shadowRouter routes tableConfig's rows to the shadows of its targets,
+// adding them to shadows.
+func shadowRouter(tableConfig config.TableConfig, direction string, db *database.Database, shadows map[string]string) (*tableRouter, error) {
+	if len(tableConfig.Routes) == 0 {
+		target := tableConfig.GetTargetName()
+		shadows[target] = target + shadowSuffix
+		tableConfig.TargetName = shadows[target]
+	} else {
+		tableConfig.Routes = append([]config.RouteConfig(nil), tableConfig.Routes...)
+		for i := range tableConfig.Routes {
+			target := tableConfig.Routes[i].Target
+			shadows[target] = target + shadowSuffix
+			tableConfig.Routes[i].Target = shadows[target]
+		}
+	}
+	return newTableRouter(tableConfig, direction, db)
+}
+
+// checkShadowable reports why targets can't be loaded into shadow tables:
+// a target with foreign keys would lose them, since CREATE TABLE ... LIKE
+// copies none, and the foreign keys on a renamed target follow it away.
+func checkShadowable(ctx context.Context, db *database.Database, targets map[string]string) error {
+	if db.Dialect.Name() != database.DriverMySQL {
+		return fmt.Errorf("shadow tables need a mysql target")
+	}
+	references, err := db.ForeignKeys(ctx)
+	if err != nil {
+		return err
+	}
+	for target := range targets {
+		for child, parents := range references {
+			if strings.EqualFold(child, target) {
+				return fmt.Errorf("%s has foreign keys, which shadow tables don't get", target)
+			}
+			for _, parent := range parents {
+				if strings.EqualFold(parent, target) {
+					return fmt.Errorf("%s is referenced by foreign keys of %s", target, child)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// createShadowTables creates an empty shadow of each target, dropping any
+// left over by a load that didn't get to clean up.
+func createShadowTables(ctx context.Context, db *database.Database, shadows map[string]string) (*shadowTables, error) {
+	s := &shadowTables{db: db, shadows: shadows}
+	s.drop(ctx, shadows)
+	q := db.Dialect.QuoteIdentifier
+	for target, shadow := range shadows {
+		if _, err := db.DB.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s LIKE %s", q(shadow), q(target))); err != nil {
+			s.Drop(ctx)
+			return nil, fmt.Errorf("failed to create shadow table %s: %w", shadow, err)
+		}
+	}
+	return s, nil
+}
+
+// Swap puts every shadow in place of its target in one RENAME TABLE, which
+// is atomic across them, then drops the old tables.
+func (s *shadowTables) Swap(ctx context.Context, registry *schemaRegistry) error {
+	q := s.db.Dialect.QuoteIdentifier
+	old := make(map[string]string, len(s.shadows))
+	var renames []string
+	for target, shadow := range s.shadows {
+		old[target] = target + oldSuffix
+		renames = append(renames, fmt.Sprintf("%s TO %s, %s TO %s", q(target), q(old[target]), q(shadow), q(target)))
+	}
+	s.drop(ctx, old)
+	if _, err := s.db.DB.ExecContext(ctx, "RENAME TABLE "+strings.Join(renames, ", ")); err != nil {
+		return fmt.Errorf("failed to swap in shadow tables: %w", err)
+	}
+	s.shadows = nil
+	for target := range old {
+		registry.InvalidateTarget(target)
+	}
+	s.drop(ctx, old)
+	return nil
+}
+
+// Drop drops the shadows not swapped in.
+func (s *shadowTables) Drop(ctx context.Context) {
+	if s != nil {
+		s.drop(ctx, s.shadows)
+	}
+}
+
+// drop drops the values of tables, logging failures.
+func (s *shadowTables) drop(ctx context.Context, tables map[string]string) {
+	for _, table := range tables {
+		if _, err := s.db.DB.ExecContext(ctx, "DROP TABLE IF EXISTS "+s.db.Dialect.QuoteIdentifier(table)); err != nil {
+			logger.Log.Warn("Failed to drop table", zap.String("table", table), zap.Error(err))
+		}
+	}
+}
+
+// Snapshot strategies for SyncConfig.Snapshot and BootstrapOptions
+const (
+	SnapshotInPlace = "in_place"
+	SnapshotShadow  = "shadow"
+)
+
+// snapshotShadows load a dump into shadow tables: while it loads, the MySQL
+// sink writes its tables' rows to their shadows, which are swapped in once
+// the rows are applied and before changes are captured.
+type snapshotShadows struct {
+	db       *database.Database
+	registry *schemaRegistry
+	targets  map[string]string
+	routers  map[string]*tableRouter // by source table
+
+	mu      sync.RWMutex
+	tables  *shadowTables
+	loading bool
+}
+
+func newSnapshotShadows(ctx context.Context, tables []config.TableConfig, db *database.Database, direction string, registry *schemaRegistry) (*snapshotShadows, error) {
+	s := &snapshotShadows{db: db, registry: registry, targets: make(map[string]string), routers: make(map[string]*tableRouter, len(tables))}
+	for _, tableConfig := range tables {
+		if tableConfig.PrimaryKey == "" {
+			key, err := registry.sourceKey(ctx, tableConfig.Name)
+			if err != nil {
+				return nil, fmt.Errorf("table %s: failed to read source keys: %w", tableConfig.Name, err)
+			}
+			tableConfig.PrimaryKey = key
+		}
+		router, err := shadowRouter(tableConfig, direction, db, s.targets)
+		if err != nil {
+			return nil, err
+		}
+		s.routers[tableConfig.Name] = router
+	}
+	if err := checkShadowable(ctx, db, s.targets); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// create creates the shadow tables and sends the rows there.
+func (s *snapshotShadows) create(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	tables, err := createShadowTables(ctx, s.db, s.targets)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tables, s.loading = tables, true
+	logger.Log.Info("Loading dump into shadow tables", zap.Int("tables", len(s.targets)))
+	return nil
+}
+
+// router is the shadow router of table while the dump loads, or nil.
+func (s *snapshotShadows) router(table string) *tableRouter {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.loading {
+		return nil
+	}
+	return s.routers[table]
+}
+
+// swap puts the loaded shadows in place of the targets.
+func (s *snapshotShadows) swap(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loading = false
+	if err := s.tables.Swap(ctx, s.registry); err != nil {
+		return err
+	}
+	logger.Log.Info("Swapped in shadow tables", zap.Int("tables", len(s.targets)))
+	return nil
+}
+
+// drop drops the shadows of a load that didn't finish.
+func (s *snapshotShadows) drop() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loading = false
+	ctx, cancel := context.WithTimeout(context.Background(), shadowDropTimeout)
+	defer cancel()
+	s.tables.Drop(ctx)
+}
@@ -0,0 +1,241 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
+	"mysql-sync-service/internal/logger"
+)
+
+// Sink types for SyncConfig.Sinks
+const (
+	SinkMySQL = "mysql"
+	SinkKafka = "kafka"
+)
+
+// Sink is an output for replicated changes. Apply receives the events of one
+// table, or of one sync group's tables, in binlog order and must apply all
+// of them or return an error.
+type Sink interface {
+	Name() string
+	Apply(ctx context.Context, table string, events []BinlogEvent) error
+	Close() error
+}
+
+// newSinks builds the configured sinks, defaulting to the MySQL target. An
+// observing run has the observer as its only sink.
+func newSinks(cfg config.SyncConfig, targetDB *database.Database, run *syncRun) ([]Sink, error) {
+	if run.observed != nil {
+		sink, err := newObserverSink(cfg.Tables, targetDB, run.observed, run.id)
+		if err != nil {
+			return nil, err
+		}
+		return []Sink{sink}, nil
+	}
+
+	sinkConfigs := cfg.Sinks
+	if len(sinkConfigs) == 0 {
+		sinkConfigs = []config.SinkConfig{{Type: SinkMySQL}}
+	}
+
+	var sinks []Sink
+	for _, sinkConfig := range sinkConfigs {
+		var (
+			sink Sink
+			err  error
+		)
+		switch sinkConfig.Type {
+		case SinkMySQL:
+			sink, err = newMySQLSink(cfg.Tables, targetDB, run, cfg.GetForeignKeys() == ForeignKeysDisable, cfg.Apply.UpsertUpdates)
+		case SinkKafka:
+			sink, err = newKafkaSink(sinkConfig, cfg.Tables)
+		default:
+			err = fmt.Errorf("unknown sink type %q", sinkConfig.Type)
+		}
+		if err != nil {
+			closeSinks(sinks)
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func closeSinks(sinks []Sink) {
+	for _, sink := range sinks {
+		sink.Close()
+	}
+}
+
+// mysqlSink applies events to the target database in one transaction per
+// batch. Despite the name it writes through the target's dialect, so a
+// Postgres cloud database works too.
+//
+// On MySQL, consecutive upserts into the same table are merged into
+// multi-row statements below the server's max_allowed_packet. Postgres
+// refuses an upsert that writes the same row twice, so there each event's
+// upserts run as built.
+type mysqlSink struct {
+	db                *database.Database
+	routers           map[string]*tableRouter
+	registry          *schemaRegistry
+	fkChecksOff       bool
+	upsertUpdates     bool
+	coalesce          bool
+	maxStatementBytes int64
+	replay            *replayState     // nil unless replaying
+	snapshot          *snapshotShadows // nil unless loading into shadows
+}
+
+func newMySQLSink(tables []config.TableConfig, db *database.Database, run *syncRun, fkChecksOff, upsertUpdates bool) (*mysqlSink, error) {
+	registry := run.registry
+	routers := make(map[string]*tableRouter, len(tables))
+	for _, tableConfig := range tables {
+		// Without a configured key, rows are matched on the source's own
+		// primary or unique key rather than on every column
+		if tableConfig.PrimaryKey == "" {
+			key, err := registry.sourceKey(context.Background(), tableConfig.Name)
+			if err != nil {
+				return nil, fmt.Errorf("table %s: failed to read source keys: %w", tableConfig.Name, err)
+			}
+			tableConfig.PrimaryKey = key
+		}
+
+		router, err := newTableRouter(tableConfig, run.direction, db)
+		if err != nil {
+			return nil, err
+		}
+		routers[tableConfig.Name] = router
+	}
+	if err := ensureCheckpointTable(context.Background(), db); err != nil {
+		return nil, err
+	}
+	sink := &mysqlSink{
+		db:                db,
+		routers:           routers,
+		registry:          registry,
+		fkChecksOff:       fkChecksOff,
+		upsertUpdates:     upsertUpdates,
+		coalesce:          db.Dialect.Name() == database.DriverMySQL,
+		maxStatementBytes: defaultMaxStatementBytes,
+		replay:            run.replay,
+		snapshot:          run.snapshot,
+	}
+	if sink.coalesce {
+		packet, err := db.MaxAllowedPacket(context.Background())
+		if err != nil {
+			logger.Log.Warn("Failed to read the target's max_allowed_packet, assuming the default", zap.Error(err))
+		} else if packet > 0 {
+			sink.maxStatementBytes = packet - packet/packetHeadroom
+		}
+	}
+	return sink, nil
+}
+
+func (s *mysqlSink) Name() string {
+	return SinkMySQL
+}
+
+func (s *mysqlSink) Apply(ctx context.Context, table string, events []BinlogEvent) error {
+	// Execute in transaction
+	execTx := s.db.ExecTx
+	if s.fkChecksOff {
+		execTx = s.db.ExecTxForeignKeyChecksOff
+	}
+	return execTx(ctx, func(tx *sql.Tx) error {
+		events, checkpoints, err := dedupEvents(ctx, tx, s.db.Dialect, events)
+		if err != nil {
+			return err
+		}
+		var pending []pendingStatement
+		for _, e := range events {
+			router, ok := s.routers[e.Table]
+			if !ok {
+				return fmt.Errorf("no table config for %s", e.Table)
+			}
+			if shadow := s.snapshot.router(e.Table); shadow != nil {
+				router = shadow
+			}
+			statements, err := s.build(router, e)
+			if err == nil && s.replay.upserts(e) {
+				// An update of a row lost on the target matches nothing;
+				// upserting the new row restores it
+				var restored []statement
+				restored, err = router.Build(upsertOf(e))
+				statements = append(statements, restored...)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to build statements at %s:%d: %w", e.BinlogFile, e.BinlogPos, err)
+			}
+			for _, stmt := range statements {
+				pending = append(pending, pendingStatement{stmt: stmt, event: e, router: router})
+			}
+		}
+		if s.coalesce {
+			pending = s.coalesceUpserts(pending)
+		}
+		for _, p := range pending {
+			var err error
+			if p.stmt.cacheable() {
+				_, err = s.db.Stmts.Exec(ctx, tx, p.stmt.stmtKey(), p.stmt.args...)
+			} else {
+				_, err = tx.ExecContext(ctx, p.stmt.query, p.stmt.args...)
+			}
+			if err != nil {
+				if database.IsUnknownColumn(err) {
+					for _, rt := range p.router.routes {
+						s.registry.InvalidateTarget(rt.builder.table)
+					}
+				}
+				err = fmt.Errorf("failed to apply %s at %s:%d: %w", p.event.Type, p.event.BinlogFile, p.event.BinlogPos, err)
+				if database.IsDuplicateKey(err) {
+					// Upserts overwrite rows with the same primary key, so
+					// the key taken is another unique one
+					return &uniqueKeyError{event: p.event, err: err}
+				}
+				return err
+			}
+		}
+		for _, e := range checkpoints {
+			if err := writeCheckpoint(ctx, tx, s.db.Dialect, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// build turns e into statements, upserting updated rows that keep their key
+// if apply.upsert_updates is on.
+func (s *mysqlSink) build(router *tableRouter, e BinlogEvent) ([]statement, error) {
+	if !s.upsertUpdates {
+		return router.Build(e)
+	}
+	parts, err := splitUpserts(e, router.upsertKey())
+	if err != nil {
+		return nil, err
+	}
+	var statements []statement
+	for _, part := range parts {
+		built, err := router.Build(part)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, built...)
+	}
+	return statements, nil
+}
+
+func (s *mysqlSink) Ping(ctx context.Context) error {
+	return s.db.DB.PingContext(ctx)
+}
+
+// Close is a no-op: the database belongs to the Manager.
+func (s *mysqlSink) Close() error {
+	return nil
+}
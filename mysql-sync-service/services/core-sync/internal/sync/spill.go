@@ -0,0 +1,630 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/metrics"
+)
+
+const (
+	defaultSegmentBytes = 64 << 20
+	segmentPattern      = "segment-*.spill"
+	cursorFile          = "cursor"
+)
+
+// spillQueue keeps events in memory while the workers keep up and appends
+// them to segment files once memory is full. Once anything is on disk, new
+// events follow it there so order is preserved; a pump feeds them back to
+// the workers as the budget frees up.
+//
+// A persistent queue leaves its segments behind on close, with a cursor
+// naming the first record not handed to the workers, and the next queue
+// opened on the dir drains them first. Events are read from the binlog in
+// order, so the segments are ordered by binlog position.
+type spillQueue struct {
+	events       chan BinlogEvent
+	budget       *byteBudget
+	dir          string
+	segmentBytes int64
+	maxDiskBytes int64
+	persist      bool
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	closed    bool
+	pending   int   // events on disk not yet handed to workers
+	diskBytes int64 // bytes of those events
+	writer    *os.File
+	writeSeq  int
+	writeSize int64
+	head      *spillHead    // the oldest pending record, if known
+	swapped   chan struct{} // closed when events is replaced
+
+	// Held for reading by the pump while it sends, so Resize only closes
+	// the old channel once the pump has moved on
+	sends sync.RWMutex
+
+	// Only touched by the pump goroutine, and by Close once it has exited
+	reader     *os.File
+	readSeq    int
+	readOffset int64 // in the read segment, past the last record read
+	held       int64 // size of the record read but not yet delivered
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newSpillQueue(cfg config.QueueConfig, capacity int, budget *byteBudget) (*spillQueue, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("disk queue needs a dir")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spill dir: %w", err)
+	}
+
+	segmentBytes := cfg.SegmentBytes
+	if segmentBytes <= 0 {
+		segmentBytes = defaultSegmentBytes
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &spillQueue{
+		events:       make(chan BinlogEvent, capacity),
+		budget:       budget,
+		dir:          cfg.Dir,
+		segmentBytes: segmentBytes,
+		maxDiskBytes: cfg.MaxDiskBytes,
+		persist:      cfg.Persist,
+		swapped:      make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	if q.persist {
+		q.recoverBacklog()
+	} else {
+		// Spilled events are transient: a new run re-reads them from the binlog
+		if stale := q.removeSegments(); stale > 0 {
+			logger.Log.Info("Discarded stale spill segments", zap.String("dir", cfg.Dir), zap.Int("segments", stale))
+		}
+	}
+	metrics.QueueSpilledBytes.Set(float64(q.diskBytes))
+
+	go q.pump()
+	return q, nil
+}
+
+func (q *spillQueue) Push(ctx context.Context, e BinlogEvent) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return errQueueClosed
+	}
+
+	// Fast path: nothing spilled and room in memory
+	if q.pending == 0 && q.budget.TryAcquire(e.Size) {
+		select {
+		case q.events <- e:
+			return nil
+		default:
+			q.budget.Release(e.Size)
+		}
+	}
+
+	spilledAt := time.Now()
+	record, err := encodeSpillRecord(e, spilledAt)
+	if err != nil {
+		return err
+	}
+
+	// The disk cap is the last line of defence: only now does the reader wait
+	if q.maxDiskBytes > 0 {
+		stop := context.AfterFunc(ctx, func() {
+			q.mu.Lock()
+			q.cond.Broadcast()
+			q.mu.Unlock()
+		})
+		defer stop()
+
+		for q.diskBytes > 0 && q.diskBytes+int64(len(record)) > q.maxDiskBytes {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if q.closed {
+				return errQueueClosed
+			}
+			q.cond.Wait()
+		}
+	}
+
+	if err := q.write(record); err != nil {
+		return err
+	}
+	if q.pending == 0 {
+		q.head = newSpillHead(spilledAt, e)
+	}
+	q.pending++
+	q.diskBytes += int64(len(record))
+	metrics.QueueSpilledBytes.Set(float64(q.diskBytes))
+	q.cond.Broadcast()
+	return nil
+}
+
+// write appends a record to the current segment, rolling to a new one when
+// it is full. Called with q.mu held.
+func (q *spillQueue) write(record []byte) error {
+	if q.writer != nil && q.writeSize > 0 && q.writeSize+int64(len(record)) > q.segmentBytes {
+		q.writer.Close()
+		q.writer = nil
+		q.writeSeq++
+	}
+	if q.writer == nil {
+		f, err := os.OpenFile(q.segmentPath(q.writeSeq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open spill segment: %w", err)
+		}
+		q.writer = f
+		q.writeSize = 0
+	}
+
+	// One write per record so the pump never sees a partial one
+	if _, err := q.writer.Write(record); err != nil {
+		return fmt.Errorf("failed to spill event: %w", err)
+	}
+	q.writeSize += int64(len(record))
+	return nil
+}
+
+func (q *spillQueue) pump() {
+	defer close(q.done)
+
+	for {
+		q.mu.Lock()
+		for q.pending == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+
+		record, size, err := q.readNext()
+		if err != nil {
+			logger.Log.Error("Failed to read spilled event, discarding spill backlog", zap.String("dir", q.dir), zap.Error(err))
+			q.discard()
+			continue
+		}
+		e := record.Event
+		q.held = size
+		q.mu.Lock()
+		q.head = newSpillHead(record.SpilledAt, e)
+		q.mu.Unlock()
+
+		if err := q.budget.Acquire(q.ctx, e.Size); err != nil {
+			return
+		}
+		if !q.deliver(e) {
+			q.budget.Release(e.Size)
+			return
+		}
+		q.held = 0
+
+		q.mu.Lock()
+		q.pending--
+		q.diskBytes -= size
+		if q.pending == 0 {
+			q.head = nil
+		}
+		metrics.QueueSpilledBytes.Set(float64(q.diskBytes))
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	}
+}
+
+// deliver hands a spilled event to the workers, on whichever channel is
+// current once there is room. False when the queue is closing.
+func (q *spillQueue) deliver(e BinlogEvent) bool {
+	for {
+		q.sends.RLock()
+		q.mu.Lock()
+		events, swapped := q.events, q.swapped
+		q.mu.Unlock()
+
+		select {
+		case events <- e:
+			q.sends.RUnlock()
+			return true
+		case <-swapped:
+			q.sends.RUnlock()
+		case <-q.ctx.Done():
+			q.sends.RUnlock()
+			return false
+		}
+	}
+}
+
+// readNext decodes the oldest spilled record, deleting segments as they
+// are exhausted. Only called while pending > 0, so a record always exists.
+func (q *spillQueue) readNext() (spillRecord, int64, error) {
+	for {
+		if q.reader == nil {
+			f, err := os.Open(q.segmentPath(q.readSeq))
+			if os.IsNotExist(err) && q.readSeq < q.writeSeq {
+				// Emptied when a persisted backlog was recovered
+				q.readSeq++
+				q.readOffset = 0
+				continue
+			}
+			if err != nil {
+				return spillRecord{}, 0, err
+			}
+			if _, err := f.Seek(q.readOffset, io.SeekStart); err != nil {
+				f.Close()
+				return spillRecord{}, 0, err
+			}
+			q.reader = f
+		}
+
+		var header [4]byte
+		_, err := io.ReadFull(q.reader, header[:])
+		if err == io.EOF {
+			// Segment drained; the writer has moved on to a newer one
+			q.reader.Close()
+			os.Remove(q.segmentPath(q.readSeq))
+			q.reader = nil
+			q.readSeq++
+			q.readOffset = 0
+			continue
+		}
+		if err != nil {
+			return spillRecord{}, 0, err
+		}
+
+		body := make([]byte, binary.BigEndian.Uint32(header[:]))
+		if _, err := io.ReadFull(q.reader, body); err != nil {
+			return spillRecord{}, 0, err
+		}
+
+		record, err := decodeSpillRecord(body)
+		if err != nil {
+			return spillRecord{}, 0, err
+		}
+		size := int64(len(header) + len(body))
+		q.readOffset += size
+		return record, size, nil
+	}
+}
+
+// discard drops every spilled event after a read failure so the pump does
+// not spin on a corrupt segment. The events are re-read on the next run.
+func (q *spillQueue) discard() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.reader != nil {
+		q.reader.Close()
+		q.reader = nil
+	}
+	if q.writer != nil {
+		q.writer.Close()
+		q.writer = nil
+	}
+	for seq := q.readSeq; seq <= q.writeSeq; seq++ {
+		os.Remove(q.segmentPath(seq))
+	}
+	os.Remove(filepath.Join(q.dir, cursorFile))
+	q.writeSeq++
+	q.readSeq = q.writeSeq
+	q.readOffset = 0
+	q.pending = 0
+	q.diskBytes = 0
+	q.head = nil
+	metrics.QueueSpilledBytes.Set(0)
+	q.cond.Broadcast()
+}
+
+func (q *spillQueue) Events() <-chan BinlogEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.events
+}
+
+func (q *spillQueue) Resize(capacity int) {
+	q.mu.Lock()
+	if q.closed || capacity == cap(q.events) {
+		q.mu.Unlock()
+		return
+	}
+	old := q.events
+	q.events = make(chan BinlogEvent, capacity)
+	close(q.swapped)
+	q.swapped = make(chan struct{})
+	q.mu.Unlock()
+
+	q.sends.Lock()
+	defer q.sends.Unlock()
+	close(old)
+}
+
+func (q *spillQueue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	q.cancel()
+	<-q.done
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	close(q.events)
+	if q.reader != nil {
+		q.reader.Close()
+	}
+	if q.writer != nil {
+		q.writer.Close()
+	}
+	if q.persist && q.pending > 0 {
+		err := q.saveCursor()
+		if err == nil {
+			logger.Log.Info("Kept spill backlog for the next run", zap.String("dir", q.dir), zap.Int("events", q.pending), zap.Int64("bytes", q.diskBytes))
+			return
+		}
+		logger.Log.Error("Failed to save spill cursor, discarding spill backlog", zap.String("dir", q.dir), zap.Error(err))
+	}
+	for seq := q.readSeq; seq <= q.writeSeq; seq++ {
+		os.Remove(q.segmentPath(seq))
+	}
+	os.Remove(filepath.Join(q.dir, cursorFile))
+	metrics.QueueSpilledBytes.Set(0)
+}
+
+func (q *spillQueue) Backlog() QueueBacklog {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	backlog := QueueBacklog{
+		Type:          QueueDisk,
+		Persistent:    q.persist,
+		MemoryEvents:  len(q.events),
+		SpilledEvents: q.pending,
+		SpilledBytes:  q.diskBytes,
+	}
+	if q.head != nil {
+		spilledAt := q.head.spilledAt
+		backlog.OldestSpilledAt = &spilledAt
+		backlog.AgeSeconds = time.Since(spilledAt).Seconds()
+		if q.head.file != "" {
+			backlog.OldestPosition = fmt.Sprintf("%s:%d", q.head.file, q.head.pos)
+		}
+	}
+	return backlog
+}
+
+// saveCursor records where the pump stopped, so the next queue starts at
+// the first record it didn't deliver. Called by Close once the pump has
+// exited.
+func (q *spillQueue) saveCursor() error {
+	cursor := fmt.Sprintf("%d %d\n", q.readSeq, q.readOffset-q.held)
+	tmp := filepath.Join(q.dir, cursorFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(cursor), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(q.dir, cursorFile))
+}
+
+// recoverBacklog picks up the segments a persistent queue left behind,
+// from its cursor on. A record cut short by a crash ends its segment; one
+// that can't be read drops the backlog, as the pump would.
+func (q *spillQueue) recoverBacklog() {
+	seqs := q.segmentSeqs()
+	if len(seqs) == 0 {
+		os.Remove(filepath.Join(q.dir, cursorFile))
+		return
+	}
+	cursorSeq, cursorOffset := q.readCursor()
+
+	first := -1
+	for _, seq := range seqs {
+		path := q.segmentPath(seq)
+		if seq < cursorSeq {
+			os.Remove(path)
+			continue
+		}
+		var offset int64
+		if seq == cursorSeq {
+			offset = cursorOffset
+		}
+		records, size, head, err := scanSegment(path, offset)
+		if err != nil {
+			logger.Log.Error("Failed to read persisted spill segment, discarding spill backlog", zap.String("path", path), zap.Error(err))
+			q.removeSegments()
+			q.pending, q.diskBytes, q.head = 0, 0, nil
+			return
+		}
+		if records == 0 {
+			os.Remove(path)
+			continue
+		}
+		if first < 0 {
+			first = seq
+			q.readOffset = offset
+			q.head = head
+		}
+		q.pending += records
+		q.diskBytes += size
+	}
+	os.Remove(filepath.Join(q.dir, cursorFile))
+	if first < 0 {
+		return
+	}
+
+	// Appends go to a new segment, after the recovered ones
+	q.readSeq = first
+	q.writeSeq = seqs[len(seqs)-1] + 1
+	logger.Log.Info("Recovered spill backlog", zap.String("dir", q.dir), zap.Int("events", q.pending), zap.Int64("bytes", q.diskBytes), zap.Time("oldest_spilled_at", q.head.spilledAt))
+}
+
+// readCursor returns the saved cursor, or the start of the first segment.
+func (q *spillQueue) readCursor() (int, int64) {
+	data, err := os.ReadFile(filepath.Join(q.dir, cursorFile))
+	if err != nil {
+		return 0, 0
+	}
+	var seq int
+	var offset int64
+	if _, err := fmt.Sscanf(string(data), "%d %d", &seq, &offset); err != nil {
+		logger.Log.Warn("Ignoring unreadable spill cursor", zap.String("dir", q.dir), zap.Error(err))
+		return 0, 0
+	}
+	return seq, offset
+}
+
+// segmentSeqs lists the sequence numbers of the segments in the dir, in
+// order.
+func (q *spillQueue) segmentSeqs() []int {
+	paths, _ := filepath.Glob(filepath.Join(q.dir, segmentPattern))
+	seqs := make([]int, 0, len(paths))
+	for _, path := range paths {
+		name := filepath.Base(path)
+		seq, err := strconv.Atoi(name[len("segment-") : len(name)-len(".spill")])
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+	return seqs
+}
+
+// removeSegments deletes every segment in the dir and the cursor, and
+// returns how many segments there were.
+func (q *spillQueue) removeSegments() int {
+	paths, _ := filepath.Glob(filepath.Join(q.dir, segmentPattern))
+	for _, path := range paths {
+		os.Remove(path)
+	}
+	os.Remove(filepath.Join(q.dir, cursorFile))
+	return len(paths)
+}
+
+// scanSegment counts the records in a segment from offset, truncating a
+// partial one at the end, and returns the first.
+func scanSegment(path string, offset int64) (int, int64, *spillHead, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, 0, nil, err
+	}
+
+	var records int
+	var size int64
+	var head *spillHead
+	for {
+		var header [4]byte
+		_, err := io.ReadFull(f, header[:])
+		if err == io.EOF {
+			break
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header[:]))
+		if err == nil {
+			_, err = io.ReadFull(f, body)
+		}
+		if err == io.ErrUnexpectedEOF {
+			logger.Log.Warn("Truncating partial spill record", zap.String("path", path), zap.Int64("offset", offset+size))
+			if err := os.Truncate(path, offset+size); err != nil {
+				return 0, 0, nil, err
+			}
+			break
+		}
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if head == nil {
+			record, err := decodeSpillRecord(body)
+			if err != nil {
+				return 0, 0, nil, err
+			}
+			head = newSpillHead(record.SpilledAt, record.Event)
+		}
+		records++
+		size += int64(len(header) + len(body))
+	}
+	return records, size, head, nil
+}
+
+func (q *spillQueue) segmentPath(seq int) string {
+	return filepath.Join(q.dir, fmt.Sprintf("segment-%08d.spill", seq))
+}
+
+// Polled rows carry time.Time values, which gob only encodes inside
+// interfaces once registered.
+func init() {
+	gob.Register(time.Time{})
+}
+
+// spillRecord is a spilled event and when it was spilled.
+type spillRecord struct {
+	SpilledAt time.Time
+	Event     BinlogEvent
+}
+
+// spillHead describes the oldest spilled event for Backlog, without
+// holding on to its rows.
+type spillHead struct {
+	spilledAt time.Time
+	file      string
+	pos       uint32
+}
+
+func newSpillHead(spilledAt time.Time, e BinlogEvent) *spillHead {
+	return &spillHead{spilledAt: spilledAt, file: e.BinlogFile, pos: e.BinlogPos}
+}
+
+// encodeSpillRecord frames a gob-encoded event with its length. Gob keeps
+// the concrete Go types of row values, which JSON would not.
+func encodeSpillRecord(e BinlogEvent, spilledAt time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 4))
+	record := spillRecord{SpilledAt: spilledAt, Event: e}
+	if err := gob.NewEncoder(&buf).Encode(&record); err != nil {
+		return nil, fmt.Errorf("failed to encode event for spill: %w", err)
+	}
+	framed := buf.Bytes()
+	binary.BigEndian.PutUint32(framed[:4], uint32(len(framed)-4))
+	return framed, nil
+}
+
+func decodeSpillRecord(body []byte) (spillRecord, error) {
+	var record spillRecord
+	if err := gob.NewDecoder(bytes.NewReader(body)).Decode(&record); err != nil {
+		return spillRecord{}, err
+	}
+	return record, nil
+}
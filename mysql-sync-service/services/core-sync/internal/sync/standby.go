@@ -0,0 +1,170 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/store"
+)
+
+// StandbyStatus is what a standby knows of the leader, and of where the
+// leader's sync stands by its checkpoints.
+type StandbyStatus struct {
+	LeaderHealthy  bool                `json:"leader_healthy"`
+	Reason         string              `json:"reason,omitempty"` // why the leader is unhealthy
+	UnhealthySince *time.Time          `json:"unhealthy_since,omitempty"`
+	PromotesAt     *time.Time          `json:"promotes_at,omitempty"` // unless the leader recovers
+	CheckedAt      *time.Time          `json:"checked_at,omitempty"`
+	Checkpoints    []StandbyCheckpoint `json:"checkpoints"`
+}
+
+// StandbyCheckpoint is a table's checkpoint as a standby last read it.
+type StandbyCheckpoint struct {
+	Table          string     `json:"table"`
+	BinlogFile     string     `json:"binlog_file,omitempty"`
+	BinlogPosition int64      `json:"binlog_position,omitempty"`
+	LastSyncTime   *time.Time `json:"last_sync_time,omitempty"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// standby tracks the leader from a standing-by instance. leaderElector.mu
+// guards it.
+type standby struct {
+	holder         string
+	renewedAt      time.Time // the holder's last renewal seen, by the state store's clock
+	renewSeen      time.Time // when it was, by the local clock
+	unhealthySince time.Time
+	reason         string
+	checkedAt      time.Time
+	checkpoints    []StandbyCheckpoint
+}
+
+func (s standby) status(window time.Duration) *StandbyStatus {
+	status := &StandbyStatus{LeaderHealthy: s.reason == "", Reason: s.reason, Checkpoints: s.checkpoints}
+	if status.Checkpoints == nil {
+		status.Checkpoints = []StandbyCheckpoint{}
+	}
+	if !s.checkedAt.IsZero() {
+		checked := s.checkedAt
+		status.CheckedAt = &checked
+	}
+	if !s.unhealthySince.IsZero() {
+		since, promotes := s.unhealthySince, s.unhealthySince.Add(window)
+		status.UnhealthySince, status.PromotesAt = &since, &promotes
+	}
+	return status
+}
+
+// watchLeader reads the checkpoints the leader persisted and checks its
+// health: it must keep renewing its lease, and answer on its advertised
+// address if it has one. Once it has been unhealthy for the failover
+// window, the lease is taken over from it and returned; otherwise nil.
+func (m *Manager) watchLeader(lease *store.Lease) *store.Lease {
+	e := m.leader
+	checkpoints := m.readCheckpoints()
+	reason := ""
+	if lease.Address != "" {
+		reason = e.checkLeader(m.ctx, lease.Address)
+	}
+
+	now := time.Now()
+	e.mu.Lock()
+	s := &e.standby
+	if s.holder != lease.Holder {
+		*s = standby{holder: lease.Holder}
+	}
+	if !lease.RenewedAt.Equal(s.renewedAt) {
+		s.renewedAt, s.renewSeen = lease.RenewedAt, now
+	}
+	if stale := now.Sub(s.renewSeen); reason == "" && stale > 2*e.renew {
+		reason = fmt.Sprintf("lease not renewed for %s", stale.Round(time.Second))
+	}
+	if checkpoints != nil {
+		s.checkpoints = checkpoints
+	}
+	s.checkedAt = now
+	wasHealthy := s.reason == ""
+	s.reason = reason
+	if reason == "" {
+		s.unhealthySince = time.Time{}
+	} else if s.unhealthySince.IsZero() {
+		s.unhealthySince = now
+	}
+	promote := reason != "" && now.Sub(s.unhealthySince) >= e.window
+	e.mu.Unlock()
+
+	switch {
+	case reason != "" && wasHealthy:
+		logger.Log.Warn("Leader unhealthy", zap.String("leader", lease.Holder), zap.String("reason", reason), zap.Duration("failover_window", e.window))
+	case reason == "" && !wasHealthy:
+		logger.Log.Info("Leader healthy again", zap.String("leader", lease.Holder))
+	}
+	if !promote {
+		return nil
+	}
+
+	logger.Log.Warn("Taking over from unhealthy leader", zap.String("leader", lease.Holder), zap.String("reason", reason))
+	ctx, cancel := context.WithTimeout(m.ctx, e.renew)
+	defer cancel()
+	taken, err := m.store.TakeLease(ctx, e.lease, e.instance, e.address, lease.Holder, e.ttl)
+	if err != nil {
+		logger.Log.Error("Failed to take over leader lease", zap.String("leader", lease.Holder), zap.Error(err))
+		return nil
+	}
+	return taken
+}
+
+// checkLeader health-checks the leader at address, returning why it is
+// unhealthy or "".
+func (e *leaderElector) checkLeader(ctx context.Context, address string) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address+"/healthz", nil)
+	if err != nil {
+		return fmt.Sprintf("invalid address %q: %v", address, err)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Sprintf("health check failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Sprintf("health check returned %s", resp.Status)
+	}
+	return ""
+}
+
+// readCheckpoints reads each configured table's checkpoint, nil if they
+// couldn't be read.
+func (m *Manager) readCheckpoints() []StandbyCheckpoint {
+	ctx, cancel := context.WithTimeout(m.ctx, m.leader.renew)
+	defer cancel()
+
+	tables := m.tableConfigs()
+	checkpoints := make([]StandbyCheckpoint, 0, len(tables))
+	for _, table := range tables {
+		state, err := m.store.GetSyncState(ctx, table.Name)
+		if err != nil {
+			logger.Log.Debug("Failed to read checkpoint on standby", zap.String("table", table.Name), zap.Error(err))
+			return nil
+		}
+		if state == nil {
+			continue
+		}
+		checkpoint := StandbyCheckpoint{
+			Table:          state.TableName,
+			BinlogFile:     state.BinlogFile.String,
+			BinlogPosition: state.BinlogPosition.Int64,
+			UpdatedAt:      state.UpdatedAt,
+		}
+		if state.LastSyncTime.Valid {
+			synced := state.LastSyncTime.Time
+			checkpoint.LastSyncTime = &synced
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	return checkpoints
+}
@@ -0,0 +1,408 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/metrics"
+)
+
+// Delete modes for TableConfig.DeleteMode
+const (
+	DeleteHard   = "hard"
+	DeleteSoft   = "soft"
+	DeleteIgnore = "ignore"
+)
+
+// statement is one parameterised SQL statement to run on the target.
+type statement struct {
+	query string
+	args  []interface{}
+	// upsert holds a multi-row upsert's rows unrendered, so the sink can
+	// merge it with the next upsert into the same columns
+	upsert *upsertRows
+	// The target table and the kind of event it applies, which with the
+	// query identify it in the target's statement cache
+	table     string
+	operation EventType
+}
+
+// stmtKey is the statement's key in the target's statement cache.
+func (s statement) stmtKey() database.StmtKey {
+	return database.StmtKey{Table: s.table, Operation: string(s.operation), Query: s.query}
+}
+
+// cacheable reports whether the statement is worth preparing: multi-row
+// upserts aren't, their text varies with how many rows a batch has.
+func (s statement) cacheable() bool {
+	return s.upsert == nil || len(s.upsert.rows) == 1
+}
+
+// upsertRows are the bound values of a multi-row upsert's rows, and the
+// text around its VALUES list.
+type upsertRows struct {
+	prefix, suffix string
+	rows           [][]interface{}
+}
+
+// renderUpsert writes rows as one multi-row upsert, numbering placeholders
+// from 1.
+func renderUpsert(dialect database.Dialect, prefix, suffix string, rows [][]interface{}) statement {
+	values := make([]string, 0, len(rows))
+	var args []interface{}
+	for _, row := range rows {
+		placeholders := make([]string, len(row))
+		for i, value := range row {
+			args = append(args, value)
+			placeholders[i] = dialect.Placeholder(len(args))
+		}
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+	}
+	return statement{
+		query:  prefix + strings.Join(values, ", ") + suffix,
+		args:   args,
+		upsert: &upsertRows{prefix: prefix, suffix: suffix, rows: rows},
+	}
+}
+
+// statementBuilder turns binlog events for one table into SQL against a
+// single target table, in the target database's dialect. Events carry
+// source column names; they are renamed per the table's column mappings
+// only when SQL is written.
+// Columns whose direction override excludes the builder's direction are
+// left out, so e.g. a cloud-owned price column is never pushed to the cloud.
+// Values are converted to their column types by the target's converter.
+type statementBuilder struct {
+	table      string
+	config     config.TableConfig
+	pkColumns  []string
+	direction  string
+	overrides  map[string]string
+	dialect    database.Dialect
+	converter  *database.Converter
+	deleteMode string
+	softColumn string
+	softFlag   bool
+}
+
+func newStatementBuilder(tableConfig config.TableConfig, target, direction string, db *database.Database) *statementBuilder {
+	var pkColumns []string
+	for _, column := range strings.Split(tableConfig.PrimaryKey, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			pkColumns = append(pkColumns, column)
+		}
+	}
+
+	overrides := make(map[string]string, len(tableConfig.ColumnDirections))
+	for column, columnDirection := range tableConfig.ColumnDirections {
+		overrides[strings.ToLower(column)] = columnDirection
+	}
+
+	return &statementBuilder{
+		table:      target,
+		config:     tableConfig,
+		pkColumns:  pkColumns,
+		direction:  direction,
+		overrides:  overrides,
+		dialect:    db.Dialect,
+		converter:  db.Converter,
+		deleteMode: tableConfig.GetDeleteMode(),
+		softColumn: tableConfig.GetSoftDeleteColumn(),
+		softFlag:   tableConfig.SoftDeleteFlag,
+	}
+}
+
+// columnAllowed reports whether a column flows in the builder's direction.
+// Primary key columns always flow: rows must stay identifiable on both sides.
+func (b *statementBuilder) columnAllowed(column string) bool {
+	if b.isPrimaryKey(column) {
+		return true
+	}
+	columnDirection, ok := b.overrides[strings.ToLower(column)]
+	if !ok || columnDirection == "" || columnDirection == DirectionBidirectional {
+		return true
+	}
+	return columnDirection == b.direction
+}
+
+// writable reports whether column is written by the builder's inserts
+// and updates: it must flow in the builder's direction, and not be
+// generated, as MySQL refuses values for generated columns.
+func (b *statementBuilder) writable(e BinlogEvent, column string) bool {
+	return b.columnAllowed(column) && columnIndex(e.Generated, column) < 0
+}
+
+func (b *statementBuilder) isPrimaryKey(column string) bool {
+	for _, pkColumn := range b.pkColumns {
+		if strings.EqualFold(pkColumn, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// Build returns the statements that apply e to the target table.
+func (b *statementBuilder) Build(e BinlogEvent) ([]statement, error) {
+	if len(e.Columns) == 0 {
+		return nil, fmt.Errorf("event for %s carries no column names", e.Table)
+	}
+
+	var (
+		statements []statement
+		err        error
+	)
+	switch e.Type {
+	case Insert:
+		statements, err = b.buildInserts(e)
+	case Update:
+		statements, err = b.buildUpdates(e)
+	case Delete:
+		statements, err = b.buildDeletes(e)
+	default:
+		return nil, fmt.Errorf("unsupported event type %s", e.Type)
+	}
+	for i := range statements {
+		statements[i].table, statements[i].operation = b.table, e.Type
+	}
+	return statements, err
+}
+
+// maxUpsertRows caps rows per multi-row upsert; the dialect's placeholder
+// limit per statement can lower it further for wide tables.
+const maxUpsertRows = 500
+
+// buildInserts upserts rows in multi-row batches so replays after a crash
+// are harmless. Every allowed column is listed in both the VALUES and the
+// UPDATE clause and NULLs are bound as NULL, never skipped: leaving a column
+// out would keep a stale target value when the source nulled it.
+// With soft deletes the target-only delete marker is cleared as well, so a
+// re-inserted row comes back to life.
+func (b *statementBuilder) buildInserts(e BinlogEvent) ([]statement, error) {
+	var columnIndexes []int
+	for columnIndex, column := range e.Columns {
+		if b.writable(e, column) {
+			columnIndexes = append(columnIndexes, columnIndex)
+		}
+	}
+	if len(columnIndexes) == 0 {
+		return nil, nil
+	}
+
+	columns := make([]string, len(columnIndexes))
+	var keyColumns []string
+	for i, columnIndex := range columnIndexes {
+		columns[i] = b.config.TargetColumn(e.Columns[columnIndex])
+		if b.isPrimaryKey(e.Columns[columnIndex]) {
+			keyColumns = append(keyColumns, columns[i])
+		}
+	}
+	clearSoftDelete := b.deleteMode == DeleteSoft && columnIndex(columns, b.softColumn) < 0
+	if clearSoftDelete {
+		columns = append(columns, b.softColumn)
+	}
+	prefix, suffix := b.dialect.Upsert(b.table, columns, keyColumns)
+
+	batchRows := maxUpsertRows
+	if limit := b.dialect.MaxPlaceholders() / len(columns); limit < batchRows {
+		batchRows = limit
+	}
+
+	rows := make([][]interface{}, 0, len(e.Rows))
+	for _, row := range e.Rows {
+		if len(row) < len(e.Columns) {
+			return nil, fmt.Errorf("row has %d values for %d columns", len(row), len(e.Columns))
+		}
+		values := make([]interface{}, 0, len(columns))
+		for _, columnIndex := range columnIndexes {
+			value, err := b.value(e, columnIndex, row[columnIndex])
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		if clearSoftDelete {
+			values = append(values, b.softDeleteValue(false, e))
+		}
+		rows = append(rows, values)
+	}
+
+	var statements []statement
+	for start := 0; start < len(rows); start += batchRows {
+		end := min(start+batchRows, len(rows))
+		statements = append(statements, renderUpsert(b.dialect, prefix, suffix, rows[start:end]))
+	}
+	return statements, nil
+}
+
+// buildUpdates finds each updated row by its old image and sets the
+// columns of its new one.
+func (b *statementBuilder) buildUpdates(e BinlogEvent) ([]statement, error) {
+	if err := e.checkImages(); err != nil {
+		return nil, err
+	}
+
+	var statements []statement
+	for rowIndex, after := range e.Rows {
+		before := e.Before[rowIndex]
+
+		var setClauses []string
+		var args []interface{}
+		for columnIndex, column := range e.Columns {
+			if !b.writable(e, column) {
+				continue
+			}
+			if b.isPrimaryKey(column) && valuesEqual(before[columnIndex], after[columnIndex]) {
+				continue
+			}
+			value, err := b.value(e, columnIndex, after[columnIndex])
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, value)
+			setClauses = append(setClauses, b.dialect.QuoteIdentifier(b.config.TargetColumn(column))+" = "+b.dialect.Placeholder(len(args)))
+		}
+		if len(setClauses) == 0 {
+			// Every changed column belongs to the other direction
+			continue
+		}
+
+		where, args, err := b.whereClause(e, before, args)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, statement{
+			query: fmt.Sprintf("UPDATE %s SET %s WHERE %s", b.dialect.QuoteIdentifier(b.table), strings.Join(setClauses, ", "), where),
+			args:  args,
+		})
+	}
+	return statements, nil
+}
+
+// buildDeletes deletes, marks or skips rows depending on the delete mode.
+func (b *statementBuilder) buildDeletes(e BinlogEvent) ([]statement, error) {
+	switch b.deleteMode {
+	case DeleteIgnore:
+		return nil, nil
+	case DeleteSoft:
+		statements := make([]statement, 0, len(e.Rows))
+		for _, row := range e.Rows {
+			where, args, err := b.whereClause(e, row, []interface{}{b.softDeleteValue(true, e)})
+			if err != nil {
+				return nil, err
+			}
+			statements = append(statements, statement{
+				query: fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s", b.dialect.QuoteIdentifier(b.table),
+					b.dialect.QuoteIdentifier(b.softColumn), b.dialect.Placeholder(1), where),
+				args: args,
+			})
+		}
+		return statements, nil
+	default:
+		return b.buildRemovals(e)
+	}
+}
+
+// buildRemovals deletes the event's rows from the target outright.
+func (b *statementBuilder) buildRemovals(e BinlogEvent) ([]statement, error) {
+	statements := make([]statement, 0, len(e.Rows))
+	for _, row := range e.Rows {
+		where, args, err := b.whereClause(e, row, nil)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, statement{
+			query: fmt.Sprintf("DELETE FROM %s WHERE %s", b.dialect.QuoteIdentifier(b.table), where),
+			args:  args,
+		})
+	}
+	return statements, nil
+}
+
+// softDeleteValue is the soft delete column's value for a deleted or live
+// row. Deleted rows get the source's delete time so replays write the same
+// value.
+func (b *statementBuilder) softDeleteValue(deleted bool, e BinlogEvent) interface{} {
+	if b.softFlag {
+		return deleted
+	}
+	if !deleted {
+		return nil
+	}
+	if e.Timestamp == 0 {
+		return time.Now().UTC()
+	}
+	return time.Unix(int64(e.Timestamp), 0).UTC()
+}
+
+// whereClause identifies a row by its primary key, or by every column when
+// the table has no primary key configured. Arguments are appended to args so
+// numbered placeholders continue from the SET clause.
+func (b *statementBuilder) whereClause(e BinlogEvent, row []interface{}, args []interface{}) (string, []interface{}, error) {
+	var clauses []string
+	for columnIndex, column := range e.Columns {
+		if len(b.pkColumns) > 0 && !b.isPrimaryKey(column) {
+			continue
+		}
+		value, err := b.value(e, columnIndex, row[columnIndex])
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, value)
+		quoted, placeholder := b.dialect.QuoteIdentifier(b.config.TargetColumn(column)), b.dialect.Placeholder(len(args))
+		if len(b.pkColumns) > 0 {
+			// Keys are never NULL; a plain = keeps the key index usable on Postgres
+			clauses = append(clauses, quoted+" = "+placeholder)
+		} else {
+			clauses = append(clauses, b.dialect.NullSafeEqual(quoted, placeholder))
+		}
+	}
+	return strings.Join(clauses, " AND "), args, nil
+}
+
+// value converts a row value for binding against the target, binary
+// values as their exact bytes. One that doesn't fit its column fails the
+// event if the converter is strict, and is otherwise bound as it came and
+// counted; text that lost characters to the target's charset is bound as
+// converted and logged as a warning.
+func (b *statementBuilder) value(e BinlogEvent, columnIndex int, v interface{}) (interface{}, error) {
+	var columnType string
+	if columnIndex < len(e.ColumnTypes) {
+		columnType = e.ColumnTypes[columnIndex]
+	}
+	value, err := b.converter.Convert(columnType, v)
+	if err == nil {
+		return value, nil
+	}
+	column := e.Columns[columnIndex]
+	metrics.ConversionErrors.WithLabelValues(e.Table, column).Inc()
+	var conversion *database.ConversionError
+	lossy := errors.As(err, &conversion) && conversion.Lossy
+	if lossy {
+		metrics.LossyConversions.WithLabelValues(e.Table, column).Inc()
+	}
+	if b.converter.Strict {
+		return nil, fmt.Errorf("table %s column %s: %w", e.Table, column, err)
+	}
+	if lossy {
+		logger.Log.Warn("Binding text that lost characters to the target charset", zap.String("table", e.Table), zap.String("column", column), zap.Error(err))
+		return value, nil
+	}
+	logger.Log.Debug("Binding value that doesn't fit its column", zap.String("table", e.Table), zap.String("column", column), zap.Error(err))
+	return value, nil
+}
+
+func valuesEqual(a, b interface{}) bool {
+	aBytes, aIsBytes := a.([]byte)
+	bBytes, bIsBytes := b.([]byte)
+	if aIsBytes || bIsBytes {
+		return aIsBytes && bIsBytes && string(aBytes) == string(bBytes)
+	}
+	return a == b
+}
@@ -0,0 +1,229 @@
+package sync
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/database"
+)
+
+// newTestBuilder returns a builder for tableConfig writing to the table of
+// the same name through driver's dialect; it needs no connection.
+func newTestBuilder(t *testing.T, driver string, tableConfig config.TableConfig) *statementBuilder {
+	t.Helper()
+	dialect, err := database.NewDialect(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converter, err := database.NewConverter(dialect, true, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &database.Database{Dialect: dialect, Converter: converter}
+	return newStatementBuilder(tableConfig, tableConfig.Name, DirectionBidirectional, db)
+}
+
+func TestBuildInsertsBindsNulls(t *testing.T) {
+	users := config.TableConfig{Name: "users", PrimaryKey: "id"}
+	softUsers := config.TableConfig{Name: "users", PrimaryKey: "id", DeleteMode: DeleteSoft, SoftDeleteFlag: true}
+
+	tests := []struct {
+		name   string
+		driver string
+		table  config.TableConfig
+		rows   [][]interface{}
+		query  string
+		args   []interface{}
+	}{
+		{
+			name:   "NULL in one row",
+			driver: database.DriverMySQL,
+			table:  users,
+			rows:   [][]interface{}{{int64(1), nil, "a@example.com"}},
+			query: "INSERT INTO `users` (`id`, `name`, `email`) VALUES (?, ?, ?)" +
+				" ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `email` = VALUES(`email`)",
+			args: []interface{}{int64(1), nil, "a@example.com"},
+		},
+		{
+			name:   "NULLs in different columns across a batch",
+			driver: database.DriverMySQL,
+			table:  users,
+			rows: [][]interface{}{
+				{int64(1), nil, "a@example.com"},
+				{int64(2), "Bea", nil},
+				{int64(3), "Cy", "c@example.com"},
+			},
+			query: "INSERT INTO `users` (`id`, `name`, `email`) VALUES (?, ?, ?), (?, ?, ?), (?, ?, ?)" +
+				" ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `email` = VALUES(`email`)",
+			args: []interface{}{
+				int64(1), nil, "a@example.com",
+				int64(2), "Bea", nil,
+				int64(3), "Cy", "c@example.com",
+			},
+		},
+		{
+			name:   "column NULL in every row",
+			driver: database.DriverMySQL,
+			table:  users,
+			rows: [][]interface{}{
+				{int64(1), nil, "a@example.com"},
+				{int64(2), nil, "b@example.com"},
+			},
+			query: "INSERT INTO `users` (`id`, `name`, `email`) VALUES (?, ?, ?), (?, ?, ?)" +
+				" ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `email` = VALUES(`email`)",
+			args: []interface{}{int64(1), nil, "a@example.com", int64(2), nil, "b@example.com"},
+		},
+		{
+			name:   "numbered placeholders",
+			driver: database.DriverPostgres,
+			table:  users,
+			rows: [][]interface{}{
+				{int64(1), nil, "a@example.com"},
+				{int64(2), "Bea", nil},
+			},
+			query: `INSERT INTO "users" ("id", "name", "email") VALUES ($1, $2, $3), ($4, $5, $6)` +
+				` ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name", "email" = EXCLUDED."email"`,
+			args: []interface{}{int64(1), nil, "a@example.com", int64(2), "Bea", nil},
+		},
+		{
+			name:   "soft delete marker after NULLs",
+			driver: database.DriverMySQL,
+			table:  softUsers,
+			rows: [][]interface{}{
+				{int64(1), nil, nil},
+				{int64(2), "Bea", nil},
+			},
+			query: "INSERT INTO `users` (`id`, `name`, `email`, `deleted_at`) VALUES (?, ?, ?, ?), (?, ?, ?, ?)" +
+				" ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `email` = VALUES(`email`), `deleted_at` = VALUES(`deleted_at`)",
+			args: []interface{}{int64(1), nil, nil, false, int64(2), "Bea", nil, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBuilder(t, tt.driver, tt.table)
+			statements, err := b.Build(BinlogEvent{
+				Type:    Insert,
+				Table:   "users",
+				Columns: []string{"id", "name", "email"},
+				Rows:    tt.rows,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(statements) != 1 {
+				t.Fatalf("got %d statements, want 1", len(statements))
+			}
+			if statements[0].query != tt.query {
+				t.Errorf("query:\n got %s\nwant %s", statements[0].query, tt.query)
+			}
+			if !reflect.DeepEqual(statements[0].args, tt.args) {
+				t.Errorf("args: got %#v, want %#v", statements[0].args, tt.args)
+			}
+		})
+	}
+}
+
+func TestBuildKeepsBinaryBytes(t *testing.T) {
+	// Bytes that aren't UTF-8, a NUL among them, as canal may read them
+	// into either a string or a []byte
+	raw := []byte{0x00, 0xff, 0xfe, 0x80, 'a'}
+
+	tests := []struct {
+		name       string
+		driver     string
+		columnType string
+		value      interface{}
+		want       []byte
+	}{
+		{"varbinary from bytes", database.DriverMySQL, "varbinary(16)", raw, raw},
+		{"varbinary from string", database.DriverMySQL, "varbinary(16)", string(raw), raw},
+		{"blob", database.DriverMySQL, "blob", string(raw), raw},
+		{"longblob", database.DriverMySQL, "longblob", raw, raw},
+		{"binary padded to its length", database.DriverMySQL, "binary(8)", string(raw), append(append([]byte{}, raw...), 0, 0, 0)},
+		{"binary at its length", database.DriverMySQL, "binary(5)", raw, raw},
+		{"bytea", database.DriverPostgres, "blob", string(raw), raw},
+		{"sqlite blob", database.DriverSQLite, "varbinary(16)", string(raw), raw},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBuilder(t, tt.driver, config.TableConfig{Name: "files", PrimaryKey: "id"})
+			statements, err := b.Build(BinlogEvent{
+				Type:        Insert,
+				Table:       "files",
+				Columns:     []string{"id", "data"},
+				ColumnTypes: []string{"int", tt.columnType},
+				Rows:        [][]interface{}{{int64(1), tt.value}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := statements[0].args[1].([]byte)
+			if !ok {
+				t.Fatalf("bound %T, want []byte", statements[0].args[1])
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("bound % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSkipsGeneratedColumns(t *testing.T) {
+	b := newTestBuilder(t, database.DriverMySQL, config.TableConfig{Name: "lines", PrimaryKey: "id"})
+	event := func(eventType EventType, rows, before [][]interface{}) BinlogEvent {
+		return BinlogEvent{
+			Type:        eventType,
+			Table:       "lines",
+			Columns:     []string{"id", "price", "quantity", "total"},
+			ColumnTypes: []string{"int", "int", "int", "int"},
+			Generated:   []string{"total"},
+			Rows:        rows,
+			Before:      before,
+		}
+	}
+
+	tests := []struct {
+		name  string
+		event BinlogEvent
+		query string
+		args  []interface{}
+	}{
+		{
+			name:  "insert",
+			event: event(Insert, [][]interface{}{{int64(1), int64(5), int64(2), int64(10)}}, nil),
+			query: "INSERT INTO `lines` (`id`, `price`, `quantity`) VALUES (?, ?, ?)" +
+				" ON DUPLICATE KEY UPDATE `price` = VALUES(`price`), `quantity` = VALUES(`quantity`)",
+			args: []interface{}{int64(1), int64(5), int64(2)},
+		},
+		{
+			name: "update",
+			event: event(Update,
+				[][]interface{}{{int64(1), int64(5), int64(3), int64(15)}},
+				[][]interface{}{{int64(1), int64(5), int64(2), int64(10)}}),
+			query: "UPDATE `lines` SET `price` = ?, `quantity` = ? WHERE `id` = ?",
+			args:  []interface{}{int64(5), int64(3), int64(1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements, err := b.Build(tt.event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(statements) != 1 {
+				t.Fatalf("got %d statements, want 1", len(statements))
+			}
+			if statements[0].query != tt.query {
+				t.Errorf("query:\n got %s\nwant %s", statements[0].query, tt.query)
+			}
+			if !reflect.DeepEqual(statements[0].args, tt.args) {
+				t.Errorf("args: got %#v, want %#v", statements[0].args, tt.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package sync
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mysql-sync-service/internal/metrics"
+)
+
+// Stats is the sync's live statistics. The listener, poller and workers
+// update it and the API, metrics exporter and health checks read it, all
+// without taking the manager's lock, so reading status never waits on a
+// run starting or draining. Counters are totals since the service started;
+// a run's own are in its shutdown report.
+type Stats struct {
+	status       atomic.Value // string
+	runID        atomic.Value // string
+	runStartedAt atomic.Int64 // unix nanos, 0 before the first run
+
+	// The current run's listener and dump loader, nil between runs
+	listener atomic.Pointer[BinlogListener]
+	loader   atomic.Pointer[DumpLoader]
+
+	eventsQueued    atomic.Int64
+	eventsProcessed atomic.Int64
+	rowsApplied     atomic.Int64
+	batchesApplied  atomic.Int64
+	batchesFailed   atomic.Int64
+	deadLetters     atomic.Int64
+	lastQueuedAt    atomic.Int64 // unix nanos
+	lastAppliedAt   atomic.Int64 // unix nanos
+
+	// Each table's, persisted so their totals outlive restarts
+	tables *tableStats
+}
+
+// StatsSnapshot is a point-in-time read of Stats.
+type StatsSnapshot struct {
+	Status          string     `json:"status"`
+	RunID           string     `json:"run_id,omitempty"`
+	RunStartedAt    *time.Time `json:"run_started_at,omitempty"`
+	EventsQueued    int64      `json:"events_queued"`
+	EventsProcessed int64      `json:"events_processed"` // Applied or dead-lettered
+	RowsApplied     int64      `json:"rows_applied"`
+	BatchesApplied  int64      `json:"batches_applied"`
+	BatchesFailed   int64      `json:"batches_failed"`
+	DeadLetters     int64      `json:"dead_letters"`
+	LastQueuedAt    *time.Time `json:"last_queued_at,omitempty"`
+	LastAppliedAt   *time.Time `json:"last_applied_at,omitempty"`
+}
+
+func newStats() *Stats {
+	s := &Stats{tables: newTableStats()}
+	s.status.Store("idle")
+	s.runID.Store("")
+	return s
+}
+
+// state is the run state as the manager set it: idle, running, paused or
+// stopping.
+func (s *Stats) state() string {
+	return s.status.Load().(string)
+}
+
+func (s *Stats) setState(status string) {
+	s.status.Store(status)
+}
+
+// Status is state, refined to loading while a run loads a dump and
+// degraded while its binlog stream is being reconnected.
+func (s *Stats) Status() string {
+	status := s.state()
+	if status != "running" {
+		return status
+	}
+	if loader := s.loader.Load(); loader != nil && loader.Loading() {
+		return "loading"
+	}
+	if listener := s.listener.Load(); listener != nil && listener.Degraded() {
+		return "degraded"
+	}
+	return status
+}
+
+// runStarted records the run now current, and what it captures with.
+func (s *Stats) runStarted(run *syncRun, listener *BinlogListener, loader *DumpLoader) {
+	s.runID.Store(run.id)
+	s.runStartedAt.Store(run.startedAt.UnixNano())
+	s.listener.Store(listener)
+	s.loader.Store(loader)
+}
+
+// runStopped forgets the stopped run's listener and loader. Its ID stays,
+// as that of the last run.
+func (s *Stats) runStopped() {
+	s.listener.Store(nil)
+	s.loader.Store(nil)
+}
+
+func (s *Stats) queued() {
+	s.eventsQueued.Add(1)
+	s.lastQueuedAt.Store(time.Now().UnixNano())
+}
+
+func (s *Stats) applied(rows int64) {
+	s.batchesApplied.Add(1)
+	s.rowsApplied.Add(rows)
+	s.lastAppliedAt.Store(time.Now().UnixNano())
+}
+
+// Snapshot reads every statistic. Counters are read one by one, so a
+// snapshot taken mid-batch may be off by that batch.
+func (s *Stats) Snapshot() StatsSnapshot {
+	return StatsSnapshot{
+		Status:          s.Status(),
+		RunID:           s.runID.Load().(string),
+		RunStartedAt:    unixTime(s.runStartedAt.Load()),
+		EventsQueued:    s.eventsQueued.Load(),
+		EventsProcessed: s.eventsProcessed.Load(),
+		RowsApplied:     s.rowsApplied.Load(),
+		BatchesApplied:  s.batchesApplied.Load(),
+		BatchesFailed:   s.batchesFailed.Load(),
+		DeadLetters:     s.deadLetters.Load(),
+		LastQueuedAt:    unixTime(s.lastQueuedAt.Load()),
+		LastAppliedAt:   unixTime(s.lastAppliedAt.Load()),
+	}
+}
+
+func unixTime(nanos int64) *time.Time {
+	if nanos == 0 {
+		return nil
+	}
+	t := time.Unix(0, nanos)
+	return &t
+}
+
+// exportStats registers the exporter's view of the stats. The metrics are
+// global, so only the first manager's stats are exported.
+var exportStats sync.Once
+
+func (s *Stats) export() {
+	exportStats.Do(func() {
+		metrics.RegisterStats(metrics.StatsReaders{
+			EventsQueued:    func() float64 { return float64(s.eventsQueued.Load()) },
+			EventsProcessed: func() float64 { return float64(s.eventsProcessed.Load()) },
+			RowsApplied:     func() float64 { return float64(s.rowsApplied.Load()) },
+			BatchesApplied:  func() float64 { return float64(s.batchesApplied.Load()) },
+			BatchesFailed:   func() float64 { return float64(s.batchesFailed.Load()) },
+			DeadLetters:     func() float64 { return float64(s.deadLetters.Load()) },
+			Running: func() float64 {
+				if state := s.state(); state != "running" && state != "paused" {
+					return 0
+				}
+				return 1
+			},
+			LastAppliedAt: func() float64 {
+				if nanos := s.lastAppliedAt.Load(); nanos != 0 {
+					return float64(nanos) / 1e9
+				}
+				return 0
+			},
+		})
+	})
+}
+
+// Stats reads the sync's live statistics.
+func (m *Manager) Stats() StatsSnapshot {
+	return m.stats.Snapshot()
+}
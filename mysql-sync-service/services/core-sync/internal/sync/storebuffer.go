@@ -0,0 +1,254 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/metrics"
+	"mysql-sync-service/internal/store"
+)
+
+// errStoreBufferFull is returned for a write that failed while the buffer
+// of waiting writes was full; the write is lost.
+var errStoreBufferFull = errors.New("state store unavailable and its write buffer is full")
+
+// syncStateSize is roughly what a buffered sync state takes.
+const syncStateSize = 256
+
+// storeBuffer writes run state to the state store, holding on to writes
+// that fail while the store is down so replication carries on, and writing
+// them in order once it is back. Sync states only keep each table's latest;
+// other writes are held up to a size bound, past which they are dropped.
+// While writes are waiting new ones queue behind them rather than trying
+// the store first.
+type storeBuffer struct {
+	store    store.Store
+	maxBytes int64
+	retry    time.Duration
+	health   *healthTracker
+
+	mu      sync.Mutex
+	states  map[string]*store.SyncState
+	writes  []bufferedWrite
+	bytes   int64
+	dropped int
+	down    bool
+}
+
+type bufferedWrite struct {
+	size  int64
+	write func(ctx context.Context) error
+}
+
+func newStoreBuffer(s store.Store, cfg config.StoreBufferConfig, health *healthTracker) *storeBuffer {
+	return &storeBuffer{
+		store:    s,
+		maxBytes: cfg.GetMaxBytes(),
+		retry:    cfg.GetRetryInterval(),
+		health:   health,
+		states:   make(map[string]*store.SyncState),
+	}
+}
+
+// UpdateSyncState records a table's sync state, its checkpoint, or holds it
+// until the store is back. The error is the store's when the write failed;
+// the state is held and retried all the same, and sync health is degraded
+// until it is written.
+func (b *storeBuffer) UpdateSyncState(ctx context.Context, state *store.SyncState) error {
+	var err error
+	if !b.waiting() {
+		err = b.store.UpdateSyncState(ctx, state)
+		if err == nil {
+			return nil
+		}
+		b.checkpointFailed(ctx, state.TableName, err)
+		b.failed(ctx, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.states[state.TableName]; !ok {
+		b.bytes += syncStateSize
+	}
+	b.states[state.TableName] = state
+	b.updateMetrics()
+	return err
+}
+
+// checkpointFailed counts a failed sync state write and degrades health.
+func (b *storeBuffer) checkpointFailed(ctx context.Context, table string, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	metrics.CheckpointWriteFailures.WithLabelValues(table).Inc()
+	b.health.CheckpointsFailing(fmt.Sprintf("checkpoints not persisted, a restart would resume from older positions: %v", err))
+}
+
+// heldStates is the number of tables whose sync state is held.
+func (b *storeBuffer) heldStates() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.states)
+}
+
+// CreateDeadLetter stores a dead letter, or holds it until the store is
+// back. It fails only when the buffer is full.
+func (b *storeBuffer) CreateDeadLetter(ctx context.Context, deadLetter *store.DeadLetter) error {
+	size := int64(len(deadLetter.Payload) + len(deadLetter.ErrorMessage) + syncStateSize)
+	return b.write(ctx, size, func(ctx context.Context) error {
+		return b.store.CreateDeadLetter(ctx, deadLetter)
+	})
+}
+
+// CreateSyncHistory and UpdateSyncHistory go through the same queue, so a
+// run's end is never written before its start.
+func (b *storeBuffer) CreateSyncHistory(ctx context.Context, history *store.SyncHistory) error {
+	return b.write(ctx, syncStateSize, func(ctx context.Context) error {
+		return b.store.CreateSyncHistory(ctx, history)
+	})
+}
+
+func (b *storeBuffer) UpdateSyncHistory(ctx context.Context, history *store.SyncHistory) error {
+	size := int64(len(history.ShutdownReport) + syncStateSize)
+	return b.write(ctx, size, func(ctx context.Context) error {
+		return b.store.UpdateSyncHistory(ctx, history)
+	})
+}
+
+func (b *storeBuffer) write(ctx context.Context, size int64, write func(context.Context) error) error {
+	if !b.waiting() {
+		err := write(ctx)
+		if err == nil {
+			return nil
+		}
+		b.failed(ctx, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.bytes+size > b.maxBytes {
+		b.dropped++
+		metrics.StateStoreWritesDropped.Inc()
+		return errStoreBufferFull
+	}
+	b.writes = append(b.writes, bufferedWrite{size: size, write: write})
+	b.bytes += size
+	b.updateMetrics()
+	return nil
+}
+
+// waiting reports whether writes are held for the store.
+func (b *storeBuffer) waiting() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.down || len(b.writes) > 0 || len(b.states) > 0
+}
+
+func (b *storeBuffer) failed(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		// Cut short by a stopping run, not the store; held all the same
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.down {
+		b.down = true
+		logger.Log.Warn("State store unavailable, holding its writes until it is back", zap.Error(err))
+	}
+}
+
+// updateMetrics reports what is held; b.mu must be held.
+func (b *storeBuffer) updateMetrics() {
+	metrics.StateStoreBufferedWrites.Set(float64(len(b.writes) + len(b.states)))
+	metrics.StateStoreBufferedBytes.Set(float64(b.bytes))
+	metrics.CheckpointsUnpersisted.Set(float64(len(b.states)))
+}
+
+// run retries the held writes every retry interval until ctx is done.
+func (b *storeBuffer) run(ctx context.Context) {
+	ticker := time.NewTicker(b.retry)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if b.waiting() {
+				b.Flush(ctx)
+			}
+		}
+	}
+}
+
+// Flush writes what is held, in order, stopping at the first failure.
+func (b *storeBuffer) Flush(ctx context.Context) error {
+	if err := b.store.Ping(ctx); err != nil {
+		return err
+	}
+
+	written := 0
+	for {
+		b.mu.Lock()
+		if len(b.writes) == 0 {
+			b.mu.Unlock()
+			break
+		}
+		next := b.writes[0]
+		b.mu.Unlock()
+
+		if err := next.write(ctx); err != nil {
+			return err
+		}
+
+		b.mu.Lock()
+		b.writes = b.writes[1:]
+		b.bytes -= next.size
+		b.updateMetrics()
+		b.mu.Unlock()
+		written++
+	}
+
+	b.mu.Lock()
+	states := b.states
+	b.states = make(map[string]*store.SyncState)
+	b.bytes -= int64(len(states)) * syncStateSize
+	b.updateMetrics()
+	b.mu.Unlock()
+	for table, state := range states {
+		if err := b.store.UpdateSyncState(ctx, state); err != nil {
+			b.checkpointFailed(ctx, table, err)
+			b.mu.Lock()
+			// Hold the unwritten ones again, unless newer came in meanwhile
+			for table, state := range states {
+				if _, ok := b.states[table]; !ok {
+					b.states[table] = state
+					b.bytes += syncStateSize
+				}
+			}
+			b.updateMetrics()
+			b.mu.Unlock()
+			return err
+		}
+		delete(states, table)
+		written++
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.states) == 0 {
+		b.health.CheckpointsPersisted()
+	}
+	if b.down && len(b.writes) == 0 && len(b.states) == 0 {
+		b.down = false
+		logger.Log.Info("State store back, held writes written", zap.Int("writes", written), zap.Int("dropped", b.dropped))
+		b.dropped = 0
+	}
+	return nil
+}
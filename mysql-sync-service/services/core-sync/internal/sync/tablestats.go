@@ -0,0 +1,219 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/logger"
+)
+
+// settingTableStats holds each table's apply statistics, as JSON, so their
+// totals carry on across restarts.
+const settingTableStats = "sync.table_stats"
+
+const (
+	// Rows per second are averaged over this many seconds
+	tableRateWindow = 60
+	// How often the per-table statistics are persisted, if they changed
+	tableStatsInterval = time.Minute
+)
+
+// TableStats is what applying a table's changes has taken: its rows per
+// second over the last minute, and totals since they were first kept.
+// Failed batches count against every table in them.
+type TableStats struct {
+	Table          string     `json:"table"`
+	RowsPerSecond  float64    `json:"rows_per_second"`
+	RowsApplied    int64      `json:"rows_applied"`
+	BatchesApplied int64      `json:"batches_applied"`
+	BatchesFailed  int64      `json:"batches_failed"`
+	AvgBatchRows   float64    `json:"avg_batch_rows"`
+	LastLatencyMs  float64    `json:"last_latency_ms"` // of the last batch applied
+	LastAppliedAt  *time.Time `json:"last_applied_at,omitempty"`
+	LastFailedAt   *time.Time `json:"last_failed_at,omitempty"`
+}
+
+// tableStats keeps each table's TableStats.
+type tableStats struct {
+	mu     sync.Mutex
+	tables map[string]*tableStat
+	dirty  bool // changed since last persisted
+}
+
+type tableStat struct {
+	TableStats
+	// Rows applied in each of the last tableRateWindow seconds, by the
+	// second modulo the window
+	window [tableRateWindow]struct{ second, rows int64 }
+}
+
+func newTableStats() *tableStats {
+	return &tableStats{tables: make(map[string]*tableStat)}
+}
+
+// table returns table's stats. s.mu must be held.
+func (s *tableStats) table(table string) *tableStat {
+	t, ok := s.tables[table]
+	if !ok {
+		t = &tableStat{TableStats: TableStats{Table: table}}
+		s.tables[table] = t
+	}
+	return t
+}
+
+// applied records a batch applied with the rows of each table in it.
+func (s *tableStats) applied(rows map[string]int, latency time.Duration) {
+	now := time.Now()
+	second := now.Unix()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for table, n := range rows {
+		t := s.table(table)
+		t.RowsApplied += int64(n)
+		t.BatchesApplied++
+		t.LastLatencyMs = float64(latency.Microseconds()) / 1000
+		t.LastAppliedAt = &now
+		bucket := &t.window[second%tableRateWindow]
+		if bucket.second != second {
+			bucket.second, bucket.rows = second, 0
+		}
+		bucket.rows += int64(n)
+	}
+	s.dirty = true
+}
+
+// failed records a batch of tables that failed to apply.
+func (s *tableStats) failed(tables []string) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, table := range tables {
+		t := s.table(table)
+		t.BatchesFailed++
+		t.LastFailedAt = &now
+	}
+	s.dirty = true
+}
+
+// snapshot lists the tables' stats, the busiest first.
+func (s *tableStats) snapshot() []TableStats {
+	second := time.Now().Unix()
+	s.mu.Lock()
+	stats := make([]TableStats, 0, len(s.tables))
+	for _, t := range s.tables {
+		stat := t.TableStats
+		var rows int64
+		for _, bucket := range t.window {
+			if second-bucket.second < tableRateWindow {
+				rows += bucket.rows
+			}
+		}
+		stat.RowsPerSecond = float64(rows) / tableRateWindow
+		if stat.BatchesApplied > 0 {
+			stat.AvgBatchRows = float64(stat.RowsApplied) / float64(stat.BatchesApplied)
+		}
+		stats = append(stats, stat)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if a.RowsPerSecond != b.RowsPerSecond {
+			return a.RowsPerSecond > b.RowsPerSecond
+		}
+		if a.RowsApplied != b.RowsApplied {
+			return a.RowsApplied > b.RowsApplied
+		}
+		return a.Table < b.Table
+	})
+	return stats
+}
+
+// load adds persisted totals to the tables' stats.
+func (s *tableStats) load(persisted []TableStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, stat := range persisted {
+		t := s.table(stat.Table)
+		t.RowsApplied += stat.RowsApplied
+		t.BatchesApplied += stat.BatchesApplied
+		t.BatchesFailed += stat.BatchesFailed
+		if t.LastAppliedAt == nil {
+			t.LastLatencyMs, t.LastAppliedAt = stat.LastLatencyMs, stat.LastAppliedAt
+		}
+		if t.LastFailedAt == nil {
+			t.LastFailedAt = stat.LastFailedAt
+		}
+	}
+}
+
+// TableStats lists each table's apply statistics, the busiest first.
+func (m *Manager) TableStats() []TableStats {
+	return m.stats.tables.snapshot()
+}
+
+// loadTableStats picks up the totals persisted before the last restart.
+func (m *Manager) loadTableStats() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	value, err := m.store.GetSetting(ctx, settingTableStats)
+	if err != nil {
+		logger.Log.Warn("Failed to load persisted table stats, counting from zero", zap.Error(err))
+		return
+	}
+	if value == "" {
+		return
+	}
+	var persisted []TableStats
+	if err := json.Unmarshal([]byte(value), &persisted); err != nil {
+		logger.Log.Warn("Ignoring invalid persisted table stats", zap.Error(err))
+		return
+	}
+	m.stats.tables.load(persisted)
+}
+
+// persistTableStats writes the tables' stats to the state store every
+// tableStatsInterval they changed in, until the manager is closed. An
+// instance that applies nothing, e.g. a standby, never writes over them.
+func (m *Manager) persistTableStats() {
+	ticker := time.NewTicker(tableStatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
+			m.saveTableStats(ctx)
+			cancel()
+		}
+	}
+}
+
+func (m *Manager) saveTableStats(ctx context.Context) {
+	s := m.stats.tables
+	s.mu.Lock()
+	dirty := s.dirty
+	s.dirty = false
+	s.mu.Unlock()
+	if !dirty {
+		return
+	}
+
+	value, err := json.Marshal(s.snapshot())
+	if err == nil {
+		err = m.store.SetSetting(ctx, settingTableStats, string(value))
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.dirty = true // tried again next time
+		s.mu.Unlock()
+		logger.Log.Warn("Failed to persist table stats", zap.Error(err))
+	}
+}
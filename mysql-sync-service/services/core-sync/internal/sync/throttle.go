@@ -0,0 +1,252 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+)
+
+// settingThrottle holds apply limits changed through the API, as JSON; they
+// take precedence over config.yaml.
+const settingThrottle = "sync.apply.throttle"
+
+// ErrInvalidThrottle is returned for negative apply limits.
+var ErrInvalidThrottle = errors.New("invalid throttle")
+
+// RateLimits caps what is applied to the target per second; 0 means
+// unthrottled.
+type RateLimits struct {
+	RowsPerSecond         int `json:"rows_per_second"`
+	TransactionsPerSecond int `json:"transactions_per_second"`
+}
+
+func (r RateLimits) isZero() bool {
+	return r.RowsPerSecond == 0 && r.TransactionsPerSecond == 0
+}
+
+// Throttle is the apply limits across workers and, on top of those, of
+// single tables.
+type Throttle struct {
+	RateLimits
+	Tables map[string]RateLimits `json:"tables,omitempty"`
+}
+
+func throttleFromConfig(cfg config.SyncConfig) Throttle {
+	throttle := Throttle{RateLimits: RateLimits{
+		RowsPerSecond:         cfg.Apply.MaxRowsPerSecond,
+		TransactionsPerSecond: cfg.Apply.MaxTransactionsPerSecond,
+	}}
+	for _, table := range cfg.Tables {
+		limits := RateLimits{RowsPerSecond: table.MaxRowsPerSecond, TransactionsPerSecond: table.MaxTransactionsPerSecond}
+		if !limits.isZero() {
+			if throttle.Tables == nil {
+				throttle.Tables = make(map[string]RateLimits)
+			}
+			throttle.Tables[table.Name] = limits
+		}
+	}
+	return throttle
+}
+
+// rateLimiter is a token bucket holding up to a second's worth of tokens.
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate int       // 0 means unthrottled
+	next time.Time // when the tokens taken so far have been paid for
+}
+
+// Wait blocks until n tokens may be taken. A request for more than the
+// bucket holds waits for the requests before it and is then paid for by
+// those after it.
+func (l *rateLimiter) Wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.rate <= 0 || n <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	if earliest := now.Add(-time.Second); l.next.Before(earliest) {
+		l.next = earliest
+	}
+	start := l.next
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.rate))
+	l.mu.Unlock()
+
+	wait := start.Sub(now)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *rateLimiter) SetRate(rate int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+}
+
+// applyThrottle holds the token buckets of a Throttle. It is shared by
+// every run, so new limits apply right away.
+type applyThrottle struct {
+	mu     sync.RWMutex
+	limits Throttle
+	rows   rateLimiter
+	txns   rateLimiter
+	tables map[string]*[2]rateLimiter // rows, transactions
+}
+
+func newApplyThrottle(limits Throttle) *applyThrottle {
+	t := &applyThrottle{}
+	t.Set(limits)
+	return t
+}
+
+func (t *applyThrottle) Set(limits Throttle) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.limits = limits
+	t.rows.SetRate(limits.RowsPerSecond)
+	t.txns.SetRate(limits.TransactionsPerSecond)
+	tables := make(map[string]*[2]rateLimiter, len(limits.Tables))
+	for table, tableLimits := range limits.Tables {
+		buckets, ok := t.tables[table]
+		if !ok {
+			buckets = &[2]rateLimiter{}
+		}
+		buckets[0].SetRate(tableLimits.RowsPerSecond)
+		buckets[1].SetRate(tableLimits.TransactionsPerSecond)
+		tables[table] = buckets
+	}
+	t.tables = tables
+}
+
+func (t *applyThrottle) Limits() Throttle {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.limits
+}
+
+// Wait blocks until a target transaction writing rowsByTable may be applied.
+func (t *applyThrottle) Wait(ctx context.Context, rowsByTable map[string]int) error {
+	t.mu.RLock()
+	total := 0
+	var buckets []*[2]rateLimiter
+	var rows []int
+	for table, n := range rowsByTable {
+		total += n
+		if b, ok := t.tables[table]; ok {
+			buckets = append(buckets, b)
+			rows = append(rows, n)
+		}
+	}
+	t.mu.RUnlock()
+
+	if err := t.rows.Wait(ctx, total); err != nil {
+		return err
+	}
+	if err := t.txns.Wait(ctx, 1); err != nil {
+		return err
+	}
+	for i, b := range buckets {
+		if err := b[0].Wait(ctx, rows[i]); err != nil {
+			return err
+		}
+		if err := b[1].Wait(ctx, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadThrottle applies limits persisted by SetThrottle.
+func (m *Manager) loadThrottle() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	value, err := m.store.GetSetting(ctx, settingThrottle)
+	if err != nil {
+		logger.Log.Warn("Failed to load persisted throttle, using config", zap.Error(err))
+		return
+	}
+	if value == "" {
+		return
+	}
+	var limits Throttle
+	if err := json.Unmarshal([]byte(value), &limits); err != nil {
+		logger.Log.Warn("Ignoring invalid persisted throttle", zap.String("value", value), zap.Error(err))
+		return
+	}
+	logger.Log.Info("Using persisted throttle", zap.String("throttle", value))
+	m.throttle.Set(limits)
+}
+
+// SetThrottle replaces the apply limits and persists them so they survive
+// restarts.
+func (m *Manager) SetThrottle(ctx context.Context, limits Throttle) error {
+	limits, err := m.checkThrottle(limits)
+	if err != nil {
+		return err
+	}
+	value, err := m.persistThrottle(ctx, limits)
+	if err != nil {
+		return err
+	}
+	m.throttle.Set(limits)
+	logger.For(ctx).Info("Throttle changed", zap.String("throttle", value))
+	return nil
+}
+
+// checkThrottle validates limits and drops the tables' zero ones.
+func (m *Manager) checkThrottle(limits Throttle) (Throttle, error) {
+	if limits.RowsPerSecond < 0 || limits.TransactionsPerSecond < 0 {
+		return limits, fmt.Errorf("%w: limits can't be negative", ErrInvalidThrottle)
+	}
+	tables := make(map[string]RateLimits, len(limits.Tables))
+	for table, tableLimits := range limits.Tables {
+		if !m.hasTable(table) {
+			return limits, fmt.Errorf("%w: %s", ErrUnknownTable, table)
+		}
+		if tableLimits.RowsPerSecond < 0 || tableLimits.TransactionsPerSecond < 0 {
+			return limits, fmt.Errorf("%w: limits of %s can't be negative", ErrInvalidThrottle, table)
+		}
+		if !tableLimits.isZero() {
+			tables[table] = tableLimits
+		}
+	}
+	limits.Tables = tables
+	return limits, nil
+}
+
+// persistThrottle writes limits to the state store and returns them as
+// written.
+func (m *Manager) persistThrottle(ctx context.Context, limits Throttle) (string, error) {
+	value, err := json.Marshal(limits)
+	if err != nil {
+		return "", err
+	}
+	if err := m.store.SetSetting(ctx, settingThrottle, string(value)); err != nil {
+		return "", fmt.Errorf("failed to persist throttle: %w", err)
+	}
+	return string(value), nil
+}
+
+// Throttle reports the apply limits in effect.
+func (m *Manager) Throttle() Throttle {
+	return m.throttle.Limits()
+}
@@ -0,0 +1,260 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"mysql-sync-service/internal/config"
+	"mysql-sync-service/internal/logger"
+)
+
+// settingTuning holds the tuning settings changed through the admin API,
+// as JSON of those changed; they take precedence over config.yaml.
+const settingTuning = "sync.tuning"
+
+// ErrInvalidTuning is returned for negative or unparsable tuning settings.
+var ErrInvalidTuning = errors.New("invalid tuning")
+
+// Tuning is the worker pool and queue settings that can change while a
+// sync runs, without stopping it.
+type Tuning struct {
+	Workers         int    `json:"workers"`
+	BatchInsertSize int    `json:"batch_insert_size"`
+	FlushInterval   string `json:"flush_interval"`
+	QueueCapacity   int    `json:"queue_capacity"`
+}
+
+func tuningFromConfig(cfg config.SyncConfig) Tuning {
+	capacity := cfg.Queue.Capacity
+	if capacity <= 0 {
+		capacity = defaultQueueCapacity
+	}
+	return Tuning{
+		Workers:         cfg.Workers,
+		BatchInsertSize: cfg.BatchInsertSize,
+		FlushInterval:   cfg.GetFlushInterval().String(),
+		QueueCapacity:   capacity,
+	}
+}
+
+// apply overlays the tuning on a run's sync config.
+func (t Tuning) apply(cfg config.SyncConfig) config.SyncConfig {
+	cfg.Workers = t.Workers
+	cfg.BatchInsertSize = t.BatchInsertSize
+	cfg.FlushInterval = t.FlushInterval
+	cfg.Queue.Capacity = t.QueueCapacity
+	return cfg
+}
+
+// merge returns t with the non-zero settings of change.
+func (t Tuning) merge(change Tuning) (Tuning, error) {
+	if change.Workers < 0 || change.BatchInsertSize < 0 || change.QueueCapacity < 0 {
+		return t, fmt.Errorf("%w: settings can't be negative", ErrInvalidTuning)
+	}
+	if change.FlushInterval != "" {
+		d, err := time.ParseDuration(change.FlushInterval)
+		if err != nil || d <= 0 {
+			return t, fmt.Errorf("%w: flush_interval %q isn't a positive duration", ErrInvalidTuning, change.FlushInterval)
+		}
+		t.FlushInterval = d.String()
+	}
+	if change.Workers > 0 {
+		t.Workers = change.Workers
+	}
+	if change.BatchInsertSize > 0 {
+		t.BatchInsertSize = change.BatchInsertSize
+	}
+	if change.QueueCapacity > 0 {
+		t.QueueCapacity = change.QueueCapacity
+	}
+	return t, nil
+}
+
+// Tuning reports the settings runs use; with scaling on, the running pool
+// may have grown or shrunk from Workers.
+func (m *Manager) Tuning() Tuning {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tuning
+}
+
+// SetTuning changes the settings given, zero ones keeping theirs, for the
+// running sync and later ones. The running worker pool is rebuilt once its
+// workers have applied what was dispatched to them, and the queue delivers
+// what it holds before taking more, so no event is lost or reordered. The
+// change lasts until the service restarts or its config is reloaded.
+func (m *Manager) SetTuning(ctx context.Context, change Tuning) (Tuning, error) {
+	m.mu.Lock()
+	tuning, err := m.tuning.merge(change)
+	if err != nil {
+		m.mu.Unlock()
+		return m.tuning, err
+	}
+	m.tuning = tuning
+	pool, queue := m.workerPool, m.queue
+	if m.run == nil || (m.stats.state() != "running" && m.stats.state() != "paused") {
+		pool, queue = nil, nil
+	}
+	m.mu.Unlock()
+	logger.For(ctx).Info("Tuning changed", zap.Int("workers", tuning.Workers), zap.Int("batch_insert_size", tuning.BatchInsertSize), zap.String("flush_interval", tuning.FlushInterval), zap.Int("queue_capacity", tuning.QueueCapacity))
+
+	if queue != nil {
+		queue.Resize(tuning.QueueCapacity)
+	}
+	if pool == nil {
+		return tuning, nil
+	}
+	flushInterval, _ := time.ParseDuration(tuning.FlushInterval)
+	err = pool.Reconfigure(ctx, poolChange{workers: tuning.Workers, batchSize: tuning.BatchInsertSize, flushInterval: flushInterval})
+	if err != nil && !errors.Is(err, errPoolStopped) {
+		return tuning, fmt.Errorf("failed to reconfigure worker pool: %w", err)
+	}
+	return tuning, nil
+}
+
+// ReloadTuning applies the tuning settings of a reloaded config, but for
+// those persisted through UpdateSyncSettings.
+func (m *Manager) ReloadTuning(ctx context.Context, cfg config.SyncConfig) (Tuning, error) {
+	m.mu.Lock()
+	persisted := m.tuned
+	m.configured = tuningFromConfig(cfg)
+	m.mu.Unlock()
+	tuning, err := tuningFromConfig(cfg).merge(persisted)
+	if err != nil {
+		return m.Tuning(), err
+	}
+	return m.SetTuning(ctx, tuning)
+}
+
+// SyncSettings is the sync settings that can be tuned at runtime: the
+// worker pool and queue settings and the apply limits.
+type SyncSettings struct {
+	Tuning
+	Throttle Throttle `json:"throttle"`
+}
+
+// SyncSettingsChange changes the settings given; zero ones keep theirs,
+// and Throttle, if set, replaces the apply limits.
+type SyncSettingsChange struct {
+	Tuning
+	Throttle *Throttle `json:"throttle"`
+}
+
+// SyncSettings reports the tuning and apply limits in effect.
+func (m *Manager) SyncSettings() SyncSettings {
+	return SyncSettings{Tuning: m.Tuning(), Throttle: m.Throttle()}
+}
+
+// UpdateSyncSettings changes the tuning and apply limits given, applies
+// them to the running sync as SetTuning and SetThrottle do, and persists
+// them so they survive restarts and config reloads. Both are checked and
+// persisted before either is applied, so a change that fails leaves the
+// settings in effect as they were.
+func (m *Manager) UpdateSyncSettings(ctx context.Context, change SyncSettingsChange) (SyncSettings, error) {
+	m.mu.Lock()
+	_, err := m.tuning.merge(change.Tuning)
+	previous := m.tuned
+	persisted, _ := m.tuned.merge(change.Tuning)
+	m.mu.Unlock()
+	if err != nil {
+		return m.SyncSettings(), err
+	}
+	var limits Throttle
+	if change.Throttle != nil {
+		if limits, err = m.checkThrottle(*change.Throttle); err != nil {
+			return m.SyncSettings(), err
+		}
+	}
+
+	if err := m.persistTuning(ctx, persisted); err != nil {
+		return m.SyncSettings(), err
+	}
+	var throttle string
+	if change.Throttle != nil {
+		if throttle, err = m.persistThrottle(ctx, limits); err != nil {
+			if err := m.persistTuning(ctx, previous); err != nil {
+				logger.For(ctx).Warn("Failed to restore persisted tuning", zap.Error(err))
+			}
+			return m.SyncSettings(), err
+		}
+	}
+
+	m.mu.Lock()
+	m.tuned = persisted
+	m.mu.Unlock()
+	if change.Throttle != nil {
+		m.throttle.Set(limits)
+		logger.For(ctx).Info("Throttle changed", zap.String("throttle", throttle))
+	}
+	if _, err := m.SetTuning(ctx, change.Tuning); err != nil {
+		return m.SyncSettings(), err
+	}
+	return m.SyncSettings(), nil
+}
+
+// ResetSyncSettings drops the tuning and apply limits persisted through
+// UpdateSyncSettings and SetThrottle, and goes back to those of
+// config.yaml for the running sync and later ones.
+func (m *Manager) ResetSyncSettings(ctx context.Context) (SyncSettings, error) {
+	// loadTuning and loadThrottle take an empty setting for none
+	if err := m.store.SetSetting(ctx, settingTuning, ""); err != nil {
+		return m.SyncSettings(), fmt.Errorf("failed to reset tuning: %w", err)
+	}
+	if err := m.store.SetSetting(ctx, settingThrottle, ""); err != nil {
+		return m.SyncSettings(), fmt.Errorf("failed to reset throttle: %w", err)
+	}
+
+	m.mu.Lock()
+	m.tuned = Tuning{}
+	configured := m.configured
+	m.mu.Unlock()
+	m.throttle.Set(throttleFromConfig(m.cfg.Sync))
+	logger.For(ctx).Info("Sync settings reset to config")
+	if _, err := m.SetTuning(ctx, configured); err != nil {
+		return m.SyncSettings(), err
+	}
+	return m.SyncSettings(), nil
+}
+
+func (m *Manager) persistTuning(ctx context.Context, tuned Tuning) error {
+	value, err := json.Marshal(tuned)
+	if err != nil {
+		return err
+	}
+	if err := m.store.SetSetting(ctx, settingTuning, string(value)); err != nil {
+		return fmt.Errorf("failed to persist tuning: %w", err)
+	}
+	return nil
+}
+
+// loadTuning applies tuning settings persisted by UpdateSyncSettings.
+func (m *Manager) loadTuning() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	value, err := m.store.GetSetting(ctx, settingTuning)
+	if err != nil {
+		logger.Log.Warn("Failed to load persisted tuning, using config", zap.Error(err))
+		return
+	}
+	if value == "" {
+		return
+	}
+	var persisted Tuning
+	if err := json.Unmarshal([]byte(value), &persisted); err != nil {
+		logger.Log.Warn("Ignoring invalid persisted tuning", zap.String("value", value), zap.Error(err))
+		return
+	}
+	tuning, err := m.tuning.merge(persisted)
+	if err != nil {
+		logger.Log.Warn("Ignoring invalid persisted tuning", zap.String("value", value), zap.Error(err))
+		return
+	}
+	logger.Log.Info("Using persisted tuning", zap.String("tuning", value))
+	m.tuning, m.tuned = tuning, persisted
+}
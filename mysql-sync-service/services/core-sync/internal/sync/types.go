@@ -2,6 +2,7 @@ package sync
 
 import (
 	"fmt"
+	"strings"
 )
 
 type EventType string
@@ -10,16 +11,86 @@ const (
 	Insert EventType = "INSERT"
 	Update EventType = "UPDATE"
 	Delete EventType = "DELETE"
+	// Group carries the changes a source transaction made to the tables of
+	// one sync group; Table holds the group name. With transactions
+	// preserved it also carries the rest of the transaction, and Table
+	// holds its tables joined by "+".
+	Group EventType = "GROUP"
 )
 
 type BinlogEvent struct {
-	Type      EventType
-	Schema    string
-	Table     string
-	Rows      [][]interface{} // For Insert/Delete, or Update (old/new pairs)
-	Timestamp uint32
-	BinlogFile string
-	BinlogPos  uint32
+	Type        EventType
+	Schema      string
+	Table       string
+	Rows        [][]interface{} // Inserted or deleted rows, or the new image of updated ones
+	Before      [][]interface{} // Update only: the old image of each of Rows
+	Timestamp   uint32
+	BinlogFile  string
+	BinlogPos   uint32
+	Size        int64 // Approximate in-memory size, used for buffer accounting
+	GTID        string
+	PrimaryKeys []string // Formatted primary key of each affected row, for logging
+	Columns     []string // Source column names, in row value order
+	ColumnTypes []string // Source column types, e.g. "tinyint(1)", in row value order
+	KeyColumns  []string // Source primary key column names
+	Generated   []string // Source generated columns, which the target computes itself
+	Source      SourceInfo
+	Members     []BinlogEvent // Group events only, in binlog order
+	// SchemaVersion is the stored version of the table schema the rows
+	// were read under, set by workers; 0 if unknown
+	SchemaVersion int
+}
+
+// EventColumn describes one column of an event's rows.
+type EventColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"` // Source column type, e.g. "tinyint(1)"
+	Key  bool   `json:"key,omitempty"`  // Part of the source primary key
+}
+
+// ColumnMeta describes the event's columns in row value order, from the
+// source table's schema as the rows were read.
+func (e BinlogEvent) ColumnMeta() []EventColumn {
+	columns := make([]EventColumn, len(e.Columns))
+	for i, name := range e.Columns {
+		columns[i].Name = name
+		if i < len(e.ColumnTypes) {
+			columns[i].Type = e.ColumnTypes[i]
+		}
+		for _, key := range e.KeyColumns {
+			if strings.EqualFold(key, name) {
+				columns[i].Key = true
+			}
+		}
+	}
+	return columns
+}
+
+// SourceInfo identifies the server a change was read from.
+type SourceInfo struct {
+	SiteID     string
+	Host       string
+	ServerUUID string
+}
+
+// checkImages reports an update whose old and new row images don't pair up.
+func (e BinlogEvent) checkImages() error {
+	if e.Type == Update && len(e.Before) != len(e.Rows) {
+		return fmt.Errorf("update event has %d old row images for %d new ones", len(e.Before), len(e.Rows))
+	}
+	return nil
+}
+
+// splitUpdateRows splits canal's update rows, pairs of old and new images,
+// into the old images and the new ones.
+func splitUpdateRows(rows [][]interface{}) (before, after [][]interface{}) {
+	before = make([][]interface{}, 0, len(rows)/2)
+	after = make([][]interface{}, 0, len(rows)/2)
+	for i := 0; i+1 < len(rows); i += 2 {
+		before = append(before, rows[i])
+		after = append(after, rows[i+1])
+	}
+	return before, after
 }
 
 func (e BinlogEvent) String() string {
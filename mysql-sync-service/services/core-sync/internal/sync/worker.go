@@ -3,98 +3,328 @@ package sync
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
 
+	"mysql-sync-service/internal/alerting"
 	"mysql-sync-service/internal/config"
 	"mysql-sync-service/internal/database"
 	"mysql-sync-service/internal/logger"
+	"mysql-sync-service/internal/metrics"
 	"mysql-sync-service/internal/store"
 )
 
 type WorkerPool struct {
-	workers    []*Worker
-	eventChan  <-chan BinlogEvent
-	targetDB   *database.Database
-	store      store.Store
-	ctx        context.Context
-	cancel     context.CancelFunc
-	wg         sync.WaitGroup
-	batchSize  int
+	workers   []*Worker
+	queue     eventQueue
+	sinks     []Sink
+	breakers  []*circuitBreaker // one per sink
+	store     *storeBuffer
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	chunkRows int
+	run       *syncRun
+	groups    map[string]bool // sync group names
+	fk        *fkGraph        // nil unless foreign keys are ordered
+
+	// Given to new workers; changed only by dispatch, through reconfigure
+	batchSize     int
+	flushInterval time.Duration
+	reconfigure   chan poolChange
+
+	// Scaling, when enabled, resizes workers through dispatch
+	scaling    config.WorkerScalingConfig
+	minWorkers int
+	maxWorkers int
+	resize     chan int
+	size       atomic.Int32
+	latency    applyLatency
+	dispatched chan struct{} // closed when dispatch returns
 }
 
-func NewWorkerPool(cfg config.SyncConfig, targetDB *database.Database, store store.Store, eventChan <-chan BinlogEvent) *WorkerPool {
+func NewWorkerPool(cfg config.SyncConfig, targetDB *database.Database, stateWrites *storeBuffer, queue eventQueue, run *syncRun) (*WorkerPool, error) {
+	sinks, err := newSinks(cfg, targetDB, run)
+	if err != nil {
+		return nil, err
+	}
+
+	breakers := make([]*circuitBreaker, len(sinks))
+	for i, sink := range sinks {
+		breakers[i] = newCircuitBreaker(cfg.CircuitBreaker, sink)
+	}
+
+	groups := make(map[string]bool, len(cfg.Groups))
+	for _, group := range cfg.Groups {
+		groups[group.Name] = true
+	}
+
+	var fk *fkGraph
+	switch cfg.GetForeignKeys() {
+	case ForeignKeysOrder:
+		if targetDB == nil {
+			break
+		}
+		// Without the graph tables are applied independently, as before
+		if fk, err = loadFKGraph(context.Background(), targetDB, cfg.Tables); err != nil {
+			logger.Log.Warn("Failed to read target foreign keys, applying tables independently", zap.Error(err))
+		} else if components := fk.components(); len(components) > 0 {
+			logger.Log.Info("Applying tables linked by foreign keys together", zap.Strings("tables", components))
+		}
+	case ForeignKeysDisable, ForeignKeysIgnore:
+	default:
+		closeSinks(sinks)
+		return nil, fmt.Errorf("unknown foreign_keys mode %q", cfg.ForeignKeys)
+	}
+
+	workers := cfg.Workers
+	minWorkers, maxWorkers := workers, workers
+	if cfg.Scaling.Enabled {
+		minWorkers, maxWorkers = cfg.Scaling.GetMinWorkers(), cfg.Scaling.GetMaxWorkers(workers)
+		workers = min(max(workers, minWorkers), maxWorkers)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
-	
+
 	pool := &WorkerPool{
-		workers:   make([]*Worker, cfg.Workers),
-		eventChan: eventChan,
-		targetDB:  targetDB,
-		store:     store,
+		workers:   make([]*Worker, workers),
+		queue:     queue,
+		sinks:     sinks,
+		breakers:  breakers,
+		store:     stateWrites,
 		ctx:       ctx,
 		cancel:    cancel,
-		batchSize: cfg.BatchInsertSize,
+		chunkRows: cfg.Apply.GetChunkRows(),
+		run:       run,
+		groups:    groups,
+		fk:        fk,
+
+		batchSize:     cfg.BatchInsertSize,
+		flushInterval: cfg.GetFlushInterval(),
+		reconfigure:   make(chan poolChange),
+
+		scaling:    cfg.Scaling,
+		minWorkers: minWorkers,
+		maxWorkers: maxWorkers,
+		resize:     make(chan int, 1),
+		dispatched: make(chan struct{}),
 	}
-	
-	for i := 0; i < cfg.Workers; i++ {
+
+	for i := 0; i < workers; i++ {
 		pool.workers[i] = newWorker(i, pool)
 	}
-	
-	return pool
+	pool.size.Store(int32(workers))
+
+	return pool, nil
 }
 
 func (p *WorkerPool) Start() {
 	logger.Log.Info("Starting worker pool", zap.Int("workers", len(p.workers)))
+	metrics.Workers.Set(float64(len(p.workers)))
 	for _, w := range p.workers {
 		p.wg.Add(1)
 		go w.run()
 	}
+	p.wg.Add(1)
+	go p.dispatch()
+	if p.scaling.Enabled {
+		logger.Log.Info("Scaling worker pool with load", zap.Int("min_workers", p.minWorkers), zap.Int("max_workers", p.maxWorkers))
+		p.wg.Add(1)
+		go p.scale()
+	}
 }
 
+// dispatch hands all events of a table, or of a sync group, to the same
+// worker so they are applied in binlog order, which the target checkpoints
+// rely on. A busy table is therefore applied by one worker at a time.
+//
+// A preserved transaction spanning several tables goes to the worker of its
+// first table, and the workers of its other tables get a fence: they apply
+// what they have, wait for the transaction to be applied, then carry on.
+func (p *WorkerPool) dispatch() {
+	defer p.wg.Done()
+	defer close(p.dispatched)
+	defer func() {
+		for _, w := range p.workers {
+			close(w.items)
+		}
+	}()
+
+	events := p.queue.Events()
+	for {
+		select {
+		case workers := <-p.resize:
+			if !p.resizeTo(workers) {
+				return
+			}
+		case change := <-p.reconfigure:
+			ok := p.reconfigureTo(change)
+			close(change.done)
+			if !ok {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				// A resized queue closes the old channel once it is drained
+				if next := p.queue.Events(); next != events {
+					events = next
+					continue
+				}
+				return
+			}
+			for _, item := range p.route(event) {
+				select {
+				case p.workers[item.worker].items <- item.workItem:
+				case <-p.ctx.Done():
+					return
+				}
+			}
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+type routedItem struct {
+	workItem
+	worker int
+}
+
+func (p *WorkerPool) route(event BinlogEvent) []routedItem {
+	if event.Type != Group || p.groups[event.Table] {
+		return []routedItem{{workItem{event: event}, p.workerFor(event.Table)}}
+	}
+
+	tables := memberTables(event.Members)
+	owner := p.workerFor(tables[0])
+	if len(tables) == 1 {
+		return []routedItem{{workItem{event: event}, owner}}
+	}
+
+	// Even with no other workers involved the transaction is applied on
+	// its own, since a batch's tables are applied in no particular order
+	others := make(map[int]bool)
+	for _, table := range tables[1:] {
+		if i := p.workerFor(table); i != owner {
+			others[i] = true
+		}
+	}
+	fence := &txnFence{applied: make(chan struct{})}
+	fence.arrived.Add(len(others))
+	items := []routedItem{{workItem{event: event, fence: fence}, owner}}
+	for i := range others {
+		items = append(items, routedItem{workItem{fence: fence}, i})
+	}
+	return items
+}
+
+// txnFence orders a transaction against the other workers of its tables.
+// Workers take items in dispatch order, so fences can't wait on each other.
+type txnFence struct {
+	arrived sync.WaitGroup // the other workers applied what came before
+	applied chan struct{}  // closed once the owner applied the transaction
+}
+
+// workItem is an event, a fence, or an event its worker applies once the
+// fence's other workers arrived. A barrier is acked once the worker has
+// applied everything before it.
+type workItem struct {
+	event   BinlogEvent
+	fence   *txnFence
+	barrier chan<- struct{}
+}
+
+// workerFor picks the worker of a table, of the tables it is linked to by
+// foreign keys, or of a sync group.
+func (p *WorkerPool) workerFor(table string) int {
+	return workerIndex(p.fk.key(table), len(p.workers))
+}
+
+func workerIndex(table string, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(table))
+	return int(h.Sum32() % uint32(workers))
+}
+
+// Stop lets the workers apply what is left in the queue, which must be
+// closed first, for up to drainTimeout before cancelling them.
 func (p *WorkerPool) Stop() {
+	drained := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(drainTimeout):
+		logger.Log.Warn("Workers did not drain the queue in time, cancelling", zap.String("run_id", p.run.id))
+		p.cancel()
+		<-drained
+	}
 	p.cancel()
-	p.wg.Wait()
+	closeSinks(p.sinks)
 	logger.Log.Info("Stopped worker pool")
 }
 
 type Worker struct {
-	id    int
-	pool  *WorkerPool
-	batch []BinlogEvent
+	id            int
+	pool          *WorkerPool
+	items         chan workItem
+	batch         []BinlogEvent
+	batchSize     int
+	flushInterval time.Duration
 }
 
 func newWorker(id int, pool *WorkerPool) *Worker {
 	return &Worker{
-		id:   id,
-		pool: pool,
+		id:            id,
+		pool:          pool,
+		items:         make(chan workItem, pool.batchSize),
+		batchSize:     pool.batchSize,
+		flushInterval: pool.flushInterval,
 	}
 }
 
 func (w *Worker) run() {
 	defer w.pool.wg.Done()
-	
-	ticker := time.NewTicker(500 * time.Millisecond) // Flush batch every 500ms
+
+	ticker := time.NewTicker(w.flushInterval)
 	defer ticker.Stop()
-	
+
 	for {
 		select {
-		case event, ok := <-w.pool.eventChan:
+		case item, ok := <-w.items:
 			if !ok {
 				w.processBatch() // Flush remaining
 				return
 			}
-			w.batch = append(w.batch, event)
-			if len(w.batch) >= w.pool.batchSize {
+			if item.barrier != nil {
 				w.processBatch()
+				item.barrier <- struct{}{}
+				continue
+			}
+			if item.fence != nil {
+				w.processFence(item)
+				continue
 			}
-			
+			w.batch = append(w.batch, item.event)
+			if len(w.batch) >= w.batchSize {
+				w.processBatch()
+			}
+
 		case <-ticker.C:
 			if len(w.batch) > 0 {
 				w.processBatch()
 			}
-			
+
 		case <-w.pool.ctx.Done():
 			w.processBatch() // Flush remaining
 			return
@@ -102,72 +332,264 @@ func (w *Worker) run() {
 	}
 }
 
+// processFence applies the batch so far, then either waits for the fenced
+// transaction or, on its owner, applies it on its own once every other
+// worker has arrived.
+func (w *Worker) processFence(item workItem) {
+	w.processBatch()
+
+	fence := item.fence
+	if item.event.Type == "" {
+		fence.arrived.Done()
+		select {
+		case <-fence.applied:
+		case <-w.pool.ctx.Done():
+		}
+		return
+	}
+
+	defer close(fence.applied)
+	arrived := make(chan struct{})
+	go func() {
+		fence.arrived.Wait()
+		close(arrived)
+	}()
+	select {
+	case <-arrived:
+	case <-w.pool.ctx.Done():
+		return
+	}
+	w.batch = append(w.batch, item.event)
+	w.processBatch()
+}
+
 func (w *Worker) processBatch() {
 	if len(w.batch) == 0 {
 		return
 	}
-	
-	logger.Log.Debug("Processing batch", zap.Int("workerID", w.id), zap.Int("size", len(w.batch)))
-	
-	// Group events by table to optimize transactions
-	eventsByTable := make(map[string][]BinlogEvent)
+
+	logger.Log.Debug("Processing batch",
+		zap.String("run_id", w.pool.run.id),
+		zap.Int("workerID", w.id),
+		zap.Int("size", len(w.batch)),
+	)
+
+	for i := range w.batch {
+		w.pool.run.schemas.Stamp(w.pool.ctx, &w.batch[i])
+		w.pool.run.policies.apply(&w.batch[i])
+	}
+
+	// Group events by table to optimize transactions. Sync groups are
+	// unpacked under the group name so their tables share one transaction,
+	// as are tables linked by foreign keys. A group stays one unit, which
+	// chunking never splits.
+	unitsByTable := make(map[string][][]BinlogEvent)
 	for _, e := range w.batch {
-		eventsByTable[e.Table] = append(eventsByTable[e.Table], e)
+		key := w.pool.fk.key(e.Table)
+		if e.Type == Group {
+			unitsByTable[key] = append(unitsByTable[key], e.Members)
+			continue
+		}
+		unitsByTable[key] = append(unitsByTable[key], []BinlogEvent{e})
 	}
-	
-	for table, events := range eventsByTable {
-		err := w.applyChanges(table, events)
-		if err != nil {
-			logger.Log.Error("Failed to apply changes", 
-				zap.Int("workerID", w.id),
-				zap.String("table", table),
-				zap.Error(err),
-			)
-			// TODO: Handle error properly (retry, DLQ, etc.)
-			// For now, we log and continue, but in real world we might want to stop or retry
-		} else {
-			// Update sync state
-			lastEvent := events[len(events)-1]
-			w.updateState(table, lastEvent)
+
+	for key, units := range unitsByTable {
+		for _, events := range chunkUnits(units, w.pool.chunkRows) {
+			w.applyTable(key, events)
 		}
 	}
-	
+
+	// Hand the memory back to the listener
+	var batchBytes int64
+	for _, e := range w.batch {
+		batchBytes += e.Size
+	}
+	w.pool.run.budget.Release(batchBytes)
+	w.pool.run.stats.Processed(len(w.batch))
+
 	// Clear batch
 	w.batch = w.batch[:0]
 }
 
+// chunkUnits joins units into chunks of at most maxRows rows, in order; a
+// unit larger than that is a chunk of its own.
+func chunkUnits(units [][]BinlogEvent, maxRows int) [][]BinlogEvent {
+	var chunks [][]BinlogEvent
+	var chunk []BinlogEvent
+	chunkRows := 0
+	for _, unit := range units {
+		rows := 0
+		for _, e := range unit {
+			rows += eventRows(e)
+		}
+		if len(chunk) > 0 && chunkRows+rows > maxRows {
+			chunks = append(chunks, chunk)
+			chunk, chunkRows = nil, 0
+		}
+		chunk = append(chunk, unit...)
+		chunkRows += rows
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// applyTable applies the events of a table, sync group or foreign key
+// component in one target transaction, within the throttle's limits.
+func (w *Worker) applyTable(key string, events []BinlogEvent) {
+	table := key
+	if tables := memberTables(events); len(tables) == 1 && key != tables[0] && w.pool.fk.key(tables[0]) == key {
+		// Only one table of its foreign key component
+		table = tables[0]
+	} else {
+		events = w.pool.fk.order(events)
+	}
+
+	rows := make(map[string]int)
+	for _, e := range events {
+		rows[e.Table] += eventRows(e)
+	}
+	var latency time.Duration
+	err := w.pool.run.throttle.Wait(w.pool.ctx, rows)
+	if err == nil {
+		release := w.pool.run.resyncs.hold(events)
+		started := time.Now()
+		err = w.applyChanges(table, events)
+		latency = time.Since(started)
+		w.pool.latency.observe(latency)
+		release(err == nil)
+	}
+	if err != nil {
+		logger.Log.Error("Failed to apply changes",
+			append(batchFields(w.pool.run.id, table, events),
+				zap.Int("workerID", w.id),
+				zap.Error(err),
+			)...,
+		)
+		w.pool.run.alerts.Fire(alerting.Alert{
+			Kind:     alerting.KindSyncFailure,
+			Severity: alerting.SeverityCritical,
+			Subject:  table,
+			Title:    fmt.Sprintf("Failed to apply changes to %s", table),
+			Message:  err.Error(),
+			Fields:   map[string]string{"table": table, "events": strconv.Itoa(len(events))},
+		})
+		w.pool.run.events.publish(SyncEvent{
+			Type:       EventBatchFailed,
+			RunID:      w.pool.run.id,
+			Table:      table,
+			Events:     len(events),
+			Error:      err.Error(),
+			SourceSite: events[len(events)-1].Source.SiteID,
+		})
+		if w.pool.run.observed == nil {
+			w.deadLetter(events, err)
+		}
+		var collision *uniqueKeyError
+		if w.pool.run.conflicts != nil && errors.As(err, &collision) {
+			w.pool.run.conflicts.recordUniqueKeyConflicts(w.pool.ctx, collision)
+		}
+		w.pool.run.progress.Failed(events)
+		w.pool.run.stats.Failed(events)
+		w.pool.run.health.RecordFailure(fmt.Sprintf("failed to apply changes to %s: %v", table, err))
+	} else {
+		w.pool.run.health.RecordSuccess()
+		w.pool.run.progress.Applied(events)
+		w.pool.run.audit.record(w.pool.ctx, w.pool.run.id, w.id, events, latency)
+		// Update sync state of each table in the batch
+		last := lastEventPerTable(events)
+		w.pool.run.stats.Applied(events, last, latency)
+		var status string
+		for _, tableEvent := range last {
+			status = w.pool.run.lag.Observe(tableEvent.Table, tableEvent.Timestamp)
+			if w.pool.run.observed == nil {
+				// An observing run leaves the next run to start where this one did
+				w.updateState(tableEvent.Table, tableEvent, status, rows[tableEvent.Table])
+			}
+		}
+		lastEvent := events[len(events)-1]
+		w.pool.run.events.publish(SyncEvent{
+			Type:       EventBatchApplied,
+			RunID:      w.pool.run.id,
+			Table:      table,
+			Status:     status,
+			Events:     len(events),
+			BinlogFile: lastEvent.BinlogFile,
+			BinlogPos:  lastEvent.BinlogPos,
+			SourceSite: lastEvent.Source.SiteID,
+		})
+	}
+}
+
+// applyChanges hands the batch to every sink in turn. A failing sink fails
+// the batch; sinks before it have already applied it. While a sink's
+// circuit is open the batch is held and retried once it closes.
 func (w *Worker) applyChanges(table string, events []BinlogEvent) error {
-	// Execute in transaction
-	return w.pool.targetDB.ExecTx(w.pool.ctx, func(tx *sql.Tx) error {
-		// Note: database.SQLTx needs to be defined or we use sql.Tx
-		// I used *sql.Tx in ExecTx signature in database package.
-		// Let's assume database.ExecTx passes *sql.Tx
-		
-		// TODO: Implement actual SQL generation and execution
-		// This requires constructing INSERT/UPDATE/DELETE statements based on event data
-		// This is complex because we need to know schema (columns).
-		// For now, I'll leave a placeholder implementation.
-		
-		for _, e := range events {
-			// Construct query based on e.Type and e.Rows
-			// ...
-			_ = e
-		}
-		return nil
-	})
-}
-
-func (w *Worker) updateState(table string, lastEvent BinlogEvent) {
+	for i, sink := range w.pool.sinks {
+		breaker := w.pool.breakers[i]
+		for {
+			if err := breaker.Wait(w.pool.ctx); err != nil {
+				return fmt.Errorf("%s sink: %w", sink.Name(), err)
+			}
+			err := sink.Apply(w.pool.ctx, table, events)
+			if err == nil {
+				breaker.RecordSuccess()
+				break
+			}
+			if w.pool.ctx.Err() != nil || !breaker.RecordFailure(w.pool.ctx, err) {
+				return fmt.Errorf("%s sink: %w", sink.Name(), err)
+			}
+			w.pool.run.health.RecordFailure(fmt.Sprintf("%s sink unavailable: %v", sink.Name(), err))
+		}
+	}
+	return nil
+}
+
+// Breakers reports the circuit breaker of every sink.
+func (p *WorkerPool) Breakers() []CircuitStatus {
+	statuses := make([]CircuitStatus, len(p.breakers))
+	for i, breaker := range p.breakers {
+		statuses[i] = breaker.Snapshot()
+	}
+	return statuses
+}
+
+// lastEventPerTable returns the last event of each table, in order of first
+// appearance; a sync group's batch spans several tables.
+func lastEventPerTable(events []BinlogEvent) []BinlogEvent {
+	index := make(map[string]int)
+	var last []BinlogEvent
+	for _, e := range events {
+		if i, ok := index[e.Table]; ok {
+			last[i] = e
+			continue
+		}
+		index[e.Table] = len(last)
+		last = append(last, e)
+	}
+	return last
+}
+
+// updateState checkpoints table at lastEvent, having applied rows more.
+func (w *Worker) updateState(table string, lastEvent BinlogEvent, status string, rows int) {
 	state := &store.SyncState{
 		TableName:      table,
 		BinlogFile:     sql.NullString{String: lastEvent.BinlogFile, Valid: true},
 		BinlogPosition: sql.NullInt64{Int64: int64(lastEvent.BinlogPos), Valid: true},
 		LastSyncTime:   sql.NullTime{Time: time.Unix(int64(lastEvent.Timestamp), 0), Valid: true},
-		RowsSynced:     0, // Increment this properly
-		Status:         "running",
+		RowsSynced:     w.pool.run.rows.add(w.pool.ctx, table, rows),
+		Status:         status,
+	}
+
+	// Held and retried while the state store is down, so replication
+	// carries on; the buffer reports the failure in metrics and health
+	if err := w.pool.store.UpdateSyncState(w.pool.ctx, state); err != nil {
+		logger.Log.Debug("Checkpoint not persisted, holding it for retry",
+			zap.String("table", table),
+			zap.String("binlog_file", lastEvent.BinlogFile),
+			zap.Uint32("binlog_pos", lastEvent.BinlogPos),
+			zap.Error(err),
+		)
 	}
-	// We need helper to convert to Null types or just use sql.NullString etc.
-	// I'll skip detailed conversion implementation for brevity.
-	
-	_ = w.pool.store.UpdateSyncState(w.pool.ctx, state)
 }